@@ -0,0 +1,76 @@
+// Package admin, as part of the admin module.
+// This file, `dto.go`, defines the request and response bodies of user management and the
+// moderation queues.
+package admin
+
+import (
+	"time"
+
+	"github.com/user/lensisku-go/validation"
+)
+
+// UserListQuery filters the accounts; zero fields don't filter.
+type UserListQuery struct {
+	Role string `form:"role" validate:"omitempty,oneof=user trusted admin"`
+	// Start of the username or the email address
+	Query string `form:"q" validate:"max=100"`
+	validation.Pagination
+}
+
+// User is an account as admins see it.
+// @Description A user account, with its role and auth source
+type User struct {
+	// example: 42
+	ID int32 `json:"id"`
+	// example: "selpa'i"
+	Username string `json:"username"`
+	// example: "selpahi@example.org"
+	Email string `json:"email"`
+	// user, trusted or admin
+	// example: "trusted"
+	Role string `json:"role"`
+	// Backend owning the account, e.g. local or ldap
+	// example: "local"
+	AuthSource string    `json:"auth_source"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// UpdateRoleRequest changes the role of an account.
+// @Description Request body for changing a user's role
+type UpdateRoleRequest struct {
+	// example: "trusted"
+	Role string `json:"role" validate:"required,oneof=user trusted admin"`
+}
+
+// ModerationSummary is the size of each moderation queue.
+// @Description Pending items per moderation queue
+type ModerationSummary struct {
+	// example: 12
+	PendingRevisions int64 `json:"pending_revisions"`
+	// Submission time of the oldest pending revision
+	OldestRevisionAt *time.Time `json:"oldest_revision_at,omitempty"`
+	// example: 3
+	PendingExamples int64 `json:"pending_examples"`
+	// Submission time of the oldest pending example
+	OldestExampleAt *time.Time `json:"oldest_example_at,omitempty"`
+}
+
+// PendingRevision is a definition edit waiting for review.
+// @Description A definition revision waiting for review
+type PendingRevision struct {
+	// example: 4212
+	DefinitionID int32 `json:"definition_id"`
+	// example: "klama"
+	Word string `json:"word"`
+	// example: "en"
+	Language string `json:"language"`
+	// example: 3
+	Revision   int32  `json:"revision"`
+	Definition string `json:"definition"`
+	// Absent if the author's account no longer exists
+	AuthorID       *int32  `json:"author_id,omitempty"`
+	AuthorUsername *string `json:"author_username,omitempty"`
+	// Edit summary
+	Comment   *string   `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,178 @@
+// Package admin holds the parts of the admin API that don't belong to another module: user
+// management and the overview of the moderation queues.
+// This file, `handlers.go`, serves /admin/users, where admins list users and change their
+// roles, and /admin/moderation, the counts and lists of what waits for review.
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// AdminHandlers provides HTTP handlers for the admin API.
+type AdminHandlers struct {
+	service *AdminService
+}
+
+// NewAdminHandlers creates new AdminHandlers.
+func NewAdminHandlers(service *AdminService) *AdminHandlers {
+	return &AdminHandlers{service: service}
+}
+
+// HandleListUsers godoc
+// @Summary List user accounts
+// @Description Returns user accounts, newest first, with their email address, role and auth source. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param role query string false "Only accounts with this role: user, trusted or admin"
+// @Param q query string false "Only accounts whose username or email address starts with this"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[User] "Accounts"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid filter or pagination"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Admin rate limit exceeded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/users [get]
+func (h *AdminHandlers) HandleListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q UserListQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		users, err := h.service.ListUsers(r.Context(), q)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		validation.WritePage(w, r, users)
+	}
+}
+
+// HandleUpdateRole godoc
+// @Summary Change a user's role
+// @Description Makes an account a regular user, a trusted user or an admin. The last admin can't be demoted. Admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Param userID path int true "User ID"
+// @Param role body UpdateRoleRequest true "New role"
+// @Success 200 {object} User "Updated account"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID or role"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin, or missing X-Sudo-Token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Last admin"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Admin rate limit exceeded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/users/{userID}/role [put]
+func (h *AdminHandlers) HandleUpdateRole() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actorID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		userID, err := userIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		var req UpdateRoleRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		user, err := h.service.SetRole(r.Context(), userID, actorID, req.Role)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, user)
+	}
+}
+
+// HandleGetModerationSummary godoc
+// @Summary Summarize the moderation queues
+// @Description Returns how many definition revisions and example sentences wait for review, and since when. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ModerationSummary "Queue sizes"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Admin rate limit exceeded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/moderation [get]
+func (h *AdminHandlers) HandleGetModerationSummary() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		summary, err := h.service.GetModerationSummary(r.Context())
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, summary)
+	}
+}
+
+// HandleListPendingRevisions godoc
+// @Summary List definition edits waiting for review
+// @Description Returns the pending definition revisions of all words, oldest first. They are reviewed at /api/v1/definitions/{definitionID}/revisions/{revision}/approve or /reject. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[PendingRevision] "Pending revisions"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid pagination"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Admin rate limit exceeded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/moderation/revisions [get]
+func (h *AdminHandlers) HandleListPendingRevisions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q validation.Pagination
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		revisions, err := h.service.ListPendingRevisions(r.Context(), q)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		validation.WritePage(w, r, revisions)
+	}
+}
+
+func userIDParam(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil || id < 1 {
+		return 0, apperror.NewBadRequestError("invalid user ID", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,171 @@
+// Package admin, as part of the admin module.
+// This file, `service.go`, manages user accounts and reads the moderation queues. Reviewing
+// the queued items stays with the definitions and examples packages; this only shows what
+// waits, across all words.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/validation"
+)
+
+// AdminService provides the admin API.
+type AdminService struct {
+	db *pgxpool.Pool
+}
+
+// NewAdminService creates a new AdminService.
+func NewAdminService(db *pgxpool.Pool) *AdminService {
+	return &AdminService{db: db}
+}
+
+const userSelect = `SELECT userid, username, email, role, auth_source, created_at FROM users`
+
+func scanUser(row pgx.Row) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.Role, &u.AuthSource, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ListUsers returns a page of the accounts matching `q`, newest first.
+func (s *AdminService) ListUsers(ctx context.Context, q UserListQuery) (*validation.Page[User], error) {
+	prefix := db.EscapeLike(strings.TrimSpace(q.Query)) + "%"
+	const filter = `
+		WHERE ($1 = '' OR role = $1)
+		  AND ($2 = '%' OR username ILIKE $2 OR email ILIKE $2)`
+
+	var total int64
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM users`+filter, q.Role, prefix).Scan(&total); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count users", err)
+	}
+	rows, err := s.db.Query(ctx, userSelect+filter+`
+		ORDER BY created_at DESC, userid DESC
+		LIMIT $3 OFFSET $4`, q.Role, prefix, q.PerPage, q.Offset())
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list users", err)
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read user", err)
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list users", err)
+	}
+	return validation.NewPage(users, total, q.Pagination), nil
+}
+
+// SetRole changes the role of `userID`. The last admin can't be demoted, so the admin API
+// always has someone to use it. The change is audited with the account before and after it.
+func (s *AdminService) SetRole(ctx context.Context, userID, actorID int, role string) (*User, error) {
+	var updated *User
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		before, err := scanUser(tx.QueryRow(ctx, userSelect+` WHERE userid = $1 FOR UPDATE`, userID))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load user", err)
+		}
+		if before.Role == role {
+			updated = before
+			return nil
+		}
+		if before.Role == auth.RoleAdmin {
+			var admins int
+			if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM users WHERE role = $1`, auth.RoleAdmin).Scan(&admins); err != nil {
+				return apperror.NewDatabaseError("failed to count admins", err)
+			}
+			if admins <= 1 {
+				return apperror.NewConflictError("the last admin can't be demoted", nil)
+			}
+		}
+		updated, err = scanUser(tx.QueryRow(ctx, `
+			UPDATE users SET role = $2 WHERE userid = $1
+			RETURNING userid, username, email, role, auth_source, created_at`, userID, role))
+		if err != nil {
+			return apperror.NewDatabaseError("failed to change role", err)
+		}
+		return audit.Record(ctx, tx, audit.Entry{
+			ActorID:    actorID,
+			Action:     audit.ActionUserRoleChange,
+			TargetType: audit.TargetUser,
+			TargetID:   strconv.Itoa(userID),
+			Before:     before,
+			After:      updated,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// GetModerationSummary counts the items of each moderation queue.
+func (s *AdminService) GetModerationSummary(ctx context.Context) (*ModerationSummary, error) {
+	var summary ModerationSummary
+	err := s.db.QueryRow(ctx, `
+		SELECT (SELECT COUNT(*) FROM definition_revisions WHERE status = 'pending'),
+		       (SELECT MIN(created_at) FROM definition_revisions WHERE status = 'pending'),
+		       (SELECT COUNT(*) FROM definition_examples WHERE status = 'pending'),
+		       (SELECT MIN(created_at) FROM definition_examples WHERE status = 'pending')`).
+		Scan(&summary.PendingRevisions, &summary.OldestRevisionAt, &summary.PendingExamples, &summary.OldestExampleAt)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to count the moderation queues", err)
+	}
+	return &summary, nil
+}
+
+// ListPendingRevisions returns a page of the definition edits waiting for review, oldest first.
+func (s *AdminService) ListPendingRevisions(ctx context.Context, p validation.Pagination) (*validation.Page[PendingRevision], error) {
+	var total int64
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM definition_revisions WHERE status = 'pending'`).Scan(&total); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count pending revisions", err)
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT r.definition_id, v.word, l.tag, r.revision, r.definition, r.author_id, u.username,
+		       r.comment, r.created_at
+		FROM definition_revisions r
+		JOIN definitions d ON d.definitionid = r.definition_id
+		JOIN valsi v ON v.valsiid = d.valsiid
+		JOIN languages l ON l.langid = d.langid
+		LEFT JOIN users u ON u.userid = r.author_id
+		WHERE r.status = 'pending'
+		ORDER BY r.created_at, r.id
+		LIMIT $1 OFFSET $2`, p.PerPage, p.Offset())
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list pending revisions", err)
+	}
+	defer rows.Close()
+	var revisions []PendingRevision
+	for rows.Next() {
+		var rev PendingRevision
+		if err := rows.Scan(&rev.DefinitionID, &rev.Word, &rev.Language, &rev.Revision, &rev.Definition,
+			&rev.AuthorID, &rev.AuthorUsername, &rev.Comment, &rev.CreatedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read revision", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list pending revisions", err)
+	}
+	return validation.NewPage(revisions, total, p), nil
+}
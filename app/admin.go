@@ -0,0 +1,100 @@
+// Package app, as part of the application bootstrap.
+// This file, `admin.go`, is the admin module: user management, the job queue, long-running
+// tasks and their progress streams, the moderation queues, feature flags, the audit log,
+// embedding campaigns and dictionary imports.
+package app
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/admin"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/background"
+	"github.com/user/lensisku-go/bodylimit"
+	"github.com/user/lensisku-go/examples"
+	"github.com/user/lensisku-go/flags"
+	"github.com/user/lensisku-go/jbovlaste"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/ratelimit"
+)
+
+// AdminModule mounts the /admin routes, the admin WebSocket and the /api/v1/import routes.
+// They are for admins only, with the role checked against the database on every request, and
+// have policies of their own: a rate limit per admin (ADMIN_RATE_LIMIT per ADMIN_RATE_WINDOW)
+// instead of the daily quota, and every request that may change something is audited. The
+// changes that are hard to undo (roles, flags, settings, retries, imports) also need a sudo
+// token from POST /auth/sudo.
+func AdminModule() Module {
+	return Module{Name: "admin", Register: registerAdmin}
+}
+
+func registerAdmin(router chi.Router, deps *Deps) error {
+	cfg := deps.Config
+	limiter := ratelimit.New("admin", cfg.Admin.RateLimit, cfg.Admin.RateWindow, deps.Redis)
+	policies := func(r chi.Router) {
+		r.Use(auth.JWTMiddleware(cfg.Auth))
+		r.Use(auth.SudoMiddleware(cfg.Auth))
+		r.Use(auth.RequireRole(deps.Auth, auth.RoleAdmin))
+		r.Use(limiter.Middleware)
+		r.Use(deps.Audit.Middleware)
+	}
+
+	adminHandlers := admin.NewAdminHandlers(admin.NewAdminService(deps.Pool))
+	exampleHandlers := examples.NewExampleHandlers(examples.NewExampleService(deps.Pool))
+	flagHandlers := flags.NewFlagHandlers(deps.Flags)
+	jobAdminHandlers := jobs.NewAdminHandlers(deps.Jobs, deps.Worker)
+	// Administration, moderation and imports are audited; admins search the log at /admin/audit.
+	auditHandlers := audit.NewAuditHandlers(audit.NewAuditService(deps.Pool))
+	taskHandlers := jbovlaste.NewTaskHandlers(deps.Broadcaster)
+	taskHandlers.UseAudit(deps.Audit)
+	sudo := auth.RequireSudo()
+
+	router.Route("/admin", func(r chi.Router) {
+		policies(r)
+		r.Get("/users", adminHandlers.HandleListUsers())
+		r.With(sudo).Put("/users/{userID}/role", adminHandlers.HandleUpdateRole())
+		r.Get("/moderation", adminHandlers.HandleGetModerationSummary())
+		r.Get("/moderation/revisions", adminHandlers.HandleListPendingRevisions())
+		r.Get("/moderation/examples", exampleHandlers.HandleListPending())
+		r.Get("/flags", flagHandlers.HandleListFlags())
+		r.With(sudo).Put("/flags/{name}", flagHandlers.HandleUpdateFlag())
+		r.Get("/jobs", jobAdminHandlers.HandleGetOverview())
+		r.Get("/jobs/dead", jobAdminHandlers.HandleListDeadJobs())
+		r.With(sudo).Post("/jobs/{jobID}/retry", jobAdminHandlers.HandleRetryJob())
+		r.Get("/tasks", taskHandlers.HandleListTasks())
+		r.Get("/tasks/{taskID}/events", taskHandlers.HandleTaskEvents())
+		r.Post("/tasks/{taskID}/cancel", taskHandlers.HandleCancelTask())
+		r.Get("/audit", auditHandlers.HandleListEvents())
+		// The embedding campaign routes exist only with an embedding provider.
+		if deps.EmbeddingCalculator != nil {
+			embeddingAdminHandlers := background.NewEmbeddingAdminHandlers(deps.EmbeddingCalculator, deps.Broadcaster)
+			embeddingAdminHandlers.UseAudit(deps.Audit)
+			r.Get("/embeddings/settings", embeddingAdminHandlers.HandleGetEmbeddingSettings())
+			r.With(sudo).Patch("/embeddings/settings", embeddingAdminHandlers.HandleUpdateEmbeddingSettings())
+			r.Post("/embeddings/pause", embeddingAdminHandlers.HandlePauseEmbeddings())
+			r.Post("/embeddings/resume", embeddingAdminHandlers.HandleResumeEmbeddings())
+			r.Get("/embeddings/status", embeddingAdminHandlers.HandleGetEmbeddingStatus())
+			r.Get("/embeddings/usage", embeddingAdminHandlers.HandleGetEmbeddingUsage())
+			r.With(sudo).Post("/embeddings/reembed", embeddingAdminHandlers.HandleStartReembedding())
+		}
+	})
+
+	// The task topics over a WebSocket. Browsers can't send headers with the upgrade, so the
+	// token may come as a subprotocol.
+	router.With(auth.WebSocketJWTMiddleware(cfg.Auth), auth.RequireRole(deps.Auth, auth.RoleAdmin)).
+		Get("/api/v1/ws", taskHandlers.HandleWebSocket())
+
+	// Dictionary imports write through the dedicated import pool. Admins only.
+	importer := jbovlaste.NewImporter(deps.ImportPool, deps.Broadcaster)
+	importer.UseAudit(deps.Audit)
+	router.Route("/api/v1/import", func(r chi.Router) {
+		policies(r)
+		r.With(sudo, bodylimit.Override(cfg.Server.MaxImportBytes)).Post("/xml", importer.HandleImportXML())
+		r.Get("/events", importer.HandleImportEvents())
+		r.With(sudo).Post("/{clientID}/cancel", importer.HandleCancelImport())
+		r.Get("/dry-runs/{taskID}", importer.HandleImportDiff())
+		r.Get("/conflicts/{taskID}", importer.HandleImportConflicts())
+	})
+	return nil
+}
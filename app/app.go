@@ -0,0 +1,82 @@
+// Package app, as part of the application bootstrap.
+// This file, `app.go`, defines how the parts of the API are put together. `main` sets up the
+// infrastructure (configuration, database pools, Redis, the job queue, the event broadcaster,
+// the global middleware) and the core services every part needs, and hands them over as Deps.
+// Each part of the API is a Module: a name and a Register function that builds the part's
+// services from the Deps, mounts its routes and registers its job handlers. Adding a part means
+// adding a Module to Modules (see `modules.go`), not growing `main`.
+package app
+
+import (
+	"fmt"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/background"
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/embedding"
+	"github.com/user/lensisku-go/flags"
+	"github.com/user/lensisku-go/jbovlaste"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/leader"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/quota"
+	"github.com/user/lensisku-go/users"
+)
+
+// Deps are what modules are built from: the infrastructure and the core services shared by
+// several modules.
+type Deps struct {
+	Config *config.AppConfig
+
+	DB         *db.DB        // Read-only lookups that tolerate replication lag may go to a replica
+	Pool       *pgxpool.Pool // The primary behind DB
+	ImportPool *pgxpool.Pool // For dictionary imports and other bulk writes
+	Redis      *cache.Redis  // nil without REDIS_URL
+	Cache      *cache.Store
+
+	// Stop is closed on shutdown; background work started by a module stops with it.
+	Stop <-chan struct{}
+	// Elector tells whether this replica runs the background singletons.
+	Elector *leader.Elector
+
+	Embedder            embedding.Embedder              // nil when EMBEDDING_PROVIDER is none
+	EmbeddingCalculator *background.EmbeddingCalculator // nil likewise
+
+	Jobs *jobs.Queue
+	// Worker runs the handlers modules register; it starts once all modules are registered.
+	Worker *jobs.Worker
+	// Broadcaster streams the progress of long-running tasks to admins.
+	Broadcaster *jbovlaste.Broadcaster
+	Audit       *audit.Log
+
+	Auth  *auth.AuthService
+	Users *users.UserService
+	Quota *quota.Service
+	// Flags tells whether a feature switched by admins at runtime is on.
+	Flags *flags.FlagService
+}
+
+// Module is a part of the API.
+type Module struct {
+	Name string
+	// Register builds the module from `deps` and mounts its routes on `router`.
+	Register func(router chi.Router, deps *Deps) error
+}
+
+// Mount registers `modules` in order. It stops at the first module that fails.
+func Mount(router chi.Router, deps *Deps, modules ...Module) error {
+	logger := logging.For("app")
+	for _, m := range modules {
+		if err := m.Register(router, deps); err != nil {
+			return fmt.Errorf("module %s: %w", m.Name, err)
+		}
+		logger.Debug("Module registered", "module", m.Name)
+	}
+	return nil
+}
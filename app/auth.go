@@ -0,0 +1,40 @@
+// Package app, as part of the application bootstrap.
+// This file, `auth.go`, is the auth module: registration, login, token refresh, logout, invites
+// and re-authentication (sudo).
+package app
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/bodylimit"
+)
+
+// AuthModule mounts the /auth routes.
+func AuthModule() Module {
+	return Module{Name: "auth", Register: registerAuth}
+}
+
+func registerAuth(router chi.Router, deps *Deps) error {
+	cfg := deps.Config
+	authHandlers := auth.NewHandlers(deps.Auth)
+
+	router.Route("/auth", func(r chi.Router) {
+		r.Use(bodylimit.Override(cfg.Server.MaxAuthBodyBytes))
+		r.Post("/register", authHandlers.HandleRegister())
+		r.Post("/login", authHandlers.HandleLogin())
+		r.Post("/refresh", authHandlers.HandleRefreshToken())
+		r.Post("/logout", authHandlers.HandleLogout())
+
+		// Invite management requires an authenticated user; `r.Group` applies the JWT
+		// middleware to these routes only, leaving register/login/refresh/logout public.
+		r.Group(func(r chi.Router) {
+			r.Use(auth.JWTMiddleware(cfg.Auth))
+			r.Use(deps.Quota.Middleware)
+			r.Post("/invites", authHandlers.HandleCreateInvite())
+			r.Get("/invites", authHandlers.HandleListInvites())
+			r.Post("/sudo", authHandlers.HandleSudo())
+		})
+	})
+	return nil
+}
@@ -0,0 +1,31 @@
+// Package app, as part of the application bootstrap.
+// This file, `comments.go`, is the comments module: threads, comments, reactions and the feeds.
+package app
+
+import (
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/comments"
+	"github.com/user/lensisku-go/etag"
+)
+
+// CommentsModule mounts the /api/v1/comments routes.
+func CommentsModule() Module {
+	return Module{Name: "comments", Register: registerComments}
+}
+
+func registerComments(router chi.Router, deps *Deps) error {
+	cfg := deps.Config
+	commentService := comments.NewCommentService(deps.Pool, deps.Jobs, deps.Cache.Cache("trending", cfg.Cache.TrendingTTL))
+	commentHandlers := comments.NewCommentHandler(commentService)
+
+	// Every comment route requires authentication.
+	router.Route("/api/v1/comments", func(r chi.Router) {
+		r.Use(auth.JWTMiddleware(cfg.Auth))
+		r.Use(deps.Quota.Middleware)
+		r.Use(etag.Middleware())
+		commentHandlers.RegisterRoutes(r)
+	})
+	return nil
+}
@@ -0,0 +1,171 @@
+// Package app, as part of the application bootstrap.
+// This file, `dictionary.go`, is the dictionary module: word lookup, definitions, examples,
+// natural-language words, relations, word analysis, exports and embedding requests.
+package app
+
+import (
+	"fmt"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/background"
+	"github.com/user/lensisku-go/changelog"
+	"github.com/user/lensisku-go/definitions"
+	"github.com/user/lensisku-go/etag"
+	"github.com/user/lensisku-go/examples"
+	"github.com/user/lensisku-go/exports"
+	"github.com/user/lensisku-go/morphology"
+	"github.com/user/lensisku-go/natlang"
+	"github.com/user/lensisku-go/parser"
+	"github.com/user/lensisku-go/relations"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/valsi"
+)
+
+// DictionaryModule mounts the dictionary routes under /api/v1 and registers the export and
+// embedding jobs.
+func DictionaryModule() Module {
+	return Module{Name: "dictionary", Register: registerDictionary}
+}
+
+func registerDictionary(router chi.Router, deps *Deps) error {
+	cfg := deps.Config
+
+	exampleService := examples.NewExampleService(deps.Pool)
+	exampleHandlers := examples.NewExampleHandlers(exampleService)
+	definitionHandlers := definitions.NewDefinitionHandlers(definitions.NewDefinitionService(deps.Pool, exampleService))
+	natlangHandlers := natlang.NewNatlangHandlers(natlang.NewNatlangService(deps.Pool))
+	relationHandlers := relations.NewRelationHandlers(relations.NewRelationService(deps.Pool))
+	valsiService := valsi.NewValsiService(deps.DB)
+	valsiService.UseCache(deps.Cache.Cache("word_of_the_day", cfg.Cache.WordOfTheDayTTL))
+	valsiHandlers := valsi.NewValsiHandlers(valsiService)
+	changelogHandlers := changelog.NewChangelogHandlers(changelog.NewChangelogService(deps.DB))
+	morphologyHandlers := morphology.NewMorphologyHandlers(morphology.NewMorphologyService(deps.Pool))
+	parseService, err := parser.NewParseService()
+	if err != nil {
+		return fmt.Errorf("compile the Lojban grammar: %w", err)
+	}
+	parseHandlers := parser.NewParseHandlers(parseService)
+
+	// Dictionary exports are built by the job workers and downloaded through signed links.
+	exportService, err := exports.NewExportService(deps.Pool, deps.Jobs, cfg.Export, cfg.Server.PublicBaseURL, cfg.Auth.JWTSecret)
+	if err != nil {
+		return fmt.Errorf("initialize dictionary exports: %w", err)
+	}
+	deps.Worker.Register(exports.ExportJobType, exportService.JobHandler())
+	exportHandlers := exports.NewExportHandlers(exportService)
+
+	// Interactive embedding requests go through the job queue with high priority, ahead of the backfill.
+	if deps.Embedder != nil {
+		deps.Worker.Register(background.EmbedDefinitionJobType, background.EmbedDefinitionJobHandler(deps.Pool, deps.Embedder))
+		embeddingHandlers := background.NewEmbeddingHandlers(deps.Pool, deps.Jobs)
+		router.With(auth.JWTMiddleware(cfg.Auth), deps.Quota.Middleware).
+			Post("/definitions/{definitionID}/embedding", embeddingHandlers.HandleRequestEmbedding())
+	}
+
+	// Dictionary lookup and the history of changes are public. These routes, and the other
+	// dictionary reads below, send ETags and answer If-None-Match with 304. Besides JSON and
+	// MessagePack, they answer in XML for clients that accept it.
+	router.Route("/api/v1/valsi", func(r chi.Router) {
+		r.Use(etag.Middleware())
+		r.Use(render.Offer(render.XML))
+		r.Get("/search", valsiHandlers.HandleSearch())
+		r.Get("/word-of-the-day", valsiHandlers.HandleWordOfTheDay())
+		r.Get("/{valsiID}/similar", valsiHandlers.HandleSimilar())
+		r.Get("/{valsiID}/history", changelogHandlers.HandleValsiHistory())
+	})
+	router.With(etag.Middleware(), render.Offer(render.XML)).Get("/api/v1/changes", changelogHandlers.HandleRecentChanges())
+
+	// Word analysis and parsing are public.
+	router.Route("/api/v1/morphology", func(r chi.Router) {
+		r.Get("/decompose", morphologyHandlers.HandleDecompose())
+	})
+	router.Post("/api/v1/parse", parseHandlers.HandleParse())
+
+	// Dictionary exports need an account; the signed download links work without one.
+	router.Route("/api/v1/exports", func(r chi.Router) {
+		r.Get("/{exportID}/download", exportHandlers.HandleDownload())
+		r.Group(func(r chi.Router) {
+			r.Use(auth.JWTMiddleware(cfg.Auth))
+			r.Use(deps.Quota.Middleware)
+			r.Post("/", exportHandlers.HandleCreateExport())
+			r.Get("/{exportID}", exportHandlers.HandleGetExport())
+			r.Get("/{exportID}/events", exportHandlers.HandleExportEvents())
+		})
+	})
+
+	// Definitions: reading is public; editing needs an account, and reviewing pending edits
+	// a trusted user or admin.
+	router.Route("/api/v1/definitions", func(r chi.Router) {
+		r.Use(etag.Middleware())
+		r.Use(render.Offer(render.XML))
+		r.Get("/", definitionHandlers.HandleListDefinitions())
+		r.Get("/{definitionID}", definitionHandlers.HandleGetDefinition())
+		r.Get("/{definitionID}/revisions", definitionHandlers.HandleListRevisions())
+		r.Group(func(r chi.Router) {
+			r.Use(auth.JWTMiddleware(cfg.Auth))
+			r.Use(deps.Quota.Middleware)
+			r.Post("/", definitionHandlers.HandleCreateDefinition())
+			r.Put("/{definitionID}", definitionHandlers.HandleUpdateDefinition())
+			r.Delete("/{definitionID}", definitionHandlers.HandleDeleteDefinition())
+			r.Group(func(r chi.Router) {
+				r.Use(auth.RequireRole(deps.Auth, auth.RoleTrusted, auth.RoleAdmin))
+				r.Post("/{definitionID}/revisions/{revision}/approve", definitionHandlers.HandleApproveRevision())
+				r.Post("/{definitionID}/revisions/{revision}/reject", definitionHandlers.HandleRejectRevision())
+			})
+		})
+	})
+
+	// Example sentences: approved ones are public, submitting needs an account, and moderating
+	// a trusted user or admin.
+	router.Route("/api/v1/examples", func(r chi.Router) {
+		r.Use(etag.Middleware())
+		r.Use(render.Offer(render.XML))
+		r.Get("/", exampleHandlers.HandleListExamples())
+		r.Group(func(r chi.Router) {
+			r.Use(auth.JWTMiddleware(cfg.Auth))
+			r.Use(deps.Quota.Middleware)
+			r.Post("/", exampleHandlers.HandleCreateExample())
+			r.Delete("/{exampleID}", exampleHandlers.HandleDeleteExample())
+			r.Group(func(r chi.Router) {
+				r.Use(auth.RequireRole(deps.Auth, auth.RoleTrusted, auth.RoleAdmin))
+				r.Get("/pending", exampleHandlers.HandleListPending())
+				r.Post("/{exampleID}/approve", exampleHandlers.HandleApproveExample())
+				r.Post("/{exampleID}/reject", exampleHandlers.HandleRejectExample())
+			})
+		})
+	})
+
+	// Natural-language words: searching is public, changes need an account.
+	router.Route("/api/v1/natlangwords", func(r chi.Router) {
+		r.Use(etag.Middleware())
+		r.Use(render.Offer(render.XML))
+		r.Get("/", natlangHandlers.HandleSearchWords())
+		r.Get("/{wordID}", natlangHandlers.HandleGetWord())
+		r.Group(func(r chi.Router) {
+			r.Use(auth.JWTMiddleware(cfg.Auth))
+			r.Use(deps.Quota.Middleware)
+			r.Post("/", natlangHandlers.HandleCreateWord())
+			r.Put("/{wordID}", natlangHandlers.HandleUpdateWord())
+			r.Delete("/{wordID}", natlangHandlers.HandleDeleteWord())
+			r.Post("/{wordID}/definitions", natlangHandlers.HandleLinkDefinition())
+			r.Delete("/{wordID}/definitions/{definitionID}", natlangHandlers.HandleUnlinkDefinition())
+		})
+	})
+
+	// Word relations and the graph built from them: reading is public, changes need an account.
+	router.Route("/api/v1/relations", func(r chi.Router) {
+		r.Use(etag.Middleware())
+		r.Use(render.Offer(render.XML))
+		r.Get("/", relationHandlers.HandleListRelations())
+		r.Get("/graph", relationHandlers.HandleGraph())
+		r.Group(func(r chi.Router) {
+			r.Use(auth.JWTMiddleware(cfg.Auth))
+			r.Use(deps.Quota.Middleware)
+			r.Post("/", relationHandlers.HandleCreateRelation())
+			r.Delete("/{relationID}", relationHandlers.HandleDeleteRelation())
+		})
+	})
+	return nil
+}
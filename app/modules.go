@@ -0,0 +1,16 @@
+// Package app, as part of the application bootstrap.
+// This file, `modules.go`, lists the modules the server is made of.
+package app
+
+// Modules returns the modules of the API, in the order they are registered. The order only
+// matters for job handlers, which a later module could replace.
+func Modules() []Module {
+	return []Module{
+		AuthModule(),
+		UsersModule(),
+		NotificationsModule(),
+		DictionaryModule(),
+		CommentsModule(),
+		AdminModule(),
+	}
+}
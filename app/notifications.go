@@ -0,0 +1,101 @@
+// Package app, as part of the application bootstrap.
+// This file, `notifications.go`, is the notifications module: outgoing email, in-app
+// notifications and the activity digests.
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/digest"
+	"github.com/user/lensisku-go/email"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/notifications"
+	"github.com/user/lensisku-go/webpush"
+)
+
+// NotificationsModule registers the email and comment notification jobs, mounts the
+// /api/v1/notifications routes and starts pushing notifications to their streams and, with Web
+// Push configured, to browsers, starts the digest scheduler and mounts the digest unsubscribe
+// links.
+func NotificationsModule() Module {
+	return Module{Name: "notifications", Register: registerNotifications}
+}
+
+func registerNotifications(router chi.Router, deps *Deps) error {
+	cfg := deps.Config
+	logger := logging.For("app")
+
+	// Outgoing email. Without SMTP_HOST, emails are only logged. Emails are queued as jobs and
+	// delivered by the job workers, with retries on transient SMTP failures.
+	emailSender := email.NewSender(cfg.Email)
+	if cfg.Email.TemplateDir != "" {
+		if err := email.LoadTemplateDir(cfg.Email.TemplateDir); err != nil {
+			return fmt.Errorf("load email templates: %w", err)
+		}
+		logger.Info("Email templates loaded", "dir", cfg.Email.TemplateDir)
+	}
+	if cfg.Email.CheckOnStart {
+		smtpCtx, smtpCancel := context.WithTimeout(context.Background(), cfg.Email.Timeout)
+		err := email.CheckSMTP(smtpCtx, cfg.Email)
+		smtpCancel()
+		if err != nil {
+			return fmt.Errorf("SMTP check: %w", err)
+		}
+		logger.Info("SMTP server reachable", "host", cfg.Email.SMTPHost, "port", cfg.Email.SMTPPort)
+	}
+	deps.Worker.Register(email.SendJobType, email.SendJobHandler(emailSender))
+	deps.Worker.Register(notifications.CommentJobType, notifications.CommentHandler(deps.Pool))
+
+	// In-app notifications: each user reads and marks only their own.
+	notificationService := notifications.NewNotificationService(deps.Pool)
+	notificationHandlers := notifications.NewNotificationHandlers(notificationService)
+	// New notifications are also pushed to the recipient's open event streams.
+	streamer := notifications.NewStreamer(notificationService, deps.Broadcaster)
+	streamer.Start(deps.Stop)
+
+	// Web Push, with VAPID keys: mentions and moderation decisions also reach subscribed
+	// browsers. The leader queues the messages; any worker delivers them.
+	var pushHandlers *webpush.Handlers
+	if cfg.WebPush != nil {
+		pushClient, err := webpush.NewClient(cfg.WebPush)
+		if err != nil {
+			return fmt.Errorf("web push: %w", err)
+		}
+		pushService := webpush.NewService(deps.Pool, deps.Jobs, pushClient, cfg.WebPush)
+		deps.Worker.Register(webpush.SendJobType, pushService.SendJobHandler())
+		pushService.Start(deps.Elector, deps.Stop)
+		pushHandlers = webpush.NewHandlers(pushService)
+		logger.Info("Web Push enabled", "poll_interval", cfg.WebPush.PollInterval)
+	}
+	router.Route("/api/v1/notifications", func(r chi.Router) {
+		r.Use(auth.JWTMiddleware(cfg.Auth))
+		r.Use(deps.Quota.Middleware)
+		r.Get("/", notificationHandlers.HandleList())
+		r.Get("/unread-count", notificationHandlers.HandleUnreadCount())
+		r.Post("/read-all", notificationHandlers.HandleMarkAllRead())
+		r.Post("/{notificationID}/read", notificationHandlers.HandleMarkRead())
+		r.Get("/stream", streamer.HandleStream())
+		if pushHandlers != nil {
+			r.Get("/push/public-key", pushHandlers.HandleGetPublicKey())
+			r.Post("/push/subscriptions", pushHandlers.HandleSubscribe())
+			r.Delete("/push/subscriptions", pushHandlers.HandleUnsubscribe())
+		}
+	})
+
+	// Activity digests, queued through the job queue.
+	digestService := digest.NewService(deps.Pool, deps.Jobs, deps.Users, cfg.Digest, cfg.Server.PublicBaseURL, cfg.Auth.JWTSecret)
+	digestHandlers := digest.NewHandlers(digestService)
+	if cfg.Digest.Enabled {
+		digestService.Start(deps.Elector, deps.Stop)
+		logger.Info("Digest scheduler initiated")
+	}
+
+	// Digest unsubscribe links work without logging in; the token in the link is signed.
+	router.Get("/digest/unsubscribe", digestHandlers.HandleConfirmUnsubscribe())
+	router.Post("/digest/unsubscribe", digestHandlers.HandleUnsubscribe())
+	return nil
+}
@@ -0,0 +1,83 @@
+// Package app, as part of the application bootstrap.
+// This file, `users.go`, is the users module: profiles, avatars, follows, blocks and the
+// user's quota usage.
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/bodylimit"
+	"github.com/user/lensisku-go/quota"
+	"github.com/user/lensisku-go/users"
+)
+
+// UsersModule mounts the /users routes, and the uploaded files of the local storage backend.
+func UsersModule() Module {
+	return Module{Name: "users", Register: registerUsers}
+}
+
+func registerUsers(router chi.Router, deps *Deps) error {
+	cfg := deps.Config
+	userHandlers := users.NewUserHandlers(deps.Users)
+	quotaHandlers := quota.NewHandlers(deps.Quota)
+
+	// Everything except public profiles requires a JWT.
+	router.Route("/users", func(r chi.Router) {
+		// Public profiles and follow listings are readable without a token.
+		// The optional JWT middleware lets logged-in viewers see fields restricted to users.
+		r.With(auth.OptionalJWTMiddleware(cfg.Auth)).Get("/by-username/{username}", userHandlers.HandleGetPublicProfile())
+		r.Get("/{userID}/followers", userHandlers.HandleListFollowers())
+		r.Get("/{userID}/following", userHandlers.HandleListFollowing())
+		r.Get("/{userID}/reputation", userHandlers.HandleGetReputation())
+		r.Get("/{userID}/stats", userHandlers.HandleGetUserStats())
+		// Verification links work without logging in; the token in the link is signed.
+		r.Get("/email/verify", userHandlers.HandleConfirmVerifyEmail())
+		r.Post("/email/verify", userHandlers.HandleVerifyEmail())
+		// Checking the quota must keep working once it is used up, so this route skips the quota middleware.
+		r.With(auth.JWTMiddleware(cfg.Auth)).Get("/me/usage", quotaHandlers.HandleGetUsage())
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.JWTMiddleware(cfg.Auth))
+			// Verifies an optional X-Sudo-Token so handlers can demand re-authentication for sensitive changes.
+			r.Use(auth.SudoMiddleware(cfg.Auth))
+			r.Use(deps.Quota.Middleware)
+
+			r.Get("/me", userHandlers.HandleGetUserProfile())
+			r.Put("/me", userHandlers.HandleUpdateUserProfile())
+			r.With(auth.RequireSudo()).Delete("/me", userHandlers.HandleDeleteAccount())
+			// A little headroom over the image size covers the multipart framing.
+			r.With(bodylimit.Override(cfg.Storage.MaxAvatarBytes+64<<10)).Post("/me/avatar", userHandlers.HandleUploadAvatar())
+			r.Put("/me/username", userHandlers.HandleChangeUsername())
+			r.Get("/me/preferences", userHandlers.HandleGetPreferences())
+			r.Patch("/me/preferences", userHandlers.HandleUpdatePreferences())
+			r.Get("/me/privacy", userHandlers.HandleGetPrivacySettings())
+			r.Patch("/me/privacy", userHandlers.HandleUpdatePrivacySettings())
+			r.Get("/me/onboarding", userHandlers.HandleGetOnboarding())
+			r.Patch("/me/onboarding", userHandlers.HandleUpdateOnboarding())
+			r.Post("/me/email/verification", userHandlers.HandleSendVerificationEmail())
+			r.Post("/{userID}/follow", userHandlers.HandleFollow())
+			r.Delete("/{userID}/follow", userHandlers.HandleUnfollow())
+			r.Get("/me/blocks", userHandlers.HandleListBlocks())
+			r.Get("/search", userHandlers.HandleSearchUsers())
+			r.Post("/{userID}/block", userHandlers.HandleBlock())
+			r.Delete("/{userID}/block", userHandlers.HandleUnblock())
+			r.Post("/{userID}/mute", userHandlers.HandleMute())
+			r.Delete("/{userID}/mute", userHandlers.HandleUnmute())
+		})
+	})
+
+	// Uploaded files of the "local" storage backend are served directly by this process.
+	// With an external backend (object storage/CDN) STORAGE_PUBLIC_BASE_URL points elsewhere
+	// and this route is simply never hit.
+	if cfg.Storage.Backend == "local" {
+		uploadsPrefix := strings.TrimRight(cfg.Storage.PublicBaseURL, "/")
+		if strings.HasPrefix(uploadsPrefix, "/") {
+			router.Handle(uploadsPrefix+"/*", http.StripPrefix(uploadsPrefix, http.FileServer(http.Dir(cfg.Storage.LocalDir))))
+		}
+	}
+	return nil
+}
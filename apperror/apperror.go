@@ -9,6 +9,7 @@ import (
 	"fmt"
 	// `net/http` is used for HTTP status codes.
 	"net/http"
+	"time"
 )
 
 // ErrorType is an enumeration (using `iota`) for different categories of application errors.
@@ -40,6 +41,18 @@ const (
 	MigrationError
 	// ConflictError represents a conflict, e.g., resource already exists
 	ConflictError
+	// RateLimitError represents an action attempted too often or too soon
+	RateLimitError
+	// PreconditionFailedError represents a failed conditional request (e.g. stale If-Match)
+	PreconditionFailedError
+	// PreconditionRequiredError represents a request that must be conditional but isn't
+	PreconditionRequiredError
+	// UnavailableError represents a dependency that is down or overloaded for now
+	UnavailableError
+	// TimeoutError represents an external service that didn't answer in time
+	TimeoutError
+	// PayloadTooLargeError represents a request body over the limit of its route
+	PayloadTooLargeError
 )
 
 // AppError is a custom error type for the application
@@ -47,8 +60,15 @@ const (
 // It also allows wrapping an underlying error (`Err`) for more detailed debugging.
 type AppError struct {
 	Type    ErrorType
+	Code    Code // Sent to clients; see `codes.go`
 	Message string
-	Err     error // Underlying error
+	Err     error        // Underlying error
+	Fields  []FieldError // Invalid request fields, sent to clients; see `fields.go`
+	MaxBytes int64       // Body size limit of a PayloadTooLargeError, sent to clients; see `size.go`
+
+	// Transient failure; see `retry.go`
+	retryable  bool
+	retryAfter time.Duration
 }
 
 // Error returns the string representation of the error, satisfying the `error` interface.
@@ -73,6 +93,10 @@ func (e *AppError) StatusCode() int {
 	// This switch statement maps our custom `ErrorType` to standard HTTP status codes.
 	switch e.Type {
 	case DatabaseError:
+		// A transient failure isn't a bug; the client may try again.
+		if e.retryable {
+			return http.StatusServiceUnavailable
+		}
 		return http.StatusInternalServerError
 	case ConfigError:
 		return http.StatusInternalServerError
@@ -98,6 +122,18 @@ func (e *AppError) StatusCode() int {
 		return http.StatusInternalServerError
 	case ConflictError:
 		return http.StatusConflict
+	case RateLimitError:
+		return http.StatusTooManyRequests
+	case PreconditionFailedError:
+		return http.StatusPreconditionFailed
+	case PreconditionRequiredError:
+		return http.StatusPreconditionRequired
+	case UnavailableError:
+		return http.StatusServiceUnavailable
+	case TimeoutError:
+		return http.StatusGatewayTimeout
+	case PayloadTooLargeError:
+		return http.StatusRequestEntityTooLarge
 	default:
 		return http.StatusInternalServerError
 	}
@@ -110,6 +146,7 @@ func (e *AppError) StatusCode() int {
 func NewAppError(errType ErrorType, message string, underlyingError error) *AppError {
 	return &AppError{
 		Type:    errType,
+		Code:    defaultCode(errType),
 		Message: message,
 		Err:     underlyingError,
 	}
@@ -119,9 +156,15 @@ func NewAppError(errType ErrorType, message string, underlyingError error) *AppE
 // These provide a more readable and type-safe way to create common `AppError` types.
 // For example, `NewDatabaseError("message", err)` is clearer than `NewAppError(DatabaseError, "message", err)`.
 
-// NewDatabaseError creates a new DatabaseError
+// NewDatabaseError creates a new DatabaseError. A transient underlying error (a deadlock, a
+// lost connection, ...) makes it retryable, with the code DATABASE_BUSY.
 func NewDatabaseError(message string, underlyingError error) *AppError {
-	return NewAppError(DatabaseError, message, underlyingError)
+	e := NewAppError(DatabaseError, message, underlyingError)
+	if isTransient(underlyingError) {
+		e.Code = CodeDatabaseBusy
+		e.retryable = true
+	}
+	return e
 }
 
 // NewConfigError creates a new ConfigError
@@ -159,8 +202,12 @@ func NewInternalError(message string, underlyingError error) *AppError {
 	return NewAppError(InternalError, message, underlyingError)
 }
 
-// NewExternalServiceError creates a new ExternalServiceError
+// NewExternalServiceError creates a new ExternalServiceError. When the service timed out, the
+// error is a TimeoutError instead.
 func NewExternalServiceError(message string, underlyingError error) *AppError {
+	if underlyingError != nil && isTransient(underlyingError) {
+		return NewTimeoutError(message, underlyingError)
+	}
 	return NewAppError(ExternalServiceError, message, underlyingError)
 }
 
@@ -174,17 +221,55 @@ func NewConflictError(message string, underlyingError error) *AppError {
 	return NewAppError(ConflictError, message, underlyingError)
 }
 
+// NewRateLimitError creates a new RateLimitError
+func NewRateLimitError(message string, underlyingError error) *AppError {
+	return NewAppError(RateLimitError, message, underlyingError)
+}
+
+// NewPreconditionFailedError creates a new PreconditionFailedError
+func NewPreconditionFailedError(message string, underlyingError error) *AppError {
+	return NewAppError(PreconditionFailedError, message, underlyingError)
+}
+
+// NewPreconditionRequiredError creates a new PreconditionRequiredError
+func NewPreconditionRequiredError(message string, underlyingError error) *AppError {
+	return NewAppError(PreconditionRequiredError, message, underlyingError)
+}
+
+// NewUnavailableError creates a new UnavailableError, which is retryable
+func NewUnavailableError(message string, underlyingError error) *AppError {
+	return NewAppError(UnavailableError, message, underlyingError)
+}
+
+// NewTimeoutError creates a new TimeoutError, which is retryable
+func NewTimeoutError(message string, underlyingError error) *AppError {
+	return NewAppError(TimeoutError, message, underlyingError)
+}
+
 // ErrorResponse represents a generic error response payload for API clients.
 type ErrorResponse struct {
 	// `example` is a struct tag often used by Swagger/OpenAPI documentation generators.
 	Error string `json:"error" example:"A description of the error"`
+	// Code is stable across releases, unlike Error; clients should branch on it.
+	Code Code `json:"code" example:"NOT_FOUND"`
+	// RequestID identifies the request in the server logs; quote it when reporting an error.
+	RequestID string `json:"request_id,omitempty" example:"host/AbCdEf1234-000042"`
+	// Fields lists the invalid fields of a request that failed validation.
+	Fields []FieldError `json:"fields,omitempty"`
+	// MaxBytes is the largest request body the route accepts, for PAYLOAD_TOO_LARGE.
+	MaxBytes int64 `json:"max_bytes,omitempty" example:"1048576"`
 }
 
 // ToResponse converts an AppError to an ErrorResponse suitable for API responses.
 // This ensures that all API error responses have a consistent JSON structure.
 func (e *AppError) ToResponse() ErrorResponse {
 	// Only the user-facing `Message` is included in the response, not the underlying `Err` details.
-	return ErrorResponse{Error: e.Message}
+	code := e.Code
+	if code == "" {
+		// Built as a literal rather than with a constructor.
+		code = defaultCode(e.Type)
+	}
+	return ErrorResponse{Error: e.Message, Code: code, Fields: e.Fields, MaxBytes: e.MaxBytes}
 }
 
 // FromError attempts to convert a generic error to an *AppError.
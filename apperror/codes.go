@@ -0,0 +1,134 @@
+// Package apperror, as part of the error handling module.
+// This file, `codes.go`, lists the error codes sent to API clients in the "code" field of an
+// error response. A message is meant for people and may be reworded at any time; a code is
+// part of the API, so clients should branch on it, and a code, once published, keeps its
+// meaning.
+//
+// Every error has a code: the generic one of its type, unless the place that raises it picks
+// a more specific one with WithCode, e.g.
+//
+//	return apperror.NewConflictError("email already exists", nil).WithCode(apperror.CodeEmailExists)
+package apperror
+
+import "errors"
+
+// Code is a stable, machine-readable identifier of an error.
+type Code string
+
+// The generic codes, one per error type.
+const (
+	CodeUnknown              Code = "UNKNOWN_ERROR"
+	CodeDatabase             Code = "DATABASE_ERROR"
+	CodeConfig               Code = "CONFIG_ERROR"
+	CodeAuthRequired         Code = "AUTHENTICATION_REQUIRED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeValidation           Code = "VALIDATION_FAILED"
+	CodeBadRequest           Code = "BAD_REQUEST"
+	CodeInternal             Code = "INTERNAL_ERROR"
+	CodeExternalService      Code = "EXTERNAL_SERVICE_ERROR"
+	CodeMigration            Code = "MIGRATION_ERROR"
+	CodeConflict             Code = "CONFLICT"
+	CodeRateLimited          Code = "RATE_LIMITED"
+	CodePreconditionFailed   Code = "PRECONDITION_FAILED"
+	CodePreconditionRequired Code = "PRECONDITION_REQUIRED"
+	CodeUnavailable          Code = "SERVICE_UNAVAILABLE"
+	CodeTimeout              Code = "TIMEOUT"
+	CodePayloadTooLarge      Code = "PAYLOAD_TOO_LARGE"
+)
+
+// The specific codes.
+const (
+	// Authentication and accounts
+	CodeInvalidCredentials    Code = "INVALID_CREDENTIALS"
+	CodeInvalidToken          Code = "INVALID_TOKEN"
+	CodeInvalidSudoToken      Code = "INVALID_SUDO_TOKEN"
+	CodeSudoRequired          Code = "SUDO_REQUIRED"
+	CodeInvalidCSRFToken      Code = "INVALID_CSRF_TOKEN"
+	CodeAuthBackendDown       Code = "AUTH_BACKEND_UNAVAILABLE"
+	CodeUsernameOtherSource   Code = "USERNAME_OTHER_SOURCE"
+	CodeInviteRequired        Code = "INVITE_REQUIRED"
+	CodeInviteInvalid         Code = "INVITE_INVALID"
+	CodeInviteExpired         Code = "INVITE_EXPIRED"
+	CodeInviteUsedUp          Code = "INVITE_USED_UP"
+	CodeEmailExists           Code = "EMAIL_EXISTS"
+	CodeUsernameExists        Code = "USERNAME_EXISTS"
+	CodeUsernameOnHold        Code = "USERNAME_ON_HOLD"
+	CodeUsernameChangeTooSoon Code = "USERNAME_CHANGE_TOO_SOON"
+	CodeProfileModified       Code = "PROFILE_MODIFIED"
+	CodeIfMatchRequired       Code = "IF_MATCH_REQUIRED"
+	CodeQuotaExceeded         Code = "QUOTA_EXCEEDED"
+
+	// Dictionary content
+	CodeCommentTooLarge    Code = "COMMENT_TOO_LARGE"
+	CodeDuplicate          Code = "DUPLICATE"
+	CodeStillReferenced    Code = "STILL_REFERENCED"
+	CodeAlreadyReviewed    Code = "ALREADY_REVIEWED"
+	CodeRevisionSuperseded Code = "REVISION_SUPERSEDED"
+
+	// Transient failures
+	CodeDatabaseBusy Code = "DATABASE_BUSY"
+
+	// Exports, imports and jobs
+	CodeDownloadLinkInvalid Code = "DOWNLOAD_LINK_INVALID"
+	CodeDownloadLinkExpired Code = "DOWNLOAD_LINK_EXPIRED"
+	CodeImportRunning       Code = "IMPORT_RUNNING"
+	CodeTaskCancelled       Code = "TASK_ALREADY_CANCELLED"
+	CodeJobNotRetryable     Code = "JOB_NOT_RETRYABLE"
+	CodeShuttingDown        Code = "SHUTTING_DOWN"
+)
+
+// defaultCode returns the generic code of an error type.
+func defaultCode(t ErrorType) Code {
+	switch t {
+	case DatabaseError:
+		return CodeDatabase
+	case ConfigError:
+		return CodeConfig
+	case AuthError:
+		return CodeAuthRequired
+	case UnauthorizedError:
+		return CodeForbidden
+	case NotFoundError:
+		return CodeNotFound
+	case ValidationError:
+		return CodeValidation
+	case BadRequestError:
+		return CodeBadRequest
+	case InternalError:
+		return CodeInternal
+	case ExternalServiceError:
+		return CodeExternalService
+	case MigrationError:
+		return CodeMigration
+	case ConflictError:
+		return CodeConflict
+	case RateLimitError:
+		return CodeRateLimited
+	case PreconditionFailedError:
+		return CodePreconditionFailed
+	case PreconditionRequiredError:
+		return CodePreconditionRequired
+	case UnavailableError:
+		return CodeUnavailable
+	case TimeoutError:
+		return CodeTimeout
+	case PayloadTooLargeError:
+		return CodePayloadTooLarge
+	default:
+		return CodeUnknown
+	}
+}
+
+// WithCode sets the code of the error, replacing the generic one of its type, and returns the
+// error so it can be chained to a constructor.
+func (e *AppError) WithCode(code Code) *AppError {
+	e.Code = code
+	return e
+}
+
+// IsCode checks if an error, or one it wraps, is an AppError with the code `code`.
+func IsCode(err error, code Code) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Code == code
+}
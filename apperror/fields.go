@@ -0,0 +1,27 @@
+// Package apperror, as part of the error handling module.
+// This file, `fields.go`, carries the invalid fields of a request in a ValidationError, so a
+// form can point at each input that needs fixing (see the `validation` package).
+package apperror
+
+import "strings"
+
+// FieldError is one invalid field of a request.
+type FieldError struct {
+	// JSON key or query parameter; nested fields are dotted, e.g. "content[0].type"
+	Field string `json:"field" example:"email"`
+	// Rule the value breaks, e.g. "required", "max" or "email"
+	Rule    string `json:"rule" example:"email"`
+	Message string `json:"message" example:"email must be a valid email address"`
+}
+
+// NewFieldsError creates a ValidationError listing the invalid fields. Its message joins
+// theirs, for clients that only show the message.
+func NewFieldsError(fields []FieldError) *AppError {
+	messages := make([]string, len(fields))
+	for i, f := range fields {
+		messages[i] = f.Message
+	}
+	e := NewValidationError(strings.Join(messages, "; "), nil)
+	e.Fields = fields
+	return e
+}
@@ -0,0 +1,77 @@
+// Package apperror, as part of the error handling module.
+// This file, `report.go`, is the hook through which server errors reach an error-reporting
+// service such as Sentry. `auth.WriteError` reports the 5xx errors it writes, and the panic
+// recovery middleware the panics it recovers; both are no-ops until main installs a Reporter
+// (see the `errreport` package).
+package apperror
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// Reporter sends errors to an error-reporting service. Its methods are called while the
+// request is being served, so they must not block on the service.
+type Reporter interface {
+	// ReportError reports an error answered with a 5xx status.
+	ReportError(r *http.Request, err *AppError)
+	// ReportPanic reports a panic recovered while serving `r`. It is called from the deferred
+	// function that recovered it, so the stack of the panic is still that of the goroutine.
+	ReportPanic(r *http.Request, value any)
+}
+
+// reporter is set once at startup, before the server starts.
+var reporter Reporter
+
+// SetReporter installs the reporter errors and panics are sent to.
+func SetReporter(rep Reporter) {
+	reporter = rep
+}
+
+// Report sends a server error to the reporter, if one is installed.
+func Report(r *http.Request, err *AppError) {
+	if reporter != nil {
+		reporter.ReportError(r, err)
+	}
+}
+
+// ReportPanic sends a recovered panic to the reporter, if one is installed.
+func ReportPanic(r *http.Request, value any) {
+	if reporter != nil {
+		reporter.ReportPanic(r, value)
+	}
+}
+
+// ReportScope holds what is learnt about a request while it is served and should go with its
+// reports. The panic recovery middleware, which runs before authentication, puts one in the
+// request context; the authentication middleware records the user in it.
+type ReportScope struct {
+	userID atomic.Int64
+}
+
+type reportScopeKey struct{}
+
+// WithReportScope returns a context carrying a new, empty scope.
+func WithReportScope(ctx context.Context) (context.Context, *ReportScope) {
+	s := &ReportScope{}
+	return context.WithValue(ctx, reportScopeKey{}, s), s
+}
+
+// ReportScopeFrom returns the scope of `ctx`, or nil.
+func ReportScopeFrom(ctx context.Context) *ReportScope {
+	s, _ := ctx.Value(reportScopeKey{}).(*ReportScope)
+	return s
+}
+
+// SetReportUser records the authenticated user in the scope of `ctx`, if it has one.
+func SetReportUser(ctx context.Context, userID int) {
+	if s := ReportScopeFrom(ctx); s != nil {
+		s.userID.Store(int64(userID))
+	}
+}
+
+// UserID returns the user recorded in the scope, or 0 for an anonymous request.
+func (s *ReportScope) UserID() int {
+	return int(s.userID.Load())
+}
@@ -0,0 +1,112 @@
+// Package apperror, as part of the error handling module.
+// This file, `retry.go`, tells transient failures, which the same request may get past if sent
+// again later, from the others. A transient error is retryable: `auth.WriteError` answers it
+// with a Retry-After header, and the job worker retries a job that failed with one while it
+// dead-letters a job that failed with a client error right away.
+//
+// Rate limits, unavailable services and timeouts are retryable by type. Database errors are
+// classified by NewDatabaseError: deadlocks, serialization failures, lock timeouts and lost or
+// refused connections are retryable, with the code DATABASE_BUSY. Any other error can be made
+// retryable with WithRetryAfter.
+package apperror
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DefaultRetryAfter is the delay suggested for a transient failure that doesn't know better.
+const DefaultRetryAfter = time.Second
+
+// transientSQLStates are the Postgres error codes of failures that a retry may get past.
+var transientSQLStates = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"55P03": true, // lock_not_available
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// WithRetryAfter marks the error as retryable after `d`, and returns the error so it can be
+// chained to a constructor.
+func (e *AppError) WithRetryAfter(d time.Duration) *AppError {
+	e.retryable = true
+	e.retryAfter = d
+	return e
+}
+
+// Retryable reports whether the request that failed may succeed if sent again later.
+func (e *AppError) Retryable() bool {
+	switch e.Type {
+	case RateLimitError, UnavailableError, TimeoutError:
+		return true
+	}
+	return e.retryable
+}
+
+// RetryAfter returns how long to wait before retrying: the delay set with WithRetryAfter, or
+// DefaultRetryAfter for a retryable error other than a rate limit, whose delay only the limiter
+// knows. It is 0 for an error that isn't retryable.
+func (e *AppError) RetryAfter() time.Duration {
+	switch {
+	case !e.Retryable():
+		return 0
+	case e.retryAfter > 0:
+		return e.retryAfter
+	case e.Type == RateLimitError:
+		return 0
+	default:
+		return DefaultRetryAfter
+	}
+}
+
+// IsRetryable checks if an error is transient: a retryable AppError, or, for errors that never
+// went through a constructor, a timeout or a transient database failure.
+func IsRetryable(err error) bool {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr.Retryable()
+	}
+	return isTransient(err)
+}
+
+// IsFatal checks if an error is an AppError that no retry can fix: a client error, such as a
+// validation failure or a missing resource, that isn't retryable.
+func IsFatal(err error) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && !appErr.Retryable() && appErr.StatusCode() < 500
+}
+
+// RetryDelay returns the delay before retrying after `err`, or 0 if it suggests none.
+func RetryDelay(err error) time.Duration {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr.RetryAfter()
+	}
+	return 0
+}
+
+// isTransient checks the underlying error of an AppError, or a plain error.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return transientSQLStates[pgErr.Code]
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) {
+		return true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
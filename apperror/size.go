@@ -0,0 +1,27 @@
+// Package apperror, as part of the error handling module.
+// This file, `size.go`, reports request bodies over the limit of their route (see the
+// `bodylimit` package) as 413 responses that tell the client the limit.
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// NewPayloadTooLargeError creates a PayloadTooLargeError for a body over `maxBytes`.
+func NewPayloadTooLargeError(maxBytes int64, underlyingError error) *AppError {
+	e := NewAppError(PayloadTooLargeError, fmt.Sprintf("request body must be at most %d bytes", maxBytes), underlyingError)
+	e.MaxBytes = maxBytes
+	return e
+}
+
+// FromMaxBytesError returns a PayloadTooLargeError if `err` comes from reading past the limit
+// of an `http.MaxBytesReader`, or nil otherwise.
+func FromMaxBytesError(err error) *AppError {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return nil
+	}
+	return NewPayloadTooLargeError(maxErr.Limit, err)
+}
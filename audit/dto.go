@@ -0,0 +1,102 @@
+// Package audit, as part of the audit module.
+// This file, `dto.go`, defines the actions that are audited and the bodies of the audit API.
+package audit
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/user/lensisku-go/validation"
+)
+
+// Audited actions, in Entry.Action. They are grouped by the part before the first dot, which
+// the action filter of the API also accepts.
+const (
+	ActionJobRetry                = "job.retry"
+	ActionTaskCancel              = "task.cancel"
+	ActionEmbeddingSettingsUpdate = "embedding.settings_update"
+	ActionEmbeddingPause          = "embedding.pause"
+	ActionEmbeddingResume         = "embedding.resume"
+	ActionEmbeddingReembed        = "embedding.reembed"
+	ActionImportStart             = "import.start"
+	ActionImportCancel            = "import.cancel"
+	ActionRevisionApprove         = "definition.revision_approve"
+	ActionRevisionReject          = "definition.revision_reject"
+	ActionDefinitionDelete        = "definition.delete"
+	ActionExampleApprove          = "example.approve"
+	ActionExampleReject           = "example.reject"
+	ActionExampleDelete           = "example.delete"
+	ActionUserRoleChange          = "user.role_change"
+	ActionFlagUpdate              = "flag.update"
+	ActionAdminRequest            = "admin.request"
+)
+
+// Kinds of targets, in Entry.TargetType.
+const (
+	TargetJob        = "job"
+	TargetTask       = "task"
+	TargetEmbeddings = "embeddings"
+	TargetImport     = "import"
+	TargetDefinition = "definition"
+	TargetExample    = "example"
+	TargetUser       = "user"
+	TargetFlag       = "flag"
+	TargetRoute      = "route"
+)
+
+// Entry is an action to record.
+type Entry struct {
+	ActorID    int
+	Action     string // One of the Action constants
+	TargetType string // One of the Target constants
+	TargetID   string
+	// Snapshots of the target, encoded as JSON; nil when there is nothing to show, e.g. no
+	// "after" for a deletion.
+	Before any
+	After  any
+}
+
+// Event is a recorded action.
+// @Description An audited action
+type Event struct {
+	// example: 1042
+	ID int64 `json:"id"`
+	// Missing if the user has been deleted since
+	// example: 1
+	ActorID *int32 `json:"actor_id,omitempty"`
+	// example: "admin"
+	ActorUsername *string `json:"actor_username,omitempty"`
+	// example: "definition.delete"
+	Action string `json:"action"`
+	// example: "definition"
+	TargetType string `json:"target_type"`
+	// example: "4212"
+	TargetID string          `json:"target_id"`
+	Before   json.RawMessage `json:"before,omitempty" swaggertype:"object"`
+	After    json.RawMessage `json:"after,omitempty" swaggertype:"object"`
+	// ID of the request that performed the action
+	// example: "host/abcdef-000042"
+	RequestID *string   `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EventListResponse is a page of events, most recent first.
+// @Description Page of audited actions
+type EventListResponse struct {
+	Events  []Event `json:"events"`
+	Page    int64   `json:"page"`
+	PerPage int64   `json:"per_page"`
+	// Whether older events follow
+	// example: true
+	HasMore bool `json:"has_more"`
+}
+
+// ListQuery filters the audit log; zero fields don't filter.
+type ListQuery struct {
+	ActorID int32 `form:"actor_id" validate:"omitempty,min=1"`
+	// An action, or a group of actions such as "definition"
+	Action string    `form:"action"`
+	Since  time.Time `form:"since"` // Inclusive
+	Until  time.Time `form:"until"` // Exclusive
+	validation.Pagination
+}
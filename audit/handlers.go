@@ -0,0 +1,72 @@
+// Package audit records who performed privileged and destructive actions, such as
+// administration, moderation and dictionary imports, with snapshots of what they changed, and
+// lets administrators search that record.
+// This file, `handlers.go`, serves GET /admin/audit, the filtered, paginated audit log.
+package audit
+
+import (
+	"net/http"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// AuditHandlers provides HTTP handlers for the audit log.
+type AuditHandlers struct {
+	service *AuditService
+}
+
+// NewAuditHandlers creates new AuditHandlers.
+func NewAuditHandlers(service *AuditService) *AuditHandlers {
+	return &AuditHandlers{service: service}
+}
+
+// HandleListEvents godoc
+// @Summary Search the audit log
+// @Description Returns audited actions (administration, moderation and dictionary imports), most recent first, with who performed them and snapshots of their target before and after. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param actor_id query int false "Only actions by this user"
+// @Param action query string false "Only this action, e.g. definition.delete, or this group of actions, e.g. definition"
+// @Param since query string false "Only actions at or after this time (RFC 3339)"
+// @Param until query string false "Only actions before this time (RFC 3339)"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Success 200 {object} EventListResponse "Events"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid filter or pagination"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/audit [get]
+func (h *AuditHandlers) HandleListEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseListQuery(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		events, err := h.service.List(r.Context(), q)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, events)
+	}
+}
+
+// parseListQuery reads the filters and the pagination.
+func parseListQuery(r *http.Request) (ListQuery, error) {
+	var q ListQuery
+	if err := validation.DecodeQuery(r, &q); err != nil {
+		return q, err
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return q, apperror.NewBadRequestError("until must be after since", nil)
+	}
+	return q, nil
+}
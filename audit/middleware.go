@@ -0,0 +1,57 @@
+// Package audit, as part of the audit module.
+// This file, `middleware.go`, records the requests made to a group of routes, the admin API in
+// particular. The actions behind them record their own entries with snapshots; this keeps the
+// requests themselves, including those that failed, so an admin's attempts show up too.
+package audit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/user/lensisku-go/auth"
+)
+
+// RequestRecord is the snapshot of an ActionAdminRequest entry.
+type RequestRecord struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Status int    `json:"status"`
+}
+
+// Middleware records every request that may change something (any method but GET, HEAD and
+// OPTIONS) once it is answered, with its route as the target. It runs after
+// `auth.JWTMiddleware`, so the actor is known.
+func (l *Log) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		actorID, _ := auth.GetUserIDFromContext(r.Context())
+		// The client may be gone by now; the entry is written anyway.
+		l.Record(context.WithoutCancel(r.Context()), Entry{
+			ActorID:    actorID,
+			Action:     ActionAdminRequest,
+			TargetType: TargetRoute,
+			TargetID:   r.Method + " " + route,
+			After:      RequestRecord{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Status: status},
+		})
+	})
+}
@@ -0,0 +1,139 @@
+// Package audit, as part of the audit module.
+// This file, `service.go`, writes and reads the audit log. An action that runs in a transaction
+// is recorded in it with Record, so the entry exists if and only if the action commits; an
+// action outside the database (pausing the embedding calculator, cancelling a task) is
+// recorded once done through a Log.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/logging"
+)
+
+// Record writes an entry through `q`, usually the transaction of the action. The request ID
+// is read from `ctx`.
+func Record(ctx context.Context, q db.Execer, e Entry) error {
+	before, err := encodeSnapshot(e.Before)
+	if err != nil {
+		return apperror.NewInternalError("failed to encode audit snapshot", err)
+	}
+	after, err := encodeSnapshot(e.After)
+	if err != nil {
+		return apperror.NewInternalError("failed to encode audit snapshot", err)
+	}
+	var requestID *string
+	if id := middleware.GetReqID(ctx); id != "" {
+		requestID = &id
+	}
+	var actorID *int
+	if e.ActorID != 0 {
+		actorID = &e.ActorID
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, before, after, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		actorID, e.Action, e.TargetType, e.TargetID, before, after, requestID)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to record audit entry", err)
+	}
+	return nil
+}
+
+// encodeSnapshot encodes a snapshot, keeping nil as SQL NULL.
+func encodeSnapshot(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, nil
+	}
+	return json.Marshal(v)
+}
+
+// Log records actions made outside a transaction.
+type Log struct {
+	db     *pgxpool.Pool
+	logger *slog.Logger
+}
+
+// NewLog creates a Log writing to the `audit_log` table.
+func NewLog(db *pgxpool.Pool) *Log {
+	return &Log{db: db, logger: logging.For("audit")}
+}
+
+// Record writes an entry for an action already done. The action can't be undone any more, so
+// a failure is logged, with the entry, rather than returned. A nil Log records nothing.
+func (l *Log) Record(ctx context.Context, e Entry) {
+	if l == nil {
+		return
+	}
+	if err := Record(ctx, l.db, e); err != nil {
+		l.logger.ErrorContext(ctx, "Failed to record audit entry",
+			"actor_id", e.ActorID, "action", e.Action, "target_type", e.TargetType, "target_id", e.TargetID, "error", err)
+	}
+}
+
+// AuditService provides the audit API.
+// It reads through the app pool, or a db.DB reading from a replica.
+type AuditService struct {
+	db db.Querier
+}
+
+// NewAuditService creates a new AuditService.
+func NewAuditService(reader db.Querier) *AuditService {
+	return &AuditService{db: reader}
+}
+
+// List returns a page of the events matching `q`, most recent first. One more row than a page
+// is fetched to tell whether more follow.
+func (s *AuditService) List(ctx context.Context, q ListQuery) (*EventListResponse, error) {
+	var since, until *time.Time
+	if !q.Since.IsZero() {
+		since = &q.Since
+	}
+	if !q.Until.IsZero() {
+		until = &q.Until
+	}
+	rows, err := s.db.Query(ctx, `
+		SELECT a.id, a.actor_id, u.username, a.action, a.target_type, a.target_id,
+		       a.before, a.after, a.request_id, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON u.userid = a.actor_id
+		WHERE ($1 = 0 OR a.actor_id = $1)
+		  AND ($2 = '' OR a.action = $2 OR starts_with(a.action, $2 || '.'))
+		  AND ($3::timestamptz IS NULL OR a.created_at >= $3)
+		  AND ($4::timestamptz IS NULL OR a.created_at < $4)
+		ORDER BY a.id DESC
+		LIMIT $5 OFFSET $6`,
+		q.ActorID, q.Action, since, until, q.PerPage+1, q.Offset())
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list audit events", err)
+	}
+	defer rows.Close()
+	resp := &EventListResponse{Events: []Event{}, Page: q.Page, PerPage: q.PerPage}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorUsername, &e.Action, &e.TargetType, &e.TargetID,
+			&e.Before, &e.After, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read audit event", err)
+		}
+		resp.Events = append(resp.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list audit events", err)
+	}
+	if int64(len(resp.Events)) > q.PerPage {
+		resp.Events = resp.Events[:q.PerPage]
+		resp.HasMore = true
+	}
+	return resp, nil
+}
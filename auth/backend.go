@@ -0,0 +1,158 @@
+// Package auth, as part of the authentication module.
+// This file, `backend.go`, defines the pluggable authentication backend interface.
+// A backend only answers "are these credentials valid, and who is this?"; token issuing
+// stays in `AuthService`, so users authenticated by an external directory still receive
+// local JWTs and have a local profile row.
+// In Nest.js terms, a backend plays the role of a Passport strategy (e.g. `passport-local`, `passport-ldapauth`).
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/tracing"
+	"github.com/user/lensisku-go/userrepo"
+)
+
+// authSourceLocal is the `users.auth_source` value for accounts with a local password.
+const authSourceLocal = userrepo.AuthSourceLocal
+
+// errInvalidCredentials is returned by a backend when it knows the credentials are wrong
+// (or the user is unknown to it). `AuthService` then tries the next backend.
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// Identity describes a user successfully authenticated by a backend.
+type Identity struct {
+	// UserID is set by backends that authenticate existing local accounts.
+	// External backends leave it at 0 and the account is provisioned on first login.
+	UserID   int
+	Username string
+	Email    string
+}
+
+// Backend is implemented by every authentication source.
+type Backend interface {
+	// Name identifies the backend and is stored in `users.auth_source` for provisioned accounts.
+	Name() string
+	// Authenticate checks the credentials. It returns errInvalidCredentials for a plain rejection
+	// and any other error when the backend itself failed (e.g. the directory is unreachable).
+	Authenticate(ctx context.Context, login, password string) (*Identity, error)
+}
+
+// newBackends builds the configured backend chain, in the order given by `AUTH_BACKENDS`.
+func newBackends(s *AuthService, cfg config.AuthConfig) []Backend {
+	backends := make([]Backend, 0, len(cfg.Backends))
+	for _, name := range cfg.Backends {
+		switch name {
+		case authSourceLocal:
+			backends = append(backends, &localBackend{service: s})
+		case "ldap":
+			backends = append(backends, NewLDAPBackend(cfg.LDAP))
+		}
+	}
+	if len(backends) == 0 {
+		// Config validation prevents this, but never leave login without a backend.
+		backends = append(backends, &localBackend{service: s})
+	}
+	return backends
+}
+
+// localBackend authenticates against the bcrypt password hashes in the `users` table.
+type localBackend struct {
+	service *AuthService
+}
+
+func (b *localBackend) Name() string { return authSourceLocal }
+
+func (b *localBackend) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	// Retrieve the user by their login identifier (username or email).
+	user, err := b.service.getUserByLogin(ctx, login)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errInvalidCredentials
+		}
+		return nil, apperror.NewDatabaseError("failed to get user", err)
+	}
+
+	// Compare the provided password with the stored hashed password.
+	// Accounts owned by external backends carry a placeholder hash, so this always fails for them.
+	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+	return &Identity{UserID: user.ID, Username: user.Username, Email: user.Email}, nil
+}
+
+// authenticate runs the backend chain and returns the local user ID of the authenticated account.
+// A backend failure (as opposed to a rejection) is logged and the next backend is tried, so an
+// LDAP outage doesn't lock out local accounts; if every backend fails, the last failure is returned.
+func (s *AuthService) authenticate(ctx context.Context, login, password string) (int, error) {
+	var lastFailure error
+	for _, backend := range s.backends {
+		bctx, span := s.tracer.Start(ctx, "Backend.Authenticate", trace.WithAttributes(attribute.String("auth.backend", backend.Name())))
+		identity, err := backend.Authenticate(bctx, login, password)
+		if errors.Is(err, errInvalidCredentials) {
+			span.End() // A rejection, not a failure
+		} else {
+			tracing.End(span, err)
+		}
+		if err != nil {
+			if !errors.Is(err, errInvalidCredentials) {
+				s.logger.WarnContext(ctx, "Authentication backend failed", "backend", backend.Name(), "error", err)
+				lastFailure = err
+			}
+			continue
+		}
+		if identity.UserID != 0 {
+			return identity.UserID, nil
+		}
+		return s.provisionExternalUser(ctx, backend.Name(), identity)
+	}
+	if lastFailure != nil {
+		if _, ok := apperror.FromError(lastFailure); ok {
+			return 0, lastFailure
+		}
+		return 0, apperror.NewUnavailableError("authentication backend unavailable", lastFailure).WithCode(apperror.CodeAuthBackendDown)
+	}
+	// Avoid revealing whether the username or password was wrong.
+	return 0, apperror.NewUnauthorizedError("invalid credentials", nil).WithCode(apperror.CodeInvalidCredentials)
+}
+
+// provisionExternalUser finds or creates the local account for an externally authenticated identity.
+// An existing account is only reused if it belongs to the same backend; otherwise a directory user
+// could take over a local account that happens to share the username.
+func (s *AuthService) provisionExternalUser(ctx context.Context, source string, identity *Identity) (int, error) {
+	existing, err := s.users.GetByUsername(ctx, identity.Username)
+	if err == nil {
+		if existing.AuthSource != source {
+			return 0, apperror.NewConflictError(fmt.Sprintf("username '%s' already belongs to a %s account", identity.Username, existing.AuthSource), nil).WithCode(apperror.CodeUsernameOtherSource)
+		}
+		return existing.ID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, apperror.NewDatabaseError("failed to look up external user", err)
+	}
+
+	// The placeholder is not a valid bcrypt hash, so the account can never log in locally.
+	user := &User{Username: identity.Username, Email: identity.Email, HashedPassword: "!" + source, AuthSource: source}
+	if err = s.users.Create(ctx, user); err != nil {
+		// The directory's address may already belong to another account, local or external.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation && strings.Contains(pgErr.ConstraintName, "email") {
+			return 0, apperror.NewConflictError(fmt.Sprintf("email '%s' of directory user '%s' already belongs to another account", identity.Email, identity.Username), nil).WithCode(apperror.CodeEmailExists)
+		}
+		return 0, apperror.NewDatabaseError("failed to provision external user", err)
+	}
+	s.logger.InfoContext(ctx, "Provisioned local account", "user_id", user.ID, "source", source, "username", identity.Username)
+	return user.ID, nil
+}
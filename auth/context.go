@@ -36,6 +36,19 @@ func ClaimsFromContext(ctx context.Context) (*CustomClaims, bool) {
 	return claims, ok
 }
 
+// SessionTypeFromContext returns the session type ("session" or "remembered") of the
+// authenticated request. It returns false if there are no claims in the context.
+func SessionTypeFromContext(ctx context.Context) (string, bool) {
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	if claims.SessionType == "" {
+		return SessionTypeRemembered, true // tokens minted before session types existed
+	}
+	return claims.SessionType, true
+}
+
 // RequireAuth returns a function that checks if the user has required roles
 func RequireAuth(roles ...string) func(ctx context.Context) error {
 	// This function uses a higher-order function pattern: it returns another function.
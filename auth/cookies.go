@@ -0,0 +1,207 @@
+// Package auth, as part of the authentication module.
+// This file, `cookies.go`, implements cookie sessions, an alternative to bearer tokens for the
+// web frontend. A login asking for a cookie session gets its tokens as HttpOnly cookies, out of
+// reach of scripts, and a CSRF token. Browsers send the cookies with every request, including
+// requests forged by other sites, so requests that change something must repeat the CSRF token
+// in the `X-CSRF-Token` header (the double-submit pattern): another site can make the browser
+// send the cookies, but can't read them to copy the token.
+//
+// The CSRF token is signed for the user of the session, so a token planted from another
+// subdomain, or taken from the attacker's own session, doesn't pass.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+)
+
+const (
+	// AccessCookieName holds the access token of a cookie session.
+	AccessCookieName = "lensisku_access"
+	// RefreshCookieName holds the refresh token; it is only sent to the /auth routes.
+	RefreshCookieName = "lensisku_refresh"
+	// CSRFCookieName holds the CSRF token. Unlike the others it isn't HttpOnly: the frontend
+	// reads it to repeat it in CSRFHeader.
+	CSRFCookieName = "lensisku_csrf"
+	// CSRFHeader carries the CSRF token on changing requests of cookie sessions.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// refreshCookiePath keeps the refresh token from being sent with every request.
+const refreshCookiePath = "/auth"
+
+// sessionCookies writes and clears the cookies of a cookie session.
+type sessionCookies struct {
+	cfg *config.SessionCookieConfig
+}
+
+func (c sessionCookies) set(w http.ResponseWriter, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   c.cfg.Domain,
+		Secure:   c.cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite(c.cfg.SameSite),
+	}
+	switch {
+	case maxAge > 0:
+		cookie.MaxAge = int(maxAge.Seconds())
+	case maxAge < 0:
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// clear removes the cookies of a session.
+func (c sessionCookies) clear(w http.ResponseWriter) {
+	c.set(w, AccessCookieName, "", "/", -1, true)
+	c.set(w, RefreshCookieName, "", refreshCookiePath, -1, true)
+	c.set(w, CSRFCookieName, "", "/", -1, false)
+}
+
+func sameSite(mode string) http.SameSite {
+	switch mode {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// startCookieSession moves the tokens of `resp` into cookies, adds a CSRF token, and blanks the
+// tokens in `resp` so scripts never see them. Without `resp.RefreshToken`, as after a refresh,
+// the refresh cookie is left alone. Short sessions get a refresh cookie that ends with the
+// browser session, remembered ones one that lasts as long as the token.
+func (s *AuthService) startCookieSession(w http.ResponseWriter, resp *TokenResponse) error {
+	c := sessionCookies{cfg: s.authConfig.Cookies}
+	claims, err := s.validateToken(resp.AccessToken, tokenTypeAccess)
+	if err != nil {
+		return err
+	}
+	csrf, err := newCSRFToken(s.authConfig.JWTSecret, claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	var lifetime time.Duration // A browser session
+	if resp.SessionType == SessionTypeRemembered {
+		lifetime = s.authConfig.RefreshTokenDuration
+	}
+	c.set(w, AccessCookieName, resp.AccessToken, "/", s.authConfig.AccessTokenDuration, true)
+	if resp.RefreshToken != "" {
+		c.set(w, RefreshCookieName, resp.RefreshToken, refreshCookiePath, lifetime, true)
+	}
+	c.set(w, CSRFCookieName, csrf, "/", lifetime, false)
+
+	resp.AccessToken, resp.RefreshToken = "", ""
+	resp.TokenType = "Cookie"
+	resp.CSRFToken = csrf
+	return nil
+}
+
+// cookieToken returns the token in the cookie `name`, if cookie sessions are enabled.
+func cookieToken(cfg *config.AuthConfig, r *http.Request, name string) string {
+	if cfg.Cookies == nil {
+		return ""
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// newCSRFToken returns a random token signed for `userID`: "<random>.<signature>".
+func newCSRFToken(secret string, userID int) (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(nonce)
+	return encoded + "." + csrfSignature(secret, encoded, userID), nil
+}
+
+func csrfSignature(secret, nonce string, userID int) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf|" + nonce + "|" + strconv.Itoa(userID)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validCSRFToken tells whether `token` was signed for `userID`.
+func validCSRFToken(secret, token string, userID int) bool {
+	nonce, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(csrfSignature(secret, nonce, userID)))
+}
+
+// CSRFMiddleware rejects changing requests (anything but GET, HEAD and OPTIONS) of cookie
+// sessions whose X-CSRF-Token header doesn't repeat the CSRF cookie, or whose token wasn't
+// signed for the session's user. Requests with an Authorization header, and requests without
+// a valid session cookie, aren't cookie sessions and pass: browsers never add the header to
+// forged requests, and an anonymous request has no session to abuse. The `exempt` paths pass
+// too; they must authorize their requests otherwise, as signed links do. It does nothing unless
+// cookie sessions are enabled.
+func CSRFMiddleware(cfg *config.AuthConfig, exempt ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if cfg.Cookies == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Header.Get("Authorization") != "" || slices.Contains(exempt, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			userID, ok := cookieSessionUser(cfg, r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := r.Header.Get(CSRFHeader)
+			cookie := cookieToken(cfg, r, CSRFCookieName)
+			if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 ||
+				!validCSRFToken(cfg.JWTSecret, header, userID) {
+				WriteError(w, r, apperror.NewUnauthorizedError("missing or invalid CSRF token", nil).WithCode(apperror.CodeInvalidCSRFToken))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// cookieSessionUser returns the user of the cookie session of `r`: that of the access token,
+// or of the refresh token once the access token has expired, as when the frontend refreshes.
+func cookieSessionUser(cfg *config.AuthConfig, r *http.Request) (int, bool) {
+	if token := cookieToken(cfg, r, AccessCookieName); token != "" {
+		if claims, err := parseToken(cfg.JWTSecret, token, tokenTypeAccess); err == nil && claims.UserID != 0 {
+			return claims.UserID, true
+		}
+	}
+	if token := cookieToken(cfg, r, RefreshCookieName); token != "" {
+		if claims, err := parseToken(cfg.JWTSecret, token, tokenTypeRefresh); err == nil && claims.UserID != 0 {
+			return claims.UserID, true
+		}
+	}
+	return 0, false
+}
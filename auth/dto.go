@@ -1,7 +1,8 @@
 // Package auth provides authentication and authorization functionality
 // This file, `dto.go` (Data Transfer Object), defines structures used for
 // transferring data in API requests and responses related to authentication.
-// These are similar to DTOs in Nest.js, often used with validation pipes/decorators.
+// These are similar to DTOs in Nest.js, often used with validation pipes/decorators; here the
+// `validate:"..."` tags play the part of the decorators (see the `validation` package).
 package auth
 
 // RegisterRequest represents the registration request payload
@@ -9,45 +10,68 @@ package auth
 // Struct tags `json:"..."` define how these fields map to JSON keys.
 // `example:"..."` tags are for Swagger/OpenAPI documentation.
 type RegisterRequest struct {
-	Username string `json:"username" example:"newuser"`
-	Email    string `json:"email" example:"user@example.com"`
-	Password string `json:"password" example:"strongpassword123"`
+	Username string `json:"username" example:"newuser" validate:"required,max=64,username"`
+	Email    string `json:"email" example:"user@example.com" validate:"required,max=254,email"`
+	// bcrypt ignores anything past 72 bytes, so longer passwords are refused.
+	Password string `json:"password" example:"strongpassword123" validate:"required,max=72"`
+	// InviteCode is required only when the server runs in invite-only mode.
+	InviteCode string `json:"invite_code,omitempty" example:"k3q9x2mfp7"`
 }
 
 // LoginRequest represents the login request payload
 // Contains fields for a user to log in.
 type LoginRequest struct {
-	Login    string `json:"login" example:"user@example.com"` // Can be username or email
-	Password string `json:"password" example:"strongpassword123"`
+	Login    string `json:"login" example:"user@example.com" validate:"required"` // Can be username or email
+	Password string `json:"password" example:"strongpassword123" validate:"required"`
+	// RememberMe selects a long-lived refresh token; otherwise a short session token is issued.
+	RememberMe bool `json:"remember_me,omitempty" example:"true"`
+	// CookieSession asks for a cookie session instead of bearer tokens, when the server enables
+	// them: the tokens are set as HttpOnly cookies and the response carries a CSRF token instead.
+	CookieSession bool `json:"cookie_session,omitempty" example:"false"`
 }
 
 // TokenResponse represents the authentication token response
 // This structure is returned to the client upon successful login or token refresh.
 type TokenResponse struct {
-	AccessToken  string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	RefreshToken string `json:"refresh_token" example:"def50200..."`
+	// The tokens are absent in cookie sessions, which keep them in cookies.
+	AccessToken  string `json:"access_token,omitempty" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	RefreshToken string `json:"refresh_token,omitempty" example:"def50200..."`
 	// TokenType and ExpiresIn are common fields in OAuth2-like token responses.
 	// TokenType and ExpiresIn can be kept or removed; for now, let's keep them as they are common.
 	// If they cause issues with Rust compatibility, they can be removed.
-	TokenType string `json:"token_type" example:"Bearer"` // Typically "Bearer" for JWTs.
+	TokenType string `json:"token_type" example:"Bearer"` // "Bearer", or "Cookie" for cookie sessions.
 	ExpiresIn int64  `json:"expires_in" example:"3600"` // Expiration time of the access token in seconds.
+	// SessionType is "remembered" for "remember me" logins and "session" otherwise.
+	SessionType string `json:"session_type" example:"session"`
+	// CSRFToken is only set in cookie sessions. It must be repeated in the `X-CSRF-Token` header
+	// of every request that changes something; it is also in the `lensisku_csrf` cookie.
+	CSRFToken string `json:"csrf_token,omitempty" example:"q3Jx...Zk0.9fQ..."`
 }
 
 // RefreshTokenRequest represents the token refresh request payload
 // Used when a client wants to obtain a new access token using a refresh token.
 type RefreshTokenRequest struct {
-	RefreshToken string `json:"refresh_token" example:"def50200..."`
+	RefreshToken string `json:"refresh_token" example:"def50200..." validate:"required"`
 }
 
-// TokenClaims represents the custom claims in the JWT token.
-// This will be used internally for generating and validating tokens.
-type TokenClaims struct {
-	// These are custom claims specific to this application, embedded within the JWT.
-	// `UserID` is essential for identifying the authenticated user.
-	UserID    int64  `json:"user_id"`
-	TokenType string `json:"token_type"` // "access" or "refresh"
-	// We can add more claims like username/email if needed for the access token,
-	// but UserID is the primary identifier.
-	// For now, keeping it minimal as per the direct requirements for token generation.
-	// jwt.RegisteredClaims will be embedded for standard claims like exp, iat, nbf.
-}
\ No newline at end of file
+// CreateInviteRequest represents the payload for generating a new invite code.
+// Both fields are optional: `MaxUses` falls back to the configured default and
+// `ExpiresInHours` of zero creates a code without expiry.
+type CreateInviteRequest struct {
+	MaxUses        *int    `json:"max_uses,omitempty" example:"5" validate:"omitnil,min=1"`
+	ExpiresInHours int     `json:"expires_in_hours,omitempty" example:"72" validate:"min=0"`
+	Note           *string `json:"note,omitempty" example:"For the Lojban study group"`
+}
+
+// SudoRequest represents the payload for obtaining a step-up ("sudo") token.
+// The user re-enters their password to prove they are still in control of the session.
+type SudoRequest struct {
+	Password string `json:"password" example:"strongpassword123" validate:"required"`
+}
+
+// SudoTokenResponse is returned after a successful re-authentication.
+// The token must be sent in the `X-Sudo-Token` header on sensitive requests.
+type SudoTokenResponse struct {
+	SudoToken string `json:"sudo_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresIn int64  `json:"expires_in" example:"1700000300"` // Expiration time of the sudo token (Unix seconds)
+}
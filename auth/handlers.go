@@ -5,10 +5,17 @@
 package auth
 
 import (
-	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5/middleware"
+
 	// `apperror` provides standardized error types and responses.
 	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
 )
 
 // Handlers wraps the AuthService to provide HTTP handlers
@@ -38,6 +45,7 @@ return &Handlers{service: service}
 // @Param registerBody body auth.RegisterRequest true "User registration details"
 // @Success 201 {object} auth.User "User created successfully"
 // @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid input or missing fields"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Missing or invalid invite code (invite-only mode)"
 // @Failure 409 {object} apperror.ErrorResponse "Conflict - User already exists (username or email)"
 // @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
 // @Router /auth/register [post]
@@ -51,21 +59,15 @@ func (h *Handlers) HandleRegister() http.HandlerFunc {
 
 	// Declare a variable `req` of type `RegisterRequest` (our DTO for registration).
 	var req RegisterRequest
-	// Decode the JSON request body into the `req` struct.
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, r, apperror.NewBadRequestError("invalid request body: "+err.Error(), nil))
+	// Decode the JSON request body into the `req` struct and check it against the rules in
+	// its `validate` tags (required fields, lengths, email format).
+	if err := validation.DecodeJSON(r, &req); err != nil {
+		WriteError(w, r, err)
 		return
 	}
 	// `defer r.Body.Close()` ensures the request body is closed after the handler finishes.
 	defer r.Body.Close()
 
-	// Perform basic validation on the request DTO.
-	// Basic validation (can be expanded with a validation library if needed)
-	if req.Username == "" || req.Email == "" || req.Password == "" {
-		WriteError(w, r, apperror.NewBadRequestError("username, email, and password are required", nil))
-		return
-	}
-
 	// Call the `Register` method on the `AuthService` to perform the business logic.
 	user, err := h.service.Register(r.Context(), req)
 	if err != nil {
@@ -76,14 +78,14 @@ func (h *Handlers) HandleRegister() http.HandlerFunc {
 	// For registration, typically return 201 Created with the user object (excluding password)
 	// or a success message. Here, we return the created user object.
 	user.HashedPassword = "" // Ensure hashed password is not sent in response
-	// `writeJSON` is a helper function to send a JSON response with a specific status code.
-	writeJSON(w, http.StatusCreated, user)
+	// `render.Write` sends the response with a specific status code, as JSON unless the client asks for another encoding.
+	render.Write(w, r, http.StatusCreated, user)
 }
 }
 
 // HandleLogin godoc
 // @Summary User Login
-// @Description Logs in an existing user and returns access and refresh tokens.
+// @Description Logs in an existing user and returns access and refresh tokens. With `cookie_session`, the tokens are set as HttpOnly cookies instead and the response carries a CSRF token.
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -96,17 +98,15 @@ func (h *Handlers) HandleRegister() http.HandlerFunc {
 // `HandleLogin` follows the same pattern as `HandleRegister`.
 func (h *Handlers) HandleLogin() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-	// Decode the login request DTO.
+	// Decode and validate the login request DTO.
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, r, apperror.NewBadRequestError("invalid request body: "+err.Error(), nil))
+	if err := validation.DecodeJSON(r, &req); err != nil {
+		WriteError(w, r, err)
 		return
 	}
 	defer r.Body.Close()
-
-	// Basic validation.
-	if req.Login == "" || req.Password == "" {
-		WriteError(w, r, apperror.NewBadRequestError("login and password are required", nil))
+	if req.CookieSession && h.service.authConfig.Cookies == nil {
+		WriteError(w, r, apperror.NewBadRequestError("cookie sessions are not enabled on this server", nil))
 		return
 	}
 
@@ -117,13 +117,20 @@ func (h *Handlers) HandleLogin() http.HandlerFunc {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	// Cookie sessions get their tokens as cookies rather than in the body.
+	if req.CookieSession {
+		if err := h.service.startCookieSession(w, resp); err != nil {
+			WriteError(w, r, apperror.NewInternalError("failed to start cookie session", err))
+			return
+		}
+	}
+	render.Write(w, r, http.StatusOK, resp)
 }
 }
 
 // HandleRefreshToken godoc
 // @Summary Refresh Access Token
-// @Description Provides a new access token and refresh token using a valid refresh token.
+// @Description Provides a new access token and refresh token using a valid refresh token. Cookie sessions send no body: the refresh token is taken from its cookie, the new access token is set as a cookie, and the request must carry the X-CSRF-Token header.
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -140,17 +147,30 @@ func (h *Handlers) HandleLogin() http.HandlerFunc {
 // @Security BearerAuth
 func (h *Handlers) HandleRefreshToken() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+	// In a cookie session the refresh token is in its cookie, and the new access token goes
+	// back into one. `CSRFMiddleware` has checked the CSRF token already.
+	if token := cookieToken(&h.service.authConfig, r, RefreshCookieName); token != "" {
+		resp, err := h.service.RefreshToken(r.Context(), token)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		resp.RefreshToken = "" // Unchanged; its cookie stays as it is
+		if err := h.service.startCookieSession(w, resp); err != nil {
+			WriteError(w, r, apperror.NewInternalError("failed to refresh cookie session", err))
+			return
+		}
+		render.Write(w, r, http.StatusOK, resp)
+		return
+	}
+
 	// Decode the refresh token request DTO.
 	var req RefreshTokenRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		WriteError(w, r, apperror.NewBadRequestError("invalid request body: "+err.Error(), nil))
+	if err := validation.DecodeJSON(r, &req); err != nil {
+		WriteError(w, r, err)
 		return
 	}
 	defer r.Body.Close()
-	if req.RefreshToken == "" {
-		WriteError(w, r, apperror.NewBadRequestError("refresh_token is required", nil))
-		return
-	}
 	// Call the `RefreshToken` method on the `AuthService`.
 	resp, err := h.service.RefreshToken(r.Context(), req.RefreshToken)
 	if err != nil {
@@ -158,27 +178,136 @@ func (h *Handlers) HandleRefreshToken() http.HandlerFunc {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	render.Write(w, r, http.StatusOK, resp)
 }
 }
 
-// Helper functions for writing responses
-// These helpers centralize response writing logic.
-
-// `writeJSON` serializes `data` to JSON and writes it to the `http.ResponseWriter` with the given `status`.
-func writeJSON(w http.ResponseWriter, status int, data interface{}) {
-w.Header().Set("Content-Type", "application/json")
-w.WriteHeader(status)
-// Check if data is nil to avoid writing "null" as the response body if no data is intended.
-if data != nil { // Avoid writing nil, which can result in "null" response body
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		// Log this error, as it's a server-side issue if encoding fails
-		// For now, we can't do much more in the response itself
-		http.Error(w, `{"error":"failed to encode response"}`, http.StatusInternalServerError)
+// HandleLogout godoc
+// @Summary Log Out
+// @Description Ends a cookie session by clearing its cookies. Tokens aren't revoked: bearer clients log out by discarding theirs, and the access token of a cookie session stays valid until it expires.
+// @Tags Auth
+// @Success 204 "Logged out"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Missing or invalid CSRF token"
+// @Router /auth/logout [post]
+func (h *Handlers) HandleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg := h.service.authConfig.Cookies; cfg != nil {
+			sessionCookies{cfg: cfg}.clear(w)
+		}
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// HandleCreateInvite godoc
+// @Summary Create Invite Code
+// @Description Generates a limited-use invite code. Only admins and trusted users may create invites.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param inviteBody body auth.CreateInviteRequest false "Invite options"
+// @Success 201 {object} auth.InviteCode "Invite created"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid options"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not allowed to create invites"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /auth/invites [post]
+func (h *Handlers) HandleCreateInvite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := GetUserIDFromContext(r.Context())
+		if !ok {
+			WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		// The body is optional; an empty body creates an invite with default settings.
+		var req CreateInviteRequest
+		if r.ContentLength != 0 {
+			if err := validation.DecodeJSON(r, &req); err != nil {
+				WriteError(w, r, err)
+				return
+			}
+		}
+		defer r.Body.Close()
+
+		invite, err := h.service.CreateInvite(r.Context(), userID, req)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		render.Write(w, r, http.StatusCreated, invite)
+	}
+}
+
+// HandleListInvites godoc
+// @Summary List My Invite Codes
+// @Description Lists the invite codes created by the current user together with their usage.
+// @Tags Auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} auth.InviteCode "Invite codes"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /auth/invites [get]
+func (h *Handlers) HandleListInvites() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := GetUserIDFromContext(r.Context())
+		if !ok {
+			WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		invites, err := h.service.ListInvites(r.Context(), userID)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		render.Write(w, r, http.StatusOK, invites)
+	}
+}
+
+// HandleSudo godoc
+// @Summary Obtain Sudo Token
+// @Description Re-authenticates the current user with their password and returns a short-lived token required for sensitive operations (send it in the X-Sudo-Token header).
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param sudoBody body auth.SudoRequest true "Current password"
+// @Success 200 {object} auth.SudoTokenResponse "Sudo token issued"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing password"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Invalid credentials"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /auth/sudo [post]
+func (h *Handlers) HandleSudo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := GetUserIDFromContext(r.Context())
+		if !ok {
+			WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req SudoRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		resp, err := h.service.IssueSudoToken(r.Context(), userID, req.Password)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		render.Write(w, r, http.StatusOK, resp)
+	}
 }
 
+// Helper functions for writing responses
+// These helpers centralize response writing logic; bodies are written by `render.Write`, in the
+// encoding the client accepts.
+
 // WriteError uses the apperror system to write standardized error responses.
 // It now accepts the *http.Request to potentially log more context if needed.
 // This function converts any error into a standardized `apperror.ErrorResponse`.
@@ -191,10 +320,22 @@ if !ok {
 	appErr = apperror.NewInternalError("an unexpected error occurred: " + err.Error(), err)
 }
 
-// Log the error internally (especially for 5xx errors)
-// Placeholder for more sophisticated logging. In a production app, a structured logger would be used.
-// log.Printf("Error processing request %s %s: %v", r.Method, r.URL.Path, appErr.LogError())
+// Log server errors internally, with the underlying cause that the response doesn't show,
+// and send them to the error-reporting service, if any.
+if appErr.StatusCode() >= http.StatusInternalServerError {
+	logging.For("http").ErrorContext(r.Context(), "Error processing request",
+		"method", r.Method, "path", r.URL.Path, "error", appErr)
+	apperror.Report(r, appErr)
+}
+
+// Transient failures tell the client when to try again, in whole seconds.
+if d := appErr.RetryAfter(); d > 0 {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
 
-// Use `writeJSON` to send the standardized error response.
-writeJSON(w, appErr.StatusCode(), appErr.ToResponse())
+// Use `render.Write` to send the standardized error response.
+// The request ID lets a user's report of the error be matched with the server logs.
+resp := appErr.ToResponse()
+resp.RequestID = middleware.GetReqID(r.Context())
+render.Write(w, r, appErr.StatusCode(), resp)
 }
@@ -0,0 +1,161 @@
+// Package auth, as part of the authentication module.
+// This file, `invites.go`, implements invite-only registration: generating limited-use
+// invite codes and redeeming them when a new account is created.
+// Redemptions are recorded in `invite_redemptions` so every account can be attributed
+// to the user who invited it.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+)
+
+// inviteCodeBytes is the amount of randomness in a generated code (10 bytes -> 16 base32 characters).
+const inviteCodeBytes = 10
+
+// CreateInvite generates a new invite code on behalf of `userID`.
+// Only users with the admin or trusted role are allowed to create invites.
+func (s *AuthService) CreateInvite(ctx context.Context, userID int, req CreateInviteRequest) (*InviteCode, error) {
+	role, err := s.getUserRole(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role != RoleAdmin && role != RoleTrusted {
+		return nil, apperror.NewUnauthorizedError("only admins and trusted users can create invites", nil)
+	}
+
+	maxUses := s.authConfig.InviteDefaultMaxUses
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
+	}
+	if maxUses < 1 {
+		return nil, apperror.NewValidationError("max_uses must be at least 1", nil)
+	}
+	if req.ExpiresInHours < 0 {
+		return nil, apperror.NewValidationError("expires_in_hours cannot be negative", nil)
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		return nil, apperror.NewInternalError("failed to generate invite code", err)
+	}
+
+	invite := &InviteCode{
+		Code:      code,
+		CreatedBy: userID,
+		MaxUses:   maxUses,
+		Note:      req.Note,
+	}
+	if req.ExpiresInHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	query := `INSERT INTO invite_codes (code, created_by, max_uses, note, expires_at)
+	          VALUES ($1, $2, $3, $4, $5)
+	          RETURNING id, uses, created_at`
+	err = s.dbPool.QueryRow(ctx, query, invite.Code, invite.CreatedBy, invite.MaxUses, invite.Note, invite.ExpiresAt).
+		Scan(&invite.ID, &invite.Uses, &invite.CreatedAt)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to create invite code", err)
+	}
+	return invite, nil
+}
+
+// ListInvites returns the invite codes created by `userID`, newest first.
+func (s *AuthService) ListInvites(ctx context.Context, userID int) ([]InviteCode, error) {
+	query := `SELECT id, code, created_by, max_uses, uses, note, expires_at, created_at
+	          FROM invite_codes
+	          WHERE created_by = $1
+	          ORDER BY created_at DESC`
+	rows, err := s.dbPool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list invite codes", err)
+	}
+	defer rows.Close()
+
+	invites := []InviteCode{}
+	for rows.Next() {
+		var inv InviteCode
+		if err := rows.Scan(&inv.ID, &inv.Code, &inv.CreatedBy, &inv.MaxUses, &inv.Uses, &inv.Note, &inv.ExpiresAt, &inv.CreatedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to scan invite code", err)
+		}
+		invites = append(invites, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to iterate invite codes", err)
+	}
+	return invites, nil
+}
+
+// createUserWithInvite inserts the user and redeems the invite code in a single transaction.
+// The invite row is locked with `FOR UPDATE` so two registrations can't both take the last use.
+func (s *AuthService) createUserWithInvite(ctx context.Context, user *User, code string) (*User, error) {
+	err := db.WithTx(ctx, s.dbPool, func(tx pgx.Tx) error {
+		var inviteID, maxUses, uses int
+		var expiresAt *time.Time
+		err := tx.QueryRow(ctx, `SELECT id, max_uses, uses, expires_at FROM invite_codes WHERE code = $1 FOR UPDATE`, code).
+			Scan(&inviteID, &maxUses, &uses, &expiresAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return apperror.NewUnauthorizedError("invalid invite code", nil).WithCode(apperror.CodeInviteInvalid)
+			}
+			return err
+		}
+		if expiresAt != nil && time.Now().After(*expiresAt) {
+			return apperror.NewUnauthorizedError("invite code has expired", nil).WithCode(apperror.CodeInviteExpired)
+		}
+		if uses >= maxUses {
+			return apperror.NewUnauthorizedError("invite code has already been used up", nil).WithCode(apperror.CodeInviteUsedUp)
+		}
+
+		if err = s.users.WithTx(tx).Create(ctx, user); err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(ctx, `UPDATE invite_codes SET uses = uses + 1 WHERE id = $1`, inviteID); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(ctx, `INSERT INTO invite_redemptions (invite_id, user_id) VALUES ($1, $2)`, inviteID, user.ID); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// getUserRole looks up the role of a user. Missing users are reported as NotFound.
+func (s *AuthService) getUserRole(ctx context.Context, userID int) (string, error) {
+	var role string
+	err := s.dbPool.QueryRow(ctx, `SELECT role FROM users WHERE userid = $1`, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+		}
+		return "", apperror.NewDatabaseError("failed to get user role", err)
+	}
+	return role, nil
+}
+
+// generateInviteCode returns a random, human-friendly (lowercase base32, no padding) code.
+func generateInviteCode() (string, error) {
+	buf := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf)
+	return strings.ToLower(code), nil
+}
@@ -0,0 +1,112 @@
+// Package auth, as part of the authentication module.
+// This file, `ldap.go`, implements the LDAP authentication backend.
+// It follows the usual "search then bind" flow: a service account finds the user's entry,
+// then a bind with the user's DN and password proves the credentials.
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// LDAPBackend authenticates users against an LDAP directory.
+type LDAPBackend struct {
+	cfg *config.LDAPConfig
+}
+
+// NewLDAPBackend creates a new LDAPBackend from configuration.
+func NewLDAPBackend(cfg *config.LDAPConfig) *LDAPBackend {
+	return &LDAPBackend{cfg: cfg}
+}
+
+// Name returns "ldap", which is also stored as `users.auth_source` for provisioned accounts.
+func (b *LDAPBackend) Name() string { return "ldap" }
+
+// Authenticate looks the user up and verifies the password with a bind as that user.
+func (b *LDAPBackend) Authenticate(ctx context.Context, login, password string) (*Identity, error) {
+	// An empty password would be an "unauthenticated bind", which many servers accept. Never allow it.
+	if password == "" {
+		return nil, errInvalidCredentials
+	}
+
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ldap connect: %w", err)
+	}
+	defer conn.Close()
+
+	if b.cfg.BindDN != "" {
+		if err := conn.Bind(b.cfg.BindDN, b.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	search := ldap.NewSearchRequest(
+		b.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, // we only need to know whether there is exactly one match
+		int(b.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(b.cfg.UserFilter, ldap.EscapeFilter(login)),
+		[]string{"dn", b.cfg.UsernameAttribute, b.cfg.EmailAttribute},
+		nil,
+	)
+	result, err := conn.Search(search)
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, errInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, errInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	username := entry.GetAttributeValue(b.cfg.UsernameAttribute)
+	if username == "" {
+		return nil, errors.New("ldap entry has no username attribute " + b.cfg.UsernameAttribute)
+	}
+	return &Identity{
+		Username: username,
+		Email:    strings.ToLower(entry.GetAttributeValue(b.cfg.EmailAttribute)),
+	}, nil
+}
+
+// dial opens a connection honoring the configured timeout and optional StartTLS upgrade.
+func (b *LDAPBackend) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: b.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	conn, err := ldap.DialURL(b.cfg.URL, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(b.cfg.Timeout)
+
+	if b.cfg.StartTLS && strings.HasPrefix(b.cfg.URL, "ldap://") {
+		parsed, err := url.Parse(b.cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: parsed.Hostname(), MinVersion: tls.VersionTLS12}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -8,46 +8,31 @@ package auth
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	// `strings` for string manipulation (e.g., splitting the Authorization header).
 	"strings"
 
-	// `jwt` library for JWT parsing and validation.
-	"github.com/golang-jwt/jwt/v5"
 	// Internal packages for application errors and configuration.
 	"github.com/user/lensisku-go/apperror"
 	"github.com/user/lensisku-go/config"
 )
 
-// ContextKey is a type used for context keys to avoid collisions.
-// Using a custom string type for context keys is a Go idiom to prevent key collisions
-// between different packages.
-type ContextKey string
-
-const (
-	// UserIDKey is the key used to store the userID in the request context.
-	// This constant defines the key under which the authenticated user's ID will be stored.
-	UserIDKey ContextKey = "userID"
-)
-
-// Claims represents the JWT claims.
-// This struct defines the expected structure of the JWT payload (claims).
-// It embeds `jwt.RegisteredClaims` for standard claims (like `exp`, `iat`) and adds custom claims.
-type Claims struct {
-	UserID int `json:"user_id"`
-	jwt.RegisteredClaims
-}
-
 // JWTMiddleware creates a new JWT authentication middleware.
-// It verifies the token from the Authorization header and adds userID to the context.
+// It verifies the access token from the Authorization header, or from the access cookie of a
+// cookie session, and stores its claims in the context.
 // This function is a higher-order function: it takes configuration and returns the actual middleware function.
 // The returned middleware conforms to the standard Go `func(next http.Handler) http.Handler` pattern.
 // This is analogous to a Nest.js Guard that implements `CanActivate`.
+//
+// Token parsing is shared with `AuthService` via `parseToken`, so the middleware and the
+// refresh flow agree on signing method, expiry, and token type (refresh tokens are rejected here).
 func JWTMiddleware(cfg *config.AuthConfig) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
+			if token := cookieToken(cfg, r, AccessCookieName); authHeader == "" && token != "" {
+				authHeader = "Bearer " + token
+			}
 			if authHeader == "" {
 				WriteError(w, r, apperror.NewUnauthorizedError("Authorization header is missing", nil))
 				return
@@ -60,55 +45,121 @@ func JWTMiddleware(cfg *config.AuthConfig) func(next http.Handler) http.Handler
 				return
 			}
 
-			// Extract the token string.
-			tokenString := parts[1]
-			claims := &Claims{}
-
-			// Parse and validate the token.
-			// The key function provides the secret key used for verifying the token's signature.
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return []byte(cfg.JWTSecret), nil
-			})
-
+			// Parse and validate the token as an access token.
+			claims, err := parseToken(cfg.JWTSecret, parts[1], tokenTypeAccess)
 			if err != nil {
-				// Handle specific JWT parsing errors.
-				if err == jwt.ErrSignatureInvalid {
-					WriteError(w, r, apperror.NewUnauthorizedError("Invalid token signature", nil))
-					return
-				}
-				WriteError(w, r, apperror.NewUnauthorizedError(fmt.Sprintf("Invalid token: %v", err), err))
-				return
-			}
-
-			// Check if the token itself is valid (e.g., not expired, signature correct).
-			if !token.Valid {
-				WriteError(w, r, apperror.NewUnauthorizedError("Invalid token", nil))
+				WriteError(w, r, apperror.NewUnauthorizedError("Invalid token: "+err.Error(), err).WithCode(apperror.CodeInvalidToken))
 				return
 			}
 
 			// Validate custom claims, e.g., ensure UserID is present.
-			if claims.UserID == 0 { // Or any other validation for UserID
-				WriteError(w, r, apperror.NewUnauthorizedError("Invalid token: user_id claim is missing or invalid", nil))
+			if claims.UserID == 0 {
+				WriteError(w, r, apperror.NewUnauthorizedError("Invalid token: user_id claim is missing or invalid", nil).WithCode(apperror.CodeInvalidToken))
 				return
 			}
 
-			// If the token is valid, add the UserID to the request's context.
-			// This makes the UserID available to subsequent handlers in the chain.
-			// Add userID to context
-			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			// If the token is valid, add the claims to the request's context.
+			// This makes the authenticated user available to subsequent handlers in the chain.
+			ctx := NewContextWithClaims(r.Context(), claims)
+			// Errors reported further down, panics included, name the user.
+			apperror.SetReportUser(ctx, claims.UserID)
 			// Call the next handler in the chain with the modified context.
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// GetUserIDFromContext retrieves the userID from the request context.
-// This is a helper function for handlers to easily access the UserID set by the middleware.
-// Returns 0 and false if userID is not found or not an int.
+// WebSocketProtocol is the subprotocol spoken on the app's WebSocket endpoints. Browsers can't
+// set headers on a WebSocket handshake, so they pass the access token as a second subprotocol:
+// `new WebSocket(url, ["lensisku", "bearer." + token])`. Unlike a query parameter, this keeps
+// the token out of request logs.
+const WebSocketProtocol = "lensisku"
+
+// WebSocketJWTMiddleware is JWTMiddleware for WebSocket handshakes: without an Authorization
+// header, it takes the token from a `bearer.{token}` subprotocol. The access cookie is not
+// accepted: browsers send it with handshakes from any site, and WebSockets aren't subject to
+// CORS, so a cookie alone would let another site open a socket as the user. The token is
+// checked once, at upgrade time; the connection outlives its expiry.
+func WebSocketJWTMiddleware(cfg *config.AuthConfig) func(next http.Handler) http.Handler {
+	jwt := JWTMiddleware(cfg)
+	return func(next http.Handler) http.Handler {
+		authenticated := jwt(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				for _, protocol := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+					if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), "bearer."); ok {
+						r = r.Clone(r.Context())
+						r.Header.Set("Authorization", "Bearer "+token)
+						break
+					}
+				}
+			}
+			if r.Header.Get("Authorization") == "" {
+				WriteError(w, r, apperror.NewUnauthorizedError("WebSocket handshakes must carry the token in the Authorization header or a bearer.{token} subprotocol", nil))
+				return
+			}
+			authenticated.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OptionalJWTMiddleware authenticates the request if it carries a valid access token and
+// otherwise lets it through anonymously. Public endpoints use it to tailor responses to
+// logged-in viewers (e.g. fields visible to "logged-in users only").
+// A malformed or expired token is treated like no token rather than rejected, so a stale
+// client token never breaks a public page.
+func OptionalJWTMiddleware(cfg *config.AuthConfig) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if token := cookieToken(cfg, r, AccessCookieName); authHeader == "" && token != "" {
+				authHeader = "Bearer " + token
+			}
+			parts := strings.Split(authHeader, " ")
+			if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+				if claims, err := parseToken(cfg.JWTSecret, parts[1], tokenTypeAccess); err == nil && claims.UserID != 0 {
+					r = r.WithContext(NewContextWithClaims(r.Context(), claims))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetUserIDFromContext retrieves the authenticated user's ID from the request context.
+// This is the single accessor every module should use; it reads the claims stored by `JWTMiddleware`.
+// Returns 0 and false if no authenticated user is present.
 func GetUserIDFromContext(ctx context.Context) (int, bool) {
-	userID, ok := ctx.Value(UserIDKey).(int)
-	return userID, ok
-}
\ No newline at end of file
+	claims, ok := ClaimsFromContext(ctx)
+	if !ok || claims.UserID == 0 {
+		return 0, false
+	}
+	return claims.UserID, true
+}
+
+// RequireRole only lets through users holding one of `roles`. It must run after `JWTMiddleware`.
+// The role is read from the database on every request rather than from the token, so revoking
+// someone's admin role takes effect immediately instead of when their token expires.
+func RequireRole(s *AuthService, roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserIDFromContext(r.Context())
+			if !ok {
+				WriteError(w, r, apperror.NewAuthError("authentication required", nil))
+				return
+			}
+			role, err := s.getUserRole(r.Context(), userID)
+			if err != nil {
+				WriteError(w, r, err)
+				return
+			}
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			WriteError(w, r, apperror.NewUnauthorizedError("insufficient permissions", nil))
+		})
+	}
+}
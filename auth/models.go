@@ -3,20 +3,35 @@
 // within the authentication domain. In this case, it defines the `User` struct.
 package auth
 
-import "time"
+import (
+	"time"
+
+	"github.com/user/lensisku-go/userrepo"
+)
 
 // User represents a user in the system.
 // This struct is analogous to an "Entity" in ORM terms (like TypeORM in Nest.js)
-// or a "Model" in MVC patterns. It defines the structure of user data as stored in the database
-// and as used within the application's business logic.
-type User struct {
-	// `json:"id"` are struct tags. They provide metadata for encoding/decoding,
-	// in this case, for JSON marshalling/unmarshalling. The `json:"-"` tag for HashedPassword
-	// means this field will be ignored by the `encoding/json` package, preventing it from being exposed in API responses.
-	ID             int       `json:"id"`
-	Username       string    `json:"username"`
-	Email          string    `json:"email"`
-	HashedPassword string    `json:"-"` // Do not expose hashed password
-	CreatedAt      time.Time `json:"created_at"`
-	// `time.Time` is Go's standard type for representing time.
+// or a "Model" in MVC patterns. It is defined next to the column mapping in the `userrepo`
+// package and aliased here, so `auth.User` and `userrepo.User` are the same type.
+type User = userrepo.User
+
+// Roles a user account can hold. They are stored in the `users.role` column.
+// Only admins and trusted users may generate invite codes.
+const (
+	RoleUser    = "user"
+	RoleTrusted = "trusted"
+	RoleAdmin   = "admin"
+)
+
+// InviteCode represents a limited-use code that allows registration when invite-only mode is on.
+// `Uses` counts accepted invites; once it reaches `MaxUses` the code can no longer be redeemed.
+type InviteCode struct {
+	ID        int        `json:"id"`
+	Code      string     `json:"code"`
+	CreatedBy int        `json:"created_by"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	Note      *string    `json:"note,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil means the code never expires
+	CreatedAt time.Time  `json:"created_at"`
 }
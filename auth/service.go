@@ -9,7 +9,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -21,6 +21,10 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	// OpenTelemetry API, for the spans of logins and registrations.
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
 	// Library for password hashing using bcrypt.
 	"golang.org/x/crypto/bcrypt"
 
@@ -29,6 +33,12 @@ import (
 	"github.com/user/lensisku-go/apperror"
 	// `config` provides access to application configuration values.
 	"github.com/user/lensisku-go/config"
+	// `logging` names this module's log records.
+	"github.com/user/lensisku-go/logging"
+	// `tracing` ends this module's spans.
+	"github.com/user/lensisku-go/tracing"
+	// `userrepo` owns the mapping between the `users` table and the `User` model.
+	"github.com/user/lensisku-go/userrepo"
 )
 
 // Constants defining token types and a PostgreSQL error code.
@@ -37,6 +47,12 @@ const (
 	tokenTypeAccess = "access"
 	// tokenTypeRefresh is a string constant for refresh tokens.
 	tokenTypeRefresh = "refresh"
+	// tokenTypeSudo is a string constant for short-lived step-up tokens (see sudo.go).
+	tokenTypeSudo = "sudo"
+	// SessionTypeShort marks tokens from a login without "remember me".
+	SessionTypeShort = "session"
+	// SessionTypeRemembered marks tokens from a "remember me" login, which use the long refresh lifetime.
+	SessionTypeRemembered = "remembered"
 	// pgUniqueViolation is the PostgreSQL error code for unique constraint violations.
 	pgUniqueViolation = "23505" // PostgreSQL unique violation error code
 )
@@ -45,6 +61,13 @@ const (
 type AuthService struct {
 	dbPool     *pgxpool.Pool
 	authConfig config.AuthConfig
+	// users reads and writes accounts with the canonical column mapping.
+	users *userrepo.Repository
+	// backends are tried in order at login; see backend.go.
+	backends []Backend
+	logger   *slog.Logger
+	// tracer times password checks and backends, the slow part of logging in.
+	tracer trace.Tracer
 	// In Go, dependencies are typically injected explicitly, often via constructor arguments.
 	// This is analogous to constructor injection in Nest.js services.
 	// `dbPool` provides database access, and `authConfig` provides authentication-specific settings.
@@ -55,25 +78,49 @@ type AuthService struct {
 // It takes its dependencies (`dbPool` and `authConfig`) as arguments.
 // This manual dependency injection is a key difference from Nest.js's decorator-based DI system.
 func NewAuthService(dbPool *pgxpool.Pool, authConfig config.AuthConfig) *AuthService {
-	return &AuthService{
+	s := &AuthService{
 		dbPool:     dbPool,
 		authConfig: authConfig,
+		users:      userrepo.New(dbPool),
+		logger:     logging.For("auth"),
+		tracer:     otel.Tracer("github.com/user/lensisku-go/auth"),
 	}
+	s.backends = newBackends(s, authConfig)
+	return s
 }
 
 // CustomClaims embeds jwt.RegisteredClaims and adds custom fields.
-// This struct defines the payload of our JWTs.
+// This struct defines the payload of our JWTs and is the only claims type in the application:
+// tokens are issued with it, parsed into it, and stored in the request context as `*CustomClaims`.
 // Embedding `jwt.RegisteredClaims` includes standard claims like `iss` (issuer), `exp` (expiration time), etc.
 type CustomClaims struct {
 	UserID    int    `json:"user_id"`
 	TokenType string `json:"token_type"` // "access" or "refresh"
+	// SessionType records how the session was established ("session" or "remembered"),
+	// so security policies such as forced re-authentication can treat them differently.
+	SessionType string `json:"session_type,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // Register creates a new user.
 // `ctx context.Context` is a standard Go pattern for passing request-scoped data, cancellation signals, and deadlines.
 // `req RegisterRequest` is a Data Transfer Object (DTO) carrying the registration data.
-func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*User, error) {
+func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (created *User, err error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.Register")
+	defer func() { tracing.End(span, err) }()
+	// Names recently given up by another account stay reserved for a while (see username_history),
+	// so old profile links can't be taken over by a newcomer.
+	var reserved bool
+	err = s.dbPool.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM username_history WHERE LOWER(old_username) = LOWER($1) AND reserved_until > NOW())`,
+		req.Username).Scan(&reserved)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to check username availability", err)
+	}
+	if reserved {
+		return nil, apperror.NewConflictError("username was recently used by another account and is not available yet", nil).WithCode(apperror.CodeUsernameOnHold)
+	}
+
 	// Hash the user's password using bcrypt. bcrypt is a strong, adaptive hashing algorithm.
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -89,17 +136,31 @@ func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*User,
 		HashedPassword: string(hashedPassword),
 	}
 
-	// Call a private method to perform the database insertion.
-	createdUser, err := s.createUser(ctx, user)
+	// In invite-only mode the user row and the invite redemption must be written atomically,
+	// otherwise a code could be over-redeemed by concurrent registrations.
+	var createdUser *User
+	if s.authConfig.InviteOnly {
+		if strings.TrimSpace(req.InviteCode) == "" {
+			return nil, apperror.NewUnauthorizedError("an invite code is required to register", nil).WithCode(apperror.CodeInviteRequired)
+		}
+		createdUser, err = s.createUserWithInvite(ctx, user, strings.TrimSpace(req.InviteCode))
+	} else {
+		// Call a private method to perform the database insertion.
+		createdUser, err = s.createUser(ctx, user)
+	}
 	if err != nil {
+		// Invite validation failures are already AppErrors and can be returned as they are.
+		if _, ok := apperror.FromError(err); ok {
+			return nil, err
+		}
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
 			if strings.Contains(pgErr.ConstraintName, "username") {
-				return nil, apperror.NewConflictError("username already exists", nil)
+				return nil, apperror.NewConflictError("username already exists", nil).WithCode(apperror.CodeUsernameExists)
 				// Returning a specific `apperror` type allows the handler to set the correct HTTP status code (e.g., 409 Conflict).
 			}
 			if strings.Contains(pgErr.ConstraintName, "email") {
-				return nil, apperror.NewConflictError("email already exists", nil)
+				return nil, apperror.NewConflictError("email already exists", nil).WithCode(apperror.CodeEmailExists)
 			}
 		}
 		// For other database errors, return a generic database error.
@@ -109,28 +170,21 @@ func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*User,
 }
 
 // Login authenticates a user and returns tokens.
-func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*TokenResponse, error) {
-	// Retrieve the user by their login identifier (username or email).
-	user, err := s.getUserByLogin(ctx, req.Login)
+func (s *AuthService) Login(ctx context.Context, req LoginRequest) (resp *TokenResponse, err error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.Login")
+	defer func() { tracing.End(span, err) }()
+	// The configured backends (local passwords, LDAP, ...) decide whether the credentials are valid.
+	// Whichever backend accepts them, the user ends up with a local account and local JWTs.
+	userID, err := s.authenticate(ctx, req.Login, req.Password)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			// If user not found, return an "invalid credentials" error. Avoid revealing whether the username or password was wrong.
-			return nil, apperror.NewUnauthorizedError("invalid credentials", nil)
-		}
-		// Log the original database error for debugging purposes
-		log.Printf("Database error in Login when trying to getUserByLogin: %v", err)
-		return nil, apperror.NewDatabaseError("failed to get user", err)
+		return nil, err
 	}
 
-	// Compare the provided password with the stored hashed password.
-	// `bcrypt.CompareHashAndPassword` handles the comparison securely.
-	err = bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(req.Password))
-	// If passwords don't match, `err` will be `bcrypt.ErrMismatchedHashAndPassword`.
-	if err != nil {
-		return nil, apperror.NewUnauthorizedError("invalid credentials", nil)
+	sessionType := SessionTypeShort
+	if req.RememberMe {
+		sessionType = SessionTypeRemembered
 	}
-
-	return s.generateTokens(user.ID)
+	return s.generateTokens(userID, sessionType)
 }
 
 // RefreshToken generates new tokens based on a refresh token.
@@ -138,13 +192,27 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshTokenString strin
 	// Validate the incoming refresh token.
 	claims, err := s.validateToken(refreshTokenString, tokenTypeRefresh)
 	if err != nil {
-		return nil, apperror.NewUnauthorizedError(fmt.Sprintf("invalid refresh token: %s", err.Error()), err)
+		return nil, apperror.NewUnauthorizedError(fmt.Sprintf("invalid refresh token: %s", err.Error()), err).WithCode(apperror.CodeInvalidToken)
 	}
 
-	// Optionally: Check if refresh token is revoked (if implementing revocation list)
+	// A refresh token outlives the account it was issued for: deleted accounts get no new tokens.
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && user.AuthSource == userrepo.AuthSourceDeleted {
+		return nil, apperror.NewUnauthorizedError("invalid refresh token: the account no longer exists", nil).WithCode(apperror.CodeInvalidToken)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load the account of the refresh token", err)
+	}
+
+	// The session type is carried over from the refresh token so a short session never
+	// turns into a remembered one. Tokens issued before session types existed were long-lived.
+	sessionType := claims.SessionType
+	if sessionType == "" {
+		sessionType = SessionTypeRemembered
+	}
 
 	// Generate a new access token.
-	newAccessToken, newAccessExpiresAt, err := s.generateSpecificToken(claims.UserID, tokenTypeAccess, s.authConfig.AccessTokenDuration)
+	newAccessToken, newAccessExpiresAt, err := s.generateSpecificToken(claims.UserID, tokenTypeAccess, sessionType, s.authConfig.AccessTokenDuration)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate new access token: %w", err)
 	}
@@ -161,19 +229,26 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshTokenString strin
 		RefreshToken: refreshTokenString, // Or generate a new one
 		TokenType:    "Bearer",
 		ExpiresIn:    newAccessExpiresAt.Unix(),
+		SessionType:  sessionType,
 	}, nil
 }
 
 // generateTokens is a helper function to create both access and refresh tokens for a user.
-func (s *AuthService) generateTokens(userID int) (*TokenResponse, error) {
+// The refresh token lifetime depends on `sessionType`: remembered sessions get the long duration.
+func (s *AuthService) generateTokens(userID int, sessionType string) (*TokenResponse, error) {
 	// Generate the access token.
-	accessToken, accessExpiresAt, err := s.generateSpecificToken(userID, tokenTypeAccess, s.authConfig.AccessTokenDuration)
+	accessToken, accessExpiresAt, err := s.generateSpecificToken(userID, tokenTypeAccess, sessionType, s.authConfig.AccessTokenDuration)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
+	refreshDuration := s.authConfig.SessionRefreshTokenDuration
+	if sessionType == SessionTypeRemembered {
+		refreshDuration = s.authConfig.RefreshTokenDuration
+	}
+
 	// Generate the refresh token.
-	refreshToken, _, err := s.generateSpecificToken(userID, tokenTypeRefresh, s.authConfig.RefreshTokenDuration)
+	refreshToken, _, err := s.generateSpecificToken(userID, tokenTypeRefresh, sessionType, refreshDuration)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -183,17 +258,19 @@ func (s *AuthService) generateTokens(userID int) (*TokenResponse, error) {
 		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
 		// `ExpiresIn` typically refers to the access token's expiration.
-		ExpiresIn: accessExpiresAt.Unix(),
+		ExpiresIn:   accessExpiresAt.Unix(),
+		SessionType: sessionType,
 	}, nil
 }
 
 // generateSpecificToken creates a JWT with specified claims, type, and duration.
-func (s *AuthService) generateSpecificToken(userID int, tokenType string, duration time.Duration) (string, time.Time, error) {
+func (s *AuthService) generateSpecificToken(userID int, tokenType string, sessionType string, duration time.Duration) (string, time.Time, error) {
 	expirationTime := time.Now().Add(duration)
 	// Define the custom claims for the token.
 	claims := &CustomClaims{
-		UserID:    userID,
-		TokenType: tokenType,
+		UserID:      userID,
+		TokenType:   tokenType,
+		SessionType: sessionType,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -214,9 +291,15 @@ func (s *AuthService) generateSpecificToken(userID int, tokenType string, durati
 	return tokenString, expirationTime, nil
 }
 
-// validateToken parses and validates a JWT string.
+// validateToken parses and validates a JWT string using the configured secret.
 // It checks the signature, expiration, and expected token type.
 func (s *AuthService) validateToken(tokenString string, expectedTokenType string) (*CustomClaims, error) {
+	return parseToken(s.authConfig.JWTSecret, tokenString, expectedTokenType)
+}
+
+// parseToken is the one place where JWTs are parsed. Both `AuthService` and `JWTMiddleware`
+// call it, so every entry point agrees on signing method, expiry, and token type.
+func parseToken(secret string, tokenString string, expectedTokenType string) (*CustomClaims, error) {
 	claims := &CustomClaims{}
 	// Parse the token string. The key function (`func(token *jwt.Token) (interface{}, error)`)
 	// is used to provide the secret key for verification.
@@ -225,7 +308,7 @@ func (s *AuthService) validateToken(tokenString string, expectedTokenType string
 			// Ensure the token's signing method is HMAC, as expected.
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(s.authConfig.JWTSecret), nil
+		return []byte(secret), nil
 	})
 
 	if err != nil {
@@ -242,8 +325,8 @@ func (s *AuthService) validateToken(tokenString string, expectedTokenType string
 		return nil, fmt.Errorf("invalid token type: expected %s, got %s", expectedTokenType, claims.TokenType)
 	}
 
-	// Check if token is expired (though jwt.ParseWithClaims should handle this based on 'exp' claim)
-	if time.Now().Unix() > claims.ExpiresAt.Unix() {
+	// Tokens without an expiry are never issued by us; treat them as invalid.
+	if claims.ExpiresAt == nil || time.Now().After(claims.ExpiresAt.Time) {
 		return nil, errors.New("token has expired")
 	}
 
@@ -256,78 +339,39 @@ func (s *AuthService) validateToken(tokenString string, expectedTokenType string
 // In a more complex application, these might reside in a separate "repository" or "data access" layer/package.
 
 func (s *AuthService) createUser(ctx context.Context, user *User) (*User, error) {
-	query := `INSERT INTO users (username, email, password) 
-              VALUES ($1, $2, $3) 
-              RETURNING id, created_at`
-	// `s.dbPool.QueryRow` executes the query and expects a single row in return.
-	err := s.dbPool.QueryRow(ctx, query, user.Username, user.Email, user.HashedPassword).Scan(&user.ID, &user.CreatedAt)
-	if err != nil {
+	if err := s.users.Create(ctx, user); err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
+// getUserByLogin allows login with either username or email; see `userrepo.Repository.GetByLogin`.
 func (s *AuthService) getUserByLogin(ctx context.Context, login string) (*User, error) {
-	// This function allows login with either username or email.
-	// Try finding by username first, then by email if it looks like an email
-	var user User
-	var query string
-	var arg interface{}
-
-	if strings.Contains(login, "@") { // Simple check for email format
-		query = `SELECT userid as id, username, email, password as hashed_password, created_at FROM users WHERE email = $1`
-		arg = strings.ToLower(login)
-	} else {
-		query = `SELECT userid as id, username, email, password as hashed_password, created_at FROM users WHERE username = $1`
-		arg = login
-	}
-
-	// Execute the query and scan the results into the `user` struct.
-	err := s.dbPool.QueryRow(ctx, query, arg).Scan(&user.ID, &user.Username, &user.Email, &user.HashedPassword, &user.CreatedAt)
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			// If not found by one method, try the other if applicable (e.g., if login was not an email, try it as email)
-			// For simplicity now, we just return the error. A more robust check could be added.
-			if !strings.Contains(login, "@") { // If it wasn't an email, try searching by email
-				query = `SELECT userid as id, username, email, password as hashed_password, created_at FROM users WHERE email = $1`
-				errEmail := s.dbPool.QueryRow(ctx, query, strings.ToLower(login)).Scan(&user.ID, &user.Username, &user.Email, &user.HashedPassword, &user.CreatedAt)
-				if errEmail != nil { // If still not found or another error occurred
-					return nil, errEmail // Return the error from the email search
-				}
-				return &user, nil
-			}
-		}
-		return nil, err
-	}
-	return &user, nil
+	return s.users.GetByLogin(ctx, login)
 }
 
 // GetUserByUsername retrieves a user by their username.
 func (s *AuthService) GetUserByUsername(ctx context.Context, username string) (*User, error) {
 	// This function is more specific, only searching by username.
-	var user User
-	query := `SELECT id, username, email, password as hashed_password, created_at FROM users WHERE username = $1`
-	err := s.dbPool.QueryRow(ctx, query, username).Scan(&user.ID, &user.Username, &user.Email, &user.HashedPassword, &user.CreatedAt)
+	user, err := s.users.GetByUsername(ctx, username)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, apperror.NewNotFoundError(fmt.Sprintf("user with username '%s' not found", username), nil)
 		}
 		return nil, apperror.NewDatabaseError("failed to get user by username", err)
 	}
-	return &user, nil
+	return user, nil
 }
 
 // GetUserByEmail retrieves a user by their email address.
 func (s *AuthService) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	// This function is specific to searching by email.
-	var user User
-	query := `SELECT id, username, email, password as hashed_password, created_at FROM users WHERE email = $1`
-	err := s.dbPool.QueryRow(ctx, query, strings.ToLower(email)).Scan(&user.ID, &user.Username, &user.Email, &user.HashedPassword, &user.CreatedAt)
+	user, err := s.users.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, apperror.NewNotFoundError(fmt.Sprintf("user with email '%s' not found", email), nil)
 		}
 		return nil, apperror.NewDatabaseError("failed to get user by email", err)
 	}
-	return &user, nil
+	return user, nil
 }
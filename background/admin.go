@@ -0,0 +1,251 @@
+// Package background, as part of the background services module.
+// This file, `admin.go`, lets administrators tune, pause and resume the embedding calculator while it runs.
+// Every change is audited.
+package background
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/jbovlaste"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// UpdateEmbeddingSettingsRequest changes the calculator's runtime settings. Omitted fields keep
+// their current value.
+// @Description Runtime settings to change; omitted fields are left as they are
+type UpdateEmbeddingSettingsRequest struct {
+	// example: 6
+	Workers *int `json:"workers,omitempty"`
+	// Go duration, at least 1s
+	// example: "5s"
+	TickInterval *string `json:"tick_interval,omitempty"`
+}
+
+// EmbeddingAdminHandlers exposes the embedding calculator's settings to administrators.
+type EmbeddingAdminHandlers struct {
+	calculator  *EmbeddingCalculator
+	broadcaster *jbovlaste.Broadcaster
+	audit       *audit.Log
+}
+
+// NewEmbeddingAdminHandlers creates the admin handlers for a running calculator. Re-embedding
+// campaigns report their progress through `broadcaster`.
+func NewEmbeddingAdminHandlers(calculator *EmbeddingCalculator, broadcaster *jbovlaste.Broadcaster) *EmbeddingAdminHandlers {
+	return &EmbeddingAdminHandlers{calculator: calculator, broadcaster: broadcaster}
+}
+
+// UseAudit records the changes made through the handlers in `log`.
+func (h *EmbeddingAdminHandlers) UseAudit(log *audit.Log) {
+	h.audit = log
+}
+
+// record audits a change to the calculator by the user of `r`.
+func (h *EmbeddingAdminHandlers) record(r *http.Request, action string, before, after any) {
+	userID, _ := auth.GetUserIDFromContext(r.Context())
+	h.audit.Record(r.Context(), audit.Entry{
+		ActorID:    userID,
+		Action:     action,
+		TargetType: audit.TargetEmbeddings,
+		TargetID:   h.calculator.embedder.Model(),
+		Before:     before,
+		After:      after,
+	})
+}
+
+// HandleGetEmbeddingSettings godoc
+// @Summary Get embedding calculator settings
+// @Description Returns the current worker count, tick interval and paused state of the embedding calculator. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} EmbeddingCalculatorSettings "Current settings"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Router /admin/embeddings/settings [get]
+func (h *EmbeddingAdminHandlers) HandleGetEmbeddingSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.Write(w, r, http.StatusOK, h.calculator.Settings())
+	}
+}
+
+// HandleUpdateEmbeddingSettings godoc
+// @Summary Update embedding calculator settings
+// @Description Changes the worker count and/or tick interval of the running embedding calculator. The change is not persisted; a restart goes back to EMBEDDING_WORKERS and EMBEDDING_TICK_INTERVAL. Admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Param settings body UpdateEmbeddingSettingsRequest true "Settings to change"
+// @Success 200 {object} EmbeddingCalculatorSettings "Settings after the change"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid body or out-of-range values"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin, or missing X-Sudo-Token"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Calculator is shutting down"
+// @Router /admin/embeddings/settings [patch]
+func (h *EmbeddingAdminHandlers) HandleUpdateEmbeddingSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateEmbeddingSettingsRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		// Validate everything before applying anything, so a bad interval doesn't leave the
+		// worker count changed.
+		var interval time.Duration
+		if req.TickInterval != nil {
+			d, err := time.ParseDuration(*req.TickInterval)
+			if err != nil {
+				auth.WriteError(w, r, apperror.NewValidationError("tick_interval must be a duration such as \"15s\"", err))
+				return
+			}
+			if err := validateEmbeddingTickInterval(d); err != nil {
+				auth.WriteError(w, r, err)
+				return
+			}
+			interval = d
+		}
+		if req.Workers != nil {
+			if err := validateEmbeddingWorkers(*req.Workers); err != nil {
+				auth.WriteError(w, r, err)
+				return
+			}
+		}
+
+		before := h.calculator.Settings()
+		if req.TickInterval != nil {
+			if err := h.calculator.SetTickInterval(interval); err != nil {
+				auth.WriteError(w, r, err)
+				return
+			}
+		}
+		if req.Workers != nil {
+			if err := h.calculator.SetWorkers(*req.Workers); err != nil {
+				auth.WriteError(w, r, err)
+				return
+			}
+		}
+		after := h.calculator.Settings()
+		h.record(r, audit.ActionEmbeddingSettingsUpdate, before, after)
+
+		render.Write(w, r, http.StatusOK, after)
+	}
+}
+
+// HandlePauseEmbeddings godoc
+// @Summary Pause the embedding calculator
+// @Description Stops the embedding calculator from fetching new definitions and comments; work already fetched is finished. The pause lasts until resumed or until the app restarts. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} EmbeddingCalculatorSettings "Settings after pausing"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Router /admin/embeddings/pause [post]
+func (h *EmbeddingAdminHandlers) HandlePauseEmbeddings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		before := h.calculator.Settings()
+		h.calculator.Pause()
+		after := h.calculator.Settings()
+		h.record(r, audit.ActionEmbeddingPause, before, after)
+		render.Write(w, r, http.StatusOK, after)
+	}
+}
+
+// HandleResumeEmbeddings godoc
+// @Summary Resume the embedding calculator
+// @Description Lets a paused embedding calculator fetch new definitions and comments again from its next tick. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} EmbeddingCalculatorSettings "Settings after resuming"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Router /admin/embeddings/resume [post]
+func (h *EmbeddingAdminHandlers) HandleResumeEmbeddings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		before := h.calculator.Settings()
+		h.calculator.Resume()
+		after := h.calculator.Settings()
+		h.record(r, audit.ActionEmbeddingResume, before, after)
+		render.Write(w, r, http.StatusOK, after)
+	}
+}
+
+// HandleGetEmbeddingStatus godoc
+// @Summary Embedding coverage
+// @Description Counts definitions and comments by embedding state relative to the configured model: current, stale (queued for re-embedding), missing, failed and outdated. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} EmbeddingStatus "Embedding coverage"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/embeddings/status [get]
+func (h *EmbeddingAdminHandlers) HandleGetEmbeddingStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := h.calculator.Status(r.Context())
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		render.Write(w, r, http.StatusOK, status)
+	}
+}
+
+// HandleGetEmbeddingUsage godoc
+// @Summary Embedding provider spend
+// @Description Returns today's (UTC) requests, tokens and cost sent to the embedding provider by this instance, with the configured budget and rate limit. While the budget is exhausted, embedding work is deferred to the next day instead of failing. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} embedding.Usage "Today's spend"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Router /admin/embeddings/usage [get]
+func (h *EmbeddingAdminHandlers) HandleGetEmbeddingUsage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.Write(w, r, http.StatusOK, h.calculator.embedder.Budget().Usage())
+	}
+}
+
+// HandleStartReembedding godoc
+// @Summary Start a re-embedding campaign
+// @Description Marks definitions and comments embedded with a model other than the configured one (or all embedded rows with all=true) for re-embedding. The background calculator replaces them gradually; the old vectors stay in place until then. The campaign's progress is streamed at GET /admin/tasks/{task_id}/events. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Param all query bool false "Re-embed every definition and comment, not only those from other models"
+// @Success 202 {object} ReembedResponse "Campaign started"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid all parameter"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin, or missing X-Sudo-Token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/embeddings/reembed [post]
+func (h *EmbeddingAdminHandlers) HandleStartReembedding() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		all, err := parseAllFlag(r.URL.Query().Get("all"))
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		marked, err := h.calculator.StartReembedding(r.Context(), all)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		progress := h.broadcaster.StartTask("reembedding")
+		go h.calculator.TrackReembedding(progress, marked)
+		h.record(r, audit.ActionEmbeddingReembed, nil, map[string]any{"all": all, "marked": marked, "task_id": progress.ID()})
+
+		render.Write(w, r, http.StatusAccepted, ReembedResponse{Model: h.calculator.embedder.Model(), Marked: marked, TaskID: progress.ID()})
+	}
+}
@@ -0,0 +1,85 @@
+// Package background, as part of the background services module.
+// This file, `comment_partitions.go`, maintains the monthly partitions of comments and their
+// reactions (see migration 000036_comment_partitions and `db/partitions.go`). Partitions for
+// the coming months are created ahead of time, so new rows never land in the default
+// partition, and with a retention set, partitions older than it are detached.
+package background
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/leader"
+	"github.com/user/lensisku-go/logging"
+)
+
+// commentPartitionInterval is how often partitions are checked. Partitions are created
+// months ahead, so a daily check leaves plenty of room for failed runs.
+const commentPartitionInterval = 24 * time.Hour
+
+// commentTables are the tables partitioned by month.
+var commentTables = []db.MonthlyTable{
+	{Name: "comments", Epoch: true},
+	{Name: "comment_reactions"},
+}
+
+// StartCommentPartitionService starts a goroutine that maintains the partitions once at
+// startup and then every `commentPartitionInterval`, until `stopChan` is closed. Only the
+// leader instance (see `elector`) does the work.
+// ELI5: A filing clerk who labels next months' folders before they're needed and moves the
+// oldest folders to the archive room.
+func StartCommentPartitionService(dbPool *pgxpool.Pool, cfg *config.PartitionsConfig, elector *leader.Elector, stopChan <-chan struct{}) {
+	logger := logging.For("partitions")
+	go func() {
+		defer logger.Info("Comment partition service stopped")
+
+		ticker := time.NewTicker(commentPartitionInterval)
+		defer ticker.Stop()
+
+		for {
+			if elector.IsLeader() {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+				maintainCommentPartitions(ctx, logger, dbPool, cfg, time.Now())
+				cancel()
+			}
+
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// maintainCommentPartitions creates and detaches the partitions of each table. A failure is
+// logged and doesn't keep the other tables from being maintained.
+func maintainCommentPartitions(ctx context.Context, logger *slog.Logger, dbPool *pgxpool.Pool, cfg *config.PartitionsConfig, now time.Time) {
+	for _, table := range commentTables {
+		created, err := db.EnsurePartitions(ctx, dbPool, table, now, cfg.Ahead)
+		for _, name := range created {
+			logger.Info("Created partition", "table", table.Name, "partition", name)
+		}
+		if err != nil {
+			logger.Error("Failed to create partitions", "table", table.Name, "error", err)
+			continue
+		}
+
+		if cfg.Retention == 0 {
+			continue
+		}
+		cutoff := time.Date(now.UTC().Year(), now.UTC().Month()-time.Month(cfg.Retention), 1, 0, 0, 0, 0, time.UTC)
+		detached, err := db.DetachPartitions(ctx, dbPool, table, cutoff)
+		for _, name := range detached {
+			logger.Info("Detached partition", "table", table.Name, "partition", name)
+		}
+		if err != nil {
+			logger.Error("Failed to detach partitions", "table", table.Name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package background, as part of the background services module.
+// This file, `counter_reconciliation.go`, periodically recomputes cached counters from their
+// source tables and repairs any drift: `comment_counters` (reactions and replies per comment)
+// and `hashtags.usage_count`. The counters are maintained incrementally when comments and
+// reactions are written, so a failed statement, a manual fix in the database or a code path
+// that forgot to update them would otherwise leave them wrong forever.
+package background
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/leader"
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// counterReconcileInterval is how often counters are checked.
+	counterReconcileInterval = time.Hour
+
+	// counterReconcileLockID is the advisory lock that keeps several app instances from
+	// reconciling at the same time.
+	counterReconcileLockID = 724101
+)
+
+// counterDrift summarizes what one reconciliation run repaired.
+type counterDrift struct {
+	MissingCounterRows int64 // Comments that had no comment_counters row
+	ReactionRows       int64 // Rows whose total_reactions was wrong
+	ReactionDelta      int64 // Sum of |stored - actual| over those rows
+	ReplyRows          int64
+	ReplyDelta         int64
+	HashtagRows        int64
+	HashtagDelta       int64
+}
+
+func (d counterDrift) any() bool {
+	return d.MissingCounterRows+d.ReactionRows+d.ReplyRows+d.HashtagRows > 0
+}
+
+// StartCounterReconciliationService starts a goroutine that reconciles counters every
+// `counterReconcileInterval` until `stopChan` is closed. Unlike the reputation sync it doesn't
+// run at startup, since drift builds up slowly and the full scan isn't free. Only the leader
+// instance (see `elector`) reconciles; the advisory lock in `reconcileCounters` still guards
+// against two runs overlapping during a change of leader.
+// ELI5: An accountant who, every hour, recounts the coins in each jar and corrects the label
+// on the jar if someone wrote the wrong number on it.
+func StartCounterReconciliationService(dbPool *pgxpool.Pool, elector *leader.Elector, stopChan <-chan struct{}) {
+	logger := logging.For("counters")
+	go func() {
+		defer logger.Info("Counter reconciliation service stopped")
+
+		ticker := time.NewTicker(counterReconcileInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+			if !elector.IsLeader() {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), counterReconcileInterval/2)
+			drift, ran, err := reconcileCounters(ctx, dbPool)
+			cancel()
+			switch {
+			case err != nil:
+				logger.Error("Counter reconciliation failed", "error", err)
+			case !ran:
+				// Another instance holds the lock and is doing the work.
+			case drift.any():
+				// One record per counter, with a "metric" field so log-based metrics can pick them up.
+				logger.Warn("Counter drift repaired", "metric", "counter_drift", "counter", "comment_counters.row_missing", "rows", drift.MissingCounterRows)
+				logger.Warn("Counter drift repaired", "metric", "counter_drift", "counter", "comment_counters.total_reactions", "rows", drift.ReactionRows, "delta", drift.ReactionDelta)
+				logger.Warn("Counter drift repaired", "metric", "counter_drift", "counter", "comment_counters.total_replies", "rows", drift.ReplyRows, "delta", drift.ReplyDelta)
+				logger.Warn("Counter drift repaired", "metric", "counter_drift", "counter", "hashtags.usage_count", "rows", drift.HashtagRows, "delta", drift.HashtagDelta)
+			default:
+				logger.Debug("Counter reconciliation found no drift")
+			}
+		}
+	}()
+}
+
+// reconcileCounters repairs all counters in one transaction and reports what it changed.
+// `ran` is false when another instance is already reconciling. A reaction or reply written
+// while the run is in progress can be overwritten with the count from before it; the next
+// run corrects that. Counters of comments in a detached partition (see `comment_partitions.go`)
+// are left as they were: their replies and reactions may be detached too, or only some of them.
+func reconcileCounters(ctx context.Context, dbPool *pgxpool.Pool) (drift counterDrift, ran bool, err error) {
+	err = db.WithTx(ctx, dbPool, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, counterReconcileLockID).Scan(&ran); err != nil || !ran {
+			return err
+		}
+
+		missing, err := tx.Exec(ctx, `
+			INSERT INTO comment_counters (comment_id, total_reactions, total_replies)
+			SELECT c.commentid, 0, 0
+			FROM comments c
+			WHERE NOT EXISTS (SELECT 1 FROM comment_counters cc WHERE cc.comment_id = c.commentid)
+			ON CONFLICT (comment_id) DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		drift.MissingCounterRows = missing.RowsAffected()
+
+		rows, err := tx.Query(ctx, `
+			UPDATE comment_counters cc
+			SET total_reactions = a.reactions, total_replies = a.replies
+			FROM (
+				SELECT cc2.comment_id,
+				       cc2.total_reactions AS stored_reactions,
+				       cc2.total_replies AS stored_replies,
+				       COALESCE(r.n, 0) AS reactions,
+				       COALESCE(p.n, 0) AS replies
+				FROM comment_counters cc2
+				LEFT JOIN (SELECT comment_id, COUNT(*) AS n FROM comment_reactions GROUP BY comment_id) r
+				  ON r.comment_id = cc2.comment_id
+				LEFT JOIN (SELECT parentid, COUNT(*) AS n FROM comments WHERE parentid IS NOT NULL GROUP BY parentid) p
+				  ON p.parentid = cc2.comment_id
+			) a
+			WHERE a.comment_id = cc.comment_id
+			  AND EXISTS (SELECT 1 FROM comments c WHERE c.commentid = cc.comment_id)
+			  AND (a.stored_reactions <> a.reactions OR a.stored_replies <> a.replies)
+			RETURNING a.stored_reactions, a.reactions, a.stored_replies, a.replies`)
+		if err != nil {
+			return err
+		}
+		var storedReactions, reactions, storedReplies, replies int64
+		_, err = pgx.ForEachRow(rows, []any{&storedReactions, &reactions, &storedReplies, &replies}, func() error {
+			if storedReactions != reactions {
+				drift.ReactionRows++
+				drift.ReactionDelta += abs64(storedReactions - reactions)
+			}
+			if storedReplies != replies {
+				drift.ReplyRows++
+				drift.ReplyDelta += abs64(storedReplies - replies)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(ctx, `
+			UPDATE hashtags h
+			SET usage_count = a.actual
+			FROM (
+				SELECT h2.id, h2.usage_count AS stored, COUNT(ph.post_id) AS actual
+				FROM hashtags h2
+				LEFT JOIN post_hashtags ph ON ph.hashtag_id = h2.id
+				GROUP BY h2.id, h2.usage_count
+			) a
+			WHERE a.id = h.id AND a.stored <> a.actual
+			RETURNING a.stored, a.actual`)
+		if err != nil {
+			return err
+		}
+		var stored, actual int64
+		_, err = pgx.ForEachRow(rows, []any{&stored, &actual}, func() error {
+			drift.HashtagRows++
+			drift.HashtagDelta += abs64(stored - actual)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	return drift, ran, err
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,175 @@
+// Package background, as part of the background services module.
+// This file, `embedding_index.go`, builds the nearest-neighbour indexes of the embeddings. The
+// `embedding` columns have no fixed dimension, since the model can change (see `reembed.go`),
+// and pgvector can only index vectors of one dimension. So each model gets partial HNSW indexes
+// on `embedding::vector(<its dimension>)`, over the rows it embedded. The dimension is read
+// from the first stored vector; until one exists, there is nothing to index. Queries must
+// filter on `embedding_model` and cast both sides the same way to use them (see
+// valsi/similar.go and comments/related.go).
+//
+// Indexes are built concurrently, so writes go on meanwhile. `comments` is partitioned, and a
+// partitioned table can't be indexed concurrently: its index is created on the parent alone,
+// then built on each partition and attached. Partitions created later get it automatically.
+package background
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxIndexedDimensions is the largest vector HNSW indexes. Vectors of larger models are
+// compared by scanning.
+const maxIndexedDimensions = 2000
+
+// embeddingIndexTimeout bounds building the indexes for one model; building them on a large
+// table takes minutes.
+const embeddingIndexTimeout = 2 * time.Hour
+
+// embeddingIndexName returns the name of the index of `table`'s vectors of `model`.
+func embeddingIndexName(table, model string) string {
+	sum := sha256.Sum256([]byte(model))
+	return fmt.Sprintf("idx_%s_embedding_%s", table, hex.EncodeToString(sum[:6]))
+}
+
+// quoteLiteral quotes `s` as an SQL string literal. DDL takes no parameters.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// maybeIndexEmbeddings starts building the indexes for the configured model in the background,
+// unless they're built or being built. It runs on the orchestrator goroutine of the leader.
+func (c *EmbeddingCalculator) maybeIndexEmbeddings() {
+	model := c.embedder.Model()
+	c.mu.Lock()
+	if c.indexing || c.indexedModel == model {
+		c.mu.Unlock()
+		return
+	}
+	c.indexing = true
+	c.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), embeddingIndexTimeout)
+		defer cancel()
+		done := true
+		for _, src := range embeddingSources {
+			built, err := ensureEmbeddingIndex(ctx, c.dbPool, src, model)
+			if err != nil {
+				c.logger.Error("Failed to build embedding index", "source", src.name, "model", model, "error", err)
+			}
+			done = done && built
+		}
+		c.mu.Lock()
+		c.indexing = false
+		if done {
+			c.indexedModel = model
+		}
+		c.mu.Unlock()
+	}()
+}
+
+// ensureEmbeddingIndex builds the index of `src`'s vectors of `model` if it's missing or
+// unfinished. It reports false when the index can't be built yet, because `model` hasn't
+// embedded any row.
+func ensureEmbeddingIndex(ctx context.Context, dbPool *pgxpool.Pool, src *embeddingSource, model string) (bool, error) {
+	var dims int
+	err := dbPool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT vector_dims(embedding) FROM %s
+		WHERE embedding_model = $1 AND embedding IS NOT NULL
+		LIMIT 1`, src.table), model).Scan(&dims)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if dims > maxIndexedDimensions {
+		return true, nil
+	}
+
+	// Index builds take longer than the pool's statement timeout allows, so they run on a
+	// connection of their own with the timeout lifted, and restored afterwards.
+	conn, err := dbPool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Release()
+	var timeout string
+	if err := conn.QueryRow(ctx, `SELECT current_setting('statement_timeout')`).Scan(&timeout); err != nil {
+		return false, err
+	}
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return false, err
+	}
+	defer conn.Exec(context.Background(), `SELECT set_config('statement_timeout', $1, false)`, timeout)
+
+	name := embeddingIndexName(src.table, model)
+	definition := fmt.Sprintf("USING hnsw ((embedding::vector(%d)) vector_cosine_ops) WHERE embedding_model = %s",
+		dims, quoteLiteral(model))
+
+	var partitioned bool
+	if err := conn.QueryRow(ctx, `SELECT relkind = 'p' FROM pg_class WHERE oid = $1::regclass`, src.table).Scan(&partitioned); err != nil {
+		return false, err
+	}
+	if !partitioned {
+		return true, buildIndex(ctx, conn.Conn(), name, src.table, definition)
+	}
+
+	if _, err := conn.Exec(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON ONLY %s %s`, name, src.table, definition)); err != nil {
+		return false, err
+	}
+	rows, err := conn.Query(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass
+		  AND NOT EXISTS (
+			SELECT 1 FROM pg_inherits ii
+			JOIN pg_index x ON x.indexrelid = ii.inhrelid
+			WHERE ii.inhparent = $2::regclass AND x.indrelid = c.oid)
+		ORDER BY c.relname`, src.table, name)
+	if err != nil {
+		return false, err
+	}
+	partitions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return false, err
+	}
+	for _, partition := range partitions {
+		child := name + "_" + strings.TrimPrefix(partition, src.table+"_")
+		if err := buildIndex(ctx, conn.Conn(), child, partition, definition); err != nil {
+			return false, err
+		}
+		if _, err := conn.Exec(ctx, fmt.Sprintf(`ALTER INDEX %s ATTACH PARTITION %s`, name, child)); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// buildIndex creates index `name` on `table` concurrently. An index left invalid by an
+// interrupted build is dropped and built again.
+func buildIndex(ctx context.Context, conn *pgx.Conn, name, table, definition string) error {
+	var valid bool
+	err := conn.QueryRow(ctx, `SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)`, name).Scan(&valid)
+	switch {
+	case err == nil && valid:
+		return nil
+	case err == nil:
+		if _, err := conn.Exec(ctx, fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS %s`, name)); err != nil {
+			return err
+		}
+	case !errors.Is(err, pgx.ErrNoRows):
+		return err
+	}
+	_, err = conn.Exec(ctx, fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s %s`, name, table, definition))
+	return err
+}
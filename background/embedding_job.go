@@ -0,0 +1,74 @@
+// Package background, as part of the background services module.
+// This file, `embedding_job.go`, embeds single definitions on request through the job queue.
+// The ticker-driven calculator in `embedding_service.go` backfills everything that is missing;
+// queued jobs cover definitions that should be embedded now rather than on a later tick, and
+// they survive restarts. Interactive requests are enqueued with `jobs.PriorityHigh`, so they
+// are claimed before any queued bulk work.
+package background
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/embedding"
+	"github.com/user/lensisku-go/jobs"
+)
+
+// EmbedDefinitionJobType is the job type for embedding one definition.
+const EmbedDefinitionJobType = "embedding.definition"
+
+// EmbedDefinitionPayload identifies the definition to embed.
+type EmbedDefinitionPayload struct {
+	DefinitionID int `json:"definition_id"`
+}
+
+// EnqueueEmbedding queues the definition for embedding. Use `jobs.PriorityHigh` when someone is
+// waiting for the result.
+func EnqueueEmbedding(ctx context.Context, queue *jobs.Queue, definitionID int, priority int) (int64, error) {
+	return queue.Enqueue(ctx, EmbedDefinitionJobType, EmbedDefinitionPayload{DefinitionID: definitionID}, &jobs.EnqueueOptions{Priority: priority})
+}
+
+// EmbedDefinitionJobHandler loads the definition text, embeds it with `embedder` and stores
+// the vector. Deleted definitions complete the job without doing anything. Loading the text
+// also claims the row, so the backfill calculator doesn't embed it at the same time.
+func EmbedDefinitionJobHandler(dbPool *pgxpool.Pool, embedder embedding.Embedder) jobs.HandlerFunc {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var payload EmbedDefinitionPayload
+		if err := job.Decode(&payload); err != nil {
+			return fmt.Errorf("invalid embedding job payload: %w", err)
+		}
+
+		var text string
+		err := dbPool.QueryRow(ctx, `
+			UPDATE definitions SET embedding_claimed_at = NOW(), embedding_claimed_by = $2
+			WHERE definitionid = $1
+			RETURNING definition`, payload.DefinitionID, claimOwner).Scan(&text)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("load definition %d: %w", payload.DefinitionID, err)
+		}
+
+		vectors, err := embedder.Embed(ctx, []string{text})
+		var exhausted *embedding.BudgetExhaustedError
+		if errors.As(err, &exhausted) {
+			// Not the job's fault: hand the row back and run again once the budget resets.
+			if releaseErr := releaseClaims(dbPool, definitionSource, []int{payload.DefinitionID}); releaseErr != nil {
+				return fmt.Errorf("release definition %d: %w", payload.DefinitionID, releaseErr)
+			}
+			return jobs.Defer(err, exhausted.ResetAt)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := storeEmbedding(dbPool, definitionSource, payload.DefinitionID, vectors[0], embedder.Model()); err != nil {
+			return fmt.Errorf("store embedding of definition %d: %w", payload.DefinitionID, err)
+		}
+		return nil
+	}
+}
@@ -6,279 +6,526 @@
 package background
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	// `sync` package provides synchronization primitives like `WaitGroup` and `Mutex`.
 	"sync"
 	"time"
 
 	// `pgxpool` for database interactions.
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	// `embedding` provides the `Embedder` that turns text into vectors.
+	"github.com/user/lensisku-go/embedding"
+	"github.com/user/lensisku-go/leader"
+	"github.com/user/lensisku-go/logging"
 )
 
-// DefinitionToEmbed represents a definition that needs its text embedding calculated.
-// ELI5: Think of this as a work order slip for a specific piece of text (a definition).
-// It says, "Here's the ID of the definition and the text itself. Please make an embedding for it!"
-type DefinitionToEmbed struct {
-	ID   int    // A unique number for this definition.
-	Text string // The actual words of the definition.
+// TextToEmbed represents a row (a definition or a comment) that needs its text embedding calculated.
+// ELI5: Think of this as a work order slip for a specific piece of text.
+// It says, "Here's where the text lives, its ID and the text itself. Please make an embedding for it!"
+type TextToEmbed struct {
+	Source *embeddingSource // Which table the row is in (see `embedding_store.go`).
+	ID     int              // A unique number for this row within its table.
+	Text   string           // The actual words to embed.
 }
 
-// EmbeddingResult holds the computed embedding for a definition, or an error if computation failed.
+// EmbeddingResult holds the computed embedding for a row, or an error if computation failed.
 // ELI5: This is the result slip you get back after the embedding work is done.
 // It either has the magical number-list (Embedding) or a note saying "Oops, something went wrong" (Error).
 type EmbeddingResult struct {
-	DefinitionID int       // Which definition was this result for?
-	Embedding    []float32 // The list of special numbers that represents the meaning of the text.
-	Error        error     // If anything went wrong, the error message is here.
+	Source    *embeddingSource // Which table was this result for?
+	ID        int              // Which row was this result for?
+	Embedding []float32        // The list of special numbers that represents the meaning of the text.
+	Error     error            // If anything went wrong, the error message is here.
 }
 
 // Constants for configuring the embedding service.
 const (
-	// embeddingTickerDuration is how often the service checks for new definitions to process.
-	// ELI5: Like setting an alarm clock that rings every 15 seconds, reminding us to look for new work orders.
-	embeddingTickerDuration = 15 * time.Second
-
-	// numProcessorWorkers is the number of concurrent workers processing definitions.
-	// ELI5: We're hiring 3 helpers (processor workers) who can all work on calculating embeddings at the same time.
-	// This helps get the work done faster, like having multiple cashiers at a store.
-	numProcessorWorkers = 3
+	// embeddingRequestTimeout bounds a single call to the embedding provider.
+	embeddingRequestTimeout = 2 * time.Minute
 )
 
-// StartEmbeddingCalculatorService initializes and starts the background service for calculating embeddings.
-// It orchestrates fetching definitions, processing them, and updating them in the database.
-// It can be gracefully shut down via the stopChan.
-// ELI5: This function is the main manager for our "Embedding Calculation Factory".
-// `dbPool` is the database connection pool.
-// `stopChan <-chan struct{}` is a read-only channel used to signal the service to stop.
-// This pattern allows for graceful shutdown of background goroutines.
-// It sets up all the machinery and workers, gets them started, and also knows how to tell everyone
-// to clean up and go home when the `stopChan` signal arrives.
-func StartEmbeddingCalculatorService(dbPool *pgxpool.Pool, stopChan <-chan struct{}) {
-	log.Println("Background embedding calculator service starting...")
+// EmbeddingCalculator is the handle of a running embedding calculator. The number of processor
+// workers and the tick interval start out from configuration (`EMBEDDING_WORKERS`,
+// `EMBEDDING_TICK_INTERVAL`) and can be changed while the service runs, e.g. from the admin API.
+// ELI5: This is the factory's control panel. The manager keeps running the factory, but an
+// operator can walk up to the panel and say "hire two more helpers" or "check for work more often".
+type EmbeddingCalculator struct {
+	dbPool    *pgxpool.Pool
+	embedder  embedding.Embedder
+	batchSize int
+	logger    *slog.Logger
 
-	// Channels are used for communication between goroutines.
 	// defsToProcessChan is a channel for sending definitions that need processing.
-	// ELI5: This is like a conveyor belt ('defsToProcessChan') where new work order slips (DefinitionToEmbed)
+	// ELI5: This is like a conveyor belt ('defsToProcessChan') where new work order slips (TextToEmbed)
 	// are placed. The processor workers pick up slips from this belt.
-	// `make(chan DefinitionToEmbed, 10)` creates a buffered channel with a capacity of 10.
 	// It's buffered, meaning it can hold up to 10 slips even if workers are busy.
-	defsToProcessChan := make(chan DefinitionToEmbed, 10)
-
+	defsToProcessChan chan TextToEmbed
 	// resultsChan is a channel for sending back the results of embedding calculations.
 	// ELI5: This is another conveyor belt ('resultsChan') where the finished result slips (EmbeddingResult)
 	// are placed by the processor workers. The updater worker picks up slips from this belt.
-	// Also a buffered channel.
-	resultsChan := make(chan EmbeddingResult, 10)
-
-	// `sync.WaitGroup` is used to wait for a collection of goroutines to finish.
-	// The main goroutine calls `Add` to set the number of goroutines to wait for,
-	// and each goroutine calls `Done` when it finishes. `Wait` blocks until all
-	// goroutines have called `Done`.
-	// mainWg is a WaitGroup for managing the lifecycle of goroutines that are direct children
-	// of the main orchestrator logic, like the updater.
-	// ELI5: `mainWg` is like a checklist for the factory manager. For every major department (like the 'updater')
-	// that needs to finish its work before the factory can fully close, we add an item to this list.
-	// When a department finishes, it checks itself off. The manager waits until all items are checked.
-	var mainWg sync.WaitGroup
-
-	// processorsWg is specifically for the worker goroutines that process definitions.
-	// This allows the orchestrator to know when all processing is done before closing `resultsChan`.
+	resultsChan chan EmbeddingResult
+
+	// `mu` guards the fields below, which the admin API changes at runtime.
+	mu sync.Mutex
+	// workerQuits holds one channel per running processor worker; closing it retires that worker.
+	workerQuits  []chan struct{}
+	nextWorkerID int
+	tickInterval time.Duration
+	stopped      bool
+	// paused makes the orchestrator skip its ticks; definitions already on the belt are still processed.
+	paused bool
+	// tickChanges tells the orchestrator to reset its ticker.
+	tickChanges chan time.Duration
+	// indexing is set while the nearest-neighbour indexes are being built, and indexedModel
+	// once they're built for that model (see `embedding_index.go`).
+	indexing     bool
+	indexedModel string
+
+	// stopRequested is closed by Stop; it has the same effect as closing the `stopChan` passed
+	// to StartEmbeddingCalculatorService.
+	stopRequested chan struct{}
+	stopOnce      sync.Once
+	// done is closed once the orchestrator has shut everything down.
+	done chan struct{}
+
 	// processorsWg is a WaitGroup specifically for the processor worker goroutines.
 	// This helps in knowing when all processors have finished their work, which is crucial
 	// for safely closing the resultsChan.
-	// ELI5: `processorsWg` is a special checklist just for our 3 calculation helpers.
+	// ELI5: `processorsWg` is a special checklist just for our calculation helpers.
 	// We need to know when ALL of them are done before we can turn off the 'resultsChan' conveyor belt.
-	var processorsWg sync.WaitGroup
+	processorsWg sync.WaitGroup
+	// updaterWg is a WaitGroup for the updater goroutine.
+	// ELI5: `updaterWg` is like a checklist for the factory manager. The 'updater' department
+	// needs to finish its work before the factory can fully close, so it has an item on this list.
+	// When it finishes, it checks itself off. The manager waits until the item is checked.
+	updaterWg sync.WaitGroup
+}
+
+// EmbeddingCalculatorSettings are the tunable settings of a running calculator.
+// @Description Runtime settings of the embedding calculator
+type EmbeddingCalculatorSettings struct {
+	// Number of concurrent processor workers
+	// example: 3
+	Workers int `json:"workers"`
+	// How often the calculator looks for definitions without embeddings (Go duration)
+	// example: "15s"
+	TickInterval string `json:"tick_interval"`
+	// Whether fetching new work is paused (see POST /admin/embeddings/pause)
+	// example: false
+	Paused bool `json:"paused"`
+}
+
+// StartEmbeddingCalculatorService initializes and starts the background service for calculating embeddings.
+// It orchestrates fetching definitions, processing them, and updating them in the database.
+// It can be gracefully shut down via the stopChan.
+// ELI5: This function is the main manager for our "Embedding Calculation Factory".
+// `dbPool` is the database connection pool.
+// `embedder` computes the vectors (see the `embedding` package for the available providers), and
+// `cfg` provides the batch size, the number of workers and the tick interval.
+// `stopChan <-chan struct{}` is a read-only channel used to signal the service to stop.
+// This pattern allows for graceful shutdown of background goroutines.
+// It sets up all the machinery and workers, gets them started, and also knows how to tell everyone
+// to clean up and go home when the `stopChan` signal arrives.
+func StartEmbeddingCalculatorService(dbPool *pgxpool.Pool, embedder embedding.Embedder, cfg *config.EmbeddingConfig, elector *leader.Elector, stopChan <-chan struct{}) *EmbeddingCalculator {
+	c := &EmbeddingCalculator{
+		dbPool:            dbPool,
+		embedder:          embedder,
+		batchSize:         cfg.BatchSize,
+		logger:            logging.For("embedding"),
+		defsToProcessChan: make(chan TextToEmbed, 10),
+		resultsChan:       make(chan EmbeddingResult, 10),
+		tickInterval:      cfg.TickInterval,
+		tickChanges:       make(chan time.Duration, 1),
+		stopRequested:     make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+
+	// --- Processor Goroutines (Worker Pool) ---
+	// ELI5: The manager hires the configured number of specialist helpers. More can be hired
+	// (or sent home) later through `SetWorkers`.
+	c.mu.Lock()
+	c.scaleWorkersLocked(cfg.Workers)
+	c.mu.Unlock()
+
+	// --- Updater Goroutine ---
+	// ELI5: The manager hires one more helper, the 'updater'. This helper's job is to take
+	// the finished result slips from the `resultsChan` belt and save them to the database.
+	c.updaterWg.Add(1) // Add the updater to the main factory checklist.
+	go func() {
+		defer c.updaterWg.Done() // When the updater finishes and exits, it checks itself off the main list.
+		c.runUpdater()
+	}()
 
 	// --- Main Orchestrator Goroutine ---
-	// This goroutine is the heart of the service. It manages the ticker,
-	// spawns workers, and handles the shutdown signal.
+	// This goroutine is the heart of the service. It manages the ticker and handles the shutdown signal.
 	// ELI5: We're starting the main factory manager (this goroutine). This manager doesn't do the
 	// calculations itself but makes sure everyone else does their job and coordinates the shutdown.
-	// `go func() { ... }()` starts a new goroutine. Goroutines are lightweight, concurrently executing functions.
 	go func() {
-		// This defer ensures that when this goroutine exits (e.g., on shutdown),
-		// it logs that it has stopped.
-		defer log.Println("Embedding calculator orchestrator goroutine stopped.")
+		defer c.logger.Info("Embedding calculator stopped")
+		// Closing `done` last tells anyone waiting in Stop that the factory is fully closed.
+		defer close(c.done)
 
-		// `time.NewTicker` creates a ticker that sends a value on its channel (`orchestratorTicker.C`)
-		// at regular intervals (`embeddingTickerDuration`).
 		// orchestratorTicker is like the factory's main clock.
-		// ELI5: This clock (`orchestratorTicker`) chimes every `embeddingTickerDuration` (15 seconds).
-		// Each chime tells the manager it's time to check for new work orders.
-		orchestratorTicker := time.NewTicker(embeddingTickerDuration)
-		// `defer orchestratorTicker.Stop()` ensures the ticker is stopped when the goroutine exits,
-		// freeing associated resources.
+		// ELI5: This clock chimes every tick interval. Each chime tells the manager it's time to check
+		// for new work orders. An operator can re-set the clock through `SetTickInterval`.
+		orchestratorTicker := time.NewTicker(cfg.TickInterval)
 		defer orchestratorTicker.Stop() // Important to stop the ticker when done to free resources.
 
-		// --- Processor Goroutines (Worker Pool) ---
-		// This loop starts multiple `processorWorker` goroutines to process definitions concurrently.
-		// This is a common pattern for creating a pool of workers.
-		// ELI5: The manager now hires `numProcessorWorkers` (3) specialist helpers.
-		// Each helper (processorWorker goroutine) will take work orders from the `defsToProcessChan` belt,
-		// do the (simulated) embedding calculation, and put the result on the `resultsChan` belt.
-		for i := 0; i < numProcessorWorkers; i++ {
-			// Increment the WaitGroup counter for each worker goroutine.
-			processorsWg.Add(1) // Add a task to the processors' checklist.
-			// Start the worker goroutine.
-			go func(workerID int) { // Each worker runs in its own goroutine.
-				defer processorsWg.Done() // When this worker finishes all its tasks and exits, it checks itself off the processors' list.
-				log.Printf("Processor Worker %d: Starting\n", workerID)
-				// This worker keeps taking definitions from the 'defsToProcessChan' conveyor belt
-				// as long as there are items and the belt hasn't been turned off (channel closed).
-				for def := range defsToProcessChan {
-					log.Printf("Processor Worker %d: Received definition ID: %d for processing.\n", workerID, def.ID)
-					// Simulate work with `time.Sleep`. In a real application, this would involve
-					// CPU-bound or I/O-bound operations (e.g., calling an ML model, database queries).
-					// Simulate preprocessing (e.g., cleaning text)
-					time.Sleep(500 * time.Millisecond) 
-					log.Printf("Processor Worker %d: Simulating embedding calculation for definition ID: %d\n", workerID, def.ID)
-					// Simulate the actual work of calculating an embedding (e.g., calling an AI model)
-					time.Sleep(1 * time.Second) 
-
-					// Create a dummy embedding result
-					embedding := make([]float32, 3) // A list of 3 numbers
-					for j := range embedding {
-						embedding[j] = float32(def.ID) + float32(j)*0.1 + float32(workerID)*0.01 // Just some fake numbers
-					}
-					result := EmbeddingResult{DefinitionID: def.ID, Embedding: embedding}
-					log.Printf("Processor Worker %d: Processed definition ID %d. Sending to resultsChan.\n", workerID, def.ID)
-					// ELI5: The worker places the finished result slip onto the `resultsChan` conveyor belt.
-					// Send the result to the `resultsChan`. This might block if `resultsChan` is full.
-					resultsChan <- result
-				}
-				// This log message appears when `defsToProcessChan` is closed and the loop finishes.
-				log.Printf("Processor Worker %d: defsToProcessChan closed. Exiting.\n", workerID)
-			}(i) // Pass `i` to give each worker a unique ID.
-		}
-
-		// --- Updater Goroutine ---
-		// ELI5: The manager hires one more helper, the 'updater'. This helper's job is to take
-		// the finished result slips from the `resultsChan` belt and (simulated) save them to the database.
-		// This goroutine consumes results from `resultsChan` and updates the database.
-		mainWg.Add(1) // Add the updater to the main factory checklist.
-		go func() {
-			// Decrement the WaitGroup counter when this goroutine finishes.
-			defer mainWg.Done() // When the updater finishes and exits, it checks itself off the main list.
-			log.Println("Updater: Starting")
-			// The updater keeps taking results from the `resultsChan` conveyor belt
-			// as long as there are items and the belt hasn't been turned off (channel closed).
-			for result := range resultsChan {
-				if result.Error != nil {
-					log.Printf("Updater: Error processing definition ID %d: %v\n", result.DefinitionID, result.Error)
-				} else {
-					log.Printf("Updater: Simulating update of embedding in DB for definition ID: %d with embedding: %v\n", result.DefinitionID, result.Embedding)
-					// In a real application, this is where you'd write `result.Embedding` to the database for `result.DefinitionID`.
-				}
-			}
-			// This log message appears when `resultsChan` is closed and the loop finishes.
-			log.Println("Updater: resultsChan closed. Exiting.")
-		}()
-
-		// --- Goroutine to manage closing resultsChan ---
-		// This goroutine waits for all processor workers to complete their tasks.
-		// Once all processors are done, it's safe to close `resultsChan`.
-		// This signals the updater that no more results will be coming.
-		// ELI5: The manager assigns a special supervisor whose only job is to watch the calculation helpers.
-		// When all calculation helpers have finished their day's work (checked off the `processorsWg` list),
-		// this supervisor turns off (closes) the `resultsChan` conveyor belt. This tells the 'updater' helper
-		// that there are no more finished results coming.
-		go func() {
-			// `processorsWg.Wait()` blocks until all processor workers have called `Done()`.
-			processorsWg.Wait() // Wait until all items on the processors' checklist are done.
-			log.Println("Orchestrator: All processor workers finished. Closing resultsChan.")
-			// Closing `resultsChan` signals to the `range resultsChan` loop in the updater goroutine
-			// that no more values will be sent, causing the loop to terminate.
-			close(resultsChan)  // Now it's safe to close the results conveyor belt.
-		}()
-
-		// --- Orchestrator's Main Loop ---
-		// ELI5: The factory manager now enters their main work loop. They will keep doing this
-		// until they get the signal to shut down the whole factory.
 		for {
-			// The `select` statement allows a goroutine to wait on multiple communication operations.
-			// It blocks until one of its cases can run, then it executes that case.
-			// If multiple cases are ready, one is chosen at random.
 			// The `select` statement is like the manager listening to multiple phones at once.
 			// They will act on the first phone that rings.
 			select {
 			// Phone 1: The factory clock (`orchestratorTicker.C`) chimes.
-			// This case runs when the ticker sends a value.
 			case <-orchestratorTicker.C:
-				log.Println("Embedding calculator tick: Time to fetch new definitions.")
-				// ELI5: The clock chimed! The manager tells a scout (fetchAndSendDefinitions)
-				// to go look for new work order slips and put them on the `defsToProcessChan` belt.
-				fetchAndSendDefinitions(dbPool, defsToProcessChan)
-
-			// Phone 2: The main stop signal (`stopChan`) for the whole factory arrives.
-			// Case for receiving a signal on `stopChan`, indicating shutdown.
-			// Phone 2: The main stop signal (`stopChan`) for the whole factory arrives.
+				// ELI5: If an operator put up the "closed for now" sign, the manager ignores the chime.
+				c.mu.Lock()
+				paused := c.paused
+				c.mu.Unlock()
+				if paused {
+					continue
+				}
+				// ELI5: Only the head factory (the elected leader) fetches new work orders; the
+				// helpers in other factories stay idle instead of queueing up at the same shelf.
+				if !elector.IsLeader() {
+					continue
+				}
+				c.maybeIndexEmbeddings()
+				// ELI5: If today's allowance at the embedding shop is spent, there's no point
+				// taking new work orders; the manager tries again on a later chime.
+				if c.embedder.Budget().Exhausted() {
+					c.logger.Info("Daily embedding budget exhausted; nothing fetched this tick")
+					continue
+				}
+				c.fetchAndSendDefinitions()
+
+			// Phone 2: An operator changed the tick interval.
+			case interval := <-c.tickChanges:
+				orchestratorTicker.Reset(interval)
+				c.logger.Info("Tick interval changed", "interval", interval)
+
+			// Phone 3: The main stop signal (`stopChan`) for the whole factory arrives,
+			// or someone called Stop directly.
 			case <-stopChan:
-				log.Println("Embedding calculator orchestrator: Stop signal received. Initiating shutdown sequence...")
-				// ELI5: The "time to go home" signal arrived! The manager starts the shutdown process.
-
-				// Step 1: Close `defsToProcessChan`.
-				// This tells the processor workers that no new work orders will be added to their conveyor belt.
-				// They should finish what they're currently working on and then stop.
-				log.Println("Orchestrator: Closing defsToProcessChan to signal processors to finish up.")
-				// Closing `defsToProcessChan` causes the `range defsToProcessChan` loops in the
-				// processor workers to terminate after processing any remaining items in the channel.
-				close(defsToProcessChan)
-
-				// Step 2: Wait for the processors to finish and for `resultsChan` to be closed.
-				// The `processorsWg.Wait()` inside the dedicated goroutine (above) ensures processors finish.
-				// That goroutine then closes `resultsChan`.
-
-				// Step 3: Wait for the updater (and any other main tasks) to finish.
-				// The updater will finish processing any remaining items on `resultsChan` once it's closed.
-				log.Println("Orchestrator: Waiting for updater and other main tasks to complete...")
-				// `mainWg.Wait()` blocks until the updater goroutine (and any other goroutines managed by `mainWg`) calls `Done()`.
-				mainWg.Wait() // Wait for all items on the main factory checklist to be done.
-
-				log.Println("All embedding calculator dependent services (updater) finished.")
-				return // Exit the main orchestrator goroutine, effectively stopping this part of the service.
+				c.shutdown()
+				return
+			case <-c.stopRequested:
+				c.shutdown()
+				return
 			}
 		}
 	}() // End of main orchestrator goroutine
 
-	log.Println("Background embedding calculator service successfully launched its orchestrator.")
+	c.logger.Info("Embedding calculator started", "workers", cfg.Workers, "tick_interval", cfg.TickInterval)
 	// StartEmbeddingCalculatorService returns now, allowing the main application to continue.
-	// The embedding service runs in the background. Shutdown is triggered by closing `stopChan`.
+	// The embedding service runs in the background. Shutdown is triggered by closing `stopChan`
+	// or calling Stop, which also waits for it to finish.
+	return c
+}
+
+// shutdown drains the pipeline: processors finish what's on the belt, then the updater saves
+// the remaining results. It runs on the orchestrator goroutine.
+func (c *EmbeddingCalculator) shutdown() {
+	c.logger.Info("Stop signal received; draining the pipeline")
+
+	// Step 1: Close `defsToProcessChan`.
+	// This tells the processor workers that no new work orders will be added to their conveyor belt.
+	// They finish what is already on it and then stop. `stopped` keeps `SetWorkers` from
+	// hiring anyone new while we're closing.
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	close(c.defsToProcessChan)
+
+	// Step 2: Wait for the processors, then close `resultsChan` so the updater knows
+	// no more results are coming.
+	c.processorsWg.Wait()
+	c.logger.Debug("All processor workers finished; closing resultsChan")
+	close(c.resultsChan)
+
+	// Step 3: Wait for the updater to save the remaining results.
+	c.updaterWg.Wait()
+	c.logger.Debug("Updater finished")
+}
+
+// Stop asks the calculator to shut down and blocks until the processors and the updater have
+// finished, or until `ctx` is done. Work still in flight when `ctx` expires is not lost: its
+// claims expire and another run picks it up. Stop may be called more than once, also after
+// `stopChan` was closed.
+// ELI5: Instead of just shouting "close up!" and walking away, the owner waits at the door
+// until the last helper has left, but not longer than they're willing to wait.
+func (c *EmbeddingCalculator) Stop(ctx context.Context) error {
+	c.stopOnce.Do(func() { close(c.stopRequested) })
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("embedding calculator did not stop in time: %w", ctx.Err())
+	}
+}
+
+// Settings returns the current runtime settings.
+func (c *EmbeddingCalculator) Settings() EmbeddingCalculatorSettings {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return EmbeddingCalculatorSettings{Workers: len(c.workerQuits), TickInterval: c.tickInterval.String(), Paused: c.paused}
+}
+
+// Pause stops the calculator from fetching new definitions until Resume is called. Workers
+// finish what was already fetched, so e.g. a provider outage or a database migration can be
+// waited out without restarting the app.
+func (c *EmbeddingCalculator) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.logger.Info("Embedding calculator paused")
+	}
+}
+
+// Resume undoes Pause; fetching restarts on the next tick.
+func (c *EmbeddingCalculator) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.paused = false
+		c.logger.Info("Embedding calculator resumed")
+	}
+}
+
+// SetWorkers changes the number of processor workers. Retired workers finish the batch they
+// are working on before they exit.
+func (c *EmbeddingCalculator) SetWorkers(n int) error {
+	if err := validateEmbeddingWorkers(n); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return apperror.NewConflictError("embedding calculator is shutting down", nil).WithCode(apperror.CodeShuttingDown)
+	}
+	c.scaleWorkersLocked(n)
+	return nil
+}
+
+// SetTickInterval changes how often the calculator looks for new work.
+func (c *EmbeddingCalculator) SetTickInterval(d time.Duration) error {
+	if err := validateEmbeddingTickInterval(d); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return apperror.NewConflictError("embedding calculator is shutting down", nil).WithCode(apperror.CodeShuttingDown)
+	}
+	c.tickInterval = d
+	// Replace a change the orchestrator hasn't picked up yet instead of blocking on it.
+	select {
+	case <-c.tickChanges:
+	default:
+	}
+	c.tickChanges <- d
+	return nil
+}
+
+func validateEmbeddingWorkers(n int) error {
+	if n < 1 || n > config.MaxEmbeddingWorkers {
+		return apperror.NewValidationError(fmt.Sprintf("workers must be between 1 and %d", config.MaxEmbeddingWorkers), nil)
+	}
+	return nil
+}
+
+func validateEmbeddingTickInterval(d time.Duration) error {
+	if d < config.MinEmbeddingTickInterval {
+		return apperror.NewValidationError(fmt.Sprintf("tick interval must be at least %s", config.MinEmbeddingTickInterval), nil)
+	}
+	return nil
+}
+
+// scaleWorkersLocked starts or retires processor workers until `n` are running. `c.mu` must be held.
+func (c *EmbeddingCalculator) scaleWorkersLocked(n int) {
+	for len(c.workerQuits) < n {
+		quit := make(chan struct{})
+		c.workerQuits = append(c.workerQuits, quit)
+		c.nextWorkerID++
+		c.processorsWg.Add(1) // Add a task to the processors' checklist.
+		go func(workerID int) {
+			defer c.processorsWg.Done() // When this worker exits, it checks itself off the processors' list.
+			c.runProcessor(workerID, quit)
+		}(c.nextWorkerID)
+	}
+	for len(c.workerQuits) > n {
+		last := len(c.workerQuits) - 1
+		close(c.workerQuits[last])
+		c.workerQuits = c.workerQuits[:last]
+	}
+}
+
+// runProcessor is one processor worker: it takes definitions off the belt, embeds them in
+// batches and hands the results to the updater, until the belt closes or it is retired.
+func (c *EmbeddingCalculator) runProcessor(workerID int, quit <-chan struct{}) {
+	logger := c.logger.With("worker", workerID)
+	logger.Debug("Processor worker starting")
+	defer logger.Debug("Processor worker exiting")
+	for {
+		var def TextToEmbed
+		select {
+		case <-quit:
+			return
+		case d, ok := <-c.defsToProcessChan:
+			if !ok {
+				return
+			}
+			def = d
+		}
+
+		// ELI5: Instead of carrying one slip at a time to the embedding provider, the worker
+		// grabs whatever else is already waiting on the belt (up to the batch size) and
+		// sends them together; providers are much faster per text that way.
+		batch := collectBatch(def, c.defsToProcessChan, c.batchSize)
+		texts := make([]string, len(batch))
+		for j, d := range batch {
+			texts[j] = d.Text
+		}
+		logger.Debug("Embedding batch", "texts", len(batch), "model", c.embedder.Model())
+
+		// The request gets its own timeout on top of the HTTP client's, so a stuck provider
+		// can't hold a worker (and therefore shutdown) forever.
+		ctx, cancel := context.WithTimeout(context.Background(), embeddingRequestTimeout)
+		vectors, err := c.embedder.Embed(ctx, texts)
+		cancel()
+
+		// ELI5: The worker places one result slip per text onto the `resultsChan` conveyor belt.
+		for j, d := range batch {
+			result := EmbeddingResult{Source: d.Source, ID: d.ID, Error: err}
+			if err == nil {
+				result.Embedding = vectors[j]
+			}
+			c.resultsChan <- result
+		}
+	}
+}
+
+// runUpdater saves results until `resultsChan` is closed.
+func (c *EmbeddingCalculator) runUpdater() {
+	c.logger.Debug("Updater starting")
+	for result := range c.resultsChan {
+		src := result.Source
+		var exhausted *embedding.BudgetExhaustedError
+		if errors.As(result.Error, &exhausted) {
+			// The provider was never asked, so this isn't a failure of the text: hand the row
+			// back for a later tick instead of writing a tally mark.
+			if err := releaseClaims(c.dbPool, src, []int{result.ID}); err != nil {
+				c.logger.Error("Failed to release claim", "source", src.name, "id", result.ID, "error", err)
+			}
+			continue
+		}
+		if result.Error != nil {
+			c.logger.Warn("Embedding failed", "source", src.name, "id", result.ID, "error", result.Error)
+			// ELI5: Write a tally mark on the work order. After too many marks, we stop trying.
+			gaveUp, err := markEmbeddingFailure(c.dbPool, src, result.ID, result.Error)
+			if err != nil {
+				c.logger.Error("Failed to record embedding failure", "source", src.name, "id", result.ID, "error", err)
+			} else if gaveUp {
+				c.logger.Warn("Giving up on row after repeated failures", "source", src.name, "id", result.ID, "attempts", maxEmbeddingAttempts)
+			}
+			continue
+		}
+		// ELI5: Put the finished number-list into the row's drawer in the database.
+		found, err := storeEmbedding(c.dbPool, src, result.ID, result.Embedding, c.embedder.Model())
+		switch {
+		case err != nil:
+			// The row stays pending and is fetched again once its claim expires.
+			c.logger.Error("Failed to store embedding", "source", src.name, "id", result.ID, "error", err)
+		case !found:
+			c.logger.Debug("Row no longer exists; embedding discarded", "source", src.name, "id", result.ID)
+		default:
+			c.logger.Debug("Stored embedding", "source", src.name, "id", result.ID, "dimensions", len(result.Embedding))
+		}
+	}
+	// This log message appears when `resultsChan` is closed and the loop finishes.
+	c.logger.Debug("Updater exiting")
 }
 
-// fetchAndSendDefinitions simulates fetching definitions from the database that need embeddings
-// and sends them to the defsToProcessChan.
-// ELI5: This is our scout. It goes to the (simulated) database, finds work order slips
-// (definitions that don't have embeddings yet), and puts them on the `defsToProcessChan` conveyor belt
-// for the processor workers.
-// `defsToProcessChan chan<- DefinitionToEmbed` indicates that this function only sends to the channel.
-func fetchAndSendDefinitions(dbPool *pgxpool.Pool, defsToProcessChan chan<- DefinitionToEmbed) {
-	log.Println("Fetcher logic: Fetching definitions from DB (simulation)...")
-	// In a real application, this would be a database query like:
-	// SELECT id, text FROM definitions WHERE embedding IS NULL LIMIT 10;
-
-	// Simulate fetching a couple of definitions.
-	// We use time to make IDs somewhat unique for demonstration.
-	dummyDefinitions := []DefinitionToEmbed{
-		{ID: time.Now().Second()*100 + 1, Text: fmt.Sprintf("Definition fetched at %v", time.Now().Format(time.Kitchen))},
-		{ID: time.Now().Second()*100 + 2, Text: "Another sample definition text for embedding."},
+// fetchAndSendDefinitions claims rows that need embeddings, definitions first and then
+// comments (see `embeddingSources`), and sends them to the defsToProcessChan. It only claims as
+// many as fit on the belt right now, so claimed rows never sit waiting behind a full channel
+// while their lease runs out.
+// ELI5: This is our scout. It goes to the database, finds work order slips (texts that
+// don't have embeddings yet), writes "taken" on them so scouts from other factories leave them
+// alone, and puts them on the `defsToProcessChan` conveyor belt for the processor workers.
+func (c *EmbeddingCalculator) fetchAndSendDefinitions() {
+	dbPool, defsToProcessChan := c.dbPool, c.defsToProcessChan
+	for _, src := range embeddingSources {
+		free := cap(defsToProcessChan) - len(defsToProcessChan)
+		if free <= 0 {
+			c.logger.Debug("defsToProcessChan is full; nothing more claimed this tick")
+			return
+		}
+
+		items, err := claimForEmbedding(dbPool, src, free)
+		if err != nil {
+			c.logger.Error("Failed to claim rows", "source", src.name, "error", err)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		var unsent []int
+		sent := 0
+		for _, item := range items {
+			// Rows without any text (e.g. a comment that is only an image) have nothing to embed.
+			if strings.TrimSpace(item.Text) == "" {
+				if err := markEmbeddingSkipped(dbPool, src, item.ID, "no text to embed"); err != nil {
+					c.logger.Error("Failed to skip row", "source", src.name, "id", item.ID, "error", err)
+				}
+				continue
+			}
+			// Use a select with a default case to prevent blocking if the channel is full.
+			// This is a non-blocking send attempt. The orchestrator is the only sender, so the
+			// belt can't fill up behind our back, but an unsent claim is released just in case.
+			select {
+			case defsToProcessChan <- item:
+				// If the send to `defsToProcessChan` succeeds immediately (channel not full).
+				sent++
+			default:
+				unsent = append(unsent, item.ID)
+			}
+		}
+		if len(unsent) > 0 {
+			c.logger.Warn("defsToProcessChan is full; releasing claims", "source", src.name, "count", len(unsent))
+			if err := releaseClaims(dbPool, src, unsent); err != nil {
+				// The claims expire after `embeddingClaimLease` anyway.
+				c.logger.Error("Failed to release claims", "source", src.name, "error", err)
+			}
+		}
+		c.logger.Debug("Claimed rows to embed", "source", src.name, "count", sent)
 	}
+}
 
-	for _, def := range dummyDefinitions {
-		// Try to send the definition to the processing channel.
-		// Use a select with a default case to prevent blocking if the channel is full.
-		// This is a non-blocking send attempt.
-		// This makes the fetcher non-blocking if the processors are overwhelmed.
+// collectBatch starts a batch with `first` and adds definitions that are already queued,
+// without waiting for more, until the batch holds `size` items.
+// ELI5: Take the slip in your hand plus any slips lying on the belt right now, but don't stand
+// around waiting for new ones.
+func collectBatch(first TextToEmbed, queue <-chan TextToEmbed, size int) []TextToEmbed {
+	batch := []TextToEmbed{first}
+	for len(batch) < size {
 		select {
-		case defsToProcessChan <- def:
-			// If the send to `defsToProcessChan` succeeds immediately (channel not full).
-			log.Printf("Fetcher logic: Sent definition ID %d to process.\n", def.ID)
+		case def, ok := <-queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, def)
 		default:
-			// ELI5: If the `defsToProcessChan` conveyor belt is full, the scout can't place more work orders
-			// right now. It logs this and will try again on the next tick.
-			log.Printf("Fetcher logic: defsToProcessChan is full. Skipping definition ID %d for this tick.\n", def.ID)
+			return batch
 		}
 	}
-	log.Println("Fetcher logic: Finished attempting to send definitions for this tick.")
-}
\ No newline at end of file
+	return batch
+}
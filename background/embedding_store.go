@@ -0,0 +1,221 @@
+// Package background, as part of the background services module.
+// This file, `embedding_store.go`, writes the results of the embedding calculator back to the
+// database. Every embedded table (`definitions`, `comments`, see `embeddingSources`) carries
+// the same set of columns: vectors go into the pgvector column `embedding`; failures are
+// counted in `embedding_attempts` and retried after the job queue's exponential backoff, so
+// that a text the provider keeps rejecting (e.g. too long) is given up after
+// `maxEmbeddingAttempts` instead of being retried on every tick.
+//
+// Before a row is handed to the processors it is claimed (`embedding_claimed_at`/`_by`),
+// so that several app instances sharing the database split the backlog instead of embedding
+// the same rows. Writing a result releases the claim; a claim older than `embeddingClaimLease`
+// is treated as abandoned (e.g. the instance crashed) and the row is picked up again.
+package background
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/jobs"
+)
+
+const (
+	// maxEmbeddingAttempts is how often a row may fail before it's no longer fetched.
+	maxEmbeddingAttempts = 5
+
+	// embeddingWriteTimeout bounds a single write-back statement.
+	embeddingWriteTimeout = 10 * time.Second
+
+	// maxStoredErrorLength keeps provider error messages in `embedding_error` reasonably short.
+	maxStoredErrorLength = 500
+
+	// embeddingClaimLease is how long a claim protects a row. It must comfortably exceed the
+	// time a row waits on the belt plus `embeddingRequestTimeout`.
+	embeddingClaimLease = 10 * time.Minute
+)
+
+// embeddingSource is a table whose rows get embeddings.
+type embeddingSource struct {
+	name     string // Singular, for logs and the admin API
+	table    string
+	idColumn string
+	// textExpr computes the text to embed from the row aliased `d`.
+	textExpr string
+}
+
+var (
+	definitionSource = &embeddingSource{
+		name:     "definition",
+		table:    "definitions",
+		idColumn: "definitionid",
+		textExpr: "d.definition",
+	}
+	// Comments store their body as a JSON array of parts; the subject ("header") and the text
+	// parts are embedded, images and other parts are not.
+	commentSource = &embeddingSource{
+		name:     "comment",
+		table:    "comments",
+		idColumn: "commentid",
+		textExpr: `COALESCE((SELECT string_agg(part->>'data', E'\n') FROM jsonb_array_elements(d.content::jsonb) part
+		                     WHERE part->>'type' IN ('header', 'text')), '')`,
+	}
+
+	// embeddingSources are fetched in this order: definitions, which semantic search depends on,
+	// before comments.
+	embeddingSources = []*embeddingSource{definitionSource, commentSource}
+)
+
+// claimOwner identifies this instance in `embedding_claimed_by`, for debugging.
+var claimOwner = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// pendingEmbeddingCondition selects rows that still need an embedding (none yet, or one
+// marked stale by a re-embedding campaign, see `reembed.go`) and haven't used up their
+// attempts. The fetcher uses it to pick work (see `claimForEmbedding`).
+var pendingEmbeddingCondition = "(embedding IS NULL OR embedding_stale) AND embedding_attempts < " + strconv.Itoa(maxEmbeddingAttempts) +
+	" AND (embedding_retry_at IS NULL OR embedding_retry_at <= NOW())"
+
+// claimForEmbedding marks up to `limit` pending, unclaimed rows of `src` as in progress and
+// returns them. `FOR UPDATE SKIP LOCKED` lets concurrent claimers on other instances pass over
+// the rows this statement is taking instead of waiting for them, so no row is claimed twice.
+func claimForEmbedding(dbPool *pgxpool.Pool, src *embeddingSource, limit int) ([]TextToEmbed, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingWriteTimeout)
+	defer cancel()
+	rows, err := dbPool.Query(ctx, fmt.Sprintf(`
+		UPDATE %[1]s d
+		SET embedding_claimed_at = NOW(), embedding_claimed_by = $2
+		FROM (
+			SELECT %[2]s FROM %[1]s
+			WHERE %[3]s
+			  AND (embedding_claimed_at IS NULL OR embedding_claimed_at < NOW() - make_interval(secs => $3))
+			ORDER BY %[2]s
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) claimable
+		WHERE d.%[2]s = claimable.%[2]s
+		RETURNING d.%[2]s, %[4]s`, src.table, src.idColumn, pendingEmbeddingCondition, src.textExpr),
+		limit, claimOwner, embeddingClaimLease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TextToEmbed
+	for rows.Next() {
+		item := TextToEmbed{Source: src}
+		if err := rows.Scan(&item.ID, &item.Text); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// releaseClaims gives claimed rows back without recording an attempt, e.g. when they
+// couldn't be handed to a processor.
+func releaseClaims(dbPool *pgxpool.Pool, src *embeddingSource, ids []int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingWriteTimeout)
+	defer cancel()
+	_, err := dbPool.Exec(ctx, fmt.Sprintf(`
+		UPDATE %s SET embedding_claimed_at = NULL, embedding_claimed_by = NULL
+		WHERE %s = ANY($1) AND embedding_claimed_by = $2`, src.table, src.idColumn), ids, claimOwner)
+	return err
+}
+
+// formatVector renders a vector in pgvector's text format, e.g. "[0.1,0.2,0.3]". Sending text
+// and casting with `::vector` avoids a driver-specific vector type.
+func formatVector(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// storeEmbedding writes a vector computed by `model`. The statement is an upsert in effect: it
+// overwrites whatever was stored before (a previous model's vector, a failure record) and resets
+// the failure bookkeeping, so writing the same result twice is harmless. It reports whether the
+// row still exists.
+func storeEmbedding(dbPool *pgxpool.Pool, src *embeddingSource, id int, vector []float32, model string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingWriteTimeout)
+	defer cancel()
+	tag, err := dbPool.Exec(ctx, fmt.Sprintf(`
+		UPDATE %s
+		SET embedding = $1::vector,
+		    embedding_model = $3,
+		    embedding_stale = FALSE,
+		    embedding_attempts = 0,
+		    embedding_error = NULL,
+		    embedding_retry_at = NULL,
+		    embedding_claimed_at = NULL,
+		    embedding_claimed_by = NULL,
+		    embedding_updated_at = NOW()
+		WHERE %s = $2`, src.table, src.idColumn), formatVector(vector), id, model)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// markEmbeddingFailure records a failed attempt and reports whether the row has now used up
+// all its attempts.
+func markEmbeddingFailure(dbPool *pgxpool.Pool, src *embeddingSource, id int, cause error) (bool, error) {
+	message := cause.Error()
+	if len(message) > maxStoredErrorLength {
+		message = message[:maxStoredErrorLength]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingWriteTimeout)
+	defer cancel()
+	var attempts int
+	err := db.WithTx(ctx, dbPool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, fmt.Sprintf(`
+			UPDATE %s
+			SET embedding_attempts = embedding_attempts + 1,
+			    embedding_error = $1,
+			    embedding_claimed_at = NULL,
+			    embedding_claimed_by = NULL,
+			    embedding_updated_at = NOW()
+			WHERE %s = $2
+			RETURNING embedding_attempts`, src.table, src.idColumn), message, id).Scan(&attempts)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET embedding_retry_at = NOW() + make_interval(secs => $1) WHERE %s = $2`, src.table, src.idColumn),
+			jobs.Backoff(attempts).Seconds(), id)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return attempts >= maxEmbeddingAttempts, nil
+}
+
+// markEmbeddingSkipped gives up on a row right away, e.g. a comment that consists only of
+// images and has no text to embed.
+func markEmbeddingSkipped(dbPool *pgxpool.Pool, src *embeddingSource, id int, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingWriteTimeout)
+	defer cancel()
+	_, err := dbPool.Exec(ctx, fmt.Sprintf(`
+		UPDATE %s
+		SET embedding_attempts = $1,
+		    embedding_error = $2,
+		    embedding_claimed_at = NULL,
+		    embedding_claimed_by = NULL,
+		    embedding_updated_at = NOW()
+		WHERE %s = $3`, src.table, src.idColumn), maxEmbeddingAttempts, reason, id)
+	return err
+}
@@ -0,0 +1,83 @@
+// Package background, as part of the background services module.
+// This file, `handlers.go`, lets users ask for a definition to be embedded right away, e.g.
+// after editing it, instead of waiting for the backfill to reach it.
+package background
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/render"
+)
+
+// EmbeddingRequestResponse identifies the queued embedding job.
+// @Description Queued embedding job
+type EmbeddingRequestResponse struct {
+	// example: 1234
+	JobID int64 `json:"job_id"`
+	// example: 5678
+	DefinitionID int `json:"definition_id"`
+}
+
+// EmbeddingHandlers serves user-facing embedding requests.
+type EmbeddingHandlers struct {
+	db    *pgxpool.Pool
+	queue *jobs.Queue
+}
+
+// NewEmbeddingHandlers creates the handlers.
+func NewEmbeddingHandlers(db *pgxpool.Pool, queue *jobs.Queue) *EmbeddingHandlers {
+	return &EmbeddingHandlers{db: db, queue: queue}
+}
+
+// HandleRequestEmbedding godoc
+// @Summary Embed a definition now
+// @Description Queues the definition for embedding ahead of the background backfill, so semantic search includes its current text shortly.
+// @Tags embeddings
+// @Produce json
+// @Security BearerAuth
+// @Param definitionID path int true "Definition ID"
+// @Success 202 {object} EmbeddingRequestResponse "Embedding queued"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid definition ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition not found"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Daily quota exceeded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /definitions/{definitionID}/embedding [post]
+func (h *EmbeddingHandlers) HandleRequestEmbedding() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		definitionID, err := strconv.Atoi(chi.URLParam(r, "definitionID"))
+		if err != nil || definitionID <= 0 {
+			auth.WriteError(w, r, apperror.NewBadRequestError("invalid definition ID", err))
+			return
+		}
+
+		var exists int
+		err = h.db.QueryRow(r.Context(), `SELECT 1 FROM definitions WHERE definitionid = $1`, definitionID).Scan(&exists)
+		if errors.Is(err, pgx.ErrNoRows) {
+			auth.WriteError(w, r, apperror.NewNotFoundError(fmt.Sprintf("definition %d not found", definitionID), nil))
+			return
+		}
+		if err != nil {
+			auth.WriteError(w, r, apperror.NewDatabaseError("failed to look up definition", err))
+			return
+		}
+
+		jobID, err := EnqueueEmbedding(r.Context(), h.queue, definitionID, jobs.PriorityHigh)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusAccepted, EmbeddingRequestResponse{JobID: jobID, DefinitionID: definitionID})
+	}
+}
@@ -0,0 +1,221 @@
+// Package background, as part of the background services module.
+// This file, `reembed.go`, runs re-embedding campaigns. Every stored vector records the model
+// that produced it (`embedding_model`). When the configured model changes, an administrator
+// starts a campaign, which marks the affected rows stale; the calculator then picks them up
+// like missing embeddings, a few per tick, while the old vectors keep serving until replaced.
+// Each campaign is reported as a background task (see jbovlaste/progress.go), so an admin UI
+// can follow it over SSE and cancel it.
+package background
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/jbovlaste"
+)
+
+// reembedProgressInterval is how often a running campaign reports its progress.
+const reembedProgressInterval = 5 * time.Second
+
+// EmbeddingStatus summarizes how far the stored embeddings are from the configured model.
+// @Description Embedding coverage for the configured model
+type EmbeddingStatus struct {
+	// Model the calculator currently uses
+	// example: "nomic-embed-text"
+	Model       string          `json:"model"`
+	Definitions EmbeddingCounts `json:"definitions"`
+	Comments    EmbeddingCounts `json:"comments"`
+}
+
+// EmbeddingCounts counts the rows of one table by embedding state.
+// @Description Rows of one table by embedding state
+type EmbeddingCounts struct {
+	// example: 48210
+	Total int64 `json:"total"`
+	// Rows embedded with the configured model
+	// example: 45000
+	Current int64 `json:"current"`
+	// Rows waiting to be re-embedded by a campaign
+	// example: 3000
+	Stale int64 `json:"stale"`
+	// Rows without any embedding
+	// example: 200
+	Missing int64 `json:"missing"`
+	// Rows given up on after too many failed attempts, or skipped for having no text
+	// example: 10
+	Failed int64 `json:"failed"`
+	// Rows embedded with another model and not yet marked stale
+	// example: 0
+	Outdated int64 `json:"outdated"`
+}
+
+// ReembedResponse reports the result of starting a campaign.
+// @Description Result of starting a re-embedding campaign
+type ReembedResponse struct {
+	// example: "nomic-embed-text"
+	Model string `json:"model"`
+	// Definitions and comments newly marked for re-embedding
+	// example: 3000
+	Marked int64 `json:"marked"`
+	// Follow progress at GET /admin/tasks/{task_id}/events
+	// example: "3f1c2a9e-5b7d-4e8f-9a0b-1c2d3e4f5a6b"
+	TaskID string `json:"task_id"`
+}
+
+// Status counts definitions and comments by embedding state relative to the configured model.
+func (c *EmbeddingCalculator) Status(ctx context.Context) (*EmbeddingStatus, error) {
+	status := &EmbeddingStatus{Model: c.embedder.Model()}
+	if err := c.countEmbeddings(ctx, definitionSource, &status.Definitions); err != nil {
+		return nil, err
+	}
+	if err := c.countEmbeddings(ctx, commentSource, &status.Comments); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// countEmbeddings fills `counts` for one source table.
+func (c *EmbeddingCalculator) countEmbeddings(ctx context.Context, src *embeddingSource, counts *EmbeddingCounts) error {
+	err := c.dbPool.QueryRow(ctx, fmt.Sprintf(`
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE embedding IS NOT NULL AND NOT embedding_stale AND embedding_model = $1),
+		       COUNT(*) FILTER (WHERE embedding IS NOT NULL AND embedding_stale),
+		       COUNT(*) FILTER (WHERE embedding IS NULL),
+		       COUNT(*) FILTER (WHERE (embedding IS NULL OR embedding_stale) AND embedding_attempts >= $2),
+		       COUNT(*) FILTER (WHERE embedding IS NOT NULL AND NOT embedding_stale AND embedding_model IS DISTINCT FROM $1)
+		FROM %s`, src.table), c.embedder.Model(), maxEmbeddingAttempts).
+		Scan(&counts.Total, &counts.Current, &counts.Stale, &counts.Missing, &counts.Failed, &counts.Outdated)
+	if err != nil {
+		return apperror.NewDatabaseError(fmt.Sprintf("failed to count %s embeddings", src.name), err)
+	}
+	return nil
+}
+
+// StartReembedding marks embeddings for re-computation with the configured model: those made
+// by another model, or every embedding when `all` is set (e.g. after the provider changed how
+// a model is served). Failure bookkeeping is reset, so rows that gave up earlier get a new
+// chance. Marking a row twice is harmless, so a campaign can simply be started again.
+// Definitions and comments are marked in one transaction, so a campaign covers both or neither.
+func (c *EmbeddingCalculator) StartReembedding(ctx context.Context, all bool) (int64, error) {
+	var marked int64
+	err := db.WithTx(ctx, c.dbPool, func(tx pgx.Tx) error {
+		for _, src := range embeddingSources {
+			tag, err := tx.Exec(ctx, fmt.Sprintf(`
+				UPDATE %s
+				SET embedding_stale = TRUE,
+				    embedding_attempts = 0,
+				    embedding_error = NULL,
+				    embedding_retry_at = NULL
+				WHERE embedding IS NOT NULL
+				  AND NOT embedding_stale
+				  AND ($2 OR embedding_model IS DISTINCT FROM $1)`, src.table), c.embedder.Model(), all)
+			if err != nil {
+				return apperror.NewDatabaseError(fmt.Sprintf("failed to start re-embedding %ss", src.name), err)
+			}
+			marked += tag.RowsAffected()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return marked, nil
+}
+
+// TrackReembedding reports the progress of a campaign that marked `marked` rows until no
+// marked row is left pending, the task is cancelled or the calculator stops. Rows that used up
+// their attempts are counted as finished; the final message says how many gave up. Meant to
+// run in its own goroutine.
+func (c *EmbeddingCalculator) TrackReembedding(progress *jbovlaste.TaskProgress, marked int64) {
+	ticker := time.NewTicker(reembedProgressInterval)
+	defer ticker.Stop()
+	for {
+		pending, failed, err := c.countReembeddingLeft()
+		if err != nil {
+			c.logger.Error("Failed to count re-embedding progress", "task", progress.ID(), "error", err)
+		} else {
+			done := max(marked-pending, 0)
+			if pending == 0 {
+				message := fmt.Sprintf("%d embeddings replaced", done-failed)
+				if failed > 0 {
+					message += fmt.Sprintf(", %d gave up after %d attempts", failed, maxEmbeddingAttempts)
+				}
+				progress.Finish(jbovlaste.TaskDone, done, marked, message)
+				return
+			}
+			progress.Update(done, marked, fmt.Sprintf("%d of %d embeddings replaced", done, marked))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-progress.Cancelled():
+			unmarked, err := c.cancelReembedding()
+			if err != nil {
+				progress.Finish(jbovlaste.TaskFailed, 0, marked, err.Error())
+				return
+			}
+			progress.Finish(jbovlaste.TaskCancelled, max(marked-unmarked, 0), marked,
+				fmt.Sprintf("%d embeddings left as they were", unmarked))
+			return
+		case <-c.done:
+			progress.Finish(jbovlaste.TaskFailed, 0, marked, "embedding calculator stopped; the campaign continues after a restart")
+			return
+		}
+	}
+}
+
+// countReembeddingLeft counts stale rows still waiting for the calculator and stale rows it
+// gave up on.
+func (c *EmbeddingCalculator) countReembeddingLeft() (pending, failed int64, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingWriteTimeout)
+	defer cancel()
+	for _, src := range embeddingSources {
+		var p, f int64
+		err := c.dbPool.QueryRow(ctx, fmt.Sprintf(`
+			SELECT COUNT(*) FILTER (WHERE embedding_attempts < $1),
+			       COUNT(*) FILTER (WHERE embedding_attempts >= $1)
+			FROM %s WHERE embedding IS NOT NULL AND embedding_stale`, src.table), maxEmbeddingAttempts).Scan(&p, &f)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to count stale %ss: %w", src.name, err)
+		}
+		pending += p
+		failed += f
+	}
+	return pending, failed, nil
+}
+
+// cancelReembedding clears the stale mark of every row not re-embedded yet, so they keep their
+// current vectors, and returns how many rows it unmarked.
+func (c *EmbeddingCalculator) cancelReembedding() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingWriteTimeout)
+	defer cancel()
+	var unmarked int64
+	for _, src := range embeddingSources {
+		tag, err := c.dbPool.Exec(ctx, fmt.Sprintf(`
+			UPDATE %s SET embedding_stale = FALSE, embedding_attempts = 0, embedding_error = NULL, embedding_retry_at = NULL
+			WHERE embedding IS NOT NULL AND embedding_stale`, src.table))
+		if err != nil {
+			return unmarked, fmt.Errorf("failed to cancel re-embedding of %ss: %w", src.name, err)
+		}
+		unmarked += tag.RowsAffected()
+	}
+	return unmarked, nil
+}
+
+// parseAllFlag reads the optional `all` query parameter of the campaign endpoint.
+func parseAllFlag(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	all, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, apperror.NewBadRequestError("all must be true or false", err)
+	}
+	return all, nil
+}
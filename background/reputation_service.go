@@ -0,0 +1,100 @@
+// Package background, as part of the background services module.
+// This file, `reputation_service.go`, keeps the definition part of user reputation in sync.
+// Reaction points are maintained by database triggers (see migration 000009_reputation), but
+// whether a definition is "accepted" depends on the running vote total, so it is re-evaluated
+// periodically here. Only the difference is written: newly accepted definitions gain a ledger
+// event and definitions that dropped out lose theirs; the ledger trigger updates the cached
+// `users.reputation` totals.
+package background
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/leader"
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// reputationSyncInterval is how often accepted definitions are re-evaluated.
+	reputationSyncInterval = 10 * time.Minute
+
+	// definitionAcceptedPoints is awarded to the author of a definition with a positive vote total.
+	definitionAcceptedPoints = 5
+)
+
+// StartReputationService starts a goroutine that syncs definition reputation once at startup
+// and then every `reputationSyncInterval`, until `stopChan` is closed. Only the instance
+// `elector` has chosen as leader syncs.
+// ELI5: A clerk who regularly walks through the dictionary, checks which definitions the
+// community voted up, and updates everyone's score card accordingly.
+func StartReputationService(dbPool *pgxpool.Pool, elector *leader.Elector, stopChan <-chan struct{}) {
+	logger := logging.For("reputation")
+	go func() {
+		defer logger.Info("Reputation service stopped")
+
+		ticker := time.NewTicker(reputationSyncInterval)
+		defer ticker.Stop()
+
+		for {
+			if elector.IsLeader() {
+				ctx, cancel := context.WithTimeout(context.Background(), reputationSyncInterval/2)
+				if err := syncDefinitionReputation(ctx, logger, dbPool); err != nil {
+					logger.Error("Definition reputation sync failed", "error", err)
+				}
+				cancel()
+			}
+
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// syncDefinitionReputation adds ledger events for newly accepted definitions and removes
+// events of definitions that are no longer accepted, in a single transaction.
+func syncDefinitionReputation(ctx context.Context, logger *slog.Logger, dbPool *pgxpool.Pool) error {
+	var added, removed pgconn.CommandTag
+	err := db.WithTx(ctx, dbPool, func(tx pgx.Tx) error {
+		// A definition counts as accepted while its votes sum to more than zero.
+		const acceptedDefinitions = `
+			SELECT d.definitionid, d.userid
+			FROM definitions d
+			JOIN (SELECT definitionid, SUM(value) AS score FROM definitionvotes GROUP BY definitionid) v
+			  ON v.definitionid = d.definitionid
+			WHERE v.score > 0`
+
+		var err error
+		added, err = tx.Exec(ctx, `
+			INSERT INTO reputation_events (user_id, source, source_id, points, reason)
+			SELECT a.userid, 'definition', a.definitionid, $1, 'definition accepted'
+			FROM (`+acceptedDefinitions+`) a
+			JOIN users u ON u.userid = a.userid
+			ON CONFLICT (source, source_id) DO NOTHING`, definitionAcceptedPoints)
+		if err != nil {
+			return err
+		}
+
+		removed, err = tx.Exec(ctx, `
+			DELETE FROM reputation_events e
+			WHERE e.source = 'definition'
+			  AND e.source_id NOT IN (SELECT definitionid FROM (`+acceptedDefinitions+`) a)`)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if added.RowsAffected() > 0 || removed.RowsAffected() > 0 {
+		logger.Info("Definition reputation synced", "accepted", added.RowsAffected(), "unaccepted", removed.RowsAffected())
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Package bodylimit bounds the size of request bodies. Middleware, installed once on the
+// router, limits every body to the server-wide default; Override, installed on a route or a
+// group, replaces that limit with a larger one (uploads, imports) or a smaller one (login and
+// registration). Handlers then read bodies that are bounded already: reading past the limit
+// fails with an `http.MaxBytesError`, which `apperror.FromMaxBytesError` turns into a 413.
+//
+// On the routes of an Override, a body whose Content-Length is over the limit is answered with
+// 413 before the handler runs, so a client uploading too much learns it before sending the body.
+// Middleware can't do that: the route it doesn't know yet may allow more.
+package bodylimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+)
+
+// contextKey keys the request body as the server received it, before any limit.
+type contextKey struct{}
+
+// Middleware limits request bodies to `maxBytes`, unless a route overrides it.
+func Middleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, r.Body))
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Override sets the body limit of the routes it is installed on to `maxBytes`. Without
+// Middleware in front of it, it only adds its limit to the body.
+func Override(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				auth.WriteError(w, r, apperror.NewPayloadTooLargeError(maxBytes, nil))
+				return
+			}
+			original, ok := r.Context().Value(contextKey{}).(io.ReadCloser)
+			if !ok {
+				original = r.Body
+			}
+			r.Body = http.MaxBytesReader(w, original, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
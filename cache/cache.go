@@ -0,0 +1,270 @@
+// Package cache, as part of the shared infrastructure.
+// This file, `cache.go`, caches computed results for a while: reads that are expensive and
+// requested often (trending lists, the word of the day, public profiles) are computed once per
+// TTL and served from the cache in between. Values live in Redis when it is configured, so every
+// instance shares them and an invalidation reaches all of them; otherwise each instance keeps
+// its own copies in memory. Values are stored as JSON either way, so a cached value is a copy
+// the caller may modify.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/user/lensisku-go/logging"
+)
+
+// invalidateBatch is how many keys are unlinked at once when a whole cache is cleared.
+const invalidateBatch = 100
+
+// The results of a lookup, as counted in the metrics.
+const (
+	resultHit   = "hit"
+	resultMiss  = "miss"
+	resultError = "error"
+)
+
+// Store holds the values of every cache. It is created once, at startup, and registers the
+// cache metrics with the default Prometheus registry.
+type Store struct {
+	redis    *Redis
+	mem      *memoryStore
+	group    singleflight.Group
+	requests *prometheus.CounterVec
+	logger   *slog.Logger
+}
+
+// NewStore creates the store. With a nil `rdb`, values are kept in memory.
+func NewStore(rdb *Redis) *Store {
+	s := &Store{
+		redis:  rdb,
+		logger: logging.For("cache"),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "lensisku",
+			Subsystem: "cache",
+			Name:      "requests_total",
+			Help:      "Cache lookups, by cache and result (hit, miss or error). The hit rate is hit / (hit + miss).",
+		}, []string{"cache", "result"}),
+	}
+	if rdb == nil {
+		s.mem = &memoryStore{entries: make(map[string]memoryEntry)}
+	}
+	prometheus.MustRegister(s.requests)
+	return s
+}
+
+// Cache returns the cache called `name`, the values of which are kept for `ttl`. The name
+// labels the metrics and namespaces the keys, so it must be unique. A TTL of zero or less
+// disables the cache: every lookup computes the value.
+func (s *Store) Cache(name string, ttl time.Duration) *Cache {
+	if s == nil {
+		return nil
+	}
+	return &Cache{store: s, name: name, ttl: ttl}
+}
+
+// Cache is a named set of cached values with a common TTL. A nil Cache caches nothing.
+type Cache struct {
+	store *Store
+	name  string
+	ttl   time.Duration
+}
+
+// fullKey is the key of `key` in the backend.
+func (c *Cache) fullKey(key string) string {
+	name := "cache:" + c.name + ":" + key
+	if c.store.redis != nil {
+		return c.store.redis.Key(name)
+	}
+	return name
+}
+
+// GetOrCompute returns the value cached under `key`, or computes it with `compute` and caches
+// it. Concurrent misses of the same key in this instance share one computation. Errors of
+// `compute` are returned and not cached. When the backend fails, the value is computed as if
+// the cache were off, so a Redis outage slows reads down but doesn't break them.
+func GetOrCompute[T any](ctx context.Context, c *Cache, key string, compute func(context.Context) (T, error)) (T, error) {
+	if c == nil || c.ttl <= 0 {
+		return compute(ctx)
+	}
+	full := c.fullKey(key)
+
+	var value T
+	data, found, err := c.store.get(ctx, full)
+	switch {
+	case err != nil:
+		c.store.requests.WithLabelValues(c.name, resultError).Inc()
+		c.store.logger.Warn("Cache read failed", "cache", c.name, "error", err)
+	case found:
+		if err := json.Unmarshal(data, &value); err == nil {
+			c.store.requests.WithLabelValues(c.name, resultHit).Inc()
+			return value, nil
+		}
+		// A value written by an older version of the type; it is replaced below.
+		c.store.requests.WithLabelValues(c.name, resultMiss).Inc()
+	default:
+		c.store.requests.WithLabelValues(c.name, resultMiss).Inc()
+	}
+
+	v, err, _ := c.store.group.Do(full, func() (any, error) {
+		value, err := compute(ctx)
+		if err != nil {
+			return value, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return value, err
+		}
+		if err := c.store.set(ctx, full, data, c.ttl); err != nil {
+			c.store.logger.Warn("Cache write failed", "cache", c.name, "error", err)
+		}
+		return value, nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.(T), nil
+}
+
+// Invalidate removes the values cached under `keys`, so the next lookups compute them again.
+// Failures are logged: the values then stay until their TTL runs out.
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = c.fullKey(key)
+	}
+	if err := c.store.delete(ctx, full); err != nil {
+		c.store.logger.Warn("Cache invalidation failed", "cache", c.name, "error", err)
+	}
+}
+
+// InvalidateAll removes every value of the cache.
+func (c *Cache) InvalidateAll(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	prefix := c.fullKey("")
+	if c.store.redis == nil {
+		c.store.mem.deletePrefix(prefix)
+		return
+	}
+	if err := c.store.deletePrefix(ctx, prefix); err != nil {
+		c.store.logger.Warn("Cache invalidation failed", "cache", c.name, "error", err)
+	}
+}
+
+func (s *Store) get(ctx context.Context, key string) ([]byte, bool, error) {
+	if s.redis == nil {
+		data, ok := s.mem.get(key)
+		return data, ok, nil
+	}
+	data, err := s.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+func (s *Store) set(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if s.redis == nil {
+		s.mem.set(key, data, ttl)
+		return nil
+	}
+	return s.redis.Set(ctx, key, data, ttl).Err()
+}
+
+func (s *Store) delete(ctx context.Context, keys []string) error {
+	if s.redis == nil {
+		s.mem.delete(keys)
+		return nil
+	}
+	return s.redis.Unlink(ctx, keys...).Err()
+}
+
+// deletePrefix unlinks the Redis keys starting with `prefix`. SCAN walks the keyspace in steps,
+// so it doesn't block the server the way KEYS would.
+func (s *Store) deletePrefix(ctx context.Context, prefix string) error {
+	iter := s.redis.Scan(ctx, 0, prefix+"*", invalidateBatch).Iterator()
+	batch := make([]string, 0, invalidateBatch)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == invalidateBatch {
+			if err := s.redis.Unlink(ctx, batch...).Err(); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return s.redis.Unlink(ctx, batch...).Err()
+	}
+	return nil
+}
+
+// memoryStore keeps the values of one instance when there is no Redis.
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+func (m *memoryStore) get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+func (m *memoryStore) set(key string, data []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	// Drop expired entries on write so the map doesn't keep every key ever looked up.
+	for k, entry := range m.entries {
+		if now.After(entry.expiresAt) {
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = memoryEntry{data: data, expiresAt: now.Add(ttl)}
+}
+
+func (m *memoryStore) delete(keys []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+}
+
+func (m *memoryStore) deletePrefix(prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.entries, key)
+		}
+	}
+}
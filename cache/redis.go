@@ -0,0 +1,61 @@
+// Package cache holds the shared Redis client and the cache of computed results built on it
+// (see `cache.go`). One client, with its connection pool, serves every feature that uses Redis;
+// it is created at startup when REDIS_URL is set, and the features fall back to Postgres or to
+// memory when it isn't.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// pingTimeout bounds the health check.
+const pingTimeout = 2 * time.Second
+
+// Redis is the shared client. Keys built with Key carry the deployment's prefix.
+type Redis struct {
+	*redis.Client
+	prefix string
+}
+
+// NewRedis connects to the server of `cfg.URL` and checks that it answers, so a wrong URL or
+// password stops the startup instead of failing the first request. The URL's own settings
+// (database number, TLS with "rediss://") are kept; pool and timeouts come from `cfg`.
+func NewRedis(ctx context.Context, cfg *config.RedisConfig) (*Redis, error) {
+	opts, err := redis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	opts.PoolSize = cfg.PoolSize
+	opts.MinIdleConns = cfg.MinIdleConns
+	opts.DialTimeout = cfg.DialTimeout
+	opts.ReadTimeout = cfg.CommandTimeout
+	opts.WriteTimeout = cfg.CommandTimeout
+	// Connections idle this long are closed rather than reused, so ones a proxy or the server
+	// dropped meanwhile aren't handed out.
+	opts.ConnMaxIdleTime = 5 * time.Minute
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to reach Redis at %s: %w", opts.Addr, err)
+	}
+	return &Redis{Client: client, prefix: cfg.KeyPrefix}, nil
+}
+
+// Key returns `name` with the deployment's key prefix.
+func (r *Redis) Key(name string) string {
+	return r.prefix + name
+}
+
+// Check pings the server, for health checks.
+func (r *Redis) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	return r.Ping(ctx).Err()
+}
@@ -0,0 +1,82 @@
+// Package changelog, as part of the dictionary module.
+// This file, `dto.go`, defines the response bodies of the changelog API.
+package changelog
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/user/lensisku-go/validation"
+)
+
+// Kinds of changed rows, in Change.Entity.
+const (
+	EntityValsi      = "valsi"
+	EntityDefinition = "definition"
+	EntityGloss      = "gloss"
+	EntityRelation   = "relation"
+)
+
+// Sources of changes, in Change.Source.
+const (
+	// SourceAPI is an edit made through the API.
+	SourceAPI = "api"
+	// SourceImport is a change made by a dictionary import.
+	SourceImport = "import"
+	// SourceSystem is a change made without an actor, e.g. directly in the database.
+	SourceSystem = "system"
+)
+
+// Change is one entry of the dictionary changelog.
+// @Description A change to the dictionary
+type Change struct {
+	// example: 90211
+	ID int64 `json:"id"`
+	// example: 678
+	ValsiID int32 `json:"valsi_id"`
+	// Empty if the word no longer exists
+	// example: "klama"
+	Word string `json:"word"`
+	// The other word of a relation
+	RelatedValsiID *int32 `json:"related_valsi_id,omitempty"`
+	// The definition of a definition or gloss change
+	// example: 4212
+	DefinitionID *int32 `json:"definition_id,omitempty"`
+	// valsi, definition, gloss or relation
+	// example: "definition"
+	Entity string `json:"entity"`
+	// create, update or delete
+	// example: "update"
+	Action string `json:"action"`
+	// The row for create and delete; {"field": {"old": ..., "new": ...}} for updates
+	Changes json.RawMessage `json:"changes" swaggertype:"object"`
+	// example: 42
+	ActorID *int32 `json:"actor_id,omitempty"`
+	// example: "mi"
+	ActorUsername *string `json:"actor_username,omitempty"`
+	// api, import or system
+	// example: "api"
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChangeListResponse is a page of changes, most recent first.
+// @Description Page of dictionary changes
+type ChangeListResponse struct {
+	Changes []Change `json:"changes"`
+	Page    int64    `json:"page"`
+	PerPage int64    `json:"per_page"`
+	// Whether older changes follow
+	// example: true
+	HasMore bool `json:"has_more"`
+}
+
+// RecentQuery filters the recent-changes feed; empty fields don't filter.
+type RecentQuery struct {
+	// One of the Entity constants
+	Entity string `form:"entity" validate:"omitempty,oneof=valsi definition gloss relation"`
+	// One of the Source constants
+	Source  string `form:"source" validate:"omitempty,oneof=api import system"`
+	ActorID int32  `form:"user_id" validate:"omitempty,min=1"`
+	validation.Pagination
+}
@@ -0,0 +1,95 @@
+// Package changelog records every change to the dictionary and serves the history of a word
+// and a feed of recent changes.
+// This file, `handlers.go`, serves the change history of a word, at
+// /api/v1/valsi/{valsiID}/history, and the feed of recent changes at /api/v1/changes.
+package changelog
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// ChangelogHandlers provides HTTP handlers for the dictionary changelog.
+type ChangelogHandlers struct {
+	service *ChangelogService
+}
+
+// NewChangelogHandlers creates new ChangelogHandlers.
+func NewChangelogHandlers(service *ChangelogService) *ChangelogHandlers {
+	return &ChangelogHandlers{service: service}
+}
+
+// HandleValsiHistory godoc
+// @Summary Get the history of a word
+// @Description Returns every recorded change to a word, its definitions and their glosses, and the relations it takes part in, most recent first, with who made it and whether through the API or an import.
+// @Tags valsi
+// @Produce json
+// @Param valsiID path int true "Word ID"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Success 200 {object} ChangeListResponse "Changes"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid word ID or pagination"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/valsi/{valsiID}/history [get]
+func (h *ChangelogHandlers) HandleValsiHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		valsiID, err := strconv.ParseInt(chi.URLParam(r, "valsiID"), 10, 32)
+		if err != nil || valsiID <= 0 {
+			auth.WriteError(w, r, apperror.NewBadRequestError("invalid word ID", err))
+			return
+		}
+		var q validation.Pagination
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		history, err := h.service.History(r.Context(), int32(valsiID), q.Page, q.PerPage)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, history)
+	}
+}
+
+// HandleRecentChanges godoc
+// @Summary List recent changes to the dictionary
+// @Description Returns the latest changes to words, definitions, glosses and word relations across the dictionary, most recent first.
+// @Tags valsi
+// @Produce json
+// @Param entity query string false "Only changes to this kind of row" Enums(valsi, definition, gloss, relation)
+// @Param source query string false "Only changes from this source" Enums(api, import, system)
+// @Param user_id query int false "Only changes by this user"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Success 200 {object} ChangeListResponse "Changes"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid filter or pagination"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/changes [get]
+func (h *ChangelogHandlers) HandleRecentChanges() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q RecentQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		changes, err := h.service.Recent(r.Context(), q)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, changes)
+	}
+}
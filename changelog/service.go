@@ -0,0 +1,101 @@
+// Package changelog, as part of the dictionary module.
+// This file, `service.go`, reads the dictionary changelog. The changes themselves are recorded
+// by triggers on the dictionary tables (see migration 000035), so every code path is covered,
+// imports included; writers only tell the triggers who is acting with `SetActor`.
+package changelog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+)
+
+// SetActor credits the dictionary changes of the transaction `tx` to a user, made from
+// `source`. The setting ends with the transaction.
+func SetActor(ctx context.Context, tx pgx.Tx, userID int, source string) error {
+	_, err := tx.Exec(ctx, `
+		SELECT set_config('lensisku.actor_id', $1, true), set_config('lensisku.change_source', $2, true)`,
+		strconv.Itoa(userID), source)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to set the changelog actor", err)
+	}
+	return nil
+}
+
+// ChangelogService provides the changelog API.
+// It reads through the app pool, or a db.DB reading from a replica.
+type ChangelogService struct {
+	db db.Querier
+}
+
+// NewChangelogService creates a new ChangelogService.
+func NewChangelogService(reader db.Querier) *ChangelogService {
+	return &ChangelogService{db: reader}
+}
+
+// changeSelect reads Change rows; callers append their clauses.
+const changeSelect = `
+	SELECT c.id, c.valsi_id, COALESCE(v.word, ''), c.related_valsi_id, c.definition_id, c.entity, c.action,
+	       c.changes, c.actor_id, u.username, c.source, c.created_at
+	FROM dictionary_changes c
+	LEFT JOIN valsi v ON v.valsiid = c.valsi_id
+	LEFT JOIN users u ON u.userid = c.actor_id`
+
+// list runs a changelog query and reads a page of it. The query must end with the LIMIT and
+// OFFSET placeholders; one more row than a page is fetched to tell whether more follow.
+func (s *ChangelogService) list(ctx context.Context, page, perPage int64, query string, args ...any) (*ChangeListResponse, error) {
+	rows, err := s.db.Query(ctx, query, append(args, perPage+1, (page-1)*perPage)...)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list changes", err)
+	}
+	defer rows.Close()
+	resp := &ChangeListResponse{Changes: []Change{}, Page: page, PerPage: perPage}
+	for rows.Next() {
+		var c Change
+		if err := rows.Scan(&c.ID, &c.ValsiID, &c.Word, &c.RelatedValsiID, &c.DefinitionID, &c.Entity, &c.Action,
+			&c.Changes, &c.ActorID, &c.ActorUsername, &c.Source, &c.CreatedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read change", err)
+		}
+		resp.Changes = append(resp.Changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list changes", err)
+	}
+	if int64(len(resp.Changes)) > perPage {
+		resp.Changes = resp.Changes[:perPage]
+		resp.HasMore = true
+	}
+	return resp, nil
+}
+
+// History returns the changes of a word, its definitions and glosses, and the relations it
+// takes part in, most recent first.
+func (s *ChangelogService) History(ctx context.Context, valsiID int32, page, perPage int64) (*ChangeListResponse, error) {
+	var known bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM valsi WHERE valsiid = $1)
+		    OR EXISTS (SELECT 1 FROM dictionary_changes WHERE valsi_id = $1)`, valsiID).Scan(&known)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to look up word", err)
+	}
+	if !known {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("word with ID %d not found", valsiID), nil)
+	}
+	return s.list(ctx, page, perPage, changeSelect+`
+		WHERE c.valsi_id = $1 OR c.related_valsi_id = $1
+		ORDER BY c.id DESC
+		LIMIT $2 OFFSET $3`, valsiID)
+}
+
+// Recent returns the latest changes to the whole dictionary.
+func (s *ChangelogService) Recent(ctx context.Context, q RecentQuery) (*ChangeListResponse, error) {
+	return s.list(ctx, q.Page, q.PerPage, changeSelect+`
+		WHERE ($1 = '' OR c.entity = $1) AND ($2 = '' OR c.source = $2) AND ($3 = 0 OR c.actor_id = $3)
+		ORDER BY c.id DESC
+		LIMIT $4 OFFSET $5`, q.Entity, q.Source, q.ActorID)
+}
@@ -0,0 +1,57 @@
+// Package comments, as part of the comments module.
+// This file, `feed.go`, builds a user's home feed: the most recent comments written by the
+// user and by everyone they follow (the `user_follows` table owned by the users module).
+// Authors the user has blocked or muted (`user_blocks`) never show up.
+package comments
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/validation"
+)
+
+// GetFeed returns a page of the user's home feed, newest first.
+// Think of it as the user's personal newspaper: only authors they subscribed to (plus themselves).
+func (s *commentServiceImpl) GetFeed(ctx context.Context, userID int32, p validation.Pagination) (*validation.Page[Comment], error) {
+	// A read-only transaction gives the count, the ID page and the comments one consistent snapshot.
+	var total int64
+	var comments []Comment
+	err := db.WithTxOptions(ctx, s.db, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+
+		// The feed's authors: the user plus everyone they follow, minus anyone they blocked or muted.
+		const authorsFilter = `
+			(c.userid = $1 OR c.userid IN (SELECT followee_id FROM user_follows WHERE follower_id = $1))
+			AND c.userid NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $1)`
+
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM comments c WHERE `+authorsFilter, userID).Scan(&total); err != nil {
+			return apperror.NewDatabaseError("failed to count feed comments", err)
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT c.commentid FROM comments c
+			WHERE `+authorsFilter+`
+			ORDER BY c.time DESC, c.commentid DESC
+			LIMIT $2 OFFSET $3`, userID, p.PerPage, p.Offset())
+		if err != nil {
+			return apperror.NewDatabaseError("failed to list feed comments", err)
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+		if err != nil {
+			return apperror.NewDatabaseError("failed to list feed comments", err)
+		}
+
+		comments, err = s.loadCommentsInternal(ctx, tx, ids, &userID)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load feed comments", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return validation.NewPage(comments, total, p), nil
+}
@@ -5,14 +5,18 @@
 package comments
 
 import (
-	"encoding/json"
 	"net/http"
-	// `strings` provides utility functions for string manipulation.
-	"strings"
+	"strconv"
 
 	// `chi` is a lightweight, idiomatic and composable router for building HTTP services in Go.
 	// It's used here for routing comment-related API endpoints.
 	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/bodylimit"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
 )
 
 // CommentHandler handles HTTP requests for comments.
@@ -49,7 +53,12 @@ func (h *CommentHandler) RegisterRoutes(router chi.Router) {
 	// (which would be `/api/v1/comments/` if mounted at `/api/v1/comments`)
 	// call the `addComment` function.
 	// A POST request is usually used when you want to create something new, like a new comment.
-	router.Post("/", h.addComment)
+	router.With(bodylimit.Override(maxCommentBodyBytes)).Post("/", h.addComment)
+	// The home feed: comments by the current user and everyone they follow.
+	router.Get("/feed", h.getFeed)
+	router.Get("/{commentID}/related", h.getRelated)
+	router.Get("/trending", h.getTrending)
+	router.Get("/trending/hashtags", h.getTrendingHashtags)
 	// ... other comment routes would be registered here ...
 	// e.g., router.Get("/thread", h.getThread) // To get all comments in a discussion
 	// router.Post("/like", h.toggleLike)    // To like or unlike a comment
@@ -70,65 +79,203 @@ func (h *CommentHandler) addComment(w http.ResponseWriter, r *http.Request) {
 	// We try to take the user's submitted information (from the request body, which is in JSON)
 	// and fill our blank `req` form with it.
 	// Go's standard `encoding/json` package is used for decoding.
-	// It's good practice to limit the size of the request body.
-	// r.Body = http.MaxBytesReader(w, r.Body, 1048576) // 1 MB limit example
-
-	// Create a new JSON decoder for the request body.
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields() // Good practice: error if extra fields are sent.
-	if err := decoder.Decode(&req); err != nil {
-		// If something goes wrong (e.g., the user sent weird data that doesn't fit the form),
-		// we tell them it's a "Bad Request" and show them the error.
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	// The size of the request body is limited by the route, to `maxCommentBodyBytes`.
+
+	// Decode the JSON body, rejecting unknown fields (good practice: error if extra fields are
+	// sent), and check the form against the rules in its `validate` tags.
+	if err := validation.DecodeStrictJSON(r, &req); err != nil {
+		// If something goes wrong (e.g., the user sent weird data that doesn't fit the form, or
+		// left out the content), we tell them it's a "Bad Request" and which fields are wrong.
+		auth.WriteError(w, r, err)
 		return // Stop here, don't do anything else.
 	}
 
 	// Now we need to know WHO is posting this comment.
-	// In Chi, middleware typically puts values into the request's context.
-	// Imagine when the user logged in, the security guard (auth middleware) put their User ID
-	// into the request's `context.Context`. We're now retrieving it.
-	// The key "userID" must match the key used by the authentication middleware.
-	userIDVal := r.Context().Value("userID") // Replace "userID" with the actual key used by your auth middleware
-	if userIDVal == nil {
-		// If there's no userID in the context, it means they're not logged in or auth failed.
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
-		return // Stop.
-	}
-
-	// The value from context might be in a generic format, so we make sure it's an int32.
-	// This is a type assertion in Go. `userIDVal.(int32)` attempts to assert that `userIDVal`
-	// is of type `int32`. The `ok` variable will be true if the assertion succeeds.
-	userID, ok := userIDVal.(int32)
+	// Imagine when the user logged in, the security guard (auth middleware) put their token claims
+	// into the request's `context.Context`. `auth.GetUserIDFromContext` is the shared, typed way
+	// to read them back, so every module resolves the authenticated user identically.
+	uid, ok := auth.GetUserIDFromContext(r.Context())
 	if !ok {
-		// If the userID in context is weird (not an int32), something is wrong internally.
-		http.Error(w, "Invalid user ID format in context", http.StatusInternalServerError)
+		// If there's no user in the context, it means they're not logged in or auth failed.
+		auth.WriteError(w, r, apperror.NewAuthError("User not authenticated", nil))
 		return // Stop.
 	}
+	// Comment IDs and user IDs are `int32` in this module, matching the database column types.
+	userID := int32(uid)
 
 	// Now we have the comment details (`req`) and who wrote it (`userID`).
 	// We ask the `service` (the manager) to actually add the comment.
 	// This is the call to the business logic layer.
-	comment, err := h.service.AddComment(req, userID)
+	comment, err := h.service.AddComment(r.Context(), req, userID)
 	if err != nil {
 		// If the manager (service) had a problem adding the comment...
-		// We check if the error message says the comment was "too large".
-		if strings.Contains(err.Error(), "exceeds the maximum size") {
-			// If so, tell the user their comment is too big.
-			http.Error(w, "Comment too large: "+err.Error(), http.StatusBadRequest)
-		} else {
+		// Errors that already carry an HTTP meaning and a code (e.g. COMMENT_TOO_LARGE, or
+		// replying to someone who blocked you) are written as they are.
+		if _, ok := apperror.FromError(err); !ok {
 			// For any other problem, tell them something went wrong on our end.
-			http.Error(w, "Failed to add comment: "+err.Error(), http.StatusInternalServerError)
+			err = apperror.NewInternalError("Failed to add comment", err)
 		}
+		auth.WriteError(w, r, err)
 		return // Stop.
 	}
 
 	// If everything went well, the manager (`service`) gives us back the `comment` that was created.
-	// We tell the user "Created" (HTTP status 201) and send them their new comment as JSON.
-	// `w.Header().Set` sets response headers.
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	// `json.NewEncoder(w).Encode(comment)` serializes the `comment` struct to JSON and writes it to the response.
-	json.NewEncoder(w).Encode(comment) // Encode the comment to JSON and write to response.
+	// We tell the user "Created" (HTTP status 201) and send them their new comment.
+	// `render.Write` serializes the `comment` struct in the encoding the client accepts (JSON
+	// unless it asks for MessagePack) and writes it to the response with its headers.
+	render.Write(w, r, http.StatusCreated, comment)
+}
+
+// getFeed handles GET /feed, returning the authenticated user's home feed.
+// @Summary Get the home feed
+// @Description Returns comments written by the current user and by the users they follow, newest first.
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[Comment] "Feed page"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid pagination parameters"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/comments/feed [get]
+func (h *CommentHandler) getFeed(w http.ResponseWriter, r *http.Request) {
+	uid, ok := auth.GetUserIDFromContext(r.Context())
+	if !ok {
+		auth.WriteError(w, r, apperror.NewAuthError("User not authenticated", nil))
+		return
+	}
+
+	var q validation.Pagination
+	if err := validation.DecodeQuery(r, &q); err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	feed, err := h.service.GetFeed(r.Context(), int32(uid), q)
+	if err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	validation.WritePage(w, r, feed)
+}
+
+// getRelated handles GET /{commentID}/related, the "related discussions" of a comment.
+// @Summary Get related discussions
+// @Description Returns comments from other threads whose text is semantically closest to the given comment, most similar first. The list is empty until the comment has been embedded.
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param commentID path int true "Comment ID"
+// @Param limit query int false "Maximum number of comments (default 10, max 50)"
+// @Success 200 {array} Comment "Related comments"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid comment ID or limit"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Comment does not exist"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/comments/{commentID}/related [get]
+func (h *CommentHandler) getRelated(w http.ResponseWriter, r *http.Request) {
+	commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 32)
+	if err != nil || commentID < 1 {
+		auth.WriteError(w, r, apperror.NewBadRequestError("Invalid comment ID", err))
+		return
+	}
+
+	var q RelatedQuery
+	if err := validation.DecodeQuery(r, &q); err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	var currentUserID *int32
+	if uid, ok := auth.GetUserIDFromContext(r.Context()); ok {
+		id := int32(uid)
+		currentUserID = &id
+	}
+
+	related, err := h.service.GetRelatedComments(r.Context(), int32(commentID), currentUserID, q.Limit)
+	if err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	render.Write(w, r, http.StatusOK, related)
+}
+
+// trendingParams decodes a `TrendingQuery`.
+func trendingParams(r *http.Request) (TrendingTimespan, int32, error) {
+	var q TrendingQuery
+	if err := validation.DecodeQuery(r, &q); err != nil {
+		return "", 0, err
+	}
+	return *q.Timespan, *q.Limit, nil
+}
+
+// getTrending handles GET /trending, the most active comments of a timespan.
+// @Summary Get trending comments
+// @Description Returns the comments posted in the timespan with the most reactions and replies (replies count twice). The ranking is cached for a few minutes (`CACHE_TRENDING_TTL`); reactions and bookmarks are the current user's.
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param timespan query string false "LastDay, LastWeek (default), LastMonth, LastYear or AllTime"
+// @Param limit query int false "Maximum number of comments (default 10, max 50)"
+// @Success 200 {array} Comment "Trending comments, most active first"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid timespan or limit"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/comments/trending [get]
+func (h *CommentHandler) getTrending(w http.ResponseWriter, r *http.Request) {
+	timespan, limit, err := trendingParams(r)
+	if err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	var currentUserID *int32
+	if uid, ok := auth.GetUserIDFromContext(r.Context()); ok {
+		id := int32(uid)
+		currentUserID = &id
+	}
+
+	trending, err := h.service.GetTrendingComments(r.Context(), timespan, currentUserID, limit)
+	if err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	render.Write(w, r, http.StatusOK, trending)
+}
+
+// getTrendingHashtags handles GET /trending/hashtags, the most used hashtags of a timespan.
+// @Summary Get trending hashtags
+// @Description Returns the hashtags used by the most comments posted in the timespan. The list is cached for a few minutes (`CACHE_TRENDING_TTL`).
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param timespan query string false "LastDay, LastWeek (default), LastMonth, LastYear or AllTime"
+// @Param limit query int false "Maximum number of hashtags (default 10, max 50)"
+// @Success 200 {array} TrendingHashtag "Trending hashtags, most used first"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid timespan or limit"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/comments/trending/hashtags [get]
+func (h *CommentHandler) getTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	timespan, limit, err := trendingParams(r)
+	if err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	hashtags, err := h.service.GetTrendingHashtags(r.Context(), timespan, limit)
+	if err != nil {
+		auth.WriteError(w, r, err)
+		return
+	}
+
+	render.Write(w, r, http.StatusOK, hashtags)
 }
 
 // --- Placeholder for other handlers ---
@@ -143,12 +290,9 @@ func (h *CommentHandler) addComment(w http.ResponseWriter, r *http.Request) {
 //
 // 	// userID, _ := auth.GetUserIDFromContext(c) // Optional user ID
 //   var currentUserID *int32
-//   userIDVal, exists := c.Get("userID")
-//   if exists {
-//      uid, ok := userIDVal.(int32)
-//      if ok {
-//          currentUserID = &uid
-//      }
+//   if uid, ok := auth.GetUserIDFromContext(r.Context()); ok {
+//      id := int32(uid)
+//      currentUserID = &id
 //   }
 //
 // 	response, err := h.service.GetThreadComments(query, currentUserID)
@@ -0,0 +1,86 @@
+// Package comments, as part of the comments module.
+// This file, `load.go`, loads whole lists of comments at once, as `getCommentByIDInternal`
+// loads one: a query for the comments with their author, counters, thread and the viewer's
+// likes and bookmarks, and one for their reactions, however many comments there are.
+package comments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// loadCommentsInternal returns the comments of `commentIDs`, in that order, as seen by
+// `currentUserID`. IDs of comments that no longer exist are skipped.
+func (s *commentServiceImpl) loadCommentsInternal(ctx context.Context, tx pgx.Tx, commentIDs []int32, currentUserID *int32) ([]Comment, error) {
+	if len(commentIDs) == 0 {
+		return []Comment{}, nil
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT c.commentid, c.threadid, c.parentid, c.userid, c.commentnum, c.time, c.subject, c.content,
+		       u.username,
+		       CASE /* Respect the author's privacy setting for their real name (see users/privacy.go) */
+		           WHEN COALESCE(u.field_visibility->>'realname', 'public') = 'public' THEN u.realname
+		           WHEN u.field_visibility->>'realname' = 'users' AND $2::int IS NOT NULL THEN u.realname
+		           WHEN u.userid = $2 THEN u.realname
+		       END,
+		       COALESCE(cc.total_reactions, 0), COALESCE(cc.total_replies, 0),
+		       cl.user_id IS NOT NULL, cb.user_id IS NOT NULL,
+		       pc.content, t.valsiid, t.definitionid, v.word, d.definition
+		FROM comments c
+		JOIN users u ON u.userid = c.userid
+		LEFT JOIN comment_counters cc ON cc.comment_id = c.commentid
+		LEFT JOIN comment_likes cl ON cl.comment_id = c.commentid AND cl.user_id = $2
+		LEFT JOIN comment_bookmarks cb ON cb.comment_id = c.commentid AND cb.user_id = $2
+		LEFT JOIN comments pc ON pc.commentid = c.parentid
+		LEFT JOIN threads t ON t.threadid = c.threadid
+		LEFT JOIN valsi v ON v.valsiid = t.valsiid
+		LEFT JOIN definitions d ON d.definitionid = t.definitionid
+		WHERE c.commentid = ANY($1)`, commentIDs, currentUserID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching comments: %w", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[int32]*Comment, len(commentIDs))
+	for rows.Next() {
+		var c Comment
+		var content []byte
+		var parentContent sql.NullString
+		if err := rows.Scan(&c.CommentID, &c.ThreadID, &c.ParentID, &c.UserID, &c.CommentNum, &c.Time, &c.Subject, &content,
+			&c.Username, &c.Realname, &c.TotalReactions, &c.TotalReplies, &c.IsLiked, &c.IsBookmarked,
+			&parentContent, &c.ValsiID, &c.DefinitionID, &c.ValsiWord, &c.Definition); err != nil {
+			return nil, fmt.Errorf("error scanning comment: %w", err)
+		}
+		if err := json.Unmarshal(content, &c.Content); err != nil {
+			return nil, fmt.Errorf("error unmarshalling comment content for comment ID %d: %w", c.CommentID, err)
+		}
+		if parentContent.Valid {
+			if err := json.Unmarshal([]byte(parentContent.String), &c.ParentContent); err != nil {
+				return nil, fmt.Errorf("error unmarshalling parent comment content for comment ID %d: %w", c.CommentID, err)
+			}
+		}
+		byID[c.CommentID] = &c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching comments: %w", err)
+	}
+
+	reactions, err := s.fetchReactionsInternal(ctx, tx, commentIDs, currentUserID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reactions: %w", err)
+	}
+	comments := make([]Comment, 0, len(byID))
+	for _, id := range commentIDs {
+		c, ok := byID[id]
+		if !ok {
+			continue
+		}
+		c.Reactions = reactions[id]
+		comments = append(comments, *c)
+	}
+	return comments, nil
+}
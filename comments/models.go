@@ -20,8 +20,8 @@ import (
 // This struct allows for rich content in comments, not just plain text.
 // It has a `Type` (e.g., "text", "image_url", "video_url") and `Data` (the actual text or URL).
 type CommentContent struct {
-	Type string `json:"type"` // What kind of brick is it? (e.g., "text", "image")
-	Data string `json:"data"` // What's on the brick? (e.g., "Hello world!", "http://example.com/cat.jpg")
+	Type string `json:"type" validate:"required"` // What kind of brick is it? (e.g., "text", "image")
+	Data string `json:"data" validate:"required"` // What's on the brick? (e.g., "Hello world!", "http://example.com/cat.jpg")
 }
 
 // ReactionResponse represents a summary of a specific reaction type on a comment.
@@ -226,12 +226,12 @@ type FreeThread struct {
 // Corresponds to Rust's `NewCommentRequest` in `dto.rs`.
 // This DTO defines the expected structure of a request to create a new comment.
 type NewCommentRequest struct {
-	ValsiID       *int32           `json:"valsi_id,omitempty"`
-	NatlangWordID *int32           `json:"natlang_word_id,omitempty"`
-	DefinitionID  *int32           `json:"definition_id,omitempty"`
-	ParentID      *int32           `json:"parent_id,omitempty"` // nil or 0 for top-level comments
+	ValsiID       *int32           `json:"valsi_id,omitempty" validate:"omitnil,min=0"`
+	NatlangWordID *int32           `json:"natlang_word_id,omitempty" validate:"omitnil,min=0"`
+	DefinitionID  *int32           `json:"definition_id,omitempty" validate:"omitnil,min=0"`
+	ParentID      *int32           `json:"parent_id,omitempty" validate:"omitnil,min=0"` // nil or 0 for top-level comments
 	Subject       string           `json:"subject"`
-	Content       []CommentContent `json:"content"`
+	Content       []CommentContent `json:"content" validate:"required,min=1,dive"` // At least one block, each with a type and data
 }
 
 // CommentActionRequest is used for liking/unliking or bookmarking/unbookmarking a comment.
@@ -330,93 +330,81 @@ type ReactionSummary struct {
 // Corresponds to Rust's `ReactionPaginationQuery` in `dto.rs`.
 type ReactionPaginationQuery struct {
 	// Query parameters for requesting paginated reactions.
-	// `form:"page"` tags are often used by libraries like Gorilla/Schema to decode form data into structs.
-	Page     *int64 `json:"page,omitempty" form:"page"`         // Default 1
-	PageSize *int32 `json:"page_size,omitempty" form:"page_size"` // Default 10
+	// `form` tags name the query parameters for `validation.DecodeQuery`, which applies the
+	// `default` and `cap` tags (see validation/decode.go).
+	Page     *int64 `json:"page,omitempty" form:"page" default:"1" validate:"omitnil,min=1"`         // Default 1
+	PageSize *int32 `json:"page_size,omitempty" form:"page_size" default:"10" cap:"100" validate:"omitnil,min=1"` // Default 10
 }
 
-// PaginatedCommentsResponse is a generic response for paginated comments.
-// Corresponds to Rust's `PaginatedCommentsResponse` in `dto.rs`.
-type PaginatedCommentsResponse struct {
-	// Standard structure for returning a paginated list of comments.
-	Comments []Comment `json:"comments"`
-	Total    int64     `json:"total"`
-	Page     int64     `json:"page"`
-	PerPage  int64     `json:"per_page"`
-}
-
-// PaginatedUserCommentsResponse is for paginated comments by a specific user.
-// Corresponds to Rust's `PaginatedUserCommentsResponse` in `dto.rs`.
-// Note: Structure is identical to PaginatedCommentsResponse, could be aliased or kept separate for semantic distinction.
-type PaginatedUserCommentsResponse struct {
-	// Specific DTO for paginated comments by a user, though structurally same as `PaginatedCommentsResponse`.
-	Comments []Comment `json:"comments"`
-	Total    int64     `json:"total"`
-	Page     int64     `json:"page"`
-	PerPage  int64     `json:"per_page"`
-}
+// Pages of comments, such as Rust's `PaginatedCommentsResponse` and
+// `PaginatedUserCommentsResponse`, are `validation.Page[Comment]`.
 
 // FreeThreadQuery defines query parameters for listing free threads.
 // Corresponds to Rust's `FreeThreadQuery` in `dto.rs`.
 type FreeThreadQuery struct {
 	// Query parameters for fetching a list of "free threads".
-	Page       *int64  `json:"page,omitempty" form:"page"`             // Default 1
-	PerPage    *int64  `json:"per_page,omitempty" form:"per_page"`       // Default 20
-	SortBy     *string `json:"sort_by,omitempty" form:"sort_by"`       // Default "time", example "subject"
-	SortOrder  *string `json:"sort_order,omitempty" form:"sort_order"`   // Default "desc", example "asc"
+	Page       *int64  `json:"page,omitempty" form:"page" default:"1" validate:"omitnil,min=1"`             // Default 1
+	PerPage    *int64  `json:"per_page,omitempty" form:"per_page" default:"20" cap:"100" validate:"omitnil,min=1"`       // Default 20
+	SortBy     *string `json:"sort_by,omitempty" form:"sort_by" default:"time"`       // Default "time", example "subject"
+	SortOrder  *string `json:"sort_order,omitempty" form:"sort_order" default:"desc" validate:"omitnil,oneof=asc desc"`   // Default "desc", example "asc"
 }
 
 // ThreadQuery defines query parameters for fetching a specific thread's comments.
 // Corresponds to Rust's `ThreadQuery` in `dto.rs`.
 type ThreadQuery struct {
 	// Query parameters for fetching comments within a specific thread.
-	ValsiID       *int32 `json:"valsi_id,omitempty" form:"valsi_id"`
-	NatlangWordID *int32 `json:"natlang_word_id,omitempty" form:"natlang_word_id"`
-	DefinitionID  *int32 `json:"definition_id,omitempty" form:"definition_id"`
-	CommentID     *int32 `json:"comment_id,omitempty" form:"comment_id"` // To find thread by a comment within it
-	ScrollTo      *int32 `json:"scroll_to,omitempty" form:"scroll_to"`   // Comment ID to scroll to in the view
-	ThreadID      *int32 `json:"thread_id,omitempty" form:"thread_id"`
-	Page          *int64 `json:"page,omitempty" form:"page"`             // Default 1
-	PerPage       *int64 `json:"per_page,omitempty" form:"per_page"`       // Default 20
+	ValsiID       *int32 `json:"valsi_id,omitempty" form:"valsi_id" validate:"omitnil,min=1"`
+	NatlangWordID *int32 `json:"natlang_word_id,omitempty" form:"natlang_word_id" validate:"omitnil,min=1"`
+	DefinitionID  *int32 `json:"definition_id,omitempty" form:"definition_id" validate:"omitnil,min=1"`
+	CommentID     *int32 `json:"comment_id,omitempty" form:"comment_id" validate:"omitnil,min=1"` // To find thread by a comment within it
+	ScrollTo      *int32 `json:"scroll_to,omitempty" form:"scroll_to" validate:"omitnil,min=1"`   // Comment ID to scroll to in the view
+	ThreadID      *int32 `json:"thread_id,omitempty" form:"thread_id" validate:"omitnil,min=1"`
+	Page          *int64 `json:"page,omitempty" form:"page" default:"1" validate:"omitnil,min=1"`             // Default 1
+	PerPage       *int64 `json:"per_page,omitempty" form:"per_page" default:"20" cap:"100" validate:"omitnil,min=1"`       // Default 20
 }
 
 // TrendingQuery defines parameters for fetching trending items (e.g., hashtags).
 // Corresponds to Rust's `TrendingQuery` in `dto.rs`.
 type TrendingQuery struct {
 	// Query parameters for fetching trending items.
-	Timespan *string `json:"timespan,omitempty" form:"timespan"` // Default "LastWeek", example "week"
-	Limit    *int32  `json:"limit,omitempty" form:"limit"`       // Default 10
+	Timespan *TrendingTimespan `json:"timespan,omitempty" form:"timespan" default:"LastWeek" validate:"oneof=LastDay LastWeek LastMonth LastYear AllTime"`
+	Limit    *int32            `json:"limit,omitempty" form:"limit" default:"10" cap:"50" validate:"min=1"`
+}
+
+// RelatedQuery bounds the related discussions of a comment.
+type RelatedQuery struct {
+	Limit int `json:"limit" form:"limit" default:"10" cap:"50" validate:"min=1"`
 }
 
 // PaginationQuery is a generic set of pagination parameters.
 // Corresponds to Rust's `PaginationQuery` in `dto.rs`.
 type PaginationQuery struct {
 	// Generic pagination query parameters, reusable across different listing endpoints.
-	Page    *int64 `json:"page,omitempty" form:"page"`       // Default 1
-	PerPage *int64 `json:"per_page,omitempty" form:"per_page"` // Default 20
+	Page    *int64 `json:"page,omitempty" form:"page" default:"1" validate:"omitnil,min=1"`
+	PerPage *int64 `json:"per_page,omitempty" form:"per_page" default:"20" cap:"100" validate:"omitnil,min=1"`
 }
 
 // SearchCommentsQuery defines parameters for searching comments.
 // Corresponds to Rust's `SearchCommentsQuery` in `dto.rs`.
 type SearchCommentsQuery struct {
 	// Query parameters for searching comments with various filters and sorting options.
-	Page         *int64  `json:"page,omitempty" form:"page"`                 // Default 1
-	PerPage      *int64  `json:"per_page,omitempty" form:"per_page"`           // Default 20
+	Page         *int64  `json:"page,omitempty" form:"page" default:"1" validate:"omitnil,min=1"`                 // Default 1
+	PerPage      *int64  `json:"per_page,omitempty" form:"per_page" default:"20" cap:"100" validate:"omitnil,min=1"`           // Default 20
 	Search       *string `json:"search,omitempty" form:"search"`
-	SortBy       *string `json:"sort_by,omitempty" form:"sort_by"`           // Default "time"
-	SortOrder    *string `json:"sort_order,omitempty" form:"sort_order"`       // Default "desc"
+	SortBy       *string `json:"sort_by,omitempty" form:"sort_by" default:"time"`           // Default "time"
+	SortOrder    *string `json:"sort_order,omitempty" form:"sort_order" default:"desc" validate:"omitnil,oneof=asc desc"`       // Default "desc"
 	Username     *string `json:"username,omitempty" form:"username"`
-	ValsiID      *int32  `json:"valsi_id,omitempty" form:"valsi_id"`
-	DefinitionID *int32  `json:"definition_id,omitempty" form:"definition_id"`
+	ValsiID      *int32  `json:"valsi_id,omitempty" form:"valsi_id" validate:"omitnil,min=1"`
+	DefinitionID *int32  `json:"definition_id,omitempty" form:"definition_id" validate:"omitnil,min=1"`
 }
 
 // ListCommentsQuery defines parameters for listing comments (e.g., all comments by a user).
 // Corresponds to Rust's `ListCommentsQuery` in `dto.rs`.
 type ListCommentsQuery struct {
 	// Query parameters for listing comments, typically with pagination and sorting.
-	Page      *int64  `json:"page,omitempty" form:"page"`             // Default 1
-	PerPage   *int64  `json:"per_page,omitempty" form:"per_page"`       // Default 20
-	SortOrder *string `json:"sort_order,omitempty" form:"sort_order"`   // Default "desc", example "asc"
+	Page      *int64  `json:"page,omitempty" form:"page" default:"1" validate:"omitnil,min=1"`             // Default 1
+	PerPage   *int64  `json:"per_page,omitempty" form:"per_page" default:"20" cap:"100" validate:"omitnil,min=1"`       // Default 20
+	SortOrder *string `json:"sort_order,omitempty" form:"sort_order" default:"desc" validate:"omitnil,oneof=asc desc"`   // Default "desc", example "asc"
 }
 
 // Note: Rust's `NewCommentParams`, `SearchCommentsParams`, `ThreadParams` are internal service parameters
@@ -0,0 +1,75 @@
+// Package comments, as part of the comments module.
+// This file, `related.go`, finds "related discussions": comments in other threads whose
+// embedding (computed by the background embedding calculator, see
+// background/embedding_store.go) is closest to a given comment's. The search runs on the
+// nearest-neighbour index of the comment's model (see background/embedding_index.go), so the
+// vectors are cast to the model's dimension as the index is.
+package comments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+)
+
+// GetRelatedComments returns up to `limit` comments from other threads, most similar first.
+// A comment that hasn't been embedded yet has no related comments, so the result is empty
+// rather than an error. Only vectors of the same model are compared; vectors of different
+// models live in different spaces. Authors the current user blocked or muted are left out.
+func (s *commentServiceImpl) GetRelatedComments(ctx context.Context, commentID int32, currentUserID *int32, limit int) ([]Comment, error) {
+	if limit < 1 {
+		limit = 10
+	}
+
+	var comments []Comment
+	err := db.WithTxOptions(ctx, s.db, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		// The vector is passed back as a parameter: an index is only searched for a constant.
+		var vector, model *string
+		var dims *int
+		err := tx.QueryRow(ctx, `
+			SELECT embedding::text, embedding_model, vector_dims(embedding)
+			FROM comments WHERE commentid = $1`, commentID).Scan(&vector, &model, &dims)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewNotFoundError("Comment not found", err)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to get comment", err)
+		}
+		if vector == nil || model == nil {
+			comments = []Comment{}
+			return nil
+		}
+
+		// The dimension can't be a parameter; it is a number read from the database.
+		rows, err := tx.Query(ctx, fmt.Sprintf(`
+			SELECT c.commentid
+			FROM comments c
+			WHERE c.embedding IS NOT NULL AND c.embedding_model = $4
+			  AND c.threadid <> (SELECT threadid FROM comments WHERE commentid = $1)
+			  AND ($2::int IS NULL OR c.userid NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $2))
+			ORDER BY c.embedding::vector(%[1]d) <=> $5::vector(%[1]d)
+			LIMIT $3`, *dims), commentID, currentUserID, limit, *model, *vector)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to find related comments", err)
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+		if err != nil {
+			return apperror.NewDatabaseError("failed to read related comment", err)
+		}
+
+		comments, err = s.loadCommentsInternal(ctx, tx, ids, currentUserID)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load related comments", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
@@ -11,7 +11,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log" // todo: for basic logging, replace with a proper logger
+	"log/slog"
 	"os"
 	// `strings` for string manipulation.
 	"strings"
@@ -22,6 +22,17 @@ import (
 	"github.com/jackc/pgx/v5" // for pgx.ErrNoRows
 	"github.com/jackc/pgx/v5/pgconn" // for pgconn.CommandTag
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/notifications"
+	"github.com/user/lensisku-go/tracing"
+	"github.com/user/lensisku-go/validation"
 )
 
 // CommentService defines the interface for comment-related operations.
@@ -30,29 +41,35 @@ import (
 // Handlers can depend on this interface rather than the concrete implementation.
 // For example, "AddComment", "GetThreadComments", "ToggleLike", etc.
 type CommentService interface {
-	AddComment(params NewCommentRequest, userID int32) (*Comment, error)
-	GetThreadComments(params ThreadQuery, currentUserID *int32) (*PaginatedCommentsResponse, error)
+	AddComment(ctx context.Context, params NewCommentRequest, userID int32) (*Comment, error)
+	GetThreadComments(params ThreadQuery, currentUserID *int32) (*validation.Page[Comment], error)
 	ToggleLike(commentID int32, userID int32, like bool) error
 	ToggleBookmark(commentID int32, userID int32, bookmark bool) error
-	GetBookmarkedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error)
-	GetLikedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error)
-	GetUserComments(userID int32, page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error)
+	GetBookmarkedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error)
+	GetLikedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error)
+	GetUserComments(userID int32, page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error)
 	CreateOpinion(userID int32, req CreateOpinionRequest) (*CommentOpinion, error)
 	SetOpinionVote(userID int32, req OpinionVoteRequest) error
 	GetCommentOpinions(commentID int32, userID *int32) ([]CommentOpinion, error)
-	GetTrendingComments(timespan TrendingTimespan, currentUserID *int32, limit int32) ([]Comment, error)
+	// GetTrendingComments returns the most active comments of a timespan (see trending.go).
+	GetTrendingComments(ctx context.Context, timespan TrendingTimespan, currentUserID *int32, limit int32) ([]Comment, error)
 	GetCommentStats(commentID int32) (*CommentStats, error)
-	GetMostBookmarkedComments(page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error)
-	GetTrendingHashtags(timespan TrendingTimespan, limit int32) ([]TrendingHashtag, error)
-	GetCommentsByHashtag(tag string, userID *int32, page *int64, perPage *int64) (*PaginatedCommentsResponse, error)
+	GetMostBookmarkedComments(page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error)
+	// GetTrendingHashtags returns the most used hashtags of a timespan (see trending.go).
+	GetTrendingHashtags(ctx context.Context, timespan TrendingTimespan, limit int32) ([]TrendingHashtag, error)
+	GetCommentsByHashtag(tag string, userID *int32, page *int64, perPage *int64) (*validation.Page[Comment], error)
 	DeleteComment(commentID int32, userID int32) error
 	ToggleReaction(commentID int32, userID int32, reaction string) (bool, error)
-	SearchComments(params SearchCommentsQuery, currentUserID *int32) (*PaginatedCommentsResponse, error)
-	GetMyReactions(userID int32, page int64, perPage int64) (*PaginatedCommentsResponse, error)
+	SearchComments(params SearchCommentsQuery, currentUserID *int32) (*validation.Page[Comment], error)
+	GetMyReactions(userID int32, page int64, perPage int64) (*validation.Page[Comment], error)
 	GetReactions(commentID int32, currentUserID *int32, page *int64, pageSize *int32) (*ReactionSummary, error)
-	ListThreads(page int64, perPage int64, sortBy string, sortOrder string) (*PaginatedCommentsResponse, error)
-	ListComments(page int64, perPage int64, sortOrder string, currentUserID *int32) (*PaginatedCommentsResponse, error)
+	ListThreads(page int64, perPage int64, sortBy string, sortOrder string) (*validation.Page[Comment], error)
+	ListComments(page int64, perPage int64, sortOrder string, currentUserID *int32) (*validation.Page[Comment], error)
 	GetLikeCount(commentID int32) (int64, error)
+	// GetFeed returns comments by the user and the users they follow (see feed.go).
+	GetFeed(ctx context.Context, userID int32, p validation.Pagination) (*validation.Page[Comment], error)
+	// GetRelatedComments returns semantically similar comments from other threads (see related.go).
+	GetRelatedComments(ctx context.Context, commentID int32, currentUserID *int32, limit int) ([]Comment, error)
 	// Internal helper, might not be exposed directly in the interface if only used internally
 	// getCommentByID(tx pgx.Tx, commentID int32, userID *int32) (*Comment, error)
 }
@@ -65,320 +82,339 @@ type commentServiceImpl struct {
 	// `db` is a pointer to a `pgxpool.Pool`, representing the database connection pool.
 	// This is a dependency injected via the constructor.
 	db *pgxpool.Pool // This is like the filing cabinet where all comment data is stored.
+	// `queue` receives notification events for new comments (see the `notifications` package).
+	queue *jobs.Queue
+	// `logger` writes this module's log records, tagged with its component name.
+	logger *slog.Logger
+	// `tracer` opens a span around each comment posted, the statements of which nest under it.
+	tracer trace.Tracer
+	// `trending` caches the trending comment IDs and hashtags (see trending.go).
+	trending *cache.Cache
 }
 
 // NewCommentService creates a new CommentService.
 // This is the constructor function for `commentServiceImpl`.
 // This is like hiring a new "comments manager" and giving them access to the filing cabinet (database).
-func NewCommentService(db *pgxpool.Pool) CommentService {
-	return &commentServiceImpl{db: db}
+// `trending` may be nil, in which case trending lists are computed on every request.
+func NewCommentService(db *pgxpool.Pool, queue *jobs.Queue, trending *cache.Cache) CommentService {
+	return &commentServiceImpl{db: db, queue: queue, logger: logging.For("comments"), tracer: otel.Tracer("github.com/user/lensisku-go/comments"), trending: trending}
 }
 
 // This is a rule: comments can't be bigger than 5 Megabytes.
 // Like saying a letter can't be heavier than a certain amount.
 const maxCommentSize = 5 * 1024 * 1024 // 5MB limit
 
+// maxCommentBodyBytes bounds the body of a new comment (see `bodylimit`), so the 5MB rule is
+// checked on a body that was never allowed to grow much bigger. JSON escaping can double the
+// size of the content, and the rest of the request needs a little room.
+const maxCommentBodyBytes = 2*maxCommentSize + 64<<10
+
 // AddComment creates a new comment.
 // Corresponds to Rust's `add_comment` function.
 // This is the detailed instruction manual for the "AddComment" job.
-func (s *commentServiceImpl) AddComment(params NewCommentRequest, userID int32) (*Comment, error) {
+func (s *commentServiceImpl) AddComment(ctx context.Context, params NewCommentRequest, userID int32) (_ *Comment, err error) {
+	ctx, span := s.tracer.Start(ctx, "CommentService.AddComment")
+	defer func() { tracing.End(span, err) }()
 	// Imagine we're doing several steps to add a comment, like writing on a form,
 	// then putting it in an envelope, then mailing it.
 	// A "transaction" (`tx`) means all these steps must succeed. If any step fails,
 	// it's like we crumple up the form and throw it away – nothing gets saved (rolled back).
 	// Database transactions ensure atomicity.
-	ctx := context.Background()
-	// `s.db.Begin(ctx)` starts a new database transaction.
-	tx, err := s.db.Begin(ctx) // Start of the "all or nothing" process.
-	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %w", err) // Problem starting? Can't do anything.
-	}
-
-	// The `defer` statement schedules a function call to be run when the surrounding function (`AddComment`) returns.
-	// This is commonly used for cleanup tasks like closing resources or, in this case, handling transaction commit/rollback.
-	// This `defer` block is like a special instruction: "No matter what happens in this function
-	// (even if it crashes or finishes normally), do this cleanup stuff at the very end."
-	defer func() {
-		// `recover()` is used to regain control of a panicking goroutine.
-		// If a panic occurs within `AddComment`, this `defer` function will execute, and `recover()` will catch the panic.
-		if p := recover(); p != nil { // `recover` is for catching unexpected crashes (panics).
-			_ = tx.Rollback(ctx) // If we crashed, undo everything (crumple the form).
-			panic(p)          // Then, let the crash continue so we know something went very wrong.
-		} else if err != nil { // If `err` is not nil, it means a known error happened.
-			// `tx.Rollback(ctx)` discards all changes made during the transaction.
-			_ = tx.Rollback(ctx) // A known error also means we undo everything.
-		} else { // If no crash and no known error...
-			err = tx.Commit(ctx) // ...then we try to save everything permanently (mail the envelope).
-			// If even saving fails, `err` will catch that problem.
-		}
-	}() // This cleanup runs when we exit AddComment.
+	// `db.WithTx` starts a new database transaction, runs our steps inside it, and then either
+	// commits them all or, if a step returned an error (or even crashed), rolls them all back.
+	var createdComment *Comment
+	err = db.WithTx(ctx, s.db, func(tx pgx.Tx) error { // Start of the "all or nothing" process.
+		var err error
+
+		var threadID int32 // A "thread" is like a conversation topic. We need to find or create one.
+
+		// Scenario 1: Is this comment a reply to another comment?
+		if params.ParentID != nil && *params.ParentID > 0 {
+			// If yes, find the conversation topic (threadID) of the comment it's replying to.
+			// `tx.QueryRow` executes a query expected to return at most one row.
+			var parentAuthorID int32
+			err = tx.QueryRow(ctx, "SELECT threadid, userid FROM comments WHERE commentid = $1", params.ParentID).Scan(&threadID, &parentAuthorID)
+			if err != nil {
+				// Couldn't find the parent comment's conversation? That's a problem.
+				return fmt.Errorf("failed to get thread ID from parent comment: %w", err)
+			}
+			// If the parent's author has blocked us, we're not allowed to reply to them.
+			// (Muting only hides content for the muter; it doesn't stop replies.)
+			var blocked bool
+			err = tx.QueryRow(ctx, `
+				SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2 AND kind = 'block')`,
+				parentAuthorID, userID).Scan(&blocked)
+			if err != nil {
+				return fmt.Errorf("failed to check block list: %w", err)
+			}
+			if blocked {
+				return apperror.NewUnauthorizedError("you cannot reply to this user", nil)
+			}
+		// Scenario 2: Is this a brand new comment, not tied to any specific Lojban word, definition, etc.?
+		// (i.e., a "free-standing" comment starting its own new topic)
+		} else if (params.ValsiID == nil || *params.ValsiID == 0) &&
+			(params.NatlangWordID == nil || *params.NatlangWordID == 0) &&
+			(params.DefinitionID == nil || *params.DefinitionID == 0) {
+			// If yes, create a brand new, generic conversation topic.
+			err = tx.QueryRow(ctx, `
+				INSERT INTO threads (valsiid, natlangwordid, definitionid)
+				VALUES (0, 0, 0) /* 0 means not specific to any item */
+				RETURNING threadid`).Scan(&threadID) // Get the ID of the new topic.
+			if err != nil {
+				return fmt.Errorf("failed to create new free thread: %w", err)
+			}
+		// Scenario 3: This comment is about a specific Lojban word (Valsi), or a definition, etc.
+		} else {
+			// We need to find if there's already a conversation topic for this specific item.
+			var valsiIDParam, natlangWordIDParam, definitionIDParam sql.NullInt32
+			// `sql.NullInt32` (and similar types like `sql.NullString`) are used to handle nullable database columns.
+			// They have a `Valid` boolean field indicating if the value is non-null.
+			// These `sql.NullInt32` are special because the item IDs might be missing (nil).
+			// If an ID is missing, we treat it as 0 for finding the thread.
+			if params.ValsiID != nil {
+				valsiIDParam = sql.NullInt32{Int32: *params.ValsiID, Valid: true}
+			} else {
+		           valsiIDParam = sql.NullInt32{Int32: 0, Valid: true} // Match 0 if NULL
+		       }
+			if params.NatlangWordID != nil {
+				natlangWordIDParam = sql.NullInt32{Int32: *params.NatlangWordID, Valid: true}
+			} else {
+		           natlangWordIDParam = sql.NullInt32{Int32: 0, Valid: true} // Match 0 if NULL
+		       }
+			if params.DefinitionID != nil {
+				definitionIDParam = sql.NullInt32{Int32: *params.DefinitionID, Valid: true}
+			}
 
-	var threadID int32 // A "thread" is like a conversation topic. We need to find or create one.
+			// Try to find an existing conversation topic that matches all the provided IDs (or 0 if an ID is missing).
+			err = tx.QueryRow(ctx, `
+				SELECT threadid FROM threads
+				WHERE (valsiid = $1 OR ($1 IS NULL AND valsiid = 0))
+				AND (natlangwordid = $2 OR ($2 IS NULL AND natlangwordid = 0))
+				AND (definitionid = $3 OR $3 IS NULL)`,
+				valsiIDParam, natlangWordIDParam, definitionIDParam).Scan(&threadID)
+
+			// `pgx.ErrNoRows` (or `sql.ErrNoRows` with `database/sql`) indicates that the query returned no results.
+			if err == pgx.ErrNoRows { // `pgx.ErrNoRows` means no existing topic was found.
+				// So, we create a new conversation topic for this specific item.
+				var vID, nID, dID int32 // Get the actual IDs, or 0 if they were missing.
+				if params.ValsiID != nil { vID = *params.ValsiID }
+				if params.NatlangWordID != nil { nID = *params.NatlangWordID }
+				if params.DefinitionID != nil { dID = *params.DefinitionID }
+
+				err = tx.QueryRow(ctx, `
+					INSERT INTO threads (valsiid, natlangwordid, definitionid)
+					VALUES ($1, $2, $3)
+					RETURNING threadid`, // Get the ID of this new topic.
+					vID, nID, dID).Scan(&threadID)
+				if err != nil {
+					return fmt.Errorf("failed to create new related thread: %w", err)
+				}
+			} else if err != nil { // Some other error happened while searching.
+				return fmt.Errorf("failed to find existing thread: %w", err)
+			}
+		} // Now we definitely have a `threadID` for our comment.
 
-	// Scenario 1: Is this comment a reply to another comment?
-	if params.ParentID != nil && *params.ParentID > 0 {
-		// If yes, find the conversation topic (threadID) of the comment it's replying to.
-		// `tx.QueryRow` executes a query expected to return at most one row.
-		err = tx.QueryRow(ctx, "SELECT threadid FROM comments WHERE commentid = $1", params.ParentID).Scan(&threadID)
-		if err != nil {
-			// Couldn't find the parent comment's conversation? That's a problem.
-			return nil, fmt.Errorf("failed to get thread ID from parent comment: %w", err)
-		}
-	// Scenario 2: Is this a brand new comment, not tied to any specific Lojban word, definition, etc.?
-	// (i.e., a "free-standing" comment starting its own new topic)
-	} else if (params.ValsiID == nil || *params.ValsiID == 0) &&
-		(params.NatlangWordID == nil || *params.NatlangWordID == 0) &&
-		(params.DefinitionID == nil || *params.DefinitionID == 0) {
-		// If yes, create a brand new, generic conversation topic.
+		// Each comment in a thread gets a number (1st comment, 2nd, etc.).
+		// We find the biggest number so far in this thread and add 1.
+		var commentNum int32
 		err = tx.QueryRow(ctx, `
-			INSERT INTO threads (valsiid, natlangwordid, definitionid)
-			VALUES (0, 0, 0) /* 0 means not specific to any item */
-			RETURNING threadid`).Scan(&threadID) // Get the ID of the new topic.
+			SELECT COALESCE(MAX(commentnum), 0) + 1 as next_num
+			FROM comments
+			WHERE threadid = $1`, threadID).Scan(&commentNum)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create new free thread: %w", err)
-		}
-	// Scenario 3: This comment is about a specific Lojban word (Valsi), or a definition, etc.
-	} else {
-		// We need to find if there's already a conversation topic for this specific item.
-		var valsiIDParam, natlangWordIDParam, definitionIDParam sql.NullInt32
-		// `sql.NullInt32` (and similar types like `sql.NullString`) are used to handle nullable database columns.
-		// They have a `Valid` boolean field indicating if the value is non-null.
-		// These `sql.NullInt32` are special because the item IDs might be missing (nil).
-		// If an ID is missing, we treat it as 0 for finding the thread.
-		if params.ValsiID != nil {
-			valsiIDParam = sql.NullInt32{Int32: *params.ValsiID, Valid: true}
-		} else {
-	           valsiIDParam = sql.NullInt32{Int32: 0, Valid: true} // Match 0 if NULL
-	       }
-		if params.NatlangWordID != nil {
-			natlangWordIDParam = sql.NullInt32{Int32: *params.NatlangWordID, Valid: true}
-		} else {
-	           natlangWordIDParam = sql.NullInt32{Int32: 0, Valid: true} // Match 0 if NULL
-	       }
-		if params.DefinitionID != nil {
-			definitionIDParam = sql.NullInt32{Int32: *params.DefinitionID, Valid: true}
+			return fmt.Errorf("failed to get next comment number: %w", err)
 		}
 
-		// Try to find an existing conversation topic that matches all the provided IDs (or 0 if an ID is missing).
-		err = tx.QueryRow(ctx, `
-			SELECT threadid FROM threads
-			WHERE (valsiid = $1 OR ($1 IS NULL AND valsiid = 0))
-			AND (natlangwordid = $2 OR ($2 IS NULL AND natlangwordid = 0))
-			AND (definitionid = $3 OR $3 IS NULL)`,
-			valsiIDParam, natlangWordIDParam, definitionIDParam).Scan(&threadID)
-
-		// `pgx.ErrNoRows` (or `sql.ErrNoRows` with `database/sql`) indicates that the query returned no results.
-		if err == pgx.ErrNoRows { // `pgx.ErrNoRows` means no existing topic was found.
-			// So, we create a new conversation topic for this specific item.
-			var vID, nID, dID int32 // Get the actual IDs, or 0 if they were missing.
-			if params.ValsiID != nil { vID = *params.ValsiID }
-			if params.NatlangWordID != nil { nID = *params.NatlangWordID }
-			if params.DefinitionID != nil { dID = *params.DefinitionID }
-
-			err = tx.QueryRow(ctx, `
-				INSERT INTO threads (valsiid, natlangwordid, definitionid)
-				VALUES ($1, $2, $3)
-				RETURNING threadid`, // Get the ID of this new topic.
-				vID, nID, dID).Scan(&threadID)
-			if err != nil {
-				return nil, fmt.Errorf("failed to create new related thread: %w", err)
+		// The comment's content can be made of several parts (text, images, etc.).
+		contentParts := params.Content
+		// This loop cleans up trailing empty text parts from the comment content.
+		// Clean up: if the user added empty text boxes at the end, remove them.
+		for len(contentParts) > 0 {
+			last := contentParts[len(contentParts)-1]
+			if last.Type == "text" && last.Data == "" { // If last part is empty text...
+				contentParts = contentParts[:len(contentParts)-1] // ...chop it off.
+			} else {
+				break // Otherwise, we're done cleaning.
 			}
-		} else if err != nil { // Some other error happened while searching.
-			return nil, fmt.Errorf("failed to find existing thread: %w", err)
 		}
-	} // Now we definitely have a `threadID` for our comment.
-
-	// Each comment in a thread gets a number (1st comment, 2nd, etc.).
-	// We find the biggest number so far in this thread and add 1.
-	var commentNum int32
-	err = tx.QueryRow(ctx, `
-		SELECT COALESCE(MAX(commentnum), 0) + 1 as next_num
-		FROM comments
-		WHERE threadid = $1`, threadID).Scan(&commentNum)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get next comment number: %w", err)
-	}
 
-	// The comment's content can be made of several parts (text, images, etc.).
-	contentParts := params.Content
-	// This loop cleans up trailing empty text parts from the comment content.
-	// Clean up: if the user added empty text boxes at the end, remove them.
-	for len(contentParts) > 0 {
-		last := contentParts[len(contentParts)-1]
-		if last.Type == "text" && last.Data == "" { // If last part is empty text...
-			contentParts = contentParts[:len(contentParts)-1] // ...chop it off.
-		} else {
-			break // Otherwise, we're done cleaning.
+		// Check if the comment is too big (remember the 5MB rule).
+		var totalSize int
+		for _, p := range contentParts { // Add up the size of all content parts.
+			totalSize += len(p.Data)
+		}
+		if totalSize > maxCommentSize {
+			return apperror.NewBadRequestError(fmt.Sprintf("comment content exceeds the maximum size of %dMB", maxCommentSize/(1024*1024)), nil).
+				WithCode(apperror.CodeCommentTooLarge)
 		}
-	}
-
-	// Check if the comment is too big (remember the 5MB rule).
-	var totalSize int
-	for _, p := range contentParts { // Add up the size of all content parts.
-		totalSize += len(p.Data)
-	}
-	if totalSize > maxCommentSize {
-		return nil, fmt.Errorf("comment content exceeds the maximum size of %dMB", maxCommentSize/(1024*1024))
-	}
-
-	// If the user gave a "Subject" for the comment, add it as a special "header" part at the beginning.
-	if params.Subject != "" {
-		contentParts = append([]CommentContent{{Type: "header", Data: params.Subject}}, contentParts...)
-	}
 
-	// Computers store complex things like `contentParts` in a special text format called JSON.
-	// We convert our `contentParts` into this JSON text.
-	// `json.Marshal` serializes a Go data structure into a JSON byte slice.
-	contentJSON, jsonErr := json.Marshal(contentParts)
-	if jsonErr != nil {
-		return nil, fmt.Errorf("failed to marshal content to JSON: %w", jsonErr)
-	}
+		// If the user gave a "Subject" for the comment, add it as a special "header" part at the beginning.
+		if params.Subject != "" {
+			contentParts = append([]CommentContent{{Type: "header", Data: params.Subject}}, contentParts...)
+		}
 
-	// Now, we're ready to save the main comment information into the database!
-	// Now, we're ready to save the main comment information into the database!
-	// The `RETURNING commentid` clause in SQL allows us to get the ID of the newly inserted row.
-	// `Scan` is used to read this returned ID into the `commentID` variable.
-	var commentID int32 // This will be the unique ID for our new comment.
-	err = tx.QueryRow(ctx, `
-		INSERT INTO comments (threadid, parentid, userid, commentnum, time, subject, content)
-		VALUES ($1, $2, $3, $4, $5, $6, $7) /* $1, $2... are placeholders for our values */
-		RETURNING commentid`, // Tell the database to give us back the ID of the new comment.
-		threadID, params.ParentID, userID, commentNum, time.Now().Unix(), params.Subject, contentJSON).Scan(&commentID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert comment: %w", err)
-	} // Our comment is now in the `comments` table!
-
-	// --- Hashtags ---
-	// If the comment has #hashtags, we need to find them and save them.
-	// `strings.Builder` is an efficient way to build strings incrementally.
-	var allTextContent strings.Builder // We'll put all text parts of the comment together here.
-	for _, part := range params.Content { // Look at the original content parts from the user.
-		if part.Type == "text" { // If it's a text part...
-			allTextContent.WriteString(part.Data) // ...add its text.
-			allTextContent.WriteString(" ")       // Add a space, just in case.
+		// Computers store complex things like `contentParts` in a special text format called JSON.
+		// We convert our `contentParts` into this JSON text.
+		// `json.Marshal` serializes a Go data structure into a JSON byte slice.
+		contentJSON, jsonErr := json.Marshal(contentParts)
+		if jsonErr != nil {
+			return fmt.Errorf("failed to marshal content to JSON: %w", jsonErr)
 		}
-	}
-	// `ExtractHashtags` is a helper function (defined in `models.go`) to parse hashtags from text.
-	hashtags := ExtractHashtags(allTextContent.String()) // A helper function finds all #words.
-
-	for tag := range hashtags { // For each #hashtag found...
-		var hashtagID int32
-		// Try to add it to our list of all known hashtags.
-		// If it's already there (`ON CONFLICT`), just make sure it's up-to-date.
-		// Then get its unique ID.
-		// `ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag` is an "upsert" operation in PostgreSQL.
+
+		// Now, we're ready to save the main comment information into the database!
+		// Now, we're ready to save the main comment information into the database!
+		// The `RETURNING commentid` clause in SQL allows us to get the ID of the newly inserted row.
+		// `Scan` is used to read this returned ID into the `commentID` variable.
+		var commentID int32 // This will be the unique ID for our new comment.
 		err = tx.QueryRow(ctx, `
-			INSERT INTO hashtags (tag)
-			VALUES ($1)
-			ON CONFLICT (tag) DO UPDATE
-			SET tag = EXCLUDED.tag /* This ensures the casing or something could be updated if needed */
-			RETURNING id`, tag).Scan(&hashtagID)
+			INSERT INTO comments (threadid, parentid, userid, commentnum, time, subject, content)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) /* $1, $2... are placeholders for our values */
+			RETURNING commentid`, // Tell the database to give us back the ID of the new comment.
+			threadID, params.ParentID, userID, commentNum, time.Now().Unix(), params.Subject, contentJSON).Scan(&commentID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to insert/get hashtag ID for tag '%s': %w", tag, err)
+			return fmt.Errorf("failed to insert comment: %w", err)
+		} // Our comment is now in the `comments` table!
+
+		// --- Hashtags ---
+		// If the comment has #hashtags, we need to find them and save them.
+		// `strings.Builder` is an efficient way to build strings incrementally.
+		var allTextContent strings.Builder // We'll put all text parts of the comment together here.
+		for _, part := range params.Content { // Look at the original content parts from the user.
+			if part.Type == "text" { // If it's a text part...
+				allTextContent.WriteString(part.Data) // ...add its text.
+				allTextContent.WriteString(" ")       // Add a space, just in case.
+			}
 		}
+		// `ExtractHashtags` is a helper function (defined in `models.go`) to parse hashtags from text.
+		hashtags := ExtractHashtags(allTextContent.String()) // A helper function finds all #words.
+
+		for tag := range hashtags { // For each #hashtag found...
+			var hashtagID int32
+			// Try to add it to our list of all known hashtags.
+			// If it's already there (`ON CONFLICT`), just make sure it's up-to-date.
+			// Then get its unique ID.
+			// `ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag` is an "upsert" operation in PostgreSQL.
+			err = tx.QueryRow(ctx, `
+				INSERT INTO hashtags (tag)
+				VALUES ($1)
+				ON CONFLICT (tag) DO UPDATE
+				SET tag = EXCLUDED.tag /* This ensures the casing or something could be updated if needed */
+				RETURNING id`, tag).Scan(&hashtagID)
+			if err != nil {
+				return fmt.Errorf("failed to insert/get hashtag ID for tag '%s': %w", tag, err)
+			}
 
-		// Now, link this comment to this hashtag in a separate table (`post_hashtags`).
-		// If they are already linked (`ON CONFLICT`), do nothing.
-		// `tx.Exec` is used for queries that don't return rows (like INSERT, UPDATE, DELETE without RETURNING).
-		var cmdTag pgconn.CommandTag
-		cmdTag, err = tx.Exec(ctx, `
-			INSERT INTO post_hashtags (post_id, hashtag_id)
-			VALUES ($1, $2)
-			ON CONFLICT (post_id, hashtag_id) DO NOTHING`, commentID, hashtagID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to link hashtag to comment: %w", err)
-		}
-		_ = cmdTag // Avoid unused variable error if not checking rows affected
-	} // All hashtags are now processed.
-
-	// --- Comment Counters ---
-	// We keep track of how many reactions and replies each comment has.
-	// For our new comment, initialize these counts to zero.
-	_, err = tx.Exec(ctx, `
-		INSERT INTO comment_counters (comment_id, total_reactions, total_replies)
-		VALUES ($1, 0, 0)
-		ON CONFLICT (comment_id) DO NOTHING`, commentID) // If counters already exist (shouldn't for new comment), do nothing.
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize comment counters: %w", err)
-	}
+			// Now, link this comment to this hashtag in a separate table (`post_hashtags`).
+			// If they are already linked (`ON CONFLICT`), do nothing.
+			// `tx.Exec` is used for queries that don't return rows (like INSERT, UPDATE, DELETE without RETURNING).
+			var cmdTag pgconn.CommandTag
+			cmdTag, err = tx.Exec(ctx, `
+				INSERT INTO post_hashtags (post_id, hashtag_id)
+				VALUES ($1, $2)
+				ON CONFLICT (post_id, hashtag_id) DO NOTHING`, commentID, hashtagID)
+			if err != nil {
+				return fmt.Errorf("failed to link hashtag to comment: %w", err)
+			}
+			// A new link means one more comment uses this hashtag; keep its cached count in step.
+			// (The counter reconciliation service in `background` repairs the count if it drifts.)
+			if cmdTag.RowsAffected() == 1 {
+				_, err = tx.Exec(ctx, `UPDATE hashtags SET usage_count = usage_count + 1 WHERE id = $1`, hashtagID)
+				if err != nil {
+					return fmt.Errorf("failed to update hashtag usage count: %w", err)
+				}
+			}
+		} // All hashtags are now processed.
 
-	// If our new comment was a reply to a parent comment...
-	if params.ParentID != nil && *params.ParentID > 0 {
-		// ...we need to increase the `total_replies` count for that parent comment.
+		// --- Comment Counters ---
+		// We keep track of how many reactions and replies each comment has.
+		// For our new comment, initialize these counts to zero.
 		_, err = tx.Exec(ctx, `
 			INSERT INTO comment_counters (comment_id, total_reactions, total_replies)
-			VALUES ($1, 0, 1) /* Try to insert with 1 reply */
-			ON CONFLICT (comment_id) DO UPDATE /* If parent already has counters, update it */
-			SET total_replies = comment_counters.total_replies + 1`, *params.ParentID)
+			VALUES ($1, 0, 0)
+			ON CONFLICT (comment_id) DO NOTHING`, commentID) // If counters already exist (shouldn't for new comment), do nothing.
 		if err != nil {
-			return nil, fmt.Errorf("failed to update parent comment reply count: %w", err)
+			return fmt.Errorf("failed to initialize comment counters: %w", err)
 		}
-	}
 
-	// --- Prepare the full comment to send back to the user ---
-	// We just saved the basic comment. Now, get all its details (like username, reactions, etc.)
-	// so we can show the complete, newly created comment to the user.
-	// Calling an internal helper method that uses the same transaction `tx`.
-	createdComment, err := s.getCommentByIDInternal(ctx, tx, commentID, &userID) // `getCommentByIDInternal` is a helper for this.
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch newly created comment: %w", err)
-	}
+		// If our new comment was a reply to a parent comment...
+		if params.ParentID != nil && *params.ParentID > 0 {
+			// ...we need to increase the `total_replies` count for that parent comment.
+			_, err = tx.Exec(ctx, `
+				INSERT INTO comment_counters (comment_id, total_reactions, total_replies)
+				VALUES ($1, 0, 1) /* Try to insert with 1 reply */
+				ON CONFLICT (comment_id) DO UPDATE /* If parent already has counters, update it */
+				SET total_replies = comment_counters.total_replies + 1`, *params.ParentID)
+			if err != nil {
+				return fmt.Errorf("failed to update parent comment reply count: %w", err)
+			}
+		}
 
-	// --- Notifications ---
-	// If the comment is about a Lojban word (Valsi), we might need to tell people who are
-	// "subscribed" to that word that there's a new comment.
-	var valsiWord sql.NullString          // To store the Lojban word itself (e.g., "broda").
-	var valsiIDForNotification sql.NullInt32 // To store the ID of that Lojban word.
-
-	// Only try to get valsi info if the comment is actually linked to a valsi.
-	   if params.ValsiID != nil && *params.ValsiID > 0 {
-		// Get the word and its ID from the database, based on the thread and valsi ID.
-	       err = tx.QueryRow(ctx, `
-	           SELECT v.word, v.valsiid
-	           FROM threads t
-	           JOIN valsi v ON t.valsiid = v.valsiid
-	           WHERE t.threadid = $1 AND v.valsiid = $2`, threadID, *params.ValsiID).Scan(&valsiWord, &valsiIDForNotification)
-	       
-	       if err != nil && err != pgx.ErrNoRows { // If an error happened (but not "not found")...
-	           log.Printf("Error fetching valsi for notification (threadID: %d, valsiID: %d): %v", threadID, *params.ValsiID, err)
-	           // This might not be a critical error, so we just log it and continue.
-	       } else if err == pgx.ErrNoRows { // If no valsi was found for this thread/valsi_id combo.
-	            log.Printf("No valsi found for notification (threadID: %d, valsiID: %d)", threadID, *params.ValsiID)
-	       }
-	   }
+		// --- Prepare the full comment to send back to the user ---
+		// We just saved the basic comment. Now, get all its details (like username, reactions, etc.)
+		// so we can show the complete, newly created comment to the user.
+		// Calling an internal helper method that uses the same transaction `tx`.
+		createdComment, err = s.getCommentByIDInternal(ctx, tx, commentID, &userID) // `getCommentByIDInternal` is a helper for this.
+		if err != nil {
+			return fmt.Errorf("failed to fetch newly created comment: %w", err)
+		}
 
+		// --- Notifications ---
+		// Subscribers of the Lojban word (Valsi), the author of the parent comment and anyone
+		// @mentioned should hear about the new comment. Telling them all can take a while for a
+		// popular word, so we only write down "this comment happened" as a job, inside our
+		// transaction, and a background worker does the telling (see the `notifications` package).
+		event := notifications.CommentEvent{
+			CommentID: commentID,
+			ThreadID:  threadID,
+			AuthorID:  userID,
+			Mentions:  notifications.ExtractMentions(allTextContent.String()),
+		}
+		if params.ParentID != nil && *params.ParentID > 0 {
+			event.ParentID = params.ParentID
+		}
+
+		// Only try to get valsi info if the comment is actually linked to a valsi.
+		if params.ValsiID != nil && *params.ValsiID > 0 {
+			var valsiWord string
+			var valsiID int32
+			// Get the word and its ID from the database, based on the thread and valsi ID.
+			err = tx.QueryRow(ctx, `
+				SELECT v.word, v.valsiid
+				FROM threads t
+				JOIN valsi v ON t.valsiid = v.valsiid
+				WHERE t.threadid = $1 AND v.valsiid = $2`, threadID, *params.ValsiID).Scan(&valsiWord, &valsiID)
+			if err != nil && err != pgx.ErrNoRows {
+				return fmt.Errorf("failed to fetch valsi for notification: %w", err)
+			} else if err == nil {
+				event.ValsiID = &valsiID
+				event.ValsiWord = valsiWord
+			}
+		}
 
-	// If we successfully got the Lojban word and its ID...
-	if valsiWord.Valid && valsiIDForNotification.Valid {
 		// `os.Getenv` reads an environment variable, used here for frontend URL configuration.
-		frontendURL := os.Getenv("FRONTEND_URL") // Get the website's main address (e.g., "https://lensisku.com").
-		if frontendURL == "" {
-			log.Println("FRONTEND_URL environment variable not set, skipping notification URL generation.")
-		} else {
+		if frontendURL := os.Getenv("FRONTEND_URL"); frontendURL == "" {
+			s.logger.Debug("FRONTEND_URL environment variable not set, skipping notification URL generation")
+		} else if event.ValsiID != nil {
 			var defID int32 // If the comment is also about a specific definition.
 			if params.DefinitionID != nil {
 				defID = *params.DefinitionID
 			}
 			// Create a direct link to this new comment on the website.
-			notificationURL := fmt.Sprintf("%s/comments?valsi_id=%d&definition_id=%d", frontendURL, valsiIDForNotification.Int32, defID)
-			
-			// Tell the database to send out notifications to subscribers of this Lojban word.
-			_, err = tx.Exec(ctx, `SELECT notify_valsi_subscribers($1, 'comment', $2, $3, $4)`,
-				valsiIDForNotification.Int32, // The ID of the Lojban word.
-				fmt.Sprintf("New comment on thread for %s", valsiWord.String), // Message for the notification.
-				notificationURL, // Link to the comment.
-				userID,          // Who posted the comment (so they don't get notified about their own comment).
-			)
-			if err != nil { // If sending notifications failed...
-				log.Printf("Error sending notification for valsi_id %d: %v", valsiIDForNotification.Int32, err)
-				// Again, just log it. The comment was still added successfully.
-			}
+			event.Link = fmt.Sprintf("%s/comments?valsi_id=%d&definition_id=%d", frontendURL, *event.ValsiID, defID)
+		} else {
+			event.Link = fmt.Sprintf("%s/comments?thread_id=%d&scroll_to=%d", frontendURL, threadID, commentID)
 		}
-	}
 
-	// Phew! Everything is done. The `defer` function at the top will now try to `Commit` all these changes.
-	// If `Commit` is successful, `err` will be `nil`. If `Commit` fails, `err` will have that error.
-	return createdComment, nil // Return the fully formed comment and any error from Commit (or earlier).
+		if err = notifications.EnqueueCommentEvent(ctx, s.queue, tx, event); err != nil {
+			return fmt.Errorf("failed to queue comment notifications: %w", err)
+		}
+		// Phew! Everything is done. Returning nil tells `db.WithTx` to `Commit` all these changes.
+		return nil
+	})
+	if err != nil {
+		return nil, err // Any error, including a failed `Commit`, means nothing was saved.
+	}
+	return createdComment, nil // Return the fully formed comment.
 }
 
 
@@ -422,7 +458,12 @@ func (s *commentServiceImpl) getCommentByIDInternal(ctx context.Context, tx pgx.
 			c.subject,
 			c.content AS content_json, /* Get the raw JSON content */
 			u.username,
-			u.realname,
+			CASE /* Respect the author's privacy setting for their real name (see users/privacy.go) */
+				WHEN COALESCE(u.field_visibility->>'realname', 'public') = 'public' THEN u.realname
+				WHEN u.field_visibility->>'realname' = 'users' AND $2::int IS NOT NULL THEN u.realname
+				WHEN u.userid = $2 THEN u.realname
+				ELSE NULL
+			END AS realname,
 			COALESCE(cc.total_reactions, 0) as total_reactions, /* How many reactions in total? Default to 0 */
 			COALESCE(cc.total_replies, 0) as total_replies,     /* How many replies? Default to 0 */
 			CASE WHEN cl.user_id IS NOT NULL THEN true ELSE false END as is_liked,      /* Did the current user like this? */
@@ -525,7 +566,7 @@ func (s *commentServiceImpl) getCommentByIDInternal(ctx context.Context, tx pgx.
 	       if err == nil { // If found...
 	           finalComment.ValsiWord = &valsiWord // ...add it to our `finalComment`.
 	       } else if err != pgx.ErrNoRows { // If some other error (not "not found")...
-	           log.Printf("Error fetching valsi word for valsi_id %d: %v", *finalComment.ValsiID, err)
+	           s.logger.Error("Error fetching valsi word", "valsi_id", *finalComment.ValsiID, "error", err)
 	       }
 	   }
 
@@ -537,7 +578,7 @@ func (s *commentServiceImpl) getCommentByIDInternal(ctx context.Context, tx pgx.
 	       if err == nil { // If found...
 	           finalComment.Definition = &definitionText // ...add it to our `finalComment`.
 	       } else if err != pgx.ErrNoRows { // If some other error...
-	           log.Printf("Error fetching definition for definition_id %d: %v", *finalComment.DefinitionID, err)
+	           s.logger.Error("Error fetching definition", "definition_id", *finalComment.DefinitionID, "error", err)
 	       }
 	   }
 
@@ -628,7 +669,7 @@ func (s *commentServiceImpl) fetchReactionsInternal(ctx context.Context, tx pgx.
 // Placeholder for other CommentService methods
 // These methods are part of the `CommentService` interface but are not yet implemented.
 // These methods are part of the `CommentService` interface but are not yet implemented.
-func (s *commentServiceImpl) GetThreadComments(params ThreadQuery, currentUserID *int32) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) GetThreadComments(params ThreadQuery, currentUserID *int32) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetThreadComments not implemented")
 }
@@ -642,15 +683,15 @@ func (s *commentServiceImpl) ToggleBookmark(commentID int32, userID int32, bookm
 	// TODO: Implement
 	return fmt.Errorf("ToggleBookmark not implemented")
 }
-func (s *commentServiceImpl) GetBookmarkedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) GetBookmarkedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetBookmarkedComments not implemented")
 }
-func (s *commentServiceImpl) GetLikedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) GetLikedComments(userID int32, page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetLikedComments not implemented")
 }
-func (s *commentServiceImpl) GetUserComments(userID int32, page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) GetUserComments(userID int32, page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetUserComments not implemented")
 }
@@ -666,23 +707,15 @@ func (s *commentServiceImpl) GetCommentOpinions(commentID int32, userID *int32)
 	// TODO: Implement
 	return nil, fmt.Errorf("GetCommentOpinions not implemented")
 }
-func (s *commentServiceImpl) GetTrendingComments(timespan TrendingTimespan, currentUserID *int32, limit int32) ([]Comment, error) {
-	// TODO: Implement
-	return nil, fmt.Errorf("GetTrendingComments not implemented")
-}
 func (s *commentServiceImpl) GetCommentStats(commentID int32) (*CommentStats, error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetCommentStats not implemented")
 }
-func (s *commentServiceImpl) GetMostBookmarkedComments(page int64, perPage int64, currentUserID *int32) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) GetMostBookmarkedComments(page int64, perPage int64, currentUserID *int32) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetMostBookmarkedComments not implemented")
 }
-func (s *commentServiceImpl) GetTrendingHashtags(timespan TrendingTimespan, limit int32) ([]TrendingHashtag, error) {
-	// TODO: Implement
-	return nil, fmt.Errorf("GetTrendingHashtags not implemented")
-}
-func (s *commentServiceImpl) GetCommentsByHashtag(tag string, userID *int32, page *int64, perPage *int64) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) GetCommentsByHashtag(tag string, userID *int32, page *int64, perPage *int64) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetCommentsByHashtag not implemented")
 }
@@ -694,11 +727,11 @@ func (s *commentServiceImpl) ToggleReaction(commentID int32, userID int32, react
 	// TODO: Implement
 	return false, fmt.Errorf("ToggleReaction not implemented")
 }
-func (s *commentServiceImpl) SearchComments(params SearchCommentsQuery, currentUserID *int32) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) SearchComments(params SearchCommentsQuery, currentUserID *int32) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("SearchComments not implemented")
 }
-func (s *commentServiceImpl) GetMyReactions(userID int32, page int64, perPage int64) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) GetMyReactions(userID int32, page int64, perPage int64) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("GetMyReactions not implemented")
 }
@@ -706,11 +739,11 @@ func (s *commentServiceImpl) GetReactions(commentID int32, currentUserID *int32,
 	// TODO: Implement
 	return nil, fmt.Errorf("GetReactions not implemented")
 }
-func (s *commentServiceImpl) ListThreads(page int64, perPage int64, sortBy string, sortOrder string) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) ListThreads(page int64, perPage int64, sortBy string, sortOrder string) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("ListThreads not implemented")
 }
-func (s *commentServiceImpl) ListComments(page int64, perPage int64, sortOrder string, currentUserID *int32) (*PaginatedCommentsResponse, error) {
+func (s *commentServiceImpl) ListComments(page int64, perPage int64, sortOrder string, currentUserID *int32) (*validation.Page[Comment], error) {
 	// TODO: Implement
 	return nil, fmt.Errorf("ListComments not implemented")
 }
@@ -0,0 +1,139 @@
+// Package comments, as part of the comments module.
+// This file, `trending.go`, lists the trending comments and hashtags of a timespan. Both are
+// aggregates over many rows and the same for every viewer, so they are cached (see
+// `cache/cache.go`): the hashtag list as it is, and the trending comments as a list of IDs,
+// which are then loaded with the viewer's own reactions and bookmarks.
+package comments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/db"
+)
+
+// since returns the Unix time the timespan starts at, or nil for AllTime.
+func (t TrendingTimespan) since(now time.Time) (*int64, error) {
+	var d time.Duration
+	switch t {
+	case LastDay:
+		d = 24 * time.Hour
+	case LastWeek:
+		d = 7 * 24 * time.Hour
+	case LastMonth:
+		d = 30 * 24 * time.Hour
+	case LastYear:
+		d = 365 * 24 * time.Hour
+	case AllTime:
+		return nil, nil
+	default:
+		return nil, apperror.NewValidationError(fmt.Sprintf("unknown timespan %q", t), nil)
+	}
+	since := now.Add(-d).Unix()
+	return &since, nil
+}
+
+// GetTrendingComments returns the comments of the timespan with the most activity: reactions,
+// plus replies, which count twice. Authors the current user blocked or muted are left out, as
+// are comments deleted since the list was cached, so the list may be shorter than `limit`.
+func (s *commentServiceImpl) GetTrendingComments(ctx context.Context, timespan TrendingTimespan, currentUserID *int32, limit int32) ([]Comment, error) {
+	since, err := timespan.since(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("comments:%s:%d", timespan, limit)
+	ids, err := cache.GetOrCompute(ctx, s.trending, key, func(ctx context.Context) ([]int32, error) {
+		rows, err := s.db.Query(ctx, `
+			SELECT c.commentid
+			FROM comments c
+			LEFT JOIN comment_counters cc ON cc.comment_id = c.commentid
+			WHERE $1::bigint IS NULL OR c.time >= $1
+			ORDER BY COALESCE(cc.total_reactions, 0) + 2 * COALESCE(cc.total_replies, 0) DESC,
+			         c.time DESC, c.commentid DESC
+			LIMIT $2`, since, limit)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to list trending comments", err)
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read trending comment", err)
+		}
+		return ids, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []Comment
+	err = db.WithTxOptions(ctx, s.db, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		blocked := map[int32]bool{}
+		if currentUserID != nil {
+			rows, err := tx.Query(ctx, `SELECT blocked_id FROM user_blocks WHERE blocker_id = $1`, *currentUserID)
+			if err != nil {
+				return apperror.NewDatabaseError("failed to list blocked users", err)
+			}
+			blockedIDs, err := pgx.CollectRows(rows, pgx.RowTo[int32])
+			if err != nil {
+				return apperror.NewDatabaseError("failed to read blocked user", err)
+			}
+			for _, id := range blockedIDs {
+				blocked[id] = true
+			}
+		}
+
+		// The IDs may be cached from before some of the comments were deleted; those are skipped.
+		loaded, err := s.loadCommentsInternal(ctx, tx, ids, currentUserID)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load trending comments", err)
+		}
+		comments = make([]Comment, 0, len(loaded))
+		for _, comment := range loaded {
+			if !blocked[comment.UserID] {
+				comments = append(comments, comment)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// GetTrendingHashtags returns the hashtags used by the most comments of the timespan.
+func (s *commentServiceImpl) GetTrendingHashtags(ctx context.Context, timespan TrendingTimespan, limit int32) ([]TrendingHashtag, error) {
+	since, err := timespan.since(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("hashtags:%s:%d", timespan, limit)
+	return cache.GetOrCompute(ctx, s.trending, key, func(ctx context.Context) ([]TrendingHashtag, error) {
+		rows, err := s.db.Query(ctx, `
+			SELECT h.tag, COUNT(*), to_timestamp(MAX(c.time))
+			FROM post_hashtags ph
+			JOIN hashtags h ON h.id = ph.hashtag_id
+			JOIN comments c ON c.commentid = ph.post_id
+			WHERE $1::bigint IS NULL OR c.time >= $1
+			GROUP BY h.tag
+			ORDER BY COUNT(*) DESC, MAX(c.time) DESC, h.tag
+			LIMIT $2`, since, limit)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to list trending hashtags", err)
+		}
+		hashtags := []TrendingHashtag{}
+		var h TrendingHashtag
+		_, err = pgx.ForEachRow(rows, []any{&h.Tag, &h.UsageCount, &h.LastUsed}, func() error {
+			hashtags = append(hashtags, h)
+			return nil
+		})
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read trending hashtag", err)
+		}
+		return hashtags, nil
+	})
+}
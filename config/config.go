@@ -1,6 +1,8 @@
 // Package config provides configuration management for the lensisku application.
 // It handles loading and validation of configuration values from environment variables,
 // with support for required variables, default values, and collective error reporting.
+// The same settings may also come from a YAML file named by CONFIG_FILE (see `file.go`),
+// which the environment overrides.
 // This is a crucial part of any application, allowing it to be configured for different
 // environments (dev, staging, prod) without code changes.
 // In Nest.js, the `@nestjs/config` module serves a similar purpose, often integrating
@@ -9,6 +11,9 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
 	// `os` package provides operating system functionalities, like reading environment variables.
 	"os"
 	"strconv"
@@ -21,6 +26,29 @@ import (
 type DatabasePools struct {
 	AppPool    *PoolConfig
 	ImportPool *PoolConfig
+
+	// Read replicas of the app database, as DSNs. Reads that tolerate replication lag go to a
+	// healthy one, and to the primary when none is.
+	ReplicaDSNs          []string
+	ReplicaPoolSize      int           // Connections per replica
+	ReplicaMaxLag        time.Duration // A replica further behind than this is skipped
+	ReplicaCheckInterval time.Duration // How often replicas are checked
+
+	// How often the pool statistics published as metrics are sampled.
+	PoolStatsInterval time.Duration
+
+	// StartDegraded starts the server even if the database can't be reached, retrying in the
+	// background with waits growing up to ConnectRetryMaxInterval.
+	StartDegraded           bool
+	ConnectRetryMaxInterval time.Duration
+
+	// QueryBudget is how much database time a request may take before it is logged as slow,
+	// with its slowest statements; 0 turns the log off.
+	QueryBudget time.Duration
+
+	// LogQueries logs every statement with its duration and row count. Meant for debugging:
+	// it is verbose, and argument values are only partly shown (see `db/tracer.go`).
+	LogQueries bool
 }
 
 // PoolConfig represents configuration for a single database connection pool.
@@ -32,33 +60,338 @@ type PoolConfig struct {
 	Password string
 	DBName   string
 	MaxSize  int
+
+	// TLS settings, with the meaning of the libpq parameters of the same names. Certificates
+	// are file paths; a client certificate needs its key.
+	SSLMode     string // disable, allow, prefer, require, verify-ca or verify-full
+	SSLRootCert string // CA certificate used to verify the server (verify-ca and verify-full)
+	SSLCert     string // Client certificate, for certificate authentication
+	SSLKey      string
+
+	// Set on every connection of the pool, so a runaway query or a transaction left open can't
+	// hold a connection forever. Zero disables the timeout.
+	StatementTimeout         time.Duration // Longest a single statement may run
+	IdleInTransactionTimeout time.Duration // Longest a transaction may sit idle between statements
 }
 
 // AuthConfig holds authentication-related configuration.
 type AuthConfig struct {
 	JWTSecret            string        // Secret key for signing JWTs
 	AccessTokenDuration  time.Duration // Duration for access tokens
-	RefreshTokenDuration time.Duration // Duration for refresh tokens
+	RefreshTokenDuration time.Duration // Duration for refresh tokens issued with "remember me"
+	// SessionRefreshTokenDuration is the shorter refresh token lifetime used when "remember me" is not set.
+	SessionRefreshTokenDuration time.Duration
+	// SudoTokenDuration is the lifetime of step-up ("sudo") tokens obtained by re-entering the password.
+	SudoTokenDuration time.Duration
+	// InviteOnly requires a valid invite code at registration when enabled.
+	InviteOnly bool
+	// InviteDefaultMaxUses is used when an invite is created without an explicit use limit.
+	InviteDefaultMaxUses int
+	// Backends lists the authentication backends tried at login, in order (e.g. "ldap", "local").
+	Backends []string
+	// LDAP is only populated when "ldap" is one of the configured backends.
+	LDAP *LDAPConfig
+	// Cookies is only populated when AUTH_COOKIE_SESSIONS is enabled.
+	Cookies *SessionCookieConfig
+}
+
+// SessionCookieConfig holds settings for cookie sessions, the alternative to bearer tokens for
+// the web frontend: the tokens are kept in HttpOnly cookies, and changing requests must repeat
+// a CSRF token in a header.
+type SessionCookieConfig struct {
+	Domain   string // Domain attribute of the cookies; empty for the API's own host
+	Secure   bool   // Only send the cookies over HTTPS
+	SameSite string // "lax", "strict" or "none"
+}
+
+// LDAPConfig holds settings for authenticating users against an LDAP directory.
+// The service account (BindDN) is used to look the user up; the user's own DN and
+// password are then used for the actual authentication bind.
+type LDAPConfig struct {
+	URL               string        // e.g. "ldaps://ldap.example.org:636"
+	BindDN            string        // Service account DN used for searching
+	BindPassword      string        // Service account password
+	BaseDN            string        // Search base for user entries
+	UserFilter        string        // Filter with a single %s placeholder for the login, e.g. "(uid=%s)"
+	UsernameAttribute string        // Attribute used as the local username
+	EmailAttribute    string        // Attribute used as the local email address
+	StartTLS          bool          // Upgrade a plain ldap:// connection with StartTLS
+	Timeout           time.Duration // Dial and operation timeout
 }
 
 // ServerConfig holds server-related configuration.
 // For settings like the HTTP server port.
 type ServerConfig struct {
-	Port string // Port for the HTTP server
+	Port          string // Port for the HTTP server
+	BindAddress   string // Interface to listen on; empty for all interfaces
+	MetricsAddr   string // Address of a separate server for /metrics; empty serves it on the main one
+	PublicBaseURL string // Externally visible base URL, used for links in emails
+	CORS          *CORSConfig
+	TLS           *TLSConfig
+
+	ReadTimeout       time.Duration // Time to read a whole request, body included
+	ReadHeaderTimeout time.Duration // Time to read the request headers
+	WriteTimeout      time.Duration // Time to write a response; event streams lift it
+	IdleTimeout       time.Duration // How long an idle keep-alive connection stays open
+	RequestTimeout    time.Duration // Deadline of a handler's context, except for event streams; 0 disables it
+	MaxBodyBytes      int64         // Largest request body, except on the routes below and uploads
+	MaxAuthBodyBytes  int64         // Largest body of login, registration and token refresh
+	MaxImportBytes    int64         // Largest dictionary import upload
+
+	// Checking of requests and responses against the OpenAPI spec (see the `openapi` package):
+	// APIValidationOff, APIValidationLog or APIValidationEnforce.
+	APIValidation string
+}
+
+// Modes accepted in OPENAPI_VALIDATION.
+const (
+	APIValidationOff     = "off"     // Not checked
+	APIValidationLog     = "log"     // Mismatches are logged and counted
+	APIValidationEnforce = "enforce" // Invalid requests are also rejected with 400
+)
+
+// TLSConfig lets the server terminate TLS itself, for deployments without a proxy in front.
+// Over TLS, the server speaks HTTP/2 as well as HTTP/1.1.
+type TLSConfig struct {
+	CertFile         string   // PEM certificate chain; with KeyFile, serves TLS with a fixed certificate
+	KeyFile          string   // PEM private key of CertFile
+	AutocertDomains  []string // Domains to get Let's Encrypt certificates for, instead of CertFile
+	AutocertCacheDir string   // Where the certificates and the ACME account key are kept
+	AutocertEmail    string   // Contact address of the ACME account; optional
+	RedirectAddr     string   // Address of a plain HTTP server redirecting to HTTPS, e.g. ":80"; empty for none
+}
+
+// Enabled reports whether the server listens with TLS.
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != "" || len(c.AutocertDomains) > 0
+}
+
+// CORSConfig holds the Cross-Origin Resource Sharing policy of the API.
+type CORSConfig struct {
+	AllowedOrigins   []string      // "*", exact origins, or wildcard subdomains such as "https://*.lojban.org"
+	AllowedMethods   []string      // Methods allowed in cross-origin requests
+	AllowedHeaders   []string      // Request headers allowed in cross-origin requests
+	AllowCredentials bool          // Whether browsers may send cookies and HTTP authentication
+	MaxAge           time.Duration // How long browsers may cache a preflight response
+}
+
+// StorageConfig holds settings for the file storage used by uploads such as avatars.
+type StorageConfig struct {
+	Backend        string // Storage implementation; currently only "local"
+	LocalDir       string // Directory for the "local" backend
+	PublicBaseURL  string // URL prefix under which stored files are reachable
+	MaxAvatarBytes int64  // Upper bound for an uploaded avatar image
+}
+
+// UsersConfig holds settings for the user profile module.
+type UsersConfig struct {
+	UsernameChangeCooldown time.Duration // Minimum time between two username changes of the same account
+	UsernameReuseHold      time.Duration // How long an abandoned username stays reserved for its previous owner
+	// PreferenceDefaults overrides built-in preference defaults, keyed by preference name
+	// (e.g. "locale"). Only keys whose environment variable is set are present.
+	PreferenceDefaults map[string]string
+	StatsCacheTTL      time.Duration // How long computed user statistics are served from memory (0 disables caching)
+}
+
+// EmailConfig holds settings for outgoing email. When SMTPHost is empty, emails are
+// written to the log instead of being sent, which is convenient in development.
+type EmailConfig struct {
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FromAddress  string        // e.g. "Lensisku <noreply@lojban.org>"
+	TLSMode      string        // One of the SMTPTLS* modes
+	Timeout      time.Duration // Limit for connecting to the server and delivering one message
+	TemplateDir  string        // Directory with templates overriding the built-in ones; empty for none
+	CheckOnStart bool          // Connect and authenticate at startup, and refuse to start if that fails
+}
+
+// TLS modes accepted in SMTP_TLS_MODE.
+const (
+	SMTPTLSOpportunistic = "opportunistic" // STARTTLS when the server offers it
+	SMTPTLSStartTLS      = "starttls"      // STARTTLS, failing if the server doesn't offer it
+	SMTPTLSImplicit      = "tls"           // TLS from the start, usually on port 465
+	SMTPTLSNone          = "none"          // Plain text; only for a local relay
+)
+
+// DigestConfig holds settings for the periodic activity digest emails.
+type DigestConfig struct {
+	Enabled       bool          // Whether the digest scheduler runs at all
+	Interval      time.Duration // Minimum time between two digests for the same user
+	CheckInterval time.Duration // How often the scheduler looks for users who are due
+	BatchSize     int           // Users loaded per scheduler query
+}
+
+// WebPushConfig holds the settings of Web Push delivery (see the `webpush` package). The VAPID
+// keys identify this server to the browsers' push services; generate a pair once, e.g. with
+// `npx web-push generate-vapid-keys`, and keep it, since subscriptions are bound to the public key.
+type WebPushConfig struct {
+	VAPIDPublicKey  string        // Uncompressed P-256 public key, base64url
+	VAPIDPrivateKey string        // P-256 private key, base64url
+	Subject         string        // Contact for push services, a mailto: or https: URL
+	TTL             time.Duration // How long push services keep an undelivered message; older notifications aren't pushed
+	PollInterval    time.Duration // How often new notifications are looked for
+	Timeout         time.Duration // Limit for delivering one message to a push service
+}
+
+// QuotaConfig holds settings for per-caller API quotas.
+type QuotaConfig struct {
+	DailyLimit int // Requests an authenticated caller may make per UTC day (0 = unlimited, usage is still counted)
+}
+
+// AdminConfig holds the policies of the /admin routes, stricter than those of the rest of the API.
+type AdminConfig struct {
+	RateLimit  int           // Requests an admin may make per RateWindow (0 = unlimited)
+	RateWindow time.Duration // Window the rate limit counts requests in
+}
+
+// Embedding providers accepted in EMBEDDING_PROVIDER.
+const (
+	EmbeddingProviderNone   = "none"
+	EmbeddingProviderOpenAI = "openai"
+	EmbeddingProviderOllama = "ollama"
+)
+
+// Limits for the embedding calculator's worker pool and tick interval. They apply to the
+// environment variables and to runtime changes made through the admin API alike.
+const (
+	MaxEmbeddingWorkers      = 64
+	MinEmbeddingTickInterval = time.Second
+)
+
+// EmbeddingConfig selects and configures the embedding provider used by the background
+// embedding calculator. With provider "none" the calculator doesn't run.
+type EmbeddingConfig struct {
+	Provider     string        // "none", "openai" (any OpenAI-compatible server) or "ollama"
+	BaseURL      string        // API root, e.g. "https://api.openai.com/v1" or "http://localhost:11434"
+	APIKey       string        // Sent as a bearer token; required for api.openai.com
+	Model        string        // Embedding model name
+	BatchSize    int           // Texts per provider request
+	Timeout      time.Duration // Per-request timeout
+	Workers      int           // Processor workers computing embeddings concurrently
+	TickInterval time.Duration // How often the calculator looks for definitions without embeddings
+
+	// Limits for paid APIs; 0 disables each of them.
+	RateLimit            int     // Provider requests per minute
+	DailyTokenBudget     int64   // Tokens per UTC day
+	DailyCostBudget      float64 // USD per UTC day, converted to tokens with CostPerMillionTokens
+	CostPerMillionTokens float64 // Provider price in USD, used to report spend
+}
+
+// JobsConfig holds settings for the background job queue workers.
+type JobsConfig struct {
+	Workers      int           // Jobs processed concurrently by this instance
+	PollInterval time.Duration // How long an idle worker waits before looking for new jobs
+}
+
+// ExportConfig holds settings for dictionary dumps.
+type ExportConfig struct {
+	Dir       string        // Directory the dump files are written to; it must not be publicly served
+	LinkTTL   time.Duration // How long a signed download link stays valid
+	Retention time.Duration // How long a finished dump is kept before its file is deleted
+}
+
+// EventsConfig selects how Server-Sent Events reach clients connected to other instances.
+type EventsConfig struct {
+	Backend string // "memory" for a single instance, "postgres" to relay events through LISTEN/NOTIFY, "redis" through Redis Pub/Sub
+	Channel string // Postgres notification channel; all instances must use the same one
+}
+
+// RedisConfig holds the settings of the shared Redis client. Redis is optional: with an empty
+// URL the features that can use it fall back to Postgres or to memory.
+type RedisConfig struct {
+	URL            string        // e.g. "redis://:password@localhost:6379/0"; "rediss://" for TLS
+	PoolSize       int           // Connections per instance
+	MinIdleConns   int           // Connections kept open while idle
+	DialTimeout    time.Duration // Timeout for opening a connection
+	CommandTimeout time.Duration // Read and write timeout of a command
+	KeyPrefix      string        // Prepended to every key, so several deployments can share a server
+}
+
+// CacheConfig holds how long computed results are cached (see `cache/cache.go`). They are kept
+// in Redis when REDIS_URL is set, otherwise in the memory of each instance. A TTL of 0 disables
+// that cache.
+type CacheConfig struct {
+	TrendingTTL     time.Duration // Trending comments and hashtags
+	WordOfTheDayTTL time.Duration // The word of the day
+	ProfileTTL      time.Duration // Public profiles looked up by username
+	FlagsTTL        time.Duration // Feature flags; a change reaches other instances after at most this long without Redis
+}
+
+// PartitionsConfig holds settings for the monthly partitions of comments and reactions.
+type PartitionsConfig struct {
+	Ahead     int // Months after the current one whose partitions are created in advance
+	Retention int // Months of partitions kept attached; older ones are detached. 0 keeps them all
+}
+
+// Formats accepted in LOG_FORMAT.
+const (
+	LogFormatText = "text" // key=value lines, for a terminal
+	LogFormatJSON = "json" // One JSON object per line, for a log collector
+)
+
+// LogConfig holds the settings of the application logger (see the `logging` package).
+type LogConfig struct {
+	Level     slog.Level // Records below this level are dropped
+	Format    string     // LogFormatText or LogFormatJSON
+	AddSource bool       // Add the source file and line of each record
+
+	// Routes whose requests are logged in detail, with their headers and body samples (see
+	// `logging/details.go`); a pattern ending in "*" selects the routes under it. Empty: none.
+	RequestDetailRoutes []string
+	RequestBodySample   int // Bytes of each request and response body kept in the details
+}
+
+// ErrorReportingConfig holds the settings of the error reporting to Sentry or a compatible
+// service (see the `errreport` package). Reporting is off when DSN is empty.
+type ErrorReportingConfig struct {
+	DSN         string        // e.g. "https://public-key@sentry.example.com/42"
+	Environment string        // Environment the events are tagged with
+	Release     string        // Release the events are tagged with, if set
+	Timeout     time.Duration // Timeout for sending one event
+}
+
+// TracingConfig holds the settings of the OpenTelemetry tracing (see the `tracing` package).
+// Tracing is off when Endpoint is empty.
+type TracingConfig struct {
+	Endpoint    string            // Base URL of an OTLP/HTTP collector, e.g. "http://tempo:4318"
+	Headers     map[string]string // Sent with every export, e.g. an API key
+	ServiceName string            // service.name of the spans
+	SampleRatio float64           // Share of the traces started here that are kept, from 0 to 1
 }
 
 // AppConfig is the top-level configuration structure for the application.
 type AppConfig struct {
-	DBPools *DatabasePools
-	Auth    *AuthConfig
-	Server  *ServerConfig
+	Env            string // Environment profile from APP_ENV: "dev", "staging" or "prod"
+	Log            *LogConfig
+	ErrorReporting *ErrorReportingConfig
+	Tracing        *TracingConfig
+	DBPools        *DatabasePools
+	Auth           *AuthConfig
+	Server         *ServerConfig
+	Storage        *StorageConfig
+	Users          *UsersConfig
+	Email          *EmailConfig
+	Digest         *DigestConfig
+	Quota          *QuotaConfig
+	Admin          *AdminConfig
+	Embedding      *EmbeddingConfig
+	Jobs           *JobsConfig
+	Export         *ExportConfig
+	Events         *EventsConfig
+	Redis          *RedisConfig
+	Cache          *CacheConfig
+	Partitions     *PartitionsConfig
+	// WebPush is only populated when the VAPID keys are set.
+	WebPush *WebPushConfig
 }
 
 // Helper function to get a required environment variable.
 // Appends an error to the errors slice if the variable is not set.
 // This promotes a "fail fast" approach for critical missing configurations.
 func getRequiredEnv(key string, errors *[]string) string {
-	value, exists := os.LookupEnv(key)
+	value, exists := lookupEnv(key)
 	if !exists {
 		*errors = append(*errors, fmt.Sprintf("missing required environment variable: %s", key))
 		return "" // Return empty string, error is collected
@@ -69,7 +402,7 @@ func getRequiredEnv(key string, errors *[]string) string {
 // Helper function to get an optional environment variable with a default string value.
 // Provides sensible defaults if an optional configuration is not explicitly set.
 func getOptionalEnv(key string, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := lookupEnv(key); exists {
 		return value
 	}
 	return defaultValue
@@ -79,7 +412,7 @@ func getOptionalEnv(key string, defaultValue string) string {
 // Uses defaultValue if not set or if parsing fails. Appends an error if parsing fails.
 // Includes type conversion and error handling.
 func getOptionalEnvInt(key string, defaultValue int, errors *[]string) int {
-	valueStr, exists := os.LookupEnv(key)
+	valueStr, exists := lookupEnv(key)
 	if !exists {
 		return defaultValue
 	}
@@ -91,11 +424,58 @@ func getOptionalEnvInt(key string, defaultValue int, errors *[]string) int {
 	return valueInt
 }
 
+// Helper function to get an optional comma-separated environment variable as a slice of strings.
+// Entries are trimmed and empty entries are dropped.
+func getOptionalEnvList(key string, defaultValue []string) []string {
+	valueStr, exists := lookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	var values []string
+	for _, part := range strings.Split(valueStr, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	return values
+}
+
+// Helper function to get an optional environment variable parsed as a bool.
+// Accepts the values understood by `strconv.ParseBool` ("1", "t", "true", "0", "f", "false", ...).
+// Uses defaultValue if not set or if parsing fails. Appends an error if parsing fails.
+func getOptionalEnvBool(key string, defaultValue bool, errors *[]string) bool {
+	valueStr, exists := lookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	valueBool, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		*errors = append(*errors, fmt.Sprintf("invalid value for %s: expected boolean, got '%s': %v", key, valueStr, err))
+		return defaultValue // Return default, error is collected
+	}
+	return valueBool
+}
+
+// Helper function to get an optional environment variable parsed as a float64.
+// Uses defaultValue if not set or if parsing fails. Appends an error if parsing fails.
+func getOptionalEnvFloat(key string, defaultValue float64, errors *[]string) float64 {
+	valueStr, exists := lookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	valueFloat, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		*errors = append(*errors, fmt.Sprintf("invalid value for %s: expected number, got '%s': %v", key, valueStr, err))
+		return defaultValue // Return default, error is collected
+	}
+	return valueFloat
+}
+
 // Helper function to get an optional environment variable parsed as time.Duration.
 // Uses defaultValue if not set or if parsing fails. Appends an error if parsing fails.
 // `time.ParseDuration` expects a string like "15m", "1h30s".
 func getOptionalEnvDuration(key string, defaultValue time.Duration, errors *[]string) time.Duration {
-	valueStr, exists := os.LookupEnv(key)
+	valueStr, exists := lookupEnv(key)
 	if !exists {
 		return defaultValue
 	}
@@ -140,6 +520,22 @@ func LoadConfig() (*AppConfig, error) {
 	// `errors` slice collects all validation/parsing errors during config loading.
 	var errors []string
 
+	// Settings missing from the environment fall back to the optional configuration file.
+	// A file that can't be read is fatal: starting with half of the intended settings would
+	// be worse than not starting.
+	fileValues = nil
+	if path, ok := os.LookupEnv("CONFIG_FILE"); ok && path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fileValues = values
+	}
+	loadSecrets(&errors)
+
+	// Environment profile: it picks the defaults of some of the settings below.
+	env, profile := loadProfile(&errors)
+
 	// Database Configuration
 	// Load individual database settings using the helper functions.
 	dbUser := getRequiredEnv("DB_USER", &errors)
@@ -148,6 +544,28 @@ func LoadConfig() (*AppConfig, error) {
 	dbHost := getOptionalEnv("DB_HOST", "localhost")
 	dbPort := getOptionalEnvInt("DB_PORT", 5432, &errors)
 
+	// TLS for database connections. Production deployments should use verify-full.
+	dbSSLMode := getOptionalEnv("DB_SSLMODE", profile.SSLMode)
+	dbSSLRootCert := getOptionalEnv("DB_SSLROOTCERT", "")
+	dbSSLCert := getOptionalEnv("DB_SSLCERT", "")
+	dbSSLKey := getOptionalEnv("DB_SSLKEY", "")
+	switch dbSSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errors = append(errors, fmt.Sprintf("DB_SSLMODE must be one of disable, allow, prefer, require, verify-ca, verify-full, got %q", dbSSLMode))
+	}
+	if (dbSSLCert == "") != (dbSSLKey == "") {
+		errors = append(errors, "DB_SSLCERT and DB_SSLKEY must be set together")
+	}
+	for _, f := range [][2]string{{"DB_SSLROOTCERT", dbSSLRootCert}, {"DB_SSLCERT", dbSSLCert}, {"DB_SSLKEY", dbSSLKey}} {
+		if f[1] == "" {
+			continue
+		}
+		if _, err := os.Stat(f[1]); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", f[0], err))
+		}
+	}
+
 	dbAppPoolSizeStr := getRequiredEnv("DB_APP_POOL_SIZE", &errors)
 	dbImportPoolSizeStr := getRequiredEnv("DB_IMPORT_POOL_SIZE", &errors)
 
@@ -166,6 +584,52 @@ func LoadConfig() (*AppConfig, error) {
 		importPoolSize = 5 // Default to min clamp
 	}
 
+	replicaDSNs := getOptionalEnvList("DB_REPLICA_URLS", nil)
+	replicaPoolSize := appPoolSize
+	if v := getOptionalEnv("DB_REPLICA_POOL_SIZE", ""); v != "" {
+		replicaPoolSize = parseAndValidatePoolSize(v, "DB_REPLICA_POOL_SIZE", &errors)
+	}
+	replicaMaxLag := getOptionalEnvDuration("DB_REPLICA_MAX_LAG", 10*time.Second, &errors)
+	replicaCheckInterval := getOptionalEnvDuration("DB_REPLICA_CHECK_INTERVAL", 5*time.Second, &errors)
+	if replicaMaxLag <= 0 {
+		errors = append(errors, "DB_REPLICA_MAX_LAG must be positive")
+	}
+	if replicaCheckInterval <= 0 {
+		errors = append(errors, "DB_REPLICA_CHECK_INTERVAL must be positive")
+	}
+	// Imports run long statements in big transactions, so their pool only guards against
+	// transactions left idle.
+	appStatementTimeout := getOptionalEnvDuration("DB_APP_STATEMENT_TIMEOUT", 30*time.Second, &errors)
+	appIdleInTxTimeout := getOptionalEnvDuration("DB_APP_IDLE_IN_TRANSACTION_TIMEOUT", time.Minute, &errors)
+	importStatementTimeout := getOptionalEnvDuration("DB_IMPORT_STATEMENT_TIMEOUT", 0, &errors)
+	importIdleInTxTimeout := getOptionalEnvDuration("DB_IMPORT_IDLE_IN_TRANSACTION_TIMEOUT", 10*time.Minute, &errors)
+	for _, t := range []struct {
+		name    string
+		timeout time.Duration
+	}{
+		{"DB_APP_STATEMENT_TIMEOUT", appStatementTimeout},
+		{"DB_APP_IDLE_IN_TRANSACTION_TIMEOUT", appIdleInTxTimeout},
+		{"DB_IMPORT_STATEMENT_TIMEOUT", importStatementTimeout},
+		{"DB_IMPORT_IDLE_IN_TRANSACTION_TIMEOUT", importIdleInTxTimeout},
+	} {
+		if t.timeout < 0 {
+			errors = append(errors, fmt.Sprintf("%s must not be negative", t.name))
+		}
+	}
+
+	poolStatsInterval := getOptionalEnvDuration("DB_POOL_STATS_INTERVAL", 15*time.Second, &errors)
+	if poolStatsInterval <= 0 {
+		errors = append(errors, "DB_POOL_STATS_INTERVAL must be positive")
+	}
+	connectRetryMaxInterval := getOptionalEnvDuration("DB_CONNECT_RETRY_MAX_INTERVAL", 30*time.Second, &errors)
+	if connectRetryMaxInterval <= 0 {
+		errors = append(errors, "DB_CONNECT_RETRY_MAX_INTERVAL must be positive")
+	}
+	queryBudget := getOptionalEnvDuration("DB_REQUEST_QUERY_BUDGET", 500*time.Millisecond, &errors)
+	if queryBudget < 0 {
+		errors = append(errors, "DB_REQUEST_QUERY_BUDGET must not be negative")
+	}
+
 	// Populate the DatabasePools struct.
 	dbPools := &DatabasePools{
 		AppPool: &PoolConfig{
@@ -175,6 +639,14 @@ func LoadConfig() (*AppConfig, error) {
 			Password: dbPassword,
 			DBName:   dbName,
 			MaxSize:  appPoolSize,
+
+			SSLMode:     dbSSLMode,
+			SSLRootCert: dbSSLRootCert,
+			SSLCert:     dbSSLCert,
+			SSLKey:      dbSSLKey,
+
+			StatementTimeout:         appStatementTimeout,
+			IdleInTransactionTimeout: appIdleInTxTimeout,
 		},
 		ImportPool: &PoolConfig{
 			Host:     dbHost,
@@ -183,37 +655,629 @@ func LoadConfig() (*AppConfig, error) {
 			Password: dbPassword,
 			DBName:   dbName,
 			MaxSize:  importPoolSize,
+
+			SSLMode:     dbSSLMode,
+			SSLRootCert: dbSSLRootCert,
+			SSLCert:     dbSSLCert,
+			SSLKey:      dbSSLKey,
+
+			StatementTimeout:         importStatementTimeout,
+			IdleInTransactionTimeout: importIdleInTxTimeout,
 		},
+		ReplicaDSNs:          replicaDSNs,
+		ReplicaPoolSize:      replicaPoolSize,
+		ReplicaMaxLag:        replicaMaxLag,
+		ReplicaCheckInterval: replicaCheckInterval,
+		LogQueries:           getOptionalEnvBool("DB_LOG_QUERIES", profile.LogQueries, &errors),
+		PoolStatsInterval:    poolStatsInterval,
+
+		StartDegraded:           getOptionalEnvBool("DB_START_DEGRADED", false, &errors),
+		ConnectRetryMaxInterval: connectRetryMaxInterval,
+
+		QueryBudget: queryBudget,
 	}
 
 	// Auth Configuration
 	jwtSecret := getRequiredEnv("JWT_SECRET", &errors)
 	accessTokenDuration := getOptionalEnvDuration("JWT_ACCESS_TOKEN_DURATION", 15*time.Minute, &errors)
 	refreshTokenDuration := getOptionalEnvDuration("JWT_REFRESH_TOKEN_DURATION", 168*time.Hour, &errors) // 7 days
+	sessionRefreshTokenDuration := getOptionalEnvDuration("JWT_SESSION_REFRESH_TOKEN_DURATION", 12*time.Hour, &errors)
+	if sessionRefreshTokenDuration > refreshTokenDuration {
+		errors = append(errors, fmt.Sprintf("JWT_SESSION_REFRESH_TOKEN_DURATION (%s) must not exceed JWT_REFRESH_TOKEN_DURATION (%s)", sessionRefreshTokenDuration, refreshTokenDuration))
+	}
+	sudoTokenDuration := getOptionalEnvDuration("JWT_SUDO_TOKEN_DURATION", 5*time.Minute, &errors)
+	inviteOnly := getOptionalEnvBool("AUTH_INVITE_ONLY", false, &errors)
+	inviteDefaultMaxUses := getOptionalEnvInt("AUTH_INVITE_DEFAULT_MAX_USES", 1, &errors)
+	if inviteDefaultMaxUses < 1 {
+		errors = append(errors, fmt.Sprintf("AUTH_INVITE_DEFAULT_MAX_USES must be at least 1, got %d", inviteDefaultMaxUses))
+	}
+
+	authBackends := getOptionalEnvList("AUTH_BACKENDS", []string{"local"})
+	var ldapConfig *LDAPConfig
+	for _, backend := range authBackends {
+		switch backend {
+		case "local":
+		case "ldap":
+			ldapConfig = loadLDAPConfig(&errors)
+		default:
+			errors = append(errors, fmt.Sprintf("unknown authentication backend in AUTH_BACKENDS: %s", backend))
+		}
+	}
+	if len(authBackends) == 0 {
+		errors = append(errors, "AUTH_BACKENDS must list at least one backend")
+	}
 
 	// Populate the AuthConfig struct.
 	authConfig := &AuthConfig{
-		JWTSecret:            jwtSecret,
-		AccessTokenDuration:  accessTokenDuration,
-		RefreshTokenDuration: refreshTokenDuration,
+		JWTSecret:                   jwtSecret,
+		AccessTokenDuration:         accessTokenDuration,
+		RefreshTokenDuration:        refreshTokenDuration,
+		SessionRefreshTokenDuration: sessionRefreshTokenDuration,
+		SudoTokenDuration:           sudoTokenDuration,
+		InviteOnly:                  inviteOnly,
+		InviteDefaultMaxUses:        inviteDefaultMaxUses,
+		Backends:                    authBackends,
+		LDAP:                        ldapConfig,
 	}
 
 	// Server Configuration
 	serverPort := getOptionalEnv("PORT", "8080")
+	publicBaseURL := strings.TrimRight(getOptionalEnv("PUBLIC_BASE_URL", "http://localhost:"+serverPort), "/")
+	// Outside development, only the site itself may call the API unless more origins are listed.
+	defaultOrigins := []string{"*"}
+	if !profile.AllowAnyOrigin {
+		if u, err := url.Parse(publicBaseURL); err == nil && u.Host != "" {
+			defaultOrigins = []string{u.Scheme + "://" + u.Host}
+		}
+	}
 	serverConfig := &ServerConfig{
 		// Note: Server port is typically a string because it's used directly in `net.Listen` (e.g., ":8080").
-		Port: serverPort,
+		Port:          serverPort,
+		PublicBaseURL: publicBaseURL,
+		CORS:          loadCORSConfig(defaultOrigins, &errors),
+		TLS:           loadTLSConfig(&errors),
+
+		BindAddress:       getOptionalEnv("HTTP_BIND_ADDRESS", ""),
+		MetricsAddr:       getOptionalEnv("METRICS_ADDR", ""),
+		ReadTimeout:       getOptionalEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second, &errors),
+		ReadHeaderTimeout: getOptionalEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second, &errors),
+		WriteTimeout:      getOptionalEnvDuration("HTTP_WRITE_TIMEOUT", 15*time.Second, &errors),
+		IdleTimeout:       getOptionalEnvDuration("HTTP_IDLE_TIMEOUT", 60*time.Second, &errors),
+		RequestTimeout:    getOptionalEnvDuration("HTTP_REQUEST_TIMEOUT", 60*time.Second, &errors),
+		MaxBodyBytes:      int64(getOptionalEnvInt("HTTP_MAX_BODY_BYTES", 1<<20, &errors)),
+		MaxAuthBodyBytes:  int64(getOptionalEnvInt("HTTP_MAX_AUTH_BODY_BYTES", 16<<10, &errors)),
+		MaxImportBytes:    int64(getOptionalEnvInt("HTTP_MAX_IMPORT_BYTES", 256<<20, &errors)),
+		APIValidation:     strings.ToLower(getOptionalEnv("OPENAPI_VALIDATION", profile.APIValidation)),
+	}
+	if serverConfig.ReadTimeout <= 0 || serverConfig.ReadHeaderTimeout <= 0 || serverConfig.WriteTimeout <= 0 || serverConfig.IdleTimeout <= 0 {
+		errors = append(errors, "HTTP_READ_TIMEOUT, HTTP_READ_HEADER_TIMEOUT, HTTP_WRITE_TIMEOUT and HTTP_IDLE_TIMEOUT must be positive")
+	}
+	if serverConfig.RequestTimeout < 0 {
+		errors = append(errors, "HTTP_REQUEST_TIMEOUT must not be negative")
+	}
+	if serverConfig.MaxBodyBytes <= 0 || serverConfig.MaxAuthBodyBytes <= 0 || serverConfig.MaxImportBytes <= 0 {
+		errors = append(errors, "HTTP_MAX_BODY_BYTES, HTTP_MAX_AUTH_BODY_BYTES and HTTP_MAX_IMPORT_BYTES must be positive")
+	}
+	switch serverConfig.APIValidation {
+	case APIValidationOff, APIValidationLog, APIValidationEnforce:
+	default:
+		errors = append(errors, fmt.Sprintf("OPENAPI_VALIDATION must be off, log or enforce, got %q", serverConfig.APIValidation))
+	}
+	if getOptionalEnvBool("AUTH_COOKIE_SESSIONS", false, &errors) {
+		authConfig.Cookies = loadSessionCookieConfig(publicBaseURL, &errors)
+	}
+
+	// Storage Configuration
+	storageConfig := &StorageConfig{
+		Backend:        getOptionalEnv("STORAGE_BACKEND", "local"),
+		LocalDir:       getOptionalEnv("STORAGE_LOCAL_DIR", "./uploads"),
+		PublicBaseURL:  getOptionalEnv("STORAGE_PUBLIC_BASE_URL", "/uploads"),
+		MaxAvatarBytes: int64(getOptionalEnvInt("AVATAR_MAX_UPLOAD_BYTES", 5<<20, &errors)),
+	}
+	if storageConfig.Backend != "local" {
+		errors = append(errors, fmt.Sprintf("unknown storage backend in STORAGE_BACKEND: %s", storageConfig.Backend))
+	}
+	if storageConfig.MaxAvatarBytes <= 0 {
+		errors = append(errors, fmt.Sprintf("AVATAR_MAX_UPLOAD_BYTES must be positive, got %d", storageConfig.MaxAvatarBytes))
+	}
+
+	// Users Configuration
+	usersConfig := &UsersConfig{
+		UsernameChangeCooldown: getOptionalEnvDuration("USERNAME_CHANGE_COOLDOWN", 30*24*time.Hour, &errors),
+		UsernameReuseHold:      getOptionalEnvDuration("USERNAME_REUSE_HOLD", 180*24*time.Hour, &errors),
+		PreferenceDefaults:     make(map[string]string),
+		StatsCacheTTL:          getOptionalEnvDuration("USER_STATS_CACHE_TTL", time.Minute, &errors),
+	}
+	// Values are validated against the preference schema by the users module.
+	for envKey, prefKey := range map[string]string{
+		"PREF_DEFAULT_LOCALE":       "locale",
+		"PREF_DEFAULT_TIMEZONE":     "timezone",
+		"PREF_DEFAULT_THEME":        "theme",
+		"PREF_DEFAULT_COMMENT_SORT": "default_comment_sort",
+		"PREF_DEFAULT_DIGEST":       "digest_frequency",
+	} {
+		if value, ok := lookupEnv(envKey); ok && value != "" {
+			usersConfig.PreferenceDefaults[prefKey] = value
+		}
+	}
+
+	// Email Configuration
+	emailConfig := &EmailConfig{
+		SMTPHost:     getOptionalEnv("SMTP_HOST", ""),
+		SMTPPort:     getOptionalEnvInt("SMTP_PORT", 587, &errors),
+		SMTPUsername: getOptionalEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getOptionalEnv("SMTP_PASSWORD", ""),
+		FromAddress:  getOptionalEnv("EMAIL_FROM", "Lensisku <noreply@lojban.org>"),
+		Timeout:      getOptionalEnvDuration("SMTP_TIMEOUT", 30*time.Second, &errors),
+		TemplateDir:  getOptionalEnv("EMAIL_TEMPLATE_DIR", ""),
+		CheckOnStart: getOptionalEnvBool("SMTP_CHECK_ON_START", false, &errors),
+	}
+	// Port 465 is the submission port with implicit TLS; the others use STARTTLS.
+	defaultTLSMode := SMTPTLSOpportunistic
+	if emailConfig.SMTPPort == 465 {
+		defaultTLSMode = SMTPTLSImplicit
+	}
+	emailConfig.TLSMode = strings.ToLower(getOptionalEnv("SMTP_TLS_MODE", defaultTLSMode))
+	switch emailConfig.TLSMode {
+	case SMTPTLSOpportunistic, SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		errors = append(errors, fmt.Sprintf("SMTP_TLS_MODE must be one of opportunistic, starttls, tls, none, got %q", emailConfig.TLSMode))
+	}
+	if emailConfig.SMTPPort < 1 || emailConfig.SMTPPort > 65535 {
+		errors = append(errors, fmt.Sprintf("SMTP_PORT must be between 1 and 65535, got %d", emailConfig.SMTPPort))
+	}
+	if emailConfig.Timeout <= 0 {
+		errors = append(errors, "SMTP_TIMEOUT must be positive")
+	}
+	if _, err := mail.ParseAddress(emailConfig.FromAddress); err != nil {
+		errors = append(errors, fmt.Sprintf("EMAIL_FROM is not a valid address: %v", err))
+	}
+	if emailConfig.TemplateDir != "" {
+		if info, err := os.Stat(emailConfig.TemplateDir); err != nil || !info.IsDir() {
+			errors = append(errors, fmt.Sprintf("EMAIL_TEMPLATE_DIR %s is not a readable directory", emailConfig.TemplateDir))
+		}
+	}
+	if emailConfig.CheckOnStart && emailConfig.SMTPHost == "" {
+		errors = append(errors, "SMTP_CHECK_ON_START requires SMTP_HOST")
+	}
+
+	// Digest Configuration
+	digestConfig := &DigestConfig{
+		Enabled:       getOptionalEnvBool("DIGEST_ENABLED", false, &errors),
+		Interval:      getOptionalEnvDuration("DIGEST_INTERVAL", 7*24*time.Hour, &errors),
+		CheckInterval: getOptionalEnvDuration("DIGEST_CHECK_INTERVAL", time.Hour, &errors),
+		BatchSize:     getOptionalEnvInt("DIGEST_BATCH_SIZE", 100, &errors),
+	}
+	if digestConfig.Interval <= 0 || digestConfig.CheckInterval <= 0 {
+		errors = append(errors, "DIGEST_INTERVAL and DIGEST_CHECK_INTERVAL must be positive")
+	}
+	if digestConfig.BatchSize < 1 {
+		errors = append(errors, fmt.Sprintf("DIGEST_BATCH_SIZE must be at least 1, got %d", digestConfig.BatchSize))
+	}
+
+	// Quota Configuration
+	quotaConfig := &QuotaConfig{
+		DailyLimit: getOptionalEnvInt("API_DAILY_QUOTA", 10000, &errors),
+	}
+	if quotaConfig.DailyLimit < 0 {
+		errors = append(errors, fmt.Sprintf("API_DAILY_QUOTA must not be negative, got %d", quotaConfig.DailyLimit))
+	}
+
+	// Admin Route Configuration
+	adminConfig := &AdminConfig{
+		RateLimit:  getOptionalEnvInt("ADMIN_RATE_LIMIT", 60, &errors),
+		RateWindow: getOptionalEnvDuration("ADMIN_RATE_WINDOW", time.Minute, &errors),
+	}
+	if adminConfig.RateLimit < 0 {
+		errors = append(errors, fmt.Sprintf("ADMIN_RATE_LIMIT must not be negative, got %d", adminConfig.RateLimit))
+	}
+	if adminConfig.RateWindow <= 0 {
+		errors = append(errors, "ADMIN_RATE_WINDOW must be positive")
+	}
+
+	// Embedding Configuration
+	embeddingConfig := loadEmbeddingConfig(&errors)
+
+	// Job Queue Configuration
+	jobsConfig := &JobsConfig{
+		Workers:      getOptionalEnvInt("JOBS_WORKERS", 4, &errors),
+		PollInterval: getOptionalEnvDuration("JOBS_POLL_INTERVAL", 2*time.Second, &errors),
+	}
+	if jobsConfig.Workers < 1 {
+		errors = append(errors, fmt.Sprintf("JOBS_WORKERS must be at least 1, got %d", jobsConfig.Workers))
+	}
+	if jobsConfig.PollInterval <= 0 {
+		errors = append(errors, "JOBS_POLL_INTERVAL must be positive")
+	}
+
+	// Dictionary Export Configuration
+	exportConfig := &ExportConfig{
+		Dir:       getOptionalEnv("EXPORT_DIR", "./dumps"),
+		LinkTTL:   getOptionalEnvDuration("EXPORT_LINK_TTL", time.Hour, &errors),
+		Retention: getOptionalEnvDuration("EXPORT_RETENTION", 7*24*time.Hour, &errors),
+	}
+	if exportConfig.LinkTTL <= 0 || exportConfig.Retention <= 0 {
+		errors = append(errors, "EXPORT_LINK_TTL and EXPORT_RETENTION must be positive")
+	}
+
+	// Server-Sent Events Configuration
+	eventsConfig := &EventsConfig{
+		Backend: strings.ToLower(getOptionalEnv("SSE_BACKEND", "memory")),
+		Channel: getOptionalEnv("SSE_CHANNEL", "lensisku_sse"),
+	}
+	if eventsConfig.Backend != "memory" && eventsConfig.Backend != "postgres" && eventsConfig.Backend != "redis" {
+		errors = append(errors, fmt.Sprintf("SSE_BACKEND must be memory, postgres or redis, got %q", eventsConfig.Backend))
+	}
+	if eventsConfig.Channel == "" {
+		errors = append(errors, "SSE_CHANNEL must not be empty")
+	}
+
+	// Redis Configuration
+	redisConfig := &RedisConfig{
+		URL:            getOptionalEnv("REDIS_URL", ""),
+		PoolSize:       getOptionalEnvInt("REDIS_POOL_SIZE", 10, &errors),
+		MinIdleConns:   getOptionalEnvInt("REDIS_MIN_IDLE_CONNS", 2, &errors),
+		DialTimeout:    getOptionalEnvDuration("REDIS_DIAL_TIMEOUT", 5*time.Second, &errors),
+		CommandTimeout: getOptionalEnvDuration("REDIS_COMMAND_TIMEOUT", 3*time.Second, &errors),
+		KeyPrefix:      getOptionalEnv("REDIS_KEY_PREFIX", "lensisku:"),
+	}
+	if redisConfig.URL != "" {
+		if u, err := url.Parse(redisConfig.URL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+			errors = append(errors, "REDIS_URL must be a redis:// or rediss:// URL")
+		}
+	}
+	if redisConfig.PoolSize < 1 || redisConfig.MinIdleConns < 0 || redisConfig.MinIdleConns > redisConfig.PoolSize {
+		errors = append(errors, fmt.Sprintf("REDIS_POOL_SIZE must be at least 1 and REDIS_MIN_IDLE_CONNS between 0 and it, got %d and %d", redisConfig.PoolSize, redisConfig.MinIdleConns))
+	}
+	if redisConfig.DialTimeout <= 0 || redisConfig.CommandTimeout <= 0 {
+		errors = append(errors, "REDIS_DIAL_TIMEOUT and REDIS_COMMAND_TIMEOUT must be positive")
+	}
+	if eventsConfig.Backend == "redis" && redisConfig.URL == "" {
+		errors = append(errors, "SSE_BACKEND=redis requires REDIS_URL")
+	}
+
+	// Cache Configuration
+	cacheConfig := &CacheConfig{
+		TrendingTTL:     getOptionalEnvDuration("CACHE_TRENDING_TTL", 5*time.Minute, &errors),
+		WordOfTheDayTTL: getOptionalEnvDuration("CACHE_WORD_OF_THE_DAY_TTL", time.Hour, &errors),
+		ProfileTTL:      getOptionalEnvDuration("CACHE_PROFILE_TTL", time.Minute, &errors),
+		FlagsTTL:        getOptionalEnvDuration("CACHE_FLAGS_TTL", 30*time.Second, &errors),
+	}
+	if cacheConfig.TrendingTTL < 0 || cacheConfig.WordOfTheDayTTL < 0 || cacheConfig.ProfileTTL < 0 || cacheConfig.FlagsTTL < 0 {
+		errors = append(errors, "CACHE_TRENDING_TTL, CACHE_WORD_OF_THE_DAY_TTL, CACHE_PROFILE_TTL and CACHE_FLAGS_TTL must not be negative")
+	}
+
+	// Comment Partition Configuration
+	partitionsConfig := &PartitionsConfig{
+		Ahead:     getOptionalEnvInt("COMMENT_PARTITIONS_AHEAD", 3, &errors),
+		Retention: getOptionalEnvInt("COMMENT_PARTITIONS_RETENTION_MONTHS", 0, &errors),
+	}
+	if partitionsConfig.Ahead < 1 {
+		errors = append(errors, fmt.Sprintf("COMMENT_PARTITIONS_AHEAD must be at least 1, got %d", partitionsConfig.Ahead))
+	}
+	if partitionsConfig.Retention < 0 {
+		errors = append(errors, fmt.Sprintf("COMMENT_PARTITIONS_RETENTION_MONTHS must not be negative, got %d", partitionsConfig.Retention))
+	}
+
+	cfg := &AppConfig{
+		Env:            env,
+		Log:            loadLogConfig(profile, &errors),
+		ErrorReporting: loadErrorReportingConfig(env, &errors),
+		Tracing:        loadTracingConfig(&errors),
+		DBPools:        dbPools,
+		Auth:           authConfig,
+		Server:         serverConfig,
+		Storage:        storageConfig,
+		Users:          usersConfig,
+		Email:          emailConfig,
+		Digest:         digestConfig,
+		Quota:          quotaConfig,
+		Admin:          adminConfig,
+		Embedding:      embeddingConfig,
+		Jobs:           jobsConfig,
+		Export:         exportConfig,
+		Events:         eventsConfig,
+		Redis:          redisConfig,
+		Cache:          cacheConfig,
+		Partitions:     partitionsConfig,
+		WebPush:        loadWebPushConfig(&errors),
+	}
+	if profile.Strict {
+		checkStrict(cfg, &errors)
 	}
 
 	// If any errors were collected during loading, return a single aggregated error message.
 	if len(errors) > 0 {
 		return nil, fmt.Errorf("configuration errors:\n- %s", strings.Join(errors, "\n- "))
 	}
+	return cfg, nil
+}
+
+// loadLogConfig reads the LOG_* variables. The level is one of debug, info, warn and error.
+func loadLogConfig(p profile, errors *[]string) *LogConfig {
+	cfg := &LogConfig{
+		Format:    strings.ToLower(getOptionalEnv("LOG_FORMAT", p.LogFormat)),
+		AddSource: getOptionalEnvBool("LOG_ADD_SOURCE", false, errors),
+
+		RequestDetailRoutes: getOptionalEnvList("LOG_REQUEST_DETAILS_ROUTES", nil),
+		RequestBodySample:   getOptionalEnvInt("LOG_REQUEST_BODY_SAMPLE", 2048, errors),
+	}
+	level := getOptionalEnv("LOG_LEVEL", p.LogLevel)
+	if err := cfg.Level.UnmarshalText([]byte(level)); err != nil {
+		*errors = append(*errors, fmt.Sprintf("LOG_LEVEL must be one of debug, info, warn, error, got %q", level))
+	}
+	if cfg.Format != LogFormatText && cfg.Format != LogFormatJSON {
+		*errors = append(*errors, fmt.Sprintf("LOG_FORMAT must be text or json, got %q", cfg.Format))
+	}
+	if cfg.RequestBodySample < 0 {
+		*errors = append(*errors, "LOG_REQUEST_BODY_SAMPLE must not be negative")
+	}
+	return cfg
+}
+
+// loadErrorReportingConfig reads the SENTRY_* variables. The DSN must name a project, and
+// carry the public key as the user of the URL.
+func loadErrorReportingConfig(env string, errors *[]string) *ErrorReportingConfig {
+	cfg := &ErrorReportingConfig{
+		DSN:         getOptionalEnv("SENTRY_DSN", ""),
+		Environment: getOptionalEnv("SENTRY_ENVIRONMENT", env),
+		Release:     getOptionalEnv("SENTRY_RELEASE", ""),
+		Timeout:     getOptionalEnvDuration("SENTRY_TIMEOUT", 5*time.Second, errors),
+	}
+	if cfg.DSN != "" {
+		u, err := url.Parse(cfg.DSN)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User.Username() == "" || strings.Trim(u.Path, "/") == "" {
+			*errors = append(*errors, "SENTRY_DSN must be an http(s) URL of the form https://key@host/project")
+		}
+	}
+	if cfg.Timeout <= 0 {
+		*errors = append(*errors, "SENTRY_TIMEOUT must be positive")
+	}
+	return cfg
+}
+
+// loadWebPushConfig reads the WEBPUSH_* variables. Web Push is off, and nil is returned, unless
+// both VAPID keys are set.
+func loadWebPushConfig(errors *[]string) *WebPushConfig {
+	cfg := &WebPushConfig{
+		VAPIDPublicKey:  getOptionalEnv("WEBPUSH_VAPID_PUBLIC_KEY", ""),
+		VAPIDPrivateKey: getOptionalEnv("WEBPUSH_VAPID_PRIVATE_KEY", ""),
+		Subject:         getOptionalEnv("WEBPUSH_SUBJECT", ""),
+		TTL:             getOptionalEnvDuration("WEBPUSH_TTL", 24*time.Hour, errors),
+		PollInterval:    getOptionalEnvDuration("WEBPUSH_POLL_INTERVAL", 5*time.Second, errors),
+		Timeout:         getOptionalEnvDuration("WEBPUSH_TIMEOUT", 10*time.Second, errors),
+	}
+	if cfg.VAPIDPublicKey == "" && cfg.VAPIDPrivateKey == "" {
+		return nil
+	}
+	if cfg.VAPIDPublicKey == "" || cfg.VAPIDPrivateKey == "" {
+		*errors = append(*errors, "WEBPUSH_VAPID_PUBLIC_KEY and WEBPUSH_VAPID_PRIVATE_KEY must be set together")
+	}
+	if !strings.HasPrefix(cfg.Subject, "mailto:") && !strings.HasPrefix(cfg.Subject, "https://") {
+		// Push services use it to reach the operator of a misbehaving server.
+		*errors = append(*errors, fmt.Sprintf("WEBPUSH_SUBJECT must be a mailto: or https: URL, got %q", cfg.Subject))
+	}
+	if cfg.TTL <= 0 || cfg.PollInterval <= 0 || cfg.Timeout <= 0 {
+		*errors = append(*errors, "WEBPUSH_TTL, WEBPUSH_POLL_INTERVAL and WEBPUSH_TIMEOUT must be positive")
+	}
+	return cfg
+}
+
+// loadTracingConfig reads the OTEL_* variables. They follow the names of the OpenTelemetry
+// SDKs, though only the OTLP/HTTP exporter and the parent-based ratio sampler are supported.
+func loadTracingConfig(errors *[]string) *TracingConfig {
+	cfg := &TracingConfig{
+		Endpoint:    strings.TrimSuffix(getOptionalEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""), "/"),
+		Headers:     make(map[string]string),
+		ServiceName: getOptionalEnv("OTEL_SERVICE_NAME", "lensisku"),
+		SampleRatio: getOptionalEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1, errors),
+	}
+	if cfg.Endpoint != "" {
+		if u, err := url.Parse(cfg.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			*errors = append(*errors, fmt.Sprintf("OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL, got %q", cfg.Endpoint))
+		}
+	}
+	for _, header := range getOptionalEnvList("OTEL_EXPORTER_OTLP_HEADERS", nil) {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			*errors = append(*errors, "OTEL_EXPORTER_OTLP_HEADERS must be a comma-separated list of name=value pairs")
+			break
+		}
+		cfg.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		*errors = append(*errors, fmt.Sprintf("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1, got %g", cfg.SampleRatio))
+	}
+	return cfg
+}
+
+// loadLDAPConfig reads the LDAP_* variables. It is only called when "ldap" is enabled,
+// so the connection settings are required in that case and ignored otherwise.
+func loadLDAPConfig(errors *[]string) *LDAPConfig {
+	cfg := &LDAPConfig{
+		URL:               getRequiredEnv("LDAP_URL", errors),
+		BindDN:            getOptionalEnv("LDAP_BIND_DN", ""),
+		BindPassword:      getOptionalEnv("LDAP_BIND_PASSWORD", ""),
+		BaseDN:            getRequiredEnv("LDAP_BASE_DN", errors),
+		UserFilter:        getOptionalEnv("LDAP_USER_FILTER", "(uid=%s)"),
+		UsernameAttribute: getOptionalEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		EmailAttribute:    getOptionalEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		StartTLS:          getOptionalEnvBool("LDAP_START_TLS", false, errors),
+		Timeout:           getOptionalEnvDuration("LDAP_TIMEOUT", 10*time.Second, errors),
+	}
+	if strings.Count(cfg.UserFilter, "%s") != 1 {
+		*errors = append(*errors, fmt.Sprintf("LDAP_USER_FILTER must contain exactly one %%s placeholder, got '%s'", cfg.UserFilter))
+	}
+	return cfg
+}
+
+// loadCORSConfig reads the CORS_* variables. Credentials (cookies) are only allowed for
+// explicitly listed origins, since with "*" any site could act with a visitor's session. A
+// frontend sending bearer tokens doesn't need them; one on another origin using cookie
+// sessions does.
+func loadCORSConfig(defaultOrigins []string, errors *[]string) *CORSConfig {
+	cfg := &CORSConfig{
+		AllowedOrigins:   getOptionalEnvList("CORS_ALLOWED_ORIGINS", defaultOrigins),
+		AllowedMethods:   getOptionalEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		AllowedHeaders:   getOptionalEnvList("CORS_ALLOWED_HEADERS", []string{"Accept", "Authorization", "Content-Type", "If-Match", "If-None-Match", "X-CSRF-Token", "X-Sudo-Token"}),
+		AllowCredentials: getOptionalEnvBool("CORS_ALLOW_CREDENTIALS", false, errors),
+		MaxAge:           getOptionalEnvDuration("CORS_MAX_AGE", 5*time.Minute, errors),
+	}
+	if len(cfg.AllowedOrigins) == 0 {
+		*errors = append(*errors, "CORS_ALLOWED_ORIGINS must not be empty")
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				*errors = append(*errors, "CORS_ALLOW_CREDENTIALS cannot be used with the wildcard origin \"*\" in CORS_ALLOWED_ORIGINS")
+			}
+			continue
+		}
+		if err := validateCORSOrigin(origin); err != nil {
+			*errors = append(*errors, fmt.Sprintf("invalid origin in CORS_ALLOWED_ORIGINS: %v", err))
+		}
+	}
+	for i, method := range cfg.AllowedMethods {
+		cfg.AllowedMethods[i] = strings.ToUpper(method)
+	}
+	if cfg.MaxAge < 0 {
+		*errors = append(*errors, "CORS_MAX_AGE must not be negative")
+	}
+	return cfg
+}
 
-	// Return the fully populated AppConfig.
-	return &AppConfig{
-		DBPools: dbPools,
-		Auth:    authConfig,
-		Server:  serverConfig,
-	}, nil
+// loadSessionCookieConfig reads the AUTH_COOKIE_* variables. The cookies are Secure by default
+// when the site is served over HTTPS.
+func loadSessionCookieConfig(publicBaseURL string, errors *[]string) *SessionCookieConfig {
+	cfg := &SessionCookieConfig{
+		Domain:   getOptionalEnv("AUTH_COOKIE_DOMAIN", ""),
+		Secure:   getOptionalEnvBool("AUTH_COOKIE_SECURE", strings.HasPrefix(publicBaseURL, "https://"), errors),
+		SameSite: strings.ToLower(getOptionalEnv("AUTH_COOKIE_SAMESITE", "lax")),
+	}
+	switch cfg.SameSite {
+	case "lax", "strict":
+	case "none":
+		// Browsers drop SameSite=None cookies that aren't Secure.
+		if !cfg.Secure {
+			*errors = append(*errors, "AUTH_COOKIE_SAMESITE=none requires AUTH_COOKIE_SECURE")
+		}
+	default:
+		*errors = append(*errors, fmt.Sprintf("AUTH_COOKIE_SAMESITE must be lax, strict or none, got %q", cfg.SameSite))
+	}
+	return cfg
+}
+
+// loadTLSConfig reads the TLS_* variables. TLS is off unless a certificate or autocert domains
+// are given; the two are alternatives.
+func loadTLSConfig(errors *[]string) *TLSConfig {
+	cfg := &TLSConfig{
+		CertFile:         getOptionalEnv("TLS_CERT_FILE", ""),
+		KeyFile:          getOptionalEnv("TLS_KEY_FILE", ""),
+		AutocertDomains:  getOptionalEnvList("TLS_AUTOCERT_DOMAINS", nil),
+		AutocertCacheDir: getOptionalEnv("TLS_AUTOCERT_CACHE_DIR", "./autocert"),
+		AutocertEmail:    getOptionalEnv("TLS_AUTOCERT_EMAIL", ""),
+		RedirectAddr:     getOptionalEnv("TLS_REDIRECT_ADDR", ""),
+	}
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		*errors = append(*errors, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.CertFile != "" && len(cfg.AutocertDomains) > 0 {
+		*errors = append(*errors, "TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS cannot be used together")
+	}
+	if len(cfg.AutocertDomains) > 0 && cfg.AutocertCacheDir == "" {
+		*errors = append(*errors, "TLS_AUTOCERT_CACHE_DIR must not be empty; without a cache every restart asks for new certificates")
+	}
+	if cfg.RedirectAddr != "" && !cfg.Enabled() {
+		*errors = append(*errors, "TLS_REDIRECT_ADDR requires TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+	}
+	return cfg
+}
+
+// validateCORSOrigin checks that `origin` is a scheme and host without a path, such as
+// "https://lensisku.org". A wildcard may only stand for subdomains, as in
+// "https://*.lojban.org": anywhere else, "https://*lojban.org" say, it would also match
+// domains such as "https://evil-lojban.org".
+func validateCORSOrigin(origin string) error {
+	host := origin
+	if strings.Contains(origin, "*") {
+		scheme, rest, ok := strings.Cut(origin, "://*.")
+		if !ok || strings.Contains(rest, "*") || scheme == "" {
+			return fmt.Errorf("%q: a wildcard is only allowed as a whole subdomain, e.g. https://*.example.org", origin)
+		}
+		host = scheme + "://" + rest
+	}
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return fmt.Errorf("%q: expected scheme://host[:port] without a path or trailing slash", origin)
+	}
+	return nil
+}
+
+// loadEmbeddingConfig reads the EMBEDDING_* variables. Base URL and model default per provider,
+// so `EMBEDDING_PROVIDER=ollama` alone is enough for a stock local Ollama.
+func loadEmbeddingConfig(errors *[]string) *EmbeddingConfig {
+	cfg := &EmbeddingConfig{
+		Provider:     strings.ToLower(getOptionalEnv("EMBEDDING_PROVIDER", EmbeddingProviderNone)),
+		APIKey:       getOptionalEnv("EMBEDDING_API_KEY", ""),
+		BatchSize:    getOptionalEnvInt("EMBEDDING_BATCH_SIZE", 32, errors),
+		Timeout:      getOptionalEnvDuration("EMBEDDING_TIMEOUT", 30*time.Second, errors),
+		Workers:      getOptionalEnvInt("EMBEDDING_WORKERS", 3, errors),
+		TickInterval: getOptionalEnvDuration("EMBEDDING_TICK_INTERVAL", 15*time.Second, errors),
+
+		RateLimit:            getOptionalEnvInt("EMBEDDING_RATE_LIMIT", 0, errors),
+		DailyTokenBudget:     int64(getOptionalEnvInt("EMBEDDING_DAILY_TOKEN_BUDGET", 0, errors)),
+		DailyCostBudget:      getOptionalEnvFloat("EMBEDDING_DAILY_COST_BUDGET", 0, errors),
+		CostPerMillionTokens: getOptionalEnvFloat("EMBEDDING_COST_PER_MILLION_TOKENS", 0, errors),
+	}
+
+	var defaultBaseURL, defaultModel string
+	switch cfg.Provider {
+	case EmbeddingProviderNone:
+	case EmbeddingProviderOpenAI:
+		defaultBaseURL, defaultModel = "https://api.openai.com/v1", "text-embedding-3-small"
+	case EmbeddingProviderOllama:
+		defaultBaseURL, defaultModel = "http://localhost:11434", "nomic-embed-text"
+	default:
+		*errors = append(*errors, fmt.Sprintf("EMBEDDING_PROVIDER must be one of none, openai, ollama, got %q", cfg.Provider))
+	}
+	cfg.BaseURL = strings.TrimRight(getOptionalEnv("EMBEDDING_BASE_URL", defaultBaseURL), "/")
+	cfg.Model = getOptionalEnv("EMBEDDING_MODEL", defaultModel)
+	if cfg.Provider != EmbeddingProviderNone {
+		if u, err := url.Parse(cfg.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			*errors = append(*errors, fmt.Sprintf("EMBEDDING_BASE_URL must be an http or https URL, got %q", cfg.BaseURL))
+		}
+		if strings.TrimSpace(cfg.Model) == "" {
+			*errors = append(*errors, "EMBEDDING_MODEL must not be empty")
+		}
+	}
+
+	if cfg.BatchSize < 1 {
+		*errors = append(*errors, fmt.Sprintf("EMBEDDING_BATCH_SIZE must be at least 1, got %d", cfg.BatchSize))
+	}
+	if cfg.Timeout <= 0 {
+		*errors = append(*errors, "EMBEDDING_TIMEOUT must be positive")
+	}
+	if cfg.Workers < 1 || cfg.Workers > MaxEmbeddingWorkers {
+		*errors = append(*errors, fmt.Sprintf("EMBEDDING_WORKERS must be between 1 and %d, got %d", MaxEmbeddingWorkers, cfg.Workers))
+	}
+	if cfg.TickInterval < MinEmbeddingTickInterval {
+		*errors = append(*errors, fmt.Sprintf("EMBEDDING_TICK_INTERVAL must be at least %s", MinEmbeddingTickInterval))
+	}
+	if cfg.RateLimit < 0 {
+		*errors = append(*errors, fmt.Sprintf("EMBEDDING_RATE_LIMIT must not be negative, got %d", cfg.RateLimit))
+	}
+	if cfg.DailyTokenBudget < 0 {
+		*errors = append(*errors, fmt.Sprintf("EMBEDDING_DAILY_TOKEN_BUDGET must not be negative, got %d", cfg.DailyTokenBudget))
+	}
+	if cfg.DailyCostBudget < 0 || cfg.CostPerMillionTokens < 0 {
+		*errors = append(*errors, "EMBEDDING_DAILY_COST_BUDGET and EMBEDDING_COST_PER_MILLION_TOKENS must not be negative")
+	}
+	if cfg.DailyCostBudget > 0 && cfg.CostPerMillionTokens == 0 {
+		*errors = append(*errors, "EMBEDDING_DAILY_COST_BUDGET requires EMBEDDING_COST_PER_MILLION_TOKENS")
+	}
+	// Self-hosted OpenAI-compatible servers usually don't need a key, OpenAI itself always does.
+	if cfg.Provider == EmbeddingProviderOpenAI && cfg.APIKey == "" && strings.Contains(cfg.BaseURL, "api.openai.com") {
+		*errors = append(*errors, "EMBEDDING_API_KEY is required for the OpenAI API")
+	}
+	return cfg
 }
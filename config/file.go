@@ -0,0 +1,125 @@
+// Package config, as part of the configuration module.
+// This file, `file.go`, reads the optional configuration file named by `CONFIG_FILE`. Every
+// setting can be given there as well as in the environment, under the same name; nested keys
+// are joined with underscores, so
+//
+//	db:
+//	  host: db.internal
+//	  app_pool_size: 20
+//	auth_backends: [local, ldap]
+//
+// sets DB_HOST, DB_APP_POOL_SIZE and AUTH_BACKENDS. Lists become the comma-separated
+// values the list settings expect. Precedence, highest first: the process environment, the
+// `.env` file (which only fills variables the environment lacks), the configuration file,
+// then the built-in defaults.
+//
+// The file is YAML; JSON, being a subset of YAML, works too.
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileValues holds the settings of the configuration file, by environment variable name. It
+// is filled by LoadConfig before any setting is read.
+var fileValues map[string]string
+
+// lookupEnv returns a setting from the environment or, failing that, from the configuration
+// file, and for sensitive settings from their secret files or manager (see `secrets.go`).
+// Every setting is read through it.
+func lookupEnv(key string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	if value, ok := fileValues[key]; ok {
+		return value, true
+	}
+	value, ok := secretValues[key]
+	return value, ok
+}
+
+// readConfigFile loads the file at `path` into settings keyed by variable name.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	values := make(map[string]string)
+	if err := flattenConfig("", tree, values); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flattenConfig adds the settings of `tree` to `values`, prefixing their names with `prefix`.
+func flattenConfig(prefix string, tree map[string]any, values map[string]string) error {
+	// Sorted, so that a bad file always reports the same error.
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if _, dup := values[name]; dup {
+			return fmt.Errorf("%s is set twice", name)
+		}
+		switch v := tree[key].(type) {
+		case nil:
+			// An empty key, e.g. a section with every entry commented out.
+		case map[string]any:
+			if err := flattenConfig(name, v, values); err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				s, ok := scalarString(item)
+				if !ok || strings.Contains(s, ",") {
+					return fmt.Errorf("%s: list entries must be plain values without commas", name)
+				}
+				items[i] = s
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			s, ok := scalarString(v)
+			if !ok {
+				return fmt.Errorf("%s: unsupported value %v", name, v)
+			}
+			values[name] = s
+		}
+	}
+	return nil
+}
+
+// scalarString renders a YAML scalar the way it would be written in the environment.
+func scalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
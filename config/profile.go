@@ -0,0 +1,80 @@
+// Package config, as part of the configuration module.
+// This file, `profile.go`, holds the environment profiles selected by APP_ENV. A profile only
+// changes defaults and how strictly the settings are checked; any setting given explicitly
+// still wins. "dev" is convenient on a laptop, "prod" refuses to start with settings that
+// are only acceptable on one, and "staging" sits in between: production defaults without the
+// refusals, so a staging instance can be pointed at throwaway services.
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Environment profiles accepted in APP_ENV.
+const (
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
+)
+
+// minProdJWTSecretLength is the shortest JWT_SECRET accepted in production: 32 bytes, the
+// size of the HMAC-SHA256 key it signs with.
+const minProdJWTSecretLength = 32
+
+// placeholderJWTSecrets are values copied from examples that must never sign real tokens.
+var placeholderJWTSecrets = []string{"your_jwt_secret_key", "secret", "changeme", "change_me"}
+
+// profile holds the defaults that differ between environments.
+type profile struct {
+	LogQueries     bool   // DB_LOG_QUERIES
+	LogLevel       string // LOG_LEVEL
+	LogFormat      string // LOG_FORMAT
+	SSLMode        string // DB_SSLMODE
+	AllowAnyOrigin bool   // CORS_ALLOWED_ORIGINS defaults to "*" rather than the origin of PUBLIC_BASE_URL
+	Strict         bool   // Insecure settings are errors rather than allowed
+	APIValidation  string // OPENAPI_VALIDATION
+}
+
+var profiles = map[string]profile{
+	EnvDev:     {LogQueries: true, LogLevel: "debug", LogFormat: LogFormatText, SSLMode: "disable", AllowAnyOrigin: true, APIValidation: APIValidationLog},
+	EnvStaging: {LogLevel: "info", LogFormat: LogFormatJSON, SSLMode: "prefer", APIValidation: APIValidationLog},
+	EnvProd:    {LogLevel: "info", LogFormat: LogFormatJSON, SSLMode: "verify-full", Strict: true, APIValidation: APIValidationOff},
+}
+
+// loadProfile reads APP_ENV. An unknown value is an error, and the "dev" profile is used so
+// that the remaining settings can still be checked.
+func loadProfile(errors *[]string) (string, profile) {
+	env := strings.ToLower(getOptionalEnv("APP_ENV", EnvDev))
+	p, ok := profiles[env]
+	if !ok {
+		*errors = append(*errors, fmt.Sprintf("APP_ENV must be one of dev, staging, prod, got %q", env))
+		return EnvDev, profiles[EnvDev]
+	}
+	return env, p
+}
+
+// checkStrict appends an error for every setting a strict profile doesn't allow. The checks
+// run on the loaded configuration, so they apply whatever the source of the setting.
+func checkStrict(cfg *AppConfig, errors *[]string) {
+	secret := cfg.Auth.JWTSecret
+	if slices.Contains(placeholderJWTSecrets, strings.ToLower(secret)) {
+		*errors = append(*errors, "JWT_SECRET is an example value; generate one, e.g. with `openssl rand -base64 48`")
+	} else if len(secret) < minProdJWTSecretLength {
+		*errors = append(*errors, fmt.Sprintf("JWT_SECRET must be at least %d bytes long in production", minProdJWTSecretLength))
+	}
+	if slices.Contains(cfg.Server.CORS.AllowedOrigins, "*") {
+		*errors = append(*errors, "CORS_ALLOWED_ORIGINS must list the allowed origins in production, not \"*\"")
+	}
+	if !strings.HasPrefix(cfg.Server.PublicBaseURL, "https://") {
+		*errors = append(*errors, fmt.Sprintf("PUBLIC_BASE_URL must be an https URL in production, got %q", cfg.Server.PublicBaseURL))
+	}
+	if cfg.Auth.Cookies != nil && !cfg.Auth.Cookies.Secure {
+		*errors = append(*errors, "AUTH_COOKIE_SECURE must be enabled in production")
+	}
+	if cfg.Email.SMTPHost == "" {
+		// Without it, emails, password reset links included, would only be written to the log.
+		*errors = append(*errors, "SMTP_HOST is required in production")
+	}
+}
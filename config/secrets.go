@@ -0,0 +1,137 @@
+// Package config, as part of the configuration module.
+// This file, `secrets.go`, resolves the sensitive settings that need not sit in plain
+// environment variables. Each of them may instead be read from a file named by the same
+// variable with a `_FILE` suffix (`DB_PASSWORD_FILE=/run/secrets/db_password`), which is how
+// Docker and Kubernetes mount secrets, or from the secret manager selected by
+// SECRETS_PROVIDER. Precedence, highest first: the variable itself (environment or
+// configuration file), its `_FILE` variant, then the secret manager.
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/user/lensisku-go/secrets"
+)
+
+// sensitiveSettings are the settings that may come from files or a secret manager.
+var sensitiveSettings = []string{
+	"DB_PASSWORD",
+	"DB_REPLICA_URLS", // The URLs carry the replica passwords
+	"JWT_SECRET",
+	"SMTP_USERNAME",
+	"SMTP_PASSWORD",
+	"LDAP_BIND_PASSWORD",
+	"EMBEDDING_API_KEY",
+	"REDIS_URL",                  // May carry the Redis password
+	"SENTRY_DSN",                 // Carries the project key
+	"OTEL_EXPORTER_OTLP_HEADERS", // May carry the collector's API key
+	"WEBPUSH_VAPID_PRIVATE_KEY",
+}
+
+// Secret managers accepted in SECRETS_PROVIDER.
+const (
+	SecretsProviderNone  = "none"
+	SecretsProviderVault = "vault"
+	SecretsProviderAWS   = "aws"
+)
+
+// secretValues holds the sensitive settings resolved by loadSecrets, by variable name.
+// lookupEnv falls back to it.
+var secretValues map[string]string
+
+// loadSecrets resolves the sensitive settings not set directly. It runs before any of them is
+// read; problems are appended to `errors`.
+func loadSecrets(errors *[]string) {
+	secretValues = make(map[string]string)
+
+	var managed map[string]string
+	if provider := newSecretsProvider(errors); provider != nil {
+		timeout := getOptionalEnvDuration("SECRETS_TIMEOUT", 10*time.Second, errors)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		values, err := provider.Secrets(ctx)
+		cancel()
+		if err != nil {
+			*errors = append(*errors, fmt.Sprintf("failed to load secrets from %s: %v", provider.Name(), err))
+		}
+		managed = values
+	}
+
+	for _, key := range sensitiveSettings {
+		value, ok := readSecretFile(key, errors)
+		if !ok {
+			value, ok = managed[key]
+		}
+		if ok {
+			secretValues[key] = value
+		}
+	}
+}
+
+// readSecretFile returns the content of the file named by `key` + "_FILE", without its
+// trailing newline. Setting both `key` and its `_FILE` variant is an error, as it is for the
+// official Docker images, since one of them would be silently ignored.
+func readSecretFile(key string, errors *[]string) (string, bool) {
+	path, ok := lookupEnv(key + "_FILE")
+	if !ok || path == "" {
+		return "", false
+	}
+	if _, set := lookupEnv(key); set {
+		*errors = append(*errors, fmt.Sprintf("%s and %s_FILE are mutually exclusive", key, key))
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		*errors = append(*errors, fmt.Sprintf("failed to read %s_FILE: %v", key, err))
+		return "", false
+	}
+	return strings.TrimRight(string(data), "\r\n"), true
+}
+
+// getOptionalSecret reads a credential of a secret manager itself, from `key` or from the file
+// named by its `_FILE` variant.
+func getOptionalSecret(key string, errors *[]string) string {
+	if value, ok := readSecretFile(key, errors); ok {
+		return value
+	}
+	return getOptionalEnv(key, "")
+}
+
+// newSecretsProvider creates the secret manager selected by SECRETS_PROVIDER, or returns nil
+// for "none" and on configuration errors.
+func newSecretsProvider(errors *[]string) secrets.Provider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch name := strings.ToLower(getOptionalEnv("SECRETS_PROVIDER", SecretsProviderNone)); name {
+	case SecretsProviderNone:
+		return nil
+	case SecretsProviderVault:
+		addr := getOptionalEnv("VAULT_ADDR", "")
+		token := getOptionalSecret("VAULT_TOKEN", errors)
+		path := getOptionalEnv("VAULT_SECRET_PATH", "")
+		if addr == "" || token == "" || path == "" {
+			*errors = append(*errors, "SECRETS_PROVIDER=vault requires VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+			return nil
+		}
+		return secrets.NewVaultProvider(client, addr, token, getOptionalEnv("VAULT_KV_MOUNT", "secret"), path)
+	case SecretsProviderAWS:
+		region := getOptionalEnv("AWS_REGION", "")
+		secretID := getOptionalEnv("AWS_SECRET_ID", "")
+		creds := secrets.AWSCredentials{
+			AccessKeyID:     getOptionalEnv("AWS_ACCESS_KEY_ID", ""),
+			SecretAccessKey: getOptionalSecret("AWS_SECRET_ACCESS_KEY", errors),
+			SessionToken:    getOptionalEnv("AWS_SESSION_TOKEN", ""),
+		}
+		if region == "" || secretID == "" || creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+			*errors = append(*errors, "SECRETS_PROVIDER=aws requires AWS_REGION, AWS_SECRET_ID, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+			return nil
+		}
+		return secrets.NewAWSProvider(client, region, secretID, creds)
+	default:
+		*errors = append(*errors, fmt.Sprintf("SECRETS_PROVIDER must be one of none, vault, aws, got %q", name))
+		return nil
+	}
+}
@@ -0,0 +1,147 @@
+// Package db, as part of the database module.
+// This file, `budget.go`, adds up the database time of each HTTP request. The middleware puts
+// a `QueryBudget` in the request context, and the query tracer (see `tracer.go`) charges every
+// statement run with that context to it. Every request's total is observed in a Prometheus
+// histogram, labeled with its route; a request that goes over the budget is also logged with
+// its slowest statements, so an endpoint that runs one query per row stands out.
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// maxSlowStatements is how many of a request's slowest statements are kept for the log.
+	maxSlowStatements = 3
+	// maxBudgetSQL bounds the length of a statement in the slow request log.
+	maxBudgetSQL = 300
+)
+
+// SlowStatement is one of the slowest statements of a request.
+type SlowStatement struct {
+	Pool     string
+	SQL      string
+	Duration time.Duration
+}
+
+// QueryBudget accumulates the statements of one request. Handlers may query from several
+// goroutines, so it is safe for concurrent use.
+type QueryBudget struct {
+	mu      sync.Mutex
+	total   time.Duration
+	count   int
+	slowest []SlowStatement // Slowest first
+}
+
+type queryBudgetKey struct{}
+
+// WithQueryBudget returns a context whose statements are charged to a new budget.
+func WithQueryBudget(ctx context.Context) (context.Context, *QueryBudget) {
+	b := &QueryBudget{}
+	return context.WithValue(ctx, queryBudgetKey{}, b), b
+}
+
+// queryBudgetFrom returns the budget of `ctx`, or nil.
+func queryBudgetFrom(ctx context.Context) *QueryBudget {
+	b, _ := ctx.Value(queryBudgetKey{}).(*QueryBudget)
+	return b
+}
+
+// charge records one statement.
+func (b *QueryBudget) charge(pool, sql string, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total += d
+	b.count++
+	if len(b.slowest) == maxSlowStatements && d <= b.slowest[len(b.slowest)-1].Duration {
+		return
+	}
+	b.slowest = append(b.slowest, SlowStatement{Pool: pool, SQL: sql, Duration: d})
+	sort.SliceStable(b.slowest, func(i, j int) bool { return b.slowest[i].Duration > b.slowest[j].Duration })
+	if len(b.slowest) > maxSlowStatements {
+		b.slowest = b.slowest[:maxSlowStatements]
+	}
+}
+
+// Total returns the time spent in statements and how many ran.
+func (b *QueryBudget) Total() (time.Duration, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total, b.count
+}
+
+// Slowest returns the slowest statements, slowest first.
+func (b *QueryBudget) Slowest() []SlowStatement {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]SlowStatement(nil), b.slowest...)
+}
+
+// QueryBudgetMiddleware tracks the database time of each request and logs the requests that
+// spend more than `budget` in statements; a zero budget turns the log off but keeps the
+// histogram. It registers its metrics with the default Prometheus registry, so it is created
+// once.
+func QueryBudgetMiddleware(budget time.Duration) func(http.Handler) http.Handler {
+	dbSeconds := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lensisku",
+		Subsystem: "http",
+		Name:      "request_db_seconds",
+		Help:      "Time each request spent in database statements.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"route"})
+	overBudget := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lensisku",
+		Subsystem: "http",
+		Name:      "requests_over_db_budget_total",
+		Help:      "Requests whose database time exceeded DB_REQUEST_QUERY_BUDGET.",
+	}, []string{"route"})
+	prometheus.MustRegister(dbSeconds, overBudget)
+	logger := logging.For("db")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, b := WithQueryBudget(r.Context())
+			next.ServeHTTP(w, r.WithContext(ctx))
+
+			total, count := b.Total()
+			if count == 0 {
+				return
+			}
+			// Unmatched paths share one label, so scanners can't grow the series without bound.
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			dbSeconds.WithLabelValues(route).Observe(total.Seconds())
+			if budget <= 0 || total <= budget {
+				return
+			}
+			overBudget.WithLabelValues(route).Inc()
+
+			slowest := b.Slowest()
+			parts := make([]string, len(slowest))
+			for i, s := range slowest {
+				sql := compactSQL(s.SQL)
+				if len(sql) > maxBudgetSQL {
+					sql = sql[:maxBudgetSQL] + "..."
+				}
+				parts[i] = fmt.Sprintf("%s [%s] %s", s.Duration.Round(time.Microsecond), s.Pool, sql)
+			}
+			logger.WarnContext(r.Context(), "Request over its query budget",
+				"method", r.Method, "route", route,
+				"db_time", total.Round(time.Microsecond), "statements", count, "budget", budget,
+				"slowest", strings.Join(parts, " | "))
+		})
+	}
+}
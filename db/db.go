@@ -8,6 +8,9 @@ package db
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	// `time` is used for setting timeouts and connection pool configurations.
 	"time"
 
@@ -21,31 +24,34 @@ import (
 	// required by `golang-migrate`'s `postgres` database driver when using DSNs, as `migrate`
 	// might internally use `database/sql` with `lib/pq`.
 	_ "github.com/lib/pq"                               // driver for database/sql, needed by migrate's postgres driver with DSN
+	"github.com/jackc/pgx/v5"
 	// `pgxpool` is part of the `jackc/pgx` suite, providing a robust connection pool for PostgreSQL.
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/user/lensisku-go/apperror"
 	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
 )
 // NewDBPools establishes connections to PostgreSQL databases using the provided configuration.
-// It returns two database pools - one for regular application queries and one for import operations.
+// It returns the application database, which also routes reads to the replicas configured in
+// `cfg.ReplicaDSNs` (see `replicas.go`), and a pool for import operations.
 //
 // The function uses pgx/v5 driver which provides better performance than lib/pq.
 // It configures connection pools with appropriate settings based on the configuration,
 // including max connections, connection lifetime, and idle connection management.
-func NewDBPools(cfg *config.DatabasePools) (*pgxpool.Pool, *pgxpool.Pool, error) {
+func NewDBPools(cfg *config.DatabasePools) (*DB, *pgxpool.Pool, error) {
 	// This function demonstrates creating multiple database pools, potentially for different
 	// purposes or even different databases, based on the application's needs.
 
 	// Create the application database pool
-	appPool, err := createPgxPool(cfg.AppPool)
+	appPool, err := createPgxPool(cfg.AppPool, newQueryTracer("app", cfg.LogQueries), cfg.StartDegraded)
 	if err != nil {
 		// If pool creation fails, wrap the error with `apperror` for consistent error handling.
 		return nil, nil, apperror.NewDatabaseError("failed to create application pool", err)
 	}
 
 	// Create the import database pool
-	importPool, err := createPgxPool(cfg.ImportPool)
+	importPool, err := createPgxPool(cfg.ImportPool, newQueryTracer("import", cfg.LogQueries), cfg.StartDegraded)
 	if err != nil {
 		// If the second pool creation fails, ensure the first pool is closed to release resources.
 		if appPool != nil {
@@ -54,19 +60,27 @@ func NewDBPools(cfg *config.DatabasePools) (*pgxpool.Pool, *pgxpool.Pool, error)
 		return nil, nil, apperror.NewDatabaseError("failed to create import pool", err)
 	}
 
-	return appPool, importPool, nil
+	// Connect to the read replicas, if any.
+	appDB, err := newDB(appPool, cfg)
+	if err != nil {
+		appPool.Close()
+		importPool.Close()
+		return nil, nil, err
+	}
+
+	return appDB, importPool, nil
 }
 
 // createPgxPool establishes a single pgxpool connection pool.
 // This helper function encapsulates the logic for creating and configuring one `pgxpool.Pool`.
-func createPgxPool(cfg *config.PoolConfig) (*pgxpool.Pool, error) {
-	dsn := fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=disable&pool_max_conns=%d&pool_max_conn_idle_time=%s&pool_max_conn_lifetime=%s",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName,
-		cfg.MaxSize,
-		(10 * time.Minute).String(), // Example: pool_max_conn_idle_time
-		(30 * time.Minute).String(), // Example: pool_max_conn_lifetime
-	)
+// Every statement on the pool goes through `tracer` (see `tracer.go`). With `lazy`, a database
+// that can't be reached yet is not an error; the pool connects once it can (see `readiness.go`).
+func createPgxPool(cfg *config.PoolConfig, tracer *queryTracer, lazy bool) (*pgxpool.Pool, error) {
+	dsn := getDSN(cfg, url.Values{
+		"pool_max_conns":          {strconv.Itoa(cfg.MaxSize)},
+		"pool_max_conn_idle_time": {(10 * time.Minute).String()}, // Example: pool_max_conn_idle_time
+		"pool_max_conn_lifetime":  {(30 * time.Minute).String()}, // Example: pool_max_conn_lifetime
+	})
 
 	// `pgxpool.ParseConfig` parses the DSN string into a `pgxpool.Config` struct.
 	poolConfig, err := pgxpool.ParseConfig(dsn)
@@ -79,6 +93,8 @@ func createPgxPool(cfg *config.PoolConfig) (*pgxpool.Pool, error) {
 	poolConfig.MaxConns = int32(cfg.MaxSize)
 	poolConfig.MaxConnIdleTime = 10 * time.Minute
 	poolConfig.MaxConnLifetime = 30 * time.Minute
+	poolConfig.ConnConfig.Tracer = tracer
+	poolConfig.AfterConnect = setTimeouts(cfg)
 	// poolConfig.MinConns = int32(cfg.MaxSize / 4) // Example: set min connections
 
 	// Use a context with a timeout for the pool creation process.
@@ -97,7 +113,7 @@ func createPgxPool(cfg *config.PoolConfig) (*pgxpool.Pool, error) {
 	// Verify the connection by pinging
 	pingCtx, pingCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer pingCancel()
-	if err := pool.Ping(pingCtx); err != nil {
+	if err := pool.Ping(pingCtx); err != nil && !lazy {
 		pool.Close() // Clean up on connection failure
 		return nil, apperror.NewDatabaseError(fmt.Sprintf("error connecting to the database %s with pgxpool", cfg.DBName), err)
 	}
@@ -105,15 +121,48 @@ func createPgxPool(cfg *config.PoolConfig) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-// getDSN constructs a DSN string from PoolConfig, suitable for golang-migrate.
-func getDSN(cfg *config.PoolConfig) string {
-	// `golang-migrate`'s `postgres` driver (which often uses `lib/pq` under the hood)
-	// typically expects a DSN in a slightly different format than `pgx`.
-	// Note: golang-migrate's postgres driver typically uses lib/pq format DSN
-	return fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName,
-	)
+// setTimeouts returns an `AfterConnect` hook that sets the pool's statement and
+// idle-in-transaction timeouts on each new connection. When a timeout fires, the server cancels
+// the statement or ends the session, and the caller gets an error instead of waiting forever.
+func setTimeouts(cfg *config.PoolConfig) func(context.Context, *pgx.Conn) error {
+	return func(ctx context.Context, conn *pgx.Conn) error {
+		// Both settings take milliseconds; 0 turns them off.
+		_, err := conn.Exec(ctx, `
+			SELECT set_config('statement_timeout', $1, false),
+			       set_config('idle_in_transaction_session_timeout', $2, false)`,
+			strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10),
+			strconv.FormatInt(cfg.IdleInTransactionTimeout.Milliseconds(), 10))
+		if err != nil {
+			return fmt.Errorf("failed to set connection timeouts: %w", err)
+		}
+		return nil
+	}
+}
+
+// getDSN constructs a DSN string from PoolConfig, plus `extra` parameters.
+// Both pgx and `lib/pq` (used by golang-migrate) understand the TLS parameters and load the
+// certificates into the connection's `tls.Config` themselves. Building the URL with `net/url`
+// escapes credentials that contain characters such as '@' or '/'.
+func getDSN(cfg *config.PoolConfig, extra url.Values) string {
+	params := url.Values{"sslmode": {cfg.SSLMode}}
+	if cfg.SSLRootCert != "" {
+		params.Set("sslrootcert", cfg.SSLRootCert)
+	}
+	if cfg.SSLCert != "" {
+		params.Set("sslcert", cfg.SSLCert)
+		params.Set("sslkey", cfg.SSLKey)
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     "/" + cfg.DBName,
+		RawQuery: params.Encode(),
+	}
+	return dsn.String()
 }
 
 // EnableExtensions enables required PostgreSQL extensions for the lensisku application.
@@ -151,7 +200,7 @@ func EnableExtensions(importPool *pgxpool.Pool) error {
 // It now takes PoolConfig to construct DSN for migrations, as pgxpool.Pool is not directly usable by golang-migrate's postgres driver.
 func RunMigrations(cfg *config.PoolConfig, migrationsPath string) error {
 	// Get the DSN suitable for `golang-migrate`.
-	dsn := getDSN(cfg) // Use the DSN for migrations
+	dsn := getDSN(cfg, nil) // Use the DSN for migrations
 
 	// Open a new sql.DB connection specifically for migrations using the DSN
 	// golang-migrate's postgres driver expects a *sql.DB instance or a DSN it can use with lib/pq.
@@ -172,13 +221,13 @@ func RunMigrations(cfg *config.PoolConfig, migrationsPath string) error {
 	// We are only concerned about logging them if they occur.
 	defer func() {
 		if srcErr, dbErr := m.Close(); srcErr != nil || dbErr != nil {
-			// Log or handle these errors appropriately. For now, just print.
-			// In a real app, you'd use your logger.
+			// They don't affect the migrations themselves, so they are only logged.
+			logger := logging.For("db")
 			if srcErr != nil {
-				fmt.Printf("Warning: error closing migration source: %v\n", srcErr)
+				logger.Warn("Error closing migration source", "error", srcErr)
 			}
 			if dbErr != nil {
-				fmt.Printf("Warning: error closing migration database instance: %v\n", dbErr)
+				logger.Warn("Error closing migration database instance", "error", dbErr)
 			}
 		}
 	}()
@@ -0,0 +1,151 @@
+// Package db, as part of the database module.
+// This file, `partitions.go`, maintains tables that are range-partitioned by month (see
+// migration 000036_comment_partitions). Monthly partitions are named `<table>_pYYYYMM`, after
+// the month they start, in UTC. Rows no monthly partition covers go to the table's default
+// partition, so partitions have to be created before their month begins: a partition can't be
+// added once the default partition holds rows of its month.
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// partitionLockTimeout bounds how long partition DDL waits for its lock. Creating and
+// detaching partitions lock the table; without a limit, a long query on it would hold them up,
+// and every query arriving meanwhile would queue behind them.
+const partitionLockTimeout = 5 * time.Second
+
+// MonthlyTable describes a table partitioned by month.
+type MonthlyTable struct {
+	Name string
+	// Epoch is true when the partition key holds Unix timestamps rather than timestamptz values.
+	Epoch bool
+}
+
+// partitionName returns the name of the partition that starts with `month`.
+func (t MonthlyTable) partitionName(month time.Time) string {
+	return t.Name + "_p" + month.Format("200601")
+}
+
+// bound returns `month` as a partition bound literal.
+func (t MonthlyTable) bound(month time.Time) string {
+	if t.Epoch {
+		return strconv.FormatInt(month.Unix(), 10)
+	}
+	return "'" + month.Format(time.RFC3339) + "'"
+}
+
+// monthStart returns the first instant of the month of `t`, in UTC.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// EnsurePartitions creates the partitions of `t` up to and including the month `ahead` months
+// after the month of `now`. It continues from the newest existing partition, so months before
+// it (such as those covered by the legacy partition) are left alone. It returns the names of
+// the partitions it created.
+func EnsurePartitions(ctx context.Context, pool TxBeginner, t MonthlyTable, now time.Time, ahead int) ([]string, error) {
+	months, err := listPartitions(ctx, pool, t)
+	if err != nil {
+		return nil, err
+	}
+	last := monthStart(now).AddDate(0, ahead, 0)
+	next := monthStart(now)
+	if len(months) > 0 {
+		next = months[len(months)-1].AddDate(0, 1, 0)
+	}
+
+	var created []string
+	for month := next; !month.After(last); month = month.AddDate(0, 1, 0) {
+		name := t.partitionName(month)
+		err := withPartitionLock(ctx, pool, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s)`,
+			pgx.Identifier{name}.Sanitize(), pgx.Identifier{t.Name}.Sanitize(), t.bound(month), t.bound(month.AddDate(0, 1, 0))))
+		if err != nil {
+			return created, fmt.Errorf("failed to create partition %s: %w", name, err)
+		}
+		created = append(created, name)
+	}
+	return created, nil
+}
+
+// DetachPartitions detaches the monthly partitions of `t` that end on or before `cutoff`. A
+// detached partition keeps its rows as a standalone table, to be archived or dropped by hand;
+// its rows no longer appear in `t`. Rows referencing them are kept, since the triggers standing
+// in for foreign keys (migration 000043) don't fire on detach. It returns the names of the
+// partitions it detached.
+func DetachPartitions(ctx context.Context, pool TxBeginner, t MonthlyTable, cutoff time.Time) ([]string, error) {
+	months, err := listPartitions(ctx, pool, t)
+	if err != nil {
+		return nil, err
+	}
+
+	var detached []string
+	for _, month := range months {
+		if month.AddDate(0, 1, 0).After(cutoff) {
+			break
+		}
+		name := t.partitionName(month)
+		err := withPartitionLock(ctx, pool, fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s`,
+			pgx.Identifier{t.Name}.Sanitize(), pgx.Identifier{name}.Sanitize()))
+		if err != nil {
+			return detached, fmt.Errorf("failed to detach partition %s: %w", name, err)
+		}
+		detached = append(detached, name)
+	}
+	return detached, nil
+}
+
+// listPartitions returns the months of the monthly partitions of `t`, oldest first. The legacy
+// and default partitions aren't monthly and are skipped.
+func listPartitions(ctx context.Context, pool TxBeginner, t MonthlyTable) ([]time.Time, error) {
+	var months []time.Time
+	err := WithTx(ctx, pool, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT c.relname
+			FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = $1::regclass`, t.Name)
+		if err != nil {
+			return err
+		}
+		names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		prefix := t.Name + "_p"
+		for _, name := range names {
+			suffix, ok := strings.CutPrefix(name, prefix)
+			if !ok {
+				continue
+			}
+			if month, err := time.Parse("200601", suffix); err == nil {
+				months = append(months, month)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %w", t.Name, err)
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	return months, nil
+}
+
+// withPartitionLock runs one DDL statement in its own transaction, under `partitionLockTimeout`.
+func withPartitionLock(ctx context.Context, pool TxBeginner, statement string) error {
+	return WithTx(ctx, pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`SET LOCAL lock_timeout = %d`, partitionLockTimeout.Milliseconds())); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, statement)
+		return err
+	})
+}
@@ -0,0 +1,135 @@
+// Package db, as part of the database module.
+// This file, `poolstats.go`, watches the connection pools. `PoolMonitor` samples
+// `pgxpool.Stat()` of each pool at an interval and publishes the numbers as Prometheus gauges,
+// labeled with the pool's name; the latest sample is also kept for the health endpoint. A pool
+// whose acquired connections sit at its maximum while the wait time climbs is too small for
+// its load.
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolStats is one sample of a pool's statistics.
+type PoolStats struct {
+	AcquiredConns int32 `json:"acquired_conns"` // Connections in use
+	IdleConns     int32 `json:"idle_conns"`
+	TotalConns    int32 `json:"total_conns"` // Acquired, idle and being opened
+	MaxConns      int32 `json:"max_conns"`
+	// Acquisitions since startup, and how many of them found no idle connection and had to wait.
+	AcquireCount      int64 `json:"acquire_count"`
+	EmptyAcquireCount int64 `json:"empty_acquire_count"`
+	// Total time spent waiting for a connection since startup, in seconds.
+	AcquireWaitSeconds float64   `json:"acquire_wait_seconds"`
+	SampledAt          time.Time `json:"sampled_at"`
+}
+
+// PoolMonitor samples the statistics of named pools.
+type PoolMonitor struct {
+	pools map[string]*pgxpool.Pool
+
+	mu     sync.RWMutex
+	latest map[string]PoolStats
+
+	acquired, idle, total, maxConns, acquires, emptyAcquires, wait *prometheus.GaugeVec
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewPoolMonitor registers the pool gauges with the default Prometheus registry and samples
+// `pools`, keyed by name, every `interval` until Close.
+func NewPoolMonitor(pools map[string]*pgxpool.Pool, interval time.Duration) *PoolMonitor {
+	gauge := func(name, help string) *prometheus.GaugeVec {
+		g := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "lensisku",
+			Subsystem: "db_pool",
+			Name:      name,
+			Help:      help,
+		}, []string{"pool"})
+		prometheus.MustRegister(g)
+		return g
+	}
+	m := &PoolMonitor{
+		pools:         pools,
+		latest:        make(map[string]PoolStats, len(pools)),
+		acquired:      gauge("acquired_conns", "Connections currently in use."),
+		idle:          gauge("idle_conns", "Idle connections."),
+		total:         gauge("total_conns", "Open connections, including ones being established."),
+		maxConns:      gauge("max_conns", "Maximum size of the pool."),
+		acquires:      gauge("acquires", "Connections acquired since startup."),
+		emptyAcquires: gauge("empty_acquires", "Acquisitions since startup that had to wait because no connection was idle."),
+		wait:          gauge("acquire_wait_seconds", "Time spent waiting for a connection since startup."),
+		stop:          make(chan struct{}),
+	}
+	m.sample()
+	m.wg.Add(1)
+	go m.run(interval)
+	return m
+}
+
+func (m *PoolMonitor) run(interval time.Duration) {
+	defer m.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.sample()
+		}
+	}
+}
+
+// sample reads every pool's statistics and updates the gauges.
+func (m *PoolMonitor) sample() {
+	now := time.Now().UTC()
+	latest := make(map[string]PoolStats, len(m.pools))
+	for name, pool := range m.pools {
+		st := pool.Stat()
+		s := PoolStats{
+			AcquiredConns:      st.AcquiredConns(),
+			IdleConns:          st.IdleConns(),
+			TotalConns:         st.TotalConns(),
+			MaxConns:           st.MaxConns(),
+			AcquireCount:       st.AcquireCount(),
+			EmptyAcquireCount:  st.EmptyAcquireCount(),
+			AcquireWaitSeconds: st.EmptyAcquireWaitTime().Seconds(),
+			SampledAt:          now,
+		}
+		latest[name] = s
+
+		m.acquired.WithLabelValues(name).Set(float64(s.AcquiredConns))
+		m.idle.WithLabelValues(name).Set(float64(s.IdleConns))
+		m.total.WithLabelValues(name).Set(float64(s.TotalConns))
+		m.maxConns.WithLabelValues(name).Set(float64(s.MaxConns))
+		m.acquires.WithLabelValues(name).Set(float64(s.AcquireCount))
+		m.emptyAcquires.WithLabelValues(name).Set(float64(s.EmptyAcquireCount))
+		m.wait.WithLabelValues(name).Set(s.AcquireWaitSeconds)
+	}
+	m.mu.Lock()
+	m.latest = latest
+	m.mu.Unlock()
+}
+
+// Stats returns the latest sample of each pool, keyed by name.
+func (m *PoolMonitor) Stats() map[string]PoolStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := make(map[string]PoolStats, len(m.latest))
+	for name, s := range m.latest {
+		stats[name] = s
+	}
+	return stats
+}
+
+// Close stops the sampling.
+func (m *PoolMonitor) Close() {
+	close(m.stop)
+	m.wg.Wait()
+}
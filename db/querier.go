@@ -0,0 +1,34 @@
+// Package db, as part of the database module.
+// This file, `querier.go`, holds the interfaces services take instead of a concrete pool, so
+// the same code runs on the pool, on a `*DB` reading from a replica, or inside a transaction,
+// and the escaping of user input for LIKE patterns.
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier runs queries. `*pgxpool.Pool`, `*DB` and `pgx.Tx` all satisfy it.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Execer runs statements that return no rows. `*pgxpool.Pool`, `*DB` and `pgx.Tx` all
+// satisfy it.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// likeEscaper escapes the LIKE wildcards and the escape character itself.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// EscapeLike escapes `s` for a LIKE or ILIKE pattern, so user input is matched literally with
+// the default escape character.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,152 @@
+// Package db, as part of the database module.
+// This file, `readiness.go`, decides when the database is ready for the app. Normally an
+// unreachable database at startup is fatal. With `DB_START_DEGRADED`, the server starts anyway:
+// requests that need the database fail until it comes up, the readiness probe reports "not
+// ready" so load balancers hold traffic back, and `Readiness` keeps trying, with backoff, until
+// the database answers and the startup setup has run.
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// readinessPingTimeout bounds one connection attempt.
+	readinessPingTimeout = 5 * time.Second
+	// firstRetryInterval is the wait before the first retry; it doubles up to the maximum.
+	firstRetryInterval = time.Second
+)
+
+// Readiness tracks whether the database has been reached and set up.
+type Readiness struct {
+	pools  map[string]*pgxpool.Pool
+	setup  func(ctx context.Context) error
+	logger *slog.Logger
+
+	ready   atomic.Bool
+	lastErr atomic.Pointer[string]
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// WaitForDatabase pings `pools`, keyed by name, and runs `setup` once they all answer. If that
+// fails and `degraded` is false, the error is returned, as before degraded mode existed.
+// Otherwise the attempt is retried in the background, waiting up to `maxInterval` between
+// attempts, and the returned Readiness reports not ready until one succeeds.
+func WaitForDatabase(pools map[string]*pgxpool.Pool, setup func(ctx context.Context) error, degraded bool, maxInterval time.Duration) (*Readiness, error) {
+	r := &Readiness{pools: pools, setup: setup, logger: logging.For("db"), stop: make(chan struct{})}
+	err := r.connect()
+	if err == nil {
+		return r, nil
+	}
+	if !degraded {
+		return nil, err
+	}
+	r.logger.Warn("Database unavailable at startup, serving in degraded mode until it is reachable", "error", err)
+	r.wg.Add(1)
+	go r.retry(maxInterval)
+	return r, nil
+}
+
+// connect makes one attempt to reach the database and set it up.
+func (r *Readiness) connect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), readinessPingTimeout)
+	defer cancel()
+	for name, pool := range r.pools {
+		if err := pool.Ping(ctx); err != nil {
+			return r.fail(fmt.Errorf("%s pool: %w", name, err))
+		}
+	}
+	if err := r.setup(context.Background()); err != nil {
+		return r.fail(err)
+	}
+	r.ready.Store(true)
+	return nil
+}
+
+func (r *Readiness) fail(err error) error {
+	msg := err.Error()
+	r.lastErr.Store(&msg)
+	return err
+}
+
+// retry calls connect with exponential backoff until it succeeds or Close is called.
+func (r *Readiness) retry(maxInterval time.Duration) {
+	defer r.wg.Done()
+	wait := firstRetryInterval
+	for attempt := 2; ; attempt++ {
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(wait):
+		}
+		err := r.connect()
+		if err == nil {
+			r.logger.Info("Database reachable; leaving degraded mode", "attempts", attempt)
+			return
+		}
+		wait = min(2*wait, maxInterval)
+		r.logger.Warn("Database still unavailable", "attempt", attempt, "retry_in", wait, "error", err)
+	}
+}
+
+// Ready reports whether the database has been reached and set up. Once true, it stays true;
+// later outages are up to the pools, which reconnect on their own.
+func (r *Readiness) Ready() bool {
+	return r.ready.Load()
+}
+
+// Err returns why the database isn't ready yet, or nil.
+func (r *Readiness) Err() error {
+	if r.Ready() {
+		return nil
+	}
+	if msg := r.lastErr.Load(); msg != nil {
+		return errors.New(*msg)
+	}
+	return errors.New("not connected yet")
+}
+
+// Close stops retrying.
+func (r *Readiness) Close() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// CheckConnection opens one connection with the settings of `cfg`, outside any pool, and
+// returns the server's version. It is what `lensisku check` uses to test the settings without
+// starting the server.
+func CheckConnection(ctx context.Context, cfg *config.PoolConfig) (string, error) {
+	return checkDSN(ctx, getDSN(cfg, nil))
+}
+
+// CheckReplica is CheckConnection for a read replica, given by its DSN.
+func CheckReplica(ctx context.Context, dsn string) (string, error) {
+	return checkDSN(ctx, dsn)
+}
+
+func checkDSN(ctx context.Context, dsn string) (string, error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(context.Background())
+	var version string
+	if err := conn.QueryRow(ctx, "SHOW server_version").Scan(&version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
@@ -0,0 +1,225 @@
+// Package db, as part of the database module.
+// This file, `replicas.go`, splits reads from writes. `DB` wraps the app pool (the primary)
+// and optional read replicas: writes and transactions go to the primary, while plain queries
+// and read-only transactions go to a healthy replica, taken in turn. A background check pings
+// each replica and measures its replication lag; a replica that fails or falls behind is
+// skipped until it recovers, and with no healthy replica everything runs on the primary.
+//
+// Replicas lag behind, so only code that doesn't need to read its own writes should read
+// through `DB`; the rest keeps using `Primary()`.
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+// replicaCheckTimeout bounds one health check of a replica.
+const replicaCheckTimeout = 3 * time.Second
+
+// DB routes queries between the primary and its read replicas.
+type DB struct {
+	primary  *pgxpool.Pool
+	replicas []*replica
+	next     atomic.Uint64 // Round-robin position among replicas
+
+	maxLag time.Duration
+	logger *slog.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// replica is a read replica and its last known health.
+type replica struct {
+	name    string // host:port, for logs
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// newDB wraps the primary pool and connects to the replicas. A replica that can't be reached
+// yet doesn't prevent startup; it is used once a health check passes.
+func newDB(primary *pgxpool.Pool, cfg *config.DatabasePools) (*DB, error) {
+	d := &DB{primary: primary, maxLag: cfg.ReplicaMaxLag, logger: logging.For("db"), stop: make(chan struct{})}
+	for i, dsn := range cfg.ReplicaDSNs {
+		poolConfig, err := pgxpool.ParseConfig(dsn)
+		if err != nil {
+			d.closeReplicas()
+			// The DSN holds a password, so it isn't part of the message.
+			return nil, apperror.NewDatabaseError(fmt.Sprintf("invalid DSN for replica %d", i+1), err)
+		}
+		poolConfig.MaxConns = int32(cfg.ReplicaPoolSize)
+		poolConfig.MaxConnIdleTime = 10 * time.Minute
+		poolConfig.MaxConnLifetime = 30 * time.Minute
+		name := fmt.Sprintf("%s:%d", poolConfig.ConnConfig.Host, poolConfig.ConnConfig.Port)
+		poolConfig.ConnConfig.Tracer = newQueryTracer(name, cfg.LogQueries)
+		// Replicas serve the app's reads, so they get its timeouts.
+		poolConfig.AfterConnect = setTimeouts(cfg.AppPool)
+		pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+		if err != nil {
+			d.closeReplicas()
+			return nil, apperror.NewDatabaseError(fmt.Sprintf("error creating pgxpool for replica %d", i+1), err)
+		}
+		d.replicas = append(d.replicas, &replica{name: name, pool: pool})
+	}
+	if len(d.replicas) > 0 {
+		d.checkReplicas()
+		d.wg.Add(1)
+		go d.monitor(cfg.ReplicaCheckInterval)
+	}
+	return d, nil
+}
+
+// Primary returns the primary pool, for writes and for reads that must see them.
+func (d *DB) Primary() *pgxpool.Pool {
+	return d.primary
+}
+
+// Reader returns a healthy replica, or the primary when there is none.
+func (d *DB) Reader() *pgxpool.Pool {
+	n := len(d.replicas)
+	start := d.next.Add(1)
+	for i := range n {
+		r := d.replicas[(start+uint64(i))%uint64(n)]
+		if r.healthy.Load() {
+			return r.pool
+		}
+	}
+	return d.primary
+}
+
+// Query runs a read on a replica. If the replica's connection fails, the replica is marked
+// unhealthy and the query is retried on the primary.
+func (d *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	pool := d.Reader()
+	rows, err := pool.Query(ctx, sql, args...)
+	if err != nil && pool != d.primary && d.failover(ctx, pool, err) {
+		return d.primary.Query(ctx, sql, args...)
+	}
+	return rows, err
+}
+
+// QueryRow runs a read on a replica. Its errors only surface on Scan, so unlike Query it
+// isn't retried on the primary.
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return d.Reader().QueryRow(ctx, sql, args...)
+}
+
+// Exec runs a statement on the primary.
+func (d *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return d.primary.Exec(ctx, sql, args...)
+}
+
+// Begin starts a transaction on the primary.
+func (d *DB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return d.primary.Begin(ctx)
+}
+
+// BeginTx starts a read-only transaction on a replica and any other on the primary.
+func (d *DB) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if opts.AccessMode != pgx.ReadOnly {
+		return d.primary.BeginTx(ctx, opts)
+	}
+	pool := d.Reader()
+	tx, err := pool.BeginTx(ctx, opts)
+	if err != nil && pool != d.primary && d.failover(ctx, pool, err) {
+		return d.primary.BeginTx(ctx, opts)
+	}
+	return tx, err
+}
+
+// failover marks the replica behind `pool` unhealthy after a connection error, and reports
+// whether the statement should be retried on the primary. Errors returned by the server, such
+// as a syntax error, would fail there too.
+func (d *DB) failover(ctx context.Context, pool *pgxpool.Pool, err error) bool {
+	var pgErr *pgconn.PgError
+	if ctx.Err() != nil || errors.As(err, &pgErr) {
+		return false
+	}
+	for _, r := range d.replicas {
+		if r.pool == pool && r.healthy.Swap(false) {
+			d.logger.Warn("Database replica failed, reading from the primary until it recovers", "replica", r.name, "error", err)
+		}
+	}
+	return true
+}
+
+// monitor checks the replicas every `interval` until Close.
+func (d *DB) monitor(interval time.Duration) {
+	defer d.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.checkReplicas()
+		}
+	}
+}
+
+// checkReplicas updates the health of every replica, logging changes.
+func (d *DB) checkReplicas() {
+	for _, r := range d.replicas {
+		err := d.checkReplica(r)
+		switch healthy := err == nil; {
+		case healthy && !r.healthy.Swap(true):
+			d.logger.Info("Database replica is healthy; reads use it", "replica", r.name)
+		case !healthy && r.healthy.Swap(false):
+			d.logger.Warn("Database replica is unhealthy, reading from the primary", "replica", r.name, "error", err)
+		}
+	}
+}
+
+// checkReplica returns why a replica can't serve reads, or nil. The lag is the age of the
+// last replayed transaction while received WAL is still waiting to be replayed; a replica that
+// replayed everything it received has none, however long the primary has been idle.
+func (d *DB) checkReplica(r *replica) error {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckTimeout)
+	defer cancel()
+	var inRecovery bool
+	var lag float64
+	err := r.pool.QueryRow(ctx, `
+		SELECT pg_is_in_recovery(),
+		       CASE WHEN pg_last_wal_receive_lsn() IS NOT DISTINCT FROM pg_last_wal_replay_lsn() THEN 0
+		            ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+		       END::float8`).Scan(&inRecovery, &lag)
+	if err != nil {
+		return err
+	}
+	if !inRecovery {
+		// A promoted replica is a primary of its own and no longer receives our writes.
+		return errors.New("not in recovery")
+	}
+	if behind := time.Duration(lag * float64(time.Second)); behind > d.maxLag {
+		return fmt.Errorf("replication lag of %s exceeds %s", behind.Round(time.Millisecond), d.maxLag)
+	}
+	return nil
+}
+
+// Close stops the health checks and closes the replicas and the primary.
+func (d *DB) Close() {
+	close(d.stop)
+	d.wg.Wait()
+	d.closeReplicas()
+	d.primary.Close()
+}
+
+func (d *DB) closeReplicas() {
+	for _, r := range d.replicas {
+		r.pool.Close()
+	}
+}
@@ -0,0 +1,43 @@
+-- The tables of the jbovlaste schema that the sqlc queries read, limited to the columns they
+-- use. sqlc derives the Go types of parameters and results from it; the database itself is
+-- created from the jbovlaste dump and the migrations, not from this file. Keep types and
+-- nullability in line with the real schema when adding columns.
+
+CREATE TABLE languages (
+    langid INTEGER PRIMARY KEY,
+    tag    TEXT NOT NULL
+);
+
+CREATE TABLE users (
+    userid   SERIAL PRIMARY KEY,
+    username TEXT NOT NULL,
+    role     TEXT NOT NULL
+);
+
+CREATE TABLE valsi (
+    valsiid SERIAL PRIMARY KEY,
+    word    TEXT NOT NULL
+);
+
+CREATE TABLE definitions (
+    definitionid SERIAL PRIMARY KEY,
+    langid       INTEGER NOT NULL REFERENCES languages (langid),
+    valsiid      INTEGER NOT NULL REFERENCES valsi (valsiid),
+    definition   TEXT NOT NULL,
+    userid       INTEGER NOT NULL REFERENCES users (userid)
+);
+
+CREATE TABLE natlangwords (
+    wordid  SERIAL PRIMARY KEY,
+    langid  INTEGER NOT NULL REFERENCES languages (langid),
+    word    TEXT NOT NULL,
+    meaning TEXT,
+    userid  INTEGER NOT NULL REFERENCES users (userid),
+    time    INTEGER NOT NULL
+);
+
+CREATE TABLE keywordmapping (
+    natlangwordid INTEGER NOT NULL REFERENCES natlangwords (wordid),
+    definitionid  INTEGER NOT NULL REFERENCES definitions (definitionid),
+    place         INTEGER NOT NULL
+);
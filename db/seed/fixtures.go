@@ -0,0 +1,96 @@
+// Package seed, as part of the database module.
+// This file, `fixtures.go`, is the seed data: a few users of each role, a handful of words with
+// English definitions and glosses, and two comment threads. Times are fixed so that every
+// seeded database is the same.
+package seed
+
+import "time"
+
+// Password is the password of every seeded user.
+const Password = "lensisku-dev"
+
+// seededAt is the creation time of every seeded row that records one.
+var seededAt = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+type userFixture struct {
+	username string
+	role     string
+}
+
+type definitionFixture struct {
+	definition string
+	notes      string
+	selmaho    string
+	glosses    []string // Gloss words (keyword place 0)
+}
+
+type wordFixture struct {
+	word       string
+	typ        string // valsitypes.descriptor
+	rafsi      string // Space-separated
+	author     string
+	definition definitionFixture
+}
+
+type commentFixture struct {
+	author  string
+	subject string
+	text    string
+	replyTo int // 1-based index of the parent within the thread, 0 for none
+}
+
+type threadFixture struct {
+	word     string // The word the thread is about; empty for a free-standing thread
+	comments []commentFixture
+}
+
+// The first user is the admin, who is also credited with the seed in the changelog.
+var users = []userFixture{
+	{username: "admin", role: "admin"},
+	{username: "trusted", role: "trusted"},
+	{username: "alice", role: "user"},
+	{username: "bob", role: "user"},
+}
+
+// Word types, in the order they get ids when missing.
+var wordTypes = []string{"gismu", "cmavo", "lujvo", "fu'ivla", "cmene"}
+
+var words = []wordFixture{
+	{word: "klama", typ: "gismu", rafsi: "kla", author: "admin", definition: definitionFixture{
+		definition: "$x_{1}$ comes/goes to destination $x_{2}$ from origin $x_{3}$ via route $x_{4}$ using means/vehicle $x_{5}$.",
+		glosses:    []string{"go", "come"},
+	}},
+	{word: "bajra", typ: "gismu", rafsi: "baj bra", author: "admin", definition: definitionFixture{
+		definition: "$x_{1}$ runs on surface $x_{2}$ using limbs $x_{3}$ with gait $x_{4}$.",
+		glosses:    []string{"run"},
+	}},
+	{word: "prami", typ: "gismu", rafsi: "pam", author: "trusted", definition: definitionFixture{
+		definition: "$x_{1}$ loves $x_{2}$.",
+		notes:      "See also {pendo}, {xebni}.",
+		glosses:    []string{"love"},
+	}},
+	{word: "mlatu", typ: "gismu", rafsi: "lat", author: "trusted", definition: definitionFixture{
+		definition: "$x_{1}$ is a cat/[puss/pussy/kitten] [feline animal] of species/breed $x_{2}$.",
+		glosses:    []string{"cat"},
+	}},
+	{word: "coi", typ: "cmavo", author: "alice", definition: definitionFixture{
+		definition: "vocative: greetings/hello.",
+		selmaho:    "COI",
+		glosses:    []string{"hello"},
+	}},
+	{word: "klamlatu", typ: "lujvo", author: "alice", definition: definitionFixture{
+		definition: "$x_{1}$ is a travelling cat going to $x_{2}$ from $x_{3}$.",
+		notes:      "From {klama} {mlatu}.",
+	}},
+}
+
+var threads = []threadFixture{
+	{word: "klama", comments: []commentFixture{
+		{author: "alice", subject: "Place structure", text: "Is the route place of klama often left out?"},
+		{author: "trusted", text: "Yes, x4 and x5 are usually left unfilled.", replyTo: 1},
+		{author: "bob", text: "Thanks, that helps.", replyTo: 2},
+	}},
+	{comments: []commentFixture{
+		{author: "bob", subject: "coi ro do", text: "Hello everyone, I just started learning Lojban."},
+	}},
+}
@@ -0,0 +1,263 @@
+// Package seed loads fixture data into a fresh database, so that local development and
+// integration tests start from the same, known state. It is run with `lensisku seed` after the
+// schema and the migrations are in place.
+// This file, `seed.go`, writes the fixtures of `fixtures.go` in a single transaction: either
+// all of them are loaded or none.
+package seed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/user/lensisku-go/changelog"
+	"github.com/user/lensisku-go/db"
+)
+
+// ErrNotEmpty is returned when the database already has users or words. Seeding it would mix
+// fixtures with real data, and the fixture names could clash with existing ones.
+var ErrNotEmpty = errors.New("the database already has users or words; only a fresh database can be seeded")
+
+// Result counts the rows Run created.
+type Result struct {
+	Users       int
+	Words       int
+	Definitions int
+	Threads     int
+	Comments    int
+}
+
+// Run loads the fixtures. Every user gets the password `Password`.
+func Run(ctx context.Context, pool db.TxBeginner) (*Result, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash the seed password: %w", err)
+	}
+
+	var res Result
+	err = db.WithTx(ctx, pool, func(tx pgx.Tx) error {
+		var used bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM valsi)`).Scan(&used); err != nil {
+			return fmt.Errorf("failed to check whether the database is empty: %w", err)
+		}
+		if used {
+			return ErrNotEmpty
+		}
+
+		userIDs, err := seedUsers(ctx, tx, string(hash))
+		if err != nil {
+			return err
+		}
+		res.Users = len(userIDs)
+		if err := changelog.SetActor(ctx, tx, int(userIDs[users[0].username]), changelog.SourceSystem); err != nil {
+			return err
+		}
+
+		valsiIDs, err := seedWords(ctx, tx, userIDs)
+		if err != nil {
+			return err
+		}
+		res.Words, res.Definitions = len(valsiIDs), len(valsiIDs)
+
+		res.Threads, res.Comments, err = seedThreads(ctx, tx, userIDs, valsiIDs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// seedUsers creates the users and returns their ids by username.
+func seedUsers(ctx context.Context, tx pgx.Tx, passwordHash string) (map[string]int32, error) {
+	ids := make(map[string]int32, len(users))
+	for _, u := range users {
+		var id int32
+		err := tx.QueryRow(ctx, `
+			INSERT INTO users (username, email, password, role, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING userid`, u.username, u.username+"@example.org", passwordHash, u.role, seededAt).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user %s: %w", u.username, err)
+		}
+		ids[u.username] = id
+	}
+	return ids, nil
+}
+
+// seedWords creates the words with their definition and glosses, and returns the words' ids.
+func seedWords(ctx context.Context, tx pgx.Tx, userIDs map[string]int32) (map[string]int32, error) {
+	langID, err := englishID(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	typeIDs, err := wordTypeIDs(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	unix := seededAt.Unix()
+	valsiIDs := make(map[string]int32, len(words))
+	for _, w := range words {
+		author := userIDs[w.author]
+		var valsiID int32
+		err := tx.QueryRow(ctx, `
+			INSERT INTO valsi (word, typeid, rafsi, userid, time)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5)
+			RETURNING valsiid`, w.word, typeIDs[w.typ], w.rafsi, author, unix).Scan(&valsiID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create word %s: %w", w.word, err)
+		}
+		valsiIDs[w.word] = valsiID
+
+		d := w.definition
+		var definitionID int32
+		err = tx.QueryRow(ctx, `
+			INSERT INTO definitions (langid, valsiid, definitionnum, definition, notes, selmaho, userid, time)
+			VALUES ($1, $2, 1, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+			RETURNING definitionid`, langID, valsiID, d.definition, d.notes, d.selmaho, author, unix).Scan(&definitionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the definition of %s: %w", w.word, err)
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO definition_revisions (definition_id, revision, definition, notes, selmaho, author_id, status, created_at)
+			VALUES ($1, 1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, 'approved', $6)`,
+			definitionID, d.definition, d.notes, d.selmaho, author, seededAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record the revision of %s: %w", w.word, err)
+		}
+
+		for _, gloss := range d.glosses {
+			var wordID int32
+			err := tx.QueryRow(ctx, `
+				INSERT INTO natlangwords (langid, word, userid, time)
+				VALUES ($1, $2, $3, $4)
+				RETURNING wordid`, langID, gloss, author, unix).Scan(&wordID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create gloss %q: %w", gloss, err)
+			}
+			_, err = tx.Exec(ctx, `INSERT INTO keywordmapping (natlangwordid, definitionid, place) VALUES ($1, $2, 0)`, wordID, definitionID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to link gloss %q: %w", gloss, err)
+			}
+		}
+	}
+	return valsiIDs, nil
+}
+
+// englishID returns the id of English, adding the language if the schema came without it.
+func englishID(ctx context.Context, tx pgx.Tx) (int32, error) {
+	var id int32
+	err := tx.QueryRow(ctx, `SELECT langid FROM languages WHERE tag = 'en' ORDER BY langid LIMIT 1`).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO languages (tag, englishname, lojbanname, realname)
+			VALUES ('en', 'English', 'glibau', 'English')
+			RETURNING langid`).Scan(&id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find or add English: %w", err)
+	}
+	return id, nil
+}
+
+// wordTypeIDs returns the ids of the word types, by descriptor, adding the missing ones.
+func wordTypeIDs(ctx context.Context, tx pgx.Tx) (map[string]int32, error) {
+	ids := make(map[string]int32, len(wordTypes))
+	rows, err := tx.Query(ctx, `SELECT typeid, descriptor FROM valsitypes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load word types: %w", err)
+	}
+	for rows.Next() {
+		var id int32
+		var descriptor string
+		if err := rows.Scan(&id, &descriptor); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to load word types: %w", err)
+		}
+		ids[strings.ToLower(descriptor)] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load word types: %w", err)
+	}
+
+	for _, typ := range wordTypes {
+		if _, ok := ids[typ]; ok {
+			continue
+		}
+		// typeid has no sequence in the jbovlaste schema.
+		var id int32
+		err := tx.QueryRow(ctx, `
+			INSERT INTO valsitypes (typeid, descriptor)
+			SELECT COALESCE(MAX(typeid), 0) + 1, $1::text FROM valsitypes
+			RETURNING typeid`, typ).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add word type %s: %w", typ, err)
+		}
+		ids[typ] = id
+	}
+	return ids, nil
+}
+
+// seedThreads creates the comment threads and returns how many threads and comments it made.
+// Comments are written the way the comments service stores them: the subject, if any, as a
+// leading header part, and a counters row for each.
+func seedThreads(ctx context.Context, tx pgx.Tx, userIDs, valsiIDs map[string]int32) (int, int, error) {
+	comments := 0
+	for i, t := range threads {
+		var threadID int32
+		err := tx.QueryRow(ctx, `
+			INSERT INTO threads (valsiid, natlangwordid, definitionid)
+			VALUES ($1, 0, 0)
+			RETURNING threadid`, valsiIDs[t.word]).Scan(&threadID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to create thread %d: %w", i+1, err)
+		}
+
+		commentIDs := make([]int32, len(t.comments))
+		for j, c := range t.comments {
+			type part struct {
+				Type string `json:"type"`
+				Data string `json:"data"`
+			}
+			parts := []part{{Type: "text", Data: c.text}}
+			if c.subject != "" {
+				parts = append([]part{{Type: "header", Data: c.subject}}, parts...)
+			}
+			content, err := json.Marshal(parts)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to encode comment: %w", err)
+			}
+			var parentID *int32
+			if c.replyTo > 0 {
+				parentID = &commentIDs[c.replyTo-1]
+			}
+			posted := seededAt.Add(time.Duration(j) * time.Hour).Unix()
+			err = tx.QueryRow(ctx, `
+				INSERT INTO comments (threadid, parentid, userid, commentnum, time, subject, content)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				RETURNING commentid`,
+				threadID, parentID, userIDs[c.author], j+1, posted, c.subject, content).Scan(&commentIDs[j])
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to create comment %d of thread %d: %w", j+1, i+1, err)
+			}
+		}
+		comments += len(t.comments)
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO comment_counters (comment_id, total_reactions, total_replies)
+			SELECT c.commentid, 0, (SELECT COUNT(*) FROM comments r WHERE r.parentid = c.commentid)
+			FROM comments c WHERE c.threadid = $1`, threadID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to count replies of thread %d: %w", i+1, err)
+		}
+	}
+	return len(threads), comments, nil
+}
@@ -0,0 +1,176 @@
+// Package db, as part of the database module.
+// This file, `tracer.go`, instruments every statement run through the pools. Each one becomes
+// an OpenTelemetry span, a child of whatever span the request context carries, so a slow
+// endpoint's trace shows which queries took the time. Spans go to the global tracer provider,
+// and are dropped when none is registered.
+//
+// Statements run for an HTTP request are also charged to its query budget (see `budget.go`).
+//
+// With `DB_LOG_QUERIES` set, statements are also logged with their duration and row count.
+// Argument values often hold passwords, tokens or emails, so only numbers, booleans and times
+// are logged as is; any other value is replaced by its type and length.
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/user/lensisku-go/logging"
+)
+
+// maxLoggedSQL bounds the length of a statement in the log.
+const maxLoggedSQL = 2000
+
+// queryTracer implements pgx.QueryTracer.
+type queryTracer struct {
+	tracer     trace.Tracer
+	logQueries bool
+	logger     *slog.Logger
+	pool       string // Which pool ran the query: "app", "import" or a replica's host:port
+}
+
+func newQueryTracer(pool string, logQueries bool) *queryTracer {
+	return &queryTracer{
+		tracer:     otel.Tracer("github.com/user/lensisku-go/db"),
+		logQueries: logQueries,
+		logger:     logging.For("sql"),
+		pool:       pool,
+	}
+}
+
+// queryTrace is what TraceQueryStart hands to TraceQueryEnd through the context.
+type queryTrace struct {
+	sql   string
+	args  []any
+	start time.Time
+	span  trace.Span
+}
+
+type queryTraceKey struct{}
+
+// TraceQueryStart opens the span of a statement.
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, span := t.tracer.Start(ctx, spanName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.statement", data.SQL),
+			attribute.String("db.pool", t.pool),
+		))
+	return context.WithValue(ctx, queryTraceKey{}, &queryTrace{sql: data.SQL, args: data.Args, start: time.Now(), span: span})
+}
+
+// TraceQueryEnd closes the span and logs the statement. For a Query, pgx calls it when the
+// rows are closed, so the duration includes reading them.
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	qt, ok := ctx.Value(queryTraceKey{}).(*queryTrace)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(qt.start)
+	rows := data.CommandTag.RowsAffected()
+
+	qt.span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+	if data.Err != nil {
+		qt.span.RecordError(data.Err)
+		qt.span.SetStatus(codes.Error, data.Err.Error())
+	}
+	qt.span.End()
+
+	if b := queryBudgetFrom(ctx); b != nil {
+		b.charge(t.pool, qt.sql, elapsed)
+	}
+
+	if !t.logQueries {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("pool", t.pool),
+		slog.Duration("duration", elapsed.Round(time.Microsecond)),
+		slog.String("sql", compactSQL(qt.sql)),
+	}
+	if len(qt.args) > 0 {
+		attrs = append(attrs, slog.String("args", formatArgs(qt.args)))
+	}
+	if data.Err != nil {
+		t.logger.LogAttrs(ctx, slog.LevelInfo, "SQL failed", append(attrs, slog.Any("error", data.Err))...)
+		return
+	}
+	t.logger.LogAttrs(ctx, slog.LevelInfo, "SQL", append(attrs, slog.Int64("rows", rows))...)
+}
+
+// spanName names a span after the statement's command, e.g. "SELECT". The full statement is an
+// attribute; as a name it would make every query its own kind of span.
+func spanName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "db.query"
+	}
+	return "db." + strings.ToUpper(fields[0])
+}
+
+// compactSQL puts a statement on one line, shortening very long ones.
+func compactSQL(sql string) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if len(sql) > maxLoggedSQL {
+		sql = sql[:maxLoggedSQL] + "..."
+	}
+	return sql
+}
+
+// formatArgs renders the arguments of a statement for the log, redacting what may be private.
+func formatArgs(args []any) string {
+	var b strings.Builder
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "$%d=%s", i+1, redactArg(arg))
+	}
+	return b.String()
+}
+
+// redactArg shows numbers, booleans, times and NULL; anything else may be private.
+func redactArg(arg any) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return fmt.Sprint(v)
+	case *int32:
+		if v == nil {
+			return "NULL"
+		}
+		return fmt.Sprint(*v)
+	case *int64:
+		if v == nil {
+			return "NULL"
+		}
+		return fmt.Sprint(*v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case string:
+		return fmt.Sprintf("<text, %d bytes>", len(v))
+	case []byte:
+		return fmt.Sprintf("<binary, %d bytes>", len(v))
+	case []int32:
+		return fmt.Sprintf("<%d ints>", len(v))
+	case []int64:
+		return fmt.Sprintf("<%d ints>", len(v))
+	case []string:
+		return fmt.Sprintf("<%d texts>", len(v))
+	default:
+		return fmt.Sprintf("<%T>", v)
+	}
+}
@@ -0,0 +1,48 @@
+// Package db, as part of the database module.
+// This file, `tx.go`, holds the shared transaction helper. Services hand `WithTx` the work to do
+// inside a transaction; it begins, commits, and rolls back, so no service has to get the
+// defer/recover dance right on its own.
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// TxBeginner starts transactions. `*pgxpool.Pool` and `*DB` both satisfy it.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+}
+
+// WithTx runs fn in a read-write transaction on pool. See WithTxOptions.
+func WithTx(ctx context.Context, pool TxBeginner, fn func(tx pgx.Tx) error) error {
+	return WithTxOptions(ctx, pool, pgx.TxOptions{}, fn)
+}
+
+// WithTxOptions runs fn in a transaction started with opts. The transaction is committed when
+// fn returns nil and rolled back when it returns an error, which is passed through unchanged.
+// If fn panics, the transaction is rolled back and the panic continues.
+func WithTxOptions(ctx context.Context, pool TxBeginner, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	tx, err := pool.BeginTx(ctx, opts)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to begin transaction", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(context.WithoutCancel(ctx))
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return apperror.NewDatabaseError("failed to commit transaction", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package definitions, as part of the dictionary module.
+// This file, `dto.go`, defines the request and response bodies of the definitions API.
+// In Nest.js terms these are the DTO classes of a `DefinitionsModule`.
+package definitions
+
+import (
+	"time"
+
+	"github.com/user/lensisku-go/examples"
+)
+
+// Revision statuses, stored in `definition_revisions.status`.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// DefinitionResponse is a definition as shown to readers: the content of its latest approved
+// revision, or of its latest revision when pending edits were asked for.
+// @Description A definition of a Lojban word in one language
+type DefinitionResponse struct {
+	// example: 12345
+	DefinitionID int32 `json:"definition_id"`
+	// example: 678
+	ValsiID int32 `json:"valsi_id"`
+	// example: "klama"
+	Word string `json:"word"`
+	// Language tag
+	// example: "en"
+	Language string `json:"language"`
+	// Position among the word's definitions in this language
+	// example: 1
+	DefinitionNum int32 `json:"definition_num"`
+	// example: "$x_{1}$ comes/goes to destination $x_{2}$ ..."
+	Definition string  `json:"definition"`
+	Notes      *string `json:"notes,omitempty"`
+	// example: "BRIVLA"
+	Selmaho *string `json:"selmaho,omitempty"`
+	// Who created the definition; the authors of later edits are listed in its revisions
+	// example: 42
+	AuthorID       int32   `json:"author_id"`
+	AuthorUsername *string `json:"author_username,omitempty"`
+	// example: "2024-01-15T10:30:00Z"
+	CreatedAt time.Time `json:"created_at"`
+	// The revision whose content is shown. Absent for definitions without a recorded history.
+	Revision *RevisionResponse `json:"revision,omitempty"`
+	// Edits waiting for review
+	// example: 0
+	PendingRevisions int `json:"pending_revisions"`
+	// Approved example sentences, oldest first
+	Examples []examples.ExampleResponse `json:"examples"`
+}
+
+// RevisionResponse is one entry of a definition's history.
+// @Description One revision of a definition
+type RevisionResponse struct {
+	// Numbered from 1 per definition
+	// example: 3
+	Revision   int32   `json:"revision"`
+	Definition string  `json:"definition"`
+	Notes      *string `json:"notes,omitempty"`
+	Selmaho    *string `json:"selmaho,omitempty"`
+	// Absent if the author's account no longer exists
+	AuthorID       *int32  `json:"author_id,omitempty"`
+	AuthorUsername *string `json:"author_username,omitempty"`
+	// Edit summary
+	// example: "Fixed the place structure"
+	Comment *string `json:"comment,omitempty"`
+	// pending, approved or rejected
+	// example: "approved"
+	Status     string     `json:"status"`
+	ReviewedBy *int32     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	// example: "2024-01-15T10:30:00Z"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ListDefinitionsQuery selects the definitions of one word.
+type ListDefinitionsQuery struct {
+	// Word spelling; either Word or ValsiID is required
+	Word    string `form:"word"`
+	ValsiID int32  `form:"valsi_id" validate:"omitempty,min=1"`
+	// Language tag; all languages if empty
+	Language string `form:"language"`
+	// Show the latest revision even if it's still pending
+	IncludePending bool `form:"include_pending"`
+}
+
+// GetDefinitionQuery holds the options of a definition lookup.
+type GetDefinitionQuery struct {
+	// Show the latest revision even if it's still pending
+	IncludePending bool `form:"include_pending"`
+}
+
+// CreateDefinitionRequest is the body of a new definition.
+// @Description Request body for adding a definition to a word
+type CreateDefinitionRequest struct {
+	// The word being defined; it must already exist
+	// example: "klama"
+	Word string `json:"word" validate:"required"`
+	// Language tag of the definition
+	// example: "en"
+	Language string `json:"language" validate:"required"`
+	// example: "$x_{1}$ comes/goes to destination $x_{2}$ ..."
+	Definition string `json:"definition" validate:"required"`
+	Notes      string `json:"notes,omitempty"`
+	Selmaho    string `json:"selmaho,omitempty"`
+}
+
+// UpdateDefinitionRequest proposes a new revision. Omitted fields keep their current value;
+// an empty notes or selmaho clears it.
+// @Description Request body for editing a definition
+type UpdateDefinitionRequest struct {
+	Definition *string `json:"definition,omitempty"`
+	Notes      *string `json:"notes,omitempty"`
+	Selmaho    *string `json:"selmaho,omitempty"`
+	// Edit summary shown in the history
+	// example: "Fixed the place structure"
+	Comment string `json:"comment,omitempty"`
+}
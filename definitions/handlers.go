@@ -0,0 +1,323 @@
+// Package definitions encapsulates the definitions of Lojban words: adding them, editing them
+// with a reviewed revision history, and reading the approved version.
+// This file, `handlers.go`, serves /api/v1/definitions: listing, reading, adding, editing and
+// deleting definitions, and the review of their revisions.
+package definitions
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// DefinitionHandlers provides HTTP handlers for definitions.
+type DefinitionHandlers struct {
+	service *DefinitionService
+}
+
+// NewDefinitionHandlers creates new DefinitionHandlers.
+func NewDefinitionHandlers(service *DefinitionService) *DefinitionHandlers {
+	return &DefinitionHandlers{service: service}
+}
+
+// HandleListDefinitions godoc
+// @Summary List the definitions of a word
+// @Description Returns the definitions of a word, ordered by language and position. Each shows its latest approved revision unless `include_pending` is set.
+// @Tags definitions
+// @Produce json
+// @Param word query string false "Word spelling; either word or valsi_id is required"
+// @Param valsi_id query int false "Word ID"
+// @Param language query string false "Language tag, e.g. en"
+// @Param include_pending query bool false "Show edits still waiting for review"
+// @Success 200 {array} DefinitionResponse "Definitions"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing word or invalid parameters"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions [get]
+func (h *DefinitionHandlers) HandleListDefinitions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var query ListDefinitionsQuery
+		if err := validation.DecodeQuery(r, &query); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		definitions, err := h.service.List(r.Context(), query)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, definitions)
+	}
+}
+
+// HandleGetDefinition godoc
+// @Summary Get a definition
+// @Description Returns a definition with the content of its latest approved revision, or of its latest revision if `include_pending` is set.
+// @Tags definitions
+// @Produce json
+// @Param definitionID path int true "Definition ID"
+// @Param include_pending query bool false "Show an edit still waiting for review"
+// @Success 200 {object} DefinitionResponse "Definition"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid definition ID"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions/{definitionID} [get]
+func (h *DefinitionHandlers) HandleGetDefinition() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		definitionID, err := definitionIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		var q GetDefinitionQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		definition, err := h.service.Get(r.Context(), definitionID, q.IncludePending)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, definition)
+	}
+}
+
+// HandleCreateDefinition godoc
+// @Summary Add a definition
+// @Description Adds a definition to an existing word. It is published right away as revision 1, authored by the current user.
+// @Tags definitions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param definition body CreateDefinitionRequest true "New definition"
+// @Success 201 {object} DefinitionResponse "Created definition"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing fields, unknown language or text too long"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions [post]
+func (h *DefinitionHandlers) HandleCreateDefinition() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req CreateDefinitionRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		definition, err := h.service.Create(r.Context(), userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusCreated, definition)
+	}
+}
+
+// HandleUpdateDefinition godoc
+// @Summary Edit a definition
+// @Description Records the edit as a new revision. Edits by the definition's author, trusted users and admins are published right away (status `approved`); other edits wait for review (status `pending`, answered with 202).
+// @Tags definitions
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param definitionID path int true "Definition ID"
+// @Param edit body UpdateDefinitionRequest true "Changed fields"
+// @Success 200 {object} RevisionResponse "Edit published"
+// @Success 202 {object} RevisionResponse "Edit waiting for review"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid payload or no change"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions/{definitionID} [put]
+func (h *DefinitionHandlers) HandleUpdateDefinition() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		definitionID, err := definitionIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		var req UpdateDefinitionRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		revision, err := h.service.Update(r.Context(), definitionID, userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		status := http.StatusOK
+		if revision.Status == StatusPending {
+			status = http.StatusAccepted
+		}
+		render.Write(w, r, status, revision)
+	}
+}
+
+// HandleDeleteDefinition godoc
+// @Summary Delete a definition
+// @Description Deletes a definition with its revisions, glosses and votes. Only its author or an admin may delete it.
+// @Tags definitions
+// @Security BearerAuth
+// @Param definitionID path int true "Definition ID"
+// @Success 204 "Deleted"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid definition ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not the author or an admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Definition still referenced"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions/{definitionID} [delete]
+func (h *DefinitionHandlers) HandleDeleteDefinition() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		definitionID, err := definitionIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.service.Delete(r.Context(), definitionID, userID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleListRevisions godoc
+// @Summary Get the history of a definition
+// @Description Returns every revision of a definition with its author and review status, newest first.
+// @Tags definitions
+// @Produce json
+// @Param definitionID path int true "Definition ID"
+// @Success 200 {array} RevisionResponse "Revisions"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid definition ID"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions/{definitionID}/revisions [get]
+func (h *DefinitionHandlers) HandleListRevisions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		definitionID, err := definitionIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		revisions, err := h.service.ListRevisions(r.Context(), definitionID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, revisions)
+	}
+}
+
+// HandleApproveRevision godoc
+// @Summary Approve a pending edit
+// @Description Publishes a pending revision. Fails with 409 if a newer revision was approved since the edit was made. Trusted users and admins only.
+// @Tags definitions
+// @Produce json
+// @Security BearerAuth
+// @Param definitionID path int true "Definition ID"
+// @Param revision path int true "Revision number"
+// @Success 200 {object} RevisionResponse "Approved revision"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not a trusted user or admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition or revision not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Revision already reviewed or superseded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions/{definitionID}/revisions/{revision}/approve [post]
+func (h *DefinitionHandlers) HandleApproveRevision() http.HandlerFunc {
+	return h.handleReview(true)
+}
+
+// HandleRejectRevision godoc
+// @Summary Reject a pending edit
+// @Description Marks a pending revision as rejected; it stays in the history. Trusted users and admins only.
+// @Tags definitions
+// @Produce json
+// @Security BearerAuth
+// @Param definitionID path int true "Definition ID"
+// @Param revision path int true "Revision number"
+// @Success 200 {object} RevisionResponse "Rejected revision"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not a trusted user or admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition or revision not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Revision already reviewed"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/definitions/{definitionID}/revisions/{revision}/reject [post]
+func (h *DefinitionHandlers) HandleRejectRevision() http.HandlerFunc {
+	return h.handleReview(false)
+}
+
+func (h *DefinitionHandlers) handleReview(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		definitionID, err := definitionIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		revision, err := strconv.ParseInt(chi.URLParam(r, "revision"), 10, 32)
+		if err != nil || revision < 1 {
+			auth.WriteError(w, r, apperror.NewBadRequestError("invalid revision number", err))
+			return
+		}
+
+		rev, err := h.service.ReviewRevision(r.Context(), definitionID, int32(revision), userID, approve)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, rev)
+	}
+}
+
+func definitionIDParam(r *http.Request) (int32, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "definitionID"), 10, 32)
+	if err != nil || id < 1 {
+		return 0, apperror.NewBadRequestError("invalid definition ID", err)
+	}
+	return int32(id), nil
+}
@@ -0,0 +1,191 @@
+// Package definitions, as part of the dictionary module.
+// This file, `revisions.go`, covers the history of a definition and the review of pending
+// edits. Reviewing is for trusted users and admins; the route enforces the role.
+package definitions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/changelog"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/notifications"
+	"github.com/user/lensisku-go/users"
+)
+
+// revisionSelect reads RevisionResponse rows; callers append their WHERE clause.
+const revisionSelect = `
+	SELECT r.revision, r.definition, r.notes, r.selmaho, r.author_id, u.username,
+	       r.comment, r.status, r.reviewed_by, r.reviewed_at, r.created_at
+	FROM definition_revisions r
+	LEFT JOIN users u ON u.userid = r.author_id`
+
+func scanRevision(row pgx.Row) (*RevisionResponse, error) {
+	var rev RevisionResponse
+	err := row.Scan(&rev.Revision, &rev.Definition, &rev.Notes, &rev.Selmaho, &rev.AuthorID, &rev.AuthorUsername,
+		&rev.Comment, &rev.Status, &rev.ReviewedBy, &rev.ReviewedAt, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// ListRevisions returns the full history of a definition, newest first, including pending and
+// rejected revisions.
+func (s *DefinitionService) ListRevisions(ctx context.Context, definitionID int32) ([]RevisionResponse, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM definitions WHERE definitionid = $1)`, definitionID).Scan(&exists)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load definition", err)
+	}
+	if !exists {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("definition with ID %d not found", definitionID), nil)
+	}
+
+	rows, err := s.db.Query(ctx, revisionSelect+`
+		WHERE r.definition_id = $1
+		ORDER BY r.revision DESC`, definitionID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list revisions", err)
+	}
+	defer rows.Close()
+	revisions := []RevisionResponse{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read revision", err)
+		}
+		revisions = append(revisions, *rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list revisions", err)
+	}
+	return revisions, nil
+}
+
+// ReviewRevision approves or rejects a pending revision. Approving publishes its content,
+// unless a newer revision has been approved in the meantime: the pending edit was made
+// against older content and would silently undo that change, so it can only be rejected.
+// The review is audited with the revision before and after it.
+func (s *DefinitionService) ReviewRevision(ctx context.Context, definitionID, revision int32, reviewerID int, approve bool) (*RevisionResponse, error) {
+	var rev *RevisionResponse
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, reviewerID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		if _, err := lockDefinition(ctx, tx, definitionID, reviewerID); err != nil {
+			return err
+		}
+		var err error
+		rev, err = scanRevision(tx.QueryRow(ctx, revisionSelect+`
+			WHERE r.definition_id = $1 AND r.revision = $2`, definitionID, revision))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewNotFoundError(fmt.Sprintf("revision %d of definition %d not found", revision, definitionID), nil)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load revision", err)
+		}
+		if rev.Status != StatusPending {
+			return apperror.NewConflictError(fmt.Sprintf("revision %d is already %s", revision, rev.Status), nil).WithCode(apperror.CodeAlreadyReviewed)
+		}
+		before := *rev
+
+		rev.Status = StatusRejected
+		if approve {
+			var latestApproved int32
+			err := tx.QueryRow(ctx, `
+				SELECT COALESCE(MAX(revision), 0) FROM definition_revisions
+				WHERE definition_id = $1 AND status = 'approved'`, definitionID).Scan(&latestApproved)
+			if err != nil {
+				return apperror.NewDatabaseError("failed to load revisions", err)
+			}
+			if latestApproved > revision {
+				return apperror.NewConflictError(fmt.Sprintf("revision %d was approved since this edit was made; it can only be rejected", latestApproved), nil).WithCode(apperror.CodeRevisionSuperseded)
+			}
+			rev.Status = StatusApproved
+		}
+
+		var revisionID int64
+		err = tx.QueryRow(ctx, `
+			UPDATE definition_revisions SET status = $3, reviewed_by = $4, reviewed_at = NOW()
+			WHERE definition_id = $1 AND revision = $2
+			RETURNING id, reviewed_by, reviewed_at`,
+			definitionID, revision, rev.Status, reviewerID).Scan(&revisionID, &rev.ReviewedBy, &rev.ReviewedAt)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to review revision", err)
+		}
+		action := audit.ActionRevisionReject
+		if approve {
+			if err := applyRevision(ctx, tx, definitionID, *rev); err != nil {
+				return err
+			}
+			action = audit.ActionRevisionApprove
+		}
+		if err := notifyRevisionAuthor(ctx, tx, definitionID, rev, reviewerID); err != nil {
+			return err
+		}
+		if err := recordRevisionReputation(ctx, tx, revisionID, rev, reviewerID); err != nil {
+			return err
+		}
+		return audit.Record(ctx, tx, audit.Entry{
+			ActorID:    reviewerID,
+			Action:     action,
+			TargetType: audit.TargetDefinition,
+			TargetID:   strconv.Itoa(int(definitionID)),
+			Before:     before,
+			After:      rev,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// recordRevisionReputation credits or debits the author of `rev` for its review. Reviewing
+// one's own edit counts for nothing.
+func recordRevisionReputation(ctx context.Context, tx pgx.Tx, revisionID int64, rev *RevisionResponse, reviewerID int) error {
+	if rev.AuthorID == nil || int(*rev.AuthorID) == reviewerID {
+		return nil
+	}
+	return users.RecordModerationOutcome(ctx, tx, users.ModerationOutcome{
+		UserID:   int(*rev.AuthorID),
+		Source:   users.ReputationSourceRevision,
+		SourceID: revisionID,
+		Points:   users.ReviewPoints(rev.Status == StatusApproved),
+		Reason:   "definition edit " + rev.Status,
+	})
+}
+
+// notifyRevisionAuthor tells the author of `rev` that it was reviewed.
+func notifyRevisionAuthor(ctx context.Context, tx pgx.Tx, definitionID int32, rev *RevisionResponse, reviewerID int) error {
+	if rev.AuthorID == nil {
+		return nil
+	}
+	var valsiID int32
+	var word string
+	err := tx.QueryRow(ctx, `
+		SELECT v.valsiid, v.word FROM definitions d JOIN valsi v ON v.valsiid = d.valsiid
+		WHERE d.definitionid = $1`, definitionID).Scan(&valsiID, &word)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to load word of definition", err)
+	}
+	kind, verb := notifications.TypeRevisionRejected, "rejected"
+	if rev.Status == StatusApproved {
+		kind, verb = notifications.TypeRevisionApproved, "approved"
+	}
+	return notifications.Notify(ctx, tx, notifications.Entry{
+		UserID:  *rev.AuthorID,
+		Type:    kind,
+		Message: fmt.Sprintf("Your edit to the definition of %s was %s", word, verb),
+		ValsiID: &valsiID,
+		ActorID: reviewerID,
+	})
+}
@@ -0,0 +1,406 @@
+// Package definitions, as part of the dictionary module.
+// This file, `service.go`, contains the business logic for definitions: reading them, adding
+// new ones and proposing edits. Every change is recorded in `definition_revisions` with its
+// author (see `revisions.go` for the history and reviews), while `definitions` always holds
+// the content of the latest approved revision.
+//
+// As in jbovlaste, a new definition is visible right away and then judged by votes. Edits are
+// approved immediately when made by the definition's author or by a trusted user or admin;
+// anyone else's edit waits as a pending revision until one of them reviews it.
+// In Nest.js terms, `DefinitionService` is the `@Injectable()` service of a `DefinitionsModule`.
+package definitions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/changelog"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/examples"
+)
+
+// maxDefinitionLength caps the definition text, in characters. Notes are allowed twice as much.
+const maxDefinitionLength = 10000
+
+// DefinitionService provides the definitions API.
+type DefinitionService struct {
+	db       *pgxpool.Pool
+	examples *examples.ExampleService
+}
+
+// NewDefinitionService creates a new DefinitionService. Definitions are returned with the
+// approved examples from `examples`.
+func NewDefinitionService(db *pgxpool.Pool, examples *examples.ExampleService) *DefinitionService {
+	return &DefinitionService{db: db, examples: examples}
+}
+
+// definitionSelect reads DefinitionResponse rows (see `scanDefinition`). Its first parameter
+// picks the revision shown: false for the latest approved one, true for the latest one that
+// wasn't rejected. Callers append their WHERE clause.
+const definitionSelect = `
+	SELECT d.definitionid, d.valsiid, v.word, l.tag, d.definitionnum,
+	       d.definition, d.notes, d.selmaho, d.userid, u.username, d.time,
+	       r.revision, r.definition, r.notes, r.selmaho, r.author_id, ru.username,
+	       r.comment, r.status, r.reviewed_by, r.reviewed_at, r.created_at,
+	       (SELECT COUNT(*) FROM definition_revisions p
+	        WHERE p.definition_id = d.definitionid AND p.status = 'pending')
+	FROM definitions d
+	JOIN valsi v ON v.valsiid = d.valsiid
+	JOIN languages l ON l.langid = d.langid
+	LEFT JOIN users u ON u.userid = d.userid
+	LEFT JOIN LATERAL (
+		SELECT * FROM definition_revisions r
+		WHERE r.definition_id = d.definitionid
+		  AND (r.status = 'approved' OR ($1::boolean AND r.status = 'pending'))
+		ORDER BY r.revision DESC
+		LIMIT 1
+	) r ON TRUE
+	LEFT JOIN users ru ON ru.userid = r.author_id`
+
+// scanDefinition reads one row of `definitionSelect`. The content comes from the chosen
+// revision; definitions without a recorded history fall back to the `definitions` row.
+func scanDefinition(row pgx.Row) (*DefinitionResponse, error) {
+	var (
+		d           DefinitionResponse
+		createdUnix int64
+		revNum      *int32
+		rev         RevisionResponse
+		revText     *string
+		revStatus   *string
+		revCreated  *time.Time
+	)
+	err := row.Scan(&d.DefinitionID, &d.ValsiID, &d.Word, &d.Language, &d.DefinitionNum,
+		&d.Definition, &d.Notes, &d.Selmaho, &d.AuthorID, &d.AuthorUsername, &createdUnix,
+		&revNum, &revText, &rev.Notes, &rev.Selmaho, &rev.AuthorID, &rev.AuthorUsername,
+		&rev.Comment, &revStatus, &rev.ReviewedBy, &rev.ReviewedAt, &revCreated,
+		&d.PendingRevisions)
+	if err != nil {
+		return nil, err
+	}
+	d.CreatedAt = time.Unix(createdUnix, 0).UTC()
+	if revNum != nil {
+		rev.Revision, rev.Definition, rev.Status, rev.CreatedAt = *revNum, *revText, *revStatus, *revCreated
+		d.Definition, d.Notes, d.Selmaho = rev.Definition, rev.Notes, rev.Selmaho
+		d.Revision = &rev
+	}
+	return &d, nil
+}
+
+// Get returns a definition with the content of its latest approved revision or, with
+// `includePending`, of its latest revision even if that is still waiting for review.
+func (s *DefinitionService) Get(ctx context.Context, definitionID int32, includePending bool) (*DefinitionResponse, error) {
+	d, err := scanDefinition(s.db.QueryRow(ctx, definitionSelect+`
+		WHERE d.definitionid = $2`, includePending, definitionID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("definition with ID %d not found", definitionID), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load definition", err)
+	}
+	definitions := []DefinitionResponse{*d}
+	if err := s.attachExamples(ctx, definitions); err != nil {
+		return nil, err
+	}
+	return &definitions[0], nil
+}
+
+// List returns the definitions of one word, by language and then position.
+func (s *DefinitionService) List(ctx context.Context, query ListDefinitionsQuery) ([]DefinitionResponse, error) {
+	if query.Word == "" && query.ValsiID == 0 {
+		return nil, apperror.NewBadRequestError("word or valsi_id is required", nil)
+	}
+	rows, err := s.db.Query(ctx, definitionSelect+`
+		WHERE ($2 = '' OR v.word = $2)
+		  AND ($3::int = 0 OR d.valsiid = $3)
+		  AND ($4 = '' OR lower(l.tag) = lower($4))
+		ORDER BY l.tag, d.definitionnum, d.definitionid`,
+		query.IncludePending, query.Word, query.ValsiID, query.Language)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list definitions", err)
+	}
+	defer rows.Close()
+	definitions := []DefinitionResponse{}
+	for rows.Next() {
+		d, err := scanDefinition(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read definition", err)
+		}
+		definitions = append(definitions, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list definitions", err)
+	}
+	if err := s.attachExamples(ctx, definitions); err != nil {
+		return nil, err
+	}
+	return definitions, nil
+}
+
+// attachExamples fills in the approved examples of each definition.
+func (s *DefinitionService) attachExamples(ctx context.Context, definitions []DefinitionResponse) error {
+	ids := make([]int32, len(definitions))
+	for i, d := range definitions {
+		ids[i] = d.DefinitionID
+	}
+	byDefinition, err := s.examples.ApprovedFor(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range definitions {
+		definitions[i].Examples = byDefinition[definitions[i].DefinitionID]
+		if definitions[i].Examples == nil {
+			definitions[i].Examples = []examples.ExampleResponse{}
+		}
+	}
+	return nil
+}
+
+// Create adds a definition to an existing word. It is published right away as revision 1.
+func (s *DefinitionService) Create(ctx context.Context, userID int, req CreateDefinitionRequest) (*DefinitionResponse, error) {
+	word := strings.TrimSpace(req.Word)
+	language := strings.TrimSpace(req.Language)
+	text := strings.TrimSpace(req.Definition)
+	notes := strings.TrimSpace(req.Notes)
+	selmaho := strings.TrimSpace(req.Selmaho)
+	if word == "" || language == "" {
+		return nil, apperror.NewBadRequestError("word and language are required", nil)
+	}
+	if err := validateContent(text, notes); err != nil {
+		return nil, err
+	}
+
+	var definitionID int32
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		// Locking the word serializes concurrent additions, which would otherwise pick the same
+		// definitionnum.
+		var valsiID int32
+		err := tx.QueryRow(ctx, `SELECT valsiid FROM valsi WHERE word = $1 FOR UPDATE`, word).Scan(&valsiID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewNotFoundError(fmt.Sprintf("word %q not found", word), nil)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to look up word", err)
+		}
+		var langID int32
+		err = tx.QueryRow(ctx, `SELECT langid FROM languages WHERE lower(tag) = lower($1)`, language).Scan(&langID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewBadRequestError(fmt.Sprintf("unknown language %q", language), nil)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to look up language", err)
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO definitions (langid, valsiid, definitionnum, definition, notes, selmaho, userid, time)
+			VALUES ($1, $2,
+			        (SELECT COALESCE(MAX(definitionnum), 0) + 1 FROM definitions WHERE valsiid = $2 AND langid = $1),
+			        $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+			RETURNING definitionid`,
+			langID, valsiID, text, notes, selmaho, userID, time.Now().Unix()).Scan(&definitionID)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to create definition", err)
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO definition_revisions (definition_id, revision, definition, notes, selmaho, author_id, status)
+			VALUES ($1, 1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, 'approved')`,
+			definitionID, text, notes, selmaho, userID)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to record revision", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, definitionID, false)
+}
+
+// Update records an edit as a new revision and publishes it if the editor may approve it
+// (see the file comment). The edit applies to the latest approved content.
+func (s *DefinitionService) Update(ctx context.Context, definitionID int32, userID int, req UpdateDefinitionRequest) (*RevisionResponse, error) {
+	var rev RevisionResponse
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		// The row lock serializes edits, which would otherwise pick the same revision number.
+		current, err := lockDefinition(ctx, tx, definitionID, userID)
+		if err != nil {
+			return err
+		}
+
+		text, notes, selmaho := current.definition, deref(current.notes), deref(current.selmaho)
+		if req.Definition != nil {
+			text = strings.TrimSpace(*req.Definition)
+		}
+		if req.Notes != nil {
+			notes = strings.TrimSpace(*req.Notes)
+		}
+		if req.Selmaho != nil {
+			selmaho = strings.TrimSpace(*req.Selmaho)
+		}
+		if err := validateContent(text, notes); err != nil {
+			return err
+		}
+		if text == current.definition && notes == deref(current.notes) && selmaho == deref(current.selmaho) {
+			return apperror.NewBadRequestError("the edit doesn't change anything", nil)
+		}
+
+		status := StatusPending
+		if current.authorID == int32(userID) || current.editorRole == auth.RoleTrusted || current.editorRole == auth.RoleAdmin {
+			status = StatusApproved
+		}
+		rev = RevisionResponse{Definition: text, Notes: nullable(notes), Selmaho: nullable(selmaho), Status: status}
+		authorID := int32(userID)
+		rev.AuthorID = &authorID
+		rev.Comment = nullable(strings.TrimSpace(req.Comment))
+		err = tx.QueryRow(ctx, `
+			INSERT INTO definition_revisions (definition_id, revision, definition, notes, selmaho, author_id, comment, status)
+			SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5, $6, $7
+			FROM definition_revisions WHERE definition_id = $1
+			RETURNING revision, created_at`,
+			definitionID, rev.Definition, rev.Notes, rev.Selmaho, authorID, rev.Comment, status).Scan(&rev.Revision, &rev.CreatedAt)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to record revision", err)
+		}
+		if status == StatusApproved {
+			if err := applyRevision(ctx, tx, definitionID, rev); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// Delete removes a definition together with its history, glosses and votes. Only its author
+// or an admin may delete it. The deletion is audited with the content it removed.
+func (s *DefinitionService) Delete(ctx context.Context, definitionID int32, userID int) error {
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		current, err := lockDefinition(ctx, tx, definitionID, userID)
+		if err != nil {
+			return err
+		}
+		if current.authorID != int32(userID) && current.editorRole != auth.RoleAdmin {
+			return apperror.NewUnauthorizedError("only the author or an admin can delete a definition", nil)
+		}
+
+		for _, stmt := range []string{
+			`DELETE FROM keywordmapping WHERE definitionid = $1`,
+			`DELETE FROM definitionvotes WHERE definitionid = $1`,
+			`DELETE FROM definitions WHERE definitionid = $1`,
+		} {
+			if _, err := tx.Exec(ctx, stmt, definitionID); err != nil {
+				var pgErr *pgconn.PgError
+				if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+					return apperror.NewConflictError("the definition is still referenced and can't be deleted", err).WithCode(apperror.CodeStillReferenced)
+				}
+				return apperror.NewDatabaseError("failed to delete definition", err)
+			}
+		}
+		return audit.Record(ctx, tx, audit.Entry{
+			ActorID:    userID,
+			Action:     audit.ActionDefinitionDelete,
+			TargetType: audit.TargetDefinition,
+			TargetID:   strconv.Itoa(int(definitionID)),
+			Before: map[string]any{
+				"author_id":  current.authorID,
+				"definition": current.definition,
+				"notes":      current.notes,
+				"selmaho":    current.selmaho,
+			},
+		})
+	})
+}
+
+// lockedDefinition is the current (approved) state of a definition locked for a change, and
+// the role of the user making it.
+type lockedDefinition struct {
+	authorID   int32
+	definition string
+	notes      *string
+	selmaho    *string
+	editorRole string
+}
+
+// lockDefinition locks the definition row until the end of `tx`.
+func lockDefinition(ctx context.Context, tx pgx.Tx, definitionID int32, userID int) (*lockedDefinition, error) {
+	var d lockedDefinition
+	err := tx.QueryRow(ctx, `
+		SELECT d.userid, d.definition, d.notes, d.selmaho,
+		       COALESCE((SELECT role FROM users WHERE userid = $2), '')
+		FROM definitions d
+		WHERE d.definitionid = $1
+		FOR UPDATE`, definitionID, userID).Scan(&d.authorID, &d.definition, &d.notes, &d.selmaho, &d.editorRole)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("definition with ID %d not found", definitionID), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load definition", err)
+	}
+	return &d, nil
+}
+
+// applyRevision publishes approved content to `definitions`. A changed text marks the
+// embedding stale; the old vector keeps serving search until the new one is stored.
+func applyRevision(ctx context.Context, tx pgx.Tx, definitionID int32, rev RevisionResponse) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE definitions
+		SET embedding_stale = embedding_stale OR (embedding IS NOT NULL AND definition IS DISTINCT FROM $2),
+		    embedding_attempts = CASE WHEN definition IS DISTINCT FROM $2 THEN 0 ELSE embedding_attempts END,
+		    definition = $2, notes = $3, selmaho = $4
+		WHERE definitionid = $1`, definitionID, rev.Definition, rev.Notes, rev.Selmaho)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to publish revision", err)
+	}
+	return nil
+}
+
+func validateContent(text, notes string) error {
+	if text == "" {
+		return apperror.NewBadRequestError("definition text is required", nil)
+	}
+	if utf8.RuneCountInString(text) > maxDefinitionLength || utf8.RuneCountInString(notes) > 2*maxDefinitionLength {
+		return apperror.NewBadRequestError(fmt.Sprintf("definitions are limited to %d characters and notes to %d", maxDefinitionLength, 2*maxDefinitionLength), nil)
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// nullable maps "" to NULL.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,364 @@
+// Package digest compiles and emails periodic activity digests: the unread replies to the
+// user's comments, the most active threads, and newly added definitions.
+// Users opt out through the `digest_frequency` preference, which every digest email can
+// switch off with a one-click unsubscribe link (see `unsubscribe.go`).
+// The scheduler follows the same start/stop-channel pattern as the `background` services.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/email"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/leader"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/notifications"
+	"github.com/user/lensisku-go/users"
+)
+
+// Limits on how much each digest section lists.
+const (
+	maxRepliesListed     = 10
+	maxTrendingThreads   = 5
+	maxDefinitionsListed = 10
+)
+
+// Service compiles and sends digests.
+type Service struct {
+	db            *pgxpool.Pool
+	queue         *jobs.Queue // Digests are delivered by the job workers (see `email/job.go`)
+	users         *users.UserService
+	cfg           *config.DigestConfig
+	publicBaseURL string
+	secret        []byte // Signs unsubscribe tokens
+	logger        *slog.Logger
+}
+
+// NewService creates a digest Service. `secret` signs unsubscribe links; the JWT secret is a
+// good choice since it is already required and private.
+func NewService(db *pgxpool.Pool, queue *jobs.Queue, userService *users.UserService, cfg *config.DigestConfig, publicBaseURL string, secret string) *Service {
+	return &Service{
+		db:            db,
+		queue:         queue,
+		users:         userService,
+		cfg:           cfg,
+		publicBaseURL: publicBaseURL,
+		secret:        []byte(secret),
+		logger:        logging.For("digest"),
+	}
+}
+
+// recipient is a user who is due for a digest.
+type recipient struct {
+	UserID     int
+	Username   string
+	Email      string
+	LastSentAt *time.Time
+}
+
+// Reply is a reply to one of the recipient's comments.
+type Reply struct {
+	CommentID int32
+	ThreadID  int32
+	Author    string
+	Subject   string
+	Time      time.Time
+}
+
+// TrendingThread is a thread with a lot of recent activity.
+type TrendingThread struct {
+	ThreadID int32
+	Subject  string
+	Comments int64
+}
+
+// NewDefinition is a recently added definition.
+type NewDefinition struct {
+	Word       string
+	Definition string
+}
+
+// Digest is everything that goes into one user's email.
+type Digest struct {
+	Username       string
+	Since          time.Time
+	Replies        []Reply
+	TotalReplies   int64
+	Trending       []TrendingThread
+	Definitions    []NewDefinition
+	NewDefinitions int64
+	BaseURL        string
+	UnsubscribeURL string
+}
+
+// empty reports whether there is nothing worth sending.
+func (d *Digest) empty() bool {
+	return d.TotalReplies == 0 && len(d.Trending) == 0 && d.NewDefinitions == 0
+}
+
+// shared holds the sections that are the same for every recipient in a run.
+type shared struct {
+	trending       []TrendingThread
+	definitions    []NewDefinition
+	newDefinitions int64
+}
+
+// Start runs the scheduler until `stopChan` is closed. Each tick sends digests to every
+// user who is due; a user is due when their last digest is at least `cfg.Interval` old.
+// Ticks are skipped unless `elector` has chosen this instance as leader, so replicas don't
+// race to queue the same digests.
+func (s *Service) Start(elector *leader.Elector, stopChan <-chan struct{}) {
+	go func() {
+		defer s.logger.Info("Digest scheduler stopped")
+		ticker := time.NewTicker(s.cfg.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if elector.IsLeader() {
+				sent, err := s.RunOnce(context.Background(), stopChan)
+				if err != nil {
+					s.logger.Error("Digest run failed", "queued", sent, "error", err)
+				} else if sent > 0 {
+					s.logger.Info("Digests queued", "queued", sent)
+				}
+			}
+
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce queues digests for all due users and returns how many emails were queued.
+// Users whose digest is empty are marked as done without an email, so they aren't
+// re-examined until the next interval. Delivery failures are retried by the job queue.
+func (s *Service) RunOnce(ctx context.Context, stopChan <-chan struct{}) (int, error) {
+	windowStart := time.Now().Add(-s.cfg.Interval)
+	common, err := s.loadShared(ctx, windowStart)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	afterUserID := 0
+	for {
+		batch, err := s.dueRecipients(ctx, afterUserID)
+		if err != nil {
+			return sent, err
+		}
+		if len(batch) == 0 {
+			return sent, nil
+		}
+		for _, rcpt := range batch {
+			select {
+			case <-stopChan:
+				return sent, nil
+			default:
+			}
+			afterUserID = rcpt.UserID
+
+			since := windowStart
+			if rcpt.LastSentAt != nil && rcpt.LastSentAt.After(since) {
+				since = *rcpt.LastSentAt
+			}
+			d, err := s.compile(ctx, rcpt, since, common)
+			if err != nil {
+				s.logger.Error("Failed to compile digest", "user_id", rcpt.UserID, "error", err)
+				continue
+			}
+			if d.empty() {
+				if err := s.markSent(ctx, s.db, rcpt.UserID); err != nil {
+					return sent, err
+				}
+				continue
+			}
+			if err := s.send(ctx, rcpt, d); err != nil {
+				s.logger.Error("Failed to queue digest", "user_id", rcpt.UserID, "error", err)
+				continue
+			}
+			sent++
+		}
+	}
+}
+
+// dueRecipients loads the next batch of users due for a digest, ordered by ID for paging.
+func (s *Service) dueRecipients(ctx context.Context, afterUserID int) ([]recipient, error) {
+	defaultFrequency, _ := s.users.PreferenceDefault(users.PrefDigestFrequency).(string)
+	rows, err := s.db.Query(ctx, `
+		SELECT u.userid, u.username, u.email, d.last_sent_at
+		FROM users u
+		LEFT JOIN digest_deliveries d ON d.user_id = u.userid
+		WHERE u.userid > $1
+		  AND u.email <> ''
+		  AND (d.last_sent_at IS NULL OR d.last_sent_at <= NOW() - $2::interval)
+		  AND COALESCE(
+		        (SELECT p.value #>> '{}' FROM user_preferences p WHERE p.user_id = u.userid AND p.key = $3),
+		        $4) = 'weekly'
+		ORDER BY u.userid
+		LIMIT $5`,
+		afterUserID, s.cfg.Interval, users.PrefDigestFrequency, defaultFrequency, s.cfg.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load digest recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []recipient
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Email, &r.LastSentAt); err != nil {
+			return nil, fmt.Errorf("failed to read digest recipient: %w", err)
+		}
+		batch = append(batch, r)
+	}
+	return batch, rows.Err()
+}
+
+// loadShared loads the trending threads and new definitions since `since`.
+// `comments.time` and `definitions.time` are Unix timestamps.
+func (s *Service) loadShared(ctx context.Context, since time.Time) (*shared, error) {
+	common := &shared{}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT c.threadid,
+		       COALESCE((ARRAY_AGG(c.subject ORDER BY c.commentnum) FILTER (WHERE c.subject <> ''))[1], ''),
+		       COUNT(*) AS activity
+		FROM comments c
+		WHERE c.time > $1
+		GROUP BY c.threadid
+		ORDER BY activity DESC, c.threadid DESC
+		LIMIT $2`, since.Unix(), maxTrendingThreads)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trending threads: %w", err)
+	}
+	for rows.Next() {
+		var t TrendingThread
+		if err := rows.Scan(&t.ThreadID, &t.Subject, &t.Comments); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read trending thread: %w", err)
+		}
+		common.trending = append(common.trending, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load trending threads: %w", err)
+	}
+
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM definitions WHERE time > $1`, since.Unix()).Scan(&common.newDefinitions); err != nil {
+		return nil, fmt.Errorf("failed to count new definitions: %w", err)
+	}
+	rows, err = s.db.Query(ctx, `
+		SELECT v.word, d.definition
+		FROM definitions d
+		JOIN valsi v ON v.valsiid = d.valsiid
+		WHERE d.time > $1
+		ORDER BY d.time DESC
+		LIMIT $2`, since.Unix(), maxDefinitionsListed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load new definitions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d NewDefinition
+		if err := rows.Scan(&d.Word, &d.Definition); err != nil {
+			return nil, fmt.Errorf("failed to read new definition: %w", err)
+		}
+		common.definitions = append(common.definitions, d)
+	}
+	return common, rows.Err()
+}
+
+// compile assembles one recipient's digest. A reply is unread while its notification is; one
+// left unread shows up again in the next digest. Replies from users the recipient blocked or
+// muted are left out.
+func (s *Service) compile(ctx context.Context, rcpt recipient, since time.Time, common *shared) (*Digest, error) {
+	d := &Digest{
+		Username:       rcpt.Username,
+		Since:          since,
+		Trending:       common.trending,
+		Definitions:    common.definitions,
+		NewDefinitions: common.newDefinitions,
+		BaseURL:        s.publicBaseURL,
+		UnsubscribeURL: s.unsubscribeURL(rcpt.UserID),
+	}
+
+	const replyFilter = `
+		FROM notifications n
+		JOIN comments c ON c.commentid = n.comment_id
+		JOIN users u ON u.userid = c.userid
+		WHERE n.user_id = $1 AND n.notification_type = '` + notifications.TypeReply + `' AND n.read_at IS NULL
+		  AND c.userid NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $1)`
+
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) `+replyFilter, rcpt.UserID).Scan(&d.TotalReplies); err != nil {
+		return nil, fmt.Errorf("failed to count replies: %w", err)
+	}
+	if d.TotalReplies == 0 {
+		return d, nil
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT c.commentid, c.threadid, u.username, COALESCE(c.subject, ''), c.time `+replyFilter+`
+		ORDER BY c.time DESC
+		LIMIT $2`, rcpt.UserID, maxRepliesListed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replies: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Reply
+		var unix int32
+		if err := rows.Scan(&r.CommentID, &r.ThreadID, &r.Author, &r.Subject, &unix); err != nil {
+			return nil, fmt.Errorf("failed to read reply: %w", err)
+		}
+		r.Time = time.Unix(int64(unix), 0).UTC()
+		d.Replies = append(d.Replies, r)
+	}
+	return d, rows.Err()
+}
+
+// send renders a digest, with List-Unsubscribe headers for one-click unsubscribe (RFC 8058),
+// and queues it. The email job and the delivery record are written in one transaction, so a
+// digest is neither lost nor queued twice when the scheduler stops halfway.
+func (s *Service) send(ctx context.Context, rcpt recipient, d *Digest) error {
+	text, html, err := render(d)
+	if err != nil {
+		return err
+	}
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		_, err := email.EnqueueTx(ctx, s.queue, tx, email.Message{
+			To:      rcpt.Email,
+			Subject: "Your Lensisku activity digest",
+			Text:    text,
+			HTML:    html,
+			Headers: map[string]string{
+				"List-Unsubscribe":      "<" + d.UnsubscribeURL + ">",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+			},
+		})
+		if err != nil {
+			return err
+		}
+		return s.markSent(ctx, tx, rcpt.UserID)
+	})
+}
+
+// markSent records that the user's digest for this interval is done.
+func (s *Service) markSent(ctx context.Context, q db.Execer, userID int) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO digest_deliveries (user_id, last_sent_at) VALUES ($1, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET last_sent_at = EXCLUDED.last_sent_at`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to record digest delivery: %w", err)
+	}
+	return nil
+}
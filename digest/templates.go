@@ -0,0 +1,78 @@
+// Package digest, as part of the digest module.
+// This file, `templates.go`, renders a `Digest` as plain text and HTML.
+// `html/template` escapes user-provided content (usernames, subjects, definitions) automatically.
+package digest
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+var templateFuncs = map[string]interface{}{
+	"truncate": func(s string, n int) string {
+		r := []rune(strings.TrimSpace(s))
+		if len(r) <= n {
+			return string(r)
+		}
+		return string(r[:n]) + "…"
+	},
+}
+
+var textTemplate = texttemplate.Must(texttemplate.New("digest.txt").Funcs(templateFuncs).Parse(`Hi {{.Username}},
+
+here is what happened on Lensisku since {{.Since.Format "2 January 2006"}}.
+{{if .TotalReplies}}
+Unread replies to your comments ({{.TotalReplies}}):
+{{range .Replies}}  - {{.Author}}{{if .Subject}}: {{truncate .Subject 80}}{{end}}
+    {{$.BaseURL}}/comments?thread_id={{.ThreadID}}&scroll_to={{.CommentID}}
+{{end}}{{end}}{{if .Trending}}
+Active discussions:
+{{range .Trending}}  - {{if .Subject}}{{truncate .Subject 80}}{{else}}Thread #{{.ThreadID}}{{end}} ({{.Comments}} new comments)
+    {{$.BaseURL}}/comments?thread_id={{.ThreadID}}
+{{end}}{{end}}{{if .NewDefinitions}}
+New definitions ({{.NewDefinitions}}):
+{{range .Definitions}}  - {{.Word}}: {{truncate .Definition 100}}
+{{end}}{{end}}
+--
+You receive this email because activity digests are enabled for your account.
+Unsubscribe: {{.UnsubscribeURL}}
+`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(templateFuncs).Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif;">
+<p>Hi {{.Username}},</p>
+<p>here is what happened on Lensisku since {{.Since.Format "2 January 2006"}}.</p>
+{{if .TotalReplies}}
+<h3>Unread replies to your comments ({{.TotalReplies}})</h3>
+<ul>{{range .Replies}}
+  <li><a href="{{$.BaseURL}}/comments?thread_id={{.ThreadID}}&amp;scroll_to={{.CommentID}}">{{.Author}}{{if .Subject}}: {{truncate .Subject 80}}{{end}}</a></li>{{end}}
+</ul>{{end}}
+{{if .Trending}}
+<h3>Active discussions</h3>
+<ul>{{range .Trending}}
+  <li><a href="{{$.BaseURL}}/comments?thread_id={{.ThreadID}}">{{if .Subject}}{{truncate .Subject 80}}{{else}}Thread #{{.ThreadID}}{{end}}</a> ({{.Comments}} new comments)</li>{{end}}
+</ul>{{end}}
+{{if .NewDefinitions}}
+<h3>New definitions ({{.NewDefinitions}})</h3>
+<ul>{{range .Definitions}}
+  <li><b>{{.Word}}</b>: {{truncate .Definition 100}}</li>{{end}}
+</ul>{{end}}
+<hr>
+<p style="font-size: small; color: #666;">You receive this email because activity digests are enabled for your account.
+<a href="{{.UnsubscribeURL}}">Unsubscribe</a></p>
+</body></html>
+`))
+
+// render produces the text and HTML bodies of a digest.
+func render(d *Digest) (text string, html string, err error) {
+	var tb, hb bytes.Buffer
+	if err := textTemplate.Execute(&tb, d); err != nil {
+		return "", "", err
+	}
+	if err := htmlTemplate.Execute(&hb, d); err != nil {
+		return "", "", err
+	}
+	return tb.String(), hb.String(), nil
+}
@@ -0,0 +1,130 @@
+// Package digest, as part of the digest module.
+// This file, `unsubscribe.go`, implements one-click unsubscribe. Each digest carries a link with
+// a token that identifies the user and is signed with HMAC-SHA256, so it works without logging in
+// but cannot be forged for other accounts. Tokens don't expire: the link in an old digest must
+// keep working. Following the link (GET) only shows a confirmation form, since mail scanners
+// and prefetchers follow links too; posting it, or the RFC 8058 one-click POST that mail
+// clients send, sets the user's `digest_frequency` preference to "off".
+package digest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/users"
+)
+
+// unsubscribePurpose is mixed into the signature so these tokens can't be reused for other features.
+const unsubscribePurpose = "digest-unsubscribe:"
+
+// unsubscribeToken returns "<userID>.<signature>".
+func (s *Service) unsubscribeToken(userID int) string {
+	id := strconv.Itoa(userID)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(unsubscribePurpose + id))
+	return id + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseUnsubscribeToken verifies a token and returns the user ID it was issued for.
+func (s *Service) parseUnsubscribeToken(token string) (int, bool) {
+	id, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, false
+	}
+	userID, err := strconv.Atoi(id)
+	if err != nil || userID <= 0 {
+		return 0, false
+	}
+	if !hmac.Equal([]byte(token), []byte(s.unsubscribeToken(userID))) {
+		return 0, false
+	}
+	return userID, true
+}
+
+func (s *Service) unsubscribeURL(userID int) string {
+	return s.publicBaseURL + "/digest/unsubscribe?token=" + url.QueryEscape(s.unsubscribeToken(userID))
+}
+
+// Handlers exposes the digest HTTP endpoints.
+type Handlers struct {
+	service *Service
+}
+
+// NewHandlers creates digest Handlers.
+func NewHandlers(service *Service) *Handlers {
+	return &Handlers{service: service}
+}
+
+// confirmPage asks to confirm the unsubscription; the form posts back to the same link.
+var confirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html><html><body>
+<form method="post" action="?token={{.}}">
+<p>Stop receiving Lensisku activity digests?</p>
+<button type="submit">Unsubscribe</button>
+</form></body></html>`))
+
+// errInvalidUnsubscribeToken is returned for a token that isn't one of ours.
+var errInvalidUnsubscribeToken = apperror.NewBadRequestError("invalid unsubscribe link", nil)
+
+// HandleConfirmUnsubscribe godoc
+// @Summary Confirm unsubscribing from activity digests
+// @Description Target of the unsubscribe link in digest emails. Shows a form that posts to /digest/unsubscribe;
+// @Description following the link changes nothing, as link scanners follow it too.
+// @Tags digest
+// @Produce html
+// @Param token query string true "Signed unsubscribe token from the email"
+// @Success 200 {string} string "Confirmation form"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid token"
+// @Router /digest/unsubscribe [get]
+func (h *Handlers) HandleConfirmUnsubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if _, ok := h.service.parseUnsubscribeToken(token); !ok {
+			auth.WriteError(w, r, errInvalidUnsubscribeToken)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		confirmPage.Execute(w, token)
+	}
+}
+
+// HandleUnsubscribe godoc
+// @Summary Unsubscribe from activity digests
+// @Description Posted by the confirmation form, or by mail clients as the RFC 8058 one-click unsubscribe
+// @Description (List-Unsubscribe-Post). Sets the user's digest_frequency preference to "off".
+// @Tags digest
+// @Produce html
+// @Param token query string true "Signed unsubscribe token from the email"
+// @Success 200 {string} string "Unsubscribed"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /digest/unsubscribe [post]
+func (h *Handlers) HandleUnsubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := h.service.parseUnsubscribeToken(r.URL.Query().Get("token"))
+		if !ok {
+			auth.WriteError(w, r, errInvalidUnsubscribeToken)
+			return
+		}
+
+		if err := h.service.users.SetPreference(r.Context(), userID, users.PrefDigestFrequency, "off"); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`<!DOCTYPE html><html><body><p>You have been unsubscribed from Lensisku activity digests.
+You can turn them back on in your preferences.</p></body></html>`))
+	}
+}
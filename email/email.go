@@ -0,0 +1,260 @@
+// Package email sends outgoing mail. Features that email users (digests, verification,
+// password reset, notifications) render a template (`templates.go`) and queue the message
+// (`job.go`); the job worker delivers it through the `Sender` interface, so the transport can
+// be swapped: SMTP in production, the log in development and tests.
+// In Nest.js this would be a mailer module (e.g. `@nestjs-modules/mailer`) injected as a provider.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+// Message is a single email with a plain-text body and an optional HTML alternative.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are extra headers such as List-Unsubscribe.
+	Headers map[string]string
+}
+
+// errInvalidAddress wraps address parse errors; no retry can fix those.
+var errInvalidAddress = errors.New("invalid email address")
+
+// IsPermanent reports whether a send error will recur on retry: a malformed address, or a
+// 5xx reply from the SMTP server (e.g. "550 mailbox unavailable"). Connection failures and
+// 4xx replies (greylisting, rate limits) are transient.
+func IsPermanent(err error) bool {
+	if errors.Is(err, errInvalidAddress) {
+		return true
+	}
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr) && smtpErr.Code >= 500
+}
+
+// Sender delivers messages.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender returns an SMTP sender when SMTP is configured, and a LogSender otherwise.
+func NewSender(cfg *config.EmailConfig) Sender {
+	if cfg.SMTPHost == "" {
+		logger := logging.For("email")
+		logger.Warn("SMTP_HOST is not set; outgoing emails will be logged instead of sent")
+		return LogSender{logger: logger}
+	}
+	return &SMTPSender{cfg: cfg}
+}
+
+// LogSender writes emails to the log instead of sending them.
+type LogSender struct {
+	logger *slog.Logger
+}
+
+// Send logs the message.
+func (s LogSender) Send(ctx context.Context, msg Message) error {
+	s.logger.InfoContext(ctx, "Email (not sent)", "to", msg.To, "subject", msg.Subject, "text", msg.Text)
+	return nil
+}
+
+// SMTPSender delivers mail through an SMTP server, encrypted as SMTP_TLS_MODE says.
+type SMTPSender struct {
+	cfg *config.EmailConfig
+}
+
+// Send builds a MIME message and hands it to the SMTP server.
+// `net/smtp` has no context support, so `ctx` only bounds connecting; the whole exchange is
+// bounded by SMTP_TIMEOUT.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.cfg.FromAddress)
+	if err != nil {
+		return fmt.Errorf("%w: EMAIL_FROM: %v", errInvalidAddress, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: recipient %q: %v", errInvalidAddress, msg.To, err)
+	}
+
+	body, err := buildMIME(from, to, msg)
+	if err != nil {
+		return err
+	}
+
+	c, addr, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := deliver(c, from.Address, to.Address, body); err != nil {
+		return fmt.Errorf("failed to send email via %s: %w", addr, err)
+	}
+	return nil
+}
+
+// deliver runs the mail transaction of one message on an open connection.
+func deliver(c *smtp.Client, from, to string, body []byte) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// CheckSMTP connects to the SMTP server of `cfg` and authenticates without sending anything,
+// so that wrong settings show up at startup rather than on the first email.
+func CheckSMTP(ctx context.Context, cfg *config.EmailConfig) error {
+	c, _, err := (&SMTPSender{cfg: cfg}).connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
+
+// connect opens a connection to the SMTP server, secures it as SMTP_TLS_MODE says and logs in
+// when a username is configured. It returns the client and the server address, for errors.
+func (s *SMTPSender) connect(ctx context.Context) (*smtp.Client, string, error) {
+	addr := net.JoinHostPort(s.cfg.SMTPHost, strconv.Itoa(s.cfg.SMTPPort))
+	tlsConfig := &tls.Config{ServerName: s.cfg.SMTPHost}
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLSMode == config.SMTPTLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, addr, fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	c, err := smtp.NewClient(conn, s.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return nil, addr, fmt.Errorf("SMTP server %s: %w", addr, err)
+	}
+	if s.cfg.TLSMode == config.SMTPTLSStartTLS || s.cfg.TLSMode == config.SMTPTLSOpportunistic {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				c.Close()
+				return nil, addr, fmt.Errorf("STARTTLS with SMTP server %s failed: %w", addr, err)
+			}
+		} else if s.cfg.TLSMode == config.SMTPTLSStartTLS {
+			c.Close()
+			return nil, addr, fmt.Errorf("SMTP server %s doesn't offer STARTTLS, which SMTP_TLS_MODE=starttls requires", addr)
+		}
+	}
+	if s.cfg.SMTPUsername != "" {
+		// PlainAuth itself refuses to send the password unencrypted, except to localhost.
+		auth := smtp.PlainAuth("", s.cfg.SMTPUsername, s.cfg.SMTPPassword, s.cfg.SMTPHost)
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, addr, fmt.Errorf("SMTP authentication with %s failed: %w", addr, err)
+		}
+	}
+	return c, addr, nil
+}
+
+// buildMIME renders the message as multipart/alternative (or text/plain when there is no HTML part).
+func buildMIME(from, to *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	headers := map[string]string{
+		"From":         from.String(),
+		"To":           to.String(),
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"MIME-Version": "1.0",
+	}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	boundary := ""
+	if msg.HTML != "" {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		boundary = "lensisku-" + hex.EncodeToString(b)
+		headers["Content-Type"] = `multipart/alternative; boundary="` + boundary + `"`
+	} else {
+		headers["Content-Type"] = "text/plain; charset=utf-8"
+		headers["Content-Transfer-Encoding"] = "quoted-printable"
+	}
+
+	// Stable header order keeps messages diffable in logs.
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Header values must not contain line breaks (header injection).
+		v := strings.NewReplacer("\r", "", "\n", "").Replace(headers[k])
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	buf.WriteString("\r\n")
+
+	if boundary == "" {
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\nContent-Type: %s\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", boundary, part.contentType)
+		if err := writeQuotedPrintable(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, s string) error {
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		return err
+	}
+	return w.Close()
+}
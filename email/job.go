@@ -0,0 +1,55 @@
+// Package email, as part of the email module.
+// This file, `job.go`, lets emails be sent through the job queue: the message is stored as a
+// job and delivered by a worker, so a slow or unavailable SMTP server neither delays the
+// request that triggered the email nor loses it. Transient failures are retried with the
+// queue's backoff; permanent ones (see `IsPermanent`) are dead-lettered at once.
+package email
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/jobs"
+)
+
+// SendJobType is the job type of queued emails; the payload is a `Message`.
+const SendJobType = "email.send"
+
+// Enqueue queues `msg` for delivery by the job workers.
+func Enqueue(ctx context.Context, queue *jobs.Queue, msg Message) (int64, error) {
+	return queue.Enqueue(ctx, SendJobType, msg, nil)
+}
+
+// EnqueueTx queues `msg` inside the caller's transaction, so the email is sent if and only if
+// the transaction commits.
+func EnqueueTx(ctx context.Context, queue *jobs.Queue, tx pgx.Tx, msg Message) (int64, error) {
+	return queue.EnqueueTx(ctx, tx, SendJobType, msg, nil)
+}
+
+// EnqueueTemplate renders template `name` for `to` and queues the result.
+func EnqueueTemplate(ctx context.Context, queue *jobs.Queue, name, to string, data any) (int64, error) {
+	msg, err := Render(name, to, data)
+	if err != nil {
+		return 0, err
+	}
+	return Enqueue(ctx, queue, msg)
+}
+
+// SendJobHandler delivers queued emails with `sender`.
+func SendJobHandler(sender Sender) jobs.HandlerFunc {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var msg Message
+		if err := job.Decode(&msg); err != nil {
+			return fmt.Errorf("invalid email job payload: %w", err)
+		}
+		if err := sender.Send(ctx, msg); err != nil {
+			if IsPermanent(err) {
+				return jobs.Permanent(err)
+			}
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,216 @@
+// Package email, as part of the email module.
+// This file, `templates.go`, holds the transactional email templates. Each template has a
+// subject, a plain-text body and an HTML body, rendered from the same data; `html/template`
+// escapes user-provided content automatically. Features render a template into a `Message`
+// and queue it with `Enqueue` (see `job.go`).
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Names of the built-in templates.
+const (
+	TemplateVerification  = "verification"
+	TemplatePasswordReset = "password_reset"
+	TemplateNotification  = "notification"
+)
+
+// VerificationData fills TemplateVerification.
+type VerificationData struct {
+	Username  string
+	VerifyURL string
+}
+
+// PasswordResetData fills TemplatePasswordReset.
+type PasswordResetData struct {
+	Username  string
+	ResetURL  string
+	ExpiresIn string // Human-readable, e.g. "1 hour"
+}
+
+// NotificationData fills TemplateNotification.
+type NotificationData struct {
+	Username string
+	Title    string
+	Body     string
+	URL      string
+	// SettingsURL points to where the user can turn these emails off.
+	SettingsURL string
+}
+
+// Template is a named email template.
+type Template struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+var templateFuncs = map[string]interface{}{
+	"truncate": func(s string, n int) string {
+		r := []rune(strings.TrimSpace(s))
+		if len(r) <= n {
+			return string(r)
+		}
+		return string(r[:n]) + "…"
+	},
+}
+
+// templates is the registry used by Render.
+var templates = map[string]*Template{}
+
+// MustRegisterTemplate parses and registers a template; it panics on a parse error, so it is
+// meant for package-level setup. Registering a name twice replaces the earlier template.
+func MustRegisterTemplate(name, subject, text, html string) {
+	templates[name] = &Template{
+		subject: texttemplate.Must(texttemplate.New(name + ".subject").Funcs(templateFuncs).Parse(subject)),
+		text:    texttemplate.Must(texttemplate.New(name + ".txt").Funcs(templateFuncs).Parse(text)),
+		html:    htmltemplate.Must(htmltemplate.New(name + ".html").Funcs(templateFuncs).Parse(html)),
+	}
+}
+
+// templateParts are the file extensions of the parts of a template in EMAIL_TEMPLATE_DIR.
+var templateParts = []string{".subject", ".txt", ".html"}
+
+// LoadTemplateDir replaces parts of the registered templates with the files of `dir`: the
+// subject, plain-text and HTML bodies of template `name` are read from `name.subject`,
+// `name.txt` and `name.html`, e.g. `password_reset.html`. Missing files keep the built-in
+// part. Files for unknown templates and templates that don't parse are errors, so a typo
+// doesn't silently leave the built-in version in place.
+func LoadTemplateDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read email template directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		t, ok := templates[name]
+		if !ok || !slices.Contains(templateParts, ext) {
+			return fmt.Errorf("email template file %s: expected <template>.subject, .txt or .html, with one of the templates %s", entry.Name(), strings.Join(templateNames(), ", "))
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("read email template: %w", err)
+		}
+		switch ext {
+		case ".subject":
+			t.subject, err = texttemplate.New(entry.Name()).Funcs(templateFuncs).Parse(string(data))
+		case ".txt":
+			t.text, err = texttemplate.New(entry.Name()).Funcs(templateFuncs).Parse(string(data))
+		case ".html":
+			t.html, err = htmltemplate.New(entry.Name()).Funcs(templateFuncs).Parse(string(data))
+		}
+		if err != nil {
+			return fmt.Errorf("parse email template %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// templateNames returns the names of the registered templates, sorted.
+func templateNames() []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render builds the message for template `name` addressed to `to`.
+func Render(name, to string, data any) (Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+	var subject, text, html bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return Message{}, fmt.Errorf("render %s subject: %w", name, err)
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("render %s text: %w", name, err)
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return Message{}, fmt.Errorf("render %s HTML: %w", name, err)
+	}
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func init() {
+	MustRegisterTemplate(TemplateVerification,
+		`Confirm your Lensisku email address`,
+		`Hi {{.Username}},
+
+please confirm your email address by opening this link:
+
+{{.VerifyURL}}
+
+If you didn't create a Lensisku account, you can ignore this email.
+`,
+		`<!DOCTYPE html>
+<html><body style="font-family: sans-serif;">
+<p>Hi {{.Username}},</p>
+<p>please confirm your email address:</p>
+<p><a href="{{.VerifyURL}}">Confirm email address</a></p>
+<p style="font-size: small; color: #666;">If you didn't create a Lensisku account, you can ignore this email.</p>
+</body></html>
+`)
+
+	MustRegisterTemplate(TemplatePasswordReset,
+		`Reset your Lensisku password`,
+		`Hi {{.Username}},
+
+someone asked to reset the password of your Lensisku account. To choose a new password,
+open this link{{if .ExpiresIn}} within {{.ExpiresIn}}{{end}}:
+
+{{.ResetURL}}
+
+If it wasn't you, ignore this email; your password stays the same.
+`,
+		`<!DOCTYPE html>
+<html><body style="font-family: sans-serif;">
+<p>Hi {{.Username}},</p>
+<p>someone asked to reset the password of your Lensisku account.</p>
+<p><a href="{{.ResetURL}}">Choose a new password</a>{{if .ExpiresIn}} (valid for {{.ExpiresIn}}){{end}}</p>
+<p style="font-size: small; color: #666;">If it wasn't you, ignore this email; your password stays the same.</p>
+</body></html>
+`)
+
+	MustRegisterTemplate(TemplateNotification,
+		`{{truncate .Title 120}}`,
+		`Hi {{.Username}},
+
+{{.Body}}
+{{if .URL}}
+{{.URL}}
+{{end}}{{if .SettingsURL}}
+--
+Manage email notifications: {{.SettingsURL}}
+{{end}}`,
+		`<!DOCTYPE html>
+<html><body style="font-family: sans-serif;">
+<p>Hi {{.Username}},</p>
+<p>{{.Body}}</p>
+{{if .URL}}<p><a href="{{.URL}}">View on Lensisku</a></p>{{end}}
+{{if .SettingsURL}}<hr>
+<p style="font-size: small; color: #666;"><a href="{{.SettingsURL}}">Manage email notifications</a></p>{{end}}
+</body></html>
+`)
+}
@@ -0,0 +1,200 @@
+// Package embedding, as part of the embedding module.
+// This file, `budget.go`, keeps paid embedding APIs within limits. Requests are spaced out to
+// stay under `EMBEDDING_RATE_LIMIT`, and tokens are counted against a daily budget
+// (`EMBEDDING_DAILY_TOKEN_BUDGET`, or `EMBEDDING_DAILY_COST_BUDGET` converted with
+// `EMBEDDING_COST_PER_MILLION_TOKENS`). The day is the UTC calendar day.
+//
+// Spend is tracked per process and starts from zero after a restart; with several instances
+// each one gets the full budget.
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+// charsPerToken is the rough ratio used to estimate tokens before a request is sent, and to
+// count the ones a provider doesn't report.
+const charsPerToken = 4
+
+// BudgetExhaustedError is returned instead of calling the provider once the daily budget is
+// used up. Callers should put the work back and try again after `ResetAt`.
+type BudgetExhaustedError struct {
+	ResetAt time.Time
+}
+
+func (e *BudgetExhaustedError) Error() string {
+	return fmt.Sprintf("daily embedding budget exhausted until %s", e.ResetAt.Format(time.RFC3339))
+}
+
+// Usage is a snapshot of today's spend.
+// @Description Embedding provider spend for the current UTC day
+type Usage struct {
+	// UTC day the counters belong to
+	// example: "2026-10-17"
+	Day string `json:"day"`
+	// Provider requests sent today
+	// example: 120
+	Requests int64 `json:"requests"`
+	// Tokens used today, as reported by the provider or estimated
+	// example: 250000
+	Tokens int64 `json:"tokens"`
+	// Cost of today's tokens in USD; 0 when no price is configured
+	// example: 0.005
+	Cost float64 `json:"cost"`
+	// Daily token limit; 0 means unlimited
+	// example: 1000000
+	TokenBudget int64 `json:"token_budget"`
+	// Whether new requests are being deferred until the next day
+	// example: false
+	Exhausted bool `json:"exhausted"`
+	// When the counters start over
+	ResetAt time.Time `json:"reset_at"`
+	// Maximum provider requests per minute; 0 means unlimited
+	// example: 60
+	RateLimit int `json:"rate_limit"`
+}
+
+// Budget rate-limits provider requests and counts tokens against the daily limit. It is safe
+// for concurrent use; all batches of all callers share it.
+type Budget struct {
+	interval     time.Duration // Minimum spacing between requests; 0 means no rate limit
+	rateLimit    int
+	tokenBudget  int64
+	pricePerUnit float64 // USD per token
+	logger       *slog.Logger
+
+	mu       sync.Mutex
+	nextSlot time.Time // Earliest time the next request may start
+	day      time.Time // Start of the UTC day the counters below belong to
+	requests int64
+	tokens   int64
+	reserved int64 // Estimated tokens of requests in flight
+}
+
+// NewBudget creates the budget described by `cfg`. A cost budget is turned into tokens with
+// the configured price; when both limits are set the stricter one applies.
+func NewBudget(cfg *config.EmbeddingConfig) *Budget {
+	b := &Budget{
+		rateLimit:    cfg.RateLimit,
+		tokenBudget:  cfg.DailyTokenBudget,
+		pricePerUnit: cfg.CostPerMillionTokens / 1e6,
+		logger:       logging.For("embedding"),
+	}
+	if cfg.RateLimit > 0 {
+		b.interval = time.Minute / time.Duration(cfg.RateLimit)
+	}
+	if cfg.DailyCostBudget > 0 && b.pricePerUnit > 0 {
+		costTokens := int64(cfg.DailyCostBudget / b.pricePerUnit)
+		if b.tokenBudget == 0 || costTokens < b.tokenBudget {
+			b.tokenBudget = costTokens
+		}
+	}
+	return b
+}
+
+// Usage returns today's spend.
+func (b *Budget) Usage() Usage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rolloverLocked(time.Now())
+	return Usage{
+		Day:         b.day.Format(time.DateOnly),
+		Requests:    b.requests,
+		Tokens:      b.tokens,
+		Cost:        float64(b.tokens) * b.pricePerUnit,
+		TokenBudget: b.tokenBudget,
+		Exhausted:   b.tokenBudget > 0 && b.tokens+b.reserved >= b.tokenBudget,
+		ResetAt:     b.day.AddDate(0, 0, 1),
+		RateLimit:   b.rateLimit,
+	}
+}
+
+// Exhausted reports whether requests are currently being deferred.
+func (b *Budget) Exhausted() bool {
+	return b.Usage().Exhausted
+}
+
+// acquire reserves the estimated tokens of `texts` and waits for a rate-limit slot. It fails
+// with a *BudgetExhaustedError if the request would go over today's budget. Every successful
+// acquire must be followed by exactly one `release`.
+func (b *Budget) acquire(ctx context.Context, texts []string) (int64, error) {
+	estimate := estimateTokens(texts)
+
+	b.mu.Lock()
+	now := time.Now()
+	b.rolloverLocked(now)
+	if b.tokenBudget > 0 && b.tokens+b.reserved+estimate > b.tokenBudget {
+		resetAt := b.day.AddDate(0, 0, 1)
+		b.mu.Unlock()
+		return 0, &BudgetExhaustedError{ResetAt: resetAt}
+	}
+	b.reserved += estimate
+	slot := now
+	if b.interval > 0 {
+		if b.nextSlot.After(slot) {
+			slot = b.nextSlot
+		}
+		b.nextSlot = slot.Add(b.interval)
+	}
+	b.mu.Unlock()
+
+	if wait := time.Until(slot); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			// The slot is lost, which only makes the next request wait a little longer than needed.
+			b.release(estimate, 0, false)
+			return 0, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return estimate, nil
+}
+
+// release settles a reservation. Sent requests are counted with the tokens the provider
+// reported, or with the estimate when it reported none.
+func (b *Budget) release(estimate, used int64, sent bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reserved -= estimate
+	if !sent {
+		return
+	}
+	if used <= 0 {
+		used = estimate
+	}
+	b.requests++
+	b.tokens += used
+}
+
+// rolloverLocked resets the counters when a new UTC day has started.
+func (b *Budget) rolloverLocked(now time.Time) {
+	y, m, d := now.UTC().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if today.Equal(b.day) {
+		return
+	}
+	if !b.day.IsZero() {
+		b.logger.Info("Daily embedding spend", "metric", "embedding_spend", "day", b.day.Format(time.DateOnly),
+			"requests", b.requests, "tokens", b.tokens, "cost", float64(b.tokens)*b.pricePerUnit)
+	}
+	b.day = today
+	b.requests, b.tokens = 0, 0
+}
+
+// estimateTokens guesses the token count of `texts` from their length.
+func estimateTokens(texts []string) int64 {
+	var chars int
+	for _, t := range texts {
+		chars += len(t)
+	}
+	return int64(chars/charsPerToken + len(texts))
+}
@@ -0,0 +1,75 @@
+// Package embedding turns text into vectors for semantic search. The rest of the application
+// only sees the `Embedder` interface; which provider does the work is chosen by configuration:
+//
+//   - "openai": any server speaking the OpenAI embeddings API (`POST {base}/embeddings`).
+//     Besides OpenAI itself this covers llama.cpp's server and most hosted gateways.
+//   - "ollama": a local Ollama server (`POST {base}/api/embed`).
+//   - "none":   embeddings are disabled; `New` returns a nil Embedder.
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/tracing"
+)
+
+// Embedder computes embeddings. Implementations are safe for concurrent use.
+type Embedder interface {
+	// Embed returns one vector per input text, in the same order. Large inputs are split into
+	// requests of the configured batch size.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model identifies the model producing the vectors, e.g. "text-embedding-3-small".
+	Model() string
+	// Budget is the rate limit and daily spend shared by all requests of this embedder.
+	Budget() *Budget
+}
+
+// New creates the embedder selected by `cfg.Provider`. It returns (nil, nil) for "none".
+func New(cfg *config.EmbeddingConfig) (Embedder, error) {
+	// Provider calls show up in the traces of the requests and jobs that make them.
+	client := &http.Client{Timeout: cfg.Timeout, Transport: tracing.Transport(nil)}
+	budget := NewBudget(cfg)
+	switch cfg.Provider {
+	case config.EmbeddingProviderNone:
+		return nil, nil
+	case config.EmbeddingProviderOpenAI:
+		return &openAIEmbedder{client: client, baseURL: cfg.BaseURL, apiKey: cfg.APIKey, model: cfg.Model, batchSize: cfg.BatchSize, budget: budget}, nil
+	case config.EmbeddingProviderOllama:
+		return &ollamaEmbedder{client: client, baseURL: cfg.BaseURL, model: cfg.Model, batchSize: cfg.BatchSize, budget: budget}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.Provider)
+	}
+}
+
+// embedInBatches calls `embed` for consecutive slices of at most `size` texts and
+// concatenates the results, checking that every batch returned one vector per text. Each call
+// goes through `budget`; `embed` returns the tokens the provider reports, or 0 if it doesn't.
+func embedInBatches(ctx context.Context, texts []string, size int, budget *Budget, embed func(context.Context, []string) ([][]float32, int64, error)) ([][]float32, error) {
+	if size < 1 {
+		size = len(texts)
+	}
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		end := min(start+size, len(texts))
+		estimate, err := budget.acquire(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		batch, used, err := embed(ctx, texts[start:end])
+		// A request the provider answered counts, even when it answered with an error.
+		var providerErr *ProviderError
+		budget.release(estimate, used, err == nil || errors.As(err, &providerErr))
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("embedding provider returned %d vectors for %d texts", len(batch), end-start)
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,58 @@
+// Package embedding, as part of the embedding module.
+// This file, `http.go`, holds the JSON-over-HTTP plumbing shared by the providers.
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxErrorBody caps how much of an error response is included in the returned error.
+const maxErrorBody = 512
+
+// postJSON sends `body` as JSON and decodes a 2xx response into `out`. `apiKey` is sent as a
+// bearer token when set. Non-2xx responses become errors carrying the start of the body,
+// which is where providers explain what went wrong.
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode embedding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("build embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return &ProviderError{StatusCode: resp.StatusCode, Body: string(bytes.TrimSpace(snippet))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode embedding response: %w", err)
+	}
+	return nil
+}
+
+// ProviderError is returned when the provider answers with a non-2xx status.
+type ProviderError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("embedding provider returned HTTP %d: %s", e.StatusCode, e.Body)
+}
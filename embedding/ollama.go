@@ -0,0 +1,44 @@
+// Package embedding, as part of the embedding module.
+// This file, `ollama.go`, implements the provider for a local Ollama server.
+package embedding
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type ollamaEmbedder struct {
+	client    *http.Client
+	baseURL   string
+	model     string
+	batchSize int
+	budget    *Budget
+}
+
+type ollamaRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaResponse struct {
+	Embeddings      [][]float32 `json:"embeddings"`
+	PromptEvalCount int64       `json:"prompt_eval_count"`
+}
+
+func (e *ollamaEmbedder) Model() string { return e.model }
+
+func (e *ollamaEmbedder) Budget() *Budget { return e.budget }
+
+func (e *ollamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInBatches(ctx, texts, e.batchSize, e.budget, e.embedBatch)
+}
+
+func (e *ollamaEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, int64, error) {
+	var resp ollamaResponse
+	url := strings.TrimRight(e.baseURL, "/") + "/api/embed"
+	if err := postJSON(ctx, e.client, url, "", ollamaRequest{Model: e.model, Input: texts}, &resp); err != nil {
+		return nil, 0, err
+	}
+	return resp.Embeddings, resp.PromptEvalCount, nil
+}
@@ -0,0 +1,64 @@
+// Package embedding, as part of the embedding module.
+// This file, `openai.go`, implements the OpenAI-compatible provider.
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type openAIEmbedder struct {
+	client    *http.Client
+	baseURL   string
+	apiKey    string
+	model     string
+	batchSize int
+	budget    *Budget
+}
+
+type openAIRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage struct {
+		PromptTokens int64 `json:"prompt_tokens"`
+	} `json:"usage"`
+}
+
+func (e *openAIEmbedder) Model() string { return e.model }
+
+func (e *openAIEmbedder) Budget() *Budget { return e.budget }
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return embedInBatches(ctx, texts, e.batchSize, e.budget, e.embedBatch)
+}
+
+func (e *openAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, int64, error) {
+	var resp openAIResponse
+	url := strings.TrimRight(e.baseURL, "/") + "/embeddings"
+	if err := postJSON(ctx, e.client, url, e.apiKey, openAIRequest{Model: e.model, Input: texts}, &resp); err != nil {
+		return nil, 0, err
+	}
+	// The API documents `index` for matching results to inputs; don't rely on the order.
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, resp.Usage.PromptTokens, fmt.Errorf("embedding provider returned out-of-range index %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, resp.Usage.PromptTokens, fmt.Errorf("embedding provider returned no vector for input %d", i)
+		}
+	}
+	return vectors, resp.Usage.PromptTokens, nil
+}
@@ -0,0 +1,337 @@
+// Package errreport sends the server errors and panics of the HTTP handlers to Sentry, or to
+// any service speaking its protocol, such as GlitchTip. main installs a Sentry reporter as the
+// `apperror` reporting hook when SENTRY_DSN is set.
+//
+// Each event carries the error, the stack where it was reported or where the panic happened,
+// the request method and path, the request ID and the authenticated user. Query strings and
+// headers are left out, since they can hold tokens and signed links.
+//
+// Events are queued and sent by a goroutine, so a request never waits for the service; when
+// the queue is full, events are dropped and logged.
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// queueSize bounds the events waiting to be sent.
+	queueSize = 100
+	// maxFrames bounds the frames of a stack trace.
+	maxFrames = 64
+	// modulePath marks the frames of this application as "in app".
+	modulePath = "github.com/user/lensisku-go/"
+	// clientName identifies this reporter to the service.
+	clientName = "lensisku-go/1.0"
+)
+
+// Sentry is an `apperror.Reporter` sending events to a Sentry project.
+type Sentry struct {
+	dsn         string
+	endpoint    string // Envelope endpoint of the project
+	auth        string // X-Sentry-Auth header
+	environment string
+	release     string
+	serverName  string
+	client      *http.Client
+	queue       chan []byte
+	stop        chan struct{}
+	done        chan struct{}
+	logger      *slog.Logger
+}
+
+// NewSentry returns a reporter for the project of `cfg.DSN` and starts its sender.
+func NewSentry(cfg *config.ErrorReportingConfig) (*Sentry, error) {
+	u, err := url.Parse(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: %w", err)
+	}
+	key := u.User.Username()
+	project := path.Base(u.Path)
+	if key == "" || project == "/" || project == "." {
+		return nil, fmt.Errorf("invalid SENTRY_DSN: missing key or project")
+	}
+	// A DSN may have a path before the project, for a service behind a prefix.
+	endpoint := url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   strings.TrimSuffix(path.Dir(u.Path), "/") + "/api/" + project + "/envelope/",
+	}
+	serverName, _ := os.Hostname()
+
+	s := &Sentry{
+		dsn:         cfg.DSN,
+		endpoint:    endpoint.String(),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", clientName, key),
+		environment: cfg.Environment,
+		release:     cfg.Release,
+		serverName:  serverName,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		queue:       make(chan []byte, queueSize),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+		logger:      logging.For("errreport"),
+	}
+	go s.run()
+	return s, nil
+}
+
+// ReportError queues an event for a server error.
+func (s *Sentry) ReportError(r *http.Request, err *apperror.AppError) {
+	ev := s.newEvent(r, "error")
+	ev.Exception.Values = []exception{{
+		Type:       string(err.Code),
+		Value:      err.Error(),
+		Stacktrace: stacktraceFrom(callers(3), ""),
+	}}
+	s.enqueue(ev)
+}
+
+// ReportPanic queues an event for a recovered panic.
+func (s *Sentry) ReportPanic(r *http.Request, value any) {
+	ev := s.newEvent(r, "fatal")
+	ev.Exception.Values = []exception{{
+		Type:       fmt.Sprintf("%T", value),
+		Value:      fmt.Sprint(value),
+		Stacktrace: stacktraceFrom(callers(3), "runtime.gopanic"),
+		Mechanism:  &mechanism{Type: "panic", Handled: false},
+	}}
+	s.enqueue(ev)
+}
+
+// Close stops the sender once the queued events are sent, or when `ctx` is done.
+func (s *Sentry) Close(ctx context.Context) error {
+	close(s.stop)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// event is a Sentry event, with the fields this reporter fills.
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	User        *user             `json:"user,omitempty"`
+	Request     *request          `json:"request,omitempty"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+}
+
+type user struct {
+	ID string `json:"id"`
+}
+
+type request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+	Mechanism  *mechanism  `json:"mechanism,omitempty"`
+}
+
+type mechanism struct {
+	Type    string `json:"type"`
+	Handled bool   `json:"handled"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"` // Oldest call first
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// newEvent returns an event for `r`, with the request, its ID and its user filled in.
+func (s *Sentry) newEvent(r *http.Request, level string) *event {
+	ev := &event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       level,
+		Platform:    "go",
+		ServerName:  s.serverName,
+		Environment: s.environment,
+		Release:     s.release,
+	}
+	if r == nil {
+		return ev
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	ev.Request = &request{Method: r.Method, URL: scheme + "://" + r.Host + r.URL.Path}
+	ev.Transaction = r.Method + " " + r.URL.Path
+	if id := middleware.GetReqID(r.Context()); id != "" {
+		ev.Tags = map[string]string{"request_id": id}
+	}
+	if scope := apperror.ReportScopeFrom(r.Context()); scope != nil && scope.UserID() != 0 {
+		ev.User = &user{ID: strconv.Itoa(scope.UserID())}
+	}
+	return ev
+}
+
+// enqueue queues an event, or drops it if the queue is full.
+func (s *Sentry) enqueue(ev *event) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		s.logger.Error("Failed to encode error report", "error", err)
+		return
+	}
+	header, _ := json.Marshal(map[string]string{
+		"event_id": ev.EventID,
+		"sent_at":  ev.Timestamp,
+		"dsn":      s.dsn,
+	})
+	item, _ := json.Marshal(map[string]any{"type": "event", "length": len(payload)})
+
+	var envelope bytes.Buffer
+	envelope.Write(header)
+	envelope.WriteByte('\n')
+	envelope.Write(item)
+	envelope.WriteByte('\n')
+	envelope.Write(payload)
+	envelope.WriteByte('\n')
+
+	select {
+	case s.queue <- envelope.Bytes():
+	default:
+		s.logger.Warn("Error report queue full; dropping event", "event_id", ev.EventID)
+	}
+}
+
+// run sends the queued events until Close is called, then sends what is left.
+func (s *Sentry) run() {
+	defer close(s.done)
+	for {
+		select {
+		case envelope := <-s.queue:
+			s.send(envelope)
+		case <-s.stop:
+			for {
+				select {
+				case envelope := <-s.queue:
+					s.send(envelope)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// send posts one envelope to the service.
+func (s *Sentry) send(envelope []byte) {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(envelope))
+	if err != nil {
+		s.logger.Error("Failed to build error report request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Warn("Failed to send error report", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		s.logger.Warn("Error reporting service rejected an event", "status", resp.StatusCode)
+	}
+}
+
+// newEventID returns a random event ID: 32 hexadecimal digits.
+func newEventID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// callers returns the stack of the calling goroutine, skipping `skip` frames.
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, maxFrames)
+	return pcs[:runtime.Callers(skip+1, pcs)]
+}
+
+// stacktraceFrom converts a stack, newest call first, to a Sentry stack trace. If `after` is
+// set, the frames up to and including that function are dropped; for a panic, they are those
+// of the recovery itself.
+func stacktraceFrom(pcs []uintptr, after string) *stacktrace {
+	var frames []frame
+	it := runtime.CallersFrames(pcs)
+	for {
+		f, more := it.Next()
+		if after != "" && f.Function == after {
+			frames = frames[:0]
+		} else {
+			module, function := splitFunction(f.Function)
+			frames = append(frames, frame{
+				Function: function,
+				Module:   module,
+				AbsPath:  f.File,
+				Lineno:   f.Line,
+				InApp:    strings.HasPrefix(f.Function, modulePath),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return &stacktrace{Frames: frames}
+}
+
+// splitFunction splits a qualified function name, such as
+// "github.com/user/lensisku-go/users.(*UserService).Get", into its package and the rest.
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
@@ -0,0 +1,98 @@
+// Package etag answers conditional GETs of list and lookup responses. Middleware gives each
+// successful GET response a weak ETag computed from its body, and answers a request whose
+// If-None-Match names that tag with 304 Not Modified and no body, so clients polling a thread,
+// a feed or a dictionary lookup only download what changed.
+//
+// The tag is a hash of the body rather than of the rows behind it: it costs the query of the
+// response, but no query of its own, and it changes with anything the response shows, such as
+// like counts or the caller's own reactions. Responses whose handler sets an ETag, such as the
+// versioned user profile, keep it.
+//
+// Only install the middleware on routes whose responses fit in memory: the response is
+// buffered to hash it. Event streams and downloads must not go through it.
+package etag
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Middleware adds weak ETags to the 200 responses of GET and HEAD requests and answers
+// matching If-None-Match headers with 304.
+func Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			bw := &bufferedWriter{ResponseWriter: w}
+			next.ServeHTTP(bw, r)
+			bw.finish(r)
+		})
+	}
+}
+
+// bufferedWriter holds back the response until it is complete, so its ETag can be sent first.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// finish sends the response, or 304 if the client already has it.
+func (w *bufferedWriter) finish(r *http.Request) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.Header()
+	if w.status == http.StatusOK {
+		tag := header.Get("ETag")
+		if tag == "" {
+			sum := sha256.Sum256(w.body.Bytes())
+			tag = `W/"` + hex.EncodeToString(sum[:16]) + `"`
+			header.Set("ETag", tag)
+		}
+		if matches(r.Header.Get("If-None-Match"), tag) {
+			// A 304 carries the validators but no content headers.
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// matches reports whether an If-None-Match header names `tag`. If-None-Match compares tags
+// weakly: W/"x" matches "x".
+func matches(ifNoneMatch, tag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+// Package examples, as part of the dictionary module.
+// This file, `dto.go`, defines the request and response bodies of the example sentence API.
+package examples
+
+import "time"
+
+// Moderation states, stored in `definition_examples.status`.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// ListExamplesQuery selects the definition whose examples are listed.
+type ListExamplesQuery struct {
+	DefinitionID int32 `form:"definition_id" validate:"required,min=1"`
+}
+
+// ExampleResponse is an example sentence for a definition.
+// @Description An example sentence showing a definition in use
+type ExampleResponse struct {
+	// example: 91
+	ID int64 `json:"id"`
+	// example: 12345
+	DefinitionID int32 `json:"definition_id"`
+	// The sentence in Lojban
+	// example: "mi klama le zarci"
+	Example string `json:"example"`
+	// Its meaning in the definition's language
+	// example: "I go to the store"
+	Translation *string `json:"translation,omitempty"`
+	// Where the sentence comes from
+	// example: "lo selci'a be la .alis."
+	Source *string `json:"source,omitempty"`
+	// example: "https://example.org/alis.html"
+	SourceURL *string `json:"source_url,omitempty"`
+	// pending, approved or rejected
+	// example: "approved"
+	Status string `json:"status"`
+	// Absent if the account no longer exists
+	SubmittedBy       *int32     `json:"submitted_by,omitempty"`
+	SubmitterUsername *string    `json:"submitter_username,omitempty"`
+	ReviewedBy        *int32     `json:"reviewed_by,omitempty"`
+	ReviewedAt        *time.Time `json:"reviewed_at,omitempty"`
+	// example: "2024-01-15T10:30:00Z"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExampleListResponse is a page of examples.
+// @Description Paginated example sentences
+type ExampleListResponse struct {
+	Examples []ExampleResponse `json:"examples"`
+	Total    int64             `json:"total"`
+	Page     int64             `json:"page"`
+	PerPage  int64             `json:"per_page"`
+}
+
+// CreateExampleRequest is the body of a new example sentence.
+// @Description Request body for submitting an example sentence
+type CreateExampleRequest struct {
+	// example: 12345
+	DefinitionID int32 `json:"definition_id" validate:"required,min=1"`
+	// example: "mi klama le zarci"
+	Example string `json:"example" validate:"required"`
+	// example: "I go to the store"
+	Translation string `json:"translation,omitempty"`
+	// example: "lo selci'a be la .alis."
+	Source string `json:"source,omitempty"`
+	// example: "https://example.org/alis.html"
+	SourceURL string `json:"source_url,omitempty"`
+}
@@ -0,0 +1,235 @@
+// Package examples encapsulates example sentences for definitions: submission with source
+// attribution, moderation, and the approved examples shown with each definition.
+// This file, `handlers.go`, serves /api/v1/examples: the examples of a definition, their
+// submission, and the moderation queue with its approve, reject and delete actions.
+package examples
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// ExampleHandlers provides HTTP handlers for example sentences.
+type ExampleHandlers struct {
+	service *ExampleService
+}
+
+// NewExampleHandlers creates new ExampleHandlers.
+func NewExampleHandlers(service *ExampleService) *ExampleHandlers {
+	return &ExampleHandlers{service: service}
+}
+
+// HandleListExamples godoc
+// @Summary List the examples of a definition
+// @Description Returns the approved example sentences of a definition, oldest first.
+// @Tags examples
+// @Produce json
+// @Param definition_id query int true "Definition ID"
+// @Success 200 {array} ExampleResponse "Examples"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing or invalid definition ID"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/examples [get]
+func (h *ExampleHandlers) HandleListExamples() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q ListExamplesQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		examples, err := h.service.List(r.Context(), q.DefinitionID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, examples)
+	}
+}
+
+// HandleListPending godoc
+// @Summary List examples waiting for moderation
+// @Description Returns the moderation queue, oldest first. Trusted users and admins only.
+// @Tags examples
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Success 200 {object} ExampleListResponse "Pending examples"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid pagination"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not a trusted user or admin"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/examples/pending [get]
+func (h *ExampleHandlers) HandleListPending() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q validation.Pagination
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		examples, err := h.service.ListPending(r.Context(), q.Page, q.PerPage)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, examples)
+	}
+}
+
+// HandleCreateExample godoc
+// @Summary Submit an example sentence
+// @Description Submits an example sentence for a definition, optionally with a translation and its source. Examples by trusted users and admins are approved right away; others wait for moderation (status `pending`, answered with 202).
+// @Tags examples
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param example body CreateExampleRequest true "New example"
+// @Success 201 {object} ExampleResponse "Approved example"
+// @Success 202 {object} ExampleResponse "Example waiting for moderation"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid payload"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Definition not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/examples [post]
+func (h *ExampleHandlers) HandleCreateExample() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req CreateExampleRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		example, err := h.service.Create(r.Context(), userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		status := http.StatusCreated
+		if example.Status == StatusPending {
+			status = http.StatusAccepted
+		}
+		render.Write(w, r, status, example)
+	}
+}
+
+// HandleApproveExample godoc
+// @Summary Approve a pending example
+// @Description Publishes a pending example with its definition. Trusted users and admins only.
+// @Tags examples
+// @Produce json
+// @Security BearerAuth
+// @Param exampleID path int true "Example ID"
+// @Success 200 {object} ExampleResponse "Approved example"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid example ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not a trusted user or admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Example not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Example already reviewed"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/examples/{exampleID}/approve [post]
+func (h *ExampleHandlers) HandleApproveExample() http.HandlerFunc {
+	return h.handleReview(true)
+}
+
+// HandleRejectExample godoc
+// @Summary Reject a pending example
+// @Description Marks a pending example as rejected; it is never shown. Trusted users and admins only.
+// @Tags examples
+// @Produce json
+// @Security BearerAuth
+// @Param exampleID path int true "Example ID"
+// @Success 200 {object} ExampleResponse "Rejected example"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid example ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not a trusted user or admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Example not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Example already reviewed"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/examples/{exampleID}/reject [post]
+func (h *ExampleHandlers) HandleRejectExample() http.HandlerFunc {
+	return h.handleReview(false)
+}
+
+func (h *ExampleHandlers) handleReview(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		exampleID, err := exampleIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		example, err := h.service.Review(r.Context(), exampleID, userID, approve)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, example)
+	}
+}
+
+// HandleDeleteExample godoc
+// @Summary Delete an example
+// @Description Deletes an example sentence. Only its submitter, trusted users and admins may delete it.
+// @Tags examples
+// @Security BearerAuth
+// @Param exampleID path int true "Example ID"
+// @Success 204 "Deleted"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid example ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not allowed to delete this example"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Example not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/examples/{exampleID} [delete]
+func (h *ExampleHandlers) HandleDeleteExample() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		exampleID, err := exampleIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.service.Delete(r.Context(), exampleID, userID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func exampleIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "exampleID"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, apperror.NewBadRequestError("invalid example ID", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,317 @@
+// Package examples, as part of the dictionary module.
+// This file, `service.go`, contains the business logic for example sentences: submitting them
+// with their source, moderating them and reading the approved ones. Examples submitted by
+// trusted users and admins are approved right away; everyone else's wait in the moderation
+// queue. Only approved examples are shown with definitions.
+package examples
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/notifications"
+	"github.com/user/lensisku-go/users"
+)
+
+const (
+	// maxExampleLength caps the sentence and its translation, in characters.
+	maxExampleLength = 2000
+	// maxSourceLength caps the source description and URL, in characters.
+	maxSourceLength = 500
+)
+
+// ExampleService provides the example sentence API.
+type ExampleService struct {
+	db *pgxpool.Pool
+}
+
+// NewExampleService creates a new ExampleService.
+func NewExampleService(db *pgxpool.Pool) *ExampleService {
+	return &ExampleService{db: db}
+}
+
+// exampleSelect reads ExampleResponse rows; callers append their clauses.
+const exampleSelect = `
+	SELECT e.id, e.definition_id, e.example, e.translation, e.source, e.source_url, e.status,
+	       e.submitted_by, u.username, e.reviewed_by, e.reviewed_at, e.created_at
+	FROM definition_examples e
+	LEFT JOIN users u ON u.userid = e.submitted_by`
+
+func scanExample(row pgx.Row) (*ExampleResponse, error) {
+	var e ExampleResponse
+	err := row.Scan(&e.ID, &e.DefinitionID, &e.Example, &e.Translation, &e.Source, &e.SourceURL, &e.Status,
+		&e.SubmittedBy, &e.SubmitterUsername, &e.ReviewedBy, &e.ReviewedAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// List returns the approved examples of a definition, oldest first.
+func (s *ExampleService) List(ctx context.Context, definitionID int32) ([]ExampleResponse, error) {
+	var exists bool
+	err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM definitions WHERE definitionid = $1)`, definitionID).Scan(&exists)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load definition", err)
+	}
+	if !exists {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("definition with ID %d not found", definitionID), nil)
+	}
+	byDefinition, err := s.ApprovedFor(ctx, []int32{definitionID})
+	if err != nil {
+		return nil, err
+	}
+	if examples := byDefinition[definitionID]; examples != nil {
+		return examples, nil
+	}
+	return []ExampleResponse{}, nil
+}
+
+// ApprovedFor returns the approved examples of several definitions at once, keyed by
+// definition ID. Definitions without examples have no entry.
+func (s *ExampleService) ApprovedFor(ctx context.Context, definitionIDs []int32) (map[int32][]ExampleResponse, error) {
+	byDefinition := make(map[int32][]ExampleResponse)
+	if len(definitionIDs) == 0 {
+		return byDefinition, nil
+	}
+	rows, err := s.db.Query(ctx, exampleSelect+`
+		WHERE e.definition_id = ANY($1) AND e.status = 'approved'
+		ORDER BY e.created_at, e.id`, definitionIDs)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load examples", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanExample(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read example", err)
+		}
+		byDefinition[e.DefinitionID] = append(byDefinition[e.DefinitionID], *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to load examples", err)
+	}
+	return byDefinition, nil
+}
+
+// ListPending returns the moderation queue, oldest first.
+func (s *ExampleService) ListPending(ctx context.Context, page, perPage int64) (*ExampleListResponse, error) {
+	resp := &ExampleListResponse{Examples: []ExampleResponse{}, Page: page, PerPage: perPage}
+	err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM definition_examples WHERE status = 'pending'`).Scan(&resp.Total)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to count pending examples", err)
+	}
+	rows, err := s.db.Query(ctx, exampleSelect+`
+		WHERE e.status = 'pending'
+		ORDER BY e.created_at, e.id
+		LIMIT $1 OFFSET $2`, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list pending examples", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanExample(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read example", err)
+		}
+		resp.Examples = append(resp.Examples, *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list pending examples", err)
+	}
+	return resp, nil
+}
+
+// Create submits an example sentence for a definition.
+func (s *ExampleService) Create(ctx context.Context, userID int, req CreateExampleRequest) (*ExampleResponse, error) {
+	example := strings.TrimSpace(req.Example)
+	translation := strings.TrimSpace(req.Translation)
+	source := strings.TrimSpace(req.Source)
+	sourceURL := strings.TrimSpace(req.SourceURL)
+	if example == "" {
+		return nil, apperror.NewBadRequestError("example is required", nil)
+	}
+	if utf8.RuneCountInString(example) > maxExampleLength || utf8.RuneCountInString(translation) > maxExampleLength {
+		return nil, apperror.NewBadRequestError(fmt.Sprintf("examples and translations are limited to %d characters", maxExampleLength), nil)
+	}
+	if utf8.RuneCountInString(source) > maxSourceLength || utf8.RuneCountInString(sourceURL) > maxSourceLength {
+		return nil, apperror.NewBadRequestError(fmt.Sprintf("sources and source URLs are limited to %d characters", maxSourceLength), nil)
+	}
+	if sourceURL != "" {
+		u, err := url.Parse(sourceURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, apperror.NewBadRequestError("source_url must be an http or https URL", err)
+		}
+	}
+
+	var role string
+	var exists bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM definitions WHERE definitionid = $1),
+		       COALESCE((SELECT role FROM users WHERE userid = $2), '')`,
+		req.DefinitionID, userID).Scan(&exists, &role)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load definition", err)
+	}
+	if !exists {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("definition with ID %d not found", req.DefinitionID), nil)
+	}
+
+	status := StatusPending
+	if role == auth.RoleTrusted || role == auth.RoleAdmin {
+		status = StatusApproved
+	}
+	var id int64
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO definition_examples (definition_id, example, translation, source, source_url, status, submitted_by)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+		RETURNING id`,
+		req.DefinitionID, example, translation, source, sourceURL, status, userID).Scan(&id)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to create example", err)
+	}
+	return s.get(ctx, id)
+}
+
+// Review approves or rejects a pending example. The review is audited with the example before
+// and after it.
+func (s *ExampleService) Review(ctx context.Context, exampleID int64, reviewerID int, approve bool) (*ExampleResponse, error) {
+	status, action := StatusRejected, audit.ActionExampleReject
+	if approve {
+		status, action = StatusApproved, audit.ActionExampleApprove
+	}
+	var reviewed *ExampleResponse
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		before, err := getExample(ctx, tx, exampleID, true)
+		if err != nil {
+			return err
+		}
+		if before.Status != StatusPending {
+			return apperror.NewConflictError(fmt.Sprintf("example %d is already %s", exampleID, before.Status), nil).WithCode(apperror.CodeAlreadyReviewed)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE definition_examples SET status = $2, reviewed_by = $3, reviewed_at = NOW()
+			WHERE id = $1`, exampleID, status, reviewerID)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to review example", err)
+		}
+		if reviewed, err = getExample(ctx, tx, exampleID, false); err != nil {
+			return err
+		}
+		if err := notifySubmitter(ctx, tx, reviewed, reviewerID); err != nil {
+			return err
+		}
+		if reviewed.SubmittedBy != nil && int(*reviewed.SubmittedBy) != reviewerID {
+			err := users.RecordModerationOutcome(ctx, tx, users.ModerationOutcome{
+				UserID:   int(*reviewed.SubmittedBy),
+				Source:   users.ReputationSourceExample,
+				SourceID: exampleID,
+				Points:   users.ReviewPoints(approve),
+				Reason:   "example " + status,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return audit.Record(ctx, tx, audit.Entry{
+			ActorID:    reviewerID,
+			Action:     action,
+			TargetType: audit.TargetExample,
+			TargetID:   strconv.FormatInt(exampleID, 10),
+			Before:     before,
+			After:      reviewed,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewed, nil
+}
+
+// notifySubmitter tells the submitter of `e` that it was reviewed.
+func notifySubmitter(ctx context.Context, tx pgx.Tx, e *ExampleResponse, reviewerID int) error {
+	if e.SubmittedBy == nil {
+		return nil
+	}
+	var valsiID int32
+	var word string
+	err := tx.QueryRow(ctx, `
+		SELECT v.valsiid, v.word FROM definitions d JOIN valsi v ON v.valsiid = d.valsiid
+		WHERE d.definitionid = $1`, e.DefinitionID).Scan(&valsiID, &word)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to load word of definition", err)
+	}
+	kind, verb := notifications.TypeExampleRejected, "rejected"
+	if e.Status == StatusApproved {
+		kind, verb = notifications.TypeExampleApproved, "approved"
+	}
+	return notifications.Notify(ctx, tx, notifications.Entry{
+		UserID:  *e.SubmittedBy,
+		Type:    kind,
+		Message: fmt.Sprintf("Your example for %s was %s", word, verb),
+		ValsiID: &valsiID,
+		ActorID: reviewerID,
+	})
+}
+
+// Delete removes an example. Its submitter, trusted users and admins may delete it. The
+// deletion is audited with the example it removed.
+func (s *ExampleService) Delete(ctx context.Context, exampleID int64, userID int) error {
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		e, err := getExample(ctx, tx, exampleID, true)
+		if err != nil {
+			return err
+		}
+		var role string
+		err = tx.QueryRow(ctx, `SELECT COALESCE((SELECT role FROM users WHERE userid = $1), '')`, userID).Scan(&role)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load user role", err)
+		}
+		if (e.SubmittedBy == nil || *e.SubmittedBy != int32(userID)) && role != auth.RoleTrusted && role != auth.RoleAdmin {
+			return apperror.NewUnauthorizedError("only the submitter, trusted users and admins can delete an example", nil)
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM definition_examples WHERE id = $1`, exampleID); err != nil {
+			return apperror.NewDatabaseError("failed to delete example", err)
+		}
+		return audit.Record(ctx, tx, audit.Entry{
+			ActorID:    userID,
+			Action:     audit.ActionExampleDelete,
+			TargetType: audit.TargetExample,
+			TargetID:   strconv.FormatInt(exampleID, 10),
+			Before:     e,
+		})
+	})
+}
+
+func (s *ExampleService) get(ctx context.Context, exampleID int64) (*ExampleResponse, error) {
+	return getExample(ctx, s.db, exampleID, false)
+}
+
+// getExample loads an example through `q`, the pool or a transaction; `lock` locks its row
+// until the end of the transaction.
+func getExample(ctx context.Context, q db.Querier, exampleID int64, lock bool) (*ExampleResponse, error) {
+	query := exampleSelect + ` WHERE e.id = $1`
+	if lock {
+		query += ` FOR UPDATE OF e`
+	}
+	e, err := scanExample(q.QueryRow(ctx, query, exampleID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("example with ID %d not found", exampleID), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load example", err)
+	}
+	return e, nil
+}
@@ -0,0 +1,73 @@
+// Package exports, as part of the dictionary module.
+// This file, `dto.go`, defines the request and response bodies of the dictionary export API.
+package exports
+
+import "time"
+
+// Export formats.
+const (
+	// FormatXML is the jbovlaste export format, readable by POST /api/v1/import/xml.
+	FormatXML = "xml"
+	// FormatJSON lists every definition of every word.
+	FormatJSON = "json"
+)
+
+// Export statuses, stored in `dictionary_exports.status`.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	// StatusExpired: the file was deleted after the retention period.
+	StatusExpired = "expired"
+)
+
+// DownloadQuery is the expiry and the signature of a download link.
+type DownloadQuery struct {
+	Expires   int64  `form:"expires" validate:"required"` // Unix seconds
+	Signature string `form:"signature" validate:"required"`
+}
+
+// ExportResponse describes a dictionary export.
+// @Description A dictionary dump and how far it has been built
+type ExportResponse struct {
+	// example: 7
+	ID int64 `json:"id"`
+	// Language tag; absent for the full dictionary
+	// example: "en"
+	Language *string `json:"language,omitempty"`
+	// xml or json
+	// example: "xml"
+	Format string `json:"format"`
+	// pending, running, done, failed or expired
+	// example: "done"
+	Status string `json:"status"`
+	// Entries written so far
+	// example: 12000
+	Done int64 `json:"done"`
+	// Entries to write; 0 until known
+	// example: 12000
+	Total int64 `json:"total"`
+	// Size of the finished file
+	// example: 21474836
+	SizeBytes *int64 `json:"size_bytes,omitempty"`
+	// Why the export failed
+	Error *string `json:"error,omitempty"`
+	// Signed link to the finished file; it works without logging in until DownloadExpiresAt
+	DownloadURL       *string    `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+	// example: "2024-01-15T10:30:00Z"
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// CreateExportRequest asks for a dictionary dump.
+// @Description Request body for starting a dictionary export
+type CreateExportRequest struct {
+	// Language tag; omit for the full dictionary
+	// example: "en"
+	Language string `json:"language,omitempty"`
+	// xml (jbovlaste-compatible) or json
+	// example: "xml"
+	Format string `json:"format" validate:"required,oneof=xml json"`
+}
@@ -0,0 +1,288 @@
+// Package exports encapsulates dictionary dumps: full or per-language exports in the jbovlaste
+// XML format or as JSON, built by a background job and downloaded through signed links.
+// This file, `handlers.go`, serves /api/v1/exports: starting an export, following its progress
+// (also over Server-Sent Events) and downloading the file once it's built.
+package exports
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/jbovlaste"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+const (
+	// eventsPollInterval is how often the progress stream looks at the export row. The job
+	// may run on another instance, so the row is the only place its progress can be read.
+	eventsPollInterval = time.Second
+
+	// keepAliveInterval is how often an idle stream gets an SSE comment.
+	keepAliveInterval = 15 * time.Second
+
+	// downloadTimeout replaces the server's WriteTimeout for a download, which is meant for
+	// small responses.
+	downloadTimeout = 30 * time.Minute
+)
+
+// ExportHandlers provides HTTP handlers for dictionary exports.
+type ExportHandlers struct {
+	service *ExportService
+}
+
+// NewExportHandlers creates new ExportHandlers.
+func NewExportHandlers(service *ExportService) *ExportHandlers {
+	return &ExportHandlers{service: service}
+}
+
+// HandleCreateExport godoc
+// @Summary Start a dictionary export
+// @Description Queues a full or per-language dictionary dump, as jbovlaste-compatible XML or as JSON. If the same dump is already being built, that export is returned. Follow the progress at GET /api/v1/exports/{exportID}/events; the finished export carries a signed download link.
+// @Tags exports
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param export body CreateExportRequest true "Language and format"
+// @Success 202 {object} ExportResponse "Export queued"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid format or unknown language"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/exports [post]
+func (h *ExportHandlers) HandleCreateExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req CreateExportRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		export, err := h.service.Create(r.Context(), userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusAccepted, export)
+	}
+}
+
+// HandleGetExport godoc
+// @Summary Get a dictionary export
+// @Description Returns an export and its progress. Once it is done, the response carries a download link signed for a limited time; fetch the export again for a fresh one.
+// @Tags exports
+// @Produce json
+// @Security BearerAuth
+// @Param exportID path int true "Export ID"
+// @Success 200 {object} ExportResponse "Export"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid export ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Export not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/exports/{exportID} [get]
+func (h *ExportHandlers) HandleGetExport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		exportID, err := exportIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		export, err := h.service.Get(r.Context(), exportID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, export)
+	}
+}
+
+// HandleExportEvents godoc
+// @Summary Stream export progress
+// @Description Streams `progress` Server-Sent Events whose data is a ProgressEvent (task_id is the export ID, kind is "export"), followed by an `export` event with the finished ExportResponse and its download link. The stream ends when the export is done or has failed.
+// @Tags exports
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param exportID path int true "Export ID"
+// @Success 200 {object} jbovlaste.ProgressEvent "Stream of progress events"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid export ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Export not found"
+// @Router /api/v1/exports/{exportID}/events [get]
+func (h *ExportHandlers) HandleExportEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		exportID, err := exportIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		// The router's request timeout would cancel the polling queries; a disconnect shows
+		// up as a failed write instead.
+		ctx := context.WithoutCancel(r.Context())
+		export, err := h.service.Get(ctx, exportID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		_ = rc.SetWriteDeadline(time.Time{})
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		poll := time.NewTicker(eventsPollInterval)
+		defer poll.Stop()
+		var last *jbovlaste.ProgressEvent
+		lastWrite := time.Now()
+		for {
+			event := progressEvent(export)
+			if last == nil || event != *last {
+				if err := writeEvent(w, rc, "progress", event); err != nil {
+					return
+				}
+				last, lastWrite = &event, time.Now()
+			} else if time.Since(lastWrite) >= keepAliveInterval {
+				fmt.Fprint(w, ": keep-alive\n\n")
+				if err := rc.Flush(); err != nil {
+					return
+				}
+				lastWrite = time.Now()
+			}
+			if event.Final() {
+				writeEvent(w, rc, "export", export)
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				if !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+					return // The client went away.
+				}
+				<-poll.C
+			case <-poll.C:
+			}
+			if export, err = h.service.Get(ctx, exportID); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// progressEvent maps an export to the progress event format of background tasks.
+func progressEvent(e *ExportResponse) jbovlaste.ProgressEvent {
+	event := jbovlaste.ProgressEvent{
+		TaskID: strconv.FormatInt(e.ID, 10),
+		Kind:   "export",
+		State:  jbovlaste.TaskRunning,
+		Done:   e.Done,
+		Total:  e.Total,
+	}
+	switch e.Status {
+	case StatusPending:
+		event.Message = "waiting for a worker"
+		if e.Error != nil {
+			event.Message = "retrying after: " + *e.Error
+		}
+	case StatusRunning:
+		event.Message = fmt.Sprintf("%d of %d entries written", e.Done, e.Total)
+	case StatusDone:
+		event.State = jbovlaste.TaskDone
+		event.Message = fmt.Sprintf("%d entries written", e.Done)
+	case StatusExpired:
+		event.State = jbovlaste.TaskDone
+		event.Message = "the export has expired; start a new one"
+	case StatusFailed:
+		event.State = jbovlaste.TaskFailed
+		if e.Error != nil {
+			event.Message = *e.Error
+		}
+	}
+	return event
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, name string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return rc.Flush()
+}
+
+// HandleDownload godoc
+// @Summary Download a dictionary export
+// @Description Serves the file of a finished export. The link comes from the export's `download_url` and works without logging in until it expires. Range requests are supported.
+// @Tags exports
+// @Produce application/xml
+// @Produce application/json
+// @Param exportID path int true "Export ID"
+// @Param expires query int true "Expiry time of the link (Unix seconds)"
+// @Param signature query string true "Link signature"
+// @Success 200 {file} file "Dictionary dump"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid parameters"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Invalid or expired link"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Export not found or not finished"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/exports/{exportID}/download [get]
+func (h *ExportHandlers) HandleDownload() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		exportID, err := exportIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		var q DownloadQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		f, export, err := h.service.Open(r.Context(), exportID, q.Expires, q.Signature)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer f.Close()
+
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(downloadTimeout))
+		contentType := "application/xml; charset=utf-8"
+		if export.Format == FormatJSON {
+			contentType = "application/json"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName(export)}))
+		modified := export.CreatedAt
+		if export.FinishedAt != nil {
+			modified = *export.FinishedAt
+		}
+		http.ServeContent(w, r, fileName(export), modified, f)
+	}
+}
+
+func exportIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "exportID"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, apperror.NewBadRequestError("invalid export ID", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,173 @@
+// Package exports, as part of the dictionary module.
+// This file, `job.go`, builds an export in the background. The job writes the dump to a
+// temporary file next to its final path and renames it into place once complete, so a
+// download never sees half a file. Progress is stored on the export row every
+// `exportProgressEvery` entries, where the SSE stream picks it up (see `handlers.go`).
+// Each run also deletes the files of exports older than the retention period.
+package exports
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/jobs"
+)
+
+// ExportJobType is the job type for building a dictionary export.
+const ExportJobType = "dictionary.export"
+
+// exportProgressEvery is how many entries are written between two progress updates.
+const exportProgressEvery = 500
+
+// ExportPayload identifies the export to build.
+type ExportPayload struct {
+	ExportID int64 `json:"export_id"`
+}
+
+// JobHandler builds the export named in the job. Exports that were deleted or already
+// finished complete the job without doing anything. A failed attempt puts the export back to
+// pending until the job runs out of attempts, which marks it failed.
+func (s *ExportService) JobHandler() jobs.HandlerFunc {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var payload ExportPayload
+		if err := job.Decode(&payload); err != nil {
+			return jobs.Permanent(fmt.Errorf("invalid export job payload: %w", err))
+		}
+		s.expireOld(ctx)
+
+		var (
+			language *string
+			format   string
+		)
+		err := s.db.QueryRow(ctx, `
+			UPDATE dictionary_exports SET status = 'running', entries_done = 0, error = NULL
+			WHERE id = $1 AND status IN ('pending', 'running')
+			RETURNING language, format`, payload.ExportID).Scan(&language, &format)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to start export %d: %w", payload.ExportID, err)
+		}
+
+		size, err := s.build(ctx, payload.ExportID, language, format)
+		if err != nil {
+			status := StatusPending
+			if job.Attempts >= job.MaxAttempts {
+				status = StatusFailed
+			}
+			if _, uerr := s.db.Exec(context.WithoutCancel(ctx), `
+				UPDATE dictionary_exports SET status = $2, error = $3,
+				       finished_at = CASE WHEN $2 = 'failed' THEN NOW() END
+				WHERE id = $1`, payload.ExportID, status, err.Error()); uerr != nil {
+				s.logger.Error("Failed to record export failure", "export_id", payload.ExportID, "error", uerr)
+			}
+			return err
+		}
+
+		_, err = s.db.Exec(ctx, `
+			UPDATE dictionary_exports
+			SET status = 'done', entries_done = entries_total, size_bytes = $2, finished_at = NOW()
+			WHERE id = $1`, payload.ExportID, size)
+		if err != nil {
+			return fmt.Errorf("failed to finish export %d: %w", payload.ExportID, err)
+		}
+		s.logger.Info("Export finished", "export_id", payload.ExportID, "format", format, "bytes", size)
+		return nil
+	}
+}
+
+// build writes the dump and returns its size in bytes.
+func (s *ExportService) build(ctx context.Context, exportID int64, language *string, format string) (int64, error) {
+	var langID *int32
+	if language != nil {
+		var id int32
+		if err := s.db.QueryRow(ctx, `SELECT langid FROM languages WHERE tag = $1`, *language).Scan(&id); err != nil {
+			return 0, fmt.Errorf("failed to look up language %q: %w", *language, err)
+		}
+		langID = &id
+	}
+	total, err := countEntries(ctx, s.db, langID, format)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count entries: %w", err)
+	}
+	if _, err := s.db.Exec(ctx, `UPDATE dictionary_exports SET entries_total = $2 WHERE id = $1`, exportID, total); err != nil {
+		return 0, fmt.Errorf("failed to record entry count: %w", err)
+	}
+
+	path := s.path(exportID, format)
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // A no-op once renamed
+	defer tmp.Close()
+
+	// Progress writes are best effort; a missed update only makes the bar jump.
+	progress := func(done int64) {
+		if done%exportProgressEvery != 0 {
+			return
+		}
+		if _, err := s.db.Exec(ctx, `UPDATE dictionary_exports SET entries_done = $2 WHERE id = $1`, exportID, done); err != nil {
+			s.logger.Warn("Failed to record export progress", "export_id", exportID, "error", err)
+		}
+	}
+	buf := bufio.NewWriterSize(tmp, 64<<10)
+	if format == FormatXML {
+		err = writeXML(ctx, s.db, buf, langID, progress)
+	} else {
+		err = writeJSON(ctx, s.db, buf, langID, language, progress)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := buf.Flush(); err != nil {
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// expireOld deletes the files of exports finished more than the retention period ago. Errors
+// are only logged; the next export tries again.
+func (s *ExportService) expireOld(ctx context.Context) {
+	rows, err := s.db.Query(ctx, `
+		UPDATE dictionary_exports SET status = 'expired'
+		WHERE status = 'done' AND finished_at < $1
+		RETURNING id, format`, time.Now().Add(-s.cfg.Retention))
+	if err != nil {
+		s.logger.Error("Failed to expire old exports", "error", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var format string
+		if err := rows.Scan(&id, &format); err != nil {
+			s.logger.Error("Failed to expire old exports", "error", err)
+			return
+		}
+		if err := os.Remove(s.path(id, format)); err != nil && !os.IsNotExist(err) {
+			s.logger.Error("Failed to delete expired export file", "export_id", id, "error", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error("Failed to expire old exports", "error", err)
+	}
+}
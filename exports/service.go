@@ -0,0 +1,176 @@
+// Package exports, as part of the dictionary module.
+// This file, `service.go`, manages dictionary exports: requesting one queues a job (see
+// `job.go`) that writes the dump to the export directory, and a finished dump is downloaded
+// through a link signed with HMAC-SHA256. The link carries its expiry time and needs no login,
+// so it can be handed to a download manager or `curl`; the directory itself is never served.
+package exports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/logging"
+)
+
+// downloadPurpose is mixed into the signature so these links can't be reused for other features.
+const downloadPurpose = "dictionary-export:"
+
+// ExportService provides the dictionary export API.
+type ExportService struct {
+	db            *pgxpool.Pool
+	queue         *jobs.Queue
+	cfg           *config.ExportConfig
+	publicBaseURL string
+	secret        []byte // Signs download links
+	logger        *slog.Logger
+}
+
+// NewExportService creates an ExportService writing to `cfg.Dir`, creating the directory if
+// needed.
+func NewExportService(db *pgxpool.Pool, queue *jobs.Queue, cfg *config.ExportConfig, publicBaseURL string, secret string) (*ExportService, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory %s: %w", cfg.Dir, err)
+	}
+	return &ExportService{
+		db:            db,
+		queue:         queue,
+		cfg:           cfg,
+		publicBaseURL: strings.TrimRight(publicBaseURL, "/"),
+		secret:        []byte(secret),
+		logger:        logging.For("exports"),
+	}, nil
+}
+
+// Create starts an export. If the same dump is already being built, that export is returned
+// instead of starting another one.
+func (s *ExportService) Create(ctx context.Context, userID int, req CreateExportRequest) (*ExportResponse, error) {
+	var language *string
+	if tag := strings.TrimSpace(req.Language); tag != "" {
+		var canonical string
+		err := s.db.QueryRow(ctx, `SELECT tag FROM languages WHERE lower(tag) = lower($1)`, tag).Scan(&canonical)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.NewBadRequestError(fmt.Sprintf("unknown language %q", tag), nil)
+		}
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to look up language", err)
+		}
+		language = &canonical
+	}
+
+	var id int64
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		// The advisory lock keeps two simultaneous requests for the same dump from both starting one.
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('dictionary_exports'))`); err != nil {
+			return apperror.NewDatabaseError("failed to lock exports", err)
+		}
+		err := tx.QueryRow(ctx, `
+			SELECT id FROM dictionary_exports
+			WHERE status IN ('pending', 'running') AND language IS NOT DISTINCT FROM $1 AND format = $2
+			ORDER BY id LIMIT 1`, language, req.Format).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = tx.QueryRow(ctx, `
+				INSERT INTO dictionary_exports (language, format, requested_by)
+				VALUES ($1, $2, $3)
+				RETURNING id`, language, req.Format, userID).Scan(&id)
+			if err != nil {
+				return apperror.NewDatabaseError("failed to create export", err)
+			}
+			if _, err := s.queue.EnqueueTx(ctx, tx, ExportJobType, ExportPayload{ExportID: id}, nil); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return apperror.NewDatabaseError("failed to look up exports", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Get returns an export; a finished one comes with a freshly signed download link.
+func (s *ExportService) Get(ctx context.Context, exportID int64) (*ExportResponse, error) {
+	var e ExportResponse
+	err := s.db.QueryRow(ctx, `
+		SELECT id, language, format, status, entries_done, entries_total, size_bytes, error, created_at, finished_at
+		FROM dictionary_exports WHERE id = $1`, exportID).
+		Scan(&e.ID, &e.Language, &e.Format, &e.Status, &e.Done, &e.Total, &e.SizeBytes, &e.Error, &e.CreatedAt, &e.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("export with ID %d not found", exportID), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load export", err)
+	}
+	if e.Status == StatusDone {
+		expires := time.Now().Add(s.cfg.LinkTTL).Truncate(time.Second)
+		link := fmt.Sprintf("%s/api/v1/exports/%d/download?expires=%d&signature=%s",
+			s.publicBaseURL, e.ID, expires.Unix(), s.signature(e.ID, expires.Unix()))
+		e.DownloadURL, e.DownloadExpiresAt = &link, &expires
+	}
+	return &e, nil
+}
+
+// signature signs a download link for an export, valid until `expires` (Unix seconds).
+func (s *ExportService) signature(exportID int64, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(downloadPurpose + strconv.FormatInt(exportID, 10) + ":" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Open checks a download link and opens the file it points to. The caller closes the file.
+func (s *ExportService) Open(ctx context.Context, exportID int64, expires int64, signature string) (*os.File, *ExportResponse, error) {
+	if !hmac.Equal([]byte(signature), []byte(s.signature(exportID, expires))) {
+		return nil, nil, apperror.NewUnauthorizedError("invalid download link", nil).WithCode(apperror.CodeDownloadLinkInvalid)
+	}
+	if time.Now().Unix() > expires {
+		return nil, nil, apperror.NewUnauthorizedError("the download link has expired; request a new one", nil).WithCode(apperror.CodeDownloadLinkExpired)
+	}
+	e, err := s.Get(ctx, exportID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.Status != StatusDone {
+		return nil, nil, apperror.NewNotFoundError(fmt.Sprintf("export %d is %s", exportID, e.Status), nil)
+	}
+	f, err := os.Open(s.path(e.ID, e.Format))
+	if err != nil {
+		return nil, nil, apperror.NewInternalError("failed to open export file", err)
+	}
+	return f, e, nil
+}
+
+// path is where the file of an export lives.
+func (s *ExportService) path(exportID int64, format string) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("lensisku-%d.%s", exportID, format))
+}
+
+// fileName is the name a download is saved under, e.g. "lensisku-en-2024-01-15.xml".
+func fileName(e *ExportResponse) string {
+	language := "all"
+	if e.Language != nil {
+		language = *e.Language
+	}
+	date := e.CreatedAt
+	if e.FinishedAt != nil {
+		date = *e.FinishedAt
+	}
+	return fmt.Sprintf("lensisku-%s-%s.%s", language, date.UTC().Format("2006-01-02"), e.Format)
+}
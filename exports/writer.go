@@ -0,0 +1,314 @@
+// Package exports, as part of the dictionary module.
+// This file, `writer.go`, writes the dump formats. Entries are read with a single streaming
+// query per language and written as they arrive, so a full dump needs little memory.
+//
+// The XML format is the one of jbovlaste exports: one `<direction from="lojban" to="...">`
+// per language, holding one `<valsi>` per word with the word's best definition (most votes,
+// then lowest definition number) and its glosses and place keywords. It can be fed back to
+// POST /api/v1/import/xml. The JSON format keeps every definition:
+//
+//	{"generated_at": "...", "language": "en", "entries": [
+//	  {"word": "klama", "type": "gismu", "rafsi": ["kla"], "definitions": [
+//	    {"id": 1, "language": "en", "definition": "...", "score": 3, "glosses": [...]}]}]}
+package exports
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// progressFunc is told how many entries have been written so far.
+type progressFunc func(done int64)
+
+// glossesSelect aggregates the glosses and keywords of definition `d` as a JSON array.
+const glossesSelect = `
+	SELECT json_agg(json_build_object('word', n.word, 'sense', n.meaning, 'place', k.place)
+	                ORDER BY k.place, n.word) AS glosses
+	FROM keywordmapping k
+	JOIN natlangwords n ON n.wordid = k.natlangwordid
+	WHERE k.definitionid = d.definitionid`
+
+// gloss is a gloss (place 0) or place keyword of a definition.
+type gloss struct {
+	Word  string `json:"word" xml:"word,attr"`
+	Sense string `json:"sense,omitempty" xml:"sense,attr,omitempty"`
+	Place int    `json:"place" xml:"place,attr,omitempty"`
+}
+
+// xmlEntry is a `<valsi>` element of a jbovlaste export.
+type xmlEntry struct {
+	XMLName    xml.Name `xml:"valsi"`
+	Word       string   `xml:"word,attr"`
+	Type       string   `xml:"type,attr"`
+	Rafsi      []string `xml:"rafsi"`
+	Selmaho    string   `xml:"selmaho,omitempty"`
+	Username   string   `xml:"user>username,omitempty"`
+	Definition string   `xml:"definition"`
+	Notes      string   `xml:"notes,omitempty"`
+	Glosswords []gloss  `xml:"glossword"`
+	Keywords   []gloss  `xml:"keyword"`
+}
+
+type jsonEntry struct {
+	Word        string           `json:"word"`
+	Type        string           `json:"type"`
+	Rafsi       []string         `json:"rafsi,omitempty"`
+	Definitions []jsonDefinition `json:"definitions"`
+}
+
+type jsonDefinition struct {
+	ID         int32   `json:"id"`
+	Language   string  `json:"language"`
+	Definition string  `json:"definition"`
+	Notes      *string `json:"notes,omitempty"`
+	Selmaho    *string `json:"selmaho,omitempty"`
+	Author     *string `json:"author,omitempty"`
+	Score      int64   `json:"score"`
+	Glosses    []gloss `json:"glosses"`
+}
+
+// countEntries returns how many entries a dump of `langID` (nil for all languages) has.
+func countEntries(ctx context.Context, db *pgxpool.Pool, langID *int32, format string) (int64, error) {
+	query := `SELECT COUNT(DISTINCT (valsiid, langid)) FROM definitions WHERE $1::int IS NULL OR langid = $1`
+	if format == FormatJSON {
+		query = `
+			SELECT COUNT(*) FROM valsi v
+			WHERE $1::int IS NULL OR EXISTS (SELECT 1 FROM definitions d WHERE d.valsiid = v.valsiid AND d.langid = $1)`
+	}
+	var total int64
+	err := db.QueryRow(ctx, query, langID).Scan(&total)
+	return total, err
+}
+
+// writeXML writes a jbovlaste-compatible dump of `langID` (nil for all languages).
+func writeXML(ctx context.Context, db *pgxpool.Pool, w io.Writer, langID *int32, progress progressFunc) error {
+	type direction struct {
+		id   int32
+		name string
+	}
+	rows, err := db.Query(ctx, `
+		SELECT l.langid, COALESCE(NULLIF(l.englishname, ''), l.tag)
+		FROM languages l
+		WHERE ($1::int IS NULL OR l.langid = $1)
+		  AND EXISTS (SELECT 1 FROM definitions d WHERE d.langid = l.langid)
+		ORDER BY l.tag`, langID)
+	if err != nil {
+		return fmt.Errorf("failed to list languages: %w", err)
+	}
+	var directions []direction
+	for rows.Next() {
+		var d direction
+		if err := rows.Scan(&d.id, &d.name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to list languages: %w", err)
+		}
+		directions = append(directions, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list languages: %w", err)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	dictionary := xml.StartElement{Name: xml.Name{Local: "dictionary"}}
+	if err := enc.EncodeToken(dictionary); err != nil {
+		return err
+	}
+	var done int64
+	for _, dir := range directions {
+		start := xml.StartElement{Name: xml.Name{Local: "direction"}, Attr: []xml.Attr{
+			{Name: xml.Name{Local: "from"}, Value: "lojban"},
+			{Name: xml.Name{Local: "to"}, Value: dir.name},
+		}}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := writeXMLDirection(ctx, db, enc, dir.id, &done, progress); err != nil {
+			return err
+		}
+		if err := enc.EncodeToken(start.End()); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeToken(dictionary.End()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// writeXMLDirection writes the `<valsi>` elements of one language.
+func writeXMLDirection(ctx context.Context, db *pgxpool.Pool, enc *xml.Encoder, langID int32, done *int64, progress progressFunc) error {
+	rows, err := db.Query(ctx, `
+		SELECT v.word, COALESCE(t.descriptor, ''), COALESCE(v.rafsi, ''),
+		       COALESCE(d.selmaho, ''), COALESCE(u.username, ''), d.definition, COALESCE(d.notes, ''), g.glosses
+		FROM valsi v
+		LEFT JOIN valsitypes t ON t.typeid = v.typeid
+		JOIN LATERAL (
+			SELECT d.definitionid, d.definition, d.notes, d.selmaho, d.userid
+			FROM definitions d
+			WHERE d.valsiid = v.valsiid AND d.langid = $1
+			ORDER BY COALESCE((SELECT SUM(value) FROM definitionvotes dv WHERE dv.definitionid = d.definitionid), 0) DESC,
+			         d.definitionnum, d.definitionid
+			LIMIT 1
+		) d ON TRUE
+		LEFT JOIN users u ON u.userid = d.userid
+		LEFT JOIN LATERAL (`+glossesSelect+`) g ON TRUE
+		ORDER BY v.word`, langID)
+	if err != nil {
+		return fmt.Errorf("failed to read entries: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			e       xmlEntry
+			rafsi   string
+			glosses []byte
+		)
+		if err := rows.Scan(&e.Word, &e.Type, &rafsi, &e.Selmaho, &e.Username, &e.Definition, &e.Notes, &glosses); err != nil {
+			return fmt.Errorf("failed to read entry: %w", err)
+		}
+		e.Rafsi = strings.Fields(rafsi)
+		all, err := decodeGlosses(glosses)
+		if err != nil {
+			return err
+		}
+		for _, g := range all {
+			if g.Place == 0 {
+				e.Glosswords = append(e.Glosswords, g)
+			} else {
+				e.Keywords = append(e.Keywords, g)
+			}
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		*done++
+		progress(*done)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read entries: %w", err)
+	}
+	return nil
+}
+
+// writeJSON writes every definition of `langID` (nil for all languages, including words
+// without definitions), grouped by word.
+func writeJSON(ctx context.Context, db *pgxpool.Pool, w io.Writer, langID *int32, language *string, progress progressFunc) error {
+	header, err := json.Marshal(struct {
+		GeneratedAt time.Time `json:"generated_at"`
+		Language    *string   `json:"language"`
+	}{time.Now().UTC(), language})
+	if err != nil {
+		return err
+	}
+	// Reopen the header object to append the entries array.
+	if _, err := fmt.Fprintf(w, "%s,\"entries\":[\n", header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT v.valsiid, v.word, COALESCE(t.descriptor, ''), COALESCE(v.rafsi, ''),
+		       d.definitionid, l.tag, d.definition, d.notes, d.selmaho, u.username,
+		       COALESCE((SELECT SUM(value) FROM definitionvotes dv WHERE dv.definitionid = d.definitionid), 0),
+		       g.glosses
+		FROM valsi v
+		LEFT JOIN valsitypes t ON t.typeid = v.typeid
+		LEFT JOIN definitions d ON d.valsiid = v.valsiid AND ($1::int IS NULL OR d.langid = $1)
+		LEFT JOIN languages l ON l.langid = d.langid
+		LEFT JOIN users u ON u.userid = d.userid
+		LEFT JOIN LATERAL (`+glossesSelect+`) g ON TRUE
+		WHERE $1::int IS NULL OR d.definitionid IS NOT NULL
+		ORDER BY v.word, v.valsiid, l.tag, d.definitionnum, d.definitionid`, langID)
+	if err != nil {
+		return fmt.Errorf("failed to read entries: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		entry   *jsonEntry
+		entryID int32
+		done    int64
+	)
+	flush := func() error {
+		if entry == nil {
+			return nil
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if done > 0 {
+			if _, err := io.WriteString(w, ",\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		done++
+		progress(done)
+		return nil
+	}
+	for rows.Next() {
+		var (
+			valsiID      int32
+			word, typ    string
+			rafsi        string
+			definitionID *int32
+			tag          *string
+			text         *string
+			def          jsonDefinition
+			glosses      []byte
+		)
+		if err := rows.Scan(&valsiID, &word, &typ, &rafsi, &definitionID, &tag, &text,
+			&def.Notes, &def.Selmaho, &def.Author, &def.Score, &glosses); err != nil {
+			return fmt.Errorf("failed to read entry: %w", err)
+		}
+		if entry == nil || valsiID != entryID {
+			if err := flush(); err != nil {
+				return err
+			}
+			entry = &jsonEntry{Word: word, Type: typ, Rafsi: strings.Fields(rafsi), Definitions: []jsonDefinition{}}
+			entryID = valsiID
+		}
+		if definitionID == nil {
+			continue
+		}
+		def.ID, def.Language, def.Definition = *definitionID, *tag, *text
+		if def.Glosses, err = decodeGlosses(glosses); err != nil {
+			return err
+		}
+		entry.Definitions = append(entry.Definitions, def)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read entries: %w", err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n]}\n")
+	return err
+}
+
+// decodeGlosses reads the result of `glossesSelect`, which is NULL without glosses.
+func decodeGlosses(data []byte) ([]gloss, error) {
+	glosses := []gloss{}
+	if data == nil {
+		return glosses, nil
+	}
+	if err := json.Unmarshal(data, &glosses); err != nil {
+		return nil, fmt.Errorf("failed to decode glosses: %w", err)
+	}
+	return glosses, nil
+}
@@ -0,0 +1,29 @@
+// Package flags, as part of the admin module.
+// This file, `dto.go`, defines the request and response bodies of the feature flag API.
+package flags
+
+import "time"
+
+// Flag is a feature flag.
+// @Description A feature flag, switched by admins at runtime
+type Flag struct {
+	// example: "semantic_search"
+	Name string `json:"name"`
+	// example: true
+	Enabled bool `json:"enabled"`
+	// What the flag switches
+	// example: "Rank search results by embedding similarity"
+	Description *string `json:"description,omitempty"`
+	// Absent if the account no longer exists
+	UpdatedBy *int32    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UpdateFlagRequest switches a flag, creating it if needed.
+// @Description Request body for switching a feature flag
+type UpdateFlagRequest struct {
+	// example: true
+	Enabled *bool `json:"enabled" validate:"required"`
+	// Replaces the description when present
+	Description *string `json:"description,omitempty" validate:"omitempty,max=500"`
+}
@@ -0,0 +1,90 @@
+// Package flags holds the feature flags admins switch at runtime, to roll features out or turn
+// them off without a deployment.
+// This file, `handlers.go`, serves /admin/flags, where admins list the feature flags and switch
+// them.
+package flags
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// FlagHandlers provides HTTP handlers for feature flags.
+type FlagHandlers struct {
+	service *FlagService
+}
+
+// NewFlagHandlers creates new FlagHandlers.
+func NewFlagHandlers(service *FlagService) *FlagHandlers {
+	return &FlagHandlers{service: service}
+}
+
+// HandleListFlags godoc
+// @Summary List feature flags
+// @Description Returns every feature flag with its state, by name. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} Flag "Flags"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Admin rate limit exceeded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/flags [get]
+func (h *FlagHandlers) HandleListFlags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flags, err := h.service.List(r.Context())
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, flags)
+	}
+}
+
+// HandleUpdateFlag godoc
+// @Summary Switch a feature flag
+// @Description Turns a feature flag on or off, creating it if it doesn't exist. Instances see the change at once with Redis, otherwise within CACHE_FLAGS_TTL. Admins only.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Param name path string true "Flag name"
+// @Param flag body UpdateFlagRequest true "New state"
+// @Success 200 {object} Flag "Updated flag"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid flag name or payload"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin, or missing X-Sudo-Token"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Admin rate limit exceeded"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/flags/{name} [put]
+func (h *FlagHandlers) HandleUpdateFlag() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		var req UpdateFlagRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		flag, err := h.service.Set(r.Context(), chi.URLParam(r, "name"), userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, flag)
+	}
+}
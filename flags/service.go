@@ -0,0 +1,138 @@
+// Package flags, as part of the admin module.
+// This file, `service.go`, reads and switches feature flags. Code checks a flag with Enabled,
+// which reads all flags through the cache, so checking is cheap enough for every request; a
+// change is seen at once where Redis holds the cache, and after CACHE_FLAGS_TTL otherwise.
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/logging"
+)
+
+// cacheKey is the key of the enabled state of all flags.
+const cacheKey = "all"
+
+// validName is the shape of a flag name, e.g. "semantic_search".
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// FlagService provides the feature flag API.
+type FlagService struct {
+	db     *pgxpool.Pool
+	cache  *cache.Cache
+	logger *slog.Logger
+}
+
+// NewFlagService creates a FlagService caching the flags in `c`.
+func NewFlagService(db *pgxpool.Pool, c *cache.Cache) *FlagService {
+	return &FlagService{db: db, cache: c, logger: logging.For("flags")}
+}
+
+const flagSelect = `SELECT name, enabled, description, updated_by, updated_at FROM feature_flags`
+
+func scanFlag(row pgx.Row) (*Flag, error) {
+	var f Flag
+	if err := row.Scan(&f.Name, &f.Enabled, &f.Description, &f.UpdatedBy, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// List returns every flag, by name.
+func (s *FlagService) List(ctx context.Context) ([]Flag, error) {
+	rows, err := s.db.Query(ctx, flagSelect+` ORDER BY name`)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list feature flags", err)
+	}
+	defer rows.Close()
+	flags := []Flag{}
+	for rows.Next() {
+		f, err := scanFlag(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read feature flag", err)
+		}
+		flags = append(flags, *f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list feature flags", err)
+	}
+	return flags, nil
+}
+
+// Enabled tells whether the flag `name` is on. Unknown flags are off, and so is every flag
+// while they can't be loaded: a feature behind a flag is one the API can do without.
+func (s *FlagService) Enabled(ctx context.Context, name string) bool {
+	enabled, err := cache.GetOrCompute(ctx, s.cache, cacheKey, s.loadEnabled)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to load feature flags", "flag", name, "error", err)
+		return false
+	}
+	return enabled[name]
+}
+
+// loadEnabled reads the state of all flags.
+func (s *FlagService) loadEnabled(ctx context.Context) (map[string]bool, error) {
+	rows, err := s.db.Query(ctx, `SELECT name, enabled FROM feature_flags`)
+	if err != nil {
+		return nil, err
+	}
+	enabled := map[string]bool{}
+	var name string
+	var on bool
+	_, err = pgx.ForEachRow(rows, []any{&name, &on}, func() error {
+		enabled[name] = on
+		return nil
+	})
+	return enabled, err
+}
+
+// Set switches the flag `name`, creating it if it doesn't exist yet. The change is audited
+// with the flag before and after it.
+func (s *FlagService) Set(ctx context.Context, name string, actorID int, req UpdateFlagRequest) (*Flag, error) {
+	if !validName.MatchString(name) {
+		return nil, apperror.NewBadRequestError(fmt.Sprintf("invalid flag name %q: use up to 64 lowercase letters, digits, '_', '.' and '-'", name), nil)
+	}
+	var updated *Flag
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		before, err := scanFlag(tx.QueryRow(ctx, flagSelect+` WHERE name = $1 FOR UPDATE`, name))
+		if errors.Is(err, pgx.ErrNoRows) {
+			before = nil
+		} else if err != nil {
+			return apperror.NewDatabaseError("failed to load feature flag", err)
+		}
+		updated, err = scanFlag(tx.QueryRow(ctx, `
+			INSERT INTO feature_flags (name, enabled, description, updated_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (name) DO UPDATE SET
+				enabled = EXCLUDED.enabled,
+				description = COALESCE(EXCLUDED.description, feature_flags.description),
+				updated_by = EXCLUDED.updated_by,
+				updated_at = NOW()
+			RETURNING name, enabled, description, updated_by, updated_at`,
+			name, *req.Enabled, req.Description, actorID))
+		if err != nil {
+			return apperror.NewDatabaseError("failed to update feature flag", err)
+		}
+		entry := audit.Entry{ActorID: actorID, Action: audit.ActionFlagUpdate, TargetType: audit.TargetFlag, TargetID: name, After: updated}
+		if before != nil {
+			entry.Before = before
+		}
+		return audit.Record(ctx, tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Invalidate(ctx, cacheKey)
+	return updated, nil
+}
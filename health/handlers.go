@@ -0,0 +1,125 @@
+// Package health reports whether the service can do its work, for load balancers and for
+// operators.
+// This file, `handlers.go`, serves /health, which pings the database and Redis and reports the
+// connection pool statistics, and /ready, the readiness probe, which only checks the database.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/render"
+)
+
+// pingTimeout bounds the database check, so a hung database fails the check instead of hanging it.
+const pingTimeout = 2 * time.Second
+
+// Status values of a HealthResponse.
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// Database values of a HealthResponse.
+const (
+	DatabaseOK          = "ok"
+	DatabaseStarting    = "starting"    // Not reached or set up since startup (degraded mode)
+	DatabaseUnreachable = "unreachable" // Set up, but not answering now
+)
+
+// HealthResponse is the health check result.
+type HealthResponse struct {
+	Status   string                  `json:"status"`
+	Database string                  `json:"database"`
+	Redis    string                  `json:"redis,omitempty"` // "ok" or "unreachable"; only with REDIS_URL, and only in /health
+	Pools    map[string]db.PoolStats `json:"pools,omitempty"` // Latest sample of each connection pool
+}
+
+// HealthHandlers provides the health check and readiness endpoints.
+type HealthHandlers struct {
+	primary   *pgxpool.Pool
+	monitor   *db.PoolMonitor
+	readiness *db.Readiness
+	redis     *cache.Redis
+	logger    *slog.Logger
+}
+
+// NewHealthHandlers creates new HealthHandlers. The primary database is pinged on each check;
+// the pool statistics come from `monitor`, and whether startup finished from `readiness`.
+func NewHealthHandlers(primary *pgxpool.Pool, monitor *db.PoolMonitor, readiness *db.Readiness) *HealthHandlers {
+	return &HealthHandlers{primary: primary, monitor: monitor, readiness: readiness, logger: logging.For("health")}
+}
+
+// UseRedis adds the Redis server to the health check.
+func (h *HealthHandlers) UseRedis(redis *cache.Redis) {
+	h.redis = redis
+}
+
+// HandleHealth godoc
+// @Summary Health check
+// @Description Pings the primary database, and Redis when it is configured, and returns the latest connection pool statistics (connections acquired, idle, open and allowed, acquisitions that had to wait, and the total wait). Responds 503 when the database or Redis can't be reached, or the database hasn't been since a degraded start. The same pool statistics are published as Prometheus gauges at /metrics.
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse "The service is healthy"
+// @Failure 503 {object} HealthResponse "The database can't be reached"
+// @Router /health [get]
+func (h *HealthHandlers) HandleHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := h.check(r.Context())
+		resp.Pools = h.monitor.Stats()
+		if h.redis != nil {
+			resp.Redis = DatabaseOK
+			if err := h.redis.Check(r.Context()); err != nil {
+				h.logger.WarnContext(r.Context(), "Redis ping failed", "error", err)
+				resp.Status, resp.Redis = StatusUnavailable, DatabaseUnreachable
+			}
+		}
+		writeResponse(w, r, resp)
+	}
+}
+
+// HandleReady godoc
+// @Summary Readiness probe
+// @Description Tells load balancers and orchestrators whether to send traffic. Responds 503 while the server runs in degraded mode, having started without its database (`database` is "starting"), and whenever the database can't be reached ("unreachable"). Redis isn't checked: without it, only cross-instance features degrade, and taking every instance out of rotation would make that worse.
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse "Ready for traffic"
+// @Failure 503 {object} HealthResponse "Not ready"
+// @Router /ready [get]
+func (h *HealthHandlers) HandleReady() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, r, h.check(r.Context()))
+	}
+}
+
+// check reports the state of the database.
+func (h *HealthHandlers) check(ctx context.Context) HealthResponse {
+	if !h.readiness.Ready() {
+		return HealthResponse{Status: StatusUnavailable, Database: DatabaseStarting}
+	}
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	if err := h.primary.Ping(ctx); err != nil {
+		// The error may name hosts and users, so it goes to the log rather than the response.
+		h.logger.WarnContext(ctx, "Database ping failed", "error", err)
+		return HealthResponse{Status: StatusUnavailable, Database: DatabaseUnreachable}
+	}
+	return HealthResponse{Status: StatusOK, Database: DatabaseOK}
+}
+
+// writeResponse writes a check result, with 503 unless it is ok.
+func writeResponse(w http.ResponseWriter, r *http.Request, resp HealthResponse) {
+	status := http.StatusOK
+	if resp.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	render.Write(w, r, status, resp)
+}
@@ -0,0 +1,67 @@
+// Package imageproc contains server-side image processing used by uploads (currently avatars).
+// Decoding is restricted to common web formats and guarded against oversized images
+// ("decompression bombs") before any pixel data is allocated.
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	// Registering decoders for `image.Decode` happens through blank imports.
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/webp"
+
+	"golang.org/x/image/draw"
+)
+
+// MaxSourcePixels bounds the decoded image size (width * height) to keep memory use predictable.
+const MaxSourcePixels = 40_000_000
+
+// ErrUnsupportedImage is returned when the input isn't a decodable GIF/JPEG/PNG/WebP image.
+var ErrUnsupportedImage = errors.New("unsupported or corrupt image")
+
+// Decode reads an image after checking its header-declared dimensions.
+// It returns the image and the detected format name ("jpeg", "png", ...).
+func Decode(data []byte) (image.Image, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxSourcePixels {
+		return nil, "", fmt.Errorf("%w: dimensions %dx%d are out of range", ErrUnsupportedImage, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	return img, format, nil
+}
+
+// SquareThumbnail center-crops `src` to a square and scales it to `size`x`size` pixels
+// using Catmull-Rom resampling, which keeps small avatars sharp.
+func SquareThumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+	return dst
+}
+
+// EncodePNG writes the image as PNG. PNG keeps transparency, which matters for avatars.
+func EncodePNG(w io.Writer, img image.Image) error {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	return enc.Encode(w, img)
+}
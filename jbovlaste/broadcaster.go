@@ -8,11 +8,16 @@ package jbovlaste
 
 import (
 	"fmt"
+	"log/slog"
+	"strconv"
 	// `sync` provides synchronization primitives like `Mutex` and `RWMutex` for safe concurrent access to shared data.
 	"sync"
+	"time"
 
 	// `uuid` is used to generate unique identifiers for clients.
 	"github.com/google/uuid"
+
+	"github.com/user/lensisku-go/logging"
 )
 
 // ClientInfo holds the channels and state for a connected client.
@@ -35,10 +40,56 @@ type ClientInfo struct {
 
 	// `mu` is a mutex to protect concurrent access to `isCancelled`.
 	// This is important if multiple goroutines might try to read or write `isCancelled` simultaneously.
+	// It also guards `lastID` and `history`.
 	// mu: This is a "mutex", short for "mutual exclusion".
 	// It's like a "talking stick". Only the person (part of the code) holding the stick
 	// can change `isCancelled`. This prevents confusion if multiple parts try to change it at once.
 	mu sync.Mutex
+
+	// lastID is the ID of the client's latest event; events are numbered from 1.
+	lastID uint64
+
+	// history keeps the client's latest `historySize` events, oldest first, so a reconnecting
+	// EventSource can be sent the ones it missed.
+	history []SSEEvent
+
+	// The heartbeat's view of the client (see `heartbeat.go`), also guarded by `mu`:
+	// task is set for detached tasks, which are never evicted; streams counts the connections
+	// reading the channel, and idleSince is when the last one went away; missedPings counts
+	// consecutive pings that found the channel full.
+	task        bool
+	streams     int
+	idleSince   time.Time
+	missedPings int
+
+	// mirror is set for the copy of a client that lives on another instance (see `relay.go`);
+	// lastRelayed is when that instance last sent an event for it.
+	mirror      bool
+	lastRelayed time.Time
+
+	// topic is set for the client of a stream following a topic (see `topics.go`).
+	topic string
+}
+
+// historySize is how many events per client are kept for replay, the same as the channel
+// buffer.
+const historySize = 32
+
+// record numbers an event and adds it to the client's history. The caller holds `c.mu`.
+func (c *ClientInfo) record(event SSEEvent) SSEEvent {
+	c.lastID++
+	event.ID = strconv.FormatUint(c.lastID, 10)
+	c.remember(event)
+	return event
+}
+
+// remember adds an event that already has its ID to the client's history. The caller holds
+// `c.mu`.
+func (c *ClientInfo) remember(event SSEEvent) {
+	if len(c.history) == historySize {
+		c.history = append(c.history[:0], c.history[1:]...)
+	}
+	c.history = append(c.history, event)
 }
 
 // Broadcaster manages SSE clients and message broadcasting.
@@ -57,6 +108,17 @@ type Broadcaster struct {
 	// Many can read the list at the same time (e.g., to send a message).
 	// But only one can write to it (e.g., add or remove a client) at a time.
 	mu sync.RWMutex
+
+	// topics holds the clients following each topic, by topic and client ID; `mu` guards it
+	// along with `clients`.
+	topics map[string]map[string]*ClientInfo
+
+	// With several instances, events, cancellations and removals are also sent to the other
+	// instances through `outbox` (see `relay.go`). Both are unset on a single instance.
+	instanceID string
+	outbox     chan relayMessage
+
+	logger *slog.Logger
 }
 
 // NewBroadcaster creates and returns a new Broadcaster instance.
@@ -66,6 +128,8 @@ func NewBroadcaster() *Broadcaster {
 	return &Broadcaster{
 		// Initialize with an empty list of clients.
 		clients: make(map[string]*ClientInfo),
+		topics:  make(map[string]map[string]*ClientInfo),
+		logger:  logging.For("sse"),
 	}
 }
 
@@ -91,11 +155,12 @@ func (b *Broadcaster) NewClient() (string, <-chan SSEEvent, <-chan bool) {
 		// This means sending a cancel signal won't block if the receiver isn't immediately ready.
 		cancelChannel: make(chan bool, 1),
 		isCancelled:   false, // They haven't cancelled anything yet.
+		idleSince:     time.Now(),
 	}
 
 	// Add the new client to the `clients` map.
-	b.clients[clientID] = clientInfo                    // Add this new listener to our list.
-	fmt.Printf("New client registered: %s\n", clientID) // Log that a new listener joined.
+	b.clients[clientID] = clientInfo                               // Add this new listener to our list.
+	b.logger.Debug("New client registered", "client_id", clientID) // Log that a new listener joined.
 
 	// Give back:
 	// 1. Their unique ID.
@@ -111,9 +176,11 @@ func (b *Broadcaster) NewClient() (string, <-chan SSEEvent, <-chan bool) {
 // This is like the radio station sending a specific news update to one particular listener.
 func (b *Broadcaster) Broadcast(clientID string, event SSEEvent) error {
 	// Use RLock for read access to `clients` map, allowing concurrent reads.
+	// Keep holding it while sending, so the heartbeat can't remove the client (closing its
+	// channel) in the middle of the send.
 	b.mu.RLock()                          // Grab the "read" part of the talking stick for `clients` (others can also read).
+	defer b.mu.RUnlock()                  // Release the read stick when done.
 	clientInfo, ok := b.clients[clientID] // Find the listener by their ID.
-	b.mu.RUnlock()                        // Release the read stick.
 
 	if !ok { // If we couldn't find a listener with that ID...
 		// Return an error if the client is not found.
@@ -126,11 +193,13 @@ func (b *Broadcaster) Broadcast(clientID string, event SSEEvent) error {
 	if clientInfo.isCancelled {
 		clientInfo.mu.Unlock() // Release the client's stick.
 		// If they cancelled, maybe we don't send them this update.
-		// fmt.Printf("Skipping broadcast to cancelled client %s\n", clientID)
+		// b.logger.Debug("Skipping broadcast to cancelled client", "client_id", clientID)
 		// Decide on behavior: either return an error or succeed quietly.
 		return nil // Or return an error saying "they cancelled". For now, just succeed quietly.
 	}
-	clientInfo.mu.Unlock() // Release the client's stick.
+	event = clientInfo.record(event) // Number the event and keep it for replay.
+	clientInfo.mu.Unlock()           // Release the client's stick.
+	b.publish(relayMessage{Kind: relayEvent, ClientID: clientID, Event: &event})
 
 	// Use a `select` statement with a `default` case for a non-blocking send on the `sseChannel`.
 	// Try to send the news update (event) to the listener's personal radio receiver (sseChannel).
@@ -142,9 +211,8 @@ func (b *Broadcaster) Broadcast(clientID string, event SSEEvent) error {
 		// If we reach `default`, it means `clientInfo.sseChannel <- event` would have blocked.
 		// This usually happens if the listener's channel is full (they're not processing messages fast enough)
 		// or if they've disconnected and their channel is closed.
-		fmt.Printf("Failed to send SSE to client %s: channel likely full or closed\n", clientID)
-		// We might decide to remove such an unresponsive client:
-		// b.RemoveClient(clientID)
+		b.logger.Debug("Failed to send SSE to client: channel likely full or closed", "client_id", clientID)
+		// If it stays that way, the heartbeat removes the client (see `heartbeat.go`).
 		return fmt.Errorf("failed to send SSE to client %s: channel full or closed", clientID)
 	}
 }
@@ -152,7 +220,17 @@ func (b *Broadcaster) Broadcast(clientID string, event SSEEvent) error {
 // CancelImport sends a cancellation signal to the task associated with the clientID.
 // It returns an error if the client is not found or if the import was already cancelled.
 // This is when the server itself (or another part of it) decides to tell a client's task to stop.
+// The other instances are told too, since the task may be running on one of them.
 func (b *Broadcaster) CancelImport(clientID string) error {
+	if err := b.signalCancel(clientID); err != nil {
+		return err
+	}
+	b.publish(relayMessage{Kind: relayCancel, ClientID: clientID})
+	return nil
+}
+
+// signalCancel is CancelImport on this instance only.
+func (b *Broadcaster) signalCancel(clientID string) error {
 	// Read-lock to find the client.
 	b.mu.RLock()                          // Grab read stick for the main clients list.
 	clientInfo, ok := b.clients[clientID] // Find the client.
@@ -178,7 +256,7 @@ func (b *Broadcaster) CancelImport(clientID string) error {
 	// Try to send the "stop!" signal on their `cancelChannel`.
 	select {
 	case clientInfo.cancelChannel <- true: // Send `true` to signal cancellation.
-		fmt.Printf("Cancellation signal sent to client %s\n", clientID)
+		b.logger.Debug("Cancellation signal sent to client", "client_id", clientID)
 		return nil // Signal sent successfully.
 	default:
 		// This `default` case means sending to `cancelChannel` would block.
@@ -203,12 +281,23 @@ func (b *Broadcaster) RemoveClient(clientID string) {
 		close(clientInfo.cancelChannel) // Close their cancellation signal channel.
 		// Remove the client from the map.
 		delete(b.clients, clientID) // Remove them from our list of active listeners.
-		fmt.Printf("Client %s removed\n", clientID)
+		b.logger.Debug("Client removed", "client_id", clientID)
+		if clientInfo.topic != "" {
+			// Topic clients exist on this instance only.
+			delete(b.topics[clientInfo.topic], clientID)
+			if len(b.topics[clientInfo.topic]) == 0 {
+				delete(b.topics, clientInfo.topic)
+			}
+		} else if !clientInfo.mirror {
+			// Other instances drop their copies.
+			b.publish(relayMessage{Kind: relayRemove, ClientID: clientID})
+		}
 	}
 }
 
 // ListActiveImports returns a list of client IDs that are considered active (not cancelled).
 // In this Go version, "active import" is synonymous with an "active client" that hasn't been explicitly cancelled.
+// Streams following a topic aren't tasks and aren't listed.
 func (b *Broadcaster) ListActiveImports() []string {
 	// Read-lock to iterate over clients.
 	b.mu.RLock()
@@ -221,13 +310,39 @@ func (b *Broadcaster) ListActiveImports() []string {
 		// Safely read the `isCancelled` flag.
 		isCancelled := clientInfo.isCancelled
 		clientInfo.mu.Unlock()
-		if !isCancelled {
+		if !isCancelled && clientInfo.topic == "" {
 			activeIDs = append(activeIDs, id)
 		}
 	}
 	return activeIDs
 }
 
+// EventsSince returns the events of a client that came after the one with ID `lastEventID`
+// (the Last-Event-ID header of a reconnecting EventSource), oldest first, as far as the history
+// goes back. It returns nil for an empty or invalid ID and for an unknown client.
+func (b *Broadcaster) EventsSince(clientID, lastEventID string) []SSEEvent {
+	last, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil {
+		return nil
+	}
+	b.mu.RLock()
+	clientInfo, ok := b.clients[clientID]
+	b.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	clientInfo.mu.Lock()
+	defer clientInfo.mu.Unlock()
+	var events []SSEEvent
+	for _, event := range clientInfo.history {
+		if id, _ := strconv.ParseUint(event.ID, 10, 64); id > last {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
 // GetClientSSEChannel returns the SSE channel for a given client ID.
 // This is useful for an HTTP handler to stream SSE events to the client.
 // Returns nil if client is not found.
@@ -0,0 +1,246 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `handlers.go`, exposes background task progress over HTTP: a list of active
+// tasks, an SSE stream per task and a cancel endpoint, plus the import event stream, which a
+// UI opens before uploading an export. All of them are admin routes; cancellations are audited.
+package jbovlaste
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+)
+
+// TaskListResponse lists the tasks that are still running.
+// @Description IDs of background tasks that haven't been cancelled
+type TaskListResponse struct {
+	TaskIDs []string `json:"task_ids"`
+}
+
+// TaskHandlers serves the progress of tasks started with `Broadcaster.StartTask`.
+type TaskHandlers struct {
+	broadcaster *Broadcaster
+	audit       *audit.Log
+}
+
+// NewTaskHandlers creates the task handlers.
+func NewTaskHandlers(broadcaster *Broadcaster) *TaskHandlers {
+	return &TaskHandlers{broadcaster: broadcaster}
+}
+
+// UseAudit records the cancellations in `log`.
+func (h *TaskHandlers) UseAudit(log *audit.Log) {
+	h.audit = log
+}
+
+// HandleListTasks godoc
+// @Summary List background tasks
+// @Description Returns the IDs of background tasks (such as re-embedding campaigns) that haven't been cancelled, including finished ones for a few minutes after they end. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} TaskListResponse "Task IDs"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Router /admin/tasks [get]
+func (h *TaskHandlers) HandleListTasks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.Write(w, r, http.StatusOK, TaskListResponse{TaskIDs: h.broadcaster.ListActiveImports()})
+	}
+}
+
+// HandleTaskEvents godoc
+// @Summary Stream task progress
+// @Description Streams `progress` Server-Sent Events whose data is a ProgressEvent. The stream ends after the final event (done, failed or cancelled). Events carry an `id`. Each event is delivered to one connection only, so use a single subscriber per task; a reconnecting EventSource sends the Last-Event-ID header and first gets the events it missed, from the last 32 of the task. Admins only.
+// @Tags admin
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param taskID path string true "Task ID"
+// @Param Last-Event-ID header string false "ID of the last event received, to replay the ones after it"
+// @Success 200 {object} ProgressEvent "Stream of progress events"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Unknown or expired task"
+// @Router /admin/tasks/{taskID}/events [get]
+func (h *TaskHandlers) HandleTaskEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID := chi.URLParam(r, "taskID")
+		events := h.broadcaster.GetClientSSEChannel(taskID)
+		if events == nil {
+			auth.WriteError(w, r, apperror.NewNotFoundError("Task not found", nil))
+			return
+		}
+
+		defer h.broadcaster.trackStream(taskID)()
+		missed := h.broadcaster.EventsSince(taskID, r.Header.Get("Last-Event-ID"))
+		streamEvents(w, r, events, missed, true)
+	}
+}
+
+// HandleCancelTask godoc
+// @Summary Cancel a background task
+// @Description Asks a running task to stop. The task acknowledges with a final `cancelled` progress event. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Param taskID path string true "Task ID"
+// @Success 202 "Cancellation requested"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Unknown or expired task"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Task already cancelled"
+// @Router /admin/tasks/{taskID}/cancel [post]
+func (h *TaskHandlers) HandleCancelTask() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		taskID := chi.URLParam(r, "taskID")
+		if cancelClient(w, r, h.broadcaster, taskID) {
+			recordCancel(r, h.audit, audit.ActionTaskCancel, audit.TargetTask, taskID)
+		}
+	}
+}
+
+// ImportConnectedEvent is the data of the `connected` event that opens an import event stream.
+// @Description Identifies an import event stream
+type ImportConnectedEvent struct {
+	// Pass as `client_id` when uploading, and to the cancel endpoint
+	// example: "3f1c2a9e-5b7d-4e8f-9a0b-1c2d3e4f5a6b"
+	ClientID string `json:"client_id"`
+}
+
+// HandleImportEvents godoc
+// @Summary Stream import progress
+// @Description Registers an import client and streams its Server-Sent Events. The first event, `connected`, carries the client ID (an ImportConnectedEvent); pass it as `client_id` to POST /api/v1/import/xml and the import reports its `progress` events (ProgressEvent) here. The client is removed when the connection closes; an import it started keeps running. Admins only.
+// @Tags admin
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Success 200 {object} ImportConnectedEvent "Stream of connected and progress events"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Router /api/v1/import/events [get]
+func (im *Importer) HandleImportEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, events, _ := im.broadcaster.NewClient()
+		defer im.broadcaster.RemoveClient(clientID)
+		defer im.broadcaster.trackStream(clientID)()
+
+		data, _ := json.Marshal(ImportConnectedEvent{ClientID: clientID})
+		im.broadcaster.Broadcast(clientID, SSEEvent{Event: "connected", Data: string(data)})
+		streamEvents(w, r, events, nil, false)
+	}
+}
+
+// HandleCancelImport godoc
+// @Summary Cancel an import
+// @Description Asks the import reporting to an import events client to stop after its current batch. Batches already written are kept. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Param clientID path string true "Client ID from the connected event"
+// @Success 202 "Cancellation requested"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin, or missing X-Sudo-Token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Unknown client"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Import already cancelled"
+// @Router /api/v1/import/{clientID}/cancel [post]
+func (im *Importer) HandleCancelImport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := chi.URLParam(r, "clientID")
+		if cancelClient(w, r, im.broadcaster, clientID) {
+			recordCancel(r, im.audit, audit.ActionImportCancel, audit.TargetImport, clientID)
+		}
+	}
+}
+
+// cancelClient signals the task of a Broadcaster client to stop and answers 202. It reports
+// whether the task was cancelled.
+func cancelClient(w http.ResponseWriter, r *http.Request, b *Broadcaster, clientID string) bool {
+	if b.GetClientSSEChannel(clientID) == nil {
+		auth.WriteError(w, r, apperror.NewNotFoundError("Task not found", nil))
+		return false
+	}
+	if err := b.CancelImport(clientID); err != nil {
+		auth.WriteError(w, r, apperror.NewConflictError("Task already cancelled", err).WithCode(apperror.CodeTaskCancelled))
+		return false
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return true
+}
+
+// recordCancel audits the cancellation of a task by the user of `r`.
+func recordCancel(r *http.Request, log *audit.Log, action, targetType, id string) {
+	userID, _ := auth.GetUserIDFromContext(r.Context())
+	log.Record(r.Context(), audit.Entry{ActorID: userID, Action: action, TargetType: targetType, TargetID: id})
+}
+
+// reconnectDelay is sent at the start of every stream as the time a browser waits before
+// reconnecting after the connection drops.
+const reconnectDelay = 3 * time.Second
+
+// streamEvents writes `missed`, then `events`, as a text/event-stream response until the
+// channel is closed (the client was removed), the client goes away or, with `untilFinal`, a
+// final progress event has been written. Events from the channel that were already replayed
+// from `missed` are skipped. The Broadcaster's heartbeat pings keep an idle stream open and
+// show when the client went away.
+func streamEvents(w http.ResponseWriter, r *http.Request, events <-chan SSEEvent, missed []SSEEvent, untilFinal bool) {
+	// The server's WriteTimeout is meant for ordinary responses; a stream stays open
+	// until the task ends or the client goes away.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	SSEEvent{Retry: reconnectDelay}.WriteTo(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	// write sends one event and reports whether the stream should end.
+	write := func(event SSEEvent) bool {
+		event.WriteTo(w)
+		if err := rc.Flush(); err != nil {
+			return true
+		}
+		var progress ProgressEvent
+		return untilFinal && json.Unmarshal([]byte(event.Data), &progress) == nil && progress.Final()
+	}
+	var replayed uint64
+	for _, event := range missed {
+		if write(event) {
+			return
+		}
+		replayed, _ = strconv.ParseUint(event.ID, 10, 64)
+	}
+
+	done := r.Context().Done()
+	for {
+		select {
+		case <-done:
+			if !errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+				return // The client went away.
+			}
+			// The router's request timeout fired, but the stream is meant to outlive it.
+			// From here on a disconnect shows up as a failed write instead.
+			done = nil
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if id, err := strconv.ParseUint(event.ID, 10, 64); err == nil && id <= replayed {
+				continue // Pings have no ID and always go through.
+			}
+			if write(event) {
+				return
+			}
+		}
+	}
+}
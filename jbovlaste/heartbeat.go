@@ -0,0 +1,89 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `heartbeat.go`, keeps the Broadcaster's client list from growing without bound.
+// Every `heartbeatInterval` each client is sent a ping through its SSE channel, which streams
+// write as a `: ping` comment: it keeps proxies from closing an idle connection, and writing it
+// to a connection that went away fails and ends the stream. A client is evicted when its
+// channel stays full for `maxMissedPings` pings in a row (nothing is reading it), or when no
+// stream has read it for `idleClientTimeout`. Clients of detached tasks (`StartTask`) are
+// never evicted, since nobody has to subscribe to a task; they are removed once the task has
+// finished (see `progress.go`). Mirrors of clients on other instances (see `relay.go`) go
+// after `mirrorTimeout` without events.
+package jbovlaste
+
+import (
+	"time"
+)
+
+const (
+	// heartbeatInterval is how often clients are pinged and checked.
+	heartbeatInterval = 15 * time.Second
+
+	// maxMissedPings is how many pings in a row may find a client's channel full.
+	maxMissedPings = 4
+
+	// idleClientTimeout is how long a client may go without a stream reading it.
+	idleClientTimeout = 2 * time.Minute
+)
+
+// StartHeartbeat pings and evicts clients in the background until `stop` is closed.
+func (b *Broadcaster) StartHeartbeat(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				b.sweep(now)
+			}
+		}
+	}()
+}
+
+// sweep pings every client once and removes the stale ones.
+func (b *Broadcaster) sweep(now time.Time) {
+	var stale []string
+	b.mu.RLock()
+	for id, clientInfo := range b.clients {
+		clientInfo.mu.Lock()
+		select {
+		case clientInfo.sseChannel <- SSEEvent{Comment: "ping"}:
+			clientInfo.missedPings = 0
+		default:
+			clientInfo.missedPings++
+		}
+		idle := clientInfo.streams == 0 && now.Sub(clientInfo.idleSince) >= idleClientTimeout
+		if !clientInfo.task && (clientInfo.missedPings >= maxMissedPings || idle) ||
+			clientInfo.mirror && now.Sub(clientInfo.lastRelayed) >= mirrorTimeout {
+			stale = append(stale, id)
+		}
+		clientInfo.mu.Unlock()
+	}
+	b.mu.RUnlock()
+
+	for _, id := range stale {
+		b.logger.Debug("Evicting stale client", "client_id", id)
+		b.RemoveClient(id)
+	}
+}
+
+// trackStream records that a stream reads the client's channel until the returned function
+// is called.
+func (b *Broadcaster) trackStream(clientID string) func() {
+	b.mu.RLock()
+	clientInfo, ok := b.clients[clientID]
+	b.mu.RUnlock()
+	if !ok {
+		return func() {}
+	}
+	clientInfo.mu.Lock()
+	clientInfo.streams++
+	clientInfo.mu.Unlock()
+	return func() {
+		clientInfo.mu.Lock()
+		clientInfo.streams--
+		clientInfo.idleSince = time.Now()
+		clientInfo.mu.Unlock()
+	}
+}
@@ -0,0 +1,731 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `import.go`, imports a jbovlaste XML export into the dictionary tables. The upload
+// is saved to a temporary file first, so the HTTP request can return right away; the import
+// then runs in the background on the import pool and reports its progress as a task
+// (see `progress.go`):
+//
+//  1. "prepare": resolve the export's language and the word types.
+//  2. "entries": stream the `<valsi>` elements and upsert them in batches of `importBatchSize`,
+//     each batch in its own transaction: valsi, then their definitions, then the glosses
+//     (`natlangwords` and `keywordmapping`).
+//
+// Importing is idempotent: words are matched by spelling, definitions by word, language and
+// text, glosses by word and sense, so importing the same export twice changes nothing. A
+// changed definition text is added as a new definition next to the old one rather than
+// replacing it, because other users may have voted on or commented the old one. New and
+// changed definitions get an approved revision in `definition_revisions`, like edits made
+// through the API. Cancelling keeps the batches committed so far. Definitions edited locally
+// since are handled by the import's conflict strategy (see `import_conflicts.go`).
+//
+// A dry run reads the export the same way but only compares it with the tables, building the
+// diff described in `import_diff.go` instead of writing.
+package jbovlaste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/changelog"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/render"
+)
+
+const (
+	// importUploadTimeout replaces the server's ReadTimeout for the upload, which is meant for
+	// small request bodies.
+	importUploadTimeout = 10 * time.Minute
+
+	// importBatchSize is how many entries are upserted per transaction.
+	importBatchSize = 500
+
+	// importBatchTimeout bounds the statements of a single batch.
+	importBatchTimeout = 2 * time.Minute
+)
+
+// Stages of an import, reported in ProgressEvent.Stage.
+const (
+	importStagePrepare = "prepare"
+	importStageEntries = "entries"
+)
+
+// ImportResponse is returned when an import has been accepted.
+// @Description An accepted dictionary import
+type ImportResponse struct {
+	// Follow progress at GET /admin/tasks/{task_id}/events; cancel with POST /admin/tasks/{task_id}/cancel
+	// example: "3f1c2a9e-5b7d-4e8f-9a0b-1c2d3e4f5a6b"
+	TaskID string `json:"task_id"`
+	// Size of the uploaded export in bytes
+	// example: 21474836
+	Bytes int64 `json:"bytes"`
+	// Nothing is written; the diff is at GET /api/v1/import/dry-runs/{task_id}
+	// example: false
+	DryRun bool `json:"dry_run"`
+	// What happens to locally edited definitions the export changes; the report is at GET /api/v1/import/conflicts/{task_id}
+	// example: "overwrite"
+	OnConflict string `json:"on_conflict"`
+}
+
+// importStats counts what an import changed.
+type importStats struct {
+	Entries     int64
+	Skipped     int64
+	NewValsi    int64
+	Definitions int64 // Newly added
+	Glosses     int64 // Newly added keyword mappings
+	Conflicts   int64 // Locally edited definitions the export changes
+}
+
+func (s importStats) String() string {
+	return fmt.Sprintf("%d entries read (%d skipped): %d new words, %d new definitions, %d new glosses, %d conflicts",
+		s.Entries, s.Skipped, s.NewValsi, s.Definitions, s.Glosses, s.Conflicts)
+}
+
+// Importer runs dictionary imports and dry runs, one at a time.
+type Importer struct {
+	pool        *pgxpool.Pool
+	broadcaster *Broadcaster
+	running     atomic.Bool
+	logger      *slog.Logger
+	audit       *audit.Log
+
+	mu    sync.Mutex
+	diffs map[string]*ImportDiff // Dry runs by task ID
+}
+
+// NewImporter creates an importer writing through `pool`, normally the dedicated import pool,
+// so a long import doesn't take connections away from requests.
+func NewImporter(pool *pgxpool.Pool, broadcaster *Broadcaster) *Importer {
+	return &Importer{pool: pool, broadcaster: broadcaster, logger: logging.For("import"), diffs: make(map[string]*ImportDiff)}
+}
+
+// UseAudit records the imports started and cancelled in `log`. Dry runs write nothing and are
+// not recorded.
+func (im *Importer) UseAudit(log *audit.Log) {
+	im.audit = log
+}
+
+// HandleImportXML godoc
+// @Summary Import a jbovlaste XML export
+// @Description Accepts a jbovlaste XML export as the multipart field "file" and imports its lojban entries (words, definitions and glosses) in the background. Progress is streamed at GET /admin/tasks/{task_id}/events, or to the stream opened with GET /api/v1/import/events when its `client_id` is passed; cancelling stops the import, keeping what was imported so far. Definitions edited locally that the export changes are handled according to `on_conflict`: `overwrite` takes the export's version, `skip` keeps the local one, `keep-newer` keeps local edits approved after `exported_at`, and `review` keeps the local version and queues the export's as a pending revision; the conflicts are reported at GET /api/v1/import/conflicts/{task_id}. With `dry_run=true` nothing is written: the export is compared with the dictionary and the diff is fetched from GET /api/v1/import/dry-runs/{task_id}. Only one import or dry run runs at a time. Admins only.
+// @Tags admin
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Param file formData file true "jbovlaste XML export"
+// @Param client_id query string false "Report progress to this import events client instead of a new task"
+// @Param dry_run query bool false "Compute the diff without writing"
+// @Param on_conflict query string false "Strategy for locally edited definitions (default overwrite)" Enums(overwrite, skip, keep-newer, review)
+// @Param exported_at query string false "When the export was made, as an RFC 3339 time or a date; required with keep-newer"
+// @Success 202 {object} ImportResponse "Import started"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing file, file too large, or invalid dry_run, on_conflict or exported_at"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin, or missing X-Sudo-Token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Unknown client_id"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Another import is running"
+// @Failure 413 {object} apperror.ErrorResponse "Payload Too Large - Export over HTTP_MAX_IMPORT_BYTES"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/import/xml [post]
+func (im *Importer) HandleImportXML() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		dryRun := false
+		if v := r.URL.Query().Get("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				auth.WriteError(w, r, apperror.NewBadRequestError("dry_run must be true or false", err))
+				return
+			}
+		}
+		policy, err := parseConflictPolicy(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		clientID := r.URL.Query().Get("client_id")
+		if clientID != "" && im.broadcaster.GetClientSSEChannel(clientID) == nil {
+			auth.WriteError(w, r, apperror.NewNotFoundError("Import events client not found", nil))
+			return
+		}
+		if !im.running.CompareAndSwap(false, true) {
+			auth.WriteError(w, r, apperror.NewConflictError("Another import is running", nil).WithCode(apperror.CodeImportRunning))
+			return
+		}
+
+		path, size, err := saveUpload(w, r)
+		if err != nil {
+			im.running.Store(false)
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		kind := "import"
+		if dryRun {
+			kind = "import-dry-run"
+		}
+		var progress *TaskProgress
+		if clientID == "" {
+			progress = im.broadcaster.StartTask(kind)
+		} else if progress, ok = im.broadcaster.AttachTask(clientID, kind); !ok {
+			// The stream went away while the file was uploading.
+			im.running.Store(false)
+			os.Remove(path)
+			auth.WriteError(w, r, apperror.NewNotFoundError("Import events client not found", nil))
+			return
+		}
+		if dryRun {
+			im.publishDiff(&ImportDiff{TaskID: progress.ID(), State: TaskRunning})
+		} else {
+			im.audit.Record(r.Context(), audit.Entry{
+				ActorID:    userID,
+				Action:     audit.ActionImportStart,
+				TargetType: audit.TargetImport,
+				TargetID:   progress.ID(),
+				After:      map[string]any{"bytes": size, "on_conflict": policy.strategy},
+			})
+		}
+		go func() {
+			defer im.running.Store(false)
+			defer os.Remove(path)
+			im.run(progress, path, size, int32(userID), policy, dryRun)
+		}()
+
+		render.Write(w, r, http.StatusAccepted, ImportResponse{TaskID: progress.ID(), Bytes: size, DryRun: dryRun, OnConflict: policy.strategy})
+	}
+}
+
+// saveUpload streams the "file" part of a multipart upload into a temporary file, without
+// holding the export in memory, and returns the file's path and size.
+func saveUpload(w http.ResponseWriter, r *http.Request) (string, int64, error) {
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(importUploadTimeout))
+	// The body is bounded by the route's limit, HTTP_MAX_IMPORT_BYTES (see `bodylimit`).
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", 0, apperror.NewBadRequestError("Invalid upload: expected multipart form data", err)
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return "", 0, apperror.NewBadRequestError("Missing \"file\" field", nil)
+		}
+		if err != nil {
+			if tooLarge := apperror.FromMaxBytesError(err); tooLarge != nil {
+				return "", 0, tooLarge
+			}
+			return "", 0, apperror.NewBadRequestError("Invalid upload: expected multipart form data", err)
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		f, err := os.CreateTemp("", "jbovlaste-import-*.xml")
+		if err != nil {
+			return "", 0, apperror.NewInternalError("failed to store upload", err)
+		}
+		size, err := io.Copy(f, part)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			if tooLarge := apperror.FromMaxBytesError(err); tooLarge != nil {
+				return "", 0, tooLarge
+			}
+			return "", 0, apperror.NewBadRequestError("Failed to read upload", err)
+		}
+		return f.Name(), size, nil
+	}
+}
+
+// run performs the import, or the dry run, and reports its outcome.
+func (im *Importer) run(progress *TaskProgress, path string, size int64, importerID int32, policy conflictPolicy, dryRun bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		if dryRun {
+			im.publishDiff(&ImportDiff{TaskID: progress.ID(), State: TaskFailed, Error: err.Error()})
+		}
+		progress.Finish(TaskFailed, 0, size, err.Error())
+		return
+	}
+	defer f.Close()
+	if dryRun {
+		im.runDryRun(progress, f, size)
+		return
+	}
+
+	stats, err := im.importExport(progress, f, size, importerID, policy, nil)
+	switch {
+	case errors.Is(err, errImportCancelled):
+		im.logger.Info("Import cancelled", "task", progress.ID(), "stats", stats.String())
+		progress.Finish(TaskCancelled, stats.Entries, 0, "cancelled; kept "+stats.String())
+	case err != nil:
+		im.logger.Error("Import failed", "task", progress.ID(), "stats", stats.String(), "error", err)
+		progress.Finish(TaskFailed, stats.Entries, 0, fmt.Sprintf("%v; kept %s", err, stats))
+	default:
+		im.logger.Info("Import finished", "task", progress.ID(), "stats", stats.String())
+		progress.Finish(TaskDone, stats.Entries, stats.Entries, stats.String())
+	}
+}
+
+var errImportCancelled = errors.New("import cancelled")
+
+// importExport streams the export and upserts it batch by batch, or only compares it with the
+// tables when `diff` is set. Progress of the "entries" stage is measured in bytes of the file.
+func (im *Importer) importExport(progress *TaskProgress, r io.Reader, size int64, importerID int32, policy conflictPolicy, diff *importDiffer) (importStats, error) {
+	var stats importStats
+
+	progress.SetStage(importStagePrepare)
+	b, err := im.newBatcher(importerID)
+	if err != nil {
+		return stats, err
+	}
+	b.taskID, b.policy = progress.ID(), policy
+
+	progress.SetStage(importStageEntries)
+	reader := newExportReader(r)
+	batch := make([]*xmlEntry, 0, importBatchSize)
+	batchLanguage := ""
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var err error
+		if diff != nil {
+			err = b.diff(batchLanguage, batch, &stats, diff)
+		} else {
+			err = b.upsert(batchLanguage, batch, &stats)
+		}
+		batch = batch[:0]
+		if err != nil {
+			return err
+		}
+		progress.Update(reader.offset(), size, fmt.Sprintf("%d entries", stats.Entries))
+		return nil
+	}
+
+	for {
+		select {
+		case cancelled := <-progress.Cancelled():
+			if cancelled {
+				return stats, errImportCancelled
+			}
+		default:
+		}
+
+		entry, language, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			if err := flush(); err != nil || diff == nil {
+				return stats, err
+			}
+			return stats, b.missingWords(diff)
+		}
+		if err != nil {
+			if flushErr := flush(); flushErr != nil {
+				return stats, flushErr
+			}
+			return stats, fmt.Errorf("invalid export: %w", err)
+		}
+		if language != batchLanguage {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+			batchLanguage = language
+		}
+		batch = append(batch, entry)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+}
+
+// batcher writes batches of entries; it caches the lookups shared by all batches.
+type batcher struct {
+	pool       *pgxpool.Pool
+	importerID int32 // Author of entries whose user doesn't exist here
+	now        int64 // `time` of new rows, a Unix timestamp like the rest of the dictionary
+	taskID     string
+	policy     conflictPolicy
+
+	types     map[string]int32 // valsitypes.descriptor -> typeid
+	languages map[string]int32 // <direction to="..."> -> langid
+	users     map[string]int32 // username -> userid
+}
+
+func (im *Importer) newBatcher(importerID int32) (*batcher, error) {
+	b := &batcher{
+		pool:       im.pool,
+		importerID: importerID,
+		now:        time.Now().Unix(),
+		types:      make(map[string]int32),
+		languages:  make(map[string]int32),
+		users:      make(map[string]int32),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), importBatchTimeout)
+	defer cancel()
+	rows, err := im.pool.Query(ctx, `SELECT typeid, descriptor FROM valsitypes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load word types: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int32
+		var descriptor string
+		if err := rows.Scan(&id, &descriptor); err != nil {
+			return nil, fmt.Errorf("failed to load word types: %w", err)
+		}
+		b.types[strings.ToLower(descriptor)] = id
+	}
+	return b, rows.Err()
+}
+
+// languageID resolves the `to` attribute of a direction, which jbovlaste writes as the
+// language's English name ("English") but which may also be a tag ("en").
+func (b *batcher) languageID(ctx context.Context, language string) (int32, error) {
+	if id, ok := b.languages[language]; ok {
+		return id, nil
+	}
+	var id int32
+	err := b.pool.QueryRow(ctx, `
+		SELECT langid FROM languages
+		WHERE lower(englishname) = lower($1) OR lower(tag) = lower($1)
+		ORDER BY langid LIMIT 1`, language).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("unknown language %q in export", language)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up language %q: %w", language, err)
+	}
+	b.languages[language] = id
+	return id, nil
+}
+
+// userIDs maps the authors of `entries` to local users, loading unknown names in one query.
+func (b *batcher) userIDs(ctx context.Context, entries []*xmlEntry) error {
+	var missing []string
+	for _, e := range entries {
+		if _, ok := b.users[e.Username]; !ok && e.Username != "" {
+			missing = append(missing, e.Username)
+			b.users[e.Username] = b.importerID // Replaced below if the user exists
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	rows, err := b.pool.Query(ctx, `SELECT userid, username FROM users WHERE username = ANY($1)`, missing)
+	if err != nil {
+		return fmt.Errorf("failed to look up authors: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int32
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return fmt.Errorf("failed to look up authors: %w", err)
+		}
+		b.users[name] = id
+	}
+	return rows.Err()
+}
+
+func (b *batcher) userID(username string) int32 {
+	if id, ok := b.users[username]; ok {
+		return id
+	}
+	return b.importerID
+}
+
+// latestEntries counts the entries of a batch and returns the words to import, in order, with
+// the entry for each. Set-based statements take one array per column, so the last entry for a
+// word wins; entries of an unknown type are skipped.
+func (b *batcher) latestEntries(entries []*xmlEntry, stats *importStats) ([]string, map[string]*xmlEntry) {
+	byWord := make(map[string]*xmlEntry, len(entries))
+	var words []string
+	for _, e := range entries {
+		stats.Entries++
+		if _, ok := b.types[strings.ToLower(e.Type)]; !ok {
+			stats.Skipped++
+			continue
+		}
+		if _, seen := byWord[e.Word]; !seen {
+			words = append(words, e.Word)
+		}
+		byWord[e.Word] = e
+	}
+	return words, byWord
+}
+
+// upsert writes one batch of entries of the given language in a single transaction.
+func (b *batcher) upsert(language string, entries []*xmlEntry, stats *importStats) error {
+	ctx, cancel := context.WithTimeout(context.Background(), importBatchTimeout)
+	defer cancel()
+
+	langID, err := b.languageID(ctx, language)
+	if err != nil {
+		return err
+	}
+	if err := b.userIDs(ctx, entries); err != nil {
+		return err
+	}
+
+	words, byWord := b.latestEntries(entries, stats)
+	if len(words) == 0 {
+		return nil
+	}
+	typeIDs := make([]int32, len(words))
+	rafsi := make([]string, len(words))
+	userIDs := make([]int32, len(words))
+	for i, w := range words {
+		e := byWord[w]
+		typeIDs[i] = b.types[strings.ToLower(e.Type)]
+		rafsi[i] = strings.Join(e.Rafsi, " ")
+		userIDs[i] = b.userID(e.Username)
+	}
+
+	return db.WithTx(ctx, b.pool, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, int(b.importerID), changelog.SourceImport); err != nil {
+			return err
+		}
+
+		// 1. Words: existing ones keep their author and date but take the export's type and rafsi.
+		rows, err := tx.Query(ctx, `
+			WITH input AS (
+				SELECT * FROM unnest($1::text[], $2::int[], $3::text[], $4::int[]) AS t(word, typeid, rafsi, userid)
+			),
+			updated AS (
+				UPDATE valsi v SET typeid = i.typeid, rafsi = NULLIF(i.rafsi, '')
+				FROM input i WHERE v.word = i.word
+				RETURNING v.valsiid, v.word, FALSE AS inserted
+			),
+			inserted AS (
+				INSERT INTO valsi (word, typeid, rafsi, userid, time)
+				SELECT i.word, i.typeid, NULLIF(i.rafsi, ''), i.userid, $5 FROM input i
+				WHERE NOT EXISTS (SELECT 1 FROM valsi v WHERE v.word = i.word)
+				RETURNING valsiid, word, TRUE AS inserted
+			)
+			SELECT valsiid, word, inserted FROM updated
+			UNION ALL
+			SELECT valsiid, word, inserted FROM inserted`, words, typeIDs, rafsi, userIDs, b.now)
+		if err != nil {
+			return fmt.Errorf("failed to upsert words: %w", err)
+		}
+		valsiIDs := make(map[string]int32, len(words))
+		for rows.Next() {
+			var id int32
+			var word string
+			var inserted bool
+			if err := rows.Scan(&id, &word, &inserted); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to upsert words: %w", err)
+			}
+			valsiIDs[word] = id
+			if inserted {
+				stats.NewValsi++
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to upsert words: %w", err)
+		}
+
+		// 2. Definitions of this language, matched by text.
+		var (
+			defValsi   []int32
+			defText    []string
+			defNotes   []string
+			defSelmaho []string
+			defUsers   []int32
+		)
+		for _, w := range words {
+			e := byWord[w]
+			text := strings.TrimSpace(e.Definition)
+			if text == "" {
+				continue
+			}
+			defValsi = append(defValsi, valsiIDs[w])
+			defText = append(defText, text)
+			defNotes = append(defNotes, strings.TrimSpace(e.Notes))
+			defSelmaho = append(defSelmaho, strings.TrimSpace(e.Selmaho))
+			defUsers = append(defUsers, b.userID(e.Username))
+		}
+		definitionIDs := make(map[int32]int32, len(defValsi)) // valsiid -> definitionid
+		if len(defValsi) > 0 {
+			// Locally edited definitions keep their notes and selma'o unless the strategy says
+			// otherwise.
+			conflicts, err := b.findConflicts(ctx, tx, langID, defValsi, defText, defNotes, defSelmaho)
+			if err != nil {
+				return err
+			}
+			kept := []int32{}
+			for _, c := range conflicts {
+				if c.resolution != resolutionOverwritten {
+					kept = append(kept, c.definitionID)
+				}
+			}
+
+			rows, err := tx.Query(ctx, `
+				WITH input AS (
+					SELECT * FROM unnest($1::int[], $2::text[], $3::text[], $4::text[], $5::int[])
+						AS t(valsiid, definition, notes, selmaho, userid)
+				),
+				updated AS (
+					UPDATE definitions d
+					SET notes = CASE WHEN d.definitionid = ANY($8) THEN d.notes ELSE NULLIF(i.notes, '') END,
+					    selmaho = CASE WHEN d.definitionid = ANY($8) THEN d.selmaho ELSE NULLIF(i.selmaho, '') END
+					FROM input i
+					WHERE d.valsiid = i.valsiid AND d.langid = $6 AND d.definition = i.definition
+					RETURNING d.definitionid, d.valsiid, FALSE AS inserted
+				),
+				inserted AS (
+					INSERT INTO definitions (langid, valsiid, definitionnum, definition, notes, selmaho, userid, time)
+					SELECT $6, i.valsiid,
+					       COALESCE((SELECT MAX(d.definitionnum) FROM definitions d WHERE d.valsiid = i.valsiid AND d.langid = $6), 0) + 1,
+					       i.definition, NULLIF(i.notes, ''), NULLIF(i.selmaho, ''), i.userid, $7
+					FROM input i
+					WHERE NOT EXISTS (
+						SELECT 1 FROM definitions d WHERE d.valsiid = i.valsiid AND d.langid = $6 AND d.definition = i.definition)
+					RETURNING definitionid, valsiid, TRUE AS inserted
+				)
+				SELECT definitionid, valsiid, inserted FROM updated
+				UNION ALL
+				SELECT definitionid, valsiid, inserted FROM inserted`,
+				defValsi, defText, defNotes, defSelmaho, defUsers, langID, b.now, kept)
+			if err != nil {
+				return fmt.Errorf("failed to upsert definitions: %w", err)
+			}
+			for rows.Next() {
+				var defID, valsiID int32
+				var inserted bool
+				if err := rows.Scan(&defID, &valsiID, &inserted); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to upsert definitions: %w", err)
+				}
+				definitionIDs[valsiID] = defID
+				if inserted {
+					stats.Definitions++
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to upsert definitions: %w", err)
+			}
+
+			// Keep the revision history in step: new definitions get their first revision, and
+			// definitions whose notes or selma'o the export changed get one by the importer.
+			ids := make([]int32, 0, len(definitionIDs))
+			for _, id := range definitionIDs {
+				ids = append(ids, id)
+			}
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO definition_revisions (definition_id, revision, definition, notes, selmaho, author_id, comment, status)
+				SELECT d.definitionid, COALESCE(n.revision, 0) + 1, d.definition, d.notes, d.selmaho,
+				       CASE WHEN n.revision IS NULL THEN d.userid ELSE $2 END, $3, 'approved'
+				FROM definitions d
+				LEFT JOIN LATERAL (
+					SELECT MAX(revision) AS revision FROM definition_revisions WHERE definition_id = d.definitionid
+				) n ON TRUE
+				LEFT JOIN LATERAL (
+					SELECT definition, notes, selmaho FROM definition_revisions
+					WHERE definition_id = d.definitionid AND status = 'approved'
+					ORDER BY revision DESC LIMIT 1
+				) a ON TRUE
+				WHERE d.definitionid = ANY($1)
+				  AND (a.definition IS NULL OR (a.notes, a.selmaho) IS DISTINCT FROM (d.notes, d.selmaho))`,
+				ids, b.importerID, importComment); err != nil {
+				return fmt.Errorf("failed to record definition revisions: %w", err)
+			}
+
+			if len(conflicts) > 0 {
+				if err := b.recordConflicts(ctx, tx, conflicts); err != nil {
+					return err
+				}
+				stats.Conflicts += int64(len(conflicts))
+			}
+		}
+
+		// 3. Glosses: glosswords have place 0, keywords the place they gloss.
+		var (
+			glossDefs   []int32
+			glossWords  []string
+			glossSenses []string
+			glossPlaces []int32
+		)
+		addGloss := func(defID int32, g xmlGloss, place int) {
+			word := strings.TrimSpace(g.Word)
+			if word == "" {
+				return
+			}
+			glossDefs = append(glossDefs, defID)
+			glossWords = append(glossWords, word)
+			glossSenses = append(glossSenses, strings.TrimSpace(g.Sense))
+			glossPlaces = append(glossPlaces, int32(place))
+		}
+		for _, w := range words {
+			defID, ok := definitionIDs[valsiIDs[w]]
+			if !ok {
+				continue
+			}
+			e := byWord[w]
+			for _, g := range e.Glosswords {
+				addGloss(defID, g, 0)
+			}
+			for _, k := range e.Keywords {
+				addGloss(defID, k, k.Place)
+			}
+		}
+		if len(glossDefs) > 0 {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO natlangwords (langid, word, meaning, userid, time)
+				SELECT DISTINCT $1::int, g.word, NULLIF(g.sense, ''), $4::int, $5::bigint
+				FROM unnest($2::text[], $3::text[]) AS g(word, sense)
+				WHERE NOT EXISTS (
+					SELECT 1 FROM natlangwords n
+					WHERE n.langid = $1 AND n.word = g.word AND n.meaning IS NOT DISTINCT FROM NULLIF(g.sense, ''))`,
+				langID, glossWords, glossSenses, b.importerID, b.now); err != nil {
+				return fmt.Errorf("failed to upsert gloss words: %w", err)
+			}
+			tag, err := tx.Exec(ctx, `
+				INSERT INTO keywordmapping (natlangwordid, definitionid, place)
+				SELECT DISTINCT n.wordid, g.definitionid, g.place
+				FROM unnest($2::int[], $3::text[], $4::text[], $5::int[]) AS g(definitionid, word, sense, place)
+				CROSS JOIN LATERAL (
+					SELECT wordid FROM natlangwords n
+					WHERE n.langid = $1 AND n.word = g.word AND n.meaning IS NOT DISTINCT FROM NULLIF(g.sense, '')
+					ORDER BY wordid LIMIT 1
+				) n
+				WHERE NOT EXISTS (
+					SELECT 1 FROM keywordmapping k
+					WHERE k.natlangwordid = n.wordid AND k.definitionid = g.definitionid AND k.place = g.place)`,
+				langID, glossDefs, glossWords, glossSenses, glossPlaces)
+			if err != nil {
+				return fmt.Errorf("failed to upsert glosses: %w", err)
+			}
+			stats.Glosses += tag.RowsAffected()
+		}
+		return nil
+	})
+}
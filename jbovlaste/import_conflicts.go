@@ -0,0 +1,385 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `import_conflicts.go`, decides what an import does with definitions edited here.
+// A definition conflicts when the export changes its notes or selma'o and its latest approved
+// revision was made locally, by an edit through the API, rather than by the definition's
+// creation or an earlier import. The `on_conflict` parameter of an import picks the strategy:
+//
+//   - overwrite (the default): the export's version replaces the local one, as for any other
+//     definition.
+//   - skip: the local version stays.
+//   - keep-newer: the local version stays if it was approved after the export was made, given
+//     by `exported_at`, since jbovlaste exports carry no dates of their own.
+//   - review: the local version stays, and the export's version is queued as a pending
+//     revision by the importer, to be approved or rejected like any other edit.
+//
+// Either way, glosses are still added, and every conflict is recorded in `import_conflicts`
+// with both versions; that table is the import's conflict report.
+package jbovlaste
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// Conflict strategies, passed as `on_conflict`.
+const (
+	ConflictOverwrite = "overwrite"
+	ConflictSkip      = "skip"
+	ConflictKeepNewer = "keep-newer"
+	ConflictReview    = "review"
+)
+
+// What a strategy did with a conflict.
+const (
+	resolutionOverwritten = "overwritten"
+	resolutionSkipped     = "skipped"
+	resolutionQueued      = "queued"
+)
+
+// importComment marks the revisions written by imports.
+const importComment = "jbovlaste import"
+
+// lastApprovedRevision joins each definition `d` with its latest approved revision `a`, where
+// `a.local` tells whether it was a local edit.
+const lastApprovedRevision = `
+	LEFT JOIN LATERAL (
+		SELECT revision, created_at, revision > 1 AND comment IS DISTINCT FROM '` + importComment + `' AS local
+		FROM definition_revisions
+		WHERE definition_id = d.definitionid AND status = 'approved'
+		ORDER BY revision DESC LIMIT 1
+	) a ON TRUE`
+
+// conflictPolicy is the conflict strategy of an import.
+type conflictPolicy struct {
+	strategy   string
+	exportedAt time.Time // With keep-newer: local edits approved after this are kept
+}
+
+// parseConflictPolicy reads the `on_conflict` and `exported_at` parameters of an import.
+func parseConflictPolicy(r *http.Request) (conflictPolicy, error) {
+	policy := conflictPolicy{strategy: ConflictOverwrite}
+	if v := r.URL.Query().Get("on_conflict"); v != "" {
+		policy.strategy = v
+	}
+	switch policy.strategy {
+	case ConflictOverwrite, ConflictSkip, ConflictReview:
+	case ConflictKeepNewer:
+		v := r.URL.Query().Get("exported_at")
+		if v == "" {
+			return policy, apperror.NewBadRequestError("exported_at is required with on_conflict=keep-newer", nil)
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, v); err != nil {
+				return policy, apperror.NewBadRequestError("exported_at must be an RFC 3339 time or a date", err)
+			}
+		}
+		policy.exportedAt = t
+	default:
+		return policy, apperror.NewBadRequestError("on_conflict must be one of overwrite, skip, keep-newer or review", nil)
+	}
+	return policy, nil
+}
+
+// resolve decides what happens to a definition whose local version was approved at `editedAt`.
+func (p conflictPolicy) resolve(editedAt time.Time) string {
+	switch p.strategy {
+	case ConflictSkip:
+		return resolutionSkipped
+	case ConflictReview:
+		return resolutionQueued
+	case ConflictKeepNewer:
+		if editedAt.After(p.exportedAt) {
+			return resolutionSkipped
+		}
+	}
+	return resolutionOverwritten
+}
+
+// importConflict is a locally edited definition that an entry of the export changes.
+type importConflict struct {
+	definitionID  int32
+	revision      int32
+	notes         string
+	selmaho       string
+	editedAt      time.Time
+	importNotes   string
+	importSelmaho string
+	resolution    string
+}
+
+// findConflicts returns the conflicts among the definitions of a batch, given as the arrays
+// passed to the definitions upsert, each with its resolution under the import's strategy.
+func (b *batcher) findConflicts(ctx context.Context, tx pgx.Tx, langID int32, valsiIDs []int32, texts, notes, selmaho []string) ([]importConflict, error) {
+	rows, err := tx.Query(ctx, `
+		WITH input AS (
+			SELECT * FROM unnest($1::int[], $2::text[], $3::text[], $4::text[]) AS t(valsiid, definition, notes, selmaho)
+		)
+		SELECT d.definitionid, a.revision, COALESCE(d.notes, ''), COALESCE(d.selmaho, ''), a.created_at, i.notes, i.selmaho
+		FROM input i
+		JOIN definitions d ON d.valsiid = i.valsiid AND d.langid = $5 AND d.definition = i.definition`+
+		lastApprovedRevision+`
+		WHERE a.local AND (COALESCE(d.notes, ''), COALESCE(d.selmaho, '')) IS DISTINCT FROM (i.notes, i.selmaho)`,
+		valsiIDs, texts, notes, selmaho, langID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for conflicts: %w", err)
+	}
+	defer rows.Close()
+	var conflicts []importConflict
+	for rows.Next() {
+		var c importConflict
+		if err := rows.Scan(&c.definitionID, &c.revision, &c.notes, &c.selmaho, &c.editedAt, &c.importNotes, &c.importSelmaho); err != nil {
+			return nil, fmt.Errorf("failed to look for conflicts: %w", err)
+		}
+		c.resolution = b.policy.resolve(c.editedAt)
+		conflicts = append(conflicts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to look for conflicts: %w", err)
+	}
+	return conflicts, nil
+}
+
+// recordConflicts queues the export's version of the conflicts resolved by review, unless the
+// same version is already waiting, and adds all of them to the import's report.
+func (b *batcher) recordConflicts(ctx context.Context, tx pgx.Tx, conflicts []importConflict) error {
+	var queuedIDs []int32
+	var queuedNotes, queuedSelmaho []string
+	for _, c := range conflicts {
+		if c.resolution == resolutionQueued {
+			queuedIDs = append(queuedIDs, c.definitionID)
+			queuedNotes = append(queuedNotes, c.importNotes)
+			queuedSelmaho = append(queuedSelmaho, c.importSelmaho)
+		}
+	}
+	queued := make(map[int32]int32, len(queuedIDs)) // definitionid -> pending revision
+	if len(queuedIDs) > 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO definition_revisions (definition_id, revision, definition, notes, selmaho, author_id, comment, status)
+			SELECT d.definitionid,
+			       (SELECT MAX(revision) FROM definition_revisions r WHERE r.definition_id = d.definitionid) + 1,
+			       d.definition, NULLIF(q.notes, ''), NULLIF(q.selmaho, ''), $4, $5, 'pending'
+			FROM unnest($1::int[], $2::text[], $3::text[]) AS q(definitionid, notes, selmaho)
+			JOIN definitions d ON d.definitionid = q.definitionid
+			WHERE NOT EXISTS (
+				SELECT 1 FROM definition_revisions r
+				WHERE r.definition_id = d.definitionid AND r.status = 'pending' AND r.definition = d.definition
+				  AND r.notes IS NOT DISTINCT FROM NULLIF(q.notes, '') AND r.selmaho IS NOT DISTINCT FROM NULLIF(q.selmaho, ''))`,
+			queuedIDs, queuedNotes, queuedSelmaho, b.importerID, importComment); err != nil {
+			return fmt.Errorf("failed to queue conflicting revisions: %w", err)
+		}
+		rows, err := tx.Query(ctx, `
+			SELECT DISTINCT ON (r.definition_id) r.definition_id, r.revision
+			FROM unnest($1::int[], $2::text[], $3::text[]) AS q(definitionid, notes, selmaho)
+			JOIN definition_revisions r ON r.definition_id = q.definitionid
+			WHERE r.status = 'pending'
+			  AND r.notes IS NOT DISTINCT FROM NULLIF(q.notes, '') AND r.selmaho IS NOT DISTINCT FROM NULLIF(q.selmaho, '')
+			ORDER BY r.definition_id, r.revision DESC`,
+			queuedIDs, queuedNotes, queuedSelmaho)
+		if err != nil {
+			return fmt.Errorf("failed to queue conflicting revisions: %w", err)
+		}
+		for rows.Next() {
+			var defID, revision int32
+			if err := rows.Scan(&defID, &revision); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to queue conflicting revisions: %w", err)
+			}
+			queued[defID] = revision
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to queue conflicting revisions: %w", err)
+		}
+	}
+
+	n := len(conflicts)
+	var (
+		ids            = make([]int32, n)
+		resolutions    = make([]string, n)
+		revisions      = make([]int32, n)
+		notes          = make([]string, n)
+		selmaho        = make([]string, n)
+		editedAt       = make([]time.Time, n)
+		importNotes    = make([]string, n)
+		importSelmaho  = make([]string, n)
+		queuedRevision = make([]*int32, n)
+	)
+	for i, c := range conflicts {
+		ids[i], resolutions[i], revisions[i] = c.definitionID, c.resolution, c.revision
+		notes[i], selmaho[i], editedAt[i] = c.notes, c.selmaho, c.editedAt
+		importNotes[i], importSelmaho[i] = c.importNotes, c.importSelmaho
+		if revision, ok := queued[c.definitionID]; ok {
+			queuedRevision[i] = &revision
+		}
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO import_conflicts (task_id, definition_id, strategy, resolution, local_revision, local_notes, local_selmaho,
+		                              local_edited_at, import_notes, import_selmaho, queued_revision)
+		SELECT $1::text, c.definitionid, $2::text, c.resolution, c.revision, NULLIF(c.notes, ''), NULLIF(c.selmaho, ''),
+		       c.edited_at, NULLIF(c.import_notes, ''), NULLIF(c.import_selmaho, ''), c.queued_revision
+		FROM unnest($3::int[], $4::text[], $5::int[], $6::text[], $7::text[], $8::timestamptz[], $9::text[], $10::text[], $11::int[])
+			AS c(definitionid, resolution, revision, notes, selmaho, edited_at, import_notes, import_selmaho, queued_revision)`,
+		b.taskID, b.policy.strategy, ids, resolutions, revisions, notes, selmaho, editedAt, importNotes, importSelmaho, queuedRevision); err != nil {
+		return fmt.Errorf("failed to record conflicts: %w", err)
+	}
+	return nil
+}
+
+// ImportConflict is a locally edited definition that an import found changed in the export.
+// @Description Conflict between a local edit and an imported definition
+type ImportConflict struct {
+	// example: 4212
+	DefinitionID int32 `json:"definition_id"`
+	// example: "bangu"
+	Word string `json:"word"`
+	// example: "en"
+	Language string `json:"language"`
+	// overwritten, skipped or queued
+	// example: "queued"
+	Resolution string `json:"resolution"`
+	// The latest approved revision when the import ran
+	// example: 3
+	LocalRevision int32     `json:"local_revision"`
+	LocalNotes    string    `json:"local_notes"`
+	LocalSelmaho  string    `json:"local_selmaho"`
+	LocalEditedAt time.Time `json:"local_edited_at"`
+	ImportNotes   string    `json:"import_notes"`
+	ImportSelmaho string    `json:"import_selmaho"`
+	// The pending revision holding the export's version, when queued for review
+	// example: 4
+	QueuedRevision *int32 `json:"queued_revision,omitempty"`
+}
+
+// ImportConflictQuery filters and pages the conflicts of an import. Reports are read in
+// larger pages than other lists.
+type ImportConflictQuery struct {
+	Resolution string `form:"resolution" validate:"omitempty,oneof=overwritten skipped queued"`
+	Page       int64  `form:"page" default:"1" validate:"min=1"`
+	PerPage    int64  `form:"per_page" default:"50" cap:"500" validate:"min=1"`
+}
+
+// ImportConflictReport is a page of the conflicts of an import.
+// @Description Conflicts met by a dictionary import
+type ImportConflictReport struct {
+	// example: "3f1c2a9e-5b7d-4e8f-9a0b-1c2d3e4f5a6b"
+	TaskID string `json:"task_id"`
+	// The import's on_conflict strategy; empty when it met no conflicts
+	// example: "review"
+	Strategy string `json:"strategy"`
+	// Conflicts by resolution, over the whole import
+	Counts    map[string]int64 `json:"counts"`
+	Conflicts []ImportConflict `json:"conflicts"`
+	// Conflicts matching the filter
+	// example: 12
+	Total   int64 `json:"total"`
+	Page    int64 `json:"page"`
+	PerPage int64 `json:"per_page"`
+}
+
+// HandleImportConflicts godoc
+// @Summary Get the conflicts of an import
+// @Description Returns the locally edited definitions that an import found changed in its export, with both versions and what its `on_conflict` strategy did: `overwritten`, `skipped`, or `queued` as a pending revision to review at POST /api/v1/definitions/{definitionID}/revisions/{revision}/approve or /reject. An import without conflicts has an empty report. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param taskID path string true "Task ID of the import"
+// @Param resolution query string false "Only conflicts with this resolution" Enums(overwritten, skipped, queued)
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 50, max 500)"
+// @Success 200 {object} ImportConflictReport "Conflicts"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid filter or pagination"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/import/conflicts/{taskID} [get]
+func (im *Importer) HandleImportConflicts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q ImportConflictQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		report, err := im.conflictReport(r.Context(), chi.URLParam(r, "taskID"), q.Resolution, q.Page, q.PerPage)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, report)
+	}
+}
+
+// conflictReport reads a page of an import's conflicts.
+func (im *Importer) conflictReport(ctx context.Context, taskID, resolution string, page, perPage int64) (*ImportConflictReport, error) {
+	report := &ImportConflictReport{
+		TaskID:    taskID,
+		Counts:    map[string]int64{resolutionOverwritten: 0, resolutionSkipped: 0, resolutionQueued: 0},
+		Conflicts: []ImportConflict{},
+		Page:      page,
+		PerPage:   perPage,
+	}
+	rows, err := im.pool.Query(ctx, `
+		SELECT strategy, resolution, COUNT(*) FROM import_conflicts
+		WHERE task_id = $1 GROUP BY strategy, resolution`, taskID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to count conflicts", err)
+	}
+	for rows.Next() {
+		var resolution string
+		var count int64
+		if err := rows.Scan(&report.Strategy, &resolution, &count); err != nil {
+			rows.Close()
+			return nil, apperror.NewDatabaseError("failed to count conflicts", err)
+		}
+		report.Counts[resolution] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count conflicts", err)
+	}
+	for r, count := range report.Counts {
+		if resolution == "" || r == resolution {
+			report.Total += count
+		}
+	}
+
+	rows, err = im.pool.Query(ctx, `
+		SELECT c.definition_id, COALESCE(v.word, ''), COALESCE(l.tag, ''), c.resolution, c.local_revision,
+		       COALESCE(c.local_notes, ''), COALESCE(c.local_selmaho, ''), c.local_edited_at,
+		       COALESCE(c.import_notes, ''), COALESCE(c.import_selmaho, ''), c.queued_revision
+		FROM import_conflicts c
+		LEFT JOIN definitions d ON d.definitionid = c.definition_id
+		LEFT JOIN valsi v ON v.valsiid = d.valsiid
+		LEFT JOIN languages l ON l.langid = d.langid
+		WHERE c.task_id = $1 AND ($2 = '' OR c.resolution = $2)
+		ORDER BY c.id
+		LIMIT $3 OFFSET $4`, taskID, resolution, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list conflicts", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ImportConflict
+		if err := rows.Scan(&c.DefinitionID, &c.Word, &c.Language, &c.Resolution, &c.LocalRevision,
+			&c.LocalNotes, &c.LocalSelmaho, &c.LocalEditedAt, &c.ImportNotes, &c.ImportSelmaho, &c.QueuedRevision); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read conflict", err)
+		}
+		report.Conflicts = append(report.Conflicts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list conflicts", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,536 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `import_diff.go`, implements import dry runs. A dry run streams the export like an
+// import (see `import.go`) but, for each batch, reads the rows the import would touch and
+// compares them with the entries in Go, so maintainers can review an export before importing
+// it. The resulting diff lists words the import would add or change, definitions it would add
+// or change, and words that have definitions in the export's languages but are missing from
+// the export. The import never deletes those; they are listed because a missing word usually
+// means the export is incomplete or from a different source. Changed definitions that were
+// edited locally are flagged, as the import would resolve them by its conflict strategy.
+//
+// Diffs are kept in memory for `dryRunRetention` after the dry run ends.
+package jbovlaste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+)
+
+// maxDiffItems bounds each list of a diff; the summary counts everything.
+const maxDiffItems = 2000
+
+// dryRunRetention is how long a finished dry run can be fetched. It is longer than
+// `taskRetention`, since reviewing a diff takes a while.
+const dryRunRetention = time.Hour
+
+// ImportDiff is what an import of an export would change.
+// @Description Result of an import dry run
+type ImportDiff struct {
+	// example: "3f1c2a9e-5b7d-4e8f-9a0b-1c2d3e4f5a6b"
+	TaskID string `json:"task_id"`
+	// running, done, failed or cancelled; the lists are only filled once done
+	// example: "done"
+	State string `json:"state"`
+	// Why the dry run failed
+	// example: "invalid export: XML syntax error on line 12"
+	Error   string            `json:"error,omitempty"`
+	Summary ImportDiffSummary `json:"summary"`
+	// Words that don't exist yet
+	WordsAdded []DiffWord `json:"words_added"`
+	// Existing words whose type or rafsi the export changes
+	WordsChanged []DiffWordChange `json:"words_changed"`
+	// Words with definitions in an exported language that the export doesn't contain; the
+	// import keeps them
+	WordsMissing []DiffMissingWord `json:"words_missing"`
+	// Definitions whose text is new for their word and language
+	DefinitionsAdded []DiffDefinition `json:"definitions_added"`
+	// Existing definitions whose notes, selma'o or glosses the export changes
+	DefinitionsChanged []DiffDefinitionChange `json:"definitions_changed"`
+	// Set when a list was cut at 2000 items
+	// example: false
+	Truncated bool `json:"truncated"`
+}
+
+// ImportDiffSummary counts the changes of a diff.
+// @Description Counts of an import dry run
+type ImportDiffSummary struct {
+	// example: 24000
+	Entries int64 `json:"entries"`
+	// Entries of an unknown word type
+	// example: 3
+	Skipped int64 `json:"skipped"`
+	// example: 12
+	WordsAdded int64 `json:"words_added"`
+	// example: 4
+	WordsChanged int64 `json:"words_changed"`
+	// example: 2
+	WordsMissing int64 `json:"words_missing"`
+	// example: 15
+	DefinitionsAdded int64 `json:"definitions_added"`
+	// example: 30
+	DefinitionsChanged int64 `json:"definitions_changed"`
+	// Changed definitions whose notes or selma'o were edited locally
+	// example: 2
+	Conflicts int64 `json:"conflicts"`
+	// New keyword mappings, on added and changed definitions
+	// example: 40
+	GlossesAdded int64 `json:"glosses_added"`
+}
+
+func (s ImportDiffSummary) String() string {
+	return fmt.Sprintf("dry run of %d entries (%d skipped): %d words to add, %d to change, %d missing from the export; %d definitions to add, %d to change (%d conflicts); %d glosses to add",
+		s.Entries, s.Skipped, s.WordsAdded, s.WordsChanged, s.WordsMissing, s.DefinitionsAdded, s.DefinitionsChanged, s.Conflicts, s.GlossesAdded)
+}
+
+// DiffWord is a word an import would add.
+type DiffWord struct {
+	// example: "jbobau"
+	Word string `json:"word"`
+	// example: "lujvo"
+	Type  string   `json:"type"`
+	Rafsi []string `json:"rafsi"`
+}
+
+// DiffField is a value an import would change.
+type DiffField struct {
+	// example: "rafsi"
+	Field string `json:"field"`
+	// example: "bau"
+	Old string `json:"old"`
+	// example: "bau ba'u"
+	New string `json:"new"`
+}
+
+// DiffWordChange is an existing word an import would change.
+type DiffWordChange struct {
+	// example: "bangu"
+	Word    string      `json:"word"`
+	Changes []DiffField `json:"changes"`
+}
+
+// DiffMissingWord is a word with definitions in an exported language that the export lacks.
+type DiffMissingWord struct {
+	// example: "cmalu"
+	Word string `json:"word"`
+	// The export's name for the language
+	// example: "English"
+	Language string `json:"language"`
+	// Definitions of the word in that language
+	// example: 1
+	Definitions int `json:"definitions"`
+}
+
+// DiffDefinition is a definition an import would add.
+type DiffDefinition struct {
+	// example: "bangu"
+	Word string `json:"word"`
+	// example: "English"
+	Language string `json:"language"`
+	// example: "x1 is a/the language/dialect used by x2 to express/communicate x3."
+	Definition string `json:"definition"`
+	Notes      string `json:"notes,omitempty"`
+	Selmaho    string `json:"selmaho,omitempty"`
+	// example: 3
+	Glosses int `json:"glosses"`
+	// Existing definitions of the word in the language, which the import keeps next to the new one
+	AlongsideDefinitionIDs []int32 `json:"alongside_definition_ids"`
+}
+
+// DiffDefinitionChange is an existing definition an import would change.
+type DiffDefinitionChange struct {
+	// example: 4212
+	DefinitionID int32 `json:"definition_id"`
+	// example: "bangu"
+	Word string `json:"word"`
+	// example: "English"
+	Language string      `json:"language"`
+	Changes  []DiffField `json:"changes"`
+	// example: 1
+	GlossesAdded int `json:"glosses_added"`
+	// The notes or selma'o changed were edited locally, so the import's on_conflict strategy applies
+	// example: false
+	Conflict bool `json:"conflict"`
+}
+
+// importDiffer collects the diff of a dry run, batch by batch.
+type importDiffer struct {
+	diff ImportDiff
+	seen map[int32]map[string]bool // langid -> words of the export in that language
+	name map[int32]string          // langid -> the export's name for it
+}
+
+func newImportDiffer(taskID string) *importDiffer {
+	return &importDiffer{
+		diff: ImportDiff{
+			TaskID:             taskID,
+			WordsAdded:         []DiffWord{},
+			WordsChanged:       []DiffWordChange{},
+			WordsMissing:       []DiffMissingWord{},
+			DefinitionsAdded:   []DiffDefinition{},
+			DefinitionsChanged: []DiffDefinitionChange{},
+		},
+		seen: make(map[int32]map[string]bool),
+		name: make(map[int32]string),
+	}
+}
+
+// room reports whether a list of `n` items can take another one, marking the diff truncated
+// when it can't.
+func (d *importDiffer) room(n int) bool {
+	if n < maxDiffItems {
+		return true
+	}
+	d.diff.Truncated = true
+	return false
+}
+
+// runDryRun computes the diff of an export and publishes it.
+func (im *Importer) runDryRun(progress *TaskProgress, r io.Reader, size int64) {
+	d := newImportDiffer(progress.ID())
+	stats, err := im.importExport(progress, r, size, 0, conflictPolicy{}, d)
+	d.diff.Summary.Entries, d.diff.Summary.Skipped = stats.Entries, stats.Skipped
+	summary := d.diff.Summary.String()
+
+	switch {
+	case errors.Is(err, errImportCancelled):
+		im.logger.Info("Import dry run cancelled", "task", progress.ID())
+		im.publishDiff(&ImportDiff{TaskID: progress.ID(), State: TaskCancelled})
+		progress.Finish(TaskCancelled, stats.Entries, 0, "cancelled")
+	case err != nil:
+		im.logger.Error("Import dry run failed", "task", progress.ID(), "error", err)
+		im.publishDiff(&ImportDiff{TaskID: progress.ID(), State: TaskFailed, Error: err.Error()})
+		progress.Finish(TaskFailed, stats.Entries, 0, err.Error())
+	default:
+		im.logger.Info("Import dry run finished", "task", progress.ID(), "summary", summary)
+		d.diff.State = TaskDone
+		im.publishDiff(&d.diff)
+		progress.Finish(TaskDone, stats.Entries, stats.Entries, summary)
+	}
+}
+
+// publishDiff stores the state of a dry run, replacing the previous one. Final states are
+// dropped after `dryRunRetention`.
+func (im *Importer) publishDiff(diff *ImportDiff) {
+	im.mu.Lock()
+	im.diffs[diff.TaskID] = diff
+	im.mu.Unlock()
+	if diff.State != TaskRunning {
+		time.AfterFunc(dryRunRetention, func() {
+			im.mu.Lock()
+			if im.diffs[diff.TaskID] == diff {
+				delete(im.diffs, diff.TaskID)
+			}
+			im.mu.Unlock()
+		})
+	}
+}
+
+// HandleImportDiff godoc
+// @Summary Get the diff of an import dry run
+// @Description Returns what importing the export uploaded with POST /api/v1/import/xml?dry_run=true would change. While the dry run is going, only `state` is set; follow its progress as for an import. Each list holds at most 2000 items, while the summary counts everything. Diffs are kept for an hour after the dry run ends. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param taskID path string true "Task ID of the dry run"
+// @Success 200 {object} ImportDiff "Diff"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Unknown or expired dry run"
+// @Router /api/v1/import/dry-runs/{taskID} [get]
+func (im *Importer) HandleImportDiff() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		im.mu.Lock()
+		diff, ok := im.diffs[chi.URLParam(r, "taskID")]
+		im.mu.Unlock()
+		if !ok {
+			auth.WriteError(w, r, apperror.NewNotFoundError("Dry run not found", nil))
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, diff)
+	}
+}
+
+// existingDefinition is a definition of a batch's words in the batch's language.
+type existingDefinition struct {
+	id      int32
+	text    string
+	notes   string
+	selmaho string
+	edited  bool            // Its latest approved revision is a local edit
+	glosses map[string]bool // glossKey of its keyword mappings
+}
+
+// glossKey identifies a keyword mapping the way the import matches them.
+func glossKey(word, sense string, place int) string {
+	return fmt.Sprintf("%s\x00%s\x00%d", strings.TrimSpace(word), strings.TrimSpace(sense), place)
+}
+
+// entryGlosses returns the keys of the glosses of an entry that the import would map.
+func entryGlosses(e *xmlEntry) map[string]bool {
+	keys := make(map[string]bool)
+	for _, g := range e.Glosswords {
+		if strings.TrimSpace(g.Word) != "" {
+			keys[glossKey(g.Word, g.Sense, 0)] = true
+		}
+	}
+	for _, k := range e.Keywords {
+		if strings.TrimSpace(k.Word) != "" {
+			keys[glossKey(k.Word, k.Sense, k.Place)] = true
+		}
+	}
+	return keys
+}
+
+// diff compares one batch of entries of the given language with the tables, reading only.
+func (b *batcher) diff(language string, entries []*xmlEntry, stats *importStats, d *importDiffer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), importBatchTimeout)
+	defer cancel()
+
+	langID, err := b.languageID(ctx, language)
+	if err != nil {
+		return err
+	}
+	d.name[langID] = language
+	if d.seen[langID] == nil {
+		d.seen[langID] = make(map[string]bool)
+	}
+	for _, e := range entries {
+		d.seen[langID][e.Word] = true
+	}
+	words, byWord := b.latestEntries(entries, stats)
+	if len(words) == 0 {
+		return nil
+	}
+
+	// 1. Words, with their current type and rafsi.
+	type existingWord struct {
+		id    int32
+		typ   string
+		rafsi string
+	}
+	existing := make(map[string]existingWord, len(words))
+	rows, err := b.pool.Query(ctx, `
+		SELECT v.valsiid, v.word, COALESCE(t.descriptor, ''), COALESCE(v.rafsi, '')
+		FROM valsi v
+		LEFT JOIN valsitypes t ON t.typeid = v.typeid
+		WHERE v.word = ANY($1)`, words)
+	if err != nil {
+		return fmt.Errorf("failed to read words: %w", err)
+	}
+	valsiIDs := make([]int32, 0, len(words))
+	for rows.Next() {
+		var w existingWord
+		var word string
+		if err := rows.Scan(&w.id, &word, &w.typ, &w.rafsi); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read words: %w", err)
+		}
+		existing[word] = w
+		valsiIDs = append(valsiIDs, w.id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read words: %w", err)
+	}
+
+	// 2. Their definitions in this language, with their glosses.
+	definitions := make(map[int32][]*existingDefinition) // valsiid -> definitions
+	byID := make(map[int32]*existingDefinition)
+	if len(valsiIDs) > 0 {
+		rows, err := b.pool.Query(ctx, `
+			SELECT d.definitionid, d.valsiid, d.definition, COALESCE(d.notes, ''), COALESCE(d.selmaho, ''), COALESCE(a.local, FALSE)
+			FROM definitions d`+lastApprovedRevision+`
+			WHERE d.valsiid = ANY($1) AND d.langid = $2
+			ORDER BY d.definitionid`, valsiIDs, langID)
+		if err != nil {
+			return fmt.Errorf("failed to read definitions: %w", err)
+		}
+		for rows.Next() {
+			def := &existingDefinition{glosses: make(map[string]bool)}
+			var valsiID int32
+			if err := rows.Scan(&def.id, &valsiID, &def.text, &def.notes, &def.selmaho, &def.edited); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read definitions: %w", err)
+			}
+			definitions[valsiID] = append(definitions[valsiID], def)
+			byID[def.id] = def
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read definitions: %w", err)
+		}
+	}
+	if len(byID) > 0 {
+		ids := make([]int32, 0, len(byID))
+		for id := range byID {
+			ids = append(ids, id)
+		}
+		rows, err := b.pool.Query(ctx, `
+			SELECT k.definitionid, n.word, COALESCE(n.meaning, ''), k.place
+			FROM keywordmapping k
+			JOIN natlangwords n ON n.wordid = k.natlangwordid
+			WHERE k.definitionid = ANY($1)`, ids)
+		if err != nil {
+			return fmt.Errorf("failed to read glosses: %w", err)
+		}
+		for rows.Next() {
+			var defID int32
+			var word, sense string
+			var place int
+			if err := rows.Scan(&defID, &word, &sense, &place); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read glosses: %w", err)
+			}
+			byID[defID].glosses[glossKey(word, sense, place)] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read glosses: %w", err)
+		}
+	}
+
+	// 3. Compare.
+	s := &d.diff.Summary
+	for _, w := range words {
+		e := byWord[w]
+		rafsi := strings.Join(e.Rafsi, " ")
+		old, exists := existing[w]
+		if !exists {
+			s.WordsAdded++
+			if d.room(len(d.diff.WordsAdded)) {
+				d.diff.WordsAdded = append(d.diff.WordsAdded, DiffWord{Word: w, Type: e.Type, Rafsi: append([]string{}, e.Rafsi...)})
+			}
+		} else {
+			var changes []DiffField
+			if !strings.EqualFold(old.typ, e.Type) {
+				changes = append(changes, DiffField{Field: "type", Old: old.typ, New: e.Type})
+			}
+			if old.rafsi != rafsi {
+				changes = append(changes, DiffField{Field: "rafsi", Old: old.rafsi, New: rafsi})
+			}
+			if len(changes) > 0 {
+				s.WordsChanged++
+				if d.room(len(d.diff.WordsChanged)) {
+					d.diff.WordsChanged = append(d.diff.WordsChanged, DiffWordChange{Word: w, Changes: changes})
+				}
+			}
+		}
+
+		text := strings.TrimSpace(e.Definition)
+		if text == "" {
+			continue
+		}
+		notes, selmaho := strings.TrimSpace(e.Notes), strings.TrimSpace(e.Selmaho)
+		glosses := entryGlosses(e)
+		var match *existingDefinition
+		alongside := []int32{}
+		for _, def := range definitions[old.id] {
+			if def.text == text {
+				match = def
+				break
+			}
+			alongside = append(alongside, def.id)
+		}
+		if match == nil {
+			s.DefinitionsAdded++
+			s.GlossesAdded += int64(len(glosses))
+			if d.room(len(d.diff.DefinitionsAdded)) {
+				d.diff.DefinitionsAdded = append(d.diff.DefinitionsAdded, DiffDefinition{
+					Word: w, Language: language, Definition: text, Notes: notes, Selmaho: selmaho,
+					Glosses: len(glosses), AlongsideDefinitionIDs: alongside,
+				})
+			}
+			continue
+		}
+
+		var changes []DiffField
+		if match.notes != notes {
+			changes = append(changes, DiffField{Field: "notes", Old: match.notes, New: notes})
+		}
+		if match.selmaho != selmaho {
+			changes = append(changes, DiffField{Field: "selmaho", Old: match.selmaho, New: selmaho})
+		}
+		added := 0
+		for key := range glosses {
+			if !match.glosses[key] {
+				added++
+			}
+		}
+		if len(changes) == 0 && added == 0 {
+			continue
+		}
+		conflict := match.edited && len(changes) > 0
+		s.DefinitionsChanged++
+		s.GlossesAdded += int64(added)
+		if conflict {
+			s.Conflicts++
+		}
+		if d.room(len(d.diff.DefinitionsChanged)) {
+			if changes == nil {
+				changes = []DiffField{}
+			}
+			d.diff.DefinitionsChanged = append(d.diff.DefinitionsChanged, DiffDefinitionChange{
+				DefinitionID: match.id, Word: w, Language: language, Changes: changes, GlossesAdded: added, Conflict: conflict,
+			})
+		}
+	}
+	return nil
+}
+
+// missingWords lists the words that have definitions in the export's languages but aren't in
+// the export.
+func (b *batcher) missingWords(d *importDiffer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), importBatchTimeout)
+	defer cancel()
+
+	langIDs := make([]int32, 0, len(d.seen))
+	for id := range d.seen {
+		langIDs = append(langIDs, id)
+	}
+	slices.Sort(langIDs)
+	for _, langID := range langIDs {
+		seen := make([]string, 0, len(d.seen[langID]))
+		for w := range d.seen[langID] {
+			seen = append(seen, w)
+		}
+		rows, err := b.pool.Query(ctx, `
+			SELECT v.word, COUNT(*)
+			FROM definitions d
+			JOIN valsi v ON v.valsiid = d.valsiid
+			WHERE d.langid = $1 AND NOT (v.word = ANY($2))
+			GROUP BY v.word
+			ORDER BY v.word`, langID, seen)
+		if err != nil {
+			return fmt.Errorf("failed to look up words missing from the export: %w", err)
+		}
+		for rows.Next() {
+			m := DiffMissingWord{Language: d.name[langID]}
+			if err := rows.Scan(&m.Word, &m.Definitions); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to look up words missing from the export: %w", err)
+			}
+			d.diff.Summary.WordsMissing++
+			if d.room(len(d.diff.WordsMissing)) {
+				d.diff.WordsMissing = append(d.diff.WordsMissing, m)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to look up words missing from the export: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `progress.go`, turns the `Broadcaster` into a progress channel for long-running
+// background tasks (re-embedding campaigns and dictionary imports).
+// Starting a task registers a Broadcaster client whose ID doubles as the task ID; the task
+// reports progress snapshots to it, and an admin UI follows them over SSE (see `handlers.go`)
+// instead of polling. The client's cancel channel lets the UI stop the task.
+// A task can also report to a client that is already connected (see `HandleImportEvents`), so
+// the UI can subscribe before it starts the task and miss nothing.
+// In Nest.js terms, this is like a service pushing `MessageEvent`s into an `@Sse()` observable.
+package jbovlaste
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Task states reported in ProgressEvent.State. Every state but TaskRunning is final.
+const (
+	TaskRunning   = "running"
+	TaskDone      = "done"
+	TaskFailed    = "failed"
+	TaskCancelled = "cancelled"
+)
+
+// taskRetention is how long a finished task can still be subscribed to, so a UI that connects
+// late (or reconnects) still sees how it ended.
+const taskRetention = 10 * time.Minute
+
+// ProgressEvent is the JSON payload of a progress SSE event.
+// @Description Progress snapshot of a long-running background task
+type ProgressEvent struct {
+	// example: "3f1c2a9e-5b7d-4e8f-9a0b-1c2d3e4f5a6b"
+	TaskID string `json:"task_id"`
+	// What kind of task this is
+	// example: "reembedding"
+	Kind string `json:"kind"`
+	// running, done, failed or cancelled
+	// example: "running"
+	State string `json:"state"`
+	// Current step of a task that runs in several stages
+	// example: "entries"
+	Stage string `json:"stage,omitempty"`
+	// example: 1200
+	Done int64 `json:"done"`
+	// 0 while unknown
+	// example: 3000
+	Total int64 `json:"total"`
+	// example: "1200 of 3000 embeddings replaced"
+	Message string `json:"message,omitempty"`
+}
+
+// Final reports whether the event ends the task's stream.
+func (e ProgressEvent) Final() bool {
+	return e.State != TaskRunning
+}
+
+// TaskProgress is the reporting side of one task. It is safe for concurrent use.
+type TaskProgress struct {
+	broadcaster *Broadcaster
+	id          string
+	kind        string
+	cancel      <-chan bool
+	// attached is set when the client belongs to an SSE connection, which removes it on
+	// disconnect; the task then doesn't schedule the removal itself.
+	attached bool
+
+	mu       sync.Mutex
+	stage    string
+	finished bool
+}
+
+// StartTask registers a new task of the given kind and returns its reporter.
+func (b *Broadcaster) StartTask(kind string) *TaskProgress {
+	id, _, cancel := b.NewClient()
+	b.mu.RLock()
+	if clientInfo, ok := b.clients[id]; ok {
+		clientInfo.mu.Lock()
+		clientInfo.task = true
+		clientInfo.mu.Unlock()
+	}
+	b.mu.RUnlock()
+	p := &TaskProgress{broadcaster: b, id: id, kind: kind, cancel: cancel}
+	p.send(ProgressEvent{State: TaskRunning})
+	return p
+}
+
+// AttachTask starts a task of the given kind that reports to the existing client `clientID`.
+// It returns false if there is no such client.
+func (b *Broadcaster) AttachTask(clientID, kind string) (*TaskProgress, bool) {
+	b.mu.RLock()
+	clientInfo, ok := b.clients[clientID]
+	b.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	p := &TaskProgress{broadcaster: b, id: clientID, kind: kind, cancel: clientInfo.cancelChannel, attached: true}
+	p.send(ProgressEvent{State: TaskRunning})
+	return p, true
+}
+
+// ID identifies the task; it is the path parameter of the SSE and cancel endpoints.
+func (p *TaskProgress) ID() string {
+	return p.id
+}
+
+// Cancelled delivers true when an admin asks to stop the task (see `CancelImport`). It is
+// closed, delivering false, once the client is removed, e.g. when the SSE connection of an
+// attached task goes away; that alone is not a request to stop.
+func (p *TaskProgress) Cancelled() <-chan bool {
+	return p.cancel
+}
+
+// SetStage starts a new stage; the following events carry its name. The counters of
+// `Update` apply to the current stage.
+func (p *TaskProgress) SetStage(stage string) {
+	p.mu.Lock()
+	p.stage = stage
+	p.mu.Unlock()
+	p.send(ProgressEvent{State: TaskRunning})
+}
+
+// Update reports that `done` of `total` units of work are finished.
+func (p *TaskProgress) Update(done, total int64, message string) {
+	p.send(ProgressEvent{State: TaskRunning, Done: done, Total: total, Message: message})
+}
+
+// Finish reports the final state and, unless the task is attached, schedules its removal
+// after `taskRetention`.
+// Only the first call has an effect.
+func (p *TaskProgress) Finish(state string, done, total int64, message string) {
+	p.mu.Lock()
+	if p.finished {
+		p.mu.Unlock()
+		return
+	}
+	p.finished = true
+	p.mu.Unlock()
+
+	p.send(ProgressEvent{State: state, Done: done, Total: total, Message: message})
+	if !p.attached {
+		time.AfterFunc(taskRetention, func() { p.broadcaster.RemoveClient(p.id) })
+	}
+}
+
+func (p *TaskProgress) send(event ProgressEvent) {
+	p.mu.Lock()
+	event.TaskID, event.Kind, event.Stage = p.id, p.kind, p.stage
+	p.mu.Unlock()
+	data, err := json.Marshal(event)
+	if err != nil {
+		p.broadcaster.logger.Error("Failed to encode task progress", "task", p.id, "error", err)
+		return
+	}
+	p.broadcaster.broadcastLatest(p.id, SSEEvent{Event: "progress", Data: string(data)})
+}
+
+// broadcastLatest is Broadcast for snapshot-style events: when nobody is reading and the
+// client's buffer is full, the oldest queued event is dropped to make room, so the newest
+// (and in particular the final) event is never the one lost. Dropped events stay in the
+// client's history for replay.
+func (b *Broadcaster) broadcastLatest(clientID string, event SSEEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	clientInfo, ok := b.clients[clientID]
+	if !ok {
+		return
+	}
+	clientInfo.mu.Lock()
+	event = clientInfo.record(event)
+	clientInfo.mu.Unlock()
+	b.publish(relayMessage{Kind: relayEvent, ClientID: clientID, Event: &event})
+	clientInfo.pushLatest(event)
+}
+
+// pushLatest queues an event, dropping the oldest queued one while the channel is full. The
+// caller holds the Broadcaster's read lock, so the channel can't be closed meanwhile.
+func (c *ClientInfo) pushLatest(event SSEEvent) {
+	for {
+		select {
+		case c.sseChannel <- event:
+			return
+		default:
+		}
+		select {
+		case <-c.sseChannel:
+		default:
+		}
+	}
+}
@@ -0,0 +1,292 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `relay.go`, lets several app instances share one set of SSE clients. Behind a load
+// balancer, the request that starts a task, the SSE stream following it and the request that
+// cancels it may each reach a different replica. With a relay, every event a Broadcaster sends
+// is also published to the other instances, which keep a mirror of the client under the same
+// ID: a stream on any instance sees the events, with the same IDs for Last-Event-ID, and
+// cancelling on any instance reaches the task. Removing a client removes its mirrors.
+//
+// The relay only carries messages. `PostgresRelay` uses Postgres LISTEN/NOTIFY, so, as for
+// leader election, no extra infrastructure is needed; `RedisRelay` uses Redis Pub/Sub, which
+// keeps the traffic off the database and has no payload limit. Delivery is best effort: messages sent
+// while an instance is reconnecting to the database are lost to it, and event IDs only stay in
+// order while one instance at a time sends to a client, which is how tasks use them.
+package jbovlaste
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// relayOutboxSize is how many messages may wait to be published. When publishing can't
+	// keep up, further messages only reach this instance's clients.
+	relayOutboxSize = 256
+
+	// relayTimeout bounds publishing one message.
+	relayTimeout = 5 * time.Second
+
+	// relayRetryDelay is how long a relay waits before listening again after losing its
+	// connection.
+	relayRetryDelay = 5 * time.Second
+
+	// mirrorTimeout is how long a mirror is kept without events; the instance running its
+	// task may have gone away without removing it.
+	mirrorTimeout = 30 * time.Minute
+
+	// maxNotifyPayload is the largest NOTIFY payload Postgres accepts, in bytes.
+	maxNotifyPayload = 8000
+)
+
+// Kinds of relay messages.
+const (
+	relayEvent  = "event"
+	relayCancel = "cancel"
+	relayRemove = "remove"
+)
+
+// relayMessage is what Broadcasters tell each other about a client.
+type relayMessage struct {
+	Origin   string    `json:"origin"`
+	Kind     string    `json:"kind"`
+	ClientID string    `json:"client_id"`
+	Event    *SSEEvent `json:"event,omitempty"`
+}
+
+// Relay carries messages between the Broadcasters of all instances.
+type Relay interface {
+	// Publish sends a message to every instance, this one included.
+	Publish(ctx context.Context, payload []byte) error
+	// Listen calls `deliver` with each published message until `stop` is closed.
+	Listen(deliver func(payload []byte), stop <-chan struct{})
+}
+
+// UseRelay shares the Broadcaster's clients with the other instances through `relay` until
+// `stop` is closed. Call it before the Broadcaster is used.
+func (b *Broadcaster) UseRelay(relay Relay, stop <-chan struct{}) {
+	b.instanceID = uuid.New().String()
+	b.outbox = make(chan relayMessage, relayOutboxSize)
+	go relay.Listen(b.receive, stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case msg := <-b.outbox:
+				payload, err := json.Marshal(msg)
+				if err != nil {
+					b.logger.Error("Failed to encode relay message", "client_id", msg.ClientID, "error", err)
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+				if err := relay.Publish(ctx, payload); err != nil {
+					b.logger.Error("Failed to publish relay message", "kind", msg.Kind, "client_id", msg.ClientID, "error", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// publish queues a message for the other instances. Without a relay it does nothing.
+func (b *Broadcaster) publish(msg relayMessage) {
+	if b.outbox == nil {
+		return
+	}
+	msg.Origin = b.instanceID
+	select {
+	case b.outbox <- msg:
+	default:
+		b.logger.Warn("Relay outbox full; message stays on this instance", "kind", msg.Kind, "client_id", msg.ClientID)
+	}
+}
+
+// receive applies a message published by another instance.
+func (b *Broadcaster) receive(payload []byte) {
+	var msg relayMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		b.logger.Warn("Ignoring invalid relay message", "error", err)
+		return
+	}
+	if msg.Origin == b.instanceID {
+		return
+	}
+	switch msg.Kind {
+	case relayEvent:
+		if msg.Event != nil {
+			b.mirrorEvent(msg.ClientID, *msg.Event)
+		}
+	case relayCancel:
+		_ = b.signalCancel(msg.ClientID) // Fails where the client is unknown or already cancelled.
+	case relayRemove:
+		b.removeMirror(msg.ClientID)
+	}
+}
+
+// mirrorEvent delivers an event sent on another instance, creating the client's mirror if
+// needed. The event keeps its ID, and the client numbers its own events after it.
+func (b *Broadcaster) mirrorEvent(clientID string, event SSEEvent) {
+	b.mu.Lock()
+	clientInfo, ok := b.clients[clientID]
+	if !ok {
+		clientInfo = &ClientInfo{
+			sseChannel:    make(chan SSEEvent, historySize),
+			cancelChannel: make(chan bool, 1),
+			idleSince:     time.Now(),
+			task:          true, // Left to mirrorTimeout rather than the idle check
+			mirror:        true,
+		}
+		b.clients[clientID] = clientInfo
+	}
+	b.mu.Unlock()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.clients[clientID] != clientInfo {
+		return // Removed meanwhile
+	}
+	clientInfo.mu.Lock()
+	if id, err := strconv.ParseUint(event.ID, 10, 64); err == nil && id > clientInfo.lastID {
+		clientInfo.lastID = id
+	}
+	clientInfo.remember(event)
+	clientInfo.lastRelayed = time.Now()
+	mirror := clientInfo.mirror
+	clientInfo.mu.Unlock()
+	clientInfo.pushLatest(event)
+
+	// Like a finished task, a mirror stays subscribable for a while after its final event.
+	var progress ProgressEvent
+	if mirror && json.Unmarshal([]byte(event.Data), &progress) == nil && progress.Final() {
+		time.AfterFunc(taskRetention, func() { b.removeMirror(clientID) })
+	}
+}
+
+// removeMirror removes a client if it is a mirror.
+func (b *Broadcaster) removeMirror(clientID string) {
+	b.mu.RLock()
+	clientInfo, ok := b.clients[clientID]
+	b.mu.RUnlock()
+	if ok && clientInfo.mirror {
+		b.RemoveClient(clientID)
+	}
+}
+
+// PostgresRelay is a Relay over Postgres LISTEN/NOTIFY. Listening keeps one connection of the
+// pool checked out.
+type PostgresRelay struct {
+	pool    *pgxpool.Pool
+	channel string
+	logger  *slog.Logger
+}
+
+// NewPostgresRelay creates a relay on the given notification channel; all instances must use
+// the same one.
+func NewPostgresRelay(pool *pgxpool.Pool, channel string) *PostgresRelay {
+	return &PostgresRelay{pool: pool, channel: channel, logger: logging.For("sse")}
+}
+
+// Publish sends a message with pg_notify. Messages over the NOTIFY payload limit are refused.
+func (r *PostgresRelay) Publish(ctx context.Context, payload []byte) error {
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("message of %d bytes exceeds the %d-byte NOTIFY limit", len(payload), maxNotifyPayload)
+	}
+	_, err := r.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, r.channel, string(payload))
+	return err
+}
+
+// Listen waits for notifications, reconnecting after errors, until `stop` is closed.
+func (r *PostgresRelay) Listen(deliver func(payload []byte), stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		err := r.listen(ctx, deliver)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Error("Listening for relay messages failed", "channel", r.channel, "retry_in", relayRetryDelay, "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(relayRetryDelay):
+		}
+	}
+}
+
+func (r *PostgresRelay) listen(ctx context.Context, deliver func(payload []byte)) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Don't hand a listening connection back to the pool. After a failed wait the
+		// connection is closed, and the pool discards it.
+		unlistenCtx, cancel := context.WithTimeout(context.Background(), relayTimeout)
+		defer cancel()
+		_, _ = conn.Exec(unlistenCtx, "UNLISTEN *")
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{r.channel}.Sanitize()); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		deliver([]byte(n.Payload))
+	}
+}
+
+// RedisRelay is a Relay over Redis Pub/Sub. Listening keeps one connection to Redis open,
+// outside the client's pool.
+type RedisRelay struct {
+	redis   *cache.Redis
+	channel string
+}
+
+// NewRedisRelay creates a relay on the given channel, under the deployment's key prefix; all
+// instances must use the same one.
+func NewRedisRelay(redis *cache.Redis, channel string) *RedisRelay {
+	return &RedisRelay{redis: redis, channel: redis.Key(channel)}
+}
+
+// Publish sends a message to the channel.
+func (r *RedisRelay) Publish(ctx context.Context, payload []byte) error {
+	return r.redis.Publish(ctx, r.channel, payload).Err()
+}
+
+// Listen delivers the messages of the channel until `stop` is closed. The subscription
+// reconnects by itself after errors.
+func (r *RedisRelay) Listen(deliver func(payload []byte), stop <-chan struct{}) {
+	sub := r.redis.Subscribe(context.Background(), r.channel)
+	defer sub.Close()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-stop:
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			deliver([]byte(msg.Payload))
+		}
+	}
+}
@@ -5,11 +5,18 @@
 // perhaps using SSE, WebSockets, or integrating with a message broker.
 package jbovlaste
 
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
 // SSEEvent represents a Server-Sent Event.
 // Think of this as the actual message or piece of news that the radio station (server)
 // sends out to its listeners (clients).
 // This struct defines the structure of data sent over an SSE connection.
-// In a real application, this might include fields like Event (type of news), ID (message number), Retry (how often to try again if lost), etc.
+// Besides the data, it carries the event name, an ID and a reconnection delay, the other fields of the SSE format.
 type SSEEvent struct {
 	// Data is the main content of the message. For example, if the server is sending
 	// progress updates for a file download, Data might be "25% complete", then "50% complete".
@@ -17,9 +24,57 @@ type SSEEvent struct {
 	Data string // The data payload of the event
 	
 
-	// Optional fields for more structured SSE events:
-	// Event string // Optional: You could add a type here, like "progressUpdate" or "newMessage".
-	// ID    string // Optional: You could give each message a unique ID.
+	// Event is the type of news, like "progress". Browsers dispatch it to listeners registered
+	// for that name; without it, the message goes to the generic "message" listener.
+	// In SSE, this corresponds to the "event:" field.
+	Event string
+
+	// ID is the message number. A browser that reconnects sends the last one it saw in the
+	// Last-Event-ID header, and the server replays what came after it (see `EventsSince`).
+	// The Broadcaster numbers each client's events; an ID set by the sender is replaced.
+	// In SSE, this corresponds to the "id:" field.
+	ID string
+
+	// Retry tells the browser how long to wait before reconnecting when the connection drops.
+	// Zero leaves it at the browser's default of a few seconds.
+	// In SSE, this corresponds to the "retry:" field, in milliseconds.
+	Retry time.Duration
+
+	// Comment is a line the browser ignores. The Broadcaster's heartbeat sends "ping" comments
+	// to keep idle connections open. In SSE, this is a line starting with ":".
+	Comment string
+}
+
+// lineBreaks turns line breaks into spaces in the fields that must fit on one line.
+var lineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// WriteTo writes the event in the text/event-stream format, ending with the blank line that
+// dispatches it. Data spanning several lines becomes one "data:" line each, which the browser
+// joins back with newlines. An event with only Retry or a Comment set dispatches nothing.
+func (e SSEEvent) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	if e.Comment != "" {
+		b.WriteString(": " + lineBreaks.Replace(e.Comment) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + lineBreaks.Replace(e.Event) + "\n")
+	}
+	if e.ID != "" {
+		// The browser ignores an ID containing NUL.
+		b.WriteString("id: " + lineBreaks.Replace(strings.ReplaceAll(e.ID, "\x00", "")) + "\n")
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry.Milliseconds())
+	}
+	if e.Data != "" || e.Event != "" || e.Retry == 0 && e.Comment == "" {
+		data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+		for _, line := range strings.Split(data, "\n") {
+			b.WriteString("data: " + line + "\n")
+		}
+	}
+	b.WriteString("\n")
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
 }
 
 // NewSSEEvent creates a new SSEEvent with the given data.
@@ -0,0 +1,79 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `topics.go`, lets several streams follow the same events. A task's client is read
+// by a single stream; a topic, such as the notifications of one user, gets a client of its own
+// for every stream following it, and an event published to the topic goes to each of them.
+//
+// Topic events keep the ID their publisher gave them, and replaying them is up to the
+// publisher: a topic client lives only as long as its stream, so a reconnecting stream starts
+// with a new, empty one. Topics aren't relayed; a publisher that needs every instance to see
+// an event runs on every instance.
+package jbovlaste
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// subscribe registers a client for a stream following `topic` and returns its ID and channel.
+func (b *Broadcaster) subscribe(topic string) (string, <-chan SSEEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	clientID := uuid.New().String()
+	clientInfo := &ClientInfo{
+		sseChannel:    make(chan SSEEvent, historySize),
+		cancelChannel: make(chan bool, 1),
+		idleSince:     time.Now(),
+		topic:         topic,
+	}
+	b.clients[clientID] = clientInfo
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[string]*ClientInfo)
+	}
+	b.topics[topic][clientID] = clientInfo
+	b.logger.Debug("Client subscribed to topic", "client_id", clientID, "topic", topic)
+	return clientID, clientInfo.sseChannel
+}
+
+// HasSubscribers tells whether a stream on this instance follows `topic`, so publishers can
+// skip the work of building events nobody receives.
+func (b *Broadcaster) HasSubscribers(topic string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic]) > 0
+}
+
+// PublishTopic sends `event`, with its ID unchanged, to every stream following `topic` on this
+// instance. A stream whose channel is full misses the event; if it stays full, the heartbeat
+// removes its client, which ends the stream, and the reconnecting EventSource has the missed
+// events replayed.
+func (b *Broadcaster) PublishTopic(topic string, event SSEEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for clientID, clientInfo := range b.topics[topic] {
+		select {
+		case clientInfo.sseChannel <- event:
+		default:
+			b.logger.Debug("Failed to send topic event: channel full", "client_id", clientID, "topic", topic)
+		}
+	}
+}
+
+// StreamTopic follows `topic` and streams its events as a text/event-stream response until the
+// client goes away. `missed` returns the events to replay first; it is called once the stream
+// is subscribed, so no event falls between the replay and the live ones, and an event in both
+// is sent once. An error from `missed` is returned before anything is written.
+func (b *Broadcaster) StreamTopic(w http.ResponseWriter, r *http.Request, topic string, missed func() ([]SSEEvent, error)) error {
+	clientID, events := b.subscribe(topic)
+	defer b.RemoveClient(clientID)
+	defer b.trackStream(clientID)()
+
+	replay, err := missed()
+	if err != nil {
+		return err
+	}
+	streamEvents(w, r, events, replay, false)
+	return nil
+}
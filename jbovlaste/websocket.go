@@ -0,0 +1,322 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `websocket.go`, offers the Broadcaster's topics over a WebSocket, for clients that
+// would rather hold one connection than an SSE stream per task, or that need to talk back over
+// it. A topic is a Broadcaster client ID: a task ID, or an import events client. Messages are
+// JSON objects (WSMessage) with a `type`:
+//
+//   - client to server: `subscribe` (topic, optionally last_event_id), `unsubscribe` (topic),
+//     `cancel` (topic), `open` (registers an import events client, like
+//     GET /api/v1/import/events, and subscribes to it) and `ping`.
+//   - server to client: `subscribed`, `event` (topic, event, id, data), `unsubscribed` (topic,
+//     message), `cancelled`, `error` (message, and the topic if any), `pong` and `ping`.
+//
+// A subscription behaves like the topic's SSE stream: it first replays the events after
+// `last_event_id`, ends after a task's final event, and, as each event is delivered once,
+// competes with any other subscriber of the topic. Topics opened over a socket are removed when
+// it closes.
+package jbovlaste
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/user/lensisku-go/auth"
+)
+
+const (
+	// wsMaxMessageBytes bounds a message from the client.
+	wsMaxMessageBytes = 4 << 10
+
+	// wsMaxSubscriptions bounds the topics one connection follows at once.
+	wsMaxSubscriptions = 16
+
+	// wsWriteTimeout bounds sending one message; a client that doesn't read is disconnected.
+	wsWriteTimeout = 10 * time.Second
+)
+
+// WSMessage is a message of the events WebSocket, in either direction.
+// @Description Message of the events WebSocket
+type WSMessage struct {
+	// subscribe, unsubscribe, cancel, open or ping from the client; subscribed, event,
+	// unsubscribed, cancelled, error, pong or ping from the server
+	// example: "subscribe"
+	Type string `json:"type"`
+	// Task or client ID
+	// example: "3f1c2a9e-5b7d-4e8f-9a0b-1c2d3e4f5a6b"
+	Topic string `json:"topic,omitempty"`
+	// With subscribe: replay the topic's events after this ID
+	// example: "12"
+	LastEventID string `json:"last_event_id,omitempty"`
+	// Name of the SSE event an event message carries
+	// example: "progress"
+	Event string `json:"event,omitempty"`
+	// ID of the carried event
+	// example: "13"
+	ID string `json:"id,omitempty"`
+	// Data of the carried event: the JSON payload itself, or a string when it isn't JSON
+	Data json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+	// What went wrong, or why a subscription ended
+	// example: "task finished"
+	Message string `json:"message,omitempty"`
+}
+
+// HandleWebSocket godoc
+// @Summary Follow tasks over a WebSocket
+// @Description Upgrades to a WebSocket carrying the same topics as the SSE task and import event streams, as JSON WSMessages. Send `{"type": "subscribe", "topic": task_id}` to receive a task's events (add `last_event_id` to replay missed ones), `{"type": "cancel", "topic": task_id}` to cancel it, and `{"type": "open"}` to register an import events client whose ID comes back in a `connected` event. Browsers pass the access token as a subprotocol: `new WebSocket(url, ["lensisku", "bearer." + token])`; other clients may send the Authorization header. The access cookie of a cookie session is not accepted. The token is only checked at upgrade time. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Success 101 {object} WSMessage "Switching to the WebSocket protocol"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Router /api/v1/ws [get]
+func (h *TaskHandlers) HandleWebSocket() http.HandlerFunc {
+	server := websocket.Server{Handshake: selectProtocol, Handler: h.serveSocket}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The server's read and write timeouts would otherwise stay on the connection after the
+		// upgrade and cut it off.
+		rc := http.NewResponseController(w)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+		server.ServeHTTP(w, r)
+	}
+}
+
+// selectProtocol accepts the app's subprotocol when the client offers it; the token the
+// client also offers as a subprotocol must not be echoed back. Origins aren't checked, since
+// the handshake can't be authenticated by cookie (see auth.WebSocketJWTMiddleware).
+func selectProtocol(config *websocket.Config, r *http.Request) error {
+	if slices.Contains(config.Protocol, auth.WebSocketProtocol) {
+		config.Protocol = []string{auth.WebSocketProtocol}
+	} else {
+		config.Protocol = nil
+	}
+	return nil
+}
+
+// socketSession is the state of one WebSocket connection.
+type socketSession struct {
+	broadcaster *Broadcaster
+	ws          *websocket.Conn
+	done        chan struct{} // Closed when the connection ends
+	wg          sync.WaitGroup
+
+	writeMu sync.Mutex
+
+	mu     sync.Mutex
+	subs   map[string]chan struct{} // Topic -> closed to end the subscription
+	opened map[string]bool          // Topics registered by this connection
+}
+
+func (h *TaskHandlers) serveSocket(ws *websocket.Conn) {
+	ws.MaxPayloadBytes = wsMaxMessageBytes
+	s := &socketSession{
+		broadcaster: h.broadcaster,
+		ws:          ws,
+		done:        make(chan struct{}),
+		subs:        make(map[string]chan struct{}),
+		opened:      make(map[string]bool),
+	}
+	defer s.close()
+
+	s.wg.Add(1)
+	go s.keepAlive()
+	for {
+		var msg WSMessage
+		err := websocket.JSON.Receive(ws, &msg)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+			s.send(WSMessage{Type: "error", Message: "invalid message: " + err.Error()})
+			continue
+		case errors.Is(err, websocket.ErrFrameTooLarge):
+			s.send(WSMessage{Type: "error", Message: fmt.Sprintf("messages may be at most %d bytes", wsMaxMessageBytes)})
+			continue
+		case err != nil:
+			return // Closed by the client, or broken
+		}
+		s.handle(msg)
+	}
+}
+
+// handle answers one message from the client.
+func (s *socketSession) handle(msg WSMessage) {
+	switch msg.Type {
+	case "ping":
+		s.send(WSMessage{Type: "pong"})
+	case "subscribe":
+		if msg.Topic == "" {
+			s.send(WSMessage{Type: "error", Message: "topic is required"})
+			return
+		}
+		s.subscribe(msg.Topic, msg.LastEventID, true)
+	case "unsubscribe":
+		s.mu.Lock()
+		stop, ok := s.subs[msg.Topic]
+		if ok {
+			delete(s.subs, msg.Topic)
+			close(stop)
+		}
+		s.mu.Unlock()
+		if !ok {
+			s.send(WSMessage{Type: "error", Topic: msg.Topic, Message: "not subscribed"})
+		}
+	case "cancel":
+		if s.broadcaster.GetClientSSEChannel(msg.Topic) == nil {
+			s.send(WSMessage{Type: "error", Topic: msg.Topic, Message: "unknown topic"})
+			return
+		}
+		if err := s.broadcaster.CancelImport(msg.Topic); err != nil {
+			s.send(WSMessage{Type: "error", Topic: msg.Topic, Message: "task already cancelled"})
+			return
+		}
+		s.send(WSMessage{Type: "cancelled", Topic: msg.Topic})
+	case "open":
+		clientID, _, _ := s.broadcaster.NewClient()
+		s.mu.Lock()
+		s.opened[clientID] = true
+		s.mu.Unlock()
+		if !s.subscribe(clientID, "", false) {
+			return
+		}
+		data, _ := json.Marshal(ImportConnectedEvent{ClientID: clientID})
+		s.broadcaster.Broadcast(clientID, SSEEvent{Event: "connected", Data: string(data)})
+	default:
+		s.send(WSMessage{Type: "error", Message: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
+
+// subscribe starts forwarding a topic's events. With `untilFinal`, the subscription ends after
+// the final event of a task.
+func (s *socketSession) subscribe(topic, lastEventID string, untilFinal bool) bool {
+	events := s.broadcaster.GetClientSSEChannel(topic)
+	if events == nil {
+		s.send(WSMessage{Type: "error", Topic: topic, Message: "unknown topic"})
+		return false
+	}
+	s.mu.Lock()
+	_, subscribed := s.subs[topic]
+	full := len(s.subs) >= wsMaxSubscriptions
+	stop := make(chan struct{})
+	if !subscribed && !full {
+		s.subs[topic] = stop
+	}
+	s.mu.Unlock()
+	switch {
+	case subscribed:
+		s.send(WSMessage{Type: "error", Topic: topic, Message: "already subscribed"})
+		return false
+	case full:
+		s.send(WSMessage{Type: "error", Topic: topic, Message: fmt.Sprintf("at most %d subscriptions per connection", wsMaxSubscriptions)})
+		return false
+	}
+
+	s.send(WSMessage{Type: "subscribed", Topic: topic})
+	missed := s.broadcaster.EventsSince(topic, lastEventID)
+	detach := s.broadcaster.trackStream(topic)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer detach()
+		reason := s.forward(topic, events, missed, stop, untilFinal)
+		s.mu.Lock()
+		if s.subs[topic] == stop {
+			delete(s.subs, topic)
+		}
+		s.mu.Unlock()
+		if reason != "" {
+			s.send(WSMessage{Type: "unsubscribed", Topic: topic, Message: reason})
+		}
+	}()
+	return true
+}
+
+// forward sends a topic's events until the subscription ends, and returns why it ended, or ""
+// when the connection is gone.
+func (s *socketSession) forward(topic string, events <-chan SSEEvent, missed []SSEEvent, stop <-chan struct{}, untilFinal bool) string {
+	// write sends one event and reports whether it was a task's final one.
+	write := func(event SSEEvent) bool {
+		msg := WSMessage{Type: "event", Topic: topic, Event: event.Event, ID: event.ID, Data: json.RawMessage(event.Data)}
+		if !json.Valid(msg.Data) {
+			msg.Data, _ = json.Marshal(event.Data)
+		}
+		s.send(msg)
+		var progress ProgressEvent
+		return untilFinal && json.Unmarshal([]byte(event.Data), &progress) == nil && progress.Final()
+	}
+	var replayed uint64
+	for _, event := range missed {
+		if write(event) {
+			return "task finished"
+		}
+		replayed, _ = strconv.ParseUint(event.ID, 10, 64)
+	}
+	for {
+		select {
+		case <-s.done:
+			return ""
+		case <-stop:
+			return "unsubscribed"
+		case event, ok := <-events:
+			if !ok {
+				return "topic closed"
+			}
+			if event.Comment != "" {
+				continue // Heartbeat pings; the connection has its own
+			}
+			if id, err := strconv.ParseUint(event.ID, 10, 64); err == nil && id <= replayed {
+				continue
+			}
+			if write(event) {
+				return "task finished"
+			}
+		}
+	}
+}
+
+// keepAlive pings the client, which keeps proxies from closing an idle connection and
+// reveals one that went away.
+func (s *socketSession) keepAlive() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.send(WSMessage{Type: "ping"})
+		}
+	}
+}
+
+// send writes a message. A failed write closes the connection, which ends the read loop.
+func (s *socketSession) send(msg WSMessage) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := websocket.JSON.Send(s.ws, msg); err != nil && !errors.Is(err, io.EOF) {
+		s.ws.Close()
+	}
+}
+
+// close ends the subscriptions and removes the topics this connection opened.
+func (s *socketSession) close() {
+	close(s.done)
+	s.ws.Close()
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for clientID := range s.opened {
+		s.broadcaster.RemoveClient(clientID)
+	}
+}
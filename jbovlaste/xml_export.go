@@ -0,0 +1,114 @@
+// Package jbovlaste, as part of the real-time updates module.
+// This file, `xml_export.go`, reads the XML export of jbovlaste, the Lojban dictionary this
+// application descends from. An export looks like this (only the parts we use are shown):
+//
+//	<dictionary>
+//	  <direction from="lojban" to="English">
+//	    <valsi word="klama" type="gismu">
+//	      <rafsi>kla</rafsi>
+//	      <user><username>officialdata</username></user>
+//	      <definition>$x_{1}$ comes/goes to ...</definition>
+//	      <notes>...</notes>
+//	      <glossword word="come" />
+//	      <keyword word="goer" place="1" />
+//	    </valsi>
+//	  </direction>
+//	  <direction from="English" to="lojban"> ... </direction>
+//	</dictionary>
+//
+// The file is read token by token, one `<valsi>` at a time, so exports of any size are parsed
+// in constant memory. Only lojban-to-natural-language directions are read; the reverse
+// direction is derived from the same keywords and is skipped.
+package jbovlaste
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// xmlEntry is one `<valsi>` element.
+type xmlEntry struct {
+	Word       string     `xml:"word,attr"`
+	Type       string     `xml:"type,attr"`
+	Rafsi      []string   `xml:"rafsi"`
+	Selmaho    string     `xml:"selmaho"`
+	Username   string     `xml:"user>username"`
+	Definition string     `xml:"definition"`
+	Notes      string     `xml:"notes"`
+	Glosswords []xmlGloss `xml:"glossword"`
+	Keywords   []xmlGloss `xml:"keyword"`
+}
+
+// xmlGloss is a `<glossword>` or a `<keyword>`; glosswords have no place.
+type xmlGloss struct {
+	Word  string `xml:"word,attr"`
+	Sense string `xml:"sense,attr"`
+	Place int    `xml:"place,attr"`
+}
+
+// exportReader yields the entries of an export in document order.
+type exportReader struct {
+	decoder *xml.Decoder
+	// language is the `to` attribute of the direction being read, e.g. "English".
+	language string
+}
+
+func newExportReader(r io.Reader) *exportReader {
+	return &exportReader{decoder: xml.NewDecoder(r)}
+}
+
+// offset is how many bytes of the input have been consumed, for progress reporting.
+func (x *exportReader) offset() int64 {
+	return x.decoder.InputOffset()
+}
+
+// next returns the next entry and the language of its direction, or io.EOF at the end of the
+// document. Entries without a word are skipped.
+func (x *exportReader) next() (*xmlEntry, string, error) {
+	for {
+		tok, err := x.decoder.Token()
+		if err != nil {
+			return nil, "", err // io.EOF at the end of the document
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "direction":
+			from, to := attr(start, "from"), attr(start, "to")
+			if !strings.EqualFold(from, "lojban") {
+				if err := x.decoder.Skip(); err != nil {
+					return nil, "", err
+				}
+				continue
+			}
+			x.language = to
+		case "valsi":
+			if x.language == "" {
+				return nil, "", fmt.Errorf("<valsi> outside a lojban <direction> at byte %d", x.offset())
+			}
+			var entry xmlEntry
+			if err := x.decoder.DecodeElement(&entry, &start); err != nil {
+				return nil, "", err
+			}
+			entry.Word = strings.TrimSpace(entry.Word)
+			if entry.Word == "" {
+				continue
+			}
+			return &entry, x.language, nil
+		}
+	}
+}
+
+// attr returns the value of the named attribute, or "".
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,311 @@
+// Package jobs, as part of the job queue module.
+// This file, `admin.go`, lets administrators see how the queue is doing, inspect dead-lettered
+// jobs and requeue them. Requeueing is audited.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// JobSummary describes a job for the admin API.
+// @Description A background job
+type JobSummary struct {
+	// example: 42
+	ID int64 `json:"id"`
+	// example: "email.send"
+	Type string `json:"type"`
+	// One of pending, running, done, dead
+	// example: "dead"
+	Status string `json:"status"`
+	// example: 5
+	Attempts int `json:"attempts"`
+	// example: 5
+	MaxAttempts int `json:"max_attempts"`
+	// Higher runs first
+	// example: 0
+	Priority int `json:"priority"`
+	// example: "dial tcp: connection refused"
+	LastError *string         `json:"last_error,omitempty"`
+	Payload   json.RawMessage `json:"payload" swaggertype:"object"`
+	RunAt     time.Time       `json:"run_at"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// JobListResponse is a page of jobs.
+// @Description Paginated list of jobs
+type JobListResponse struct {
+	Jobs    []JobSummary `json:"jobs"`
+	Total   int64        `json:"total"`
+	Page    int64        `json:"page"`
+	PerPage int64        `json:"per_page"`
+}
+
+// QueueSize is the number of jobs of one type in one status.
+// @Description Job count for a type and status
+type QueueSize struct {
+	// example: "email.send"
+	Type string `json:"type"`
+	// example: "pending"
+	Status string `json:"status"`
+	// example: 12
+	Count int64 `json:"count"`
+}
+
+// JobsOverview is the state of the queue as seen by one instance.
+// @Description Queue sizes, recent failures and worker status
+type JobsOverview struct {
+	// Jobs that are pending, running or dead, by type. Completed jobs are not counted.
+	Queues []QueueSize `json:"queues"`
+	// Jobs whose last attempt failed (waiting for a retry or dead), most recent first
+	RecentFailures []JobSummary `json:"recent_failures"`
+	// Worker pool of the instance that served the request
+	Worker WorkerStatus `json:"worker"`
+}
+
+// recentFailuresLimit caps JobsOverview.RecentFailures.
+const recentFailuresLimit = 20
+
+// Sizes counts unfinished and dead jobs by type and status.
+func (q *Queue) Sizes(ctx context.Context) ([]QueueSize, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT type, status, COUNT(*)
+		FROM jobs
+		WHERE status <> 'done'
+		GROUP BY type, status
+		ORDER BY type, status`)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to count jobs", err)
+	}
+	defer rows.Close()
+	sizes := []QueueSize{}
+	for rows.Next() {
+		var size QueueSize
+		if err := rows.Scan(&size.Type, &size.Status, &size.Count); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read job counts", err)
+		}
+		sizes = append(sizes, size)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count jobs", err)
+	}
+	return sizes, nil
+}
+
+// RecentFailures returns jobs whose last attempt failed, most recently updated first.
+func (q *Queue) RecentFailures(ctx context.Context, limit int) ([]JobSummary, error) {
+	rows, err := q.db.Query(ctx, `
+		SELECT id, type, status, attempts, max_attempts, priority, last_error, payload, run_at, created_at, updated_at
+		FROM jobs
+		WHERE last_error IS NOT NULL AND status IN ('pending', 'dead')
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list failed jobs", err)
+	}
+	defer rows.Close()
+	failures := []JobSummary{}
+	for rows.Next() {
+		var j JobSummary
+		if err := rows.Scan(&j.ID, &j.Type, &j.Status, &j.Attempts, &j.MaxAttempts, &j.Priority, &j.LastError, &j.Payload, &j.RunAt, &j.CreatedAt, &j.UpdatedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read job", err)
+		}
+		failures = append(failures, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list failed jobs", err)
+	}
+	return failures, nil
+}
+
+// ListDead returns dead-lettered jobs, most recently failed first.
+func (q *Queue) ListDead(ctx context.Context, page, perPage int64) (*JobListResponse, error) {
+	resp := &JobListResponse{Jobs: []JobSummary{}, Page: page, PerPage: perPage}
+	if err := q.db.QueryRow(ctx, `SELECT COUNT(*) FROM jobs WHERE status = 'dead'`).Scan(&resp.Total); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count dead jobs", err)
+	}
+	rows, err := q.db.Query(ctx, `
+		SELECT id, type, status, attempts, max_attempts, priority, last_error, payload, run_at, created_at, updated_at
+		FROM jobs
+		WHERE status = 'dead'
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $1 OFFSET $2`, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list dead jobs", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var j JobSummary
+		if err := rows.Scan(&j.ID, &j.Type, &j.Status, &j.Attempts, &j.MaxAttempts, &j.Priority, &j.LastError, &j.Payload, &j.RunAt, &j.CreatedAt, &j.UpdatedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read job", err)
+		}
+		resp.Jobs = append(resp.Jobs, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list dead jobs", err)
+	}
+	return resp, nil
+}
+
+// Retry puts a dead job back into the queue with a fresh set of attempts, on behalf of the
+// admin `actorID`.
+func (q *Queue) Retry(ctx context.Context, id int64, actorID int) error {
+	return db.WithTx(ctx, q.db, func(tx pgx.Tx) error {
+		var before struct {
+			Status    string  `json:"status"`
+			Attempts  int     `json:"attempts"`
+			LastError *string `json:"last_error"`
+		}
+		err := tx.QueryRow(ctx, `SELECT status, attempts, last_error FROM jobs WHERE id = $1 FOR UPDATE`, id).
+			Scan(&before.Status, &before.Attempts, &before.LastError)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewNotFoundError(fmt.Sprintf("job %d not found", id), nil)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to look up job", err)
+		}
+		if before.Status != StatusDead {
+			return apperror.NewConflictError(fmt.Sprintf("job %d is %s; only dead jobs can be retried", id, before.Status), nil).WithCode(apperror.CodeJobNotRetryable)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE jobs
+			SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+			WHERE id = $1`, id)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to requeue job", err)
+		}
+		return audit.Record(ctx, tx, audit.Entry{
+			ActorID:    actorID,
+			Action:     audit.ActionJobRetry,
+			TargetType: audit.TargetJob,
+			TargetID:   strconv.FormatInt(id, 10),
+			Before:     before,
+			After:      map[string]any{"status": StatusPending, "attempts": 0},
+		})
+	})
+}
+
+// AdminHandlers exposes the queue and this instance's worker pool to administrators.
+type AdminHandlers struct {
+	queue  *Queue
+	worker *Worker
+}
+
+// NewAdminHandlers creates the admin handlers.
+func NewAdminHandlers(queue *Queue, worker *Worker) *AdminHandlers {
+	return &AdminHandlers{queue: queue, worker: worker}
+}
+
+// HandleGetOverview godoc
+// @Summary Job queue overview
+// @Description Returns job counts by type and status, the most recent failures and the status of the serving instance's worker pool. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} JobsOverview "Queue overview"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/jobs [get]
+func (h *AdminHandlers) HandleGetOverview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sizes, err := h.queue.Sizes(r.Context())
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		failures, err := h.queue.RecentFailures(r.Context(), recentFailuresLimit)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, JobsOverview{
+			Queues:         sizes,
+			RecentFailures: failures,
+			Worker:         h.worker.Status(),
+		})
+	}
+}
+
+// HandleListDeadJobs godoc
+// @Summary List dead-lettered jobs
+// @Description Returns background jobs that failed on every attempt, most recent first. Admins only.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Success 200 {object} JobListResponse "Dead jobs"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/jobs/dead [get]
+func (h *AdminHandlers) HandleListDeadJobs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q validation.Pagination
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		list, err := h.queue.ListDead(r.Context(), q.Page, q.PerPage)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, list)
+	}
+}
+
+// HandleRetryJob godoc
+// @Summary Requeue a dead job
+// @Description Moves a dead-lettered job back to pending with its attempt counter reset. Admins only.
+// @Tags admin
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Param jobID path int true "Job ID"
+// @Success 204 "Requeued"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid job ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not an admin, or missing X-Sudo-Token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Job not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Job is not dead"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /admin/jobs/{jobID}/retry [post]
+func (h *AdminHandlers) HandleRetryJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+		if err != nil || id <= 0 {
+			auth.WriteError(w, r, apperror.NewBadRequestError("invalid job ID", err))
+			return
+		}
+		if err := h.queue.Retry(r.Context(), id, userID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,30 @@
+// Package jobs, as part of the job queue module.
+// This file, `backoff.go`, computes retry delays: exponential growth capped at a maximum, with
+// jitter so that jobs which failed together (e.g. during a provider outage) don't all retry at
+// the same moment and fail together again.
+package jobs
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	backoffBase = 10 * time.Second
+	backoffMax  = time.Hour
+)
+
+// Backoff returns the delay before retrying after the given failed attempt (1-based):
+// about 10s, 20s, 40s, ... up to one hour, each randomised to between half and the full value.
+func Backoff(attempt int) time.Duration {
+	delay := backoffMax
+	if attempt < 1 {
+		attempt = 1
+	}
+	// Beyond ~20 doublings the cap applies anyway; stop early to avoid overflow.
+	if attempt <= 20 {
+		delay = min(backoffBase<<(attempt-1), backoffMax)
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
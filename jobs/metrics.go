@@ -0,0 +1,93 @@
+// Package jobs, as part of the job queue module.
+// This file, `metrics.go`, publishes the job queue in Prometheus: the outcome and duration of
+// the jobs this instance runs, its busy workers, and, counted at each scrape, the jobs waiting,
+// running or dead in the whole queue.
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/user/lensisku-go/logging"
+)
+
+// sizesTimeout bounds the count of the queue at each scrape.
+const sizesTimeout = 5 * time.Second
+
+// The outcomes of a job run.
+const (
+	outcomeDone        = "done"
+	outcomeRetried     = "retried"
+	outcomeDeferred    = "deferred"
+	outcomeDead        = "dead"
+	outcomeInterrupted = "interrupted"
+)
+
+// workerMetrics are the metrics of one worker pool.
+type workerMetrics struct {
+	runs     *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// newWorkerMetrics registers the metrics of `w` with the default Prometheus registry.
+func newWorkerMetrics(w *Worker) *workerMetrics {
+	m := &workerMetrics{
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "lensisku",
+			Subsystem: "jobs",
+			Name:      "runs_total",
+			Help:      "Jobs run by this instance, by type and outcome (done, retried, deferred, dead or interrupted).",
+		}, []string{"type", "outcome"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "lensisku",
+			Subsystem: "jobs",
+			Name:      "run_duration_seconds",
+			Help:      "Time the handler of each job took, by type.",
+			Buckets:   []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 120, 300},
+		}, []string{"type"}),
+	}
+	busy := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "lensisku",
+		Subsystem: "jobs",
+		Name:      "busy_workers",
+		Help:      "Workers of this instance currently running a handler.",
+	}, func() float64 { return float64(w.busy.Load()) })
+	prometheus.MustRegister(m.runs, m.duration, busy, &queueCollector{queue: w.queue})
+	return m
+}
+
+// observe records one run of `job`.
+func (m *workerMetrics) observe(job *Job, outcome string, took time.Duration) {
+	m.runs.WithLabelValues(job.Type, outcome).Inc()
+	m.duration.WithLabelValues(job.Type).Observe(took.Seconds())
+}
+
+// queueCollector counts the unfinished and dead jobs at each scrape, so the numbers are those
+// of the whole queue, whichever instance is scraped.
+type queueCollector struct {
+	queue *Queue
+}
+
+var queueSizeDesc = prometheus.NewDesc("lensisku_jobs_queue_size",
+	"Jobs that are pending, running or dead, by type and status.",
+	[]string{"type", "status"}, nil)
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueSizeDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), sizesTimeout)
+	defer cancel()
+	sizes, err := c.queue.Sizes(ctx)
+	if err != nil {
+		// The scrape goes on without the queue sizes; the other metrics don't need the database.
+		logging.For("jobs").Warn("Failed to count jobs for metrics", "error", err)
+		return
+	}
+	for _, s := range sizes {
+		ch <- prometheus.MustNewConstMetric(queueSizeDesc, prometheus.GaugeValue, float64(s.Count), s.Type, s.Status)
+	}
+}
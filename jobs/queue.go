@@ -0,0 +1,114 @@
+// Package jobs is a durable background job queue stored in PostgreSQL. Work that used to live
+// only in Go channels (embeddings, emails, ...) is written to the `jobs` table instead, so it
+// survives restarts and can be shared between several app instances.
+//
+// Workers claim jobs with `SELECT ... FOR UPDATE SKIP LOCKED`: each pending row is handed to
+// exactly one worker, and workers never wait on rows another worker has locked.
+// In Nest.js terms this plays the role of BullMQ, with Postgres instead of Redis.
+//
+// This file, `queue.go`, holds the job model and enqueueing; `worker.go` runs the handlers.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+)
+
+// Job statuses, as stored in `jobs.status`.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	// StatusDead is the dead-letter state: the job used up its attempts and waits for an
+	// operator to inspect it and requeue it (POST /admin/jobs/{id}/retry).
+	StatusDead = "dead"
+)
+
+// Job priorities. Workers always take a due job of the highest priority first, so work a user
+// is waiting for isn't stuck behind a bulk backfill.
+const (
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// defaultMaxAttempts applies when a job is enqueued without its own limit.
+const defaultMaxAttempts = 5
+
+// Job is a unit of background work.
+type Job struct {
+	ID          int64
+	Type        string
+	Payload     json.RawMessage
+	Attempts    int // Including the current one while a handler runs
+	MaxAttempts int
+	RunAt       time.Time
+	CreatedAt   time.Time
+}
+
+// Decode unmarshals the payload into `v`.
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// EnqueueOptions tune a single job; the zero value runs it as soon as possible with the
+// default attempt limit.
+type EnqueueOptions struct {
+	RunAt       time.Time // Earliest time the job may run
+	MaxAttempts int       // Attempts before the job is marked failed
+	Priority    int       // PriorityNormal unless set
+}
+
+// Queue enqueues jobs.
+type Queue struct {
+	db *pgxpool.Pool
+}
+
+// NewQueue creates a queue on top of the `jobs` table.
+func NewQueue(db *pgxpool.Pool) *Queue {
+	return &Queue{db: db}
+}
+
+// Enqueue adds a job; `payload` is stored as JSON.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload any, opts *EnqueueOptions) (int64, error) {
+	return enqueue(ctx, q.db, jobType, payload, opts)
+}
+
+// EnqueueTx adds a job inside the caller's transaction, so the job exists if and only if the
+// rest of the transaction commits (e.g. "send a notification for this new comment").
+func (q *Queue) EnqueueTx(ctx context.Context, tx pgx.Tx, jobType string, payload any, opts *EnqueueOptions) (int64, error) {
+	return enqueue(ctx, tx, jobType, payload, opts)
+}
+
+func enqueue(ctx context.Context, q db.Querier, jobType string, payload any, opts *EnqueueOptions) (int64, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return 0, apperror.NewInternalError("failed to encode job payload", err)
+	}
+	runAt, maxAttempts, priority := time.Now(), defaultMaxAttempts, PriorityNormal
+	if opts != nil {
+		priority = opts.Priority
+		if !opts.RunAt.IsZero() {
+			runAt = opts.RunAt
+		}
+		if opts.MaxAttempts > 0 {
+			maxAttempts = opts.MaxAttempts
+		}
+	}
+
+	var id int64
+	err = q.QueryRow(ctx, `
+		INSERT INTO jobs (type, payload, run_at, max_attempts, priority)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`, jobType, encoded, runAt, maxAttempts, priority).Scan(&id)
+	if err != nil {
+		return 0, apperror.NewDatabaseError("failed to enqueue job", err)
+	}
+	return id, nil
+}
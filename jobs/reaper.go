@@ -0,0 +1,79 @@
+// Package jobs, as part of the job queue module.
+// This file, `reaper.go`, recovers jobs stranded by a worker that died mid-run (e.g. a crashed
+// pod). Such a job stays `running` forever because nobody is left to record its outcome. Live
+// workers refresh `heartbeat_at` every `heartbeatInterval`; the reaper, which runs in every
+// instance, hands back running jobs whose heartbeat is older than `staleJobAfter`.
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// staleJobAfter is how old a running job's heartbeat may get before its worker is
+	// considered dead. Several missed heartbeats are tolerated so a slow database doesn't
+	// cause jobs to be taken away from healthy workers.
+	staleJobAfter = 5 * heartbeatInterval
+
+	// reapInterval is how often each instance looks for stale jobs.
+	reapInterval = time.Minute
+)
+
+// reapLoop runs `reapStaleJobs` every `reapInterval` until `ctx` is cancelled.
+func (w *Worker) reapLoop(ctx context.Context) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reaped, err := w.reapStaleJobs(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					w.logger.Error("Failed to reset stale jobs", "error", err)
+				}
+				continue
+			}
+			if reaped > 0 {
+				w.reaped.Add(reaped)
+				// Stale jobs mean a worker died; worth an alert even though nothing was lost.
+				w.logger.Warn("Stale jobs reset", "metric", "jobs_reaped", "count", reaped, "total", w.reaped.Load())
+			}
+		}
+	}
+}
+
+// reapStaleJobs resets running jobs without a recent heartbeat. The interrupted attempt still
+// counts, so a job that keeps killing its worker ends up dead-lettered instead of crashing
+// one instance after another. Jobs claimed before heartbeats existed fall back to `locked_at`.
+func (w *Worker) reapStaleJobs(ctx context.Context) (int64, error) {
+	rows, err := w.queue.db.Query(ctx, `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+		    last_error = 'worker ' || COALESCE(locked_by, 'unknown') || ' stopped sending heartbeats',
+		    run_at = NOW(),
+		    updated_at = NOW(),
+		    locked_by = NULL, locked_at = NULL, heartbeat_at = NULL
+		WHERE status = 'running'
+		  AND COALESCE(heartbeat_at, locked_at, updated_at) < NOW() - make_interval(secs => $1)
+		RETURNING id, type, status`, staleJobAfter.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var reaped int64
+	for rows.Next() {
+		var (
+			id            int64
+			jobType, next string
+		)
+		if err := rows.Scan(&id, &jobType, &next); err != nil {
+			return reaped, err
+		}
+		w.logger.Warn("Job was stranded by a dead worker", "job_id", id, "type", jobType, "status", next)
+		reaped++
+	}
+	return reaped, rows.Err()
+}
@@ -0,0 +1,354 @@
+// Package jobs, as part of the job queue module.
+// This file, `worker.go`, runs registered handlers for queued jobs. A worker pool polls the
+// table, claims one due job at a time and records the outcome: done, retried after an
+// exponential backoff (see `backoff.go`), deferred without using up an attempt, or
+// dead-lettered once `max_attempts` is reached. Errors are classified with apperror: a client
+// error that isn't retryable (a validation failure, a missing row) dead-letters the job right
+// away, and a transient one is retried no sooner than its suggested delay.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// jobTimeout bounds a single handler run.
+	jobTimeout = 5 * time.Minute
+
+	// maxErrorLength keeps `jobs.last_error` reasonably short.
+	maxErrorLength = 1000
+
+	// heartbeatInterval is how often a running job's `heartbeat_at` is refreshed. It must stay
+	// well below `staleJobAfter` (see `reaper.go`).
+	heartbeatInterval = 30 * time.Second
+)
+
+// HandlerFunc processes one job. Returning an error schedules a retry (or dead-letters the job
+// once its attempts are used up), so handlers must be safe to run more than once. Errors that
+// no retry can fix should be wrapped with Permanent (an apperror client error that isn't
+// retryable counts as one), and temporary refusals that aren't the job's fault with Defer.
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+// permanentError marks a failure that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps `err` so the worker dead-letters the job right away instead of retrying it,
+// e.g. when an email address is rejected by the mail server.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// deferredError marks a job that couldn't run yet and should be tried again at `until`.
+type deferredError struct {
+	err   error
+	until time.Time
+}
+
+func (e *deferredError) Error() string { return e.err.Error() }
+func (e *deferredError) Unwrap() error { return e.err }
+
+// Defer wraps `err` so the worker puts the job back until `until` without counting the attempt,
+// e.g. when the embedding provider's daily budget is used up. A deferred job never dead-letters.
+func Defer(err error, until time.Time) error {
+	if err == nil {
+		return nil
+	}
+	return &deferredError{err: err, until: until}
+}
+
+// Worker claims jobs and dispatches them to the handler registered for their type.
+type Worker struct {
+	queue        *Queue
+	handlers     map[string]HandlerFunc
+	concurrency  int
+	pollInterval time.Duration
+	id           string // Stored in `jobs.locked_by` for debugging
+	logger       *slog.Logger
+	metrics      *workerMetrics
+
+	running atomic.Bool  // Between Start and the last goroutine exiting
+	busy    atomic.Int32 // Goroutines currently inside a handler
+	reaped  atomic.Int64 // Stale jobs of dead workers this instance's reaper handed back
+}
+
+// WorkerStatus reports what this instance's worker pool is doing.
+// @Description Job worker pool of the instance that served the request
+type WorkerStatus struct {
+	// Value of `jobs.locked_by` for jobs claimed by this instance
+	// example: "app-1-4242"
+	ID string `json:"id"`
+	// example: true
+	Running bool `json:"running"`
+	// example: 4
+	Workers int `json:"workers"`
+	// Workers currently running a handler
+	// example: 1
+	Busy int `json:"busy"`
+	// Job types this instance handles
+	Types []string `json:"types"`
+	// Jobs of dead workers this instance's reaper reset since it started
+	// example: 0
+	Reaped int64 `json:"reaped"`
+}
+
+// NewWorker creates a worker pool; register handlers before calling Start.
+func NewWorker(queue *Queue, cfg *config.JobsConfig) *Worker {
+	host, _ := os.Hostname()
+	w := &Worker{
+		queue:        queue,
+		handlers:     make(map[string]HandlerFunc),
+		concurrency:  cfg.Workers,
+		pollInterval: cfg.PollInterval,
+		id:           fmt.Sprintf("%s-%d", host, os.Getpid()),
+		logger:       logging.For("jobs"),
+	}
+	w.metrics = newWorkerMetrics(w)
+	return w
+}
+
+// Register sets the handler for a job type. Jobs of unregistered types stay pending, so an
+// instance running older code never fails jobs it doesn't know about.
+func (w *Worker) Register(jobType string, handler HandlerFunc) {
+	w.handlers[jobType] = handler
+}
+
+// Start launches the worker goroutines. Closing `stopChan` cancels running handlers; their
+// jobs are put back without counting the interrupted attempt.
+func (w *Worker) Start(stopChan <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopChan
+		cancel()
+	}()
+
+	types := make([]string, 0, len(w.handlers))
+	for t := range w.handlers {
+		types = append(types, t)
+	}
+
+	w.running.Store(true)
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx, types)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.reapLoop(ctx)
+	}()
+	go func() {
+		wg.Wait()
+		w.running.Store(false)
+		w.logger.Info("Job workers stopped")
+	}()
+	w.logger.Info("Job workers started", "workers", w.concurrency, "types", types)
+}
+
+// Status returns a snapshot of the pool.
+func (w *Worker) Status() WorkerStatus {
+	types := make([]string, 0, len(w.handlers))
+	for t := range w.handlers {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return WorkerStatus{
+		ID:      w.id,
+		Running: w.running.Load(),
+		Workers: w.concurrency,
+		Busy:    int(w.busy.Load()),
+		Types:   types,
+		Reaped:  w.reaped.Load(),
+	}
+}
+
+// loop claims and runs jobs until `ctx` is cancelled, sleeping when the queue is empty.
+func (w *Worker) loop(ctx context.Context, types []string) {
+	for {
+		job, err := w.claim(ctx, types)
+		if err != nil && ctx.Err() == nil {
+			w.logger.Error("Failed to claim a job", "error", err)
+		}
+		if job != nil {
+			w.busy.Add(1)
+			w.run(ctx, job)
+			w.busy.Add(-1)
+			continue // There may be more due jobs; don't wait.
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+// claim atomically takes the oldest due pending job of a known type, highest priority first.
+func (w *Worker) claim(ctx context.Context, types []string) (*Job, error) {
+	var job Job
+	err := w.queue.db.QueryRow(ctx, `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_by = $2, locked_at = NOW(), heartbeat_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'pending' AND run_at <= NOW() AND type = ANY($1)
+			ORDER BY priority DESC, run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, type, payload, attempts, max_attempts, run_at, created_at`, types, w.id).
+		Scan(&job.ID, &job.Type, &job.Payload, &job.Attempts, &job.MaxAttempts, &job.RunAt, &job.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// run executes the handler and records the outcome. Bookkeeping uses a fresh context so the
+// result is still saved while the worker is shutting down.
+func (w *Worker) run(ctx context.Context, job *Job) {
+	jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+	stopHeartbeat := w.heartbeat(job)
+	started := time.Now()
+	err := w.callHandler(jobCtx, job)
+	took := time.Since(started)
+	stopHeartbeat()
+	cancel()
+
+	saveCtx, cancelSave := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelSave()
+
+	logger := w.logger.With("job_id", job.ID, "type", job.Type)
+	var saveErr error
+	var deferred *deferredError
+	outcome := outcomeDone
+	switch {
+	case err == nil:
+		_, saveErr = w.queue.db.Exec(saveCtx, `
+			UPDATE jobs SET status = 'done', completed_at = NOW(), updated_at = NOW(), locked_by = NULL, locked_at = NULL, heartbeat_at = NULL
+			WHERE id = $1`, job.ID)
+	case ctx.Err() != nil:
+		// Interrupted by shutdown: hand the job back as if this attempt never happened.
+		outcome = outcomeInterrupted
+		_, saveErr = w.queue.db.Exec(saveCtx, `
+			UPDATE jobs SET status = 'pending', attempts = attempts - 1, updated_at = NOW(), locked_by = NULL, locked_at = NULL, heartbeat_at = NULL
+			WHERE id = $1`, job.ID)
+	case errors.As(err, &deferred):
+		outcome = outcomeDeferred
+		logger.Info("Job deferred", "until", deferred.until.Format(time.RFC3339), "error", err)
+		_, saveErr = w.queue.db.Exec(saveCtx, `
+			UPDATE jobs
+			SET status = 'pending', attempts = attempts - 1, last_error = $2, run_at = $3, updated_at = NOW(), locked_by = NULL, locked_at = NULL, heartbeat_at = NULL
+			WHERE id = $1`, job.ID, truncateError(err.Error()), deferred.until)
+	default:
+		message := truncateError(err.Error())
+		outcome = outcomeRetried
+		status, delay := StatusPending, Backoff(job.Attempts)
+		if d := apperror.RetryDelay(err); d > delay {
+			delay = d
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || apperror.IsFatal(err) {
+			status, delay, outcome = StatusDead, 0, outcomeDead
+			logger.Error("Job failed permanently, moved to dead-letter state", "error", err)
+		} else if job.Attempts >= job.MaxAttempts {
+			status, delay, outcome = StatusDead, 0, outcomeDead
+			logger.Error("Job failed too often, moved to dead-letter state", "attempts", job.Attempts, "error", err)
+		} else {
+			logger.Warn("Job attempt failed, retrying", "attempt", job.Attempts, "max_attempts", job.MaxAttempts, "retry_in", delay.Round(time.Second), "error", err)
+		}
+		_, saveErr = w.queue.db.Exec(saveCtx, `
+			UPDATE jobs
+			SET status = $2, last_error = $3, run_at = NOW() + make_interval(secs => $4), updated_at = NOW(), locked_by = NULL, locked_at = NULL, heartbeat_at = NULL
+			WHERE id = $1`, job.ID, status, message, delay.Seconds())
+	}
+	w.metrics.observe(job, outcome, took)
+	if saveErr != nil {
+		logger.Error("Failed to record job result", "error", saveErr)
+	}
+}
+
+// callHandler runs the job's handler. A panic becomes the attempt's error, with its stack, so
+// a broken handler fails its job (retried or dead-lettered as usual) instead of crashing the
+// process.
+func (w *Worker) callHandler(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+	return w.handlers[job.Type](ctx, job)
+}
+
+// heartbeat refreshes the job's `heartbeat_at` until the returned function is called, so the
+// reaper can tell a long-running handler from a dead worker.
+func (w *Worker) heartbeat(job *Job) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				_, err := w.queue.db.Exec(ctx, `
+					UPDATE jobs SET heartbeat_at = NOW() WHERE id = $1 AND status = 'running' AND locked_by = $2`, job.ID, w.id)
+				cancel()
+				if err != nil {
+					w.logger.Error("Failed to record job heartbeat", "job_id", job.ID, "type", job.Type, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// truncateError keeps a handler error within `maxErrorLength` bytes for `jobs.last_error`. It
+// cuts at a rune boundary: Postgres refuses text with half a UTF-8 character.
+func truncateError(message string) string {
+	if len(message) <= maxErrorLength {
+		return message
+	}
+	end := maxErrorLength
+	for end > 0 && !utf8.RuneStart(message[end]) {
+		end--
+	}
+	return message[:end]
+}
@@ -0,0 +1,136 @@
+// Package leader elects one app instance to run the background singletons: the embedding
+// fetcher, the digest scheduler and the periodic sync services. Running them on every replica
+// would do the same work several times (or, for the digest, race to send it).
+//
+// Election uses a session-level Postgres advisory lock, so no extra infrastructure is needed.
+// The leader holds the lock on a connection it keeps checked out of the pool; if that instance
+// dies, its session ends, Postgres releases the lock and another instance takes over on its
+// next attempt. In Nest.js terms this is a tiny distributed lock service, as one would otherwise
+// build with Redis (e.g. Redlock).
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// BackgroundLockID is the advisory lock that decides which instance runs the background
+	// singletons. It is distinct from the per-run locks those services may take themselves.
+	BackgroundLockID = 724100
+
+	// checkInterval is how often followers try to take over and the leader checks that its
+	// session is still alive. A takeover after the leader dies takes at most this long.
+	checkInterval = 15 * time.Second
+
+	// queryTimeout bounds a single lock or ping statement.
+	queryTimeout = 5 * time.Second
+)
+
+// Elector campaigns for one advisory lock until stopped. It is safe for concurrent use.
+type Elector struct {
+	pool   *pgxpool.Pool
+	lockID int64
+	logger *slog.Logger
+
+	leader atomic.Bool
+
+	mu   sync.Mutex
+	conn *pgxpool.Conn // Holds the lock while this instance leads; nil otherwise
+}
+
+// Start makes a first attempt right away, so a single instance leads from the start, then
+// keeps campaigning in the background until `stopChan` is closed, when the lock is released.
+// `name` only appears in logs, as the "election" field.
+func Start(pool *pgxpool.Pool, name string, lockID int64, stopChan <-chan struct{}) *Elector {
+	e := &Elector{pool: pool, lockID: lockID, logger: logging.For("leader").With("election", name)}
+	e.check()
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopChan:
+				e.resign()
+				return
+			case <-ticker.C:
+				e.check()
+			}
+		}
+	}()
+	return e
+}
+
+// IsLeader reports whether this instance currently holds the lock. Singletons check it before
+// each run; leadership can move between two runs.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// check confirms the leader's session or, on a follower, tries to take the lock.
+func (e *Elector) check() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if e.conn != nil {
+		err := e.conn.Ping(ctx)
+		if err == nil {
+			return
+		}
+		e.logger.Warn("Lost the database session, stepping down", "error", err)
+		// The session is gone or unusable; make sure it's closed so the lock is released.
+		e.conn.Conn().Close(ctx)
+		e.conn.Release()
+		e.conn = nil
+		e.leader.Store(false)
+		return
+	}
+
+	conn, err := e.pool.Acquire(ctx)
+	if err != nil {
+		e.logger.Error("Failed to acquire a connection", "error", err)
+		return
+	}
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, e.lockID).Scan(&acquired); err != nil {
+		e.logger.Error("Failed to try the lock", "error", err)
+		conn.Release()
+		return
+	}
+	if !acquired {
+		conn.Release()
+		return
+	}
+	e.conn = conn
+	e.leader.Store(true)
+	e.logger.Info("This instance is now the leader")
+}
+
+// resign releases the lock so another instance can take over without waiting for this
+// process to exit.
+func (e *Elector) resign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn == nil {
+		return
+	}
+	e.leader.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	if _, err := e.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, e.lockID); err != nil {
+		// Closing the session releases the lock just as well.
+		e.conn.Conn().Close(ctx)
+	}
+	e.conn.Release()
+	e.conn = nil
+	e.logger.Info("Resigned")
+}
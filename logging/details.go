@@ -0,0 +1,233 @@
+// Package logging, as part of the logging module.
+// This file, `details.go`, logs the details of chosen requests for debugging in production:
+// their headers, query and a sample of the request and response bodies, next to the method,
+// path, status and latency of the request log. The routes are picked with
+// LOG_REQUEST_DETAILS_ROUTES; every other request is only in the request log.
+//
+// Secrets are redacted before anything is logged: credentials headers such as Authorization
+// and Cookie, and the values of query parameters, form fields and JSON members whose names
+// look like a password, token or key. Multipart and binary bodies are described, not sampled.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// redacted replaces the value of a secret.
+const redacted = "[REDACTED]"
+
+// redactedHeaders are the headers whose values are never logged.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+	"X-Sudo-Token":        true,
+}
+
+// sensitiveName matches the names of query parameters, form fields and JSON members holding
+// secrets, e.g. "password", "new_password", "refresh_token", "sudoToken" or "api_key".
+var sensitiveName = regexp.MustCompile(`(?i)pass(word)?|token|secret|auth|api_?key|signature|^sig$|dsn|credential`)
+
+// jsonSecret matches a JSON string member with a sensitive name, for bodies that can't be
+// parsed because the sample cut them short.
+var jsonSecret = regexp.MustCompile(`(?i)("[^"]*(?:pass|token|secret|auth|api_?key|signature|dsn|credential)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// RequestDetails logs the details of the requests to the routes of `cfg.RequestDetailRoutes`,
+// with bodies sampled up to `cfg.RequestBodySample` bytes. A route is a chi route pattern such
+// as "/api/v1/comments/{commentID}", or a prefix ending in "*", such as "/api/v1/auth/*"; "*"
+// alone selects every route. Without routes, it returns the handler unchanged.
+func RequestDetails(logger *slog.Logger, cfg *config.LogConfig) func(http.Handler) http.Handler {
+	routes := cfg.RequestDetailRoutes
+	if len(routes) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	sample := cfg.RequestBodySample
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The route is only known once the request is routed, so every request is sampled
+			// and the sample thrown away if its route isn't selected.
+			reqBody := &sampleBuffer{limit: sample}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+			}
+			respBody := &sampleBuffer{limit: sample}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(respBody)
+			start := time.Now()
+			next.ServeHTTP(ww, r)
+
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			if !routeSelected(routes, route) {
+				return
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "Request details",
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.String("path", r.URL.Path),
+				slog.String("query", redactQuery(r.URL.RawQuery)),
+				slog.Int("status", status),
+				slog.Duration("duration", time.Since(start)),
+				slog.Any("request_headers", redactHeaders(r.Header)),
+				slog.String("request_body", describeBody(r.Header.Get("Content-Type"), reqBody)),
+				slog.Any("response_headers", redactHeaders(ww.Header())),
+				slog.String("response_body", describeBody(ww.Header().Get("Content-Type"), respBody)),
+			)
+		})
+	}
+}
+
+// routeSelected checks `route` against the selected patterns and prefixes.
+func routeSelected(routes []string, route string) bool {
+	if route == "" {
+		return false
+	}
+	for _, pattern := range routes {
+		if pattern == route || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(route, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleBuffer keeps the first `limit` bytes written to it and counts the rest.
+type sampleBuffer struct {
+	limit int
+	buf   bytes.Buffer
+	total int
+}
+
+func (b *sampleBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// truncated reports whether the sample misses part of the body.
+func (b *sampleBuffer) truncated() bool {
+	return b.total > b.buf.Len()
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// redactHeaders returns the headers, one value per name, with credentials redacted.
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if redactedHeaders[name] {
+			out[name] = redacted
+			continue
+		}
+		out[name] = strings.Join(values, ", ")
+	}
+	return out
+}
+
+// redactQuery returns a raw query string with the values of sensitive parameters redacted.
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return redacted // Can't tell the secrets apart
+	}
+	redactValues(values)
+	return strings.ReplaceAll(values.Encode(), url.QueryEscape(redacted), redacted)
+}
+
+func redactValues(values url.Values) {
+	for name := range values {
+		if sensitiveName.MatchString(name) {
+			values[name] = []string{redacted}
+		}
+	}
+}
+
+// describeBody returns the sample of a body for the log, redacted according to its type.
+func describeBody(contentType string, b *sampleBuffer) string {
+	if b.total == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var text string
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		text = redactJSON(b.buf.Bytes(), b.truncated())
+	case mediaType == "application/x-www-form-urlencoded":
+		text = redactQuery(b.buf.String())
+		if b.truncated() {
+			text = redacted // The cut may hide a field name
+		}
+	case mediaType == "" || strings.HasPrefix(mediaType, "text/"):
+		text = b.buf.String()
+	default:
+		// Multipart uploads, images and archives: only the size and type.
+		return mediaType + ", " + byteCount(b.total)
+	}
+	if b.truncated() {
+		text += "... (" + byteCount(b.total) + " in all)"
+	}
+	return text
+}
+
+// redactJSON redacts the sensitive members of a JSON document, wherever they are nested. A
+// document cut short by the sample is redacted by pattern instead.
+func redactJSON(data []byte, truncated bool) string {
+	var doc any
+	if truncated || json.Unmarshal(data, &doc) != nil {
+		return jsonSecret.ReplaceAllString(string(data), `${1}"`+redacted+`"`)
+	}
+	redactDocument(doc)
+	out, _ := json.Marshal(doc)
+	return string(out)
+}
+
+func redactDocument(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, member := range v {
+			if sensitiveName.MatchString(key) {
+				v[key] = redacted
+			} else {
+				redactDocument(member)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			redactDocument(item)
+		}
+	}
+}
+
+func byteCount(n int) string {
+	return strconv.Itoa(n) + " bytes"
+}
@@ -0,0 +1,109 @@
+// Package logging sets up the structured logger the application writes to. main calls Setup
+// once the configuration is loaded; from then on every component logs through `log/slog`,
+// as text lines for a terminal or as JSON objects for a log collector, and drops the records
+// below LOG_LEVEL. Messages still written with the standard `log` package go through the
+// same handler, at the info level.
+//
+// Each component takes its logger from For when it is created, so its records carry a
+// "component" field and can be filtered on it:
+//
+//	logger := logging.For("jobs")
+//	logger.Info("Job finished", "job_id", job.ID, "type", job.Type)
+//
+// Records logged with the context of a request, through the `...Context` methods or LogAttrs,
+// also carry its "request_id", the one error responses show to the client.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// Setup makes a logger configured by `cfg` the default one, writing to standard error.
+func Setup(cfg *config.LogConfig) *slog.Logger {
+	logger := New(cfg, os.Stderr)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New returns a logger writing to `w` in the format and at the level of `cfg`.
+func New(cfg *config.LogConfig, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.Level, AddSource: cfg.AddSource}
+	if cfg.Format == config.LogFormatJSON {
+		return slog.New(requestIDHandler{slog.NewJSONHandler(w, opts)})
+	}
+	return slog.New(requestIDHandler{slog.NewTextHandler(w, opts)})
+}
+
+// requestIDHandler adds the request ID of the context, if any, to the records.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := middleware.GetReqID(ctx); id != "" {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// For returns the logger of a component. It must be called after Setup, typically in the
+// component's constructor, since it captures the default logger of the moment.
+func For(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
+
+// RequestLogger logs each HTTP request once it has been served: method, path, status, size,
+// duration, request ID and client address. It also sends the request ID back in the
+// X-Request-Id header, so a client can quote it when reporting a problem. Server errors are logged at the error level,
+// client errors at the warn level, the rest at the info level.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			if id := middleware.GetReqID(r.Context()); id != "" {
+				w.Header().Set(middleware.RequestIDHeader, id)
+			}
+			start := time.Now()
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					// Nothing was written; net/http answers 200.
+					status = http.StatusOK
+				}
+				level := slog.LevelInfo
+				switch {
+				case status >= 500:
+					level = slog.LevelError
+				case status >= 400:
+					level = slog.LevelWarn
+				}
+				logger.LogAttrs(r.Context(), level, "Request served",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.Int("status", status),
+					slog.Int("bytes", ww.BytesWritten()),
+					slog.Duration("duration", time.Since(start)),
+					slog.String("remote_addr", r.RemoteAddr),
+				)
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
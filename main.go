@@ -22,22 +22,23 @@ package main
 
 // Standard library imports
 import (
-	// `_ "github.com/user/lensisku-go/docs"` imports the generated Swagger docs package
-	// for its side effect: registering the Swagger spec. The underscore `_` indicates
-	// that the package is imported only for these side effects, and its exported names
-	// are not directly used in this file.
-	"context"       // Moved for standard library grouping
-	"encoding/json" // for local writeError
-	"fmt"
+	// `github.com/user/lensisku-go/docs` is the generated Swagger docs package. Importing it
+	// registers the Swagger spec the UI serves; with OPENAPI_VALIDATION, the same spec is
+	// checked against at runtime.
+	"context" // Moved for standard library grouping
+	"flag"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	httpSwagger "github.com/swaggo/http-swagger"
-	_ "github.com/user/lensisku-go/docs" // Generated Swagger docs
+	"github.com/user/lensisku-go/docs" // Generated Swagger docs
 
 	// Third-party libraries
 	// `chi` is a lightweight, idiomatic and composable router for building HTTP services in Go.
@@ -46,17 +47,40 @@ import (
 
 	// `chi/cors` provides CORS (Cross-Origin Resource Sharing) middleware.
 	"github.com/go-chi/cors"
+	"github.com/jackc/pgx/v5/pgxpool"
 	// `godotenv` loads environment variables from a .env file, useful for development.
 	"github.com/joho/godotenv"
+	// `promhttp` serves the Prometheus metrics registered by the application.
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	// Internal application packages (modules)
+	"github.com/user/lensisku-go/app" // Modules of the API and what they are built from
 	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/audit" // Audit log of privileged and destructive actions
 	"github.com/user/lensisku-go/auth"
 	"github.com/user/lensisku-go/background" // For background embedding service
-	"github.com/user/lensisku-go/comments"   // Import for comments feature
+	"github.com/user/lensisku-go/bodylimit"  // Request body size limits
+	"github.com/user/lensisku-go/cache"      // Shared Redis client
 	"github.com/user/lensisku-go/config"
 	"github.com/user/lensisku-go/db"
-	"github.com/user/lensisku-go/users" // Import for user profile management
+	"github.com/user/lensisku-go/db/seed"   // Development fixtures for the `seed` subcommand
+	"github.com/user/lensisku-go/embedding" // Embedding providers for semantic search
+	"github.com/user/lensisku-go/errreport" // Error reports to Sentry
+	"github.com/user/lensisku-go/flags"     // Feature flags switched by admins
+	"github.com/user/lensisku-go/health"    // Health check with database pool statistics
+	"github.com/user/lensisku-go/jbovlaste" // Progress streaming for long-running admin tasks
+	"github.com/user/lensisku-go/jobs"      // Durable background job queue
+	"github.com/user/lensisku-go/leader"    // Picks the instance that runs background singletons
+	"github.com/user/lensisku-go/logging"   // Structured logger and request log
+	"github.com/user/lensisku-go/metrics"   // Prometheus metrics of the HTTP server
+	"github.com/user/lensisku-go/openapi"   // Runtime checks against the Swagger spec
+	"github.com/user/lensisku-go/preflight" // Configuration self-check for `lensisku check`
+	"github.com/user/lensisku-go/quota"
+	"github.com/user/lensisku-go/render"    // Response encodings picked by the Accept header
+	"github.com/user/lensisku-go/storage"   // File storage for uploads (avatars)
+	"github.com/user/lensisku-go/tlsserver" // TLS termination and the HTTPS redirect
+	"github.com/user/lensisku-go/tracing"   // OpenTelemetry spans exported over OTLP
+	"github.com/user/lensisku-go/users"     // Import for user profile management
 )
 
 // `main` is the entry point function for the executable.
@@ -68,58 +92,185 @@ func main() {
 		log.Printf("Warning: .env file not found or error loading it: %v", err)
 	}
 
+	// `lensisku check [-format text|json]` validates the configuration and the services it
+	// names, prints a report and exits, without starting the server (see `preflight`).
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		flags := flag.NewFlagSet("check", flag.ExitOnError)
+		format := flags.String("format", "text", "report format: text or json")
+		flags.Parse(os.Args[2:])
+		report := preflight.Run(context.Background())
+		var err error
+		if *format == "json" {
+			err = report.WriteJSON(os.Stdout)
+		} else {
+			err = report.WriteText(os.Stdout)
+		}
+		if err != nil || !report.OK {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Load application configuration using the `config` package.
 	// `cfg` will hold all configuration settings (database, auth, server).
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	// From here on, everything is logged through the structured logger LOG_LEVEL and LOG_FORMAT
+	// configure; the messages above went to the standard logger.
+	logging.Setup(cfg.Log)
+	logger := logging.For("main")
+	logger.Info("Configuration loaded", "environment", cfg.Env)
+	// Spans go to the OTLP collector of OTEL_EXPORTER_OTLP_ENDPOINT, if set.
+	shutdownTracing := tracing.Setup(cfg.Tracing, cfg.Env)
+
+	// Server errors and panics go to Sentry, or a compatible service, when SENTRY_DSN is set.
+	var reporter *errreport.Sentry
+	if cfg.ErrorReporting.DSN != "" {
+		reporter, err = errreport.NewSentry(cfg.ErrorReporting)
+		if err != nil {
+			fatal(logger, "Failed to initialize error reporting", err)
+		}
+		apperror.SetReporter(reporter)
+		logger.Info("Error reporting enabled", "environment", cfg.ErrorReporting.Environment)
+	}
 
 	// Initialize database connection pools using the loaded configuration.
-	// `appPool` for general application use, `importPool` for specific import tasks.
-	appPool, importPool, err := db.NewDBPools(cfg.DBPools)
+	// `appDB` for general application use, `importPool` for specific import tasks.
+	// `appPool` is the primary behind `appDB`; read-only lookups that tolerate replication lag
+	// go through `appDB`, which sends them to a read replica when one is configured.
+	appDB, importPool, err := db.NewDBPools(cfg.DBPools)
 	if err != nil {
-		// `log.Fatalf` prints the message and exits the application.
-		log.Fatalf("Failed to create database pools: %v", err)
+		// `fatal` logs the error and exits the application.
+		fatal(logger, "Failed to create database pools", err)
 	}
-	defer appPool.Close()
+	defer appDB.Close()
 	defer importPool.Close()
+	appPool := appDB.Primary()
+
+	// Sample both pools for the /metrics gauges and the health check.
+	poolMonitor := db.NewPoolMonitor(map[string]*pgxpool.Pool{"app": appPool, "import": importPool}, cfg.DBPools.PoolStatsInterval)
+	defer poolMonitor.Close()
 
-	// Enable required PostgreSQL extensions using import pool
-	if err := db.EnableExtensions(importPool); err != nil {
-		log.Fatalf("Failed to enable extensions: %v", err)
+	// `lensisku seed` loads fixtures instead of serving, so it has no use for degraded mode.
+	seeding := len(os.Args) > 1 && os.Args[1] == "seed"
+
+	// Wait for the database, then enable required PostgreSQL extensions using import pool.
+	// With DB_START_DEGRADED, an unreachable database doesn't stop the server: this carries on
+	// in the background, and /ready reports not ready meanwhile.
+	readiness, err := db.WaitForDatabase(
+		map[string]*pgxpool.Pool{"app": appPool, "import": importPool},
+		func(ctx context.Context) error { return db.EnableExtensions(importPool) },
+		cfg.DBPools.StartDegraded && !seeding, cfg.DBPools.ConnectRetryMaxInterval)
+	if err != nil {
+		fatal(logger, "Failed to prepare the database", err)
 	}
+	defer readiness.Close()
+
+	// Shared Redis client, when REDIS_URL is set. Features that can use it fall back to
+	// Postgres or memory without it.
+	var redisClient *cache.Redis
+	if cfg.Redis.URL != "" {
+		redisCtx, redisCancel := context.WithTimeout(context.Background(), cfg.Redis.DialTimeout+cfg.Redis.CommandTimeout)
+		redisClient, err = cache.NewRedis(redisCtx, cfg.Redis)
+		redisCancel()
+		if err != nil {
+			fatal(logger, "Failed to connect to Redis", err)
+		}
+		defer redisClient.Close()
+		logger.Info("Connected to Redis")
+	}
+	// Cached trending lists, word of the day and public profiles, in Redis or in memory.
+	cacheStore := cache.NewStore(redisClient)
 
 	// Run database migrations. This section is currently commented out.
 	// Migrations ensure the database schema is up-to-date with the application's requirements.
 	// Migrations disabled
 	// if err := db.RunMigrations(importPool, "./migrations"); err != nil {
-	// 	log.Fatalf("Failed to run migrations: %v", err)
+	// 	fatal(logger, "Failed to run migrations", err)
 	// }
 
+	// `lensisku seed` loads the development fixtures into a fresh database (see `db/seed`)
+	// and exits instead of serving.
+	if seeding {
+		res, err := seed.Run(context.Background(), appPool)
+		if err != nil {
+			fatal(logger, "Failed to seed the database", err)
+		}
+		logger.Info("Database seeded", "users", res.Users, "words", res.Words, "definitions", res.Definitions,
+			"threads", res.Threads, "comments", res.Comments, "password", seed.Password)
+		return
+	}
+
 	// Start background embedding calculator
 	// ELI5: This is like starting a separate, continuously running helper factory (our embedding service)
 	// that will do its work in the background. We give it a way to connect to the database (appPool)
 	// and a special signal (embeddingStopChan) to tell it when to shut down.
 	// `embeddingStopChan` is a channel used to signal the background service to stop gracefully.
 	embeddingStopChan := make(chan struct{})
-	background.StartEmbeddingCalculatorService(appPool, embeddingStopChan) // This function launches its own goroutines internally
-	log.Println("Background embedding calculator service initiated.")
+	embedder, err := embedding.New(cfg.Embedding)
+	if err != nil {
+		fatal(logger, "Failed to initialize embedding provider", err)
+	}
+	// With several replicas, only the elected leader runs the background singletons below (the
+	// embedding fetcher, the periodic syncs and the digest scheduler).
+	elector := leader.Start(appPool, "background", leader.BackgroundLockID, embeddingStopChan)
 
-	// Initialize auth service
+	// `embeddingCalculator` stays nil when no provider is configured; its admin routes are skipped then.
+	var embeddingCalculator *background.EmbeddingCalculator
+	if embedder != nil {
+		embeddingCalculator = background.StartEmbeddingCalculatorService(appPool, embedder, cfg.Embedding, elector, embeddingStopChan) // This function launches its own goroutines internally
+		logger.Info("Background embedding calculator service initiated", "provider", cfg.Embedding.Provider, "model", embedder.Model())
+	} else {
+		logger.Info("Embedding provider is \"none\"; background embedding calculator not started")
+	}
+
+	// Reaction points are kept current by database triggers; accepted definitions are synced periodically.
+	// It shares the embedding service's stop channel, so both stop together on shutdown.
+	background.StartReputationService(appPool, elector, embeddingStopChan)
+	// Cached comment and hashtag counters are recomputed from their source tables every hour.
+	background.StartCounterReconciliationService(appPool, elector, embeddingStopChan)
+	// Comments and reactions are partitioned by month; next months' partitions are created ahead of time.
+	background.StartCommentPartitionService(appPool, cfg.Partitions, elector, embeddingStopChan)
+
+	// Core services, shared by several modules.
 	// Services encapsulate business logic. They are instantiated here and their dependencies (like db pool, config) are injected.
 	// This is manual dependency injection, common in Go. Nest.js uses a DI container.
 	authService := auth.NewAuthService(appPool, *cfg.Auth) // Dereference cfg.Auth
-	// Handlers (controllers) use services to process requests.
-	authHandlers := auth.NewHandlers(authService)
 
-	// Initialize user service and handlers
-	userService := users.NewUserService(appPool)
-	userHandlers := users.NewUserHandlers(userService)
+	// File storage for uploads. The service only sees the `storage.Storage` interface.
+	fileStore, err := storage.New(cfg.Storage)
+	if err != nil {
+		fatal(logger, "Failed to initialize storage", err)
+	}
+	userService := users.NewUserService(appPool, fileStore, cfg.Storage, cfg.Users)
+	userService.UseCache(cacheStore.Cache("public_profile", cfg.Cache.ProfileTTL))
+
+	// Daily API quotas. The middleware needs the user from the JWT, so it runs after JWTMiddleware.
+	quotaService := quota.NewService(appPool, cfg.Quota)
 
-	// Initialize comments service and handlers, following the same pattern.
-	commentService := comments.NewCommentService(appPool)
-	commentHandlers := comments.NewCommentHandler(commentService)
+	// Durable job queue. Workers run the handlers the modules register; jobs of other types stay queued.
+	jobQueue := jobs.NewQueue(appPool)
+	jobWorker := jobs.NewWorker(jobQueue, cfg.Jobs)
+	// Verification emails go through the queue; their links are signed like digest unsubscribe links.
+	userService.UseEmail(jobQueue, cfg.Server.PublicBaseURL, cfg.Auth.JWTSecret)
+
+	// Administration, moderation and imports are audited.
+	auditLog := audit.NewLog(appPool)
+	// Feature flags admins switch at runtime, cached like the other hot reads.
+	flagService := flags.NewFlagService(appPool, cacheStore.Cache("feature_flags", cfg.Cache.FlagsTTL))
+
+	// Long-running admin tasks (re-embedding campaigns, dictionary imports) stream their progress through `broadcaster`; its heartbeat pings open streams and drops stale clients.
+	broadcaster := jbovlaste.NewBroadcaster()
+	// Replicas share task progress and cancellation through Postgres notifications or Redis Pub/Sub.
+	switch cfg.Events.Backend {
+	case "postgres":
+		broadcaster.UseRelay(jbovlaste.NewPostgresRelay(appPool, cfg.Events.Channel), embeddingStopChan)
+	case "redis":
+		broadcaster.UseRelay(jbovlaste.NewRedisRelay(redisClient, cfg.Events.Channel), embeddingStopChan)
+	}
+	broadcaster.StartHeartbeat(embeddingStopChan)
 
 	// Create router and configure middleware
 	// `chi.NewRouter()` creates a new Chi router instance.
@@ -132,43 +283,91 @@ func main() {
 
 	// IMPORTANT: Chi requires all middleware to be registered before any routes
 	// Global middleware
-	// `middleware.Logger` logs incoming requests.
-	r.Use(middleware.Logger) // Log all requests
+	r.Use(middleware.RequestID) // Add request ID to context
+	r.Use(middleware.RealIP)    // Get real IP from proxy headers
+	// `tracing.Middleware` opens the server span of each request, parent of every span below.
+	r.Use(tracing.Middleware())
+	// `metrics.HTTPMiddleware` counts and times the requests by route and status for /metrics.
+	r.Use(metrics.HTTPMiddleware())
+	// `logging.RequestLogger` logs each request, with the request ID and real IP set above.
+	r.Use(logging.RequestLogger(logging.For("http"))) // Log all requests
+	r.Use(logging.RequestDetails(logging.For("http"), cfg.Log))
 	// `middleware.Recoverer` recovers from panics in handlers and returns a 500 error.
-	r.Use(middleware.Recoverer)                 // Recover from panics
-	r.Use(middleware.RequestID)                 // Add request ID to context
-	r.Use(middleware.RealIP)                    // Get real IP from proxy headers
-	r.Use(middleware.Timeout(60 * time.Second)) // Timeout long-running requests
+	r.Use(middleware.Recoverer) // Recover from panics
+	// Timeout long-running requests. Event streams stay open until the client goes away.
+	if cfg.Server.RequestTimeout > 0 {
+		r.Use(middleware.Maybe(middleware.Timeout(cfg.Server.RequestTimeout), func(r *http.Request) bool {
+			return !strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+		}))
+	}
+	// With OPENAPI_VALIDATION, requests and responses are checked against the Swagger spec. It
+	// reads request bodies up front, so it goes before the body limits.
+	if cfg.Server.APIValidation != config.APIValidationOff {
+		apiSpec, err := openapi.Parse([]byte(docs.SwaggerInfo.ReadDoc()))
+		if err != nil {
+			fatal(logger, "Failed to load the OpenAPI spec", err)
+		}
+		r.Use(openapi.Middleware(apiSpec, cfg.Server.APIValidation))
+		logger.Info("OpenAPI validation enabled", "mode", cfg.Server.APIValidation)
+	}
+	// Bound request bodies to HTTP_MAX_BODY_BYTES; uploads, imports, comments and the auth
+	// routes override the limit in their modules.
+	r.Use(bodylimit.Middleware(cfg.Server.MaxBodyBytes))
+	// Database time per request, by route; requests over DB_REQUEST_QUERY_BUDGET are logged.
+	r.Use(db.QueryBudgetMiddleware(cfg.DBPools.QueryBudget))
 
-	// CORS middleware configuration
+	// CORS middleware configuration, from the CORS_* settings (see `config.CORSConfig`).
 	r.Use(cors.Handler(cors.Options{
-		// `AllowedOrigins: []string{"*"}` allows requests from any origin. For production, this should be restricted.
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		AllowCredentials: true,
-		MaxAge:           300,
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.Server.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Server.CORS.AllowedHeaders,
+		ExposedHeaders:   []string{"ETag", "Link", middleware.RequestIDHeader},
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           int(cfg.Server.CORS.MaxAge.Seconds()),
 	}))
 
 	// Error handling middleware
 	// This is a custom middleware for more fine-grained panic recovery and error logging,
 	// potentially integrating with the `apperror` system.
+	// Panics are also sent to the error-reporting service, with the user the authentication
+	// middleware records in the report scope.
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ctx, _ := apperror.WithReportScope(r.Context())
+			r = r.WithContext(ctx)
 			// `defer func() { ... }()` with `recover()` is a common Go pattern for panic handling.
 			defer func() {
 				// Recover from panics and convert to 500 error
 				if rvr := recover(); rvr != nil {
-					log.Printf("Panic: %+v", rvr)
+					logger.ErrorContext(r.Context(), "Panic", "panic", rvr)
+					apperror.ReportPanic(r, rvr)
 					err := apperror.NewInternalError("internal server error", nil)
-					writeError(ww, err)
+					writeError(ww, r, err)
 				}
 			}()
 			next.ServeHTTP(ww, r)
 		})
 	})
 
+	// Cookie sessions (AUTH_COOKIE_SESSIONS) must repeat their CSRF token on every request that
+	// changes something; bearer tokens pass as before. The digest unsubscribe form is authorized
+	// by the signed token in its link, and is posted by browsers that may hold a session.
+	r.Use(auth.CSRFMiddleware(cfg.Auth, "/digest/unsubscribe"))
+
+	// Health check and Prometheus metrics, outside /api/v1 where load balancers and scrapers
+	// expect them. With METRICS_ADDR set, the metrics are served by an internal server instead
+	// (see below).
+	healthHandlers := health.NewHealthHandlers(appPool, poolMonitor, readiness)
+	if redisClient != nil {
+		healthHandlers.UseRedis(redisClient)
+	}
+	r.Get("/health", healthHandlers.HandleHealth())
+	r.Get("/ready", healthHandlers.HandleReady())
+	if cfg.Server.MetricsAddr == "" {
+		r.Handle("/metrics", promhttp.Handler())
+	}
+
 	// Swagger UI endpoint
 	// `httpSwagger.Handler` serves the Swagger UI, using the documentation generated by `swaggo/swag`.
 	// `/swagger/doc.json` is the conventional path for the OpenAPI spec JSON file.
@@ -176,60 +375,85 @@ func main() {
 		httpSwagger.URL("/swagger/doc.json"),
 	))
 
-	// Auth routes
-	// `r.Route("/auth", ...)` groups routes under the "/auth" prefix.
-	// This is similar to defining a controller with a base path in Nest.js.
-	r.Route("/auth", func(r chi.Router) {
-		// `r.Post(...)` maps HTTP POST requests to the specified path to the handler function.
-		r.Post("/register", authHandlers.HandleRegister())
-		r.Post("/login", authHandlers.HandleLogin())
-		r.Post("/refresh", authHandlers.HandleRefreshToken())
-	})
-
-	// User profile routes (protected by JWT middleware)
-	// These routes are grouped under "/users".
-	r.Route("/users", func(r chi.Router) {
-		// `r.Use(auth.JWTMiddleware(cfg.Auth))` applies the JWT authentication middleware
-		// specifically to this group of routes. Only authenticated users can access these.
-		// This is analogous to applying an AuthGuard to a controller or specific routes in Nest.js.
-		// Apply JWT middleware to all routes in this group
-		r.Use(auth.JWTMiddleware(cfg.Auth)) // cfg.Auth contains JWTSecret
-
-		r.Get("/me", userHandlers.HandleGetUserProfile())
-		r.Put("/me", userHandlers.HandleUpdateUserProfile())
-	})
-
-	// Comments routes
-	// These routes are grouped under "/api/v1/comments".
-	// The `/api/v1` prefix is a common practice for versioning APIs.
-	r.Route("/api/v1/comments", func(r chi.Router) { // Using /api/v1 prefix for consistency
-		// Apply JWT middleware to all routes in this group
-		// This ensures that comment-related actions require authentication.
-		r.Use(auth.JWTMiddleware(cfg.Auth))
-		commentHandlers.RegisterRoutes(r) // Register comment specific routes
-	})
+	// The parts of the API (auth, users, notifications, dictionary, comments, admin) are
+	// modules; each builds its services from `deps` and mounts its own routes (see `app`).
+	deps := &app.Deps{
+		Config:              cfg,
+		DB:                  appDB,
+		Pool:                appPool,
+		ImportPool:          importPool,
+		Redis:               redisClient,
+		Cache:               cacheStore,
+		Stop:                embeddingStopChan,
+		Elector:             elector,
+		Embedder:            embedder,
+		EmbeddingCalculator: embeddingCalculator,
+		Jobs:                jobQueue,
+		Worker:              jobWorker,
+		Broadcaster:         broadcaster,
+		Audit:               auditLog,
+		Auth:                authService,
+		Users:               userService,
+		Quota:               quotaService,
+		Flags:               flagService,
+	}
+	if err := app.Mount(r, deps, app.Modules()...); err != nil {
+		fatal(logger, "Failed to set up the API", err)
+	}
+	// The modules registered their job handlers; the workers can start.
+	jobWorker.Start(embeddingStopChan)
 
-	addr := fmt.Sprintf(":%s", cfg.Server.Port)
+	addr := net.JoinHostPort(cfg.Server.BindAddress, cfg.Server.Port)
 
 	// Create server with graceful shutdown
 	// `http.Server` provides more control over server behavior than `http.ListenAndServe`.
 	srv := &http.Server{
-		Addr:         addr,
-		Handler:      r,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:              addr,
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
 	}
 
 	// Start server in goroutine
 	// The server is started in a separate goroutine so that the main goroutine can continue
 	// to listen for shutdown signals.
+	// With TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS, it terminates TLS itself and speaks HTTP/2.
+	tlsSrv := tlsserver.New(srv, cfg.Server.TLS)
 	go func() {
-		log.Printf("Server starting on %s", addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+		logger.Info("Server starting", "addr", addr, "tls", cfg.Server.TLS.Enabled())
+		if err := tlsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal(logger, "Failed to start server", err)
 		}
 	}()
+	// The HTTP to HTTPS redirect, on TLS_REDIRECT_ADDR.
+	redirectSrv := tlsSrv.RedirectServer()
+	if redirectSrv != nil {
+		go func() {
+			logger.Info("HTTPS redirect server starting", "addr", redirectSrv.Addr)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal(logger, "Failed to start HTTPS redirect server", err)
+			}
+		}()
+	}
+	// The internal metrics server, for scrapers on a network the public port isn't open to.
+	var metricsSrv *http.Server
+	if cfg.Server.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		metricsSrv = &http.Server{
+			Addr:              cfg.Server.MetricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		}
+		go func() {
+			logger.Info("Metrics server starting", "addr", cfg.Server.MetricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal(logger, "Failed to start metrics server", err)
+			}
+		}()
+	}
 	// Wait for interrupt signal
 	// This section handles graceful shutdown of the server.
 	// ELI5: This part of the code is like having an ear to the ground, listening for a special signal
@@ -243,7 +467,7 @@ func main() {
 
 	// Graceful shutdown
 	// ELI5: Once we get the "stop" signal, we don't just crash. We try to finish up neatly.
-	log.Println("Server shutting down...")
+	logger.Info("Server shutting down")
 	// We create a "context" with a timeout. This is like saying, "Try to shut down within 30 seconds.
 	// If it takes longer, we might have to force it."
 	// `context.WithTimeout` creates a context that will be cancelled after the specified duration.
@@ -255,32 +479,63 @@ func main() {
 	// The `embeddingStopChan` was given to the background service when it started.
 	// `close(channel)` is a special way to signal all listeners on that channel that no more
 	// values will be sent and it's time to wrap up. The background service is designed to listen for this.
-	log.Println("Signaling background embedding service to stop...")
+	logger.Info("Signaling background services to stop")
 	close(embeddingStopChan)
 	// Note: StartEmbeddingCalculatorService is designed for graceful shutdown internally.
-	// It will see the `embeddingStopChan` is closed and start its own cleanup.
-	// We might want to add a timeout/wait here if main needs to ensure the background service
-	// has fully stopped before the server itself stops, but for now, we just signal.
-	// The background service uses WaitGroups to ensure its goroutines finish.
+	// It will see the `embeddingStopChan` is closed and start its own cleanup; we wait for that
+	// cleanup below, after the HTTP server has stopped.
 
 	// `srv.Shutdown(ctx)` attempts to gracefully shut down the HTTP server.
 	// Now, tell the main web server (`srv`) to shut down gracefully.
 	// It will try to finish handling any ongoing requests before stopping.
 	if err := srv.Shutdown(ctx); err != nil { // Pass the timeout context.
-		log.Fatalf("Server shutdown failed: %v", err) // If shutdown itself fails.
+		fatal(logger, "Server shutdown failed", err) // If shutdown itself fails.
+	}
+	logger.Info("Server stopped gracefully")
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			logger.Warn("Metrics server did not stop cleanly", "error", err)
+		}
+	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			logger.Warn("HTTPS redirect server did not stop cleanly", "error", err)
+		}
+	}
+
+	// Wait for the embedding calculator to store the results it's still working on, within
+	// what's left of the shutdown timeout.
+	if embeddingCalculator != nil {
+		if err := embeddingCalculator.Stop(ctx); err != nil {
+			logger.Warn("Background embedding service did not stop cleanly", "error", err)
+		} else {
+			logger.Info("Background embedding service stopped")
+		}
+	}
+
+	// Send the error reports and spans still queued.
+	if reporter != nil {
+		if err := reporter.Close(ctx); err != nil {
+			logger.Warn("Error reports left unsent", "error", err)
+		}
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("Spans left unexported", "error", err)
 	}
-	log.Println("Server stopped gracefully")
+}
+
+// fatal logs `err` and exits, as `log.Fatalf` does for the standard logger.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
 }
 
 // writeError is a local helper for the panic recovery middleware.
 // It's kept separate to avoid import cycles if apperror needed to import main or vice-versa.
 // This function ensures that panic errors are also formatted using the `apperror` system.
-func writeError(w http.ResponseWriter, appErr *apperror.AppError) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(appErr.StatusCode())
-	// Encode the `AppError`'s `ErrorResponse` representation to JSON.
-	if err := json.NewEncoder(w).Encode(appErr.ToResponse()); err != nil {
-		// Fallback if JSON encoding fails
-		http.Error(w, `{"error":"Failed to encode error response"}`, http.StatusInternalServerError)
-	}
+func writeError(w http.ResponseWriter, r *http.Request, appErr *apperror.AppError) {
+	// Write the `AppError`'s `ErrorResponse` representation in the encoding the client accepts.
+	resp := appErr.ToResponse()
+	resp.RequestID = middleware.GetReqID(r.Context())
+	render.Write(w, r, appErr.StatusCode(), resp)
 }
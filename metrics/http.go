@@ -0,0 +1,79 @@
+// Package metrics records the Prometheus metrics of the HTTP server. The database and job
+// metrics are registered by their own packages (see `db/poolstats.go`, `db/budget.go` and
+// `jobs/metrics.go`); all of them end up in the default registry, which `/metrics` serves.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HTTPMiddleware counts the requests and observes their duration, labeled with the method, the
+// route and the response status. A request's route is only known once it is routed, so the
+// in-flight gauge has no route label. Scrapes of `/metrics` are not counted. It registers its
+// metrics with the default Prometheus registry, so it is created once.
+func HTTPMiddleware() func(http.Handler) http.Handler {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lensisku",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Requests served, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "lensisku",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time to serve each request, by method, route and status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"method", "route", "status"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "lensisku",
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Requests being served.",
+	})
+	prometheus.MustRegister(requests, duration, inFlight)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			inFlight.Inc()
+			defer inFlight.Dec()
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			// Unmatched paths share one label, so scanners can't grow the series without bound.
+			route := "unmatched"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK // Nothing written: net/http answers 200
+			}
+			labels := prometheus.Labels{"method": methodLabel(r.Method), "route": route, "status": strconv.Itoa(status)}
+			requests.With(labels).Inc()
+			duration.With(labels).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// methodLabel returns the method, or "other" for a method outside the standard ones, which a
+// client may make up at will.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
@@ -0,0 +1,23 @@
+-- Roles gate who may hand out invites. Existing accounts default to plain users.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS invite_codes (
+    id          SERIAL PRIMARY KEY,
+    code        TEXT NOT NULL UNIQUE,
+    created_by  INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    max_uses    INTEGER NOT NULL CHECK (max_uses > 0),
+    uses        INTEGER NOT NULL DEFAULT 0,
+    note        TEXT,
+    expires_at  TIMESTAMPTZ,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_invite_codes_created_by ON invite_codes (created_by);
+
+-- One row per accepted invite, so every registration can be attributed to its inviter.
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+    invite_id   INTEGER NOT NULL REFERENCES invite_codes(id) ON DELETE CASCADE,
+    user_id     INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    redeemed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (invite_id, user_id)
+);
@@ -0,0 +1,3 @@
+-- Records which authentication backend owns an account ("local", "ldap", ...).
+-- Accounts provisioned from an external directory cannot log in with a local password.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_source TEXT NOT NULL DEFAULT 'local';
@@ -0,0 +1,3 @@
+-- Public URLs of the resized avatar images, keyed by pixel size ("32", "64", ...).
+-- NULL means the user has not uploaded an avatar.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_urls JSONB;
@@ -0,0 +1,14 @@
+-- Every username change leaves a row behind. Old names resolve to the account's current
+-- profile, and `reserved_until` keeps other accounts from claiming an abandoned name
+-- while links to it may still be circulating.
+CREATE TABLE IF NOT EXISTS username_history (
+    id              SERIAL PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    old_username    TEXT NOT NULL,
+    new_username    TEXT NOT NULL,
+    changed_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    reserved_until  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_username_history_old_username ON username_history (LOWER(old_username), changed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_username_history_user_id ON username_history (user_id, changed_at DESC);
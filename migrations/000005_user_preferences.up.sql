@@ -0,0 +1,9 @@
+-- Per-user preferences as key/value pairs. Only keys known to the server are accepted;
+-- keys without a row fall back to the configured defaults.
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id     INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    key         TEXT NOT NULL,
+    value       JSONB NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, key)
+);
@@ -0,0 +1,11 @@
+-- Directed follow relationships between users. The home feed includes comments by followed users.
+CREATE TABLE IF NOT EXISTS user_follows (
+    follower_id  INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    followee_id  INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+-- The primary key serves "who do I follow"; this index serves "who follows me".
+CREATE INDEX IF NOT EXISTS idx_user_follows_followee ON user_follows (followee_id, created_at DESC);
@@ -0,0 +1,13 @@
+-- Blocks and mutes, one row per (blocker, blocked) pair.
+--   mute:  the muted user's comments are hidden from the muter and their mentions don't notify.
+--   block: everything a mute does, and the blocked user can no longer reply to the blocker.
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id  INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    blocked_id  INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    kind        TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_blocks_blocked ON user_blocks (blocked_id);
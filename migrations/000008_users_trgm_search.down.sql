@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_realname_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
@@ -0,0 +1,4 @@
+-- Trigram indexes for fuzzy user search (GET /users/search). Requires the pg_trgm
+-- extension, which is enabled at startup by db.EnableExtensions.
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING GIN (username gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_realname_trgm ON users USING GIN (realname gin_trgm_ops);
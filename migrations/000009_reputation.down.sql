@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_comment_reactions_reputation ON comment_reactions;
+DROP FUNCTION IF EXISTS comment_reactions_reputation();
+DROP TABLE IF EXISTS reputation_events;
+DROP FUNCTION IF EXISTS reputation_events_apply();
+ALTER TABLE users DROP COLUMN IF EXISTS reputation;
@@ -0,0 +1,63 @@
+-- Reputation is kept as a ledger of point events plus a cached total on users.
+-- Each event is unique per (source, source_id), so sources can be re-synced idempotently,
+-- and a trigger keeps users.reputation in step with inserts, updates and deletes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS reputation INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS reputation_events (
+    id          BIGSERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    source      TEXT NOT NULL CHECK (source IN ('reaction', 'definition', 'moderation')),
+    source_id   BIGINT NOT NULL,
+    points      INTEGER NOT NULL,
+    reason      TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (source, source_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reputation_events_user ON reputation_events (user_id, created_at DESC);
+
+CREATE OR REPLACE FUNCTION reputation_events_apply() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE users SET reputation = reputation - OLD.points WHERE userid = OLD.user_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE users SET reputation = reputation + NEW.points WHERE userid = NEW.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_reputation_events_apply ON reputation_events;
+CREATE TRIGGER trg_reputation_events_apply
+    AFTER INSERT OR UPDATE OR DELETE ON reputation_events
+    FOR EACH ROW EXECUTE FUNCTION reputation_events_apply();
+
+-- Received reactions: one point per reaction on the author's comment (reacting to yourself doesn't count).
+CREATE OR REPLACE FUNCTION comment_reactions_reputation() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO reputation_events (user_id, source, source_id, points)
+        SELECT c.userid, 'reaction', NEW.id, 1
+        FROM comments c
+        WHERE c.commentid = NEW.comment_id AND c.userid <> NEW.user_id
+        ON CONFLICT (source, source_id) DO NOTHING;
+        RETURN NEW;
+    END IF;
+    DELETE FROM reputation_events WHERE source = 'reaction' AND source_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_comment_reactions_reputation ON comment_reactions;
+CREATE TRIGGER trg_comment_reactions_reputation
+    AFTER INSERT OR DELETE ON comment_reactions
+    FOR EACH ROW EXECUTE FUNCTION comment_reactions_reputation();
+
+-- Backfill reactions that existed before the trigger.
+INSERT INTO reputation_events (user_id, source, source_id, points, created_at)
+SELECT c.userid, 'reaction', cr.id, 1, cr.created_at
+FROM comment_reactions cr
+JOIN comments c ON c.commentid = cr.comment_id
+WHERE c.userid <> cr.user_id
+ON CONFLICT (source, source_id) DO NOTHING;
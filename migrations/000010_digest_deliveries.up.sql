@@ -0,0 +1,5 @@
+-- When each user last received an activity digest. The digest covers activity since then.
+CREATE TABLE IF NOT EXISTS digest_deliveries (
+    user_id       INTEGER PRIMARY KEY REFERENCES users(userid) ON DELETE CASCADE,
+    last_sent_at  TIMESTAMPTZ NOT NULL
+);
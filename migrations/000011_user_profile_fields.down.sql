@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS lojban_level;
+ALTER TABLE users DROP COLUMN IF EXISTS pronouns;
+ALTER TABLE users DROP COLUMN IF EXISTS location;
+ALTER TABLE users DROP COLUMN IF EXISTS website;
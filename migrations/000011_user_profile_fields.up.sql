@@ -0,0 +1,6 @@
+-- Optional self-descriptive profile fields. NULL means "not set".
+ALTER TABLE users ADD COLUMN IF NOT EXISTS website TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS location TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pronouns TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS lojban_level TEXT
+    CHECK (lojban_level IN ('beginner', 'intermediate', 'advanced', 'fluent'));
@@ -0,0 +1,3 @@
+-- Per-field visibility of profile fields: {"realname": "private", "website": "users", ...}.
+-- Missing keys mean "public". Values: public, users (logged-in users only), private.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS field_visibility JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comment_reactions_comment_id;
+DROP INDEX IF EXISTS idx_definitions_userid_time;
+DROP INDEX IF EXISTS idx_comments_userid_time;
@@ -0,0 +1,4 @@
+-- Per-author lookups used by GET /users/{id}/stats (counts and active days).
+CREATE INDEX IF NOT EXISTS idx_comments_userid_time ON comments (userid, time);
+CREATE INDEX IF NOT EXISTS idx_definitions_userid_time ON definitions (userid, time);
+CREATE INDEX IF NOT EXISTS idx_comment_reactions_comment_id ON comment_reactions (comment_id);
@@ -0,0 +1,7 @@
+-- Daily API request counters per caller, e.g. subject 'user:42'. See quota/quota.go.
+CREATE TABLE IF NOT EXISTS api_usage (
+    subject TEXT NOT NULL,
+    day DATE NOT NULL,
+    request_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (subject, day)
+);
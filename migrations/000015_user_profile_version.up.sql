@@ -0,0 +1,3 @@
+-- Incremented on every profile update; exposed as the ETag of GET /users/me and checked
+-- against If-Match on PUT /users/me.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_version INTEGER NOT NULL DEFAULT 1;
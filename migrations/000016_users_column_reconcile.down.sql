@@ -0,0 +1,3 @@
+-- Nothing to undo: the columns may have existed before the up migration ran,
+-- and reverting the rename would break the application.
+SELECT 1;
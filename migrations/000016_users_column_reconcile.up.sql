@@ -0,0 +1,15 @@
+-- Reconciles the users table with the column mapping in userrepo/userrepo.go.
+-- Some development databases were created from a schema whose key column was `id`;
+-- the code uses `userid` everywhere, so rename it where necessary.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'id')
+       AND NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'userid') THEN
+        ALTER TABLE users RENAME COLUMN id TO userid;
+    END IF;
+END $$;
+
+-- Columns read by the profile and auth code that older schemas may lack.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
@@ -0,0 +1,8 @@
+-- Onboarding checklist progress. `completed` maps step keys to the time they were
+-- completed, e.g. {"set_bio": "2024-05-01T10:00:00Z"}. See users/onboarding.go.
+CREATE TABLE IF NOT EXISTS user_onboarding (
+    user_id      INTEGER PRIMARY KEY REFERENCES users(userid) ON DELETE CASCADE,
+    completed    JSONB NOT NULL DEFAULT '{}',
+    dismissed_at TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_definitions_embedding_pending;
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_updated_at;
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_error;
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_attempts;
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding;
@@ -0,0 +1,14 @@
+-- pgvector is normally enabled already; this is a no-op then.
+CREATE EXTENSION IF NOT EXISTS vector;
+
+-- Embedding of the definition text, written by the background embedding calculator.
+-- No fixed dimension, so the embedding model can be changed without a schema change.
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding vector;
+-- Failure bookkeeping: rows that failed `embedding_attempts` times are no longer picked up.
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_error TEXT;
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_updated_at TIMESTAMPTZ;
+
+-- Finds definitions still waiting for an embedding without scanning the whole table.
+CREATE INDEX IF NOT EXISTS idx_definitions_embedding_pending
+    ON definitions (definitionid) WHERE embedding IS NULL;
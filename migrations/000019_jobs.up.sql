@@ -0,0 +1,22 @@
+-- Durable background job queue, see jobs/queue.go.
+-- status: pending -> running -> done, or back to pending for a retry, or failed when
+-- the attempts are used up.
+CREATE TABLE IF NOT EXISTS jobs (
+    id           BIGSERIAL PRIMARY KEY,
+    type         TEXT NOT NULL,
+    payload      JSONB NOT NULL DEFAULT '{}',
+    status       TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5 CHECK (max_attempts > 0),
+    last_error   TEXT,
+    run_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_by    TEXT,
+    locked_at    TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+-- Workers claim the oldest due pending job; only pending rows are indexed.
+CREATE INDEX IF NOT EXISTS idx_jobs_pending ON jobs (run_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_jobs_type_status ON jobs (type, status);
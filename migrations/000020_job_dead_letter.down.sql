@@ -0,0 +1,5 @@
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_retry_at;
+DROP INDEX IF EXISTS idx_jobs_dead;
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_status_check;
+UPDATE jobs SET status = 'failed' WHERE status = 'dead';
+ALTER TABLE jobs ADD CONSTRAINT jobs_status_check CHECK (status IN ('pending', 'running', 'done', 'failed'));
@@ -0,0 +1,9 @@
+-- Jobs that used up their attempts move to the dead-letter state 'dead' (formerly 'failed')
+-- and stay there until an operator requeues them.
+ALTER TABLE jobs DROP CONSTRAINT IF EXISTS jobs_status_check;
+UPDATE jobs SET status = 'dead' WHERE status = 'failed';
+ALTER TABLE jobs ADD CONSTRAINT jobs_status_check CHECK (status IN ('pending', 'running', 'done', 'dead'));
+CREATE INDEX IF NOT EXISTS idx_jobs_dead ON jobs (updated_at DESC) WHERE status = 'dead';
+
+-- Failed embeddings wait for an exponential backoff before they are fetched again.
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_retry_at TIMESTAMPTZ;
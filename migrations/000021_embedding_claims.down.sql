@@ -0,0 +1,2 @@
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_claimed_by;
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_claimed_at;
@@ -0,0 +1,5 @@
+-- Definitions handed to an embedding calculator are marked in progress, so several app
+-- instances don't embed the same rows. A claim older than the lease (see
+-- `embeddingClaimLease` in background/embedding_store.go) is considered abandoned.
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_claimed_at TIMESTAMPTZ;
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_claimed_by TEXT;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_definitions_embedding_pending;
+CREATE INDEX IF NOT EXISTS idx_definitions_embedding_pending
+    ON definitions (definitionid) WHERE embedding IS NULL;
+
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_stale;
+ALTER TABLE definitions DROP COLUMN IF EXISTS embedding_model;
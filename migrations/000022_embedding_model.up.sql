@@ -0,0 +1,9 @@
+-- Model that produced `embedding`. Vectors of different models aren't comparable, so rows
+-- embedded with an older model are re-embedded when a campaign marks them stale.
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+-- Set by a re-embedding campaign; the old vector stays usable until the new one is stored.
+ALTER TABLE definitions ADD COLUMN IF NOT EXISTS embedding_stale BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP INDEX IF EXISTS idx_definitions_embedding_pending;
+CREATE INDEX IF NOT EXISTS idx_definitions_embedding_pending
+    ON definitions (definitionid) WHERE embedding IS NULL OR embedding_stale;
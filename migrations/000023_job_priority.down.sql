@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_jobs_pending;
+CREATE INDEX IF NOT EXISTS idx_jobs_pending ON jobs (run_at, id) WHERE status = 'pending';
+
+ALTER TABLE jobs DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,5 @@
+-- Higher priorities are claimed first; jobs of equal priority run oldest first.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS idx_jobs_pending;
+CREATE INDEX IF NOT EXISTS idx_jobs_pending ON jobs (priority DESC, run_at, id) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_notifications_comment_once;
+DROP INDEX IF EXISTS idx_notifications_user;
+DROP TABLE IF EXISTS notifications;
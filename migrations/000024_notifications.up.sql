@@ -0,0 +1,20 @@
+-- In-app notifications. Valsi subscriptions are delivered by the existing
+-- notify_valsi_subscribers() function; replies and mentions are written by the fan-out
+-- worker (notifications/fanout.go).
+CREATE TABLE IF NOT EXISTS notifications (
+    id                BIGSERIAL PRIMARY KEY,
+    user_id           INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    notification_type TEXT NOT NULL,
+    message           TEXT NOT NULL,
+    link              TEXT,
+    valsi_id          INTEGER,
+    comment_id        INTEGER,
+    actor_id          INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    read_at           TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, created_at DESC);
+-- A fan-out job that runs twice must not notify twice about the same comment.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_comment_once
+    ON notifications (user_id, comment_id, notification_type) WHERE comment_id IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE hashtags DROP COLUMN IF EXISTS usage_count;
@@ -0,0 +1,8 @@
+-- Cached number of comments using each hashtag. Incremented when a comment is linked to the
+-- tag; the counter reconciliation service recomputes it from post_hashtags.
+ALTER TABLE hashtags ADD COLUMN IF NOT EXISTS usage_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE hashtags h
+SET usage_count = c.n
+FROM (SELECT hashtag_id, COUNT(*) AS n FROM post_hashtags GROUP BY hashtag_id) c
+WHERE c.hashtag_id = h.id;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_comments_embedding_pending;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_claimed_by;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_claimed_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_updated_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_retry_at;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_error;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_attempts;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_stale;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding_model;
+ALTER TABLE comments DROP COLUMN IF EXISTS embedding;
@@ -0,0 +1,14 @@
+-- Comments are embedded like definitions (see `embeddingSources` in
+-- background/embedding_store.go), with the same bookkeeping columns.
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding vector;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_stale BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_error TEXT;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_retry_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_updated_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_claimed_at TIMESTAMPTZ;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS embedding_claimed_by TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_comments_embedding_pending
+    ON comments (commentid) WHERE embedding IS NULL OR embedding_stale;
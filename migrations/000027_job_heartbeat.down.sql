@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_jobs_running_heartbeat;
+ALTER TABLE jobs DROP COLUMN IF EXISTS heartbeat_at;
@@ -0,0 +1,6 @@
+-- Workers refresh `heartbeat_at` while a handler runs (see jobs/worker.go). A running job
+-- whose heartbeat is too old belongs to a worker that died; the reaper (jobs/reaper.go)
+-- hands it back to the queue.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_running_heartbeat ON jobs (heartbeat_at) WHERE status = 'running';
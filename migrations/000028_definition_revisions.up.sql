@@ -0,0 +1,30 @@
+-- Every change to a definition is kept as a revision with its author. `definitions` holds the
+-- content of the latest approved revision, so everything reading it directly (embeddings,
+-- digests, exports) only ever sees approved text; proposed edits wait here until reviewed.
+CREATE TABLE IF NOT EXISTS definition_revisions (
+    id             BIGSERIAL PRIMARY KEY,
+    definition_id  INTEGER NOT NULL REFERENCES definitions(definitionid) ON DELETE CASCADE,
+    revision       INTEGER NOT NULL,
+    definition     TEXT NOT NULL,
+    notes          TEXT,
+    selmaho        TEXT,
+    author_id      INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    -- Optional edit summary
+    comment        TEXT,
+    status         TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    reviewed_by    INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    reviewed_at    TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (definition_id, revision)
+);
+
+-- The review queue.
+CREATE INDEX IF NOT EXISTS idx_definition_revisions_pending
+    ON definition_revisions (created_at) WHERE status = 'pending';
+
+-- Existing definitions start their history with a single approved revision by their author.
+INSERT INTO definition_revisions (definition_id, revision, definition, notes, selmaho, author_id, status, created_at)
+SELECT d.definitionid, 1, d.definition, d.notes, d.selmaho, u.userid, 'approved', to_timestamp(d.time)
+FROM definitions d
+LEFT JOIN users u ON u.userid = d.userid
+ON CONFLICT (definition_id, revision) DO NOTHING;
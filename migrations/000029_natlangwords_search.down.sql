@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_keywordmapping_natlangword;
+DROP INDEX IF EXISTS idx_natlangwords_word_trgm;
@@ -0,0 +1,5 @@
+-- Gloss search (GET /api/v1/natlangwords) matches words by prefix and trigram similarity.
+-- pg_trgm is enabled at startup by db.EnableExtensions.
+CREATE INDEX IF NOT EXISTS idx_natlangwords_word_trgm ON natlangwords USING GIN (word gin_trgm_ops);
+-- Listing the definitions a natural-language word is linked to.
+CREATE INDEX IF NOT EXISTS idx_keywordmapping_natlangword ON keywordmapping (natlangwordid);
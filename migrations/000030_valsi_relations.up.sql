@@ -0,0 +1,17 @@
+-- Relations between words, for etymology and "see also" links. A row reads
+-- "<from> is <relation> <to>", e.g. "kla is rafsi-of klama" or "klama is lujvo-component of
+-- klagau". see-also has no direction and is stored once.
+CREATE TABLE IF NOT EXISTS valsi_relations (
+    id           BIGSERIAL PRIMARY KEY,
+    from_valsiid INTEGER NOT NULL REFERENCES valsi(valsiid) ON DELETE CASCADE,
+    to_valsiid   INTEGER NOT NULL REFERENCES valsi(valsiid) ON DELETE CASCADE,
+    relation     TEXT NOT NULL CHECK (relation IN ('rafsi-of', 'lujvo-component', 'borrowed-from', 'see-also')),
+    note         TEXT,
+    created_by   INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (from_valsiid <> to_valsiid),
+    UNIQUE (from_valsiid, to_valsiid, relation)
+);
+
+-- The unique constraint covers lookups by `from_valsiid`; this one covers the reverse direction.
+CREATE INDEX IF NOT EXISTS idx_valsi_relations_to ON valsi_relations (to_valsiid);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS definition_examples;
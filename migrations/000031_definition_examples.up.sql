@@ -0,0 +1,25 @@
+-- Example sentences for definitions, submitted by users. Examples by anyone but trusted users
+-- and admins start out pending and are only shown once a moderator approves them.
+CREATE TABLE IF NOT EXISTS definition_examples (
+    id             BIGSERIAL PRIMARY KEY,
+    definition_id  INTEGER NOT NULL REFERENCES definitions(definitionid) ON DELETE CASCADE,
+    -- The sentence in Lojban
+    example        TEXT NOT NULL,
+    -- Its meaning in the definition's language
+    translation    TEXT,
+    -- Where the sentence comes from (a book, a chat log, "own work") and a link to it
+    source         TEXT,
+    source_url     TEXT,
+    status         TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    submitted_by   INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    reviewed_by    INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    reviewed_at    TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_definition_examples_definition
+    ON definition_examples (definition_id, created_at);
+
+-- The moderation queue.
+CREATE INDEX IF NOT EXISTS idx_definition_examples_pending
+    ON definition_examples (created_at) WHERE status = 'pending';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_valsi_word_trgm;
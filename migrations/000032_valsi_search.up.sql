@@ -0,0 +1,3 @@
+-- Fuzzy word lookup (GET /api/v1/valsi/search) matches valsi.word by trigram similarity.
+-- Gloss search reuses the natlangwords index from migration 29.
+CREATE INDEX IF NOT EXISTS idx_valsi_word_trgm ON valsi USING GIN (word gin_trgm_ops);
@@ -0,0 +1,19 @@
+-- Dictionary dumps requested through POST /api/v1/exports. A job writes the file to the export
+-- directory and records its progress here, so any instance can stream it to the requester.
+CREATE TABLE IF NOT EXISTS dictionary_exports (
+    id            BIGSERIAL PRIMARY KEY,
+    -- Language tag of a per-language dump; NULL for the full dictionary
+    language      TEXT,
+    format        TEXT NOT NULL CHECK (format IN ('xml', 'json')),
+    status        TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed', 'expired')),
+    entries_done  BIGINT NOT NULL DEFAULT 0,
+    entries_total BIGINT NOT NULL DEFAULT 0,
+    size_bytes    BIGINT,
+    error         TEXT,
+    requested_by  INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at   TIMESTAMPTZ
+);
+
+-- Finding an export of the same kind that is still being built, and expiring old files.
+CREATE INDEX IF NOT EXISTS idx_dictionary_exports_status ON dictionary_exports (status, created_at);
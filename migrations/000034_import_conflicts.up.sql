@@ -0,0 +1,24 @@
+-- Definitions that a dictionary import found edited locally and that the export would change.
+-- Each row keeps both versions and what the import's conflict strategy did with them, so the
+-- report of an import can be read after the task itself is gone.
+CREATE TABLE IF NOT EXISTS import_conflicts (
+    id              BIGSERIAL PRIMARY KEY,
+    -- Task ID of the import
+    task_id         TEXT NOT NULL,
+    definition_id   INTEGER NOT NULL REFERENCES definitions(definitionid) ON DELETE CASCADE,
+    strategy        TEXT NOT NULL CHECK (strategy IN ('overwrite', 'skip', 'keep-newer', 'review')),
+    resolution      TEXT NOT NULL CHECK (resolution IN ('overwritten', 'skipped', 'queued')),
+    -- The latest approved revision when the import ran
+    local_revision  INTEGER NOT NULL,
+    local_notes     TEXT,
+    local_selmaho   TEXT,
+    local_edited_at TIMESTAMPTZ NOT NULL,
+    import_notes    TEXT,
+    import_selmaho  TEXT,
+    -- The pending revision holding the export's version, for conflicts queued for review
+    queued_revision INTEGER,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The report of an import.
+CREATE INDEX IF NOT EXISTS idx_import_conflicts_task ON import_conflicts (task_id, id);
@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS trg_valsi_relations_changelog ON valsi_relations;
+DROP TRIGGER IF EXISTS trg_keywordmapping_changelog ON keywordmapping;
+DROP TRIGGER IF EXISTS trg_definitions_changelog_update ON definitions;
+DROP TRIGGER IF EXISTS trg_definitions_changelog_insert_delete ON definitions;
+DROP TRIGGER IF EXISTS trg_valsi_changelog_update ON valsi;
+DROP TRIGGER IF EXISTS trg_valsi_changelog_insert_delete ON valsi;
+DROP FUNCTION IF EXISTS valsi_relations_changelog();
+DROP FUNCTION IF EXISTS keywordmapping_changelog();
+DROP FUNCTION IF EXISTS definitions_changelog();
+DROP FUNCTION IF EXISTS valsi_changelog();
+DROP FUNCTION IF EXISTS dictionary_change_diff(JSONB, JSONB);
+DROP FUNCTION IF EXISTS dictionary_change_source();
+DROP FUNCTION IF EXISTS dictionary_change_actor();
+DROP TABLE IF EXISTS dictionary_changes;
@@ -0,0 +1,176 @@
+-- Changelog of the dictionary: every change to words, definitions, glosses and word relations,
+-- whichever code path makes it, is recorded here by triggers. The user and the source of a
+-- change are read from the `lensisku.actor_id` and `lensisku.change_source` settings, which
+-- the application sets for its transaction (see changelog.SetActor); without them, inserts are
+-- credited to the row's own author. IDs are kept without foreign keys, so the history of a
+-- deleted definition survives it. History starts with this migration.
+CREATE TABLE IF NOT EXISTS dictionary_changes (
+    id               BIGSERIAL PRIMARY KEY,
+    -- The word the change belongs to, and for relations the other word
+    valsi_id         INTEGER NOT NULL,
+    related_valsi_id INTEGER,
+    definition_id    INTEGER,
+    entity           TEXT NOT NULL CHECK (entity IN ('valsi', 'definition', 'gloss', 'relation')),
+    action           TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    -- The row for create and delete; {"field": {"old": ..., "new": ...}} for updates
+    changes          JSONB NOT NULL,
+    actor_id         INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    source           TEXT NOT NULL DEFAULT 'system',
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_dictionary_changes_valsi ON dictionary_changes (valsi_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_dictionary_changes_related ON dictionary_changes (related_valsi_id, id DESC)
+    WHERE related_valsi_id IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION dictionary_change_actor() RETURNS INTEGER AS $$
+    SELECT NULLIF(current_setting('lensisku.actor_id', true), '')::integer
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION dictionary_change_source() RETURNS TEXT AS $$
+    SELECT COALESCE(NULLIF(current_setting('lensisku.change_source', true), ''), 'system')
+$$ LANGUAGE sql STABLE;
+
+-- The fields that differ between two snapshots of a row, as {"field": {"old": ..., "new": ...}}.
+CREATE OR REPLACE FUNCTION dictionary_change_diff(old_row JSONB, new_row JSONB) RETURNS JSONB AS $$
+    SELECT COALESCE(jsonb_object_agg(n.key, jsonb_build_object('old', o.value, 'new', n.value)), '{}'::jsonb)
+    FROM jsonb_each(new_row) n
+    JOIN jsonb_each(old_row) o ON o.key = n.key
+    WHERE o.value IS DISTINCT FROM n.value
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION valsi_changelog() RETURNS TRIGGER AS $$
+DECLARE
+    old_row JSONB;
+    new_row JSONB;
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        old_row := jsonb_build_object('word', OLD.word, 'rafsi', OLD.rafsi,
+            'type', (SELECT descriptor FROM valsitypes WHERE typeid = OLD.typeid));
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        new_row := jsonb_build_object('word', NEW.word, 'rafsi', NEW.rafsi,
+            'type', (SELECT descriptor FROM valsitypes WHERE typeid = NEW.typeid));
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO dictionary_changes (valsi_id, entity, action, changes, actor_id, source)
+        VALUES (NEW.valsiid, 'valsi', 'create', new_row, COALESCE(dictionary_change_actor(), NEW.userid), dictionary_change_source());
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO dictionary_changes (valsi_id, entity, action, changes, actor_id, source)
+        VALUES (NEW.valsiid, 'valsi', 'update', dictionary_change_diff(old_row, new_row), dictionary_change_actor(), dictionary_change_source());
+    ELSE
+        INSERT INTO dictionary_changes (valsi_id, entity, action, changes, actor_id, source)
+        VALUES (OLD.valsiid, 'valsi', 'delete', old_row, dictionary_change_actor(), dictionary_change_source());
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_valsi_changelog_insert_delete ON valsi;
+CREATE TRIGGER trg_valsi_changelog_insert_delete
+    AFTER INSERT OR DELETE ON valsi
+    FOR EACH ROW EXECUTE FUNCTION valsi_changelog();
+
+-- Imports rewrite the type and rafsi of every word they contain; only actual changes count.
+DROP TRIGGER IF EXISTS trg_valsi_changelog_update ON valsi;
+CREATE TRIGGER trg_valsi_changelog_update
+    AFTER UPDATE OF word, typeid, rafsi ON valsi
+    FOR EACH ROW
+    WHEN ((OLD.word, OLD.typeid, OLD.rafsi) IS DISTINCT FROM (NEW.word, NEW.typeid, NEW.rafsi))
+    EXECUTE FUNCTION valsi_changelog();
+
+CREATE OR REPLACE FUNCTION definitions_changelog() RETURNS TRIGGER AS $$
+DECLARE
+    old_row JSONB;
+    new_row JSONB;
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        old_row := jsonb_build_object('definition', OLD.definition, 'notes', OLD.notes, 'selmaho', OLD.selmaho,
+            'language', (SELECT tag FROM languages WHERE langid = OLD.langid));
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        new_row := jsonb_build_object('definition', NEW.definition, 'notes', NEW.notes, 'selmaho', NEW.selmaho,
+            'language', (SELECT tag FROM languages WHERE langid = NEW.langid));
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO dictionary_changes (valsi_id, definition_id, entity, action, changes, actor_id, source)
+        VALUES (NEW.valsiid, NEW.definitionid, 'definition', 'create', new_row,
+                COALESCE(dictionary_change_actor(), NEW.userid), dictionary_change_source());
+    ELSIF TG_OP = 'UPDATE' THEN
+        INSERT INTO dictionary_changes (valsi_id, definition_id, entity, action, changes, actor_id, source)
+        VALUES (NEW.valsiid, NEW.definitionid, 'definition', 'update', dictionary_change_diff(old_row, new_row),
+                dictionary_change_actor(), dictionary_change_source());
+    ELSE
+        INSERT INTO dictionary_changes (valsi_id, definition_id, entity, action, changes, actor_id, source)
+        VALUES (OLD.valsiid, OLD.definitionid, 'definition', 'delete', old_row,
+                dictionary_change_actor(), dictionary_change_source());
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_definitions_changelog_insert_delete ON definitions;
+CREATE TRIGGER trg_definitions_changelog_insert_delete
+    AFTER INSERT OR DELETE ON definitions
+    FOR EACH ROW EXECUTE FUNCTION definitions_changelog();
+
+-- Only content counts, not bookkeeping such as embedding claims.
+DROP TRIGGER IF EXISTS trg_definitions_changelog_update ON definitions;
+CREATE TRIGGER trg_definitions_changelog_update
+    AFTER UPDATE OF definition, notes, selmaho, langid ON definitions
+    FOR EACH ROW
+    WHEN ((OLD.definition, OLD.notes, OLD.selmaho, OLD.langid) IS DISTINCT FROM (NEW.definition, NEW.notes, NEW.selmaho, NEW.langid))
+    EXECUTE FUNCTION definitions_changelog();
+
+-- Glosses belong to the word of their definition.
+CREATE OR REPLACE FUNCTION keywordmapping_changelog() RETURNS TRIGGER AS $$
+DECLARE
+    row_data      keywordmapping;
+    change_action TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        row_data := NEW;
+        change_action := 'create';
+    ELSE
+        row_data := OLD;
+        change_action := 'delete';
+    END IF;
+    INSERT INTO dictionary_changes (valsi_id, definition_id, entity, action, changes, actor_id, source)
+    SELECT d.valsiid, d.definitionid, 'gloss', change_action,
+           jsonb_build_object('word', n.word, 'meaning', n.meaning, 'place', row_data.place),
+           dictionary_change_actor(), dictionary_change_source()
+    FROM definitions d
+    LEFT JOIN natlangwords n ON n.wordid = row_data.natlangwordid
+    WHERE d.definitionid = row_data.definitionid;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_keywordmapping_changelog ON keywordmapping;
+CREATE TRIGGER trg_keywordmapping_changelog
+    AFTER INSERT OR DELETE ON keywordmapping
+    FOR EACH ROW EXECUTE FUNCTION keywordmapping_changelog();
+
+CREATE OR REPLACE FUNCTION valsi_relations_changelog() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO dictionary_changes (valsi_id, related_valsi_id, entity, action, changes, actor_id, source)
+        VALUES (NEW.from_valsiid, NEW.to_valsiid, 'relation', 'create',
+                jsonb_build_object('relation', NEW.relation, 'to', (SELECT word FROM valsi WHERE valsiid = NEW.to_valsiid), 'note', NEW.note),
+                COALESCE(dictionary_change_actor(), NEW.created_by), dictionary_change_source());
+    ELSE
+        INSERT INTO dictionary_changes (valsi_id, related_valsi_id, entity, action, changes, actor_id, source)
+        VALUES (OLD.from_valsiid, OLD.to_valsiid, 'relation', 'delete',
+                jsonb_build_object('relation', OLD.relation, 'to', (SELECT word FROM valsi WHERE valsiid = OLD.to_valsiid), 'note', OLD.note),
+                dictionary_change_actor(), dictionary_change_source());
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_valsi_relations_changelog ON valsi_relations;
+CREATE TRIGGER trg_valsi_relations_changelog
+    AFTER INSERT OR DELETE ON valsi_relations
+    FOR EACH ROW EXECUTE FUNCTION valsi_relations_changelog();
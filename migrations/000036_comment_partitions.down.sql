@@ -0,0 +1,75 @@
+-- Turns the legacy partitions back into the tables: rows of the other attached partitions are
+-- moved into them and the partitioned tables are dropped. Partitions detached by the
+-- maintenance job are left alone; their rows don't come back.
+CREATE FUNCTION pg_temp.unpartition(tbl TEXT, key TEXT) RETURNS VOID AS $$
+DECLARE
+    legacy    TEXT := tbl || '_legacy';
+    pk_name   TEXT;
+    pk_cols   TEXT;
+    legacy_pk TEXT;
+    seq       TEXT;
+    indexes   TEXT[];
+    triggers  TEXT[];
+    name      TEXT;
+    def       TEXT;
+BEGIN
+    SELECT conname INTO pk_name FROM pg_constraint WHERE conrelid = tbl::regclass AND contype = 'p';
+    SELECT string_agg(quote_ident(a.attname), ', ' ORDER BY k.ord)
+    INTO pk_cols
+    FROM pg_index i
+    CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+    JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+    WHERE i.indrelid = tbl::regclass AND i.indisprimary AND a.attname <> key;
+    SELECT array_agg(ic.relname)
+    INTO indexes
+    FROM pg_index i
+    JOIN pg_class ic ON ic.oid = i.indexrelid
+    WHERE i.indrelid = tbl::regclass
+      AND NOT i.indisunique
+      AND NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conindid = i.indexrelid);
+    SELECT array_agg(pg_get_triggerdef(oid)) INTO triggers
+    FROM pg_trigger
+    WHERE tgrelid = tbl::regclass AND NOT tgisinternal;
+
+    -- Detaching drops the triggers cloned to the partition, so moving the rows doesn't fire them.
+    EXECUTE format('ALTER TABLE %I DETACH PARTITION %I', tbl, legacy);
+    EXECUTE format('INSERT INTO %I SELECT * FROM %I', legacy, tbl);
+
+    IF pk_cols IS NOT NULL THEN
+        seq := pg_get_serial_sequence(tbl, split_part(pk_cols, ', ', 1));
+        IF seq IS NOT NULL THEN
+            EXECUTE format('ALTER SEQUENCE %s OWNED BY %I.%s', seq, legacy, split_part(pk_cols, ', ', 1));
+        END IF;
+    END IF;
+    EXECUTE format('DROP TABLE %I', tbl);
+    EXECUTE format('ALTER TABLE %I RENAME TO %I', legacy, tbl);
+
+    IF pk_cols IS NOT NULL THEN
+        SELECT conname INTO legacy_pk FROM pg_constraint WHERE conrelid = tbl::regclass AND contype = 'p';
+        EXECUTE format('ALTER TABLE %I DROP CONSTRAINT %I', tbl, legacy_pk);
+        EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I PRIMARY KEY (%s)', tbl, pk_name, pk_cols);
+    END IF;
+    FOREACH name IN ARRAY coalesce(indexes, '{}') LOOP
+        EXECUTE format('ALTER INDEX IF EXISTS %I RENAME TO %I', left(name, 56) || '_legacy', name);
+    END LOOP;
+    FOREACH def IN ARRAY coalesce(triggers, '{}') LOOP
+        EXECUTE def;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT pg_temp.unpartition('comment_reactions', 'created_at');
+SELECT pg_temp.unpartition('comments', 'time');
+
+-- The restored keys are not validated, since rows they pointed at may have been detached.
+DO $$
+DECLARE
+    c RECORD;
+BEGIN
+    FOR c IN SELECT * FROM partition_dropped_foreign_keys LOOP
+        EXECUTE format('ALTER TABLE %s ADD CONSTRAINT %I %s NOT VALID', c.referencing_table, c.constraint_name, c.definition);
+    END LOOP;
+END;
+$$;
+
+DROP TABLE IF EXISTS partition_dropped_foreign_keys;
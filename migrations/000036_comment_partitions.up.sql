@@ -0,0 +1,126 @@
+-- Comments and their reactions are range-partitioned by month: `comments` on `time` (a Unix
+-- timestamp), `comment_reactions` on `created_at`. Existing rows are not copied: each old table
+-- is renamed to `<table>_legacy` and attached as the partition for everything before the first
+-- month. Monthly partitions are named `<table>_pYYYYMM`; the application creates them ahead of
+-- time and detaches old ones (see background/comment_partitions.go). A default partition
+-- catches rows no monthly partition covers yet.
+--
+-- A primary or unique key of a partitioned table has to include the partition key, so:
+--   * the primary keys become (commentid, time) and (id, created_at); the ids still come from
+--     their sequences, which keep them unique;
+--   * foreign keys that reference `comments` are dropped (their definitions are kept in
+--     `partition_dropped_foreign_keys`, from which the down migration restores them);
+--   * other unique constraints stay on the legacy partitions only.
+-- Indexes, triggers and outgoing foreign keys of the old tables are recreated on the
+-- partitioned ones, so they apply to every partition.
+
+CREATE TABLE IF NOT EXISTS partition_dropped_foreign_keys (
+    table_name        TEXT NOT NULL,
+    referencing_table TEXT NOT NULL,
+    constraint_name   TEXT NOT NULL,
+    definition        TEXT NOT NULL,
+    PRIMARY KEY (referencing_table, constraint_name)
+);
+
+-- The bound of a partition that starts at `m`, as SQL: a Unix timestamp or a timestamptz literal.
+CREATE FUNCTION pg_temp.partition_bound(m TIMESTAMPTZ, epoch BOOLEAN) RETURNS TEXT AS $$
+    SELECT CASE WHEN epoch THEN extract(epoch FROM m)::bigint::text ELSE quote_literal(m::text) END
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION pg_temp.partition_by_month(tbl TEXT, key TEXT, epoch BOOLEAN, months_ahead INTEGER) RETURNS VOID AS $$
+DECLARE
+    legacy  TEXT := tbl || '_legacy';
+    key_ts  TEXT := CASE WHEN epoch THEN format('to_timestamp(%I)', key) ELSE quote_ident(key) END;
+    pk_name TEXT;
+    pk_cols TEXT;
+    seq     TEXT;
+    cutoff  TIMESTAMPTZ;
+    m       TIMESTAMPTZ;
+    c       RECORD;
+BEGIN
+    -- Foreign keys that point at the table.
+    FOR c IN
+        SELECT conname, conrelid::regclass::text AS rel, pg_get_constraintdef(oid) AS def
+        FROM pg_constraint
+        WHERE contype = 'f' AND confrelid = tbl::regclass
+    LOOP
+        INSERT INTO partition_dropped_foreign_keys (table_name, referencing_table, constraint_name, definition)
+        VALUES (tbl, c.rel, c.conname, c.def);
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', c.rel, c.conname);
+    END LOOP;
+
+    SELECT string_agg(quote_ident(a.attname), ', ' ORDER BY k.ord)
+    INTO pk_cols
+    FROM pg_index i
+    CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+    JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+    WHERE i.indrelid = tbl::regclass AND i.indisprimary;
+    -- The old key can't stay: the partitioned table's key becomes the legacy partition's.
+    SELECT conname INTO pk_name FROM pg_constraint WHERE conrelid = tbl::regclass AND contype = 'p';
+    IF pk_name IS NOT NULL THEN
+        EXECUTE format('ALTER TABLE %I DROP CONSTRAINT %I', tbl, pk_name);
+    END IF;
+
+    EXECUTE format('ALTER TABLE %I RENAME TO %I', tbl, legacy);
+    EXECUTE format('CREATE TABLE %I (LIKE %I INCLUDING DEFAULTS INCLUDING STORAGE INCLUDING COMMENTS) PARTITION BY RANGE (%I)',
+        tbl, legacy, key);
+
+    -- The legacy partition ends with the month after the newest row (or after this one).
+    EXECUTE format('SELECT date_trunc(''month'', greatest(now(), max(%s)), ''UTC'') + interval ''1 month'' FROM %I', key_ts, legacy)
+    INTO cutoff;
+    EXECUTE format('ALTER TABLE %I ATTACH PARTITION %I FOR VALUES FROM (MINVALUE) TO (%s)',
+        tbl, legacy, pg_temp.partition_bound(cutoff, epoch));
+    EXECUTE format('CREATE TABLE %I PARTITION OF %I DEFAULT', tbl || '_default', tbl);
+    FOR i IN 0 .. months_ahead - 1 LOOP
+        m := cutoff + make_interval(months => i);
+        EXECUTE format('CREATE TABLE %I PARTITION OF %I FOR VALUES FROM (%s) TO (%s)',
+            tbl || '_p' || to_char(m AT TIME ZONE 'UTC', 'YYYYMM'), tbl,
+            pg_temp.partition_bound(m, epoch), pg_temp.partition_bound(m + interval '1 month', epoch));
+    END LOOP;
+
+    IF pk_cols IS NOT NULL THEN
+        EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I PRIMARY KEY (%s, %I)', tbl, pk_name, pk_cols, key);
+        -- Keep the id sequence with the table that uses it, not with the legacy partition.
+        seq := pg_get_serial_sequence(legacy, split_part(pk_cols, ', ', 1));
+        IF seq IS NOT NULL THEN
+            EXECUTE format('ALTER SEQUENCE %s OWNED BY %I.%s', seq, tbl, split_part(pk_cols, ', ', 1));
+        END IF;
+    END IF;
+
+    -- Indexes that don't back a constraint move to the partitioned table. The legacy index is
+    -- renamed first, then attached to the new one instead of being rebuilt.
+    FOR c IN
+        SELECT ic.relname AS name, pg_get_indexdef(i.indexrelid) AS def
+        FROM pg_index i
+        JOIN pg_class ic ON ic.oid = i.indexrelid
+        WHERE i.indrelid = legacy::regclass
+          AND NOT i.indisunique
+          AND NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conindid = i.indexrelid)
+    LOOP
+        EXECUTE format('ALTER INDEX %I RENAME TO %I', c.name, left(c.name, 56) || '_legacy');
+        EXECUTE regexp_replace(c.def, ' ON (\S+\.)?' || legacy || ' ', ' ON ' || quote_ident(tbl) || ' ');
+    END LOOP;
+
+    -- Row triggers are cloned to every partition when created on the partitioned table.
+    FOR c IN
+        SELECT tgname, pg_get_triggerdef(oid) AS def
+        FROM pg_trigger
+        WHERE tgrelid = legacy::regclass AND NOT tgisinternal
+    LOOP
+        EXECUTE format('DROP TRIGGER %I ON %I', c.tgname, legacy);
+        EXECUTE regexp_replace(c.def, ' ON (\S+\.)?' || legacy || ' ', ' ON ' || quote_ident(tbl) || ' ');
+    END LOOP;
+
+    -- Outgoing foreign keys; the legacy partition's own constraints are attached to them.
+    FOR c IN
+        SELECT conname, pg_get_constraintdef(oid) AS def
+        FROM pg_constraint
+        WHERE contype = 'f' AND conrelid = legacy::regclass
+    LOOP
+        EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I %s', tbl, c.conname, c.def);
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql SET timezone = 'UTC';
+
+SELECT pg_temp.partition_by_month('comments', 'time', true, 3);
+SELECT pg_temp.partition_by_month('comment_reactions', 'created_at', false, 3);
@@ -0,0 +1,21 @@
+-- Audit log of privileged and destructive actions: administration, moderation and dictionary
+-- imports. Each entry says who did what to which target, with snapshots of the target before
+-- and after when there are any. Entries are written by the application in the transaction of
+-- the action when it has one (see audit.Record), and are never updated.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    -- e.g. 'definition.delete' or 'job.retry'
+    action      TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    -- Kept as text, since targets are keyed by integers, UUIDs or task IDs
+    target_id   TEXT NOT NULL,
+    before      JSONB,
+    after       JSONB,
+    request_id  TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_action ON audit_log (action, id DESC);
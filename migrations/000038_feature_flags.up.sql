@@ -0,0 +1,9 @@
+-- Feature flags switched by admins at runtime (see the `flags` package). A flag that has no
+-- row is off.
+CREATE TABLE IF NOT EXISTS feature_flags (
+    name        TEXT PRIMARY KEY,
+    enabled     BOOLEAN NOT NULL DEFAULT FALSE,
+    description TEXT,
+    updated_by  INTEGER REFERENCES users(userid) ON DELETE SET NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- The bell icon asks for the unread count on every page load; only unread rows are indexed,
+-- so the index stays small however many notifications users keep.
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS trg_notifications_announce ON notifications;
+DROP FUNCTION IF EXISTS notifications_announce();
@@ -0,0 +1,16 @@
+-- Announces each new notification on the `lensisku_notifications` channel when its
+-- transaction commits, whichever code path wrote it; every instance listens and pushes it to
+-- its recipient's open streams (see notifications/stream.go). The payload only identifies the
+-- row, so it stays far below the NOTIFY size limit.
+CREATE OR REPLACE FUNCTION notifications_announce() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('lensisku_notifications',
+        json_build_object('id', NEW.id, 'user_id', NEW.user_id)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_notifications_announce ON notifications;
+CREATE TRIGGER trg_notifications_announce
+    AFTER INSERT ON notifications
+    FOR EACH ROW EXECUTE FUNCTION notifications_announce();
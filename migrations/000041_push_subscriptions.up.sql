@@ -0,0 +1,25 @@
+-- Web Push subscriptions of browsers (see the `webpush` package). An endpoint is unique to a
+-- browser profile; one registered again, after another user logs in there, changes hands.
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id              BIGSERIAL PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users(userid) ON DELETE CASCADE,
+    endpoint        TEXT NOT NULL UNIQUE,
+    -- The browser's P-256 public key and auth secret, base64url
+    p256dh          TEXT NOT NULL,
+    auth            TEXT NOT NULL,
+    user_agent      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_success_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user ON push_subscriptions (user_id);
+
+-- When the sender took a notification for delivery. Only the types worth interrupting someone
+-- for are pushed; the partial index lists them, as webpush.PushTypes does, and notifications
+-- older than this migration count as done.
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS pushed_at TIMESTAMPTZ;
+UPDATE notifications SET pushed_at = created_at
+WHERE notification_type IN ('mention', 'revision_approved', 'revision_rejected', 'example_approved', 'example_rejected');
+CREATE INDEX IF NOT EXISTS idx_notifications_push_pending ON notifications (id)
+    WHERE pushed_at IS NULL
+      AND notification_type IN ('mention', 'revision_approved', 'revision_rejected', 'example_approved', 'example_rejected');
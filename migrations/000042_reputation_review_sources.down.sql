@@ -0,0 +1,4 @@
+DELETE FROM reputation_events WHERE source IN ('revision', 'example');
+ALTER TABLE reputation_events DROP CONSTRAINT IF EXISTS reputation_events_source_check;
+ALTER TABLE reputation_events ADD CONSTRAINT reputation_events_source_check
+    CHECK (source IN ('reaction', 'definition', 'moderation'));
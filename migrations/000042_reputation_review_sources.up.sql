@@ -0,0 +1,6 @@
+-- Reviews of definition edits and examples count towards their author's reputation. Each gets a
+-- source of its own, keyed by the revision or example ID, so the IDs of the two tables can't
+-- collide with each other or with other moderation actions.
+ALTER TABLE reputation_events DROP CONSTRAINT IF EXISTS reputation_events_source_check;
+ALTER TABLE reputation_events ADD CONSTRAINT reputation_events_source_check
+    CHECK (source IN ('reaction', 'definition', 'moderation', 'revision', 'example'));
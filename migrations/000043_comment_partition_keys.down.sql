@@ -0,0 +1,28 @@
+-- Dropping the trigger functions drops every trigger enforcing a foreign key.
+DROP FUNCTION IF EXISTS partition_fk_check() CASCADE;
+DROP FUNCTION IF EXISTS partition_fk_action() CASCADE;
+DROP FUNCTION IF EXISTS partition_unique_check() CASCADE;
+
+-- The partitioned tables had no unique keys but their primary keys before this migration, and no
+-- indexes for the unique key triggers.
+DO $$
+DECLARE
+    c RECORD;
+BEGIN
+    FOR c IN
+        SELECT i.indrelid::regclass::text AS tbl, ic.relname AS name, con.conname
+        FROM pg_index i
+        JOIN pg_class ic ON ic.oid = i.indexrelid
+        LEFT JOIN pg_constraint con ON con.conindid = i.indexrelid AND con.contype = 'u'
+        WHERE i.indrelid IN ('comments'::regclass, 'comment_reactions'::regclass)
+          AND NOT i.indisprimary
+          AND (i.indisunique OR ic.relname LIKE '%\_partkey')
+    LOOP
+        IF c.conname IS NOT NULL THEN
+            EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', c.tbl, c.conname);
+        ELSE
+            EXECUTE format('DROP INDEX %I', c.name);
+        END IF;
+    END LOOP;
+END;
+$$;
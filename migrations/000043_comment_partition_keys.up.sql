@@ -0,0 +1,219 @@
+-- Enforces again the keys migration 000036 had to give up when it partitioned `comments` and
+-- `comment_reactions`.
+--
+-- Foreign keys: the referencing tables have no partition key column to add to their keys, so
+-- each key recorded in `partition_dropped_foreign_keys` is enforced by a pair of triggers, named
+-- after it. The one on the referencing table checks that inserted or updated keys exist in the
+-- referenced table, locking the referenced row FOR KEY SHARE as a foreign key does; the one on
+-- the referenced table applies the key's ON DELETE and ON UPDATE actions. Rows that went
+-- unchecked since 000036 are not validated, and detaching a partition (see db/partitions.go)
+-- fires no trigger, so rows referencing detached comments are left as they are.
+--
+-- Unique constraints: the legacy partitions keep theirs, and each is enforced on every partition
+-- of the partitioned table, by a unique constraint where it includes the partition key and by a
+-- trigger otherwise.
+
+-- Trigger arguments: referenced table, referencing columns, referenced columns (as text[]
+-- literals) and the constraint name.
+CREATE OR REPLACE FUNCTION partition_fk_check() RETURNS TRIGGER AS $$
+DECLARE
+    cols     TEXT[] := TG_ARGV[1]::TEXT[];
+    ref_cols TEXT[] := TG_ARGV[2]::TEXT[];
+    has_null BOOLEAN;
+    hit      INTEGER;
+BEGIN
+    -- As with MATCH SIMPLE, a key with a NULL column references nothing.
+    EXECUTE 'SELECT ' || (SELECT string_agg(format('($1).%I IS NULL', k.c), ' OR ') FROM unnest(cols) AS k(c))
+    INTO has_null USING NEW;
+    IF has_null THEN
+        RETURN NULL;
+    END IF;
+    EXECUTE format('SELECT 1 FROM %s r WHERE %s LIMIT 1 FOR KEY SHARE', TG_ARGV[0],
+        (SELECT string_agg(format('r.%I = ($1).%I', k.rc, k.c), ' AND ') FROM unnest(ref_cols, cols) AS k(rc, c)))
+    INTO hit USING NEW;
+    IF hit IS NULL THEN
+        RAISE EXCEPTION 'insert or update on table "%" violates foreign key constraint "%"', TG_TABLE_NAME, TG_ARGV[3]
+            USING ERRCODE = 'foreign_key_violation', CONSTRAINT = TG_ARGV[3], TABLE = TG_TABLE_NAME;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Trigger arguments: referencing table, referencing columns, referenced columns, the constraint
+-- name, its ON DELETE and ON UPDATE actions, and the referenced table (the trigger fires on
+-- its partitions, as TG_TABLE_NAME).
+CREATE OR REPLACE FUNCTION partition_fk_action() RETURNS TRIGGER AS $$
+DECLARE
+    cols     TEXT[] := TG_ARGV[1]::TEXT[];
+    ref_cols TEXT[] := TG_ARGV[2]::TEXT[];
+    act      TEXT := CASE TG_OP WHEN 'DELETE' THEN TG_ARGV[4] ELSE TG_ARGV[5] END;
+    cond     TEXT;
+    same     BOOLEAN;
+    hit      INTEGER;
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        EXECUTE 'SELECT ' || (SELECT string_agg(format('($1).%1$I IS NOT DISTINCT FROM ($2).%1$I', k.rc), ' AND ') FROM unnest(ref_cols) AS k(rc))
+        INTO same USING OLD, NEW;
+        IF same THEN
+            RETURN NULL;
+        END IF;
+    ELSE
+        -- An update moving a row to another partition deletes it from the old one; the key
+        -- still exists, so nothing references a missing row.
+        EXECUTE format('SELECT 1 FROM %s r WHERE %s LIMIT 1', TG_ARGV[6],
+            (SELECT string_agg(format('r.%1$I = ($1).%1$I', k.rc), ' AND ') FROM unnest(ref_cols) AS k(rc)))
+        INTO hit USING OLD;
+        IF hit IS NOT NULL THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    SELECT string_agg(format('%I = ($1).%I', k.c, k.rc), ' AND ') INTO cond FROM unnest(cols, ref_cols) AS k(c, rc);
+    IF act = 'CASCADE' AND TG_OP = 'DELETE' THEN
+        EXECUTE format('DELETE FROM %s WHERE %s', TG_ARGV[0], cond) USING OLD;
+    ELSIF act = 'CASCADE' THEN
+        EXECUTE format('UPDATE %s SET %s WHERE %s', TG_ARGV[0],
+            (SELECT string_agg(format('%I = ($2).%I', k.c, k.rc), ', ') FROM unnest(cols, ref_cols) AS k(c, rc)), cond)
+        USING OLD, NEW;
+    ELSIF act IN ('SET NULL', 'SET DEFAULT') THEN
+        EXECUTE format('UPDATE %s SET %s WHERE %s', TG_ARGV[0],
+            (SELECT string_agg(format('%I = %s', k.c, substr(act, 5)), ', ') FROM unnest(cols) AS k(c)), cond)
+        USING OLD;
+    ELSE
+        EXECUTE format('SELECT 1 FROM %s WHERE %s LIMIT 1', TG_ARGV[0], cond) INTO hit USING OLD;
+        IF hit IS NOT NULL THEN
+            RAISE EXCEPTION 'update or delete on table "%" violates foreign key constraint "%" on table "%"', TG_ARGV[6], TG_ARGV[3], TG_ARGV[0]
+                USING ERRCODE = 'foreign_key_violation', CONSTRAINT = TG_ARGV[3], TABLE = TG_ARGV[0];
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- The columns of a constraint definition's column list, such as `a, "B"`.
+CREATE FUNCTION pg_temp.constraint_columns(list TEXT) RETURNS TEXT[] AS $$
+    SELECT array_agg(btrim(k.c, '"') ORDER BY k.ord) FROM unnest(string_to_array(list, ', ')) WITH ORDINALITY AS k(c, ord)
+$$ LANGUAGE sql IMMUTABLE;
+
+-- The action of a foreign key definition on `event` (DELETE or UPDATE).
+CREATE FUNCTION pg_temp.constraint_action(def TEXT, event TEXT) RETURNS TEXT AS $$
+    SELECT coalesce((regexp_match(def, 'ON ' || event || ' (CASCADE|SET NULL|SET DEFAULT|RESTRICT)'))[1], 'NO ACTION')
+$$ LANGUAGE sql IMMUTABLE;
+
+DO $$
+DECLARE
+    c        RECORD;
+    parts    TEXT[];
+    cols     TEXT[];
+    ref_cols TEXT[];
+BEGIN
+    FOR c IN SELECT * FROM partition_dropped_foreign_keys LOOP
+        -- The referencing table may have been dropped since.
+        CONTINUE WHEN to_regclass(c.referencing_table) IS NULL;
+        parts := regexp_match(c.definition, '^FOREIGN KEY \((.+?)\) REFERENCES [^(\s]+\((.+?)\)');
+        IF parts IS NULL THEN
+            RAISE EXCEPTION 'unexpected definition of foreign key %: %', c.constraint_name, c.definition;
+        END IF;
+        cols := pg_temp.constraint_columns(parts[1]);
+        ref_cols := pg_temp.constraint_columns(parts[2]);
+
+        EXECUTE format('CREATE TRIGGER %I AFTER INSERT OR UPDATE OF %s ON %s FOR EACH ROW EXECUTE FUNCTION partition_fk_check(%L, %L, %L, %L)',
+            c.constraint_name, (SELECT string_agg(quote_ident(k.c), ', ') FROM unnest(cols) AS k(c)), c.referencing_table,
+            quote_ident(c.table_name), cols::TEXT, ref_cols::TEXT, c.constraint_name);
+        EXECUTE format('CREATE TRIGGER %I AFTER DELETE OR UPDATE OF %s ON %I FOR EACH ROW EXECUTE FUNCTION partition_fk_action(%L, %L, %L, %L, %L, %L, %L)',
+            left(c.constraint_name || '_' || btrim(c.referencing_table, '"'), 63),
+            (SELECT string_agg(quote_ident(k.c), ', ') FROM unnest(ref_cols) AS k(c)), c.table_name,
+            c.referencing_table, cols::TEXT, ref_cols::TEXT, c.constraint_name,
+            pg_temp.constraint_action(c.definition, 'DELETE'), pg_temp.constraint_action(c.definition, 'UPDATE'),
+            quote_ident(c.table_name));
+    END LOOP;
+END;
+$$;
+
+-- Trigger arguments: the partitioned table, the key columns (as a text[] literal), the
+-- predicate of a partial key (or an empty string) and the constraint name. Like the foreign key
+-- triggers, it runs after the row is written: the key's advisory lock makes concurrent writers
+-- of one key take turns, and the last one sees the others' rows once they commit. That holds in
+-- READ COMMITTED transactions, which take a new snapshot per statement.
+CREATE OR REPLACE FUNCTION partition_unique_check() RETURNS TRIGGER AS $$
+DECLARE
+    cols     TEXT[] := TG_ARGV[1]::TEXT[];
+    pred     TEXT := TG_ARGV[2];
+    has_null BOOLEAN;
+    applies  BOOLEAN;
+    key_text TEXT;
+    n        BIGINT;
+BEGIN
+    -- As with a unique index, keys with a NULL column never conflict.
+    EXECUTE 'SELECT ' || (SELECT string_agg(format('($1).%I IS NULL', k.c), ' OR ') FROM unnest(cols) AS k(c))
+    INTO has_null USING NEW;
+    IF has_null THEN
+        RETURN NULL;
+    END IF;
+    IF pred <> '' THEN
+        EXECUTE format('SELECT %s FROM (SELECT ($1).*) t', pred) INTO applies USING NEW;
+        IF NOT coalesce(applies, false) THEN
+            RETURN NULL;
+        END IF;
+    END IF;
+
+    EXECUTE 'SELECT ROW(' || (SELECT string_agg(format('($1).%I', k.c), ', ') FROM unnest(cols) AS k(c)) || ')::TEXT'
+    INTO key_text USING NEW;
+    PERFORM pg_advisory_xact_lock(hashtextextended(TG_ARGV[3] || key_text, 0));
+    EXECUTE format('SELECT count(*) FROM %s WHERE %s%s', TG_ARGV[0],
+        (SELECT string_agg(format('%I = ($1).%I', k.c, k.c), ' AND ') FROM unnest(cols) AS k(c)),
+        CASE WHEN pred <> '' THEN ' AND (' || pred || ')' ELSE '' END)
+    INTO n USING NEW;
+    IF n > 1 THEN
+        RAISE EXCEPTION 'duplicate key value violates unique constraint "%"', TG_ARGV[3]
+            USING ERRCODE = 'unique_violation', CONSTRAINT = TG_ARGV[3], TABLE = TG_TABLE_NAME,
+                  DETAIL = format('Key (%s)=%s already exists.', array_to_string(cols, ', '), key_text);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Enforces the unique keys of `tbl`'s legacy partition on all of `tbl`, whose partition key is
+-- `key`. A key that includes the partition key becomes a unique constraint or index of `tbl`.
+-- Any other key can't be one, and adding the partition key to it would let every new row
+-- through, since each row gets its own timestamp; it is checked by `partition_unique_check`
+-- instead, with a plain index for the lookups (named `<key>_partkey`). Such keys can't be the
+-- target of ON CONFLICT. Keys on expressions are left to the legacy partition.
+CREATE FUNCTION pg_temp.partition_unique_keys(tbl TEXT, key TEXT) RETURNS VOID AS $$
+DECLARE
+    c        RECORD;
+    name     TEXT;
+    cols_sql TEXT;
+    where_sql TEXT;
+BEGIN
+    FOR c IN
+        SELECT ic.relname AS index_name, con.conname, pg_get_expr(i.indpred, i.indrelid) AS pred,
+               (SELECT array_agg(a.attname::TEXT ORDER BY k.ord)
+                FROM unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+                JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+                WHERE k.ord <= i.indnkeyatts) AS cols
+        FROM pg_index i
+        JOIN pg_class ic ON ic.oid = i.indexrelid
+        LEFT JOIN pg_constraint con ON con.conindid = i.indexrelid AND con.contype = 'u'
+        WHERE i.indrelid = (tbl || '_legacy')::regclass
+          AND i.indisunique AND NOT i.indisprimary
+          AND i.indexprs IS NULL
+    LOOP
+        name := coalesce(c.conname, c.index_name);
+        SELECT string_agg(quote_ident(k.c), ', ') INTO cols_sql FROM unnest(c.cols) AS k(c);
+        where_sql := coalesce(' WHERE ' || c.pred, '');
+        IF key = ANY (c.cols) AND c.conname IS NOT NULL THEN
+            EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I UNIQUE (%s)', tbl, left(name, 58) || '_part', cols_sql);
+        ELSIF key = ANY (c.cols) THEN
+            EXECUTE format('CREATE UNIQUE INDEX %I ON %I (%s)%s', left(name, 58) || '_part', tbl, cols_sql, where_sql);
+        ELSE
+            EXECUTE format('CREATE INDEX %I ON %I (%s)%s', left(name, 55) || '_partkey', tbl, cols_sql, where_sql);
+            EXECUTE format('CREATE TRIGGER %I AFTER INSERT OR UPDATE OF %s ON %I FOR EACH ROW EXECUTE FUNCTION partition_unique_check(%L, %L, %L, %L)',
+                name, cols_sql, tbl, quote_ident(tbl), c.cols::TEXT, coalesce(c.pred, ''), name);
+        END IF;
+    END LOOP;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT pg_temp.partition_unique_keys('comments', 'time');
+SELECT pg_temp.partition_unique_keys('comment_reactions', 'created_at');
@@ -0,0 +1,3 @@
+-- When the user proved they receive mail at their current address (see users/verification.go).
+-- Changing the address clears it. Existing accounts start unverified.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
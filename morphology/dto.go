@@ -0,0 +1,71 @@
+// Package morphology, as part of the dictionary module.
+// This file, `dto.go`, defines the query and response bodies of the morphology API.
+package morphology
+
+// DecomposeQuery is the word to analyze.
+type DecomposeQuery struct {
+	Word string `form:"word" validate:"required"`
+}
+
+// Word kinds, by shape.
+const (
+	KindGismu   = "gismu"
+	KindLujvo   = "lujvo"
+	KindCmavo   = "cmavo"
+	KindCmene   = "cmene"
+	KindFuhivla = "fu'ivla"
+)
+
+// RafsiPart is one rafsi of a decomposed lujvo.
+// @Description A rafsi of a lujvo and the word it stands for
+type RafsiPart struct {
+	// The rafsi as it appears in the lujvo
+	// example: "kla"
+	Rafsi string `json:"rafsi"`
+	// CVC, CCV, CVV, CVCC, CCVC, or CVCCV / CCVCV for a whole gismu at the end
+	// example: "CCV"
+	Form string `json:"form"`
+	// Hyphen letter (y, r or n) between this rafsi and the next
+	// example: ""
+	Hyphen string `json:"hyphen,omitempty"`
+	// The gismu or cmavo the rafsi belongs to; absent if the dictionary has none
+	// example: "klama"
+	Valsi *string `json:"valsi,omitempty"`
+}
+
+// Decomposition is one way of reading a lujvo as a chain of rafsi.
+// @Description A reading of a lujvo with how likely it is
+type Decomposition struct {
+	Parts []RafsiPart `json:"parts"`
+	// The words behind the rafsi, in order (the tanru the lujvo stands for); a rafsi without a
+	// known word shows as itself
+	// example: ["klama", "mlatu"]
+	Tanru []string `json:"tanru"`
+	// Between 0 and 1. Unknown rafsi and broken hyphen rules lower it, and so does every other
+	// reading that is just as good.
+	// example: 1
+	Confidence float64 `json:"confidence"`
+	// Morphology rules this reading breaks
+	Issues []string `json:"issues"`
+}
+
+// DecomposeResponse describes the morphology of a word.
+// @Description A word, its kind and how it splits into rafsi
+type DecomposeResponse struct {
+	// The word, normalized (lowercase, h for the apostrophe is replaced)
+	// example: "klamlatu"
+	Word string `json:"word"`
+	// gismu, lujvo, cmavo, cmene or fu'ivla, judged from the shape of the word
+	// example: "lujvo"
+	Kind string `json:"kind"`
+	// Type of the word in the dictionary, if it is there
+	// example: "lujvo"
+	DictionaryType *string `json:"dictionary_type,omitempty"`
+	// Rafsi assigned to a gismu or cmavo
+	// example: ["kla"]
+	Rafsi []string `json:"rafsi,omitempty"`
+	// The most likely reading of a lujvo
+	Decomposition *Decomposition `json:"decomposition,omitempty"`
+	// Other readings, most likely first
+	Alternatives []Decomposition `json:"alternatives"`
+}
@@ -0,0 +1,51 @@
+// Package morphology encapsulates the analysis of Lojban word forms: telling gismu, lujvo,
+// cmavo, cmene and fu'ivla apart and splitting lujvo into their rafsi.
+// This file, `handlers.go`, serves GET /api/v1/morphology/decompose, which classifies a word
+// and lists the ways a lujvo splits into rafsi.
+package morphology
+
+import (
+	"net/http"
+
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// MorphologyHandlers provides HTTP handlers for word analysis.
+type MorphologyHandlers struct {
+	service *MorphologyService
+}
+
+// NewMorphologyHandlers creates new MorphologyHandlers.
+func NewMorphologyHandlers(service *MorphologyService) *MorphologyHandlers {
+	return &MorphologyHandlers{service: service}
+}
+
+// HandleDecompose godoc
+// @Summary Split a lujvo into rafsi
+// @Description Classifies a word by its shape and splits a lujvo into its rafsi, following the morphology rules of the CLL. Each rafsi is matched to the gismu or cmavo it stands for. Readings are ranked by confidence: rafsi missing from the dictionary and broken hyphen rules make a reading less likely. The word does not have to be in the dictionary. `h` may be used for the apostrophe.
+// @Tags morphology
+// @Produce json
+// @Param word query string true "The word to analyze, e.g. klamlatu"
+// @Success 200 {object} DecomposeResponse "Kind and readings of the word"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing word or not a Lojban word"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/morphology/decompose [get]
+func (h *MorphologyHandlers) HandleDecompose() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q DecomposeQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		result, err := h.service.Decompose(r.Context(), q.Word)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,265 @@
+// Package morphology, as part of the dictionary module.
+// This file, `rules.go`, holds the parts of Lojban morphology (CLL chapter 4) needed to take
+// lujvo apart: the letter classes, the consonant cluster rules and the rafsi shapes. Splitting
+// is done on shapes alone; whether a piece is a real rafsi is decided later against the
+// dictionary (see `service.go`).
+//
+// A lujvo is a chain of rafsi, possibly glued with hyphens:
+//   - CVC, CCV and CVV (also CV'V) rafsi anywhere, the last one ending in a vowel;
+//   - the four-letter rafsi CVCC or CCVC, always followed by a `y` hyphen;
+//   - a whole gismu (CVCCV or CCVCV) as the last part;
+//   - a `y` hyphen where two consonants would otherwise clash, and an `r` hyphen (`n` before
+//     an r) after a CVV rafsi at the start, so the word doesn't fall apart into cmavo.
+package morphology
+
+import (
+	"slices"
+	"strings"
+)
+
+// Rafsi forms.
+const (
+	FormCVC   = "CVC"
+	FormCCV   = "CCV"
+	FormCVV   = "CVV"
+	FormCVCC  = "CVCC"
+	FormCCVC  = "CCVC"
+	FormCVCCV = "CVCCV"
+	FormCCVCV = "CCVCV"
+)
+
+// maxCandidates bounds how many ways of splitting a word are considered.
+const maxCandidates = 32
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) >= 0
+}
+
+func isConsonant(c byte) bool {
+	return strings.IndexByte("bcdfgjklmnprstvxz", c) >= 0
+}
+
+// initialPairs are the 48 consonant pairs a word or a CCV rafsi may start with.
+var initialPairs = map[string]bool{}
+
+func init() {
+	for _, p := range strings.Fields(`bl br cf ck cl cm cn cp cr ct dj dr dz fl fr gl gr jb jd jg jm jv
+		kl kr ml mr pl pr sf sk sl sm sn sp sr st tc tr ts vl vr xl xr zb zd zg zm zv`) {
+		initialPairs[p] = true
+	}
+}
+
+// permissiblePair reports whether two consonants may stand next to each other inside a word:
+// not the same letter twice, not a voiced next to an unvoiced consonant, not two of c, j, s
+// and z, and none of cx, kx, xc, xk and mz.
+func permissiblePair(a, b byte) bool {
+	if a == b {
+		return false
+	}
+	voiced := func(c byte) bool { return strings.IndexByte("bdgjvz", c) >= 0 }
+	unvoiced := func(c byte) bool { return strings.IndexByte("cfkpstx", c) >= 0 }
+	if voiced(a) && unvoiced(b) || unvoiced(a) && voiced(b) {
+		return false
+	}
+	sibilant := func(c byte) bool { return strings.IndexByte("cjsz", c) >= 0 }
+	if sibilant(a) && sibilant(b) {
+		return false
+	}
+	switch string([]byte{a, b}) {
+	case "cx", "kx", "xc", "xk", "mz":
+		return false
+	}
+	return true
+}
+
+// forbiddenTriple reports the four consonant triples that are never allowed.
+func forbiddenTriple(s string) bool {
+	switch s {
+	case "ndj", "ndz", "ntc", "nts":
+		return true
+	}
+	return false
+}
+
+// normalizeWord lowercases a word, accepts `h` for the apostrophe and drops the pauses
+// (periods) around it. It reports false if what is left isn't a single word in Lojban letters.
+func normalizeWord(word string) (string, bool) {
+	word = strings.Trim(strings.ToLower(strings.TrimSpace(word)), ".")
+	word = strings.ReplaceAll(word, "h", "'")
+	if word == "" || len(word) > 64 {
+		return "", false
+	}
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		if !isVowel(c) && !isConsonant(c) && c != 'y' && c != '\'' {
+			return "", false
+		}
+	}
+	return word, true
+}
+
+// shape returns the consonant/vowel pattern of a word, e.g. "CCVCV" for "klama". The
+// apostrophe and y are kept as they are.
+func shape(word string) string {
+	var b strings.Builder
+	for i := 0; i < len(word); i++ {
+		switch c := word[i]; {
+		case isVowel(c):
+			b.WriteByte('V')
+		case isConsonant(c):
+			b.WriteByte('C')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// isGismuShape reports whether a word has the shape of a gismu.
+func isGismuShape(word string) bool {
+	switch shape(word) {
+	case FormCVCCV:
+		return permissiblePair(word[2], word[3])
+	case FormCCVCV:
+		return initialPairs[word[:2]]
+	}
+	return false
+}
+
+// hasCluster reports whether a word contains two consonants in a row; brivla always do, cmavo
+// never.
+func hasCluster(word string) bool {
+	return strings.Contains(shape(word), "CC")
+}
+
+// segment is one piece of a split word.
+type segment struct {
+	rafsi  string
+	form   string
+	hyphen string // Hyphen letter following the rafsi, if any
+}
+
+// splitLujvo returns the ways `word` can be read as a chain of rafsi, by shape alone. Hyphen
+// rules are not enforced here; `hyphenIssues` reports where a split breaks them.
+func splitLujvo(word string) [][]segment {
+	var (
+		results [][]segment
+		walk    func(pos int, parts []segment)
+	)
+	walk = func(pos int, parts []segment) {
+		if len(results) >= maxCandidates {
+			return
+		}
+		if pos == len(word) {
+			last := parts[len(parts)-1]
+			if len(parts) >= 2 && last.hyphen == "" && isVowel(last.rafsi[len(last.rafsi)-1]) {
+				results = append(results, slices.Clone(parts))
+			}
+			return
+		}
+		rest := word[pos:]
+		for _, piece := range rafsiAt(rest) {
+			next := pos + len(piece.rafsi)
+			final := next == len(word)
+			switch piece.form {
+			case FormCVCCV, FormCCVCV:
+				if final {
+					walk(next, append(parts, piece))
+				}
+				continue
+			case FormCVCC, FormCCVC:
+				// Four-letter rafsi are always followed by a y hyphen.
+				if next < len(word) && word[next] == 'y' && next+1 < len(word) {
+					piece.hyphen = "y"
+					walk(next+1, append(parts, piece))
+				}
+				continue
+			}
+			walk(next, append(parts, piece))
+			if final {
+				continue
+			}
+			switch h := word[next]; {
+			case h == 'y' && isConsonant(piece.rafsi[len(piece.rafsi)-1]) && next+1 < len(word):
+				piece.hyphen = "y"
+				walk(next+1, append(parts, piece))
+			case (h == 'r' || h == 'n') && piece.form == FormCVV && len(parts) == 0 && next+1 < len(word):
+				piece.hyphen = string(h)
+				walk(next+1, append(parts, piece))
+			}
+		}
+	}
+	walk(0, nil)
+	return results
+}
+
+// rafsiAt returns the rafsi shapes `s` can start with.
+func rafsiAt(s string) []segment {
+	var pieces []segment
+	sh := shape(s)
+	has := func(form string) bool { return strings.HasPrefix(sh, form) }
+	if has("CV'V") {
+		pieces = append(pieces, segment{rafsi: s[:4], form: FormCVV})
+	}
+	if has("CVV") {
+		switch s[1:3] {
+		case "ai", "ei", "oi", "au":
+			pieces = append(pieces, segment{rafsi: s[:3], form: FormCVV})
+		}
+	}
+	if has("CCV") && initialPairs[s[:2]] {
+		pieces = append(pieces, segment{rafsi: s[:3], form: FormCCV})
+		if has("CCVC") {
+			pieces = append(pieces, segment{rafsi: s[:4], form: FormCCVC})
+		}
+		if has("CCVCV") {
+			pieces = append(pieces, segment{rafsi: s[:5], form: FormCCVCV})
+		}
+	}
+	if has("CVC") {
+		pieces = append(pieces, segment{rafsi: s[:3], form: FormCVC})
+		if has("CVCC") && permissiblePair(s[2], s[3]) {
+			pieces = append(pieces, segment{rafsi: s[:4], form: FormCVCC})
+			if has("CVCCV") {
+				pieces = append(pieces, segment{rafsi: s[:5], form: FormCVCCV})
+			}
+		}
+	}
+	return pieces
+}
+
+// hyphenIssues lists where a split breaks the hyphenation rules.
+func hyphenIssues(parts []segment) []string {
+	var issues []string
+	first := parts[0]
+	if first.form == FormCVV {
+		needsHyphen := !(len(parts) == 2 && parts[1].form == FormCCV)
+		switch {
+		case needsHyphen && first.hyphen == "":
+			issues = append(issues, "a CVV rafsi at the start needs an r hyphen (n before r): "+first.rafsi)
+		case !needsHyphen && first.hyphen != "":
+			issues = append(issues, "unneeded "+first.hyphen+" hyphen after "+first.rafsi)
+		case first.hyphen == "r" && parts[1].rafsi[0] == 'r':
+			issues = append(issues, "the hyphen before an r is n, not r: "+first.rafsi)
+		case first.hyphen == "n" && parts[1].rafsi[0] != 'r':
+			issues = append(issues, "the n hyphen is only used before an r: "+first.rafsi)
+		}
+	}
+	for i := 0; i+1 < len(parts); i++ {
+		cur, next := parts[i], parts[i+1]
+		last := cur.rafsi[len(cur.rafsi)-1]
+		// Four-letter rafsi always take a y, which the split already checked.
+		if !isConsonant(last) || cur.form == FormCVCC || cur.form == FormCCVC {
+			continue
+		}
+		clash := !permissiblePair(last, next.rafsi[0]) ||
+			isConsonant(next.rafsi[1]) && forbiddenTriple(string(last)+next.rafsi[:2])
+		switch {
+		case clash && cur.hyphen == "":
+			issues = append(issues, "a y hyphen is needed between "+cur.rafsi+" and "+next.rafsi)
+		case !clash && cur.hyphen == "y":
+			issues = append(issues, "unneeded y hyphen between "+cur.rafsi+" and "+next.rafsi)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,154 @@
+package morphology
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// splitString renders a split as its rafsi separated by spaces, each followed by `-` and its
+// hyphen if it has one.
+func splitString(parts []segment) string {
+	var s []string
+	for _, p := range parts {
+		if p.hyphen != "" {
+			s = append(s, p.rafsi+"-"+p.hyphen)
+		} else {
+			s = append(s, p.rafsi)
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestNormalizeWord(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+		ok   bool
+	}{
+		{"klama", "klama", true},
+		{" .Lojban. ", "lojban", true},
+		{"fuhivla", "fu'ivla", true},
+		{"", "", false},
+		{"mi klama", "", false},
+		{"qa", "", false},
+		{strings.Repeat("a", 65), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := normalizeWord(tt.word)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("normalizeWord(%q) = %q, %v, want %q, %v", tt.word, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIsGismuShape(t *testing.T) {
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{"klama", true},
+		{"lojbo", true},
+		{"selfu", true},
+		{"mlatu", true},
+		{"xamgu", true},
+		// Not one of the 48 initial pairs.
+		{"tlama", false},
+		// A voiced consonant next to an unvoiced one.
+		{"labta", false},
+		{"brivla", false},
+		{"coi", false},
+	}
+	for _, tt := range tests {
+		if got := isGismuShape(tt.word); got != tt.want {
+			t.Errorf("isGismuShape(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestSplitLujvo(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"klamlatu", []string{"kla mlatu"}},
+		{"brivla", []string{"bri vla"}},
+		{"gerzda", []string{"ger zda"}},
+		{"zbasai", []string{"zba sai"}},
+		{"jbobau", []string{"jbo bau"}},
+		{"bavlamdei", []string{"bav lam dei"}},
+		{"fu'ivla", []string{"fu'i vla"}},
+		{"nunynau", []string{"nun-y nau"}},
+		{"sairgau", []string{"sai-r gau"}},
+		{"sainre'u", []string{"sai-n re'u"}},
+		{"cirlyselfu", []string{"cirl-y selfu"}},
+		{"ckafybo'e", []string{"ckaf-y bo'e"}},
+		// Gismu and cmevla are not chains of rafsi.
+		{"klama", nil},
+		{"lojbo", nil},
+		{"lojban", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, parts := range splitLujvo(tt.word) {
+			got = append(got, splitString(parts))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitLujvo(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestHyphenIssues(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"klamlatu", nil},
+		{"saikla", nil},
+		{"sairgau", nil},
+		{"sainre'u", nil},
+		{"nunynau", nil},
+		{"saigau", []string{"a CVV rafsi at the start needs an r hyphen (n before r): sai"}},
+		{"sairre'u", []string{"the hyphen before an r is n, not r: sai"}},
+		{"nunnau", []string{"a y hyphen is needed between nun and nau"}},
+		{"gerydja", []string{"unneeded y hyphen between ger and dja"}},
+	}
+	for _, tt := range tests {
+		splits := splitLujvo(tt.word)
+		if len(splits) != 1 {
+			t.Errorf("splitLujvo(%q) has %d splits, want 1", tt.word, len(splits))
+			continue
+		}
+		if got := hyphenIssues(splits[0]); !slices.Equal(got, tt.want) {
+			t.Errorf("hyphenIssues(%s) = %q, want %q", splitString(splits[0]), got, tt.want)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	ix := &rafsiIndex{
+		rafsi: map[string]string{"kla": "klama", "sai": "sance", "gau": "gasnu"},
+		gismu: map[string]string{"mlat": "mlatu"},
+	}
+	tests := []struct {
+		word       string
+		tanru      []string
+		confidence float64
+	}{
+		{"klamlatu", []string{"klama", "mlatu"}, 1},
+		// An unknown rafsi shows as itself.
+		{"brivla", []string{"bri", "vla"}, 0.09},
+		{"saigau", []string{"sance", "gasnu"}, 0.5},
+	}
+	for _, tt := range tests {
+		readings := rank(ix, splitLujvo(tt.word))
+		if len(readings) != 1 {
+			t.Errorf("rank(%q) has %d readings, want 1", tt.word, len(readings))
+			continue
+		}
+		if got := readings[0]; !slices.Equal(got.Tanru, tt.tanru) || got.Confidence != tt.confidence {
+			t.Errorf("rank(%q) = %q at %v, want %q at %v", tt.word, got.Tanru, got.Confidence, tt.tanru, tt.confidence)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package morphology, as part of the dictionary module.
+// This file, `service.go`, decomposes words. The splits from `rules.go` are checked against the
+// rafsi of the dictionary: every rafsi found there, and every hyphen rule kept, makes a reading
+// more likely. The rafsi table is small and rarely changes, so it is kept in memory and
+// reloaded every `rafsiIndexTTL`.
+package morphology
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// rafsiIndexTTL is how long the in-memory rafsi table is used before it is reloaded.
+const rafsiIndexTTL = 10 * time.Minute
+
+const (
+	// unknownRafsiFactor scales the score of a reading for each rafsi not in the dictionary.
+	unknownRafsiFactor = 0.3
+	// issueFactor scales the score of a reading for each hyphen rule it breaks.
+	issueFactor = 0.5
+)
+
+// rafsiIndex maps rafsi to the words they stand for.
+type rafsiIndex struct {
+	rafsi  map[string]string   // Three-letter (and CV'V) rafsi -> gismu or cmavo
+	gismu  map[string]string   // First four letters of a gismu -> gismu
+	byWord map[string][]string // gismu or cmavo -> its rafsi
+}
+
+// lookup returns the word a rafsi of the given form stands for.
+func (ix *rafsiIndex) lookup(rafsi, form string) (string, bool) {
+	switch form {
+	case FormCVCC, FormCCVC:
+		word, ok := ix.gismu[rafsi]
+		return word, ok
+	case FormCVCCV, FormCCVCV:
+		word, ok := ix.gismu[rafsi[:4]]
+		return word, ok && word == rafsi
+	}
+	word, ok := ix.rafsi[rafsi]
+	return word, ok
+}
+
+// MorphologyService provides the morphology API.
+type MorphologyService struct {
+	db *pgxpool.Pool
+
+	mu       sync.Mutex
+	index    *rafsiIndex
+	loadedAt time.Time
+}
+
+// NewMorphologyService creates a new MorphologyService.
+func NewMorphologyService(db *pgxpool.Pool) *MorphologyService {
+	return &MorphologyService{db: db}
+}
+
+// rafsiIndex returns the rafsi table, loading it if it is missing or stale.
+func (s *MorphologyService) rafsiIndex(ctx context.Context) (*rafsiIndex, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index != nil && time.Since(s.loadedAt) < rafsiIndexTTL {
+		return s.index, nil
+	}
+
+	// Official words come first so they keep a rafsi that an experimental word also claims.
+	rows, err := s.db.Query(ctx, `
+		SELECT v.word, COALESCE(v.rafsi, ''), COALESCE(t.descriptor, '') ILIKE '%gismu%'
+		FROM valsi v
+		LEFT JOIN valsitypes t ON t.typeid = v.typeid
+		WHERE COALESCE(v.rafsi, '') <> '' OR t.descriptor ILIKE '%gismu%'
+		ORDER BY COALESCE(t.descriptor, '') ILIKE 'experimental%', v.word`)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load rafsi", err)
+	}
+	defer rows.Close()
+	ix := &rafsiIndex{rafsi: map[string]string{}, gismu: map[string]string{}, byWord: map[string][]string{}}
+	for rows.Next() {
+		var (
+			word, rafsi string
+			isGismu     bool
+		)
+		if err := rows.Scan(&word, &rafsi, &isGismu); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read rafsi", err)
+		}
+		for _, r := range strings.Fields(rafsi) {
+			if _, taken := ix.rafsi[r]; !taken {
+				ix.rafsi[r] = word
+			}
+			ix.byWord[word] = append(ix.byWord[word], r)
+		}
+		if isGismu && isGismuShape(word) {
+			if _, taken := ix.gismu[word[:4]]; !taken {
+				ix.gismu[word[:4]] = word
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to load rafsi", err)
+	}
+	s.index, s.loadedAt = ix, time.Now()
+	return ix, nil
+}
+
+// Decompose classifies a word by its shape and, for a lujvo, returns the ways it splits into
+// rafsi, most likely first.
+func (s *MorphologyService) Decompose(ctx context.Context, word string) (*DecomposeResponse, error) {
+	normalized, ok := normalizeWord(word)
+	if !ok {
+		return nil, apperror.NewBadRequestError("word must be a single Lojban word", nil)
+	}
+	ix, err := s.rafsiIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &DecomposeResponse{Word: normalized, Alternatives: []Decomposition{}}
+	var descriptor string
+	err = s.db.QueryRow(ctx, `
+		SELECT COALESCE(t.descriptor, '')
+		FROM valsi v LEFT JOIN valsitypes t ON t.typeid = v.typeid
+		WHERE v.word = $1`, normalized).Scan(&descriptor)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewDatabaseError("failed to look up word", err)
+	}
+	if err == nil {
+		resp.DictionaryType = &descriptor
+	}
+	resp.Rafsi = ix.byWord[normalized]
+
+	switch {
+	case isConsonant(normalized[len(normalized)-1]):
+		resp.Kind = KindCmene
+	case !hasCluster(normalized):
+		resp.Kind = KindCmavo
+	case isGismuShape(normalized):
+		resp.Kind = KindGismu
+	default:
+		readings := rank(ix, splitLujvo(normalized))
+		if len(readings) == 0 {
+			resp.Kind = KindFuhivla
+			break
+		}
+		resp.Kind = KindLujvo
+		resp.Decomposition = &readings[0]
+		resp.Alternatives = readings[1:]
+	}
+	return resp, nil
+}
+
+// rank scores the splits of a word and orders them, most likely first. A reading starts at 1
+// and is scaled down for every unknown rafsi and broken rule; its confidence is that score
+// weighted by its share of the scores of all readings, so two equally good readings get half
+// each.
+func rank(ix *rafsiIndex, splits [][]segment) []Decomposition {
+	readings := make([]Decomposition, 0, len(splits))
+	scores := make([]float64, 0, len(splits))
+	var total float64
+	for _, parts := range splits {
+		d := Decomposition{Parts: make([]RafsiPart, 0, len(parts)), Tanru: make([]string, 0, len(parts))}
+		score := 1.0
+		for _, p := range parts {
+			part := RafsiPart{Rafsi: p.rafsi, Form: p.form, Hyphen: p.hyphen}
+			if word, ok := ix.lookup(p.rafsi, p.form); ok {
+				part.Valsi = &word
+				d.Tanru = append(d.Tanru, word)
+			} else {
+				score *= unknownRafsiFactor
+				d.Tanru = append(d.Tanru, p.rafsi)
+			}
+			d.Parts = append(d.Parts, part)
+		}
+		d.Issues = hyphenIssues(parts)
+		if d.Issues == nil {
+			d.Issues = []string{}
+		}
+		score *= math.Pow(issueFactor, float64(len(d.Issues)))
+		readings = append(readings, d)
+		scores = append(scores, score)
+		total += score
+	}
+	for i := range readings {
+		readings[i].Confidence = math.Round(scores[i]*scores[i]/total*100) / 100
+	}
+	slices.SortStableFunc(readings, func(a, b Decomposition) int {
+		return cmp.Or(cmp.Compare(b.Confidence, a.Confidence), cmp.Compare(len(a.Parts), len(b.Parts)))
+	})
+	return readings
+}
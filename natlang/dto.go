@@ -0,0 +1,87 @@
+// Package natlang, as part of the dictionary module.
+// This file, `dto.go`, defines the request and response bodies of the natural-language word
+// API. A natural-language word ("natlangword") is a word of a language other than Lojban,
+// e.g. English "go" in the sense "travel"; linking it to a definition makes it a gloss of
+// that definition (place 0) or a keyword of one of its places.
+package natlang
+
+import (
+	"time"
+
+	"github.com/user/lensisku-go/validation"
+)
+
+// NatlangWordResponse is a natural-language word with the definitions it is linked to.
+// @Description A natural-language word and the Lojban definitions it glosses
+type NatlangWordResponse struct {
+	// example: 321
+	WordID int32 `json:"word_id"`
+	// Language tag
+	// example: "en"
+	Language string `json:"language"`
+	// example: "go"
+	Word string `json:"word"`
+	// Sense that tells homonyms apart
+	// example: "travel"
+	Meaning *string `json:"meaning,omitempty"`
+	// Who added the word
+	// example: 42
+	UserID   int32   `json:"user_id"`
+	Username *string `json:"username,omitempty"`
+	// example: "2024-01-15T10:30:00Z"
+	CreatedAt   time.Time          `json:"created_at"`
+	Definitions []LinkedDefinition `json:"definitions"`
+}
+
+// LinkedDefinition is one link between a natural-language word and a definition.
+// @Description A definition a natural-language word is linked to
+type LinkedDefinition struct {
+	// example: 12345
+	DefinitionID int32 `json:"definition_id"`
+	// example: 678
+	ValsiID int32 `json:"valsi_id"`
+	// example: "klama"
+	Valsi string `json:"valsi"`
+	// 0 for a gloss of the whole word, otherwise the place the word is a keyword for
+	// example: 1
+	Place int32 `json:"place"`
+	// example: "$x_{1}$ comes/goes to destination $x_{2}$ ..."
+	Definition string `json:"definition"`
+}
+
+// NatlangSearchQuery is a search for natural-language words by gloss.
+type NatlangSearchQuery struct {
+	Query    string `form:"q" validate:"required"`
+	Language string `form:"language"` // Language tag; any language if empty
+	validation.Pagination
+}
+
+// CreateNatlangWordRequest is the body of a new natural-language word.
+// @Description Request body for adding a natural-language word
+type CreateNatlangWordRequest struct {
+	// Language tag
+	// example: "en"
+	Language string `json:"language" validate:"required"`
+	// example: "go"
+	Word string `json:"word" validate:"required"`
+	// example: "travel"
+	Meaning string `json:"meaning,omitempty"`
+}
+
+// UpdateNatlangWordRequest changes a natural-language word. Omitted fields are kept; an empty
+// meaning clears it.
+// @Description Request body for changing a natural-language word
+type UpdateNatlangWordRequest struct {
+	Word    *string `json:"word,omitempty"`
+	Meaning *string `json:"meaning,omitempty"`
+}
+
+// LinkDefinitionRequest links a natural-language word to a definition.
+// @Description Request body for linking a natural-language word to a definition
+type LinkDefinitionRequest struct {
+	// example: 12345
+	DefinitionID int32 `json:"definition_id" validate:"required,min=1"`
+	// 0 for a gloss, otherwise the place (1-based) the word is a keyword for
+	// example: 1
+	Place int32 `json:"place" validate:"min=0"`
+}
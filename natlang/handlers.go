@@ -0,0 +1,315 @@
+// Package natlang encapsulates natural-language words (e.g. English "go") and their links to
+// the Lojban definitions they gloss.
+// This file, `handlers.go`, serves /api/v1/natlangwords: searching, reading and editing
+// natural-language words, and linking them to definitions.
+package natlang
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// NatlangHandlers provides HTTP handlers for natural-language words.
+type NatlangHandlers struct {
+	service *NatlangService
+}
+
+// NewNatlangHandlers creates new NatlangHandlers.
+func NewNatlangHandlers(service *NatlangService) *NatlangHandlers {
+	return &NatlangHandlers{service: service}
+}
+
+// HandleSearchWords godoc
+// @Summary Search natural-language words
+// @Description Finds natural-language words by gloss (prefix match first, then trigram similarity), each with the Lojban definitions it is linked to.
+// @Tags natlangwords
+// @Produce json
+// @Param q query string true "Search text"
+// @Param language query string false "Language tag, e.g. en"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[NatlangWordResponse] "Matches, best first"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing or invalid query"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/natlangwords [get]
+func (h *NatlangHandlers) HandleSearchWords() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q NatlangSearchQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		results, err := h.service.Search(r.Context(), q.Query, q.Language, q.Pagination)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		validation.WritePage(w, r, results)
+	}
+}
+
+// HandleGetWord godoc
+// @Summary Get a natural-language word
+// @Description Returns a natural-language word with the definitions it is linked to.
+// @Tags natlangwords
+// @Produce json
+// @Param wordID path int true "Word ID"
+// @Success 200 {object} NatlangWordResponse "Word"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid word ID"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/natlangwords/{wordID} [get]
+func (h *NatlangHandlers) HandleGetWord() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wordID, err := int32Param(r, "wordID")
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		word, err := h.service.Get(r.Context(), wordID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, word)
+	}
+}
+
+// HandleCreateWord godoc
+// @Summary Add a natural-language word
+// @Description Adds a word of a natural language. Homonyms are told apart by their meaning; the same word with the same meaning can't be added twice.
+// @Tags natlangwords
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param word body CreateNatlangWordRequest true "New word"
+// @Success 201 {object} NatlangWordResponse "Created word"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing fields or unknown language"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Word already exists"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/natlangwords [post]
+func (h *NatlangHandlers) HandleCreateWord() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req CreateNatlangWordRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		word, err := h.service.Create(r.Context(), userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusCreated, word)
+	}
+}
+
+// HandleUpdateWord godoc
+// @Summary Change a natural-language word
+// @Description Changes the spelling or meaning of a word. Only the user who added it, trusted users and admins may change it.
+// @Tags natlangwords
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param wordID path int true "Word ID"
+// @Param word body UpdateNatlangWordRequest true "Changed fields"
+// @Success 200 {object} NatlangWordResponse "Updated word"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid payload"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not allowed to change this word"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Word already exists"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/natlangwords/{wordID} [put]
+func (h *NatlangHandlers) HandleUpdateWord() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		wordID, err := int32Param(r, "wordID")
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		var req UpdateNatlangWordRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		word, err := h.service.Update(r.Context(), wordID, userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, word)
+	}
+}
+
+// HandleDeleteWord godoc
+// @Summary Delete a natural-language word
+// @Description Deletes a word and its links to definitions. Only the user who added it or an admin may delete it.
+// @Tags natlangwords
+// @Security BearerAuth
+// @Param wordID path int true "Word ID"
+// @Success 204 "Deleted"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid word ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not allowed to delete this word"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Word still referenced"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/natlangwords/{wordID} [delete]
+func (h *NatlangHandlers) HandleDeleteWord() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		wordID, err := int32Param(r, "wordID")
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.service.Delete(r.Context(), wordID, userID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleLinkDefinition godoc
+// @Summary Link a word to a definition
+// @Description Makes the word a gloss (place 0) or the keyword of a place of a definition in the same language. Only the definition's author, trusted users and admins may do this.
+// @Tags natlangwords
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param wordID path int true "Word ID"
+// @Param link body LinkDefinitionRequest true "Definition and place"
+// @Success 201 {object} NatlangWordResponse "Word with its links"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid payload or language mismatch"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not allowed to change this definition"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word or definition not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Already linked"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/natlangwords/{wordID}/definitions [post]
+func (h *NatlangHandlers) HandleLinkDefinition() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		wordID, err := int32Param(r, "wordID")
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		var req LinkDefinitionRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		word, err := h.service.Link(r.Context(), wordID, userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusCreated, word)
+	}
+}
+
+// HandleUnlinkDefinition godoc
+// @Summary Unlink a word from a definition
+// @Description Removes the word as gloss or keyword of a definition. Only the definition's author, trusted users and admins may do this.
+// @Tags natlangwords
+// @Security BearerAuth
+// @Param wordID path int true "Word ID"
+// @Param definitionID path int true "Definition ID"
+// @Param place query int false "Place of the link (default 0, the gloss)"
+// @Success 204 "Unlinked"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid ID or place"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not allowed to change this definition"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word, definition or link not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/natlangwords/{wordID}/definitions/{definitionID} [delete]
+func (h *NatlangHandlers) HandleUnlinkDefinition() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		wordID, err := int32Param(r, "wordID")
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		definitionID, err := int32Param(r, "definitionID")
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		var place int64
+		if v := r.URL.Query().Get("place"); v != "" {
+			place, err = strconv.ParseInt(v, 10, 32)
+			if err != nil || place < 0 {
+				auth.WriteError(w, r, apperror.NewBadRequestError("place must be a non-negative integer", err))
+				return
+			}
+		}
+
+		if err := h.service.Unlink(r.Context(), wordID, definitionID, int32(place), userID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// int32Param parses a positive ID path parameter.
+func int32Param(r *http.Request, name string) (int32, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 32)
+	if err != nil || id < 1 {
+		return 0, apperror.NewBadRequestError("invalid "+name, err)
+	}
+	return int32(id), nil
+}
@@ -0,0 +1,83 @@
+-- name: GetWord :one
+SELECT n.wordid, l.tag, n.word, n.meaning, n.userid, u.username, n.time
+FROM natlangwords n
+JOIN languages l ON l.langid = n.langid
+LEFT JOIN users u ON u.userid = n.userid
+WHERE n.wordid = $1;
+
+-- name: CountWords :one
+-- CountWords counts the words SearchWords pages through.
+SELECT COUNT(*)
+FROM natlangwords n
+JOIN languages l ON l.langid = n.langid
+WHERE (n.word % @query::text OR n.word ILIKE @prefix::text)
+  AND (@language::text = '' OR lower(l.tag) = lower(@language::text));
+
+-- name: SearchWords :many
+-- SearchWords finds words resembling `query` or starting with `prefix`, prefix matches first,
+-- in the language `language`, or in all languages if it is empty.
+SELECT n.wordid, l.tag, n.word, n.meaning, n.userid, u.username, n.time
+FROM natlangwords n
+JOIN languages l ON l.langid = n.langid
+LEFT JOIN users u ON u.userid = n.userid
+WHERE (n.word % @query::text OR n.word ILIKE @prefix::text)
+  AND (@language::text = '' OR lower(l.tag) = lower(@language::text))
+ORDER BY (n.word ILIKE @prefix::text) DESC, similarity(n.word, @query::text) DESC, n.word, n.wordid
+LIMIT @page_size::bigint OFFSET @page_offset::bigint;
+
+-- name: ListLinkedDefinitions :many
+SELECT k.natlangwordid, d.definitionid, d.valsiid, v.word, k.place, d.definition
+FROM keywordmapping k
+JOIN definitions d ON d.definitionid = k.definitionid
+JOIN valsi v ON v.valsiid = d.valsiid
+WHERE k.natlangwordid = ANY(@word_ids::int[])
+ORDER BY k.natlangwordid, v.word, d.definitionid, k.place;
+
+-- name: GetLanguageID :one
+SELECT langid FROM languages WHERE lower(tag) = lower(@tag::text);
+
+-- name: InsertWord :one
+INSERT INTO natlangwords (langid, word, meaning, userid, time)
+VALUES (@langid, @word, NULLIF(@meaning::text, ''), @userid, @time)
+RETURNING wordid;
+
+-- name: LockWord :one
+-- LockWord locks the word row until the end of the transaction, and returns it with the role
+-- of the user changing it.
+SELECT n.langid, n.userid, n.word, COALESCE(n.meaning, '')::text AS meaning,
+       COALESCE((SELECT role FROM users WHERE userid = @user_id), '')::text AS role
+FROM natlangwords n
+WHERE n.wordid = @word_id
+FOR UPDATE;
+
+-- name: GetDefinitionOwner :one
+SELECT langid, userid FROM definitions WHERE definitionid = $1;
+
+-- name: DuplicateWordExists :one
+-- DuplicateWordExists reports whether another word than `except_id` has the same spelling and
+-- meaning in the language.
+SELECT EXISTS (
+    SELECT 1 FROM natlangwords
+    WHERE langid = @langid AND word = @word AND COALESCE(meaning, '') = @meaning::text AND wordid <> @except_id
+);
+
+-- name: UpdateWord :exec
+UPDATE natlangwords SET word = @word, meaning = NULLIF(@meaning::text, '') WHERE wordid = @wordid;
+
+-- name: DeleteWordLinks :exec
+DELETE FROM keywordmapping WHERE natlangwordid = $1;
+
+-- name: DeleteWord :exec
+DELETE FROM natlangwords WHERE wordid = $1;
+
+-- name: InsertLink :execrows
+-- InsertLink links a word to a place of a definition, unless it already is.
+INSERT INTO keywordmapping (natlangwordid, definitionid, place)
+SELECT @natlangwordid::int, @definitionid::int, @place::int
+WHERE NOT EXISTS (
+    SELECT 1 FROM keywordmapping
+    WHERE natlangwordid = @natlangwordid::int AND definitionid = @definitionid::int AND place = @place::int
+);
+
+-- name: DeleteLink :execrows
+DELETE FROM keywordmapping WHERE natlangwordid = $1 AND definitionid = $2 AND place = $3;
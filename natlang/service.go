@@ -0,0 +1,367 @@
+// Package natlang, as part of the dictionary module.
+// This file, `service.go`, manages natural-language words (`natlangwords`) and their links to
+// definitions (`keywordmapping`), and searches them by gloss. Comment threads can be about a
+// natural-language word (`threads.natlangwordid`); this is the API behind those IDs.
+//
+// Anyone logged in may add a word. Changing a word is for the user who added it, trusted users
+// and admins; deleting it for the user who added it and admins. Links change what a definition
+// means to readers, so they are for the definition's author, trusted users and admins.
+package natlang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/changelog"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/natlang/natlangdb"
+	"github.com/user/lensisku-go/validation"
+)
+
+// maxWordLength bounds words, meanings and search input.
+const maxWordLength = 100
+
+// NatlangService provides the natural-language word API. Its queries are in `queries.sql`,
+// compiled by sqlc into package natlangdb.
+type NatlangService struct {
+	db *pgxpool.Pool
+	q  *natlangdb.Queries
+}
+
+// NewNatlangService creates a new NatlangService.
+func NewNatlangService(db *pgxpool.Pool) *NatlangService {
+	return &NatlangService{db: db, q: natlangdb.New(db)}
+}
+
+// wordResponse converts a word row, without its links.
+func wordResponse(row natlangdb.GetWordRow) NatlangWordResponse {
+	return NatlangWordResponse{
+		WordID:      row.Wordid,
+		Language:    row.Tag,
+		Word:        row.Word,
+		Meaning:     row.Meaning,
+		UserID:      row.Userid,
+		Username:    row.Username,
+		CreatedAt:   time.Unix(int64(row.Time), 0).UTC(),
+		Definitions: []LinkedDefinition{},
+	}
+}
+
+// Search finds natural-language words resembling `query` (prefix matches first, then by
+// trigram similarity), optionally in one language, with the definitions they are linked to.
+// This is how a reader gets from "go" to klama.
+func (s *NatlangService) Search(ctx context.Context, query, language string, p validation.Pagination) (*validation.Page[NatlangWordResponse], error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, apperror.NewValidationError("search query must not be empty", nil)
+	}
+	if utf8.RuneCountInString(query) > maxWordLength {
+		return nil, apperror.NewValidationError("search query is too long", nil)
+	}
+	prefix := db.EscapeLike(query) + "%"
+
+	total, err := s.q.CountWords(ctx, natlangdb.CountWordsParams{Query: query, Prefix: prefix, Language: language})
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to count search results", err)
+	}
+
+	rows, err := s.q.SearchWords(ctx, natlangdb.SearchWordsParams{
+		Query:      query,
+		Prefix:     prefix,
+		Language:   language,
+		PageSize:   p.PerPage,
+		PageOffset: p.Offset(),
+	})
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to search words", err)
+	}
+	words := make([]NatlangWordResponse, 0, len(rows))
+	for _, row := range rows {
+		words = append(words, wordResponse(natlangdb.GetWordRow(row)))
+	}
+	if err := s.loadLinks(ctx, words); err != nil {
+		return nil, err
+	}
+	return validation.NewPage(words, total, p), nil
+}
+
+// Get returns one natural-language word with its links.
+func (s *NatlangService) Get(ctx context.Context, wordID int32) (*NatlangWordResponse, error) {
+	row, err := s.q.GetWord(ctx, wordID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("word with ID %d not found", wordID), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load word", err)
+	}
+	words := []NatlangWordResponse{wordResponse(row)}
+	if err := s.loadLinks(ctx, words); err != nil {
+		return nil, err
+	}
+	return &words[0], nil
+}
+
+// loadLinks fills in the definitions of `words` with a single query.
+func (s *NatlangService) loadLinks(ctx context.Context, words []NatlangWordResponse) error {
+	if len(words) == 0 {
+		return nil
+	}
+	index := make(map[int32]int, len(words))
+	ids := make([]int32, len(words))
+	for i, w := range words {
+		index[w.WordID] = i
+		ids[i] = w.WordID
+	}
+	rows, err := s.q.ListLinkedDefinitions(ctx, ids)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to load linked definitions", err)
+	}
+	for _, row := range rows {
+		w := &words[index[row.Natlangwordid]]
+		w.Definitions = append(w.Definitions, LinkedDefinition{
+			DefinitionID: row.Definitionid,
+			ValsiID:      row.Valsiid,
+			Valsi:        row.Word,
+			Place:        row.Place,
+			Definition:   row.Definition,
+		})
+	}
+	return nil
+}
+
+// Create adds a natural-language word. A word with the same spelling and meaning in the same
+// language is a conflict; homonyms are told apart by their meaning.
+func (s *NatlangService) Create(ctx context.Context, userID int, req CreateNatlangWordRequest) (*NatlangWordResponse, error) {
+	word, meaning := strings.TrimSpace(req.Word), strings.TrimSpace(req.Meaning)
+	language := strings.TrimSpace(req.Language)
+	if language == "" {
+		return nil, apperror.NewBadRequestError("language is required", nil)
+	}
+	if err := validateWord(word, meaning); err != nil {
+		return nil, err
+	}
+
+	var wordID int32
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		q := s.q.WithTx(tx)
+		langID, err := q.GetLanguageID(ctx, language)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewBadRequestError(fmt.Sprintf("unknown language %q", language), nil)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to look up language", err)
+		}
+		if err := checkDuplicate(ctx, q, langID, word, meaning, 0); err != nil {
+			return err
+		}
+
+		wordID, err = q.InsertWord(ctx, natlangdb.InsertWordParams{
+			Langid:  langID,
+			Word:    word,
+			Meaning: meaning,
+			Userid:  int32(userID),
+			Time:    int32(time.Now().Unix()),
+		})
+		if err != nil {
+			return apperror.NewDatabaseError("failed to create word", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, wordID)
+}
+
+// Update changes the spelling or meaning of a word.
+func (s *NatlangService) Update(ctx context.Context, wordID int32, userID int, req UpdateNatlangWordRequest) (*NatlangWordResponse, error) {
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		q := s.q.WithTx(tx)
+		current, err := lockWord(ctx, q, wordID, userID)
+		if err != nil {
+			return err
+		}
+		if current.Userid != int32(userID) && current.Role != auth.RoleTrusted && current.Role != auth.RoleAdmin {
+			return apperror.NewUnauthorizedError("only the user who added a word, trusted users and admins can change it", nil)
+		}
+
+		word, meaning := current.Word, current.Meaning
+		if req.Word != nil {
+			word = strings.TrimSpace(*req.Word)
+		}
+		if req.Meaning != nil {
+			meaning = strings.TrimSpace(*req.Meaning)
+		}
+		if err := validateWord(word, meaning); err != nil {
+			return err
+		}
+		if err := checkDuplicate(ctx, q, current.Langid, word, meaning, wordID); err != nil {
+			return err
+		}
+
+		if err := q.UpdateWord(ctx, natlangdb.UpdateWordParams{Word: word, Meaning: meaning, Wordid: wordID}); err != nil {
+			return apperror.NewDatabaseError("failed to update word", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, wordID)
+}
+
+// Delete removes a word and its links.
+func (s *NatlangService) Delete(ctx context.Context, wordID int32, userID int) error {
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		q := s.q.WithTx(tx)
+		current, err := lockWord(ctx, q, wordID, userID)
+		if err != nil {
+			return err
+		}
+		if current.Userid != int32(userID) && current.Role != auth.RoleAdmin {
+			return apperror.NewUnauthorizedError("only the user who added a word or an admin can delete it", nil)
+		}
+
+		for _, del := range []func(context.Context, int32) error{q.DeleteWordLinks, q.DeleteWord} {
+			if err := del(ctx, wordID); err != nil {
+				var pgErr *pgconn.PgError
+				if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+					return apperror.NewConflictError("the word is still referenced and can't be deleted", err).WithCode(apperror.CodeStillReferenced)
+				}
+				return apperror.NewDatabaseError("failed to delete word", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Link makes a word a gloss (place 0) or a place keyword of a definition in the same language.
+func (s *NatlangService) Link(ctx context.Context, wordID int32, userID int, req LinkDefinitionRequest) (*NatlangWordResponse, error) {
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		q := s.q.WithTx(tx)
+		current, err := lockWord(ctx, q, wordID, userID)
+		if err != nil {
+			return err
+		}
+		if err := checkDefinitionAccess(ctx, q, req.DefinitionID, current.Langid, userID, current.Role); err != nil {
+			return err
+		}
+
+		linked, err := q.InsertLink(ctx, natlangdb.InsertLinkParams{Natlangwordid: wordID, Definitionid: req.DefinitionID, Place: req.Place})
+		if err != nil {
+			return apperror.NewDatabaseError("failed to link word", err)
+		}
+		if linked == 0 {
+			return apperror.NewConflictError("the word is already linked to this place of the definition", nil).WithCode(apperror.CodeDuplicate)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, wordID)
+}
+
+// Unlink removes the link between a word and a place of a definition.
+func (s *NatlangService) Unlink(ctx context.Context, wordID, definitionID int32, place int32, userID int) error {
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		q := s.q.WithTx(tx)
+		current, err := lockWord(ctx, q, wordID, userID)
+		if err != nil {
+			return err
+		}
+		if err := checkDefinitionAccess(ctx, q, definitionID, current.Langid, userID, current.Role); err != nil {
+			return err
+		}
+
+		unlinked, err := q.DeleteLink(ctx, natlangdb.DeleteLinkParams{Natlangwordid: wordID, Definitionid: definitionID, Place: place})
+		if err != nil {
+			return apperror.NewDatabaseError("failed to unlink word", err)
+		}
+		if unlinked == 0 {
+			return apperror.NewNotFoundError("the word isn't linked to this place of the definition", nil)
+		}
+		return nil
+	})
+}
+
+// lockWord locks the word row until the end of the transaction of `q`.
+func lockWord(ctx context.Context, q *natlangdb.Queries, wordID int32, userID int) (*natlangdb.LockWordRow, error) {
+	w, err := q.LockWord(ctx, natlangdb.LockWordParams{UserID: int32(userID), WordID: wordID})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("word with ID %d not found", wordID), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load word", err)
+	}
+	return &w, nil
+}
+
+// checkDefinitionAccess makes sure the definition exists, is in the word's language and may be
+// changed by the user.
+func checkDefinitionAccess(ctx context.Context, q *natlangdb.Queries, definitionID, langID int32, userID int, role string) error {
+	def, err := q.GetDefinitionOwner(ctx, definitionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperror.NewNotFoundError(fmt.Sprintf("definition with ID %d not found", definitionID), nil)
+	}
+	if err != nil {
+		return apperror.NewDatabaseError("failed to load definition", err)
+	}
+	if def.Langid != langID {
+		return apperror.NewBadRequestError("the word and the definition are in different languages", nil)
+	}
+	if def.Userid != int32(userID) && role != auth.RoleTrusted && role != auth.RoleAdmin {
+		return apperror.NewUnauthorizedError("only the definition's author, trusted users and admins can change its glosses", nil)
+	}
+	return nil
+}
+
+// checkDuplicate reports a conflict if another word (not `exceptID`) has the same spelling and
+// meaning in the language.
+func checkDuplicate(ctx context.Context, q *natlangdb.Queries, langID int32, word, meaning string, exceptID int32) error {
+	exists, err := q.DuplicateWordExists(ctx, natlangdb.DuplicateWordExistsParams{
+		Langid:   langID,
+		Word:     word,
+		Meaning:  meaning,
+		ExceptID: exceptID,
+	})
+	if err != nil {
+		return apperror.NewDatabaseError("failed to check for duplicates", err)
+	}
+	if exists {
+		return apperror.NewConflictError("this word already exists with the same meaning", nil).WithCode(apperror.CodeDuplicate)
+	}
+	return nil
+}
+
+func validateWord(word, meaning string) error {
+	if word == "" {
+		return apperror.NewBadRequestError("word is required", nil)
+	}
+	if utf8.RuneCountInString(word) > maxWordLength || utf8.RuneCountInString(meaning) > maxWordLength {
+		return apperror.NewBadRequestError(fmt.Sprintf("words and meanings are limited to %d characters", maxWordLength), nil)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Package notifications, as part of the notifications module.
+// This file, `dto.go`, defines the request and response bodies of the notification endpoints.
+package notifications
+
+import (
+	"time"
+
+	"github.com/user/lensisku-go/validation"
+)
+
+// ListQuery filters a user's notifications.
+type ListQuery struct {
+	// Only notifications not yet marked read
+	Unread bool `form:"unread"`
+	validation.Pagination
+}
+
+// Notification is an in-app notification, as its recipient sees it.
+// @Description A notification about a comment, a mention or a moderation decision
+type Notification struct {
+	// example: 1017
+	ID int64 `json:"id"`
+	// reply, mention, comment (on a subscribed word), revision_approved, revision_rejected,
+	// example_approved or example_rejected
+	// example: "mention"
+	Type string `json:"type"`
+	// example: "selpa'i mentioned you in a comment"
+	Message string `json:"message"`
+	// Where the notification leads on the website, if anywhere
+	Link    *string `json:"link,omitempty"`
+	ValsiID *int32  `json:"valsi_id,omitempty"`
+	// example: 5521
+	CommentID *int32 `json:"comment_id,omitempty"`
+	// The user whose action caused the notification; absent if the account no longer exists
+	ActorID       *int32  `json:"actor_id,omitempty"`
+	ActorUsername *string `json:"actor_username,omitempty"`
+	// example: "2024-01-15T10:30:00Z"
+	CreatedAt time.Time `json:"created_at"`
+	// Absent while unread
+	ReadAt *time.Time `json:"read_at,omitempty"`
+}
+
+// UnreadCountResponse is the number of unread notifications.
+// @Description The number shown on the bell icon
+type UnreadCountResponse struct {
+	// example: 3
+	Count int64 `json:"count"`
+}
+
+// MarkAllReadResponse reports how many notifications were marked read.
+// @Description Result of marking all notifications read
+type MarkAllReadResponse struct {
+	// example: 3
+	Marked int64 `json:"marked"`
+}
@@ -0,0 +1,156 @@
+// Package notifications delivers in-app notifications, the ones behind the bell icon of the
+// website, and serves them to their recipients (see `service.go`).
+// This file, `fanout.go`, notifies about new comments: subscribers of the word the comment is
+// about, the author of the comment being replied to, and users mentioned with @username.
+//
+// Posting a comment only records a `CommentEvent` as a job in the same transaction (see
+// `EnqueueCommentEvent`); the job workers fan it out afterwards. A word with thousands of
+// subscribers therefore doesn't slow down the request, and an event is never lost or sent for
+// a comment whose transaction rolled back.
+// In Nest.js terms this is an event emitter whose listeners run on a BullMQ worker.
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/jobs"
+)
+
+// CommentJobType is the job type of comment events; the payload is a `CommentEvent`.
+const CommentJobType = "notifications.comment"
+
+// Notification types written by the fan-out.
+const (
+	TypeReply   = "reply"
+	TypeMention = "mention"
+	// TypeComment is a new comment on a subscribed word, written by notify_valsi_subscribers().
+	TypeComment = "comment"
+)
+
+// maxMentions caps how many users one comment can notify by mentioning them.
+const maxMentions = 20
+
+// CommentEvent describes a newly posted comment.
+type CommentEvent struct {
+	CommentID int32 `json:"comment_id"`
+	ThreadID  int32 `json:"thread_id"`
+	AuthorID  int32 `json:"author_id"`
+	// ParentID is the comment replied to, if any.
+	ParentID *int32 `json:"parent_id,omitempty"`
+	// ValsiID and ValsiWord are set when the thread is about a word; its subscribers are notified.
+	ValsiID   *int32 `json:"valsi_id,omitempty"`
+	ValsiWord string `json:"valsi_word,omitempty"`
+	// Link points to the comment on the website; empty when FRONTEND_URL isn't configured.
+	Link string `json:"link,omitempty"`
+	// Mentions are the lowercased usernames mentioned in the comment text (see `ExtractMentions`).
+	Mentions []string `json:"mentions,omitempty"`
+}
+
+// EnqueueCommentEvent records the event in the caller's transaction.
+func EnqueueCommentEvent(ctx context.Context, queue *jobs.Queue, tx pgx.Tx, event CommentEvent) error {
+	_, err := queue.EnqueueTx(ctx, tx, CommentJobType, event, nil)
+	return err
+}
+
+// mentionRegex matches "@name"; usernames can't contain whitespace or '/' (see users/username.go).
+var mentionRegex = regexp.MustCompile(`(?:^|[^\w@])@([^\s@/]+)`)
+
+// ExtractMentions returns the unique, lowercased usernames mentioned in `content`, at most
+// `maxMentions` of them. Trailing punctuation ("@mi, ..." or "@mi.") isn't part of the name.
+func ExtractMentions(content string) []string {
+	seen := make(map[string]struct{})
+	var mentions []string
+	for _, match := range mentionRegex.FindAllStringSubmatch(content, -1) {
+		name := strings.ToLower(strings.TrimRight(match[1], ".,;:!?)]}\"'"))
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		mentions = append(mentions, name)
+		if len(mentions) == maxMentions {
+			break
+		}
+	}
+	return mentions
+}
+
+// CommentHandler fans comment events out into notifications. Everything for one event is
+// written in one transaction, and reply and mention rows are unique per comment, so a retried
+// job doesn't notify anyone twice.
+func CommentHandler(pool *pgxpool.Pool) jobs.HandlerFunc {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var event CommentEvent
+		if err := job.Decode(&event); err != nil {
+			return jobs.Permanent(fmt.Errorf("invalid comment event payload: %w", err))
+		}
+
+		return db.WithTx(ctx, pool, func(tx pgx.Tx) error {
+			// The comment may have been deleted before the job ran; then there's nothing to announce.
+			var exists bool
+			if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM comments WHERE commentid = $1)`, event.CommentID).Scan(&exists); err != nil {
+				return fmt.Errorf("check comment %d: %w", event.CommentID, err)
+			}
+			if !exists {
+				return nil
+			}
+
+			var author string
+			if err := tx.QueryRow(ctx, `SELECT username FROM users WHERE userid = $1`, event.AuthorID).Scan(&author); err != nil {
+				return fmt.Errorf("load author %d: %w", event.AuthorID, err)
+			}
+
+			if event.ValsiID != nil && event.Link != "" {
+				// The database function inserts one row per subscriber, skipping the author.
+				_, err := tx.Exec(ctx, `SELECT notify_valsi_subscribers($1, $2, $3, $4, $5)`,
+					*event.ValsiID, TypeComment, fmt.Sprintf("New comment on thread for %s", event.ValsiWord), event.Link, event.AuthorID)
+				if err != nil {
+					return fmt.Errorf("notify subscribers of valsi %d: %w", *event.ValsiID, err)
+				}
+			}
+
+			if event.ParentID != nil {
+				_, err := tx.Exec(ctx, `
+					INSERT INTO notifications (user_id, notification_type, message, link, valsi_id, comment_id, actor_id)
+					SELECT p.userid, $2, $3, NULLIF($4, ''), $5, $6, $7
+					FROM comments p
+					WHERE p.commentid = $1
+					  AND p.userid <> $7
+					  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = p.userid AND b.blocked_id = $7)
+					ON CONFLICT DO NOTHING`,
+					*event.ParentID, TypeReply, fmt.Sprintf("%s replied to your comment", author), event.Link, event.ValsiID, event.CommentID, event.AuthorID)
+				if err != nil {
+					return fmt.Errorf("notify reply to comment %d: %w", *event.ParentID, err)
+				}
+			}
+
+			if len(event.Mentions) > 0 {
+				// Mentioned users who muted or blocked the author aren't notified, and neither is
+				// the author of the parent comment, who already got a reply notification.
+				_, err := tx.Exec(ctx, `
+					INSERT INTO notifications (user_id, notification_type, message, link, valsi_id, comment_id, actor_id)
+					SELECT u.userid, $2, $3, NULLIF($4, ''), $5, $6, $7
+					FROM users u
+					WHERE LOWER(u.username) = ANY($1)
+					  AND u.userid <> $7
+					  AND u.userid IS DISTINCT FROM (SELECT p.userid FROM comments p WHERE p.commentid = $8)
+					  AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = u.userid AND b.blocked_id = $7)
+					ON CONFLICT DO NOTHING`,
+					event.Mentions, TypeMention, fmt.Sprintf("%s mentioned you in a comment", author), event.Link, event.ValsiID, event.CommentID, event.AuthorID, event.ParentID)
+				if err != nil {
+					return fmt.Errorf("notify mentions in comment %d: %w", event.CommentID, err)
+				}
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Package notifications, as part of the notifications module.
+// This file, `handlers.go`, serves the notification inbox under /api/v1/notifications: the list,
+// the unread count, and marking one or all notifications read.
+package notifications
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// NotificationHandlers provides HTTP handlers for a user's notifications.
+type NotificationHandlers struct {
+	service *NotificationService
+}
+
+// NewNotificationHandlers creates new NotificationHandlers.
+func NewNotificationHandlers(service *NotificationService) *NotificationHandlers {
+	return &NotificationHandlers{service: service}
+}
+
+// HandleList godoc
+// @Summary List my notifications
+// @Description Returns the authenticated user's notifications, newest first: replies to and mentions in comments, new comments on subscribed words, and decisions on their definition edits and examples.
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only unread notifications"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[Notification] "Notifications"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid filter or pagination"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/notifications [get]
+func (h *NotificationHandlers) HandleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		var q ListQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		page, err := h.service.List(r.Context(), userID, q)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		validation.WritePage(w, r, page)
+	}
+}
+
+// HandleUnreadCount godoc
+// @Summary Count my unread notifications
+// @Description Returns how many of the authenticated user's notifications are unread, the number on the bell icon.
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} UnreadCountResponse "Unread notifications"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/notifications/unread-count [get]
+func (h *NotificationHandlers) HandleUnreadCount() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		count, err := h.service.UnreadCount(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		render.Write(w, r, http.StatusOK, UnreadCountResponse{Count: count})
+	}
+}
+
+// HandleMarkRead godoc
+// @Summary Mark a notification read
+// @Description Marks one of the authenticated user's notifications read. Marking it again keeps the time it was first read.
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param notificationID path int true "Notification ID"
+// @Success 200 {object} Notification "The notification, marked read"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid notification ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - No such notification of this user"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/notifications/{notificationID}/read [post]
+func (h *NotificationHandlers) HandleMarkRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+		if err != nil || id < 1 {
+			auth.WriteError(w, r, apperror.NewBadRequestError("invalid notification ID", err))
+			return
+		}
+
+		n, err := h.service.MarkRead(r.Context(), userID, id)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, n)
+	}
+}
+
+// HandleMarkAllRead godoc
+// @Summary Mark all notifications read
+// @Description Marks every unread notification of the authenticated user read.
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} MarkAllReadResponse "How many were marked"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/notifications/read-all [post]
+func (h *NotificationHandlers) HandleMarkAllRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		marked, err := h.service.MarkAllRead(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, MarkAllReadResponse{Marked: marked})
+	}
+}
@@ -0,0 +1,191 @@
+// Package notifications, as part of the notifications module.
+// This file, `service.go`, reads a user's notifications and marks them read, and lets other
+// modules write notifications in their own transactions (see `Notify`), as the moderation of
+// definition revisions and examples does.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/validation"
+)
+
+// Notification types written by the moderation of definition revisions and examples.
+const (
+	TypeRevisionApproved = "revision_approved"
+	TypeRevisionRejected = "revision_rejected"
+	TypeExampleApproved  = "example_approved"
+	TypeExampleRejected  = "example_rejected"
+)
+
+// Entry is a notification to write with Notify.
+type Entry struct {
+	UserID  int32
+	Type    string
+	Message string
+	// Link is optional; empty means none.
+	Link    string
+	ValsiID *int32
+	// ActorID is the user whose action caused the notification; zero means none.
+	ActorID int
+}
+
+// Notify writes `e` in the caller's transaction, so the notification exists exactly when the
+// change it announces does. Nobody is notified of their own action.
+func Notify(ctx context.Context, tx pgx.Tx, e Entry) error {
+	if e.ActorID != 0 && int(e.UserID) == e.ActorID {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO notifications (user_id, notification_type, message, link, valsi_id, actor_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, 0))`,
+		e.UserID, e.Type, e.Message, e.Link, e.ValsiID, e.ActorID)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to write notification", err)
+	}
+	return nil
+}
+
+// NotificationService provides the notification endpoints.
+type NotificationService struct {
+	db *pgxpool.Pool
+}
+
+// NewNotificationService creates a new NotificationService.
+func NewNotificationService(db *pgxpool.Pool) *NotificationService {
+	return &NotificationService{db: db}
+}
+
+const notificationSelect = `
+	SELECT n.id, n.notification_type, n.message, n.link, n.valsi_id, n.comment_id,
+	       n.actor_id, u.username, n.created_at, n.read_at
+	FROM notifications n
+	LEFT JOIN users u ON u.userid = n.actor_id`
+
+func scanNotification(row pgx.Row) (*Notification, error) {
+	var n Notification
+	err := row.Scan(&n.ID, &n.Type, &n.Message, &n.Link, &n.ValsiID, &n.CommentID,
+		&n.ActorID, &n.ActorUsername, &n.CreatedAt, &n.ReadAt)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// List returns a page of the notifications of `userID`, newest first.
+func (s *NotificationService) List(ctx context.Context, userID int, q ListQuery) (*validation.Page[Notification], error) {
+	const filter = `
+		WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)`
+
+	var total int64
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM notifications n`+filter, userID, q.Unread).Scan(&total); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count notifications", err)
+	}
+	rows, err := s.db.Query(ctx, notificationSelect+filter+`
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $3 OFFSET $4`, userID, q.Unread, q.PerPage, q.Offset())
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list notifications", err)
+	}
+	defer rows.Close()
+	var items []Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read notification", err)
+		}
+		items = append(items, *n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list notifications", err)
+	}
+	return validation.NewPage(items, total, q.Pagination), nil
+}
+
+// UnreadCount returns how many notifications of `userID` are unread.
+func (s *NotificationService) UnreadCount(ctx context.Context, userID int) (int64, error) {
+	var count int64
+	err := s.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, apperror.NewDatabaseError("failed to count unread notifications", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks the notification `id` of `userID` read and returns it. Marking it again
+// keeps the time it was first read. Other users' notifications are reported as not found.
+func (s *NotificationService) MarkRead(ctx context.Context, userID int, id int64) (*Notification, error) {
+	n, err := scanNotification(s.db.QueryRow(ctx, `
+		WITH n AS (
+			UPDATE notifications SET read_at = COALESCE(read_at, NOW())
+			WHERE id = $1 AND user_id = $2
+			RETURNING *
+		)
+		SELECT n.id, n.notification_type, n.message, n.link, n.valsi_id, n.comment_id,
+		       n.actor_id, u.username, n.created_at, n.read_at
+		FROM n
+		LEFT JOIN users u ON u.userid = n.actor_id`, id, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("notification with ID %d not found", id), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to mark notification read", err)
+	}
+	return n, nil
+}
+
+// MarkAllRead marks every unread notification of `userID` read and returns how many there were.
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, apperror.NewDatabaseError("failed to mark notifications read", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// get returns the notification `id` of `userID`.
+func (s *NotificationService) get(ctx context.Context, userID int, id int64) (*Notification, error) {
+	n, err := scanNotification(s.db.QueryRow(ctx, notificationSelect+`
+		WHERE n.id = $1 AND n.user_id = $2`, id, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("notification with ID %d not found", id), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load notification", err)
+	}
+	return n, nil
+}
+
+// since returns the latest `limit` notifications of `userID` after the one with ID `afterID`,
+// oldest first.
+func (s *NotificationService) since(ctx context.Context, userID int, afterID int64, limit int) ([]Notification, error) {
+	rows, err := s.db.Query(ctx, `SELECT * FROM (`+notificationSelect+`
+		WHERE n.user_id = $1 AND n.id > $2
+		ORDER BY n.id DESC
+		LIMIT $3) latest
+		ORDER BY id`, userID, afterID, limit)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load missed notifications", err)
+	}
+	defer rows.Close()
+	var items []Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read notification", err)
+		}
+		items = append(items, *n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to load missed notifications", err)
+	}
+	return items, nil
+}
@@ -0,0 +1,152 @@
+// Package notifications, as part of the notifications module.
+// This file, `stream.go`, pushes new notifications to their recipient's open event streams.
+// A trigger announces every new notification on the `lensisku_notifications` Postgres channel
+// when its transaction commits, whoever wrote it; each instance listens, and publishes the
+// notifications of users who have a stream open on it to the user's Broadcaster topic.
+//
+// The event ID is the notification ID, so a reconnecting EventSource, sending the last one in
+// Last-Event-ID, is replayed what it missed from the table rather than from memory: nothing is
+// lost to a restart, or to reconnecting through another instance.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/jbovlaste"
+	"github.com/user/lensisku-go/logging"
+)
+
+const (
+	// announceChannel is the channel of the trigger announcing new notifications.
+	announceChannel = "lensisku_notifications"
+
+	// maxReplay caps the missed notifications sent to a reconnecting stream; older ones are
+	// left to GET /api/v1/notifications.
+	maxReplay = 100
+
+	// loadTimeout bounds loading an announced notification.
+	loadTimeout = 5 * time.Second
+)
+
+// UserTopic is the Broadcaster topic of the notifications of `userID`.
+func UserTopic(userID int) string {
+	return "notifications:" + strconv.Itoa(userID)
+}
+
+// Streamer delivers new notifications to the streams of their recipients.
+type Streamer struct {
+	service     *NotificationService
+	broadcaster *jbovlaste.Broadcaster
+	logger      *slog.Logger
+}
+
+// NewStreamer creates a Streamer publishing to `broadcaster`.
+func NewStreamer(service *NotificationService, broadcaster *jbovlaste.Broadcaster) *Streamer {
+	return &Streamer{service: service, broadcaster: broadcaster, logger: logging.For("notifications")}
+}
+
+// Start listens for new notifications in the background until `stop` is closed. Listening
+// keeps one connection of the pool checked out.
+func (s *Streamer) Start(stop <-chan struct{}) {
+	// The relay's LISTEN loop, reconnecting after errors, serves any channel.
+	go jbovlaste.NewPostgresRelay(s.service.db, announceChannel).Listen(s.deliver, stop)
+}
+
+// announcement is the payload of the trigger.
+type announcement struct {
+	ID     int64 `json:"id"`
+	UserID int   `json:"user_id"`
+}
+
+// deliver publishes an announced notification, if its recipient has a stream open here.
+func (s *Streamer) deliver(payload []byte) {
+	var a announcement
+	if err := json.Unmarshal(payload, &a); err != nil {
+		s.logger.Warn("Ignoring invalid notification announcement", "error", err)
+		return
+	}
+	topic := UserTopic(a.UserID)
+	if !s.broadcaster.HasSubscribers(topic) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	n, err := s.service.get(ctx, a.UserID, a.ID)
+	if err != nil {
+		// Deleted meanwhile, or the database is busy; the stream's next reconnect replays it.
+		s.logger.Warn("Failed to load announced notification", "id", a.ID, "error", err)
+		return
+	}
+	event, err := sseEvent(n)
+	if err != nil {
+		s.logger.Error("Failed to encode notification", "id", a.ID, "error", err)
+		return
+	}
+	s.broadcaster.PublishTopic(topic, event)
+}
+
+// sseEvent is the `notification` event carrying `n`.
+func sseEvent(n *Notification) (jbovlaste.SSEEvent, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return jbovlaste.SSEEvent{}, err
+	}
+	return jbovlaste.SSEEvent{Event: "notification", ID: strconv.FormatInt(n.ID, 10), Data: string(data)}, nil
+}
+
+// HandleStream godoc
+// @Summary Stream my new notifications
+// @Description Streams a `notification` Server-Sent Event, whose data is a Notification, for each new notification of the authenticated user. Every open stream of the user gets every event. Events carry the notification ID as their `id`; a reconnecting EventSource sends the Last-Event-ID header and first gets the notifications it missed, the latest 100 at most. A page that reloads can pass the last ID it saw as `last_event_id` instead. Browsers, whose EventSource can't send an Authorization header, authenticate with a cookie session.
+// @Tags notifications
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param Last-Event-ID header string false "ID of the last notification received, to replay the ones after it"
+// @Param last_event_id query string false "Same as the Last-Event-ID header, for a new EventSource"
+// @Success 200 {object} Notification "Stream of notification events"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/notifications/stream [get]
+func (s *Streamer) HandleStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+
+		missed := func() ([]jbovlaste.SSEEvent, error) {
+			after, err := strconv.ParseInt(lastEventID, 10, 64)
+			if err != nil {
+				return nil, nil // No or an invalid ID: nothing to replay
+			}
+			items, err := s.service.since(r.Context(), userID, after, maxReplay)
+			if err != nil {
+				return nil, err
+			}
+			events := make([]jbovlaste.SSEEvent, 0, len(items))
+			for i := range items {
+				event, err := sseEvent(&items[i])
+				if err != nil {
+					return nil, apperror.NewInternalError("failed to encode notification", err)
+				}
+				events = append(events, event)
+			}
+			return events, nil
+		}
+		if err := s.broadcaster.StreamTopic(w, r, UserTopic(userID), missed); err != nil {
+			auth.WriteError(w, r, err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package openapi, as part of the API documentation module.
+// This file, `middleware.go`, checks requests before they are handled and responses once they
+// are written. A response has already been sent by the time it is checked, so a mismatch in a
+// response is only ever logged; in enforce mode a request that doesn't match is answered with
+// 400 and never reaches its handler.
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+// maxCheckedBody is the largest request or response body that is checked. Larger bodies, such
+// as dictionary dumps, pass unchecked rather than being held in memory.
+const maxCheckedBody = 1 << 20
+
+// Kinds of mismatches, as counted in the metrics.
+const (
+	mismatchRequest      = "request"
+	mismatchResponse     = "response"
+	mismatchUndocumented = "undocumented"
+)
+
+// Middleware checks the requests and responses of the API against `s`. In
+// config.APIValidationEnforce mode, requests that don't match are rejected. Install it before
+// `bodylimit.Middleware`: it reads JSON bodies up front and hands the handler a copy, which the
+// limits then apply to. It registers its metrics with the default Prometheus registry, so it is
+// created once.
+func Middleware(s *Spec, mode string) func(http.Handler) http.Handler {
+	mismatches := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "lensisku",
+		Subsystem: "openapi",
+		Name:      "mismatches_total",
+		Help:      "Requests and responses that don't match the OpenAPI spec, and undocumented operations, by kind and route.",
+	}, []string{"kind", "route"})
+	prometheus.MustRegister(mismatches)
+	logger := logging.For("openapi")
+	// Undocumented operations are logged once each; they don't change between requests.
+	var reported sync.Map
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// WebSocket upgrades and the documentation itself aren't part of the spec.
+			if r.Header.Get("Upgrade") != "" || strings.HasPrefix(r.URL.Path, "/swagger/") || r.URL.Path == "/metrics" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			op, _ := s.find(r)
+			if op == nil {
+				next.ServeHTTP(w, r)
+				// Only requests the router served count: a 404 for a path nobody routes isn't drift.
+				rctx := chi.RouteContext(r.Context())
+				if rctx == nil || rctx.RoutePattern() == "" {
+					return
+				}
+				key := r.Method + " " + rctx.RoutePattern()
+				if _, seen := reported.LoadOrStore(key, struct{}{}); !seen {
+					mismatches.WithLabelValues(mismatchUndocumented, rctx.RoutePattern()).Inc()
+					logger.WarnContext(r.Context(), "Operation missing from the OpenAPI spec", "method", r.Method, "route", rctx.RoutePattern())
+				}
+				return
+			}
+
+			if fields := s.checkRequest(r, op); len(fields) > 0 {
+				mismatches.WithLabelValues(mismatchRequest, op.pattern).Inc()
+				logger.WarnContext(r.Context(), "Request does not match the OpenAPI spec",
+					"method", r.Method, "route", op.pattern, "problems", fieldMessages(fields))
+				if mode == config.APIValidationEnforce {
+					auth.WriteError(w, r, apperror.NewFieldsError(fields))
+					return
+				}
+			}
+
+			// Event streams stay open; there is no response body to check.
+			if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			body := &cappedBuffer{max: maxCheckedBody}
+			ww.Tee(body)
+			next.ServeHTTP(ww, r)
+
+			if fields := s.checkResponse(r, op, ww, body); len(fields) > 0 {
+				mismatches.WithLabelValues(mismatchResponse, op.pattern).Inc()
+				logger.WarnContext(r.Context(), "Response does not match the OpenAPI spec",
+					"method", r.Method, "route", op.pattern, "status", statusOf(ww), "problems", fieldMessages(fields))
+			}
+		})
+	}
+}
+
+// checkRequest checks the parameters and JSON body of `r`. The body is read and replaced by a
+// copy, so the handler still gets all of it.
+func (s *Spec) checkRequest(r *http.Request, op *operation) []apperror.FieldError {
+	c := &checker{spec: s}
+	query := r.URL.Query()
+	for _, p := range op.params {
+		switch p.In {
+		case "path":
+			c.param(p, op.pathValues[p.Name])
+		case "query":
+			values := query[p.Name]
+			if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+				if p.Required && !p.AllowEmptyValue {
+					c.fail(p.Name, "required", "is required")
+				}
+				continue
+			}
+			if p.Type == "array" && p.CollectionFormat == "multi" {
+				for _, v := range values {
+					if p.Items != nil {
+						c.simple(p.Name, p.Items.Type, p.Items.Format, p.Items.Enum, v)
+					}
+				}
+				continue
+			}
+			c.param(p, values[0])
+		case "header":
+			v := r.Header.Get(p.Name)
+			if v == "" {
+				if p.Required {
+					c.fail(p.Name, "required", "is required")
+				}
+				continue
+			}
+			c.param(p, v)
+		case "body":
+			if p.Schema == nil || !isJSON(r.Header.Get("Content-Type"), true) {
+				continue
+			}
+			data, complete := readBody(r)
+			if !complete {
+				continue
+			}
+			if len(bytes.TrimSpace(data)) == 0 {
+				if p.Required {
+					c.fail("body", "required", "is required")
+				}
+				continue
+			}
+			var v any
+			if err := json.Unmarshal(data, &v); err != nil {
+				c.fail("body", "json", "must be valid JSON")
+				continue
+			}
+			c.value("", p.Schema, v, 0)
+		}
+	}
+	return c.fields
+}
+
+// readBody reads up to maxCheckedBody bytes of the body of `r` and puts them back in front of
+// the rest. `complete` is false when the body is larger, or couldn't be read; the handler then
+// meets the same error.
+func readBody(r *http.Request) (data []byte, complete bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxCheckedBody+1))
+	complete = err == nil && len(data) <= maxCheckedBody
+	rest := r.Body
+	if err != nil {
+		rest = io.NopCloser(errReader{err})
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), rest), r.Body}
+	return data, complete
+}
+
+// errReader replays a read error.
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// checkResponse checks the status and JSON body of the response written through `ww`.
+func (s *Spec) checkResponse(r *http.Request, op *operation, ww middleware.WrapResponseWriter, body *cappedBuffer) []apperror.FieldError {
+	c := &checker{spec: s}
+	status := statusOf(ww)
+	resp, ok := op.response(status)
+	if !ok {
+		c.fail("status", "documented", "%d is not documented", status)
+		return c.fields
+	}
+	if resp.Schema == nil || r.Method == http.MethodHead || status == http.StatusNoContent || status == http.StatusNotModified ||
+		body.overflow || !isJSON(ww.Header().Get("Content-Type"), false) {
+		return c.fields
+	}
+	var v any
+	if err := json.Unmarshal(body.Bytes(), &v); err != nil {
+		c.fail("body", "json", "must be valid JSON")
+		return c.fields
+	}
+	c.value("", resp.Schema, v, 0)
+	return c.fields
+}
+
+// isJSON tells whether `contentType` is JSON. A request without a Content-Type is taken for
+// JSON when `missingIsJSON` is set, as the handlers decode such bodies as JSON.
+func isJSON(contentType string, missingIsJSON bool) bool {
+	if contentType == "" {
+		return missingIsJSON
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+func statusOf(ww middleware.WrapResponseWriter) int {
+	if ww.Status() == 0 {
+		return http.StatusOK
+	}
+	return ww.Status()
+}
+
+func fieldMessages(fields []apperror.FieldError) []string {
+	messages := make([]string, len(fields))
+	for i, f := range fields {
+		messages[i] = f.Message
+	}
+	return messages
+}
+
+// cappedBuffer keeps up to `max` bytes of what is written to it, and notes whether more came.
+type cappedBuffer struct {
+	bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflow || b.Len()+len(p) > b.max {
+		b.overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
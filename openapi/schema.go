@@ -0,0 +1,235 @@
+// Package openapi, as part of the API documentation module.
+// This file, `schema.go`, checks parameters and decoded JSON values against the spec. Problems
+// are reported as field errors, the format the validation package answers invalid requests
+// with, so enforce mode rejects a request the same way a handler would.
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/spec"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// maxRefDepth bounds how deep references are followed, should a spec make a cycle of them.
+const maxRefDepth = 32
+
+// checker collects the problems of one request or response.
+type checker struct {
+	spec   *Spec
+	fields []apperror.FieldError
+}
+
+// fail records a problem with `field`; an empty field is the body itself.
+func (c *checker) fail(field, rule, format string, args ...any) {
+	if field == "" {
+		field = "body"
+	}
+	c.fields = append(c.fields, apperror.FieldError{Field: field, Rule: rule, Message: field + " " + fmt.Sprintf(format, args...)})
+}
+
+// param checks the raw value of a path, query or header parameter.
+func (c *checker) param(p spec.Parameter, raw string) {
+	if p.Type == "array" {
+		sep := ","
+		switch p.CollectionFormat {
+		case "ssv":
+			sep = " "
+		case "tsv":
+			sep = "\t"
+		case "pipes":
+			sep = "|"
+		}
+		for i, v := range strings.Split(raw, sep) {
+			if p.Items != nil {
+				c.simple(fmt.Sprintf("%s[%d]", p.Name, i), p.Items.Type, p.Items.Format, p.Items.Enum, v)
+			}
+		}
+		return
+	}
+	c.simple(p.Name, p.Type, p.Format, p.Enum, raw)
+	if p.Type == "integer" || p.Type == "number" {
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			c.bounds(p.Name, n, p.Minimum, p.Maximum)
+		}
+	}
+	if p.Type == "string" {
+		c.length(p.Name, raw, p.MinLength, p.MaxLength)
+	}
+}
+
+// simple checks a parameter value of a simple type.
+func (c *checker) simple(field, typ, format string, enum []any, raw string) {
+	switch typ {
+	case "integer":
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			c.fail(field, "type", "must be an integer")
+			return
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			c.fail(field, "type", "must be a number")
+			return
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(raw); err != nil {
+			c.fail(field, "type", "must be true or false")
+			return
+		}
+	case "string":
+		c.format(field, format, raw)
+	}
+	if len(enum) > 0 && !slices.ContainsFunc(enum, func(e any) bool { return fmt.Sprint(e) == raw }) {
+		c.fail(field, "oneof", "must be one of %s", enumList(enum))
+	}
+}
+
+// value checks a decoded JSON value against `s`.
+func (c *checker) value(field string, s *spec.Schema, v any, depth int) {
+	if depth > maxRefDepth {
+		return
+	}
+	if ref := s.Ref.String(); ref != "" {
+		def, ok := c.spec.definition(ref)
+		if !ok {
+			return
+		}
+		c.value(field, def, v, depth+1)
+		return
+	}
+	for i := range s.AllOf {
+		c.value(field, &s.AllOf[i], v, depth+1)
+	}
+	// Swagger 2.0 has no way to say a value may be null, and optional Go pointers without
+	// omitempty are encoded as null, so null passes wherever a value is allowed at all.
+	if v == nil {
+		return
+	}
+
+	switch {
+	case s.Type.Contains("object") || (len(s.Type) == 0 && len(s.Properties) > 0):
+		obj, ok := v.(map[string]any)
+		if !ok {
+			c.fail(field, "type", "must be an object")
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				c.fail(join(field, name), "required", "is required")
+			}
+		}
+		for name, prop := range s.Properties {
+			if pv, ok := obj[name]; ok {
+				c.value(join(field, name), &prop, pv, depth+1)
+			}
+		}
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+			for name, pv := range obj {
+				if _, declared := s.Properties[name]; !declared {
+					c.value(join(field, name), s.AdditionalProperties.Schema, pv, depth+1)
+				}
+			}
+		}
+	case s.Type.Contains("array"):
+		arr, ok := v.([]any)
+		if !ok {
+			c.fail(field, "type", "must be an array")
+			return
+		}
+		if s.MinItems != nil && int64(len(arr)) < *s.MinItems {
+			c.fail(field, "min", "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && int64(len(arr)) > *s.MaxItems {
+			c.fail(field, "max", "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil && s.Items.Schema != nil {
+			for i, item := range arr {
+				c.value(fmt.Sprintf("%s[%d]", field, i), s.Items.Schema, item, depth+1)
+			}
+		}
+	case s.Type.Contains("string"):
+		str, ok := v.(string)
+		if !ok {
+			c.fail(field, "type", "must be a string")
+			return
+		}
+		c.format(field, s.Format, str)
+		c.length(field, str, s.MinLength, s.MaxLength)
+	case s.Type.Contains("integer"):
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) {
+			c.fail(field, "type", "must be an integer")
+			return
+		}
+		c.bounds(field, n, s.Minimum, s.Maximum)
+	case s.Type.Contains("number"):
+		n, ok := v.(float64)
+		if !ok {
+			c.fail(field, "type", "must be a number")
+			return
+		}
+		c.bounds(field, n, s.Minimum, s.Maximum)
+	case s.Type.Contains("boolean"):
+		if _, ok := v.(bool); !ok {
+			c.fail(field, "type", "must be true or false")
+			return
+		}
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+		c.fail(field, "oneof", "must be one of %s", enumList(s.Enum))
+	}
+}
+
+func (c *checker) format(field, format, s string) {
+	switch format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			c.fail(field, "datetime", "must be an RFC 3339 time")
+		}
+	case "date":
+		if _, err := time.Parse(time.DateOnly, s); err != nil {
+			c.fail(field, "date", "must be a date (YYYY-MM-DD)")
+		}
+	}
+}
+
+func (c *checker) length(field, s string, minLength, maxLength *int64) {
+	n := int64(len([]rune(s)))
+	if minLength != nil && n < *minLength {
+		c.fail(field, "min", "must be at least %d characters long", *minLength)
+	}
+	if maxLength != nil && n > *maxLength {
+		c.fail(field, "max", "must be at most %d characters long", *maxLength)
+	}
+}
+
+func (c *checker) bounds(field string, n float64, minimum, maximum *float64) {
+	if minimum != nil && n < *minimum {
+		c.fail(field, "min", "must be at least %v", *minimum)
+	}
+	if maximum != nil && n > *maximum {
+		c.fail(field, "max", "must be at most %v", *maximum)
+	}
+}
+
+// join names a member of `field`, the body itself when it is empty.
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func enumList(enum []any) string {
+	values := make([]string, len(enum))
+	for i, e := range enum {
+		values[i] = fmt.Sprint(e)
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,186 @@
+// Package openapi checks the API against its OpenAPI (Swagger 2.0) spec at runtime, so the
+// documentation generated from the handlers' annotations can't silently drift from what the
+// handlers do. The middleware (see `middleware.go`) matches each request to its documented
+// operation, checks the parameters and the JSON body against it, then checks the response's
+// status and JSON body. Mismatches are logged and counted; in enforce mode, invalid requests
+// are also rejected. It is meant for dev and staging, where the cost of buffering and checking
+// bodies doesn't matter.
+//
+// Only the parts of the spec that swag generates are understood: path, query and header
+// parameters of simple types, and JSON bodies described by schemas with $ref, allOf, type,
+// properties, required, items, enum, and length and range limits. Form data isn't checked.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// Spec is a parsed spec, with its paths ready to match requests against.
+type Spec struct {
+	doc   *spec.Swagger
+	paths []*pathMatcher
+}
+
+// pathMatcher matches the request paths of a spec path such as "/users/{userID}/follow".
+type pathMatcher struct {
+	pattern  string
+	segments []string // A segment "{name}" matches any one segment
+	params   int
+	item     *spec.PathItem
+}
+
+// Parse reads a spec in JSON, as `docs.SwaggerInfo.ReadDoc()` returns it.
+func Parse(doc []byte) (*Spec, error) {
+	var sw spec.Swagger
+	if err := json.Unmarshal(doc, &sw); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	s := &Spec{doc: &sw}
+	if sw.Paths == nil {
+		return s, nil
+	}
+	basePath := strings.TrimRight(sw.BasePath, "/")
+	for pattern, item := range sw.Paths.Paths {
+		m := &pathMatcher{pattern: pattern, segments: splitPath(basePath + pattern), item: &item}
+		for _, seg := range m.segments {
+			if isParam(seg) {
+				m.params++
+			}
+		}
+		s.paths = append(s.paths, m)
+	}
+	// Literal segments win over parameters, e.g. "/users/me" over "/users/{userID}".
+	sort.Slice(s.paths, func(i, j int) bool {
+		if s.paths[i].params != s.paths[j].params {
+			return s.paths[i].params < s.paths[j].params
+		}
+		return s.paths[i].pattern < s.paths[j].pattern
+	})
+	return s, nil
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// match returns the path values of `path` if it matches.
+func (m *pathMatcher) match(path []string) (map[string]string, bool) {
+	if len(path) != len(m.segments) {
+		return nil, false
+	}
+	var values map[string]string
+	for i, seg := range m.segments {
+		if isParam(seg) {
+			if path[i] == "" {
+				return nil, false
+			}
+			if values == nil {
+				values = make(map[string]string, m.params)
+			}
+			values[seg[1:len(seg)-1]] = path[i]
+			continue
+		}
+		if seg != path[i] {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// operation is the documented operation of a request.
+type operation struct {
+	pattern    string // The spec path, e.g. "/users/{userID}/follow"
+	op         *spec.Operation
+	params     []spec.Parameter // Of the operation and its path, the operation's first
+	pathValues map[string]string
+}
+
+// find returns the operation of `r`. `pathKnown` tells whether the path is documented at
+// all; the operation is nil when it isn't, or when its method isn't.
+func (s *Spec) find(r *http.Request) (op *operation, pathKnown bool) {
+	path := splitPath(r.URL.Path)
+	for _, m := range s.paths {
+		values, ok := m.match(path)
+		if !ok {
+			continue
+		}
+		o := methodOperation(m.item, r.Method)
+		if o == nil {
+			return nil, true
+		}
+		params := append([]spec.Parameter{}, o.Parameters...)
+		for _, p := range m.item.Parameters {
+			if !hasParam(params, p) {
+				params = append(params, p)
+			}
+		}
+		return &operation{pattern: m.pattern, op: o, params: params, pathValues: values}, true
+	}
+	return nil, false
+}
+
+func hasParam(params []spec.Parameter, p spec.Parameter) bool {
+	for _, q := range params {
+		if q.Name == p.Name && q.In == p.In {
+			return true
+		}
+	}
+	return false
+}
+
+func methodOperation(item *spec.PathItem, method string) *spec.Operation {
+	switch method {
+	case http.MethodGet:
+		return item.Get
+	case http.MethodHead:
+		if item.Head != nil {
+			return item.Head
+		}
+		return item.Get
+	case http.MethodPost:
+		return item.Post
+	case http.MethodPut:
+		return item.Put
+	case http.MethodPatch:
+		return item.Patch
+	case http.MethodDelete:
+		return item.Delete
+	case http.MethodOptions:
+		return item.Options
+	}
+	return nil
+}
+
+// response returns the documented response for `status`, falling back to the default one.
+func (o *operation) response(status int) (*spec.Response, bool) {
+	if o.op.Responses == nil {
+		return nil, false
+	}
+	if resp, ok := o.op.Responses.StatusCodeResponses[status]; ok {
+		return &resp, true
+	}
+	if o.op.Responses.Default != nil {
+		return o.op.Responses.Default, true
+	}
+	return nil, false
+}
+
+// definition resolves a local reference such as "#/definitions/auth.LoginRequest".
+func (s *Spec) definition(ref string) (*spec.Schema, bool) {
+	name, ok := strings.CutPrefix(ref, "#/definitions/")
+	if !ok {
+		return nil, false
+	}
+	def, ok := s.doc.Definitions[name]
+	return &def, ok
+}
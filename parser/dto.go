@@ -0,0 +1,69 @@
+// Package parser, as part of the dictionary module.
+// This file, `dto.go`, defines the request and response bodies of the parse API.
+package parser
+
+// ParseRequest is a text to parse.
+// @Description Request body for parsing Lojban text
+type ParseRequest struct {
+	// example: "mi klama le zarci"
+	Text string `json:"text"`
+}
+
+// ParseResponse is the result of parsing a text.
+// @Description The parse tree of a text, or where it fails to parse
+type ParseResponse struct {
+	// Whether the whole text parsed
+	// example: true
+	Valid bool `json:"valid"`
+	// Parse tree, rooted at the rule "text"; absent if the text doesn't parse
+	Tree *Node `json:"tree,omitempty"`
+	// Why the text doesn't parse; empty if it does
+	Errors []ParseError `json:"errors"`
+}
+
+// ParseError locates a problem in a text.
+// @Description A problem in the text and where it is
+type ParseError struct {
+	// example: "unexpected end of text; expected BRIVLA, KOhA, LE, ..."
+	Message string `json:"message"`
+	// Byte offset in the text
+	// example: 11
+	Offset int `json:"offset"`
+	// 1-based line
+	// example: 1
+	Line int `json:"line"`
+	// 1-based column, in characters
+	// example: 12
+	Column int `json:"column"`
+	// Selma'o (or BRIVLA, CMEVLA) that would have been accepted here
+	// example: ["BRIVLA", "KOhA", "LE"]
+	Expected []string `json:"expected"`
+	// The word found instead, with its selma'o, or "end of text"
+	// example: "end of text"
+	Found string `json:"found,omitempty"`
+}
+
+// Node is a node of a parse tree: a grammar rule with its parts, or a word.
+// @Description A rule of the grammar with its parts, or a single word
+type Node struct {
+	// Grammar rule, for rule nodes
+	// example: "sumti"
+	Rule string `json:"rule,omitempty"`
+	// Selma'o of a cmavo, or BRIVLA / CMEVLA, for word nodes
+	// example: "KOhA"
+	Selmaho string `json:"selmaho,omitempty"`
+	// The word, for word nodes
+	// example: "mi"
+	Text string `json:"text,omitempty"`
+	// Contents of a quote (zo, zoi, la'o, lo'u)
+	Quoted string `json:"quoted,omitempty"`
+	// Byte offsets of the node in the text, end exclusive
+	// example: 0
+	Start int `json:"start"`
+	// example: 2
+	End int `json:"end"`
+	// Parts of a rule node
+	Children []*Node `json:"children,omitempty"`
+	// Attitudinals (UI, CAI) following the word, with their NAI
+	Indicators []*Node `json:"indicators,omitempty"`
+}
@@ -0,0 +1,54 @@
+// Package parser encapsulates the grammar check of Lojban text: an embedded PEG parser, after
+// the camxes grammar, that returns the parse tree of a text or the position where it fails.
+// This file, `handlers.go`, serves POST /api/v1/parse, which checks a text against the grammar
+// and returns its parse tree or the errors found.
+package parser
+
+import (
+	"net/http"
+
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// ParseHandlers provides HTTP handlers for parsing.
+type ParseHandlers struct {
+	service *ParseService
+}
+
+// NewParseHandlers creates new ParseHandlers.
+func NewParseHandlers(service *ParseService) *ParseHandlers {
+	return &ParseHandlers{service: service}
+}
+
+// HandleParse godoc
+// @Summary Parse Lojban text
+// @Description Runs Lojban text through the grammar and returns its parse tree. Rule nodes carry the grammar rule, word nodes the selma'o; attitudinals are attached to the word they follow. A text that doesn't parse still returns 200, with `valid` false and an error giving the position (byte offset, line and column), the word found there and the selma'o that would have been accepted. The grammar follows camxes for everyday Lojban; see `parser/grammar.peg` for what it covers.
+// @Tags parser
+// @Accept json
+// @Produce json
+// @Param text body ParseRequest true "Text to parse"
+// @Success 200 {object} ParseResponse "Parse tree or errors"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing or too long text"
+// @Router /api/v1/parse [post]
+func (h *ParseHandlers) HandleParse() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// JSON escaping can double the size of the text; anything bigger is rejected unread.
+		r.Body = http.MaxBytesReader(w, r.Body, 2*maxTextLength+1<<10)
+		var req ParseRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		result, err := h.service.Parse(req.Text)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,317 @@
+// Package parser, as part of the dictionary module.
+// This file, `lexer.go`, turns text into the words the grammar works on. Words are separated
+// by spaces and pauses (periods); commas inside a word are ignored and `h` may stand for the
+// apostrophe. A word ending in a consonant is a cmevla, a word with a consonant cluster a
+// brivla, and anything else one or more cmavo written together (`lenu` is `le nu`), each
+// looked up in `selmaho.txt`.
+//
+// The constructs that work on words rather than grammar are resolved here, in the order the
+// CLL gives: quotes first (zo, zoi/la'o, lo'u ... le'u), then erasure (si, su), then zei and
+// bu. Finally attitudinals (UI, CAI, with their NAI) and the markers da'o and fu'o are
+// attached to the word they follow, and hesitations (y) are dropped.
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// token is a word of the text.
+type token struct {
+	class      string // Selma'o, BRIVLA or CMEVLA
+	text       string
+	quoted     string
+	start, end int // Byte offsets in the text, end exclusive
+	indicators []*token
+}
+
+// node returns the parse tree node of a word.
+func (t *token) node() *Node {
+	n := &Node{Selmaho: t.class, Text: t.text, Quoted: t.quoted, Start: t.start, End: t.end}
+	for _, ind := range t.indicators {
+		n.Indicators = append(n.Indicators, ind.node())
+	}
+	return n
+}
+
+// lexError is a problem with a word, at a byte offset of the text.
+type lexError struct {
+	offset  int
+	message string
+}
+
+func isVowel(c byte) bool {
+	return strings.IndexByte("aeiou", c) >= 0
+}
+
+func isConsonant(c byte) bool {
+	return strings.IndexByte("bcdfgjklmnprstvxz", c) >= 0
+}
+
+// isWordByte reports whether a byte belongs to a word; anything else but spaces and periods
+// is an error.
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '\'' || c == ','
+}
+
+func isSeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '.'
+}
+
+// lexer holds the state of splitting one text.
+type lexer struct {
+	src     string
+	pos     int
+	selmaho map[string]string
+}
+
+// lex splits a text into words. It returns the words and the attitudinals that come before
+// the first word, which apply to the whole text.
+func lex(src string, selmaho map[string]string) ([]*token, []*token, *lexError) {
+	l := &lexer{src: src, selmaho: selmaho}
+	var toks []*token
+	for {
+		word, ok, err := l.nextWord()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			break
+		}
+		pieces, err := l.classify(word)
+		if err != nil {
+			return nil, nil, err
+		}
+		toks = append(toks, pieces...)
+		// A zoi right after zo is quoted itself rather than starting a quote.
+		quotedByZo := len(toks) >= 2 && toks[len(toks)-2].class == "ZO"
+		if last := toks[len(toks)-1]; last.class == "ZOI" && !quotedByZo {
+			if err := l.readZoi(last); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	toks, err := l.resolveQuotes(toks)
+	if err != nil {
+		return nil, nil, err
+	}
+	if toks, err = resolveErasure(toks); err != nil {
+		return nil, nil, err
+	}
+	if toks, err = resolveGlue(toks); err != nil {
+		return nil, nil, err
+	}
+	toks, leading := attachIndicators(toks)
+	return toks, leading, nil
+}
+
+// rawWord is a word as written, with its letters normalized.
+type rawWord struct {
+	letters string // Lowercase, apostrophes for h, without commas
+	offsets []int  // Byte offset in the text of each letter
+	start   int
+	end     int
+}
+
+// nextWord reads the next word of the text.
+func (l *lexer) nextWord() (rawWord, bool, *lexError) {
+	for l.pos < len(l.src) && isSeparator(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return rawWord{}, false, nil
+	}
+	w := rawWord{start: l.pos}
+	var b strings.Builder
+	for l.pos < len(l.src) && isWordByte(l.src[l.pos]) {
+		c := l.src[l.pos]
+		switch {
+		case c == ',':
+		case c == 'h' || c == 'H' || c == '\'':
+			b.WriteByte('\'')
+			w.offsets = append(w.offsets, l.pos)
+		default:
+			b.WriteByte(c | 0x20) // Lowercase; capitals only mark stress
+			w.offsets = append(w.offsets, l.pos)
+		}
+		l.pos++
+	}
+	if l.pos == w.start {
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		return rawWord{}, false, &lexError{offset: l.pos, message: fmt.Sprintf("unexpected character %q", r)}
+	}
+	w.letters, w.end = b.String(), l.pos
+	if w.letters == "" {
+		return l.nextWord() // Only commas
+	}
+	return w, true, nil
+}
+
+// classify turns a written word into tokens: one brivla or cmevla, or a run of cmavo.
+func (l *lexer) classify(w rawWord) ([]*token, *lexError) {
+	letters := w.letters
+	if isConsonant(letters[len(letters)-1]) {
+		return []*token{{class: "CMEVLA", text: letters, start: w.start, end: w.end}}, nil
+	}
+	for i := 0; i+1 < len(letters); i++ {
+		if isConsonant(letters[i]) && isConsonant(letters[i+1]) {
+			return []*token{{class: "BRIVLA", text: letters, start: w.start, end: w.end}}, nil
+		}
+	}
+
+	// A run of cmavo: each one starts at a consonant.
+	var toks []*token
+	for i := 0; i < len(letters); {
+		j := i + 1
+		for j < len(letters) && !isConsonant(letters[j]) {
+			j++
+		}
+		cmavo := letters[i:j]
+		class, ok := l.selmaho[cmavo]
+		if !ok {
+			return nil, &lexError{offset: w.offsets[i], message: fmt.Sprintf("unknown cmavo %q", cmavo)}
+		}
+		end := w.end
+		if j < len(letters) {
+			end = w.offsets[j]
+		}
+		toks = append(toks, &token{class: class, text: cmavo, start: w.offsets[i], end: end})
+		i = j
+	}
+	return toks, nil
+}
+
+// readZoi reads the delimiter and the text of a zoi or la'o quote into `t`.
+func (l *lexer) readZoi(t *token) *lexError {
+	delim, ok, err := l.nextWord()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &lexError{offset: t.start, message: fmt.Sprintf("%s needs a delimiter word", t.text)}
+	}
+	d := l.src[delim.start:delim.end]
+	for from := l.pos; ; {
+		i := strings.Index(l.src[from:], d)
+		if i < 0 {
+			return &lexError{offset: t.start, message: fmt.Sprintf("%s quote is not closed with %q", t.text, d)}
+		}
+		i += from
+		end := i + len(d)
+		if (i == 0 || !isWordByte(l.src[i-1])) && (end == len(l.src) || !isWordByte(l.src[end])) {
+			t.quoted = strings.TrimSpace(strings.Trim(strings.TrimSpace(l.src[l.pos:i]), "."))
+			t.end, l.pos = end, end
+			return nil
+		}
+		from = i + 1
+	}
+}
+
+// resolveQuotes folds zo and lo'u quotes into single words. zoi was handled while reading.
+func (l *lexer) resolveQuotes(toks []*token) ([]*token, *lexError) {
+	var out []*token
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch t.class {
+		case "ZO":
+			if i+1 == len(toks) {
+				return nil, &lexError{offset: t.start, message: "zo at the end of the text quotes nothing"}
+			}
+			i++
+			t.quoted, t.end = toks[i].text, toks[i].end
+		case "LOhU":
+			j := i + 1
+			for j < len(toks) && toks[j].text != "le'u" {
+				j++
+			}
+			if j == len(toks) {
+				return nil, &lexError{offset: t.start, message: "lo'u quote is not closed with le'u"}
+			}
+			if j > i+1 {
+				t.quoted = l.src[toks[i+1].start:toks[j-1].end]
+			}
+			t.end = toks[j].end
+			i = j
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// resolveErasure applies si (erase the previous word) and su (erase everything so far).
+func resolveErasure(toks []*token) ([]*token, *lexError) {
+	var out []*token
+	for _, t := range toks {
+		switch t.class {
+		case "SI":
+			if len(out) == 0 {
+				return nil, &lexError{offset: t.start, message: "si has no word to erase"}
+			}
+			out = out[:len(out)-1]
+		case "SU":
+			out = out[:0]
+		default:
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// resolveGlue joins words around zei into a brivla and turns a word followed by bu into a
+// letter.
+func resolveGlue(toks []*token) ([]*token, *lexError) {
+	var out []*token
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch t.class {
+		case "ZEI":
+			if len(out) == 0 || i+1 == len(toks) {
+				return nil, &lexError{offset: t.start, message: "zei needs a word on each side"}
+			}
+			prev := out[len(out)-1]
+			i++
+			prev.class, prev.end = "BRIVLA", toks[i].end
+			prev.text = prev.text + " zei " + toks[i].text
+			continue
+		case "BU":
+			if len(out) == 0 {
+				return nil, &lexError{offset: t.start, message: "bu has no word to turn into a letter"}
+			}
+			prev := out[len(out)-1]
+			prev.class, prev.end = "BY", t.end
+			prev.text = prev.text + " bu"
+			continue
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// indicatorClasses are the selma'o attached to the preceding word rather than parsed.
+var indicatorClasses = map[string]bool{"UI": true, "CAI": true, "DAhO": true, "FUhO": true}
+
+// attachIndicators moves attitudinals onto the word before them. Those before the first word
+// are returned separately.
+func attachIndicators(toks []*token) (words []*token, leading []*token) {
+	var lastIndicator bool
+	for _, t := range toks {
+		switch {
+		case t.class == "Y":
+			continue
+		case indicatorClasses[t.class], t.class == "NAI" && lastIndicator:
+			if len(words) == 0 {
+				leading = append(leading, t)
+			} else {
+				prev := words[len(words)-1]
+				prev.indicators = append(prev.indicators, t)
+			}
+			lastIndicator = true
+			continue
+		}
+		words = append(words, t)
+		lastIndicator = false
+	}
+	return words, leading
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// describe renders tokens as `CLASS:text`, with a quote's contents and indicators in brackets.
+func describe(toks []*token) string {
+	var parts []string
+	for _, t := range toks {
+		s := t.class + ":" + t.text
+		if t.quoted != "" {
+			s += "[" + t.quoted + "]"
+		}
+		if len(t.indicators) > 0 {
+			s += "{" + describe(t.indicators) + "}"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestLex(t *testing.T) {
+	selmaho, err := loadSelmaho(selmahoSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		leading string
+	}{
+		{"words", "mi klama le zarci", "KOhA:mi BRIVLA:klama LE:le BRIVLA:zarci", ""},
+		{"cmavo written together", "lenu", "LE:le NU:nu", ""},
+		{"cmevla between pauses", "la .djan.", "LA:la CMEVLA:djan", ""},
+		{"h for apostrophe and stress", "MI DO'u doHu", "KOhA:mi DOhU:do'u DOhU:do'u", ""},
+		{"commas inside a word", "kla,ma", "BRIVLA:klama", ""},
+		{"zo", "zo mi", "ZO:zo[mi]", ""},
+		{"zoi", "zoi gy. any text .gy", "ZOI:zoi[any text]", ""},
+		{"zo quoting zoi", "zo zoi", "ZO:zo[zoi]", ""},
+		{"lo'u", "lo'u mi klama le'u", "LOhU:lo'u[mi klama]", ""},
+		{"si", "mi si do", "KOhA:do", ""},
+		{"su", "mi klama su do", "KOhA:do", ""},
+		{"zei", "mi zei klama", "BRIVLA:mi zei klama", ""},
+		{"bu", "a bu", "BY:a bu", ""},
+		{"indicators", "mi ui nai klama", "KOhA:mi{UI:ui NAI:nai} BRIVLA:klama", ""},
+		{"leading indicators", "ui mi", "KOhA:mi", "UI:ui"},
+		{"hesitation", "mi y klama", "KOhA:mi BRIVLA:klama", ""},
+		{"nai after a word", "na nai", "NA:na NAI:nai", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toks, leading, lexErr := lex(tt.text, selmaho)
+			if lexErr != nil {
+				t.Fatalf("lex(%q): %s at %d", tt.text, lexErr.message, lexErr.offset)
+			}
+			if got := describe(toks); got != tt.want {
+				t.Errorf("lex(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if got := describe(leading); got != tt.leading {
+				t.Errorf("lex(%q) leading = %q, want %q", tt.text, got, tt.leading)
+			}
+		})
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	selmaho, err := loadSelmaho(selmahoSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text    string
+		offset  int
+		message string
+	}{
+		{"mi klama?", 8, `unexpected character '?'`},
+		{"mi qa", 3, `unknown cmavo "qa"`},
+		{"mi zo", 3, "zo at the end of the text quotes nothing"},
+		{"zoi", 0, "zoi needs a delimiter word"},
+		{"zoi gy. text", 0, `zoi quote is not closed with "gy"`},
+		{"lo'u mi", 0, "lo'u quote is not closed with le'u"},
+		{"si", 0, "si has no word to erase"},
+		{"zei mi", 0, "zei needs a word on each side"},
+		{"bu", 0, "bu has no word to turn into a letter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			_, _, lexErr := lex(tt.text, selmaho)
+			if lexErr == nil {
+				t.Fatalf("lex(%q) succeeded, want %q", tt.text, tt.message)
+			}
+			if lexErr.offset != tt.offset || lexErr.message != tt.message {
+				t.Errorf("lex(%q) = %q at %d, want %q at %d", tt.text, lexErr.message, lexErr.offset, tt.message, tt.offset)
+			}
+		})
+	}
+}
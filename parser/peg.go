@@ -0,0 +1,408 @@
+// Package parser, as part of the dictionary module.
+// This file, `peg.go`, is a small packrat PEG engine. It reads the grammar in `grammar.peg`
+// once at startup and matches it against the words produced by the lexer. Every rule result is
+// memoized per position, so parsing stays linear in the number of words however much the
+// grammar backtracks. When the text doesn't match, the error points at the farthest word any
+// alternative got to, with the selma'o that would have been accepted there.
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+type exprKind int
+
+const (
+	exprSeq exprKind = iota
+	exprChoice
+	exprRepeat
+	exprAnd
+	exprNot
+	exprAny
+	exprRule
+	exprTerminal
+)
+
+// expr is a node of a compiled grammar rule.
+type expr struct {
+	kind  exprKind
+	items []*expr // Parts of a sequence or alternatives of a choice
+	sub   *expr   // Operand of a repetition or predicate
+	min   int     // Repetition bounds; max < 0 is unbounded
+	max   int
+	name  string // Rule name or selma'o
+	rule  int    // Index of a referenced rule
+}
+
+type rule struct {
+	name   string
+	hidden bool // Left out of the tree; its parts go to the enclosing rule
+	body   *expr
+}
+
+// pegGrammar is a compiled grammar. Its first rule is the start rule.
+type pegGrammar struct {
+	rules []rule
+}
+
+// compileGrammar reads a grammar. `terminals` lists the selma'o the grammar may use.
+func compileGrammar(src string, terminals map[string]bool) (*pegGrammar, error) {
+	toks := tokenizeGrammar(src)
+	g := &pegGrammar{}
+	index := map[string]int{}
+	c := &grammarCompiler{toks: toks}
+	for c.pos < len(toks) {
+		name := c.next()
+		if !isRuleName(name) || c.next() != "<-" {
+			return nil, fmt.Errorf("grammar: expected a rule definition at %q", name)
+		}
+		body, err := c.choice()
+		if err != nil {
+			return nil, fmt.Errorf("grammar: rule %s: %w", name, err)
+		}
+		if _, dup := index[name]; dup {
+			return nil, fmt.Errorf("grammar: rule %s is defined twice", name)
+		}
+		index[name] = len(g.rules)
+		g.rules = append(g.rules, rule{name: name, hidden: strings.HasPrefix(name, "_"), body: body})
+	}
+	if len(g.rules) == 0 {
+		return nil, fmt.Errorf("grammar: no rules")
+	}
+
+	var resolve func(e *expr) error
+	resolve = func(e *expr) error {
+		switch e.kind {
+		case exprRule:
+			i, ok := index[e.name]
+			if !ok {
+				return fmt.Errorf("grammar: undefined rule %s", e.name)
+			}
+			e.rule = i
+		case exprTerminal:
+			if !terminals[e.name] {
+				return fmt.Errorf("grammar: unknown selma'o %s", e.name)
+			}
+		}
+		for _, item := range e.items {
+			if err := resolve(item); err != nil {
+				return err
+			}
+		}
+		if e.sub != nil {
+			return resolve(e.sub)
+		}
+		return nil
+	}
+	for _, r := range g.rules {
+		if err := resolve(r.body); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// tokenizeGrammar splits grammar source into names and operators, dropping comments.
+func tokenizeGrammar(src string) []string {
+	var toks []string
+	for _, line := range strings.Split(src, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for i := 0; i < len(line); {
+			c := line[i]
+			switch {
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case strings.HasPrefix(line[i:], "<-"):
+				toks = append(toks, "<-")
+				i += 2
+			case strings.IndexByte("/()*+?&!.", c) >= 0:
+				toks = append(toks, string(c))
+				i++
+			default:
+				j := i
+				for j < len(line) && (line[j] == '_' || unicode.IsLetter(rune(line[j])) || unicode.IsDigit(rune(line[j]))) {
+					j++
+				}
+				if j == i {
+					j++ // Let the compiler report the stray character
+				}
+				toks = append(toks, line[i:j])
+				i = j
+			}
+		}
+	}
+	return toks
+}
+
+// isRuleName reports whether a name is a rule (lowercase) rather than a selma'o (capitals).
+func isRuleName(name string) bool {
+	return name != "" && (name[0] == '_' || name[0] >= 'a' && name[0] <= 'z')
+}
+
+func isTerminalName(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+type grammarCompiler struct {
+	toks []string
+	pos  int
+}
+
+func (c *grammarCompiler) peek(offset int) string {
+	if c.pos+offset < len(c.toks) {
+		return c.toks[c.pos+offset]
+	}
+	return ""
+}
+
+func (c *grammarCompiler) next() string {
+	t := c.peek(0)
+	c.pos++
+	return t
+}
+
+// atEnd reports whether the current expression ends here: at the end of the grammar, before
+// the next rule definition, or at a closing parenthesis or alternative.
+func (c *grammarCompiler) atEnd() bool {
+	t := c.peek(0)
+	return t == "" || t == ")" || t == "/" || c.peek(1) == "<-"
+}
+
+func (c *grammarCompiler) choice() (*expr, error) {
+	first, err := c.sequence()
+	if err != nil {
+		return nil, err
+	}
+	alts := []*expr{first}
+	for c.peek(0) == "/" {
+		c.next()
+		alt, err := c.sequence()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, alt)
+	}
+	if len(alts) == 1 {
+		return first, nil
+	}
+	return &expr{kind: exprChoice, items: alts}, nil
+}
+
+func (c *grammarCompiler) sequence() (*expr, error) {
+	var items []*expr
+	for !c.atEnd() {
+		item, err := c.prefixed()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("empty alternative")
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return &expr{kind: exprSeq, items: items}, nil
+}
+
+func (c *grammarCompiler) prefixed() (*expr, error) {
+	switch c.peek(0) {
+	case "&", "!":
+		kind := exprAnd
+		if c.next() == "!" {
+			kind = exprNot
+		}
+		sub, err := c.suffixed()
+		if err != nil {
+			return nil, err
+		}
+		return &expr{kind: kind, sub: sub}, nil
+	}
+	return c.suffixed()
+}
+
+func (c *grammarCompiler) suffixed() (*expr, error) {
+	e, err := c.primary()
+	if err != nil {
+		return nil, err
+	}
+	switch c.peek(0) {
+	case "*":
+		c.next()
+		return &expr{kind: exprRepeat, sub: e, min: 0, max: -1}, nil
+	case "+":
+		c.next()
+		return &expr{kind: exprRepeat, sub: e, min: 1, max: -1}, nil
+	case "?":
+		c.next()
+		return &expr{kind: exprRepeat, sub: e, min: 0, max: 1}, nil
+	}
+	return e, nil
+}
+
+func (c *grammarCompiler) primary() (*expr, error) {
+	t := c.next()
+	switch {
+	case t == "(":
+		e, err := c.choice()
+		if err != nil {
+			return nil, err
+		}
+		if c.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	case t == ".":
+		return &expr{kind: exprAny}, nil
+	case isRuleName(t):
+		return &expr{kind: exprRule, name: t}, nil
+	case isTerminalName(t):
+		return &expr{kind: exprTerminal, name: t}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", t)
+}
+
+type memoEntry struct {
+	end   int
+	nodes []*Node
+	ok    bool
+}
+
+// pegParser matches a grammar against the words of one text.
+type pegParser struct {
+	g    *pegGrammar
+	toks []*token
+	memo map[int]memoEntry
+
+	predicates int             // Depth of & and ! being matched; their failures aren't errors
+	farthest   int             // Farthest word at which a terminal failed to match
+	expected   map[string]bool // Selma'o tried at `farthest`
+}
+
+func newPegParser(g *pegGrammar, toks []*token) *pegParser {
+	return &pegParser{g: g, toks: toks, memo: map[int]memoEntry{}, expected: map[string]bool{}}
+}
+
+// parse matches the start rule and returns its tree.
+func (p *pegParser) parse() (*Node, bool) {
+	end, nodes, ok := p.match(&expr{kind: exprRule, rule: 0}, 0)
+	if !ok || end != len(p.toks) {
+		return nil, false
+	}
+	if len(nodes) == 0 {
+		return &Node{Rule: p.g.rules[0].name}, true // Empty text
+	}
+	return nodes[0], true
+}
+
+// fail records a terminal that didn't match at `pos`.
+func (p *pegParser) fail(pos int, name string) {
+	if p.predicates > 0 || pos < p.farthest {
+		return
+	}
+	if pos > p.farthest {
+		p.farthest = pos
+		clear(p.expected)
+	}
+	p.expected[name] = true
+}
+
+// expectedAtFarthest returns the selma'o tried where the parse got farthest, sorted.
+func (p *pegParser) expectedAtFarthest() []string {
+	names := make([]string, 0, len(p.expected))
+	for name := range p.expected {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (p *pegParser) match(e *expr, pos int) (int, []*Node, bool) {
+	switch e.kind {
+	case exprSeq:
+		var nodes []*Node
+		for _, item := range e.items {
+			end, sub, ok := p.match(item, pos)
+			if !ok {
+				return pos, nil, false
+			}
+			pos = end
+			nodes = append(nodes, sub...)
+		}
+		return pos, nodes, true
+
+	case exprChoice:
+		for _, alt := range e.items {
+			if end, nodes, ok := p.match(alt, pos); ok {
+				return end, nodes, true
+			}
+		}
+		return pos, nil, false
+
+	case exprRepeat:
+		var nodes []*Node
+		start, count := pos, 0
+		for e.max < 0 || count < e.max {
+			end, sub, ok := p.match(e.sub, pos)
+			if !ok || end == pos {
+				break // An empty match would repeat forever
+			}
+			pos = end
+			nodes = append(nodes, sub...)
+			count++
+		}
+		if count < e.min {
+			return start, nil, false
+		}
+		return pos, nodes, true
+
+	case exprAnd, exprNot:
+		p.predicates++
+		_, _, ok := p.match(e.sub, pos)
+		p.predicates--
+		return pos, nil, ok == (e.kind == exprAnd)
+
+	case exprAny:
+		if pos < len(p.toks) {
+			return pos + 1, []*Node{p.toks[pos].node()}, true
+		}
+		p.fail(pos, "any word")
+		return pos, nil, false
+
+	case exprTerminal:
+		if pos < len(p.toks) && p.toks[pos].class == e.name {
+			return pos + 1, []*Node{p.toks[pos].node()}, true
+		}
+		p.fail(pos, e.name)
+		return pos, nil, false
+
+	case exprRule:
+		key := pos*len(p.g.rules) + e.rule
+		if m, ok := p.memo[key]; ok {
+			return m.end, m.nodes, m.ok
+		}
+		r := p.g.rules[e.rule]
+		end, nodes, ok := p.match(r.body, pos)
+		if ok && !r.hidden {
+			if end == pos {
+				nodes = nil // Nothing matched; leave the rule out of the tree
+			} else {
+				nodes = []*Node{{
+					Rule:     r.name,
+					Start:    p.toks[pos].start,
+					End:      p.toks[end-1].end,
+					Children: nodes,
+				}}
+			}
+		}
+		p.memo[key] = memoEntry{end: end, nodes: nodes, ok: ok}
+		return end, nodes, ok
+	}
+	panic("parser: unknown expression kind")
+}
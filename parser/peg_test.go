@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// toyGrammar is a grammar small enough to follow by hand: sentences of sumti around a
+// selbri, with an elidable terminator.
+const toyGrammar = `
+text     <- sentence+ !.
+sentence <- _sumti* selbri _sumti*
+selbri   <- BRIVLA+
+_sumti   <- KOhA / LE selbri KU?
+`
+
+// toyTerminals are the selma'o of the toy grammar.
+var toyTerminals = map[string]bool{"BRIVLA": true, "KOhA": true, "LE": true, "KU": true}
+
+// shapeOf renders a parse tree as rules with their parts in parentheses, and words as their
+// selma'o.
+func shapeOf(n *Node) string {
+	if n.Rule == "" {
+		return n.Selmaho
+	}
+	var parts []string
+	for _, c := range n.Children {
+		parts = append(parts, shapeOf(c))
+	}
+	return n.Rule + "(" + strings.Join(parts, " ") + ")"
+}
+
+func TestCompileGrammarErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar string
+		want    string
+	}{
+		{"no rules", "# only a comment", "grammar: no rules"},
+		{"not a rule", "KOhA <- BRIVLA", `grammar: expected a rule definition at "KOhA"`},
+		{"defined twice", "a <- KOhA\na <- BRIVLA", "grammar: rule a is defined twice"},
+		{"undefined rule", "a <- b", "grammar: undefined rule b"},
+		{"unknown selma'o", "a <- GOI", "grammar: unknown selma'o GOI"},
+		{"empty alternative", "a <- KOhA / ", "grammar: rule a: empty alternative"},
+		{"unclosed parenthesis", "a <- (KOhA BRIVLA", "grammar: rule a: missing )"},
+		{"stray character", "a <- KOhA ;", `grammar: rule a: unexpected ";"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileGrammar(tt.grammar, toyTerminals)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("compileGrammar(%q) = %v, want %q", tt.grammar, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPegParser(t *testing.T) {
+	g, err := compileGrammar(toyGrammar, toyTerminals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		words    string
+		want     string
+		farthest int
+		expected string
+	}{
+		{"sumti selbri sumti", "KOhA BRIVLA KOhA", "text(sentence(KOhA selbri(BRIVLA) KOhA))", 0, ""},
+		{"tanru", "BRIVLA BRIVLA", "text(sentence(selbri(BRIVLA BRIVLA)))", 0, ""},
+		{"terminator", "LE BRIVLA KU BRIVLA", "text(sentence(LE selbri(BRIVLA) KU selbri(BRIVLA)))", 0, ""},
+		// Without KU, the description takes both brivla and the sentence has no selbri.
+		{"elided terminator", "LE BRIVLA BRIVLA", "", 3, "BRIVLA, KOhA, KU, LE"},
+		{"no selbri", "KOhA", "", 1, "BRIVLA, KOhA, LE"},
+		{"stray terminator", "BRIVLA KU", "", 1, "BRIVLA, KOhA, LE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var toks []*token
+			for _, class := range strings.Fields(tt.words) {
+				toks = append(toks, &token{class: class})
+			}
+			p := newPegParser(g, toks)
+			tree, ok := p.parse()
+			if tt.want != "" {
+				if !ok {
+					t.Fatalf("%s: no parse, farthest %d", tt.words, p.farthest)
+				}
+				if got := shapeOf(tree); got != tt.want {
+					t.Errorf("%s = %s, want %s", tt.words, got, tt.want)
+				}
+				return
+			}
+			if ok {
+				t.Fatalf("%s parsed as %s, want a failure", tt.words, shapeOf(tree))
+			}
+			if got := strings.Join(p.expectedAtFarthest(), ", "); p.farthest != tt.farthest || got != tt.expected {
+				t.Errorf("%s failed at %d expecting %s, want %d expecting %s", tt.words, p.farthest, got, tt.farthest, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Package parser, as part of the dictionary module.
+// This file, `service.go`, puts the lexer and the grammar together. Both the grammar and the
+// selma'o table are embedded in the binary and compiled once, when the service is created;
+// parsing needs no database.
+package parser
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// maxTextLength bounds the text of a parse request, in bytes.
+const maxTextLength = 20000
+
+// maxExpectedInMessage bounds how many expected selma'o an error message lists; the error's
+// `expected` field has all of them.
+const maxExpectedInMessage = 8
+
+//go:embed grammar.peg
+var grammarSource string
+
+//go:embed selmaho.txt
+var selmahoSource string
+
+// ParseService provides the grammar parse API.
+type ParseService struct {
+	grammar *pegGrammar
+	selmaho map[string]string // cmavo -> selma'o
+}
+
+// NewParseService compiles the embedded grammar. An error means the embedded files are
+// broken.
+func NewParseService() (*ParseService, error) {
+	selmaho, err := loadSelmaho(selmahoSource)
+	if err != nil {
+		return nil, err
+	}
+	terminals := map[string]bool{"BRIVLA": true, "CMEVLA": true}
+	for _, class := range selmaho {
+		terminals[class] = true
+	}
+	g, err := compileGrammar(grammarSource, terminals)
+	if err != nil {
+		return nil, err
+	}
+	return &ParseService{grammar: g, selmaho: selmaho}, nil
+}
+
+// loadSelmaho reads the `CLASS: cmavo...` lines of the selma'o table.
+func loadSelmaho(src string) (map[string]string, error) {
+	selmaho := map[string]string{}
+	for n, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		class, words, ok := strings.Cut(line, ":")
+		if !ok || !isTerminalName(class) {
+			return nil, fmt.Errorf("selmaho.txt:%d: expected CLASS: cmavo...", n+1)
+		}
+		for _, w := range strings.Fields(words) {
+			if other, dup := selmaho[w]; dup {
+				return nil, fmt.Errorf("selmaho.txt:%d: %s is already in %s", n+1, w, other)
+			}
+			selmaho[w] = class
+		}
+	}
+	return selmaho, nil
+}
+
+// Parse parses a Lojban text. A text that doesn't parse is not an error: the response says
+// where it goes wrong.
+func (s *ParseService) Parse(text string) (*ParseResponse, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, apperror.NewBadRequestError("text is required", nil)
+	}
+	if len(text) > maxTextLength {
+		return nil, apperror.NewBadRequestError(fmt.Sprintf("text must be at most %d bytes", maxTextLength), nil)
+	}
+
+	toks, leading, lexErr := lex(text, s.selmaho)
+	if lexErr != nil {
+		return &ParseResponse{Errors: []ParseError{newParseError(text, lexErr.offset, lexErr.message, nil, "")}}, nil
+	}
+
+	p := newPegParser(s.grammar, toks)
+	tree, ok := p.parse()
+	if !ok {
+		offset, found := len(text), "end of text"
+		if p.farthest < len(toks) {
+			t := toks[p.farthest]
+			offset, found = t.start, fmt.Sprintf("%q (%s)", text[t.start:t.end], t.class)
+		}
+		expected := p.expectedAtFarthest()
+		message := "unexpected " + found
+		if len(expected) > 0 {
+			listed := expected[:min(len(expected), maxExpectedInMessage)]
+			message += "; expected " + strings.Join(listed, ", ")
+			if len(expected) > len(listed) {
+				message += ", ..."
+			}
+		}
+		return &ParseResponse{Errors: []ParseError{newParseError(text, offset, message, expected, found)}}, nil
+	}
+	for _, t := range leading {
+		tree.Indicators = append(tree.Indicators, t.node())
+	}
+	return &ParseResponse{Valid: true, Tree: tree, Errors: []ParseError{}}, nil
+}
+
+// newParseError locates a byte offset of the text by line and column.
+func newParseError(text string, offset int, message string, expected []string, found string) ParseError {
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	if expected == nil {
+		expected = []string{}
+	}
+	return ParseError{Message: message, Offset: offset, Line: line, Column: column, Expected: expected, Found: found}
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	s, err := NewParseService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := []string{
+		"mi klama le zarci",
+		"lo mlatu cu citka lo finpe",
+		"la .alis. cu klama le zarci .i mi klama",
+		"coi",
+		"mi djica lo nu do klama",
+		"ro da poi prenu cu morsi",
+		"mi pu klama le zarci",
+		"mi ba'o citka",
+		"ko'a sisku le se cmene",
+		"zo mi valsi",
+		"mi klama le zarci gi'e citka lo plise",
+		"mi ui klama",
+	}
+	for _, text := range valid {
+		t.Run(text, func(t *testing.T) {
+			resp, err := s.Parse(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !resp.Valid {
+				t.Fatalf("Parse(%q) failed: %+v", text, resp.Errors)
+			}
+			if resp.Tree.Rule != "text" || resp.Tree.Start != 0 {
+				t.Errorf("Parse(%q) tree = %s at %d, want text at 0", text, resp.Tree.Rule, resp.Tree.Start)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	s, err := NewParseService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text   string
+		line   int
+		column int
+		found  string
+	}{
+		{"mi klama le", 1, 12, "end of text"},
+		{"mi klama\nle cu", 2, 4, `"cu" (CU)`},
+		{"mi cu cu klama", 1, 7, `"cu" (CU)`},
+		{"mi klama ?", 1, 10, ""},
+		{"mi .ąa", 1, 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			resp, err := s.Parse(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Valid || len(resp.Errors) != 1 {
+				t.Fatalf("Parse(%q) = valid %v with %d errors, want one error", tt.text, resp.Valid, len(resp.Errors))
+			}
+			e := resp.Errors[0]
+			if e.Line != tt.line || e.Column != tt.column || e.Found != tt.found {
+				t.Errorf("Parse(%q) error at %d:%d found %q, want %d:%d found %q", tt.text, e.Line, e.Column, e.Found, tt.line, tt.column, tt.found)
+			}
+			if tt.found != "" && !strings.HasPrefix(e.Message, "unexpected "+tt.found) {
+				t.Errorf("Parse(%q) message = %q", tt.text, e.Message)
+			}
+		})
+	}
+}
+
+func TestParseRejectsEmptyAndLongText(t *testing.T) {
+	s, err := NewParseService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"", " \n", strings.Repeat("mi ", maxTextLength)} {
+		if _, err := s.Parse(text); err == nil {
+			t.Errorf("Parse of %d bytes succeeded, want an error", len(text))
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Package preflight checks a deployment's configuration without starting the server. It is run
+// with `lensisku check`: the configuration is loaded and validated, the TLS certificate, if
+// any, is loaded, then every external service it names (Postgres and its replicas, Redis, the
+// SMTP server, the embedding provider) is contacted once, and the result is printed as a report, as text or as JSON for deployment
+// pipelines. The command exits non-zero if any check failed.
+package preflight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/email"
+	"github.com/user/lensisku-go/embedding"
+	"github.com/user/lensisku-go/tlsserver"
+)
+
+// checkTimeout bounds each check, so an unreachable service can't stall a pipeline.
+const checkTimeout = 15 * time.Second
+
+// Status values of a Result.
+const (
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped" // The service isn't configured
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of all checks.
+type Report struct {
+	OK     bool     `json:"ok"`
+	Env    string   `json:"env,omitempty"`
+	Checks []Result `json:"checks"`
+}
+
+// Run loads the configuration and checks the services it names. When the configuration doesn't
+// load, the other checks are skipped, since they would only repeat its errors.
+func Run(ctx context.Context) *Report {
+	report := &Report{OK: true}
+	var cfg *config.AppConfig
+	report.add(ctx, "config", func(context.Context) (string, error) {
+		var err error
+		cfg, err = config.LoadConfig()
+		if err != nil {
+			return "", err
+		}
+		return "APP_ENV=" + cfg.Env, nil
+	})
+	if cfg == nil {
+		return report
+	}
+	report.Env = cfg.Env
+
+	if !cfg.Server.TLS.Enabled() {
+		report.skip("tls", "TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS are not set; a proxy terminates TLS")
+	} else {
+		report.add(ctx, "tls", func(context.Context) (string, error) {
+			return tlsserver.Check(cfg.Server.TLS)
+		})
+	}
+
+	report.add(ctx, "postgres", func(ctx context.Context) (string, error) {
+		version, err := db.CheckConnection(ctx, cfg.DBPools.AppPool)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s:%d/%s, PostgreSQL %s", cfg.DBPools.AppPool.Host, cfg.DBPools.AppPool.Port, cfg.DBPools.AppPool.DBName, version), nil
+	})
+	for i, dsn := range cfg.DBPools.ReplicaDSNs {
+		report.add(ctx, fmt.Sprintf("postgres replica %d", i+1), func(ctx context.Context) (string, error) {
+			version, err := db.CheckReplica(ctx, dsn)
+			if err != nil {
+				return "", err
+			}
+			return "PostgreSQL " + version, nil
+		})
+	}
+
+	if cfg.Redis.URL == "" {
+		report.skip("redis", "REDIS_URL is not set")
+	} else {
+		report.add(ctx, "redis", func(ctx context.Context) (string, error) {
+			client, err := cache.NewRedis(ctx, cfg.Redis)
+			if err != nil {
+				return "", err
+			}
+			defer client.Close()
+			return client.Options().Addr, nil
+		})
+	}
+
+	if cfg.Email.SMTPHost == "" {
+		report.skip("smtp", "SMTP_HOST is not set; emails are logged")
+	} else {
+		report.add(ctx, "smtp", func(ctx context.Context) (string, error) {
+			if err := email.CheckSMTP(ctx, cfg.Email); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s:%d, TLS mode %s", cfg.Email.SMTPHost, cfg.Email.SMTPPort, cfg.Email.TLSMode), nil
+		})
+	}
+
+	if cfg.Embedding.Provider == config.EmbeddingProviderNone {
+		report.skip("embedding", "EMBEDDING_PROVIDER is none")
+	} else {
+		// A one-word request: it costs a few tokens with a paid API, but it is the only way to
+		// know the key and the model are accepted.
+		report.add(ctx, "embedding", func(ctx context.Context) (string, error) {
+			embedder, err := embedding.New(cfg.Embedding)
+			if err != nil {
+				return "", err
+			}
+			vectors, err := embedder.Embed(ctx, []string{"lensisku"})
+			if err != nil {
+				return "", err
+			}
+			if len(vectors) != 1 {
+				return "", fmt.Errorf("expected 1 vector, got %d", len(vectors))
+			}
+			return fmt.Sprintf("%s, model %s, %d dimensions", cfg.Embedding.Provider, embedder.Model(), len(vectors[0])), nil
+		})
+	}
+	return report
+}
+
+// add runs one check and records its result.
+func (r *Report) add(ctx context.Context, name string, check func(ctx context.Context) (string, error)) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	start := time.Now()
+	detail, err := check(ctx)
+	result := Result{Name: name, Status: StatusOK, Detail: detail, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status, result.Detail = StatusFailed, err.Error()
+		r.OK = false
+	}
+	r.Checks = append(r.Checks, result)
+}
+
+// skip records a check that doesn't apply.
+func (r *Report) skip(name, reason string) {
+	r.Checks = append(r.Checks, Result{Name: name, Status: StatusSkipped, Detail: reason})
+}
+
+// WriteText prints the report as a table, one check per line. Multi-line details, such as the
+// list of configuration errors, are indented below their check.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range r.Checks {
+		first, rest, _ := strings.Cut(c.Detail, "\n")
+		fmt.Fprintf(tw, "%s\t%s\t%dms\t%s\n", c.Name, strings.ToUpper(c.Status), c.DurationMS, first)
+		for _, line := range strings.Split(rest, "\n") {
+			if line != "" {
+				fmt.Fprintf(tw, "\t\t\t  %s\n", line)
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	verdict := "All checks passed."
+	if !r.OK {
+		verdict = "Some checks failed."
+	}
+	_, err := fmt.Fprintln(w, verdict)
+	return err
+}
+
+// WriteJSON prints the report as a JSON object.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
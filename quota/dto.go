@@ -0,0 +1,20 @@
+// Package quota, as part of the API usage module.
+// This file, `dto.go`, defines the response payloads of the module.
+package quota
+
+import "time"
+
+// UsageResponse reports the caller's API usage for the current day (UTC).
+// @Description API usage of the current day; limit and remaining are omitted when no quota is configured
+type UsageResponse struct {
+	// Requests made today
+	// example: 120
+	Used int `json:"used"`
+	// example: 10000
+	Limit *int `json:"limit,omitempty"`
+	// example: 9880
+	Remaining *int `json:"remaining,omitempty"`
+	// When the counter resets (midnight UTC)
+	// example: 2024-05-02T00:00:00Z
+	ResetAt time.Time `json:"reset_at"`
+}
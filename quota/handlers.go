@@ -0,0 +1,50 @@
+// Package quota, as part of the API usage module.
+// This file, `handlers.go`, exposes the caller's usage over HTTP.
+package quota
+
+import (
+	"net/http"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+)
+
+// Handlers holds the HTTP handlers of the quota module.
+type Handlers struct {
+	service *Service
+}
+
+// NewHandlers creates the quota handlers.
+func NewHandlers(service *Service) *Handlers {
+	return &Handlers{service: service}
+}
+
+// HandleGetUsage godoc
+// @Summary Get current user's API usage
+// @Description Returns the number of API requests made today, the remaining daily quota and when it resets.
+// @Description This endpoint does not count against the quota.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} UsageResponse "Usage"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/usage [get]
+func (h *Handlers) HandleGetUsage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		usage, err := h.service.GetUsage(r.Context(), UserSubject(userID))
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, usage)
+	}
+}
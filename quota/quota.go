@@ -0,0 +1,118 @@
+// Package quota, as part of the API usage module.
+// This file, `quota.go`, counts API requests per caller and enforces a daily quota. Counters live
+// in the `api_usage` table, one row per caller ("subject") and UTC day, so every API instance
+// sees the same numbers and counters reset at midnight UTC without any cleanup job.
+//
+// A subject is a string such as "user:42". Requests are only counted once a caller is
+// authenticated, which is why the middleware runs after `auth.JWTMiddleware`; other kinds of
+// credentials (e.g. API keys) only need their own subject prefix.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+// Service records and reports API usage.
+type Service struct {
+	db     *pgxpool.Pool
+	cfg    *config.QuotaConfig
+	logger *slog.Logger
+}
+
+// NewService creates a quota service.
+func NewService(db *pgxpool.Pool, cfg *config.QuotaConfig) *Service {
+	return &Service{db: db, cfg: cfg, logger: logging.For("quota")}
+}
+
+// UserSubject returns the usage subject of a user account.
+func UserSubject(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// nextReset returns the moment the current day's counters stop applying.
+func nextReset(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// record counts one request for `subject` and returns the number of requests made today.
+func (s *Service) record(ctx context.Context, subject string) (int, error) {
+	var count int
+	err := s.db.QueryRow(ctx, `
+		INSERT INTO api_usage (subject, day, request_count)
+		VALUES ($1, (now() AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (subject, day) DO UPDATE SET request_count = api_usage.request_count + 1
+		RETURNING request_count`, subject).Scan(&count)
+	return count, err
+}
+
+// GetUsage reports today's usage of `subject`.
+func (s *Service) GetUsage(ctx context.Context, subject string) (*UsageResponse, error) {
+	var used int
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(request_count), 0)
+		FROM api_usage
+		WHERE subject = $1 AND day = (now() AT TIME ZONE 'UTC')::date`, subject).Scan(&used)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load API usage", err)
+	}
+
+	resp := &UsageResponse{Used: used, ResetAt: nextReset(time.Now())}
+	if s.cfg.DailyLimit > 0 {
+		limit := s.cfg.DailyLimit
+		remaining := max(limit-used, 0)
+		resp.Limit = &limit
+		resp.Remaining = &remaining
+	}
+	return resp, nil
+}
+
+// Middleware counts each authenticated request and rejects it with 429 Too Many Requests
+// once the caller has used up the daily quota. Every counted response carries the usual
+// X-RateLimit-* headers. When the counter can't be updated the request is let through:
+// an outage of the usage table should not take the whole API down with it.
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		used, err := s.record(r.Context(), UserSubject(userID))
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "Failed to record API usage", "user_id", userID, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.cfg.DailyLimit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reset := nextReset(time.Now())
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.cfg.DailyLimit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(s.cfg.DailyLimit-used, 0)))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if used > s.cfg.DailyLimit {
+			auth.WriteError(w, r, apperror.NewRateLimitError(
+				fmt.Sprintf("daily API quota of %d requests exceeded; it resets at %s", s.cfg.DailyLimit, reset.Format(time.RFC3339)), nil).
+				WithCode(apperror.CodeQuotaExceeded).WithRetryAfter(time.Until(reset)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
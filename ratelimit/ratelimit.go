@@ -0,0 +1,105 @@
+// Package ratelimit limits how many requests a user makes in a short window, for routes that
+// need a tighter bound than the daily quota (see the `quota` package), such as the admin API.
+// Requests are counted in fixed windows: in Redis when it is configured, so the limit holds
+// across instances, otherwise in the memory of each instance.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/logging"
+)
+
+// Limiter counts the requests of each user in the current window.
+type Limiter struct {
+	name   string
+	limit  int
+	window time.Duration
+	rdb    *cache.Redis
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	start  time.Time   // Start of the window `counts` belong to
+	counts map[int]int // Requests per user in that window, without Redis
+}
+
+// New creates a limiter letting each user make `limit` requests per `window`. The name keeps
+// the Redis keys of different limiters apart. With a nil `rdb`, requests are counted in memory.
+func New(name string, limit int, window time.Duration, rdb *cache.Redis) *Limiter {
+	return &Limiter{
+		name:   name,
+		limit:  limit,
+		window: window,
+		rdb:    rdb,
+		logger: logging.For("ratelimit"),
+		counts: make(map[int]int),
+	}
+}
+
+// count records a request of `userID` in the window starting at `start` and returns the
+// number of requests made in it.
+func (l *Limiter) count(ctx context.Context, userID int, start time.Time) (int, error) {
+	if l.rdb == nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if !l.start.Equal(start) {
+			l.start = start
+			clear(l.counts)
+		}
+		l.counts[userID]++
+		return l.counts[userID], nil
+	}
+
+	key := l.rdb.Key(fmt.Sprintf("ratelimit:%s:%d:%d", l.name, userID, start.Unix()))
+	pipe := l.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, l.window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// Middleware rejects the requests of a user over the limit with 429 Too Many Requests, with
+// the X-RateLimit-* headers of the window on every counted response. It runs after
+// `auth.JWTMiddleware`; anonymous requests aren't counted. When the counter can't be updated
+// the request is let through, as the quota middleware does.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok || l.limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now().Truncate(l.window)
+		used, err := l.count(r.Context(), userID, start)
+		if err != nil {
+			l.logger.ErrorContext(r.Context(), "Failed to count request", "limiter", l.name, "user_id", userID, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reset := start.Add(l.window)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(l.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(l.limit-used, 0)))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if used > l.limit {
+			auth.WriteError(w, r, apperror.NewRateLimitError(
+				fmt.Sprintf("rate limit of %d requests per %s exceeded", l.limit, l.window), nil).
+				WithRetryAfter(time.Until(reset)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,109 @@
+// Package relations, as part of the dictionary module.
+// This file, `dto.go`, defines the request and response bodies of the word relation API.
+package relations
+
+import "time"
+
+// Relation types. A relation reads "<from> is <type> <to>".
+const (
+	// RafsiOf: `from` is a rafsi (combining form) of `to`, e.g. kla of klama.
+	RafsiOf = "rafsi-of"
+	// LujvoComponent: `from` is one of the words the lujvo `to` is built from.
+	LujvoComponent = "lujvo-component"
+	// BorrowedFrom: `from` was borrowed or derived from `to`.
+	BorrowedFrom = "borrowed-from"
+	// SeeAlso: the words are related in meaning. It has no direction.
+	SeeAlso = "see-also"
+)
+
+// relationTypes lists the valid relation types.
+var relationTypes = []string{RafsiOf, LujvoComponent, BorrowedFrom, SeeAlso}
+
+// ListRelationsQuery selects the word whose relations are listed.
+type ListRelationsQuery struct {
+	Word string `form:"word" validate:"required"`
+}
+
+// GraphQuery selects the neighborhood of a word. The depth bounds how many relations away
+// from the center the graph reaches.
+type GraphQuery struct {
+	Word  string   `form:"word" validate:"required"`
+	Depth int      `form:"depth" default:"2" validate:"min=1,max=3"`
+	Types []string `form:"types" validate:"dive,oneof=rafsi-of lujvo-component borrowed-from see-also"`
+}
+
+// RelationResponse is one relation between two words.
+// @Description A relation between two Lojban words
+type RelationResponse struct {
+	// example: 17
+	ID int64 `json:"id"`
+	// example: "kla"
+	From string `json:"from"`
+	// example: 1234
+	FromID int32 `json:"from_id"`
+	// example: "klama"
+	To string `json:"to"`
+	// example: 678
+	ToID int32 `json:"to_id"`
+	// rafsi-of, lujvo-component, borrowed-from or see-also
+	// example: "rafsi-of"
+	Type string  `json:"type"`
+	Note *string `json:"note,omitempty"`
+	// Absent if the account no longer exists
+	CreatedBy *int32 `json:"created_by,omitempty"`
+	// example: "2024-01-15T10:30:00Z"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateRelationRequest is the body of a new relation.
+// @Description Request body for relating two words
+type CreateRelationRequest struct {
+	// example: "kla"
+	From string `json:"from" validate:"required"`
+	// example: "klama"
+	To string `json:"to" validate:"required"`
+	// rafsi-of, lujvo-component, borrowed-from or see-also
+	// example: "rafsi-of"
+	Type string `json:"type" validate:"required,oneof=rafsi-of lujvo-component borrowed-from see-also"`
+	Note string `json:"note,omitempty"`
+}
+
+// GraphNode is a word in a neighborhood graph.
+// @Description A word in a relation graph
+type GraphNode struct {
+	// example: 678
+	ID int32 `json:"id"`
+	// example: "klama"
+	Word string `json:"word"`
+	// Word type, e.g. gismu or lujvo
+	// example: "gismu"
+	Type string `json:"type"`
+	// Number of relations between this word and the center; 0 for the center itself
+	// example: 1
+	Distance int `json:"distance"`
+}
+
+// GraphEdge is a relation in a neighborhood graph.
+// @Description A relation in a relation graph
+type GraphEdge struct {
+	// example: 17
+	ID int64 `json:"id"`
+	// example: 1234
+	From int32 `json:"from"`
+	// example: 678
+	To int32 `json:"to"`
+	// example: "rafsi-of"
+	Type string `json:"type"`
+}
+
+// GraphResponse is the neighborhood of a word, in the node/edge shape graph visualization
+// libraries expect.
+// @Description The neighborhood of a word in the relation graph
+type GraphResponse struct {
+	// example: 678
+	Center int32       `json:"center"`
+	Nodes  []GraphNode `json:"nodes"`
+	Edges  []GraphEdge `json:"edges"`
+	// Set when the node limit cut the neighborhood short
+	Truncated bool `json:"truncated"`
+}
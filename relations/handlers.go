@@ -0,0 +1,161 @@
+// Package relations encapsulates relations between Lojban words (rafsi, lujvo components,
+// etymology, "see also") and the neighborhood graphs built from them.
+// This file, `handlers.go`, serves /api/v1/relations: the relations of a word, its neighborhood
+// graph, and adding and removing relations.
+package relations
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// RelationHandlers provides HTTP handlers for word relations.
+type RelationHandlers struct {
+	service *RelationService
+}
+
+// NewRelationHandlers creates new RelationHandlers.
+func NewRelationHandlers(service *RelationService) *RelationHandlers {
+	return &RelationHandlers{service: service}
+}
+
+// HandleListRelations godoc
+// @Summary List the relations of a word
+// @Description Returns every relation the word takes part in, whether it is the `from` or the `to` side.
+// @Tags relations
+// @Produce json
+// @Param word query string true "Lojban word"
+// @Success 200 {array} RelationResponse "Relations"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing word"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/relations [get]
+func (h *RelationHandlers) HandleListRelations() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q ListRelationsQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		relations, err := h.service.List(r.Context(), q.Word)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, relations)
+	}
+}
+
+// HandleGraph godoc
+// @Summary Get the relation graph around a word
+// @Description Returns the words within `depth` relations of a word, following relations in both directions, and the relations between them as nodes and edges for visualization. At most 200 words are returned, nearest first.
+// @Tags relations
+// @Produce json
+// @Param word query string true "Lojban word at the center"
+// @Param depth query int false "Relations to follow outward (default 2, max 3)"
+// @Param types query string false "Comma-separated relation types to follow (default all)"
+// @Success 200 {object} GraphResponse "Neighborhood graph"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing word, invalid depth or unknown type"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/relations/graph [get]
+func (h *RelationHandlers) HandleGraph() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q GraphQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		graph, err := h.service.Graph(r.Context(), q.Word, q.Depth, q.Types)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, graph)
+	}
+}
+
+// HandleCreateRelation godoc
+// @Summary Relate two words
+// @Description Adds a relation "<from> is <type> <to>", e.g. kla rafsi-of klama. see-also has no direction, so it can't be added again with the words swapped.
+// @Tags relations
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param relation body CreateRelationRequest true "New relation"
+// @Success 201 {object} RelationResponse "Created relation"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid payload or type"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Relation already exists"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/relations [post]
+func (h *RelationHandlers) HandleCreateRelation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req CreateRelationRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		relation, err := h.service.Create(r.Context(), userID, req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusCreated, relation)
+	}
+}
+
+// HandleDeleteRelation godoc
+// @Summary Remove a relation
+// @Description Removes a relation between two words. Only the user who added it, trusted users and admins may remove it.
+// @Tags relations
+// @Security BearerAuth
+// @Param relationID path int true "Relation ID"
+// @Success 204 "Removed"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid relation ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Not allowed to remove this relation"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Relation not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/relations/{relationID} [delete]
+func (h *RelationHandlers) HandleDeleteRelation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		relationID, err := strconv.ParseInt(chi.URLParam(r, "relationID"), 10, 64)
+		if err != nil || relationID < 1 {
+			auth.WriteError(w, r, apperror.NewBadRequestError("invalid relationID", err))
+			return
+		}
+
+		if err := h.service.Delete(r.Context(), relationID, userID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
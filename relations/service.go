@@ -0,0 +1,268 @@
+// Package relations, as part of the dictionary module.
+// This file, `service.go`, stores relations between words (etymology, rafsi, lujvo
+// components, "see also") in `valsi_relations` and walks them to build the neighborhood graph
+// of a word for visualization. For the walk every relation counts in both directions: klama's
+// neighborhood includes its rafsi as well as the lujvo built from it.
+//
+// Anyone logged in may add a relation; the user who added it, trusted users and admins may
+// remove it.
+package relations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/changelog"
+	"github.com/user/lensisku-go/db"
+)
+
+const (
+	// maxGraphNodes bounds the size of a graph; the nearest words are kept.
+	maxGraphNodes = 200
+	// maxNoteLength bounds the note of a relation, in characters.
+	maxNoteLength = 500
+)
+
+// RelationService provides the word relation API.
+type RelationService struct {
+	db *pgxpool.Pool
+}
+
+// NewRelationService creates a new RelationService.
+func NewRelationService(db *pgxpool.Pool) *RelationService {
+	return &RelationService{db: db}
+}
+
+// relationSelect reads RelationResponse rows; callers append their clauses.
+const relationSelect = `
+	SELECT r.id, f.word, r.from_valsiid, t.word, r.to_valsiid, r.relation, r.note, r.created_by, r.created_at
+	FROM valsi_relations r
+	JOIN valsi f ON f.valsiid = r.from_valsiid
+	JOIN valsi t ON t.valsiid = r.to_valsiid`
+
+func scanRelation(row pgx.Row) (*RelationResponse, error) {
+	var rel RelationResponse
+	err := row.Scan(&rel.ID, &rel.From, &rel.FromID, &rel.To, &rel.ToID, &rel.Type, &rel.Note, &rel.CreatedBy, &rel.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rel, nil
+}
+
+// List returns every relation a word takes part in, on either side.
+func (s *RelationService) List(ctx context.Context, word string) ([]RelationResponse, error) {
+	valsiID, err := s.valsiID(ctx, s.db, word)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, relationSelect+`
+		WHERE r.from_valsiid = $1 OR r.to_valsiid = $1
+		ORDER BY r.relation, f.word, t.word`, valsiID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list relations", err)
+	}
+	defer rows.Close()
+	relations := []RelationResponse{}
+	for rows.Next() {
+		rel, err := scanRelation(rows)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to read relation", err)
+		}
+		relations = append(relations, *rel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list relations", err)
+	}
+	return relations, nil
+}
+
+// Create relates two words. A relation that already exists is a conflict; for see-also that
+// includes the same pair in the other order.
+func (s *RelationService) Create(ctx context.Context, userID int, req CreateRelationRequest) (*RelationResponse, error) {
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > maxNoteLength {
+		return nil, apperror.NewBadRequestError(fmt.Sprintf("notes are limited to %d characters", maxNoteLength), nil)
+	}
+
+	var rel *RelationResponse
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+
+		fromID, err := s.valsiID(ctx, tx, req.From)
+		if err != nil {
+			return err
+		}
+		toID, err := s.valsiID(ctx, tx, req.To)
+		if err != nil {
+			return err
+		}
+		if fromID == toID {
+			return apperror.NewBadRequestError("a word can't be related to itself", nil)
+		}
+
+		var id int64
+		err = tx.QueryRow(ctx, `
+			INSERT INTO valsi_relations (from_valsiid, to_valsiid, relation, note, created_by)
+			SELECT $1, $2, $3, NULLIF($4, ''), $5
+			WHERE NOT ($3 = 'see-also' AND EXISTS (
+				SELECT 1 FROM valsi_relations WHERE from_valsiid = $2 AND to_valsiid = $1 AND relation = $3))
+			ON CONFLICT (from_valsiid, to_valsiid, relation) DO NOTHING
+			RETURNING id`, fromID, toID, req.Type, note, userID).Scan(&id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewConflictError("this relation already exists", nil).WithCode(apperror.CodeDuplicate)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to create relation", err)
+		}
+		rel, err = scanRelation(tx.QueryRow(ctx, relationSelect+` WHERE r.id = $1`, id))
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load relation", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// Delete removes a relation.
+func (s *RelationService) Delete(ctx context.Context, relationID int64, userID int) error {
+	var createdBy *int32
+	var role string
+	err := s.db.QueryRow(ctx, `
+		SELECT created_by, COALESCE((SELECT role FROM users WHERE userid = $2), '')
+		FROM valsi_relations WHERE id = $1`, relationID, userID).Scan(&createdBy, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apperror.NewNotFoundError(fmt.Sprintf("relation with ID %d not found", relationID), nil)
+	}
+	if err != nil {
+		return apperror.NewDatabaseError("failed to load relation", err)
+	}
+	if (createdBy == nil || *createdBy != int32(userID)) && role != auth.RoleTrusted && role != auth.RoleAdmin {
+		return apperror.NewUnauthorizedError("only the user who added a relation, trusted users and admins can remove it", nil)
+	}
+
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if err := changelog.SetActor(ctx, tx, userID, changelog.SourceAPI); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM valsi_relations WHERE id = $1`, relationID); err != nil {
+			return apperror.NewDatabaseError("failed to delete relation", err)
+		}
+		return nil
+	})
+}
+
+// Graph returns the words within `depth` relations of `word` and the relations between them,
+// following only `types` (all types if empty). The nearest `maxGraphNodes` words are kept.
+func (s *RelationService) Graph(ctx context.Context, word string, depth int, types []string) (*GraphResponse, error) {
+	if len(types) == 0 {
+		types = relationTypes
+	}
+	center, err := s.valsiID(ctx, s.db, word)
+	if err != nil {
+		return nil, err
+	}
+
+	var graph *GraphResponse
+	err = db.WithTxOptions(ctx, s.db, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		// Breadth-first walk over relations in both directions. UNION drops repeated
+		// (word, distance) pairs, and the depth bound ends cycles; each word keeps its shortest
+		// distance. One extra row tells whether the limit cut anything off.
+		rows, err := tx.Query(ctx, `
+			WITH RECURSIVE walk(valsiid, distance) AS (
+				SELECT $1::int, 0
+				UNION
+				SELECT CASE WHEN r.from_valsiid = w.valsiid THEN r.to_valsiid ELSE r.from_valsiid END, w.distance + 1
+				FROM walk w
+				JOIN valsi_relations r ON (r.from_valsiid = w.valsiid OR r.to_valsiid = w.valsiid)
+				WHERE w.distance < $2 AND r.relation = ANY($3)
+			),
+			nearest AS (
+				SELECT valsiid, MIN(distance) AS distance FROM walk GROUP BY valsiid
+			)
+			SELECT v.valsiid, v.word, COALESCE(t.descriptor, ''), n.distance
+			FROM nearest n
+			JOIN valsi v ON v.valsiid = n.valsiid
+			LEFT JOIN valsitypes t ON t.typeid = v.typeid
+			ORDER BY n.distance, v.word
+			LIMIT $4`, center, depth, types, maxGraphNodes+1)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to walk relations", err)
+		}
+		graph = &GraphResponse{Center: center, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+		for rows.Next() {
+			var n GraphNode
+			if err := rows.Scan(&n.ID, &n.Word, &n.Type, &n.Distance); err != nil {
+				rows.Close()
+				return apperror.NewDatabaseError("failed to read graph node", err)
+			}
+			graph.Nodes = append(graph.Nodes, n)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return apperror.NewDatabaseError("failed to walk relations", err)
+		}
+		if len(graph.Nodes) > maxGraphNodes {
+			graph.Nodes = graph.Nodes[:maxGraphNodes]
+			graph.Truncated = true
+		}
+
+		ids := make([]int32, len(graph.Nodes))
+		for i, n := range graph.Nodes {
+			ids[i] = n.ID
+		}
+		rows, err = tx.Query(ctx, `
+			SELECT id, from_valsiid, to_valsiid, relation
+			FROM valsi_relations
+			WHERE from_valsiid = ANY($1) AND to_valsiid = ANY($1) AND relation = ANY($2)
+			ORDER BY id`, ids, types)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to load graph edges", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var e GraphEdge
+			if err := rows.Scan(&e.ID, &e.From, &e.To, &e.Type); err != nil {
+				return apperror.NewDatabaseError("failed to read graph edge", err)
+			}
+			graph.Edges = append(graph.Edges, e)
+		}
+		if err := rows.Err(); err != nil {
+			return apperror.NewDatabaseError("failed to load graph edges", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// valsiID resolves a word's spelling.
+func (s *RelationService) valsiID(ctx context.Context, q db.Querier, word string) (int32, error) {
+	word = strings.TrimSpace(word)
+	if word == "" {
+		return 0, apperror.NewBadRequestError("word is required", nil)
+	}
+	var id int32
+	err := q.QueryRow(ctx, `SELECT valsiid FROM valsi WHERE word = $1`, word).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, apperror.NewNotFoundError(fmt.Sprintf("word %q not found", word), nil)
+	}
+	if err != nil {
+		return 0, apperror.NewDatabaseError("failed to look up word", err)
+	}
+	return id, nil
+}
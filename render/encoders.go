@@ -0,0 +1,167 @@
+// Package render, as part of the response-writing helpers.
+// This file, `encoders.go`, holds the encoders. MessagePack and XML are written from the JSON
+// encoding of the value rather than the value itself, so they carry the very document the JSON
+// encoder would, whatever the `json` tags and marshalers of the DTOs.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	// JSON is the default encoding.
+	JSON Encoder = jsonEncoder{}
+	// MsgPack is MessagePack, offered on every route.
+	MsgPack Encoder = msgpackEncoder{}
+	// XML is offered on the dictionary routes, for clients built around jbovlaste's XML.
+	XML Encoder = xmlEncoder{}
+)
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) MediaTypes() []string { return []string{"application/json"} }
+
+func (jsonEncoder) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) MediaTypes() []string {
+	return []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (msgpackEncoder) Encode(w io.Writer, v any) error {
+	doc, err := jsonDocument(v)
+	if err != nil {
+		return err
+	}
+	enc := msgpack.NewEncoder(w)
+	// Sorted keys keep the bytes, and so the ETag, of an unchanged document the same.
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	return enc.Encode(doc)
+}
+
+// jsonDocument returns the JSON encoding of `v` decoded into maps, slices and scalars, with
+// whole numbers as int64 so MessagePack encodes them as integers.
+func jsonDocument(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return convertNumbers(doc), nil
+}
+
+func convertNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = convertNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) MediaTypes() []string { return []string{"application/xml", "text/xml"} }
+
+// Encode writes the JSON document of `v` as XML under a <response> element: members become
+// elements named after them, in order, items of arrays become <item> elements, and null
+// becomes an empty element.
+func (xmlEncoder) Encode(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	enc := xml.NewEncoder(w)
+	if err := writeXML(dec, enc, "response"); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// writeXML writes the next JSON value of `dec` as the element `name`.
+func writeXML(dec *json.Decoder, enc *xml.Encoder, name string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		for dec.More() {
+			itemName := "item"
+			if tok == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				itemName = xmlName(key.(string))
+			}
+			if err := writeXML(dec, enc, itemName); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil { // The closing delimiter
+			return err
+		}
+	case nil:
+	default:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(tok))); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// xmlName turns a JSON member name into an element name. The DTOs' names are snake_case and
+// need no change; others, such as the keys of maps, have their invalid characters replaced.
+func xmlName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, key)
+	first, _ := utf8.DecodeRuneInString(name)
+	if name == "" || !(unicode.IsLetter(first) || first == '_') || strings.HasPrefix(strings.ToLower(name), "xml") {
+		name = "_" + name
+	}
+	return name
+}
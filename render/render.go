@@ -0,0 +1,135 @@
+// Package render writes response bodies in the encoding the client asks for. JSON is the
+// default; a client sending `Accept: application/msgpack` gets the same document as MessagePack,
+// which is smaller and cheaper to parse on slow links. Routes can offer more encoders, as the
+// dictionary routes offer XML, with the Offer middleware.
+//
+// Every encoder writes the document the JSON encoding of the value describes, with the same
+// names, omitted fields and custom marshalers, so the Swagger spec and the DTOs' `json` tags
+// describe all of them.
+package render
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/user/lensisku-go/logging"
+)
+
+// Encoder is an encoding responses can be written in.
+type Encoder interface {
+	// MediaTypes are the media types that select the encoder in an Accept header. The first
+	// one is sent as the Content-Type.
+	MediaTypes() []string
+	Encode(w io.Writer, v any) error
+}
+
+// defaultEncoders are offered on every route. The first one is used when the client has no
+// preference, or prefers nothing on offer.
+var defaultEncoders = []Encoder{JSON, MsgPack}
+
+type contextKey struct{}
+
+// Offer adds `encoders` to those offered on the routes it is installed on.
+func Offer(encoders ...Encoder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			offered := append(append([]Encoder{}, offeredEncoders(r.Context())...), encoders...)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, offered)))
+		})
+	}
+}
+
+func offeredEncoders(ctx context.Context) []Encoder {
+	if offered, ok := ctx.Value(contextKey{}).([]Encoder); ok {
+		return offered
+	}
+	return defaultEncoders
+}
+
+// Write writes `v` with `status` in the encoding `r` accepts. A nil `v` writes no body.
+func Write(w http.ResponseWriter, r *http.Request, status int, v any) {
+	offered := offeredEncoders(r.Context())
+	enc := Negotiate(r.Header.Get("Accept"), offered)
+	w.Header().Add("Vary", "Accept")
+	if v == nil {
+		w.Header().Set("Content-Type", enc.MediaTypes()[0])
+		w.WriteHeader(status)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, v); err != nil {
+		// A value that can't be encoded is a bug; the client learns no more than that.
+		logging.For("render").ErrorContext(r.Context(), "Failed to encode response",
+			"method", r.Method, "path", r.URL.Path, "media_type", enc.MediaTypes()[0], "error", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"failed to encode response","code":"INTERNAL_ERROR"}` + "\n"))
+		return
+	}
+	w.Header().Set("Content-Type", enc.MediaTypes()[0])
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// Negotiate picks the encoder of `offered` an Accept header prefers: the one with the highest
+// quality, the earliest offered among equals. Without an Accept header, or when it accepts
+// none of them, the first one is picked: clients that ask for something else still get JSON
+// rather than 406 Not Acceptable.
+func Negotiate(accept string, offered []Encoder) Encoder {
+	best, bestQ := offered[0], 0.0
+	if accept == "" {
+		return best
+	}
+	for _, enc := range offered {
+		if q := quality(accept, enc.MediaTypes()); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// quality returns the quality an Accept header gives an encoder of `mediaTypes`, that of the most
+// specific range matching one of them: "application/msgpack;q=0" refuses MessagePack even next
+// to "*/*".
+func quality(accept string, mediaTypes []string) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		rangeQ := 1.0
+		if v, ok := params["q"]; ok {
+			if rangeQ, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		for _, mediaType := range mediaTypes {
+			s := matchRange(mediaRange, mediaType)
+			if s > specificity {
+				q, specificity = rangeQ, s
+			}
+		}
+	}
+	return q
+}
+
+// matchRange tells how specifically `mediaRange` matches `mediaType`: 2 for the type itself,
+// 1 for "type/*", 0 for "*/*", and -1 when it doesn't match.
+func matchRange(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
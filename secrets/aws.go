@@ -0,0 +1,143 @@
+// Package secrets, as part of the secrets module.
+// This file, `aws.go`, reads an AWS Secrets Manager secret. The request is signed with
+// Signature Version 4 here rather than through the AWS SDK, which would be a large dependency
+// for a single call made once at startup. Credentials come from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are the keys the request is signed with. SessionToken is only set for
+// temporary credentials.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+type awsProvider struct {
+	client   *http.Client
+	region   string
+	secretID string
+	creds    AWSCredentials
+	now      func() time.Time
+}
+
+// NewAWSProvider reads the secret `secretID` (a name or an ARN) in `region`. Its value must be
+// a JSON object of strings, the format the console's key/value editor produces.
+func NewAWSProvider(client *http.Client, region, secretID string, creds AWSCredentials) Provider {
+	return &awsProvider{client: client, region: region, secretID: secretID, creds: creds, now: time.Now}
+}
+
+func (p *awsProvider) Name() string { return "aws" }
+
+type getSecretValueResponse struct {
+	SecretString *string `json:"SecretString"`
+}
+
+func (p *awsProvider) Secrets(ctx context.Context) (map[string]string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": p.secretID})
+	if err != nil {
+		return nil, fmt.Errorf("encode secrets manager request: %w", err)
+	}
+	host := "secretsmanager." + p.region + ".amazonaws.com"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build secrets manager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	p.sign(req, host, body, p.now().UTC())
+
+	var resp getSecretValueResponse
+	if err := doJSON(p.client, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.SecretString == nil {
+		return nil, fmt.Errorf("secret %s has no string value", p.secretID)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(*resp.SecretString), &raw); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object", p.secretID)
+	}
+	return stringValues(raw)
+}
+
+// sign adds the Signature Version 4 headers to `req`, which must carry `body` and nothing
+// but the headers set above.
+func (p *awsProvider) sign(req *http.Request, host string, body []byte, now time.Time) {
+	signV4(req, host, body, p.creds, p.region, "secretsmanager", now)
+}
+
+// signV4 signs `req` for `service` in `region` and returns the canonical request and the
+// string to sign, the intermediate steps of the signature. Only requests to "/" without a
+// query string are supported.
+func signV4(req *http.Request, host string, body []byte, creds AWSCredentials, region, service string, now time.Time) (canonicalRequest, stringToSign string) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	// Canonical headers: lower-case names, sorted, including Host, which net/http sets itself.
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest = strings.Join([]string{
+		req.Method,
+		"/",
+		"", // No query string
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign = "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+	return canonicalRequest, stringToSign
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The credentials and time of the AWS Signature Version 4 test suite.
+var (
+	sigV4Creds = AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	sigV4Time  = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+func TestSignV4(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		headers       map[string]string
+		body          string
+		canonical     string
+		stringToSign  string
+		authorization string
+	}{
+		{
+			name:   "get-vanilla",
+			method: http.MethodGet,
+			canonical: "GET\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"bb579772317eb040ac9ed261061d46c1f17a8133879d6129b6e1c25292927e63",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "post-vanilla",
+			method: http.MethodPost,
+			canonical: "POST\n/\n\nhost:example.amazonaws.com\nx-amz-date:20150830T123600Z\n\nhost;x-amz-date\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			stringToSign: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"553f88c9e4d10fc9e109e2aeb65f030801b70c2f6468faca261d401ae622fc87",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:    "post-x-www-form-urlencoded",
+			method:  http.MethodPost,
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:    "Param1=value1",
+			canonical: "POST\n/\n\ncontent-type:application/x-www-form-urlencoded\nhost:example.amazonaws.com\n" +
+				"x-amz-date:20150830T123600Z\n\ncontent-type;host;x-amz-date\n" +
+				"9095672bbd1f56dfc5b65f3e153adc8731a4a654192329106275f4c7b24d0b6e",
+			stringToSign: "AWS4-HMAC-SHA256\n20150830T123600Z\n20150830/us-east-1/service/aws4_request\n" +
+				"42a5e5bb34198acb3e84da4f085bb7927f2bc277ca766e6d19c73c2154021281",
+			authorization: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "https://example.amazonaws.com/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			canonical, stringToSign := signV4(req, "example.amazonaws.com", []byte(tt.body), sigV4Creds, "us-east-1", "service", sigV4Time)
+			if canonical != tt.canonical {
+				t.Errorf("canonical request = %q, want %q", canonical, tt.canonical)
+			}
+			if stringToSign != tt.stringToSign {
+				t.Errorf("string to sign = %q, want %q", stringToSign, tt.stringToSign)
+			}
+			if got := req.Header.Get("Authorization"); got != tt.authorization {
+				t.Errorf("Authorization = %q, want %q", got, tt.authorization)
+			}
+		})
+	}
+}
+
+func TestSignV4SessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := sigV4Creds
+	creds.SessionToken = "session-token"
+	canonical, _ := signV4(req, "secretsmanager.us-east-1.amazonaws.com", nil, creds, "us-east-1", "secretsmanager", sigV4Time)
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "session-token" {
+		t.Errorf("X-Amz-Security-Token = %q, want the session token", got)
+	}
+	if !strings.Contains(canonical, "\nx-amz-security-token:session-token\n") ||
+		!strings.Contains(req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-date;x-amz-security-token,") {
+		t.Errorf("the session token isn't signed: %q", canonical)
+	}
+}
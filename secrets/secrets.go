@@ -0,0 +1,63 @@
+// Package secrets fetches sensitive settings from a secret manager at startup. The
+// configuration module only sees the `Provider` interface; which manager answers is chosen
+// by SECRETS_PROVIDER:
+//
+//   - "vault": a HashiCorp Vault KV version 2 secret (`GET {addr}/v1/{mount}/data/{path}`).
+//   - "aws":   an AWS Secrets Manager secret whose value is a JSON object.
+//
+// Either way one secret holds all the settings, keyed by their environment variable names,
+// e.g. {"DB_PASSWORD": "...", "JWT_SECRET": "..."}.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Provider returns the settings stored in a secret manager.
+type Provider interface {
+	// Secrets returns every setting of the secret, by environment variable name.
+	Secrets(ctx context.Context) (map[string]string, error)
+	// Name identifies the provider in errors, e.g. "vault".
+	Name() string
+}
+
+// maxErrorBody caps how much of an error response is included in the returned error.
+const maxErrorBody = 512
+
+// doJSON sends `req` and decodes a 2xx response into `out`. Non-2xx responses become errors
+// carrying the start of the body; neither manager echoes secret values in its errors.
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("secret manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("secret manager returned HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode secret manager response: %w", err)
+	}
+	return nil
+}
+
+// stringValues checks that every value of a secret is a string. Numbers and nested objects are
+// rejected rather than guessed at, so a typo in the secret shows up at startup.
+func stringValues(raw map[string]any) (map[string]string, error) {
+	values := make(map[string]string, len(raw))
+	for key, v := range raw {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("secret value %s is not a string", key)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
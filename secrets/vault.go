@@ -0,0 +1,57 @@
+// Package secrets, as part of the secrets module.
+// This file, `vault.go`, reads a HashiCorp Vault KV version 2 secret over Vault's HTTP API.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type vaultProvider struct {
+	client *http.Client
+	addr   string
+	token  string
+	mount  string
+	path   string
+}
+
+// NewVaultProvider reads the secret at `path` of the KV version 2 engine mounted at `mount`,
+// e.g. mount "secret" and path "lensisku". `token` needs read access to it.
+func NewVaultProvider(client *http.Client, addr, token, mount, path string) Provider {
+	return &vaultProvider{
+		client: client,
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		mount:  strings.Trim(mount, "/"),
+		path:   strings.Trim(path, "/"),
+	}
+}
+
+func (p *vaultProvider) Name() string { return "vault" }
+
+type vaultResponse struct {
+	Data struct {
+		Data map[string]any `json:"data"`
+	} `json:"data"`
+}
+
+func (p *vaultProvider) Secrets(ctx context.Context) (map[string]string, error) {
+	endpoint := p.addr + "/v1/" + p.mount + "/data/" + (&url.URL{Path: p.path}).EscapedPath()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	var resp vaultResponse
+	if err := doJSON(p.client, req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Data == nil {
+		return nil, fmt.Errorf("vault secret %s/%s has no data", p.mount, p.path)
+	}
+	return stringValues(resp.Data.Data)
+}
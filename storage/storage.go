@@ -0,0 +1,107 @@
+// Package storage provides an abstraction over where uploaded files (avatars, exports, ...) live.
+// Services depend on the `Storage` interface rather than on the filesystem directly, so a
+// deployment can later switch to object storage (S3, GCS) without touching business logic.
+// In Nest.js this would typically be a custom provider injected behind an interface token.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// Storage stores and removes objects addressed by a slash-separated key (e.g. "avatars/42/128.png").
+type Storage interface {
+	// Put writes the object and returns the public URL under which it can be fetched.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL for a key without checking that it exists.
+	URL(key string) string
+}
+
+// New creates the Storage implementation selected in configuration.
+func New(cfg *config.StorageConfig) (Storage, error) {
+	switch cfg.Backend {
+	case "local":
+		return NewLocalStorage(cfg.LocalDir, cfg.PublicBaseURL)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Backend)
+	}
+}
+
+// LocalStorage keeps objects on the local filesystem below a root directory.
+// The files are served by the HTTP server under `publicBaseURL` (see main.go).
+type LocalStorage struct {
+	root          string
+	publicBaseURL string
+}
+
+// NewLocalStorage creates a LocalStorage rooted at `root`, creating the directory if needed.
+func NewLocalStorage(root string, publicBaseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %w", root, err)
+	}
+	return &LocalStorage{root: root, publicBaseURL: strings.TrimRight(publicBaseURL, "/")}, nil
+}
+
+// Put writes the object to a temporary file first and renames it into place,
+// so readers never observe a half-written file.
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) (string, error) {
+	path, err := s.pathFor(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return s.URL(key), nil
+}
+
+// Delete removes the object, ignoring objects that don't exist.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.pathFor(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// URL returns the public URL of a key.
+func (s *LocalStorage) URL(key string) string {
+	return s.publicBaseURL + "/" + strings.TrimLeft(key, "/")
+}
+
+// pathFor maps a key to a filesystem path and refuses keys that would escape the root directory.
+func (s *LocalStorage) pathFor(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.root, clean), nil
+}
@@ -0,0 +1,124 @@
+// Package tlsserver lets the API server terminate TLS itself, for deployments without a proxy
+// in front: with a certificate and key from files, or with certificates obtained and renewed
+// from Let's Encrypt (autocert) for the configured domains. Over TLS the server speaks HTTP/2
+// as well as HTTP/1.1. A second, plain HTTP server may redirect to HTTPS; with autocert it also
+// answers the ACME HTTP challenges.
+package tlsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// Server serves an `http.Server` according to the TLS settings.
+type Server struct {
+	srv     *http.Server
+	cfg     *config.TLSConfig
+	manager *autocert.Manager // nil unless autocert is on
+}
+
+// New prepares `srv` to be served with the TLS settings `cfg`.
+func New(srv *http.Server, cfg *config.TLSConfig) *Server {
+	s := &Server{srv: srv, cfg: cfg}
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true) // Only negotiated over TLS
+	if len(cfg.AutocertDomains) > 0 {
+		s.manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		srv.TLSConfig = s.manager.TLSConfig()
+	}
+	return s
+}
+
+// ListenAndServe serves over TLS if it is configured and plain HTTP otherwise. Like
+// `http.Server.ListenAndServe`, it returns `http.ErrServerClosed` after a shutdown.
+func (s *Server) ListenAndServe() error {
+	switch {
+	case s.manager != nil:
+		return s.srv.ListenAndServeTLS("", "")
+	case s.cfg.CertFile != "":
+		return s.srv.ListenAndServeTLS(s.cfg.CertFile, s.cfg.KeyFile)
+	default:
+		return s.srv.ListenAndServe()
+	}
+}
+
+// RedirectServer returns the plain HTTP server that redirects to HTTPS, or nil if
+// TLS_REDIRECT_ADDR isn't set. The caller starts and shuts it down.
+func (s *Server) RedirectServer() *http.Server {
+	if s.cfg.RedirectAddr == "" {
+		return nil
+	}
+	var handler http.Handler = http.HandlerFunc(s.redirect)
+	if s.manager != nil {
+		handler = s.manager.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              s.cfg.RedirectAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: s.srv.ReadHeaderTimeout,
+	}
+}
+
+// Check verifies that the TLS settings can be served, for `lensisku check`: the certificate
+// and key load and the certificate hasn't expired, or the autocert cache directory is
+// writable. It describes the setup.
+func Check(cfg *config.TLSConfig) (string, error) {
+	if len(cfg.AutocertDomains) > 0 {
+		if err := os.MkdirAll(cfg.AutocertCacheDir, 0o700); err != nil {
+			return "", fmt.Errorf("autocert cache: %w", err)
+		}
+		f, err := os.CreateTemp(cfg.AutocertCacheDir, ".check-*")
+		if err != nil {
+			return "", fmt.Errorf("autocert cache is not writable: %w", err)
+		}
+		f.Close()
+		os.Remove(f.Name())
+		return "autocert for " + strings.Join(cfg.AutocertDomains, ", "), nil
+	}
+	pair, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return "", err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+	if time.Now().After(cert.NotAfter) {
+		return "", fmt.Errorf("certificate for %s expired on %s", cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly))
+	}
+	return fmt.Sprintf("certificate for %s, valid until %s", cert.Subject.CommonName, cert.NotAfter.Format(time.DateOnly)), nil
+}
+
+// redirect sends the client to the same URL over HTTPS, on the port of the TLS server unless
+// it is the default one. Requests other than GET and HEAD get 308, so they keep their method
+// and body.
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if _, port, err := net.SplitHostPort(s.srv.Addr); err == nil && port != "" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	status := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		status = http.StatusMovedPermanently
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
@@ -0,0 +1,249 @@
+// Package tracing, as part of the tracing module.
+// This file, `otlp.go`, exports spans to an OTLP/HTTP collector, encoded as OTLP JSON, which
+// the collectors accept next to protobuf (Jaeger, Tempo and the OpenTelemetry Collector all
+// do). It keeps the protobuf and gRPC stacks of the upstream exporter out of the build.
+//
+// Per the OTLP specification, trace and span IDs are hex strings and 64-bit integers are
+// decimal strings; enums are numbers.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// exportTimeout bounds one export request.
+const exportTimeout = 10 * time.Second
+
+// otlpExporter implements sdktrace.SpanExporter.
+type otlpExporter struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newOTLPExporter(cfg *config.TracingConfig) *otlpExporter {
+	return &otlpExporter{
+		url:     cfg.Endpoint + "/v1/traces",
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: exportTimeout},
+	}
+}
+
+// ExportSpans sends a batch of spans in one request.
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(encodeSpans(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector rejected %d spans: %s: %s", len(spans), resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Shutdown has nothing to release; the batcher flushes before calling it.
+func (e *otlpExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// The OTLP JSON messages, with the fields this exporter fills.
+type (
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+	resourceSpans struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	scopeSpans struct {
+		Scope struct {
+			Name    string `json:"name"`
+			Version string `json:"version,omitempty"`
+		} `json:"scope"`
+		Spans []span `json:"spans"`
+	}
+	span struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		TraceState        string     `json:"traceState,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Events            []event    `json:"events,omitempty"`
+		Links             []link     `json:"links,omitempty"`
+		Status            status     `json:"status"`
+	}
+	event struct {
+		TimeUnixNano string     `json:"timeUnixNano"`
+		Name         string     `json:"name"`
+		Attributes   []keyValue `json:"attributes,omitempty"`
+	}
+	link struct {
+		TraceID    string     `json:"traceId"`
+		SpanID     string     `json:"spanId"`
+		Attributes []keyValue `json:"attributes,omitempty"`
+	}
+	status struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	anyValue struct {
+		StringValue *string     `json:"stringValue,omitempty"`
+		BoolValue   *bool       `json:"boolValue,omitempty"`
+		IntValue    *string     `json:"intValue,omitempty"`
+		DoubleValue *float64    `json:"doubleValue,omitempty"`
+		ArrayValue  *arrayValue `json:"arrayValue,omitempty"`
+	}
+	arrayValue struct {
+		Values []anyValue `json:"values"`
+	}
+)
+
+// encodeSpans groups spans by resource and instrumentation scope, as OTLP nests them. All the
+// spans of this process share one resource.
+func encodeSpans(spans []sdktrace.ReadOnlySpan) exportRequest {
+	var rs resourceSpans
+	rs.Resource.Attributes = encodeAttributes(spans[0].Resource().Attributes())
+
+	scopes := make(map[instrumentation.Scope]int)
+	for _, s := range spans {
+		i, ok := scopes[s.InstrumentationScope()]
+		if !ok {
+			var ss scopeSpans
+			ss.Scope.Name = s.InstrumentationScope().Name
+			ss.Scope.Version = s.InstrumentationScope().Version
+			i = len(rs.ScopeSpans)
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+			scopes[s.InstrumentationScope()] = i
+		}
+		rs.ScopeSpans[i].Spans = append(rs.ScopeSpans[i].Spans, encodeSpan(s))
+	}
+	return exportRequest{ResourceSpans: []resourceSpans{rs}}
+}
+
+func encodeSpan(s sdktrace.ReadOnlySpan) span {
+	sc := s.SpanContext()
+	out := span{
+		TraceID:           sc.TraceID().String(),
+		SpanID:            sc.SpanID().String(),
+		TraceState:        sc.TraceState().String(),
+		Name:              s.Name(),
+		Kind:              int(s.SpanKind()), // trace.SpanKind numbers the kinds as OTLP does
+		StartTimeUnixNano: unixNano(s.StartTime()),
+		EndTimeUnixNano:   unixNano(s.EndTime()),
+		Attributes:        encodeAttributes(s.Attributes()),
+	}
+	if s.Parent().HasSpanID() {
+		out.ParentSpanID = s.Parent().SpanID().String()
+	}
+	for _, ev := range s.Events() {
+		out.Events = append(out.Events, event{
+			TimeUnixNano: unixNano(ev.Time),
+			Name:         ev.Name,
+			Attributes:   encodeAttributes(ev.Attributes),
+		})
+	}
+	for _, l := range s.Links() {
+		out.Links = append(out.Links, link{
+			TraceID:    l.SpanContext.TraceID().String(),
+			SpanID:     l.SpanContext.SpanID().String(),
+			Attributes: encodeAttributes(l.Attributes),
+		})
+	}
+	// OTLP numbers the status codes differently from the Go API: 1 is ok and 2 is error.
+	switch s.Status().Code {
+	case codes.Ok:
+		out.Status.Code = 1
+	case codes.Error:
+		out.Status = status{Code: 2, Message: s.Status().Description}
+	}
+	return out
+}
+
+func encodeAttributes(attrs []attribute.KeyValue) []keyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]keyValue, len(attrs))
+	for i, a := range attrs {
+		out[i] = keyValue{Key: string(a.Key), Value: encodeValue(a.Value)}
+	}
+	return out
+}
+
+func encodeValue(v attribute.Value) anyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return anyValue{BoolValue: &b}
+	case attribute.INT64:
+		n := strconv.FormatInt(v.AsInt64(), 10)
+		return anyValue{IntValue: &n}
+	case attribute.FLOAT64:
+		f := v.AsFloat64()
+		return anyValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		return arrayOf(v.AsBoolSlice(), attribute.BoolValue)
+	case attribute.INT64SLICE:
+		return arrayOf(v.AsInt64Slice(), attribute.Int64Value)
+	case attribute.FLOAT64SLICE:
+		return arrayOf(v.AsFloat64Slice(), attribute.Float64Value)
+	case attribute.STRINGSLICE:
+		return arrayOf(v.AsStringSlice(), attribute.StringValue)
+	default:
+		s := v.Emit()
+		return anyValue{StringValue: &s}
+	}
+}
+
+func arrayOf[T any](items []T, value func(T) attribute.Value) anyValue {
+	values := make([]anyValue, len(items))
+	for i, item := range items {
+		values[i] = encodeValue(value(item))
+	}
+	return anyValue{ArrayValue: &arrayValue{Values: values}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,106 @@
+// Package tracing sets up OpenTelemetry tracing. When OTEL_EXPORTER_OTLP_ENDPOINT is set,
+// Setup registers a tracer provider that batches spans to an OTLP/HTTP collector such as
+// Jaeger or Tempo; otherwise the global provider stays the no-op one and spans cost nothing.
+//
+// A trace starts in Middleware, with one server span per request (or continues the trace of
+// the caller, from its `traceparent` header). The services pass the request context on, so
+// their spans, the spans of their statements (see `db/tracer.go`) and of their outgoing calls
+// nest under it:
+//
+//	ctx, span := tracer.Start(ctx, "AuthService.Login")
+//	defer span.End()
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/logging"
+)
+
+// Setup registers the tracer provider and propagators configured by `cfg`, and returns a
+// function that flushes the spans still buffered and stops the provider. With tracing off,
+// that function does nothing.
+func Setup(cfg *config.TracingConfig, env string) (shutdown func(context.Context) error) {
+	// The trace context is read from and written to headers even with tracing off, so a trace
+	// started by a caller goes on through this server.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }
+	}
+
+	logger := logging.For("tracing")
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("OpenTelemetry error", "error", err)
+	}))
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.DeploymentEnvironment(env),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(newOTLPExporter(cfg)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	logger.Info("Tracing enabled", "endpoint", cfg.Endpoint, "sample_ratio", cfg.SampleRatio)
+	return provider.Shutdown
+}
+
+// Middleware starts the server span of each request. Once the request is routed, the span is
+// renamed after its route, e.g. "GET /api/v1/users/{userID}", so that requests to the same
+// endpoint group together. The health checks and metrics scrapes are not traced.
+func Middleware() func(http.Handler) http.Handler {
+	otelMiddleware := otelhttp.NewMiddleware("http.request",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }),
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/health", "/ready", "/metrics":
+				return false
+			}
+			return true
+		}),
+	)
+	return func(next http.Handler) http.Handler {
+		return otelMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Method + " " + rctx.RoutePattern())
+				span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+			}
+		}))
+	}
+}
+
+// Transport wraps an HTTP client transport so that outgoing requests get client spans and
+// carry the trace context. A nil `base` stands for `http.DefaultTransport`.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
+
+// End ends `span`, marking it as failed if `err` is set. It is meant to be deferred with a
+// named error result:
+//
+//	defer func() { tracing.End(span, err) }()
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
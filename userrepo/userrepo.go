@@ -0,0 +1,114 @@
+// Package userrepo is the single place that maps the `users` table to the `User` model.
+// The auth and users modules both read accounts; before this package existed each wrote its own
+// SQL and they drifted apart (some queries used a non-existent `id` column instead of `userid`).
+//
+// Canonical column mapping:
+//
+//	userid      -> User.ID
+//	username    -> User.Username
+//	email       -> User.Email (stored lowercase)
+//	password    -> User.HashedPassword
+//	auth_source -> User.AuthSource
+//	created_at  -> User.CreatedAt
+//
+// Other modules may still query profile-specific columns directly, but the key is always `userid`.
+// Lookups that find nothing return `pgx.ErrNoRows`, like a plain `QueryRow`, so callers keep
+// deciding whether that is a NotFound, an invalid login or something else.
+package userrepo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/db"
+)
+
+// User represents a user account as stored in the `users` table.
+type User struct {
+	// The `json:"-"` tags keep credentials and internals out of API responses.
+	ID             int       `json:"id"`
+	Username       string    `json:"username"`
+	Email          string    `json:"email"`
+	HashedPassword string    `json:"-"` // Do not expose hashed password
+	AuthSource     string    `json:"-"` // Backend owning the account ("local", "ldap", ...)
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// AuthSourceLocal is the auth source of accounts with a password stored in `users.password`.
+const AuthSourceLocal = "local"
+
+// AuthSourceDeleted is the auth source of deleted accounts (see users.DeleteAccount). No
+// backend owns it, so nobody can log in to them or provision them again.
+const AuthSourceDeleted = "deleted"
+
+// userColumns lists the columns scanned by `scanUser`, in order.
+const userColumns = `userid, username, email, password, auth_source, created_at`
+
+// Repository reads and writes user accounts.
+type Repository struct {
+	db db.Querier
+}
+
+// New creates a repository on top of a pool or transaction, so it works both standalone and
+// inside a caller's transaction.
+func New(q db.Querier) *Repository {
+	return &Repository{db: q}
+}
+
+// WithTx returns a repository that runs its queries in `tx`.
+func (r *Repository) WithTx(tx pgx.Tx) *Repository {
+	return &Repository{db: tx}
+}
+
+func scanUser(row pgx.Row) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Username, &u.Email, &u.HashedPassword, &u.AuthSource, &u.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// GetByID returns the user with the given ID.
+func (r *Repository) GetByID(ctx context.Context, id int) (*User, error) {
+	return scanUser(r.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE userid = $1`, id))
+}
+
+// GetByUsername returns the user with the given username (exact match).
+func (r *Repository) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return scanUser(r.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE username = $1`, username))
+}
+
+// GetByEmail returns the user with the given email address; the comparison is case-insensitive.
+func (r *Repository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return scanUser(r.db.QueryRow(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, strings.ToLower(email)))
+}
+
+// GetByLogin resolves a login identifier: anything containing "@" is treated as an email,
+// everything else as a username first and an email second.
+func (r *Repository) GetByLogin(ctx context.Context, login string) (*User, error) {
+	if strings.Contains(login, "@") {
+		return r.GetByEmail(ctx, login)
+	}
+	u, err := r.GetByUsername(ctx, login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.GetByEmail(ctx, login)
+	}
+	return u, err
+}
+
+// Create inserts `u` and fills in its ID and creation time. An empty AuthSource means local.
+func (r *Repository) Create(ctx context.Context, u *User) error {
+	if u.AuthSource == "" {
+		u.AuthSource = AuthSourceLocal
+	}
+	u.Email = strings.ToLower(u.Email)
+	return r.db.QueryRow(ctx, `
+		INSERT INTO users (username, email, password, auth_source)
+		VALUES ($1, $2, $3, $4)
+		RETURNING userid, created_at`,
+		u.Username, u.Email, u.HashedPassword, u.AuthSource).Scan(&u.ID, &u.CreatedAt)
+}
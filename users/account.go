@@ -0,0 +1,82 @@
+// Package users, as part of the user profile management module.
+// This file, `account.go`, deletes accounts. The dictionary keeps what a user contributed
+// (definitions, comments, votes), so the account row stays as an anonymous author and only
+// what identifies the person, or belongs to them alone, is removed.
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/userrepo"
+)
+
+// AuthSourceDeleted marks an anonymised account in `users.auth_source`.
+const AuthSourceDeleted = userrepo.AuthSourceDeleted
+
+// deletedUsername is the name an account keeps after its deletion. Usernames can't contain
+// spaces, so nobody can register it.
+func deletedUsername(userID int) string {
+	return fmt.Sprintf("deleted user %d", userID)
+}
+
+// personalTables are deleted from along with the account, each by its user column.
+var personalTables = []struct{ table, column string }{
+	{"username_history", "user_id"},
+	{"user_preferences", "user_id"},
+	{"user_onboarding", "user_id"},
+	{"user_follows", "follower_id"},
+	{"user_follows", "followee_id"},
+	{"user_blocks", "blocker_id"},
+	{"user_blocks", "blocked_id"},
+	{"digest_deliveries", "user_id"},
+	{"notifications", "user_id"},
+	{"push_subscriptions", "user_id"},
+}
+
+// DeleteAccount anonymises the account of `userID`: the username becomes `deleted user <id>`,
+// the email, password and profile fields are cleared, and follows, blocks, preferences,
+// notifications, push subscriptions and avatar files are deleted. Its refresh tokens are
+// refused from then on (see auth.AuthService.RefreshToken), so its sessions end.
+func (s *UserService) DeleteAccount(ctx context.Context, userID int) error {
+	var oldUsername string
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE users u
+			SET username = $2, email = $3, email_verified_at = NULL, password = '', auth_source = $4, role = 'user',
+			    realname = NULL, bio = NULL, avatar_urls = NULL, website = NULL, location = NULL,
+			    pronouns = NULL, lojban_level = NULL, field_visibility = '{}',
+			    profile_version = u.profile_version + 1
+			FROM (SELECT userid, username FROM users WHERE userid = $1 FOR UPDATE) old
+			WHERE u.userid = old.userid AND u.auth_source <> $4
+			RETURNING old.username`,
+			userID, deletedUsername(userID), fmt.Sprintf("deleted-%d@invalid", userID), AuthSourceDeleted).Scan(&oldUsername)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+		}
+		if err != nil {
+			return apperror.NewDatabaseError("failed to anonymise account", err)
+		}
+		for _, t := range personalTables {
+			if _, err := tx.Exec(ctx, `DELETE FROM `+t.table+` WHERE `+t.column+` = $1`, userID); err != nil {
+				return apperror.NewDatabaseError("failed to delete "+t.table+" of account", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.profileCache.Invalidate(ctx, oldUsername)
+	// The account is gone either way; files left behind only take up space.
+	if err := s.deleteAvatarFiles(ctx, userID); err != nil {
+		logging.For("users").Warn("Failed to delete avatar files of deleted account", "user_id", userID, "error", err)
+	}
+	return nil
+}
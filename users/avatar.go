@@ -0,0 +1,80 @@
+// Package users, as part of the user profile management module.
+// This file, `avatar.go`, handles avatar uploads: the uploaded image is decoded, cropped to a
+// square and resized to a fixed set of sizes by the `imageproc` package, then written through
+// the `storage` abstraction. Only the resulting public URLs are stored in the database.
+package users
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/imageproc"
+)
+
+// AvatarSizes lists the square sizes (in pixels) generated for every uploaded avatar.
+var AvatarSizes = []int{32, 64, 128, 256}
+
+// avatarKey is the storage key of one size of a user's avatar.
+func avatarKey(userID, size int) string {
+	return fmt.Sprintf("avatars/%d/%d.png", userID, size)
+}
+
+// deleteAvatarFiles removes every size of a user's avatar from storage.
+func (s *UserService) deleteAvatarFiles(ctx context.Context, userID int) error {
+	var errs []error
+	for _, size := range AvatarSizes {
+		if err := s.store.Delete(ctx, avatarKey(userID, size)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// UploadAvatar processes an uploaded image and stores all avatar sizes for the user.
+// It returns the updated profile, which includes the new avatar URLs.
+func (s *UserService) UploadAvatar(ctx context.Context, userID int, data []byte) (*UserProfileResponse, error) {
+	img, _, err := imageproc.Decode(data)
+	if err != nil {
+		if errors.Is(err, imageproc.ErrUnsupportedImage) {
+			return nil, apperror.NewValidationError("avatar must be a GIF, JPEG, PNG or WebP image of reasonable size", err)
+		}
+		return nil, apperror.NewInternalError("Failed to decode avatar", err)
+	}
+
+	// The object keys are stable per user and size, so a new upload overwrites the previous files.
+	// A version query parameter keeps browsers and CDNs from serving the old image.
+	version := strconv.FormatInt(time.Now().Unix(), 10)
+	urls := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		var buf bytes.Buffer
+		if err := imageproc.EncodePNG(&buf, imageproc.SquareThumbnail(img, size)); err != nil {
+			return nil, apperror.NewInternalError("Failed to encode avatar", err)
+		}
+		url, err := s.store.Put(ctx, avatarKey(userID, size), &buf, "image/png")
+		if err != nil {
+			return nil, apperror.NewInternalError("Failed to store avatar", err)
+		}
+		urls[strconv.Itoa(size)] = url + "?v=" + version
+	}
+
+	encoded, err := json.Marshal(urls)
+	if err != nil {
+		return nil, apperror.NewInternalError("Failed to encode avatar URLs", err)
+	}
+	tag, err := s.db.Exec(ctx, `UPDATE users SET avatar_urls = $1 WHERE userid = $2`, encoded, userID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("Failed to save avatar URLs", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+	}
+	s.invalidatePublicProfile(ctx, userID)
+
+	return s.GetUserProfile(ctx, userID)
+}
@@ -0,0 +1,107 @@
+// Package users, as part of the user profile management module.
+// This file, `blocks.go`, lets users block or mute each other. Both are stored in
+// `user_blocks` with a `kind` column:
+//   - a mute hides the other user's comments and suppresses their replies and mentions
+//     (filtered out when notifications are fanned out, see notifications/fanout.go);
+//   - a block does the same, also removes follows in both directions and stops the
+//     blocked user from replying (enforced by the comments module).
+package users
+
+import (
+	"context"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// Block kinds as stored in `user_blocks.kind`.
+const (
+	BlockKindBlock = "block"
+	BlockKindMute  = "mute"
+)
+
+// Block blocks `blockedID` for `blockerID`, replacing an existing mute.
+func (s *UserService) Block(ctx context.Context, blockerID, blockedID int) error {
+	if err := s.setBlock(ctx, blockerID, blockedID, BlockKindBlock); err != nil {
+		return err
+	}
+	// A block severs the relationship entirely, so neither side keeps following the other.
+	_, err := s.db.Exec(ctx, `
+		DELETE FROM user_follows
+		WHERE (follower_id = $1 AND followee_id = $2) OR (follower_id = $2 AND followee_id = $1)`,
+		blockerID, blockedID)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to remove follows of blocked user", err)
+	}
+	return nil
+}
+
+// Mute mutes `mutedID` for `muterID`. Muting an already blocked user keeps the block.
+func (s *UserService) Mute(ctx context.Context, muterID, mutedID int) error {
+	return s.setBlock(ctx, muterID, mutedID, BlockKindMute)
+}
+
+// Unblock removes a block. A mute is left untouched.
+func (s *UserService) Unblock(ctx context.Context, blockerID, blockedID int) error {
+	return s.removeBlock(ctx, blockerID, blockedID, BlockKindBlock)
+}
+
+// Unmute removes a mute. A block is left untouched.
+func (s *UserService) Unmute(ctx context.Context, muterID, mutedID int) error {
+	return s.removeBlock(ctx, muterID, mutedID, BlockKindMute)
+}
+
+// ListBlocks returns everyone the user has blocked or muted, most recent first.
+func (s *UserService) ListBlocks(ctx context.Context, userID int) ([]BlockedUser, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT u.userid, u.username, b.kind, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.userid = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC`, userID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list blocked users", err)
+	}
+	defer rows.Close()
+
+	blocks := []BlockedUser{}
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.ID, &b.Username, &b.Kind, &b.CreatedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read blocked user", err)
+		}
+		blocks = append(blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list blocked users", err)
+	}
+	return blocks, nil
+}
+
+// setBlock upserts the (blocker, blocked) row. A block always wins over a mute.
+func (s *UserService) setBlock(ctx context.Context, blockerID, blockedID int, kind string) error {
+	if blockerID == blockedID {
+		return apperror.NewValidationError("users cannot block or mute themselves", nil)
+	}
+	if err := s.ensureUserExists(ctx, blockedID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id, kind)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (blocker_id, blocked_id) DO UPDATE
+		SET kind = CASE WHEN user_blocks.kind = 'block' THEN 'block' ELSE EXCLUDED.kind END`,
+		blockerID, blockedID, kind)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to update block list", err)
+	}
+	return nil
+}
+
+// removeBlock deletes the row only if it is of the given kind.
+func (s *UserService) removeBlock(ctx context.Context, blockerID, blockedID int, kind string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2 AND kind = $3`, blockerID, blockedID, kind)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to update block list", err)
+	}
+	return nil
+}
@@ -5,7 +5,11 @@
 // This is very similar to DTOs in Nest.js, often used with validation decorators.
 package users
 
-import "time"
+import (
+	"time"
+
+	"github.com/user/lensisku-go/validation"
+)
 
 // UserProfileResponse represents the data returned for a user profile.
 // @Description User profile information (This is a Swagger annotation)
@@ -28,6 +32,17 @@ type UserProfileResponse struct {
 	// The time the user was created
 	// example: "2023-01-15T10:30:00Z"
 	CreatedAt time.Time `json:"created_at"`
+	// Avatar image URLs keyed by square pixel size ("32", "64", "128", "256").
+	// Omitted when the user hasn't uploaded an avatar.
+	// example: {"64": "/uploads/avatars/1/64.png?v=1700000000"}
+	AvatarURLs map[string]string `json:"avatar_urls,omitempty"`
+	// Reputation earned from received reactions, accepted definitions and moderation outcomes
+	// example: 42
+	Reputation int `json:"reputation"`
+	// Optional self-descriptive fields (website, location, pronouns, Lojban level)
+	ProfileDetails
+	// Version is bumped on every profile update; it's sent as the ETag header, not in the body.
+	Version int `json:"-"`
 }
 
 // UpdateUserProfileRequest represents the data for updating a user profile.
@@ -38,8 +53,202 @@ type UpdateUserProfileRequest struct {
 	// Using pointers (`*string`) allows for partial updates: if a field is `nil`, it means
 	// the client doesn't intend to update that field. `omitempty` in the JSON tag
 	// means the field will not be included in the JSON output if it's nil (for responses) or empty (for requests, depending on marshaller).
-	Email *string `json:"email,omitempty"` // Pointer to allow partial updates
+	// The `validate` tags are the rules the handler checks (see the `validation` package);
+	// `omitnil` skips the fields left out, and `|len=0` lets an empty string through.
+	Email *string `json:"email,omitempty" validate:"omitnil,max=254,email|len=0"` // Pointer to allow partial updates
 	// The new biography for the user.
 	// example: "Updated bio: Still a Lojban enthusiast, now also learning Klingon."
 	Bio *string `json:"bio,omitempty"` // Pointer to allow partial updates
+	// Optional profile fields; an empty string clears a field.
+	ProfileDetails
+}
+
+// ProfileDetails holds the optional profile fields. It is embedded in the profile DTOs,
+// so its fields appear at the top level of the JSON objects.
+type ProfileDetails struct {
+	// Personal website, an absolute http(s) URL of at most 200 characters
+	// example: "https://example.org"
+	Website *string `json:"website,omitempty" validate:"omitnil,max=200,http_url|len=0"`
+	// Free-form location, at most 100 characters
+	// example: "Berlin"
+	Location *string `json:"location,omitempty" validate:"omitnil,max=100"`
+	// Pronouns, at most 40 characters
+	// example: "they/them"
+	Pronouns *string `json:"pronouns,omitempty" validate:"omitnil,max=40"`
+	// Self-assessed Lojban proficiency: beginner, intermediate, advanced or fluent (also
+	// enforced by a CHECK constraint)
+	// example: "intermediate"
+	LojbanLevel *string `json:"lojban_level,omitempty" validate:"omitnil,oneof=beginner intermediate advanced fluent|len=0"`
+}
+
+// PublicUserProfileResponse is the profile shown to other users. It omits private fields such as the email address.
+// @Description Public user profile
+type PublicUserProfileResponse struct {
+	// example: 1
+	ID int `json:"id"`
+	// example: "johndoe"
+	Username string `json:"username"`
+	// Omitted when hidden by the user's privacy settings
+	// example: "John Doe"
+	Realname *string `json:"realname,omitempty"`
+	// example: "Lojban enthusiast and software developer."
+	Bio *string `json:"bio,omitempty"`
+	// Avatar image URLs keyed by square pixel size.
+	AvatarURLs map[string]string `json:"avatar_urls,omitempty"`
+	// example: 42
+	Reputation int `json:"reputation"`
+	ProfileDetails
+	// example: "2023-01-15T10:30:00Z"
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChangeUsernameRequest represents the data for changing the current user's username.
+// @Description Request body for changing the username
+type ChangeUsernameRequest struct {
+	// The new username. Old usernames keep redirecting to the profile.
+	// example: "johndoe2"
+	Username string `json:"username" validate:"required,max=64,username"`
+}
+
+// PreferencesResponse maps preference keys to their effective values (stored or default).
+// @Description User preferences, e.g. {"locale": "en", "timezone": "UTC", "theme": "system", "default_comment_sort": "newest"}
+type PreferencesResponse map[string]interface{}
+
+// FollowUser is one entry of a follower/following listing.
+// @Description User in a follower or following list
+type FollowUser struct {
+	// example: 2
+	ID int `json:"id"`
+	// example: "janedoe"
+	Username string `json:"username"`
+	// Avatar image URLs keyed by square pixel size.
+	AvatarURLs map[string]string `json:"avatar_urls,omitempty"`
+	// When the follow relationship was created
+	// example: "2024-03-01T12:00:00Z"
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+// BlockedUser is an entry of the current user's block/mute list.
+// @Description Blocked or muted user
+type BlockedUser struct {
+	// example: 3
+	ID int `json:"id"`
+	// example: "spammer"
+	Username string `json:"username"`
+	// "block" or "mute"
+	// example: "block"
+	Kind string `json:"kind"`
+	// example: "2024-03-01T12:00:00Z"
+	CreatedAt time.Time `json:"created_at"`
 }
+
+// UserSearchResult is one match of a user search.
+// @Description User search match
+type UserSearchResult struct {
+	// example: 1
+	ID int `json:"id"`
+	// example: "johndoe"
+	Username string `json:"username"`
+	// example: "John Doe"
+	Realname *string `json:"realname,omitempty"`
+	// Avatar image URLs keyed by square pixel size.
+	AvatarURLs map[string]string `json:"avatar_urls,omitempty"`
+	// Trigram similarity between the query and the best-matching field (0..1)
+	// example: 0.45
+	Score float32 `json:"score"`
+}
+
+// UserSearchQuery is a search for users by username or real name.
+type UserSearchQuery struct {
+	Query string `form:"q" validate:"required"`
+	validation.Pagination
+}
+
+// ReputationResponse is a user's reputation total with a per-source breakdown.
+// @Description Reputation score and its sources
+type ReputationResponse struct {
+	// example: 1
+	UserID int `json:"user_id"`
+	// example: 42
+	Total int `json:"total"`
+	// Points per source ("reaction", "definition", "moderation")
+	BySource map[string]int `json:"by_source"`
+}
+
+// UserStatsResponse holds a user's contribution statistics.
+// @Description Contribution counts and activity streaks (days are UTC)
+type UserStatsResponse struct {
+	// example: 1
+	UserID int `json:"user_id"`
+	// example: 120
+	CommentsPosted int64 `json:"comments_posted"`
+	// example: 340
+	ReactionsReceived int64 `json:"reactions_received"`
+	// example: 15
+	DefinitionsAuthored int64 `json:"definitions_authored"`
+	// Number of distinct days with at least one comment or definition
+	// example: 48
+	DaysActive int64 `json:"days_active"`
+	// Consecutive active days ending today or yesterday
+	// example: 3
+	CurrentStreak int64 `json:"current_streak"`
+	// example: 12
+	LongestStreak int64 `json:"longest_streak"`
+	// example: "2024-05-01"
+	LastActiveDay *string `json:"last_active_day,omitempty"`
+	// When the statistics were computed; they may be served from a short-lived cache
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// OnboardingStep is one entry of the onboarding checklist.
+// @Description Onboarding checklist entry
+type OnboardingStep struct {
+	// One of verify_email, set_bio, first_comment, learn_first_words
+	// example: "set_bio"
+	Key string `json:"key"`
+	// example: "Write a short bio"
+	Title string `json:"title"`
+	// example: true
+	Completed bool `json:"completed"`
+	// example: "2024-05-01T10:00:00Z"
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// OnboardingResponse is the current user's onboarding checklist.
+// @Description Onboarding progress
+type OnboardingResponse struct {
+	// One of in_progress, completed, dismissed
+	// example: "in_progress"
+	State string `json:"state"`
+	// example: 2
+	CompletedCount int `json:"completed_count"`
+	// example: 4
+	Total int              `json:"total"`
+	Steps []OnboardingStep `json:"steps"`
+}
+
+// EmailVerificationResponse tells where a verification email was sent.
+// @Description Verification email queued
+type EmailVerificationResponse struct {
+	// example: "user@example.com"
+	Email string `json:"email"`
+	// When the link in the email stops working
+	// example: "2024-05-03T10:00:00Z"
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UpdateOnboardingRequest reports client-side progress or hides the checklist.
+// @Description Onboarding update; only client-reported steps (learn_first_words) can be completed here
+type UpdateOnboardingRequest struct {
+	// Steps to mark as completed
+	// example: ["learn_first_words"]
+	Complete []string `json:"complete,omitempty"`
+	// Hide (true) or show again (false) the checklist
+	// example: true
+	Dismissed *bool `json:"dismissed,omitempty"`
+}
+
+// PrivacySettings maps profile fields (realname, bio, website, location, pronouns, lojban_level)
+// to their visibility: "public", "users" (logged-in users only) or "private".
+// @Description Per-field profile visibility, e.g. {"realname": "private", "website": "users"}
+type PrivacySettings map[string]string
@@ -0,0 +1,112 @@
+// Package users, as part of the user profile management module.
+// This file, `follows.go`, implements following other users. A follow is a directed edge
+// (follower -> followee) in the `user_follows` table; the comments module reads the same
+// table to build a user's home feed.
+package users
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/validation"
+)
+
+// Follow makes `followerID` follow `followeeID`. Following someone twice is not an error.
+func (s *UserService) Follow(ctx context.Context, followerID, followeeID int) error {
+	if followerID == followeeID {
+		return apperror.NewValidationError("users cannot follow themselves", nil)
+	}
+	if err := s.ensureUserExists(ctx, followeeID); err != nil {
+		return err
+	}
+	var blocked bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2 AND kind = 'block')`,
+		followeeID, followerID).Scan(&blocked)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to check block list", err)
+	}
+	if blocked {
+		return apperror.NewUnauthorizedError("you cannot follow this user", nil)
+	}
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO user_follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT (follower_id, followee_id) DO NOTHING`, followerID, followeeID)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to follow user", err)
+	}
+	return nil
+}
+
+// Unfollow removes the follow edge. Unfollowing someone not followed is not an error.
+func (s *UserService) Unfollow(ctx context.Context, followerID, followeeID int) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM user_follows WHERE follower_id = $1 AND followee_id = $2`, followerID, followeeID)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to unfollow user", err)
+	}
+	return nil
+}
+
+// ListFollowers returns the users following `userID`, most recent first.
+func (s *UserService) ListFollowers(ctx context.Context, userID int, p validation.Pagination) (*validation.Page[FollowUser], error) {
+	return s.listFollows(ctx, userID, p, "followee_id", "follower_id")
+}
+
+// ListFollowing returns the users `userID` follows, most recent first.
+func (s *UserService) ListFollowing(ctx context.Context, userID int, p validation.Pagination) (*validation.Page[FollowUser], error) {
+	return s.listFollows(ctx, userID, p, "follower_id", "followee_id")
+}
+
+// listFollows pages through one side of the follow graph. `matchColumn` selects the edges
+// belonging to `userID` and `otherColumn` is the user listed for each edge. Both are fixed
+// column names from the callers above, never user input.
+func (s *UserService) listFollows(ctx context.Context, userID int, p validation.Pagination, matchColumn, otherColumn string) (*validation.Page[FollowUser], error) {
+	if err := s.ensureUserExists(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM user_follows WHERE %s = $1`, matchColumn)
+	if err := s.db.QueryRow(ctx, countQuery, userID).Scan(&total); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count follows", err)
+	}
+
+	listQuery := fmt.Sprintf(`
+		SELECT u.userid, u.username, u.avatar_urls, f.created_at
+		FROM user_follows f
+		JOIN users u ON u.userid = f.%s
+		WHERE f.%s = $1
+		ORDER BY f.created_at DESC, u.userid
+		LIMIT $2 OFFSET $3`, otherColumn, matchColumn)
+	rows, err := s.db.Query(ctx, listQuery, userID, p.PerPage, p.Offset())
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to list follows", err)
+	}
+	defer rows.Close()
+	var users []FollowUser
+	for rows.Next() {
+		var u FollowUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.AvatarURLs, &u.FollowedAt); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read follow", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to list follows", err)
+	}
+	return validation.NewPage(users, total, p), nil
+}
+
+// ensureUserExists returns a NotFoundError if there is no user with the given ID.
+func (s *UserService) ensureUserExists(ctx context.Context, userID int) error {
+	var exists bool
+	if err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE userid = $1)`, userID).Scan(&exists); err != nil {
+		return apperror.NewDatabaseError("failed to look up user", err)
+	}
+	if !exists {
+		return apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+	}
+	return nil
+}
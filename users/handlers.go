@@ -5,13 +5,23 @@
 package users
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
 
 	// `apperror` provides standardized error types and responses.
 	"github.com/user/lensisku-go/apperror"
 	// `auth` package provides authentication utilities, like extracting user ID from context.
 	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
 )
 
 // UserHandlers provides HTTP handlers for user profile management.
@@ -36,6 +46,7 @@ func NewUserHandlers(service *UserService) *UserHandlers {
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} UserProfileResponse "Successfully retrieved user profile"
+// @Header 200 {string} ETag "Profile version; send it as If-Match when updating"
 // @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
 // @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
 // @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
@@ -56,33 +67,39 @@ func (h *UserHandlers) HandleGetUserProfile() http.HandlerFunc {
 		}
 
 		// Call the service layer to fetch the user profile.
-		profile, err := h.service.GetUserProfile(userID)
+		profile, err := h.service.GetUserProfile(r.Context(), userID)
 		if err != nil {
 			// The service layer is expected to return `apperror` types, which `auth.WriteError` can handle.
 			auth.WriteError(w, r, err) // service layer should return apperror types
 			return
 		}
 
-		// Set response headers and status code, then encode the profile as JSON.
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(profile)
+		// Set the ETag, then write the profile in the encoding the client accepts.
+		w.Header().Set("ETag", profileETag(profile.Version))
+		render.Write(w, r, http.StatusOK, profile)
 	}
 }
 
 // HandleUpdateUserProfile godoc
 // @Summary Update current user's profile
-// @Description Updates the profile information (e.g., email, bio) for the currently authenticated user.
+// @Description Updates the profile information (e.g., email, bio, website, location, pronouns, lojban_level)
+// @Description for the currently authenticated user. Sending an empty string clears an optional field.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param userProfile body UpdateUserProfileRequest true "User profile data to update"
+// @Param If-Match header string true "ETag from GET /users/me, or * to overwrite unconditionally"
+// @Param X-Sudo-Token header string false "Step-up token from POST /auth/sudo (required when changing email)"
 // @Success 200 {object} UserProfileResponse "Successfully updated user profile"
+// @Header 200 {string} ETag "New profile version"
 // @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid input data"
 // @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Email change requires an X-Sudo-Token"
 // @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
 // @Failure 409 {object} apperror.ErrorResponse "Conflict - e.g., email already exists"
+// @Failure 412 {object} apperror.ErrorResponse "Precondition Failed - Profile changed since it was loaded"
+// @Failure 428 {object} apperror.ErrorResponse "Precondition Required - If-Match header missing"
 // @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
 // @Router /users/me [put]
 // `HandleUpdateUserProfile` follows the same pattern as `HandleGetUserProfile`.
@@ -95,10 +112,11 @@ func (h *UserHandlers) HandleUpdateUserProfile() http.HandlerFunc {
 			return
 		}
 
-		// Decode the JSON request body into `UpdateUserProfileRequest` DTO.
+		// Decode the JSON request body into `UpdateUserProfileRequest` DTO and check the
+		// fields provided against the rules in its `validate` tags.
 		var req UpdateUserProfileRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			auth.WriteError(w, r, apperror.NewBadRequestError("Invalid request payload", err))
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
 			return
 		}
 		// `defer r.Body.Close()` ensures the request body is closed after the function finishes,
@@ -107,25 +125,839 @@ func (h *UserHandlers) HandleUpdateUserProfile() http.HandlerFunc {
 
 		// Perform basic validation on the request DTO.
 		// Basic validation (more can be added)
-		if req.Email == nil && req.Bio == nil {
+		if req.Email == nil && req.Bio == nil && req.ProfileDetails.empty() {
 			auth.WriteError(w, r, apperror.NewBadRequestError("No fields provided for update", nil))
 			return
 		}
+		// Changing the email address moves account recovery to a new inbox, so it requires
+		// a fresh sudo token (step-up re-authentication) in addition to the access token.
+		if req.Email != nil && !auth.HasSudo(r.Context()) {
+			auth.WriteError(w, r, auth.ErrSudoRequired)
+			return
+		}
 		// Example: Validate email format if provided
 		// if req.Email != nil && !isValidEmail(*req.Email) {
 		//    apperror.HandleError(w, apperror.NewBadRequestError("Invalid email format", nil))
 		//    return
 		// }
 
+		// The client must say which version of the profile its edit is based on.
+		ifMatch, err := parseIfMatch(r.Header.Get("If-Match"))
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
 		// Call the service layer to update the user profile.
-		updatedProfile, err := h.service.UpdateUserProfile(userID, &req)
+		updatedProfile, err := h.service.UpdateUserProfile(r.Context(), userID, ifMatch, &req)
 		if err != nil {
 			auth.WriteError(w, r, err) // service layer should return apperror types
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", profileETag(updatedProfile.Version))
+		render.Write(w, r, http.StatusOK, updatedProfile)
+	}
+}
+
+// HandleUploadAvatar godoc
+// @Summary Upload an avatar for the current user
+// @Description Accepts a GIF, JPEG, PNG or WebP image as the multipart field "avatar". The image is
+// @Description center-cropped to a square, resized to 32, 64, 128 and 256 pixels and stored; the
+// @Description updated profile with the new avatar URLs is returned.
+// @Tags users
+// @Accept mpfd
+// @Produce json
+// @Security BearerAuth
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} UserProfileResponse "Avatar stored; profile includes avatar_urls"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing file, unsupported image, or file too large"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 413 {object} apperror.ErrorResponse "Payload Too Large - Upload over the body limit"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/avatar [post]
+func (h *UserHandlers) HandleUploadAvatar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		// The body is bounded by the route (see `bodylimit`): the parse fails once it exceeds the
+		// limit, so oversized uploads never reach memory or disk.
+		maxBytes := h.service.maxAvatarBytes
+		if err := r.ParseMultipartForm(maxBytes); err != nil {
+			if tooLarge := apperror.FromMaxBytesError(err); tooLarge != nil {
+				auth.WriteError(w, r, tooLarge)
+				return
+			}
+			auth.WriteError(w, r, apperror.NewBadRequestError(fmt.Sprintf("Invalid upload: expected multipart form data of at most %d bytes", maxBytes), err))
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("avatar")
+		if err != nil {
+			auth.WriteError(w, r, apperror.NewBadRequestError("Missing \"avatar\" file field", err))
+			return
+		}
+		defer file.Close()
+		if header.Size > maxBytes {
+			auth.WriteError(w, r, apperror.NewBadRequestError(fmt.Sprintf("Avatar must be at most %d bytes", maxBytes), nil))
+			return
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			auth.WriteError(w, r, apperror.NewBadRequestError("Failed to read uploaded file", err))
+			return
+		}
+
+		profile, err := h.service.UploadAvatar(r.Context(), userID, data)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", profileETag(profile.Version))
+		render.Write(w, r, http.StatusOK, profile)
+	}
+}
+
+// HandleChangeUsername godoc
+// @Summary Change current user's username
+// @Description Renames the authenticated user. The old username keeps redirecting to the profile and
+// @Description stays reserved against other accounts for a while. Changes are limited by a cooldown.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body ChangeUsernameRequest true "New username"
+// @Success 200 {object} UserProfileResponse "Username changed"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid username"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Username taken or reserved"
+// @Failure 429 {object} apperror.ErrorResponse "Too Many Requests - Username changed too recently"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/username [put]
+func (h *UserHandlers) HandleChangeUsername() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req ChangeUsernameRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		profile, err := h.service.ChangeUsername(r.Context(), userID, req.Username)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("ETag", profileETag(profile.Version))
+		render.Write(w, r, http.StatusOK, profile)
+	}
+}
+
+// HandleGetPublicProfile godoc
+// @Summary Get a user's public profile by username
+// @Description Returns the public profile of a user, without fields the user has hidden from the viewer.
+// @Description Sending a token reveals fields visible to logged-in users. If the username was changed,
+// @Description responds with 301 Moved Permanently pointing at the profile under the current username.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} PublicUserProfileResponse "Public profile"
+// @Success 301 {string} string "Redirect to the current username"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - No such user"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/by-username/{username} [get]
+func (h *UserHandlers) HandleGetPublicProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+		// Anonymous viewers get 0; the route uses the optional JWT middleware.
+		viewerID, _ := auth.GetUserIDFromContext(r.Context())
+
+		profile, currentUsername, err := h.service.GetPublicProfileByUsername(r.Context(), username, viewerID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		if profile == nil {
+			http.Redirect(w, r, "/users/by-username/"+url.PathEscape(currentUsername), http.StatusMovedPermanently)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, profile)
+	}
+}
+
+// HandleGetPreferences godoc
+// @Summary Get current user's preferences
+// @Description Returns all known preferences (locale, timezone, theme, default_comment_sort), using defaults for unset keys.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} PreferencesResponse "Effective preferences"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/preferences [get]
+func (h *UserHandlers) HandleGetPreferences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		prefs, err := h.service.GetPreferences(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, prefs)
+	}
+}
+
+// HandleUpdatePreferences godoc
+// @Summary Update current user's preferences
+// @Description Partially updates preferences. Only known keys are accepted and values are validated;
+// @Description setting a key to null resets it to the default. Returns the effective preferences.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param preferences body PreferencesResponse true "Preferences to change"
+// @Success 200 {object} PreferencesResponse "Effective preferences after the update"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Unknown key or invalid value"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/preferences [patch]
+func (h *UserHandlers) HandleUpdatePreferences() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var patch map[string]interface{}
+		if err := validation.DecodeJSON(r, &patch); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		prefs, err := h.service.UpdatePreferences(r.Context(), userID, patch)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, prefs)
+	}
+}
+
+// HandleFollow godoc
+// @Summary Follow a user
+// @Description Makes the authenticated user follow another user. Comments by followed users appear in the home feed.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param userID path int true "ID of the user to follow"
+// @Success 204 "Now following"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID or self-follow"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/follow [post]
+func (h *UserHandlers) HandleFollow() http.HandlerFunc {
+	return h.handleRelationChange(h.service.Follow)
+}
+
+// HandleUnfollow godoc
+// @Summary Unfollow a user
+// @Description Stops following a user. Succeeds even if the user was not followed.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param userID path int true "ID of the user to unfollow"
+// @Success 204 "No longer following"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/follow [delete]
+func (h *UserHandlers) HandleUnfollow() http.HandlerFunc {
+	return h.handleRelationChange(h.service.Unfollow)
+}
+
+// HandleListFollowers godoc
+// @Summary List a user's followers
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[FollowUser] "Followers, most recent first"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid parameters"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/followers [get]
+func (h *UserHandlers) HandleListFollowers() http.HandlerFunc {
+	return h.handleListFollows(h.service.ListFollowers)
+}
+
+// HandleListFollowing godoc
+// @Summary List the users a user follows
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[FollowUser] "Followed users, most recent first"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid parameters"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/following [get]
+func (h *UserHandlers) HandleListFollowing() http.HandlerFunc {
+	return h.handleListFollows(h.service.ListFollowing)
+}
+
+// handleListFollows is the shared body of the follower/following listings.
+func (h *UserHandlers) handleListFollows(list func(ctx context.Context, userID int, p validation.Pagination) (*validation.Page[FollowUser], error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		var q validation.Pagination
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		page, err := list(r.Context(), userID, q)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		validation.WritePage(w, r, page)
+	}
+}
+
+// profileETag formats a profile version as a strong entity tag.
+func profileETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch reads an `If-Match` header for a profile update. It returns the accepted
+// versions, or nil for "*". Weak tags never match (If-Match uses strong comparison), so
+// they are kept out of the list; a header containing only weak tags therefore fails with 412.
+func parseIfMatch(header string) ([]int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, apperror.NewPreconditionRequiredError("If-Match header with the profile ETag is required", nil).WithCode(apperror.CodeIfMatchRequired)
+	}
+	if header == "*" {
+		return nil, nil
+	}
+	versions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		version, err := strconv.Atoi(strings.Trim(tag, `"`))
+		if err != nil {
+			return nil, apperror.NewBadRequestError(fmt.Sprintf("invalid entity tag %q in If-Match", tag), err)
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// userIDParam reads the `{userID}` path parameter.
+func userIDParam(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil || id <= 0 {
+		return 0, apperror.NewBadRequestError("invalid user ID", err)
+	}
+	return id, nil
+}
+
+// HandleBlock godoc
+// @Summary Block a user
+// @Description Blocks a user: their comments are hidden from you, they can't reply to you or follow you,
+// @Description their mentions don't notify you, and existing follows in both directions are removed.
+// @Tags users
+// @Security BearerAuth
+// @Param userID path int true "ID of the user to block"
+// @Success 204 "Blocked"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID or self-block"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/block [post]
+func (h *UserHandlers) HandleBlock() http.HandlerFunc {
+	return h.handleRelationChange(h.service.Block)
+}
+
+// HandleUnblock godoc
+// @Summary Unblock a user
+// @Tags users
+// @Security BearerAuth
+// @Param userID path int true "ID of the user to unblock"
+// @Success 204 "Unblocked"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/block [delete]
+func (h *UserHandlers) HandleUnblock() http.HandlerFunc {
+	return h.handleRelationChange(h.service.Unblock)
+}
+
+// HandleMute godoc
+// @Summary Mute a user
+// @Description Mutes a user: their comments are hidden from you and their mentions don't notify you.
+// @Tags users
+// @Security BearerAuth
+// @Param userID path int true "ID of the user to mute"
+// @Success 204 "Muted"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID or self-mute"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/mute [post]
+func (h *UserHandlers) HandleMute() http.HandlerFunc {
+	return h.handleRelationChange(h.service.Mute)
+}
+
+// HandleUnmute godoc
+// @Summary Unmute a user
+// @Tags users
+// @Security BearerAuth
+// @Param userID path int true "ID of the user to unmute"
+// @Success 204 "Unmuted"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/mute [delete]
+func (h *UserHandlers) HandleUnmute() http.HandlerFunc {
+	return h.handleRelationChange(h.service.Unmute)
+}
+
+// HandleListBlocks godoc
+// @Summary List blocked and muted users
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} BlockedUser "Blocked and muted users, most recent first"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/blocks [get]
+func (h *UserHandlers) HandleListBlocks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		blocks, err := h.service.ListBlocks(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, blocks)
+	}
+}
+
+// handleRelationChange is the shared body of the follow/block/mute style endpoints: it applies
+// `change(currentUser, {userID})` and answers 204 No Content.
+func (h *UserHandlers) handleRelationChange(change func(ctx context.Context, userID, otherID int) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		otherID, err := userIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		if err := change(r.Context(), userID, otherID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleSearchUsers godoc
+// @Summary Search users
+// @Description Fuzzy search over usernames and real names (trigram similarity plus prefix match),
+// @Description e.g. for mention autocomplete. Users who blocked you or whom you blocked are excluded.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Search text"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[UserSearchResult] "Matches, best first"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing or invalid query"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/search [get]
+func (h *UserHandlers) HandleSearchUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		var q UserSearchQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		results, err := h.service.SearchUsers(r.Context(), userID, q.Query, q.Pagination)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		validation.WritePage(w, r, results)
+	}
+}
+
+// HandleGetReputation godoc
+// @Summary Get a user's reputation breakdown
+// @Description Returns the reputation total and the points per source: received reactions (`reaction`), accepted definitions (`definition`),
+// @Description reviewed definition edits (`revision`) and examples (`example`), +2 when approved and -1 when rejected, and other moderation (`moderation`).
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Success 200 {object} ReputationResponse "Reputation"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/reputation [get]
+func (h *UserHandlers) HandleGetReputation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		rep, err := h.service.GetReputationBreakdown(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, rep)
+	}
+}
+
+// HandleGetUserStats godoc
+// @Summary Get a user's contribution statistics
+// @Description Returns counts of comments posted, reactions received and definitions authored, plus days active
+// @Description and activity streaks. Results may be up to `USER_STATS_CACHE_TTL` old.
+// @Tags users
+// @Produce json
+// @Param userID path int true "User ID"
+// @Success 200 {object} UserStatsResponse "Statistics"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid user ID"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - User not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/{userID}/stats [get]
+func (h *UserHandlers) HandleGetUserStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDParam(r)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		stats, err := h.service.GetUserStats(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, stats)
+	}
+}
+
+// HandleGetOnboarding godoc
+// @Summary Get current user's onboarding checklist
+// @Description Returns the onboarding steps (verify email, write a bio, post a first comment, learn the first
+// @Description 10 words), which of them are completed, and the overall state.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} OnboardingResponse "Onboarding progress"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/onboarding [get]
+func (h *UserHandlers) HandleGetOnboarding() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		onboarding, err := h.service.GetOnboarding(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, onboarding)
+	}
+}
+
+// HandleUpdateOnboarding godoc
+// @Summary Update current user's onboarding checklist
+// @Description Marks client-reported steps (learn_first_words) as completed and/or dismisses the checklist.
+// @Description Completed steps can't be reset; other steps complete automatically.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param onboarding body UpdateOnboardingRequest true "Onboarding changes"
+// @Success 200 {object} OnboardingResponse "Updated onboarding progress"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Unknown or automatic step"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/onboarding [patch]
+func (h *UserHandlers) HandleUpdateOnboarding() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var req UpdateOnboardingRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		onboarding, err := h.service.UpdateOnboarding(r.Context(), userID, &req)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, onboarding)
+	}
+}
+
+// HandleSendVerificationEmail godoc
+// @Summary Send a verification email
+// @Description Emails a link that verifies the current user's email address, which completes the verify_email
+// @Description onboarding step. The link works for 48 hours, and only while the address stays the same.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} EmailVerificationResponse "Verification email queued"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - The account has no email address"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 409 {object} apperror.ErrorResponse "Conflict - Already verified"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/email/verification [post]
+func (h *UserHandlers) HandleSendVerificationEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		resp, err := h.service.SendVerificationEmail(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusAccepted, resp)
+	}
+}
+
+// confirmVerificationPage asks to confirm the verification; the form posts back to the same link.
+var confirmVerificationPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html><html><body>
+<form method="post" action="?token={{.}}">
+<p>Confirm this email address for your Lensisku account?</p>
+<button type="submit">Confirm</button>
+</form></body></html>`))
+
+// HandleConfirmVerifyEmail godoc
+// @Summary Confirm an email verification
+// @Description Target of the link in verification emails. Shows a form that posts to /users/email/verify;
+// @Description following the link changes nothing, as link scanners follow it too.
+// @Tags users
+// @Produce html
+// @Param token query string true "Signed verification token from the email"
+// @Success 200 {string} string "Confirmation form"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid or expired token"
+// @Router /users/email/verify [get]
+func (h *UserHandlers) HandleConfirmVerifyEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if err := h.service.CheckVerificationToken(r.Context(), token); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(updatedProfile)
+		confirmVerificationPage.Execute(w, token)
 	}
-}
\ No newline at end of file
+}
+
+// HandleVerifyEmail godoc
+// @Summary Verify an email address
+// @Description Posted by the confirmation form. Marks the address the token was issued for as verified.
+// @Tags users
+// @Produce html
+// @Param token query string true "Signed verification token from the email"
+// @Success 200 {string} string "Verified"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid or expired token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/email/verify [post]
+func (h *UserHandlers) HandleVerifyEmail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.service.VerifyEmail(r.Context(), r.URL.Query().Get("token")); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`<!DOCTYPE html><html><body><p>Your email address is verified.</p></body></html>`))
+	}
+}
+
+// HandleDeleteAccount godoc
+// @Summary Delete current user's account
+// @Description Deletes the account: the username becomes "deleted user <id>", the email, password and profile
+// @Description are cleared, and follows, blocks, preferences, notifications and avatar files are deleted. Definitions and
+// @Description comments stay, under the anonymous name. The account's refresh tokens are refused from then on. Requires a sudo token.
+// @Tags users
+// @Security BearerAuth
+// @Param X-Sudo-Token header string true "Step-up token from POST /auth/sudo"
+// @Success 204 "Account deleted"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 403 {object} apperror.ErrorResponse "Forbidden - Missing or invalid X-Sudo-Token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Account already deleted"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me [delete]
+func (h *UserHandlers) HandleDeleteAccount() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		if err := h.service.DeleteAccount(r.Context(), userID); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleGetPrivacySettings godoc
+// @Summary Get current user's profile privacy settings
+// @Description Returns the visibility (public, users, private) of each configurable profile field.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} PrivacySettings "Visibility per field"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/privacy [get]
+func (h *UserHandlers) HandleGetPrivacySettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		settings, err := h.service.GetPrivacySettings(r.Context(), userID)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, settings)
+	}
+}
+
+// HandleUpdatePrivacySettings godoc
+// @Summary Update current user's profile privacy settings
+// @Description Sets the visibility of the given fields; fields not sent keep their setting.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body PrivacySettings true "Visibility per field"
+// @Success 200 {object} PrivacySettings "Visibility per field after the update"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Unknown field or visibility"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /users/me/privacy [patch]
+func (h *UserHandlers) HandleUpdatePrivacySettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+
+		var patch PrivacySettings
+		if err := validation.DecodeJSON(r, &patch); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		defer r.Body.Close()
+
+		settings, err := h.service.UpdatePrivacySettings(r.Context(), userID, patch)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, settings)
+	}
+}
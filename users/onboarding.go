@@ -0,0 +1,221 @@
+// Package users, as part of the user profile management module.
+// This file, `onboarding.go`, tracks the onboarding checklist shown to new users. Each step moves
+// one way only, from pending to completed; the checklist as a whole is "in_progress" until every
+// step is done ("completed") or the user hides it ("dismissed", which can be undone).
+//
+// Steps complete in two ways:
+//   - derived from data: the email address was verified, a bio was saved, a first comment was
+//     posted (checked on every read);
+//   - reported by the client: words learned in the frontend's study mode.
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// Onboarding step keys, in checklist order.
+const (
+	OnboardingVerifyEmail     = "verify_email"
+	OnboardingSetBio          = "set_bio"
+	OnboardingFirstComment    = "first_comment"
+	OnboardingLearnFirstWords = "learn_first_words"
+)
+
+// Overall onboarding states.
+const (
+	OnboardingInProgress = "in_progress"
+	OnboardingCompleted  = "completed"
+	OnboardingDismissed  = "dismissed"
+)
+
+// onboardingStep describes one checklist entry.
+type onboardingStep struct {
+	key   string
+	title string
+	// clientReported steps may be completed through PATCH /users/me/onboarding.
+	clientReported bool
+}
+
+var onboardingSteps = []onboardingStep{
+	{key: OnboardingVerifyEmail, title: "Verify your email address"},
+	{key: OnboardingSetBio, title: "Write a short bio"},
+	{key: OnboardingFirstComment, title: "Post your first comment"},
+	{key: OnboardingLearnFirstWords, title: "Learn your first 10 words", clientReported: true},
+}
+
+// onboardingState is the stored row of `user_onboarding`.
+type onboardingState struct {
+	completed   map[string]time.Time
+	dismissedAt *time.Time
+}
+
+// loadOnboarding reads the stored state; users without a row have completed nothing.
+func (s *UserService) loadOnboarding(ctx context.Context, userID int) (*onboardingState, error) {
+	state := &onboardingState{completed: map[string]time.Time{}}
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(o.completed, '{}'), o.dismissed_at
+		FROM users u
+		LEFT JOIN user_onboarding o ON o.user_id = u.userid
+		WHERE u.userid = $1`, userID).Scan(&state.completed, &state.dismissedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+		}
+		return nil, apperror.NewDatabaseError("failed to load onboarding state", err)
+	}
+	return state, nil
+}
+
+// derivedOnboardingSteps reports which data-derived steps the user has fulfilled.
+func (s *UserService) derivedOnboardingSteps(ctx context.Context, userID int) ([]string, error) {
+	var verified, hasBio, hasComment bool
+	err := s.db.QueryRow(ctx, `
+		SELECT email_verified_at IS NOT NULL,
+		       COALESCE(TRIM(bio), '') <> '',
+		       EXISTS (SELECT 1 FROM comments WHERE userid = $1)
+		FROM users WHERE userid = $1`, userID).Scan(&verified, &hasBio, &hasComment)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to check onboarding progress", err)
+	}
+	var done []string
+	if verified {
+		done = append(done, OnboardingVerifyEmail)
+	}
+	if hasBio {
+		done = append(done, OnboardingSetBio)
+	}
+	if hasComment {
+		done = append(done, OnboardingFirstComment)
+	}
+	return done, nil
+}
+
+// markOnboardingSteps records steps as completed now. Steps completed earlier keep their time.
+func (s *UserService) markOnboardingSteps(ctx context.Context, userID int, steps []string) error {
+	now := time.Now().UTC()
+	patch := make(map[string]time.Time, len(steps))
+	for _, step := range steps {
+		patch[step] = now
+	}
+	encoded, err := json.Marshal(patch)
+	if err != nil {
+		return apperror.NewInternalError("failed to encode onboarding steps", err)
+	}
+	// `$2 || completed` lets already stored timestamps win over the new ones.
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO user_onboarding (user_id, completed)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET completed = $2::jsonb || user_onboarding.completed, updated_at = NOW()`, userID, encoded)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to save onboarding progress", err)
+	}
+	return nil
+}
+
+func isOnboardingStep(key string) bool {
+	for _, step := range onboardingSteps {
+		if step.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOnboarding returns the checklist with the current progress. Data-derived steps that are
+// newly fulfilled are recorded first, so their completion time stays stable afterwards.
+func (s *UserService) GetOnboarding(ctx context.Context, userID int) (*OnboardingResponse, error) {
+	state, err := s.loadOnboarding(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := s.derivedOnboardingSteps(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var fresh []string
+	for _, step := range derived {
+		if _, ok := state.completed[step]; !ok {
+			fresh = append(fresh, step)
+		}
+	}
+	if len(fresh) > 0 {
+		if err := s.markOnboardingSteps(ctx, userID, fresh); err != nil {
+			return nil, err
+		}
+		if state, err = s.loadOnboarding(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return buildOnboardingResponse(state), nil
+}
+
+// UpdateOnboarding applies a PATCH: completing client-reported steps and dismissing or
+// restoring the checklist.
+func (s *UserService) UpdateOnboarding(ctx context.Context, userID int, req *UpdateOnboardingRequest) (*OnboardingResponse, error) {
+	if len(req.Complete) == 0 && req.Dismissed == nil {
+		return nil, apperror.NewBadRequestError("No onboarding changes provided", nil)
+	}
+	for _, key := range req.Complete {
+		if !isOnboardingStep(key) {
+			return nil, apperror.NewValidationError(fmt.Sprintf("unknown onboarding step %q", key), nil)
+		}
+		for _, step := range onboardingSteps {
+			if step.key == key && !step.clientReported {
+				return nil, apperror.NewValidationError(fmt.Sprintf("onboarding step %q is completed automatically", key), nil)
+			}
+		}
+	}
+	if err := s.ensureUserExists(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if len(req.Complete) > 0 {
+		if err := s.markOnboardingSteps(ctx, userID, req.Complete); err != nil {
+			return nil, err
+		}
+	}
+	if req.Dismissed != nil {
+		_, err := s.db.Exec(ctx, `
+			INSERT INTO user_onboarding (user_id, dismissed_at)
+			VALUES ($1, CASE WHEN $2::boolean THEN NOW() END)
+			ON CONFLICT (user_id) DO UPDATE
+			SET dismissed_at = CASE WHEN $2::boolean THEN COALESCE(user_onboarding.dismissed_at, NOW()) END,
+			    updated_at = NOW()`, userID, *req.Dismissed)
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to update onboarding state", err)
+		}
+	}
+	return s.GetOnboarding(ctx, userID)
+}
+
+// buildOnboardingResponse turns the stored state into the checklist payload.
+func buildOnboardingResponse(state *onboardingState) *OnboardingResponse {
+	resp := &OnboardingResponse{Steps: make([]OnboardingStep, 0, len(onboardingSteps)), Total: len(onboardingSteps)}
+	for _, step := range onboardingSteps {
+		item := OnboardingStep{Key: step.key, Title: step.title}
+		if at, ok := state.completed[step.key]; ok {
+			item.Completed = true
+			item.CompletedAt = &at
+			resp.CompletedCount++
+		}
+		resp.Steps = append(resp.Steps, item)
+	}
+	switch {
+	case resp.CompletedCount == resp.Total:
+		resp.State = OnboardingCompleted
+	case state.dismissedAt != nil:
+		resp.State = OnboardingDismissed
+	default:
+		resp.State = OnboardingInProgress
+	}
+	return resp
+}
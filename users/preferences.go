@@ -0,0 +1,227 @@
+// Package users, as part of the user profile management module.
+// This file, `preferences.go`, implements a small key/value store for per-user preferences
+// (locale, timezone, theme, ...). The set of keys is fixed by `preferenceSchema`: unknown keys
+// are rejected and every value is validated before it is stored. Keys a user hasn't set fall
+// back to defaults, which can be overridden in configuration.
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/logging"
+)
+
+// Known preference keys.
+const (
+	PrefLocale             = "locale"
+	PrefTimezone           = "timezone"
+	PrefTheme              = "theme"
+	PrefDefaultCommentSort = "default_comment_sort"
+	PrefDigestFrequency    = "digest_frequency"
+)
+
+// preferenceSpec describes one known preference: its built-in default and how values are checked.
+type preferenceSpec struct {
+	defaultValue interface{}
+	validate     func(value interface{}) error
+}
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// preferenceSchema is the server-side schema of all accepted preference keys.
+var preferenceSchema = map[string]preferenceSpec{
+	PrefLocale: {
+		defaultValue: "en",
+		validate: stringPreference(func(v string) error {
+			if !localePattern.MatchString(v) {
+				return fmt.Errorf("must be a language tag such as \"en\" or \"jbo\"")
+			}
+			return nil
+		}),
+	},
+	PrefTimezone: {
+		defaultValue: "UTC",
+		validate: stringPreference(func(v string) error {
+			if _, err := time.LoadLocation(v); err != nil || v == "" || v == "Local" {
+				return fmt.Errorf("must be an IANA time zone such as \"Europe/Berlin\"")
+			}
+			return nil
+		}),
+	},
+	PrefTheme: {
+		defaultValue: "system",
+		validate:     enumPreference("light", "dark", "system"),
+	},
+	PrefDefaultCommentSort: {
+		defaultValue: "newest",
+		validate:     enumPreference("newest", "oldest"),
+	},
+	// Activity digest emails; "off" is also what the one-click unsubscribe link sets.
+	PrefDigestFrequency: {
+		defaultValue: "weekly",
+		validate:     enumPreference("weekly", "off"),
+	},
+}
+
+// stringPreference adapts a string check to the generic validator signature.
+func stringPreference(check func(string) error) func(interface{}) error {
+	return func(value interface{}) error {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		return check(s)
+	}
+}
+
+// enumPreference accepts one of a fixed set of strings.
+func enumPreference(allowed ...string) func(interface{}) error {
+	return stringPreference(func(v string) error {
+		for _, a := range allowed {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of: %s", strings.Join(allowed, ", "))
+	})
+}
+
+// buildPreferenceDefaults merges the configured defaults over the built-in ones.
+// Invalid or unknown configured values are logged and ignored, so a typo in the
+// environment can't make every user's preferences fail validation.
+func buildPreferenceDefaults(cfg *config.UsersConfig) map[string]interface{} {
+	defaults := make(map[string]interface{}, len(preferenceSchema))
+	for key, spec := range preferenceSchema {
+		defaults[key] = spec.defaultValue
+	}
+	if cfg == nil {
+		return defaults
+	}
+	logger := logging.For("users")
+	for key, value := range cfg.PreferenceDefaults {
+		spec, ok := preferenceSchema[key]
+		if !ok {
+			logger.Warn("Ignoring default for unknown preference", "preference", key)
+			continue
+		}
+		if err := spec.validate(value); err != nil {
+			logger.Warn("Ignoring invalid default for preference", "preference", key, "error", err)
+			continue
+		}
+		defaults[key] = value
+	}
+	return defaults
+}
+
+// PreferenceDefault returns the effective default of a known preference key, or nil.
+// Modules that filter users by a preference in SQL use it for users without a stored value.
+func (s *UserService) PreferenceDefault(key string) interface{} {
+	return s.preferenceDefaults[key]
+}
+
+// SetPreference stores a single validated preference, e.g. from an unsubscribe link.
+func (s *UserService) SetPreference(ctx context.Context, userID int, key string, value interface{}) error {
+	_, err := s.UpdatePreferences(ctx, userID, map[string]interface{}{key: value})
+	return err
+}
+
+// GetPreferences returns all known preferences for the user, with defaults filled in.
+func (s *UserService) GetPreferences(ctx context.Context, userID int) (PreferencesResponse, error) {
+	prefs := make(PreferencesResponse, len(s.preferenceDefaults))
+	for key, value := range s.preferenceDefaults {
+		prefs[key] = value
+	}
+
+	rows, err := s.db.Query(ctx, `SELECT key, value FROM user_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load preferences", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var raw []byte
+		if err := rows.Scan(&key, &raw); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read preference", err)
+		}
+		// Rows for keys that were removed from the schema are simply not reported.
+		if _, known := preferenceSchema[key]; !known {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, apperror.NewInternalError(fmt.Sprintf("stored preference %q is not valid JSON", key), err)
+		}
+		prefs[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to load preferences", err)
+	}
+	return prefs, nil
+}
+
+// UpdatePreferences applies a partial update. A `null` value resets the key to its default.
+// The whole patch is validated before anything is written, so an invalid key leaves all
+// preferences untouched.
+func (s *UserService) UpdatePreferences(ctx context.Context, userID int, patch map[string]interface{}) (PreferencesResponse, error) {
+	if len(patch) == 0 {
+		return nil, apperror.NewBadRequestError("No preferences provided for update", nil)
+	}
+
+	var problems []string
+	for key, value := range patch {
+		spec, ok := preferenceSchema[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown preference", key))
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		if err := spec.validate(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, apperror.NewValidationError("invalid preferences: "+strings.Join(problems, "; "), nil)
+	}
+
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		for key, value := range patch {
+			if value == nil {
+				if _, err := tx.Exec(ctx, `DELETE FROM user_preferences WHERE user_id = $1 AND key = $2`, userID, key); err != nil {
+					return apperror.NewDatabaseError("failed to reset preference", err)
+				}
+				continue
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return apperror.NewInternalError("failed to encode preference", err)
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO user_preferences (user_id, key, value, updated_at)
+				VALUES ($1, $2, $3, NOW())
+				ON CONFLICT (user_id, key) DO UPDATE SET value = EXCLUDED.value, updated_at = EXCLUDED.updated_at`,
+				userID, key, encoded)
+			if err != nil {
+				return apperror.NewDatabaseError("failed to save preference", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(ctx, userID)
+}
@@ -0,0 +1,136 @@
+// Package users, as part of the user profile management module.
+// This file, `privacy.go`, implements per-field visibility of profile fields. Each field can be
+//   - "public":  visible to everyone,
+//   - "users":   visible to logged-in users only,
+//   - "private": visible only to the owner.
+//
+// Settings are stored in `users.field_visibility` (JSONB, missing keys mean public) so that other
+// modules can apply them in SQL too; the comments module does this for the author's real name.
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// Visibility levels of a profile field.
+const (
+	VisibilityPublic  = "public"
+	VisibilityUsers   = "users"
+	VisibilityPrivate = "private"
+)
+
+// PrivacyFields lists the profile fields whose visibility can be configured.
+var PrivacyFields = []string{"realname", "bio", "website", "location", "pronouns", "lojban_level"}
+
+// isPrivacyField reports whether `field` is configurable.
+func isPrivacyField(field string) bool {
+	for _, f := range PrivacyFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldVisible decides whether a viewer may see a field with the given visibility.
+// `viewerID` is 0 for anonymous viewers.
+func fieldVisible(visibility string, ownerID, viewerID int) bool {
+	switch visibility {
+	case VisibilityUsers:
+		return viewerID != 0
+	case VisibilityPrivate:
+		return viewerID == ownerID
+	default:
+		return true
+	}
+}
+
+// GetPrivacySettings returns the visibility of every configurable field.
+func (s *UserService) GetPrivacySettings(ctx context.Context, userID int) (PrivacySettings, error) {
+	var stored map[string]string
+	err := s.db.QueryRow(ctx, `SELECT field_visibility FROM users WHERE userid = $1`, userID).Scan(&stored)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+		}
+		return nil, apperror.NewDatabaseError("failed to load privacy settings", err)
+	}
+	settings := make(PrivacySettings, len(PrivacyFields))
+	for _, field := range PrivacyFields {
+		settings[field] = VisibilityPublic
+		if v, ok := stored[field]; ok {
+			settings[field] = v
+		}
+	}
+	return settings, nil
+}
+
+// UpdatePrivacySettings changes the visibility of the given fields and returns all settings.
+func (s *UserService) UpdatePrivacySettings(ctx context.Context, userID int, patch PrivacySettings) (PrivacySettings, error) {
+	if len(patch) == 0 {
+		return nil, apperror.NewBadRequestError("No privacy settings provided for update", nil)
+	}
+	var problems []string
+	for field, visibility := range patch {
+		if !isPrivacyField(field) {
+			problems = append(problems, fmt.Sprintf("%s: unknown field", field))
+			continue
+		}
+		if visibility != VisibilityPublic && visibility != VisibilityUsers && visibility != VisibilityPrivate {
+			problems = append(problems, fmt.Sprintf("%s: must be one of public, users, private", field))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, apperror.NewValidationError("invalid privacy settings: "+strings.Join(problems, "; "), nil)
+	}
+
+	encoded, err := json.Marshal(patch)
+	if err != nil {
+		return nil, apperror.NewInternalError("failed to encode privacy settings", err)
+	}
+	// `||` merges the patch into the stored object, keeping fields that weren't sent.
+	tag, err := s.db.Exec(ctx, `UPDATE users SET field_visibility = field_visibility || $1::jsonb WHERE userid = $2`, encoded, userID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to update privacy settings", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+	}
+	s.invalidatePublicProfile(ctx, userID)
+	return s.GetPrivacySettings(ctx, userID)
+}
+
+// applyPrivacy clears the fields of a public profile that `viewerID` may not see.
+func applyPrivacy(p *PublicUserProfileResponse, visibility map[string]string, viewerID int) {
+	hide := func(field string) bool {
+		return !fieldVisible(visibility[field], p.ID, viewerID)
+	}
+	if hide("realname") {
+		p.Realname = nil
+	}
+	if hide("bio") {
+		p.Bio = nil
+	}
+	if hide("website") {
+		p.Website = nil
+	}
+	if hide("location") {
+		p.Location = nil
+	}
+	if hide("pronouns") {
+		p.Pronouns = nil
+	}
+	if hide("lojban_level") {
+		p.LojbanLevel = nil
+	}
+}
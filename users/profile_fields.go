@@ -0,0 +1,38 @@
+// Package users, as part of the user profile management module.
+// This file, `profile_fields.go`, maps the optional profile fields in `ProfileDetails`
+// (website, location, pronouns, Lojban proficiency level) to SQL for updates. Their values are
+// checked by the rules in the `validate` tags of `ProfileDetails`.
+package users
+
+import (
+	"fmt"
+	"strings"
+)
+
+// empty reports whether no profile detail was provided.
+func (d *ProfileDetails) empty() bool {
+	return d.Website == nil && d.Location == nil && d.Pronouns == nil && d.LojbanLevel == nil
+}
+
+// profileDetailAssignments returns the SET clauses and arguments for the provided fields,
+// numbering placeholders from `firstArg`. Empty strings are stored as NULL.
+func profileDetailAssignments(d *ProfileDetails, firstArg int) ([]string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for _, f := range []struct {
+		column string
+		value  *string
+	}{
+		{"website", d.Website},
+		{"location", d.Location},
+		{"pronouns", d.Pronouns},
+		{"lojban_level", d.LojbanLevel},
+	} {
+		if f.value == nil {
+			continue
+		}
+		clauses = append(clauses, fmt.Sprintf("%s = NULLIF($%d, '')", f.column, firstArg+len(args)))
+		args = append(args, strings.TrimSpace(*f.value))
+	}
+	return clauses, args
+}
@@ -0,0 +1,114 @@
+// Package users, as part of the user profile management module.
+// This file, `reputation.go`, exposes the reputation ledger. A user's reputation is the sum of
+// `reputation_events`: received reactions and accepted definitions are recorded automatically
+// (database trigger and background sync), moderation outcomes, including the reviews of
+// definition edits and examples, are recorded through `RecordModerationOutcome`. The total is cached in `users.reputation` and shown on profiles.
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+)
+
+// Reputation sources of moderation outcomes, as stored in `reputation_events.source`. Each
+// numbers its events by the ID of what was moderated.
+const (
+	ReputationSourceModeration = "moderation" // Other moderation actions
+	ReputationSourceRevision   = "revision"   // Reviews of definition edits, by revision ID
+	ReputationSourceExample    = "example"    // Reviews of examples, by example ID
+)
+
+// Points of a reviewed contribution for its author.
+const (
+	ReviewApprovedPoints = 2
+	ReviewRejectedPoints = -1
+)
+
+// ReviewPoints returns the points of a contribution's review for its author.
+func ReviewPoints(approved bool) int {
+	if approved {
+		return ReviewApprovedPoints
+	}
+	return ReviewRejectedPoints
+}
+
+// ModerationOutcome is the reputation effect of one moderation decision.
+type ModerationOutcome struct {
+	UserID   int
+	Source   string // One of the ReputationSource* constants
+	SourceID int64
+	Points   int
+	Reason   string
+}
+
+// RecordModerationOutcome adds (or, when called again for the same source, replaces) the
+// reputation effect of a moderation decision, e.g. a negative amount for removed content or a
+// positive one for an approved edit. Called with the transaction making the decision, the
+// points stand or fall with it.
+func RecordModerationOutcome(ctx context.Context, q db.Execer, o ModerationOutcome) error {
+	tag, err := q.Exec(ctx, `
+		INSERT INTO reputation_events (user_id, source, source_id, points, reason)
+		SELECT userid, $2, $3, $4, NULLIF($5, '') FROM users WHERE userid = $1
+		ON CONFLICT (source, source_id) DO UPDATE
+		SET user_id = EXCLUDED.user_id, points = EXCLUDED.points, reason = EXCLUDED.reason`,
+		o.UserID, o.Source, o.SourceID, o.Points, o.Reason)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to record moderation outcome", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", o.UserID), nil)
+	}
+	return nil
+}
+
+// RecordModerationOutcome records the outcome of the moderation action `actionID` for
+// `userID`; see the package-level RecordModerationOutcome.
+func (s *UserService) RecordModerationOutcome(ctx context.Context, userID int, actionID int64, points int, reason string) error {
+	return RecordModerationOutcome(ctx, s.db, ModerationOutcome{
+		UserID:   userID,
+		Source:   ReputationSourceModeration,
+		SourceID: actionID,
+		Points:   points,
+		Reason:   reason,
+	})
+}
+
+// GetReputationBreakdown returns the user's reputation split by source.
+func (s *UserService) GetReputationBreakdown(ctx context.Context, userID int) (*ReputationResponse, error) {
+	resp := &ReputationResponse{UserID: userID, BySource: map[string]int{}}
+	err := s.db.QueryRow(ctx, `SELECT reputation FROM users WHERE userid = $1`, userID).Scan(&resp.Total)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+		}
+		return nil, apperror.NewDatabaseError("failed to load reputation", err)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT source, COALESCE(SUM(points), 0)
+		FROM reputation_events
+		WHERE user_id = $1
+		GROUP BY source`, userID)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to load reputation", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var source string
+		var points int
+		if err := rows.Scan(&source, &points); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read reputation", err)
+		}
+		resp.BySource[source] = points
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to load reputation", err)
+	}
+	return resp, nil
+}
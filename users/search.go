@@ -0,0 +1,72 @@
+// Package users, as part of the user profile management module.
+// This file, `search.go`, implements fuzzy user search for mention autocomplete and admin tooling.
+// Matching uses pg_trgm trigram similarity on username and real name, plus a plain prefix match
+// so that very short inputs (which have too few trigrams) still find users while typing.
+package users
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/validation"
+)
+
+// maxSearchQueryLength bounds the search input; longer strings make trigram matching expensive.
+const maxSearchQueryLength = 100
+
+// SearchUsers finds users whose username or real name resembles `query`, best matches first.
+// Users who have blocked the searcher, or whom the searcher has blocked, are left out.
+func (s *UserService) SearchUsers(ctx context.Context, viewerID int, query string, p validation.Pagination) (*validation.Page[UserSearchResult], error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, apperror.NewValidationError("search query must not be empty", nil)
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return nil, apperror.NewValidationError("search query is too long", nil)
+	}
+	prefix := db.EscapeLike(query) + "%"
+
+	// $1 = query, $2 = prefix pattern, $3 = viewer.
+	// Private real names are neither matched nor returned; the viewer is always logged in here.
+	const realname = `CASE WHEN u.field_visibility->>'realname' = 'private' AND u.userid <> $3 THEN NULL ELSE u.realname END`
+	const filter = `
+		(u.username % $1 OR ` + realname + ` % $1 OR u.username ILIKE $2)
+		AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE b.kind = 'block'
+			  AND ((b.blocker_id = u.userid AND b.blocked_id = $3) OR (b.blocker_id = $3 AND b.blocked_id = u.userid))
+		)`
+
+	var total int64
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM users u WHERE `+filter, query, prefix, viewerID).Scan(&total); err != nil {
+		return nil, apperror.NewDatabaseError("failed to count search results", err)
+	}
+
+	// Prefix hits rank first (that's what autocomplete wants), then by trigram similarity.
+	rows, err := s.db.Query(ctx, `
+		SELECT u.userid, u.username, `+realname+`, u.avatar_urls,
+		       GREATEST(similarity(u.username, $1), similarity(COALESCE(`+realname+`, ''), $1)) AS score
+		FROM users u
+		WHERE `+filter+`
+		ORDER BY (u.username ILIKE $2) DESC, score DESC, u.username
+		LIMIT $4 OFFSET $5`, query, prefix, viewerID, p.PerPage, p.Offset())
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to search users", err)
+	}
+	defer rows.Close()
+	var users []UserSearchResult
+	for rows.Next() {
+		var u UserSearchResult
+		if err := rows.Scan(&u.ID, &u.Username, &u.Realname, &u.AvatarURLs, &u.Score); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read search result", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to search users", err)
+	}
+	return validation.NewPage(users, total, p), nil
+}
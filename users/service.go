@@ -9,6 +9,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	// `pgx` specific imports for PostgreSQL interaction.
@@ -19,6 +20,11 @@ import (
 	// Internal application packages.
 	"github.com/user/lensisku-go/apperror" // For standardized error handling.
 	"github.com/user/lensisku-go/auth"     // For the `auth.User` model, reusing it here.
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/storage" // Where uploaded avatars are written.
+	"github.com/user/lensisku-go/userrepo"
 )
 
 // UserService provides methods for user profile management.
@@ -27,34 +33,74 @@ type UserService struct {
 	// `db` is a pointer to a `pgxpool.Pool`, representing the database connection pool.
 	// This dependency is injected via the constructor.
 	db *pgxpool.Pool
+	// `accounts` reads account rows with the canonical column mapping shared with `auth`.
+	accounts *userrepo.Repository
+	// `store` receives uploaded files such as avatars; see `avatar.go`.
+	store storage.Storage
+	// `maxAvatarBytes` caps the size of an avatar upload request body.
+	maxAvatarBytes int64
+	// `cfg` holds module settings such as the username change cooldown.
+	cfg *config.UsersConfig
+	// `preferenceDefaults` are the effective defaults for unset preferences (see `preferences.go`).
+	preferenceDefaults map[string]interface{}
+	// `statsCache` keeps recently computed contribution statistics (see `stats.go`).
+	statsCache *statsCache
+	// `profileCache` keeps public profiles by username (see `username.go`); nil disables it.
+	profileCache *cache.Cache
+	// `queue`, `publicBaseURL` and `verificationSecret` send verification emails (see `verification.go`).
+	queue              *jobs.Queue
+	publicBaseURL      string
+	verificationSecret []byte
 }
 
 // NewUserService creates a new UserService.
 // This is the constructor function for `UserService`.
-func NewUserService(db *pgxpool.Pool) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *pgxpool.Pool, store storage.Storage, storageCfg *config.StorageConfig, usersCfg *config.UsersConfig) *UserService {
+	return &UserService{
+		db:                 db,
+		accounts:           userrepo.New(db),
+		store:              store,
+		maxAvatarBytes:     storageCfg.MaxAvatarBytes,
+		cfg:                usersCfg,
+		preferenceDefaults: buildPreferenceDefaults(usersCfg),
+		statsCache:         newStatsCache(usersCfg.StatsCacheTTL),
+	}
 }
 
 // GetUserProfile retrieves a user's profile by their ID.
-func (s *UserService) GetUserProfile(userID int) (*UserProfileResponse, error) {
+func (s *UserService) GetUserProfile(ctx context.Context, userID int) (*UserProfileResponse, error) {
 	query := `
-		SELECT id, username, email, bio, created_at 
+		SELECT userid, username, email, bio, created_at, avatar_urls, reputation,
+		       website, location, pronouns, lojban_level, profile_version
 		FROM users 
-		WHERE id = $1
+		WHERE userid = $1
 	`
 	// Reusing `auth.User` struct for scanning basic user data. This is acceptable if the fields match.
 	// Alternatively, a dedicated `User` struct could be defined within the `users` package.
 	var user auth.User // Reusing the auth.User model for scanning
 	// `sql.NullString` is used for the `bio` field, as it can be NULL in the database.
 	var bio sql.NullString // Handling nullable bio field
+	// `avatar_urls` is a nullable JSONB object; pgx decodes it straight into the map (nil when NULL).
+	var avatarURLs map[string]string
+	var reputation int
+	// The optional profile fields are nullable and scan directly into `*string`.
+	var details ProfileDetails
+	var version int
 
 	// `s.db.QueryRow` executes the query and scans the result into the provided variables.
-	err := s.db.QueryRow(context.Background(), query, userID).Scan(
+	err := s.db.QueryRow(ctx, query, userID).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&bio,
 		&user.CreatedAt,
+		&avatarURLs,
+		&reputation,
+		&details.Website,
+		&details.Location,
+		&details.Pronouns,
+		&details.LojbanLevel,
+		&version,
 	)
 
 	if err != nil {
@@ -68,10 +114,14 @@ func (s *UserService) GetUserProfile(userID int) (*UserProfileResponse, error) {
 
 	response := &UserProfileResponse{
 		// Map the scanned data to the `UserProfileResponse` DTO.
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
+		ID:             user.ID,
+		Username:       user.Username,
+		Email:          user.Email,
+		CreatedAt:      user.CreatedAt,
+		AvatarURLs:     avatarURLs,
+		Reputation:     reputation,
+		ProfileDetails: details,
+		Version:        version,
 	}
 	if bio.Valid {
 		// If `bio` is not NULL, assign its string value to the response.
@@ -81,14 +131,23 @@ func (s *UserService) GetUserProfile(userID int) (*UserProfileResponse, error) {
 	return response, nil
 }
 
+// errProfileModified is returned when `If-Match` no longer matches the stored profile version.
+var errProfileModified = apperror.NewPreconditionFailedError("profile was modified since it was loaded; fetch it again and retry", nil).WithCode(apperror.CodeProfileModified)
+
 // UpdateUserProfile updates a user's profile.
-func (s *UserService) UpdateUserProfile(userID int, req *UpdateUserProfileRequest) (*UserProfileResponse, error) {
+// `ifMatch` lists the profile versions the client based its edit on (from `If-Match`); the update
+// only applies if the stored version is one of them, so an edit made on another device in the
+// meantime isn't silently overwritten. A nil slice (`If-Match: *`) accepts any version.
+func (s *UserService) UpdateUserProfile(ctx context.Context, userID int, ifMatch []int, req *UpdateUserProfileRequest) (*UserProfileResponse, error) {
 	// 1. Check if user exists
 	// Calling `GetUserProfile` serves as an existence check and reuses logic.
-	_, err := s.GetUserProfile(userID) // This also checks for existence
+	current, err := s.GetUserProfile(ctx, userID) // This also checks for existence
 	if err != nil {
 		return nil, err // Will be NotFoundError or InternalServerError
 	}
+	if ifMatch != nil && !slices.Contains(ifMatch, current.Version) {
+		return nil, errProfileModified
+	}
 
 	// 2. Construct the UPDATE query dynamically based on provided fields
 	var setClauses []string
@@ -98,7 +157,9 @@ func (s *UserService) UpdateUserProfile(userID int, req *UpdateUserProfileReques
 
 	// Check if the email field is provided in the request for update.
 	if req.Email != nil && *req.Email != "" {
-		setClauses = append(setClauses, fmt.Sprintf("email = $%d", argID))
+		// A new address has to be verified again.
+		setClauses = append(setClauses, fmt.Sprintf("email = $%d", argID),
+			fmt.Sprintf("email_verified_at = CASE WHEN email = $%d THEN email_verified_at END", argID))
 		args = append(args, *req.Email)
 		argID++
 	}
@@ -111,42 +172,72 @@ func (s *UserService) UpdateUserProfile(userID int, req *UpdateUserProfileReques
 		argID++
 	}
 
+	// The optional profile fields, validated with the rest of the request by the handler, are
+	// appended to the same UPDATE.
+	detailClauses, detailArgs := profileDetailAssignments(&req.ProfileDetails, argID)
+	setClauses = append(setClauses, detailClauses...)
+	args = append(args, detailArgs...)
+	argID += len(detailArgs)
+
 	if len(setClauses) == 0 {
 		// No fields to update, just return current profile
-		return s.GetUserProfile(userID)
+		return s.GetUserProfile(ctx, userID)
 	}
+	setClauses = append(setClauses, "profile_version = profile_version + 1")
 
 	// Add the userID for the WHERE clause.
 	args = append(args, userID) // For the WHERE clause
+	where := fmt.Sprintf("userid = $%d", argID)
+	// Repeat the version check in the UPDATE itself so a concurrent edit between the
+	// check above and this statement is caught as well.
+	if ifMatch != nil {
+		args = append(args, ifMatch)
+		where += fmt.Sprintf(" AND profile_version = ANY($%d)", argID+1)
+	}
 
 	query := fmt.Sprintf(`
 		UPDATE users 
 		SET %s 
-		WHERE userid = $%d
-		RETURNING userid as id, username, email, bio, created_at
-	`, strings.Join(setClauses, ", "), argID)
+		WHERE %s
+		RETURNING userid, username, email, bio, created_at, avatar_urls, reputation,
+		          website, location, pronouns, lojban_level, profile_version
+	`, strings.Join(setClauses, ", "), where)
 
 	// Variables to scan the updated user data into.
 	var updatedUser auth.User
 	var updatedBio sql.NullString
+	var updatedAvatarURLs map[string]string
+	var updatedReputation int
+	var updatedDetails ProfileDetails
+	var updatedVersion int
 
 	// Execute the update query and scan the returned (updated) row.
-	err = s.db.QueryRow(context.Background(), query, args...).Scan(
+	err = s.db.QueryRow(ctx, query, args...).Scan(
 		&updatedUser.ID,
 		&updatedUser.Username,
 		&updatedUser.Email,
 		&updatedBio,
 		&updatedUser.CreatedAt,
+		&updatedAvatarURLs,
+		&updatedReputation,
+		&updatedDetails.Website,
+		&updatedDetails.Location,
+		&updatedDetails.Pronouns,
+		&updatedDetails.LojbanLevel,
+		&updatedVersion,
 	)
 
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errProfileModified
+		}
 		var pgErr *pgconn.PgError
 		// Check for specific PostgreSQL errors, like unique constraint violations.
 		if errors.As(err, &pgErr) {
 			// Check for unique constraint violation on email (assuming constraint name is users_email_key)
 			// You might need to adjust the constraint name based on your actual schema.
 			if pgErr.Code == "23505" && strings.Contains(pgErr.ConstraintName, "email") { // 23505 is unique_violation
-				return nil, apperror.NewConflictError(fmt.Sprintf("email '%s' already exists", *req.Email), nil)
+				return nil, apperror.NewConflictError(fmt.Sprintf("email '%s' already exists", *req.Email), nil).WithCode(apperror.CodeEmailExists)
 			}
 		}
 		return nil, apperror.NewInternalError("Failed to update user profile", err)
@@ -154,14 +245,19 @@ func (s *UserService) UpdateUserProfile(userID int, req *UpdateUserProfileReques
 
 	// Construct and return the `UserProfileResponse` DTO.
 	response := &UserProfileResponse{
-		ID:        updatedUser.ID,
-		Username:  updatedUser.Username,
-		Email:     updatedUser.Email,
-		CreatedAt: updatedUser.CreatedAt,
+		ID:             updatedUser.ID,
+		Username:       updatedUser.Username,
+		Email:          updatedUser.Email,
+		CreatedAt:      updatedUser.CreatedAt,
+		AvatarURLs:     updatedAvatarURLs,
+		Reputation:     updatedReputation,
+		ProfileDetails: updatedDetails,
+		Version:        updatedVersion,
 	}
 	if updatedBio.Valid {
 		response.Bio = &updatedBio.String
 	}
+	s.profileCache.Invalidate(ctx, updatedUser.Username)
 
 	return response, nil
 }
@@ -169,28 +265,13 @@ func (s *UserService) UpdateUserProfile(userID int, req *UpdateUserProfileReques
 // Helper to get the actual user model if needed internally, not exposed.
 // This function might be used by other methods within the `UserService` that need the full user model,
 // including potentially sensitive fields like `HashedPassword`.
-func (s *UserService) getUserModelByID(userID int) (*auth.User, error) {
-	query := `SELECT userid as id, username, email, password as hashed_password, bio, created_at FROM users WHERE id = $1`
-	var user auth.User
-	var bio sql.NullString
-	// Scan all relevant fields, including `HashedPassword`.
-	err := s.db.QueryRow(context.Background(), query, userID).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.HashedPassword, // For internal use if needed, e.g. password checks
-		&bio,
-		&user.CreatedAt,
-	)
+func (s *UserService) getUserModelByID(ctx context.Context, userID int) (*auth.User, error) {
+	user, err := s.accounts.GetByID(ctx, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
 		}
 		return nil, apperror.NewInternalError("Failed to get user model", err)
 	}
-	if bio.Valid {
-		// If you add Bio to auth.User model, assign it here.
-		// For now, UserProfileResponse handles it.
-	}
-	return &user, nil
+	return user, nil
 }
@@ -0,0 +1,117 @@
+// Package users, as part of the user profile management module.
+// This file, `stats.go`, computes per-user contribution statistics: comments posted, reactions
+// received, definitions authored, days active and activity streaks. A day counts as active when
+// the user posted a comment or a definition on it (UTC). Results are cached in memory for a short
+// time (`USER_STATS_CACHE_TTL`) because profile pages request them often and the numbers don't
+// need to be exact to the second.
+package users
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// statsCache is a small TTL cache of computed statistics, keyed by user ID.
+type statsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[int]statsCacheEntry
+}
+
+type statsCacheEntry struct {
+	stats     UserStatsResponse
+	expiresAt time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{ttl: ttl, entries: make(map[int]statsCacheEntry)}
+}
+
+func (c *statsCache) get(userID int) (UserStatsResponse, bool) {
+	if c.ttl <= 0 {
+		return UserStatsResponse{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[userID]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return UserStatsResponse{}, false
+	}
+	return entry.stats, true
+}
+
+func (c *statsCache) put(userID int, stats UserStatsResponse) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	// Drop expired entries on write so the map doesn't grow with every profile ever viewed.
+	for id, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+	c.entries[userID] = statsCacheEntry{stats: stats, expiresAt: now.Add(c.ttl)}
+}
+
+// userStatsQuery computes all statistics in a single round trip. Streaks use the
+// "gaps and islands" technique: for consecutive days, `day - row_number` is constant,
+// so grouping by it yields one row per streak.
+const userStatsQuery = `
+	WITH days AS (
+		SELECT (to_timestamp(time) AT TIME ZONE 'UTC')::date AS day FROM comments WHERE userid = $1
+		UNION
+		SELECT (to_timestamp(time) AT TIME ZONE 'UTC')::date AS day FROM definitions WHERE userid = $1
+	),
+	streaks AS (
+		SELECT MAX(day) AS last_day, COUNT(*) AS length
+		FROM (SELECT day, day - (ROW_NUMBER() OVER (ORDER BY day))::int AS island FROM days) d
+		GROUP BY island
+	)
+	SELECT
+		(SELECT COUNT(*) FROM comments WHERE userid = $1),
+		(SELECT COUNT(*) FROM comment_reactions r JOIN comments c ON c.commentid = r.comment_id WHERE c.userid = $1),
+		(SELECT COUNT(*) FROM definitions WHERE userid = $1),
+		(SELECT COUNT(*) FROM days),
+		(SELECT MAX(day) FROM days),
+		COALESCE((SELECT MAX(length) FROM streaks), 0),
+		/* A streak is still current if the user was active today or yesterday. */
+		COALESCE((SELECT MAX(length) FROM streaks WHERE last_day >= (now() AT TIME ZONE 'UTC')::date - 1), 0)`
+
+// GetUserStats returns the contribution statistics of a user.
+func (s *UserService) GetUserStats(ctx context.Context, userID int) (*UserStatsResponse, error) {
+	if stats, ok := s.statsCache.get(userID); ok {
+		return &stats, nil
+	}
+	if err := s.ensureUserExists(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	stats := UserStatsResponse{UserID: userID}
+	var lastActive *time.Time
+	err := s.db.QueryRow(ctx, userStatsQuery, userID).Scan(
+		&stats.CommentsPosted,
+		&stats.ReactionsReceived,
+		&stats.DefinitionsAuthored,
+		&stats.DaysActive,
+		&lastActive,
+		&stats.LongestStreak,
+		&stats.CurrentStreak,
+	)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to compute user statistics", err)
+	}
+	if lastActive != nil {
+		day := lastActive.Format("2006-01-02")
+		stats.LastActiveDay = &day
+	}
+	stats.ComputedAt = time.Now().UTC()
+
+	s.statsCache.put(userID, stats)
+	return &stats, nil
+}
@@ -0,0 +1,196 @@
+// Package users, as part of the user profile management module.
+// This file, `username.go`, implements username changes. Every change is recorded in the
+// `username_history` table, which serves two purposes:
+//   - old usernames keep resolving (via redirect) to the account's current profile;
+//   - an abandoned username stays reserved for a while, so nobody else can pick it up
+//     and impersonate the previous owner through old links.
+//
+// Changes are rate-limited by `UsersConfig.UsernameChangeCooldown`.
+package users
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/db"
+)
+
+// maxUsernameLength bounds usernames to keep URLs and listings readable.
+const maxUsernameLength = 64
+
+// validateUsername applies the rules for a new username. Usernames appear in profile URLs,
+// so whitespace and slashes are not allowed.
+func validateUsername(username string) error {
+	if username == "" {
+		return apperror.NewValidationError("username must not be empty", nil)
+	}
+	if len([]rune(username)) > maxUsernameLength {
+		return apperror.NewValidationError(fmt.Sprintf("username must be at most %d characters", maxUsernameLength), nil)
+	}
+	for _, r := range username {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == '/' {
+			return apperror.NewValidationError("username must not contain whitespace, control characters or '/'", nil)
+		}
+	}
+	return nil
+}
+
+// ChangeUsername renames the user, subject to the cooldown and to names reserved by other accounts.
+func (s *UserService) ChangeUsername(ctx context.Context, userID int, newUsername string) (*UserProfileResponse, error) {
+	newUsername = strings.TrimSpace(newUsername)
+	if err := validateUsername(newUsername); err != nil {
+		return nil, err
+	}
+
+	var currentUsername string
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		// Lock the user row so two concurrent renames can't both pass the cooldown check.
+		err := tx.QueryRow(ctx, `SELECT username FROM users WHERE userid = $1 FOR UPDATE`, userID).Scan(&currentUsername)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+			}
+			return apperror.NewDatabaseError("failed to load user", err)
+		}
+		if currentUsername == newUsername {
+			return apperror.NewValidationError("new username is the same as the current one", nil)
+		}
+
+		var lastChange sql.NullTime
+		err = tx.QueryRow(ctx, `SELECT MAX(changed_at) FROM username_history WHERE user_id = $1`, userID).Scan(&lastChange)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to check username history", err)
+		}
+		if lastChange.Valid {
+			nextAllowed := lastChange.Time.Add(s.cfg.UsernameChangeCooldown)
+			if time.Now().Before(nextAllowed) {
+				return apperror.NewRateLimitError(
+					fmt.Sprintf("username can be changed again after %s", nextAllowed.UTC().Format(time.RFC3339)), nil).
+					WithCode(apperror.CodeUsernameChangeTooSoon).WithRetryAfter(time.Until(nextAllowed))
+			}
+		}
+
+		// A user may take back their own former name; anyone else has to wait for the hold to expire.
+		var reserved bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM username_history
+				WHERE LOWER(old_username) = LOWER($1) AND user_id <> $2 AND reserved_until > NOW()
+			)`, newUsername, userID).Scan(&reserved)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to check username availability", err)
+		}
+		if reserved {
+			return apperror.NewConflictError(fmt.Sprintf("username '%s' was recently used by another account and is not available yet", newUsername), nil).WithCode(apperror.CodeUsernameOnHold)
+		}
+
+		if _, err := tx.Exec(ctx, `UPDATE users SET username = $1 WHERE userid = $2`, newUsername, userID); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return apperror.NewConflictError(fmt.Sprintf("username '%s' already exists", newUsername), nil).WithCode(apperror.CodeUsernameExists)
+			}
+			return apperror.NewDatabaseError("failed to update username", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO username_history (user_id, old_username, new_username, reserved_until)
+			VALUES ($1, $2, $3, NOW() + $4::interval)`,
+			userID, currentUsername, newUsername, s.cfg.UsernameReuseHold)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to record username change", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The old name now redirects instead of showing the profile.
+	s.profileCache.Invalidate(ctx, currentUsername)
+	return s.GetUserProfile(ctx, userID)
+}
+
+// publicProfileEntry is a public profile as cached, before the privacy settings are applied
+// for a viewer.
+type publicProfileEntry struct {
+	Profile    PublicUserProfileResponse `json:"profile"`
+	Visibility map[string]string         `json:"visibility"`
+}
+
+// UseCache caches public profiles, by username, in `c`. Changes made through this service
+// invalidate them; a reputation change shows once the entry expires.
+func (s *UserService) UseCache(c *cache.Cache) {
+	s.profileCache = c
+}
+
+// invalidatePublicProfile drops the cached public profile of `userID`.
+func (s *UserService) invalidatePublicProfile(ctx context.Context, userID int) {
+	if s.profileCache == nil {
+		return
+	}
+	var username string
+	if err := s.db.QueryRow(ctx, `SELECT username FROM users WHERE userid = $1`, userID).Scan(&username); err == nil {
+		s.profileCache.Invalidate(ctx, username)
+	}
+}
+
+// GetPublicProfileByUsername looks up a profile by username.
+// If the name is no longer in use but belonged to an account in the past, the profile is not
+// returned; instead `currentUsername` holds the name the client should be redirected to.
+// Fields hidden by the owner's privacy settings are removed for `viewerID` (0 = anonymous).
+// Profiles are cached; redirects and unknown names are always looked up.
+func (s *UserService) GetPublicProfileByUsername(ctx context.Context, username string, viewerID int) (profile *PublicUserProfileResponse, currentUsername string, err error) {
+	entry, err := cache.GetOrCompute(ctx, s.profileCache, username, func(ctx context.Context) (*publicProfileEntry, error) {
+		var e publicProfileEntry
+		var bio sql.NullString
+		p := &e.Profile
+		err := s.db.QueryRow(ctx, `
+			SELECT userid, username, realname, bio, avatar_urls, reputation, created_at,
+			       website, location, pronouns, lojban_level, field_visibility
+			FROM users
+			WHERE username = $1`, username).Scan(&p.ID, &p.Username, &p.Realname, &bio, &p.AvatarURLs, &p.Reputation, &p.CreatedAt,
+			&p.Website, &p.Location, &p.Pronouns, &p.LojbanLevel, &e.Visibility)
+		if err != nil {
+			return nil, err
+		}
+		if bio.Valid {
+			p.Bio = &bio.String
+		}
+		return &e, nil
+	})
+	if err == nil {
+		// The entry is shared with concurrent callers and the cache: filter a copy. Privacy
+		// only clears fields, so a shallow copy suffices.
+		p := entry.Profile
+		applyPrivacy(&p, entry.Visibility, viewerID)
+		return &p, "", nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", apperror.NewDatabaseError("failed to get user profile", err)
+	}
+
+	// Not a current username: follow the most recent rename away from it.
+	err = s.db.QueryRow(ctx, `
+		SELECT u.username
+		FROM username_history h
+		JOIN users u ON u.userid = h.user_id
+		WHERE LOWER(h.old_username) = LOWER($1)
+		ORDER BY h.changed_at DESC
+		LIMIT 1`, username).Scan(&currentUsername)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", apperror.NewNotFoundError(fmt.Sprintf("user '%s' not found", username), nil)
+		}
+		return nil, "", apperror.NewDatabaseError("failed to resolve username history", err)
+	}
+	return nil, currentUsername, nil
+}
@@ -0,0 +1,153 @@
+// Package users, as part of the user profile management module.
+// This file, `verification.go`, verifies email addresses. The user asks for a verification
+// email; its link carries a token naming the user, the address and an expiry time, signed with
+// HMAC-SHA256, so nothing has to be stored until the link is used. Posting the link sets
+// `users.email_verified_at`. The address is part of the signature, so a link stops working once
+// the user changes their email, which also clears the verified state (see `UpdateUserProfile`).
+package users
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/email"
+	"github.com/user/lensisku-go/jobs"
+)
+
+// verificationPurpose is mixed into the signature so these tokens can't be reused for other features.
+const verificationPurpose = "email-verification:"
+
+// verificationLifetime is how long a verification link works.
+const verificationLifetime = 48 * time.Hour
+
+// UseEmail lets the service send verification emails through `queue`. Links point to
+// `publicBaseURL` and are signed with `secret`.
+func (s *UserService) UseEmail(queue *jobs.Queue, publicBaseURL, secret string) {
+	s.queue = queue
+	s.publicBaseURL = strings.TrimRight(publicBaseURL, "/")
+	s.verificationSecret = []byte(secret)
+}
+
+// verificationToken returns "<userID>.<expiry as Unix time>.<signature>".
+func (s *UserService) verificationToken(userID int, address string, expires int64) string {
+	payload := strconv.Itoa(userID) + "." + strconv.FormatInt(expires, 10)
+	mac := hmac.New(sha256.New, s.verificationSecret)
+	mac.Write([]byte(verificationPurpose + payload + "." + address))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseVerificationToken returns the user ID and expiry of a well-formed token. The signature
+// can only be checked against the user's current address.
+func parseVerificationToken(token string) (userID int, expires int64, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, 0, false
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil || userID <= 0 {
+		return 0, 0, false
+	}
+	expires, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return userID, expires, true
+}
+
+// errInvalidVerificationToken is returned for a token that isn't one of ours, or was issued for
+// another address.
+var errInvalidVerificationToken = apperror.NewBadRequestError("invalid email verification link", nil)
+
+// CheckVerificationToken reports whether `token` is a valid, unexpired verification token for
+// the current address of its user.
+func (s *UserService) CheckVerificationToken(ctx context.Context, token string) error {
+	_, _, err := s.checkVerificationToken(ctx, token)
+	return err
+}
+
+func (s *UserService) checkVerificationToken(ctx context.Context, token string) (int, string, error) {
+	userID, expires, ok := parseVerificationToken(token)
+	if !ok {
+		return 0, "", errInvalidVerificationToken
+	}
+	var address string
+	err := s.db.QueryRow(ctx, `SELECT email FROM users WHERE userid = $1`, userID).Scan(&address)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, "", errInvalidVerificationToken
+		}
+		return 0, "", apperror.NewDatabaseError("failed to load user", err)
+	}
+	if address == "" || !hmac.Equal([]byte(token), []byte(s.verificationToken(userID, address, expires))) {
+		return 0, "", errInvalidVerificationToken
+	}
+	if time.Now().Unix() > expires {
+		return 0, "", apperror.NewBadRequestError("this email verification link has expired; ask for a new one", nil)
+	}
+	return userID, address, nil
+}
+
+// SendVerificationEmail queues an email with a verification link to the user's address.
+func (s *UserService) SendVerificationEmail(ctx context.Context, userID int) (*EmailVerificationResponse, error) {
+	if s.queue == nil {
+		return nil, apperror.NewInternalError("email verification is not configured", nil)
+	}
+	var username, address string
+	var verifiedAt *time.Time
+	err := s.db.QueryRow(ctx, `SELECT username, email, email_verified_at FROM users WHERE userid = $1`, userID).
+		Scan(&username, &address, &verifiedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.NewNotFoundError(fmt.Sprintf("user with ID %d not found", userID), nil)
+		}
+		return nil, apperror.NewDatabaseError("failed to load user", err)
+	}
+	if address == "" {
+		return nil, apperror.NewBadRequestError("the account has no email address", nil)
+	}
+	if verifiedAt != nil {
+		return nil, apperror.NewConflictError("the email address is already verified", nil)
+	}
+
+	expiresAt := time.Now().Add(verificationLifetime).Truncate(time.Second)
+	token := s.verificationToken(userID, address, expiresAt.Unix())
+	data := email.VerificationData{
+		Username:  username,
+		VerifyURL: s.publicBaseURL + "/users/email/verify?token=" + url.QueryEscape(token),
+	}
+	if _, err := email.EnqueueTemplate(ctx, s.queue, email.TemplateVerification, address, data); err != nil {
+		return nil, apperror.NewInternalError("failed to queue the verification email", err)
+	}
+	return &EmailVerificationResponse{Email: address, ExpiresAt: expiresAt}, nil
+}
+
+// VerifyEmail marks the address a verification token was issued for as verified. Using a link
+// twice is harmless; the first verification time is kept.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	userID, address, err := s.checkVerificationToken(ctx, token)
+	if err != nil {
+		return err
+	}
+	// The address is checked again in case it changed since the token was checked.
+	tag, err := s.db.Exec(ctx, `
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW())
+		WHERE userid = $1 AND email = $2`, userID, address)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to verify email address", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errInvalidVerificationToken
+	}
+	return nil
+}
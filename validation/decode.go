@@ -0,0 +1,228 @@
+// Package validation, as part of the request validation module.
+// This file, `decode.go`, decodes request bodies and query strings into DTOs and validates
+// them. A value of the wrong type is reported as an invalid field, like a broken rule.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// DecodeJSON decodes the JSON body of `r` into `dst`, a pointer to a struct, and validates it.
+// Unknown members are ignored.
+func DecodeJSON(r *http.Request, dst any) error {
+	return decodeJSON(json.NewDecoder(r.Body), dst)
+}
+
+// DecodeStrictJSON is DecodeJSON, except that unknown members are an error.
+func DecodeStrictJSON(r *http.Request, dst any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decodeJSON(decoder, dst)
+}
+
+func decodeJSON(decoder *json.Decoder, dst any) error {
+	if err := decoder.Decode(dst); err != nil {
+		if tooLarge := apperror.FromMaxBytesError(err); tooLarge != nil {
+			return tooLarge
+		}
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			field := jsonPath(typeErr.Field)
+			return apperror.NewFieldsError([]apperror.FieldError{{
+				Field:   field,
+				Rule:    "type",
+				Message: fmt.Sprintf("%s must be %s", field, typeName(typeErr.Type)),
+			}})
+		case errors.Is(err, io.EOF):
+			return apperror.NewBadRequestError("request body is required", err)
+		default:
+			return apperror.NewBadRequestError("invalid request body: "+err.Error(), err)
+		}
+	}
+	return Struct(dst)
+}
+
+// DecodeQuery fills the fields of `dst`, a pointer to a struct, from the query parameters of
+// `r` named in their `form` tags, and validates it. Fields may be strings, booleans, integers
+// or times (RFC 3339), pointers to those, or slices of those, which take comma-separated
+// or repeated parameters. The fields of embedded structs, such as Pagination, are decoded too.
+//
+// Two more tags shape the values before they are validated:
+//   - `default:"20"` is the value of a field whose parameter is absent or empty; without it
+//     the field keeps its value, so defaults can also be set beforehand;
+//   - `cap:"100"` lowers an integer above it to it, so clients asking for too much get as
+//     much as allowed rather than an error.
+func DecodeQuery(r *http.Request, dst any) error {
+	var fields []apperror.FieldError
+	decodeQuery(r.URL.Query(), reflect.ValueOf(dst).Elem(), &fields)
+	if len(fields) > 0 {
+		return apperror.NewFieldsError(fields)
+	}
+	return Struct(dst)
+}
+
+func decodeQuery(params url.Values, v reflect.Value, fields *[]apperror.FieldError) {
+	for i := 0; i < v.NumField(); i++ {
+		sf, f := v.Type().Field(i), v.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			decodeQuery(params, f, fields)
+			if resolver, ok := f.Addr().Interface().(queryResolver); ok {
+				resolver.resolveQuery(fields)
+			}
+			continue
+		}
+		name := sf.Tag.Get("form")
+		if name == "" {
+			continue
+		}
+		value := strings.Join(params[name], ",")
+		if strings.Trim(value, ",") == "" {
+			if def, ok := sf.Tag.Lookup("default"); ok {
+				if err := setValue(f, def); err != nil {
+					panic(fmt.Sprintf("validation: invalid default %q of %s: %v", def, sf.Name, err))
+				}
+			}
+			continue
+		}
+		if err := setValue(f, value); err != nil {
+			*fields = append(*fields, apperror.FieldError{
+				Field:   name,
+				Rule:    "type",
+				Message: fmt.Sprintf("%s must be %s", name, typeName(f.Type())),
+			})
+			continue
+		}
+		if c, ok := sf.Tag.Lookup("cap"); ok {
+			capValue(f, c)
+		}
+	}
+}
+
+// queryResolver is an embedded query struct with fields that depend on each other, such as
+// Pagination with its cursor. resolveQuery runs once the struct is decoded.
+type queryResolver interface {
+	resolveQuery(fields *[]apperror.FieldError)
+}
+
+// capValue lowers the integer in `f` to `c` if it is above.
+func capValue(f reflect.Value, c string) {
+	if f.Kind() == reflect.Pointer {
+		f = f.Elem()
+	}
+	limit, err := strconv.ParseInt(c, 10, 64)
+	if err != nil || !f.CanInt() {
+		panic(fmt.Sprintf("validation: cap %q on a field of type %s", c, f.Type()))
+	}
+	if f.Int() > limit {
+		f.SetInt(limit)
+	}
+}
+
+// jsonPath writes the path of a JSON member, "content.0.type" for the decoder, as validation
+// errors do: "content[0].type".
+func jsonPath(field string) string {
+	parts := strings.Split(field, ".")
+	path := parts[:1]
+	for _, part := range parts[1:] {
+		if _, err := strconv.Atoi(part); err == nil {
+			path[len(path)-1] += "[" + part + "]"
+		} else {
+			path = append(path, part)
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// setValue parses `s` into the field `f`.
+func setValue(f reflect.Value, s string) error {
+	if f.Kind() == reflect.Pointer {
+		p := reflect.New(f.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	if f.Kind() == reflect.Slice {
+		var parts []string
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		slice := reflect.MakeSlice(f.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setValue(slice.Index(i), part); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+		return nil
+	}
+	if f.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	default:
+		panic(fmt.Sprintf("validation: unsupported query field type %s", f.Type()))
+	}
+	return nil
+}
+
+// typeName describes the values of a type for people, e.g. "an integer".
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return "an RFC 3339 time, e.g. 2024-05-01T00:00:00Z"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,138 @@
+// Package validation, as part of the request validation module.
+// This file, `pagination.go`, holds the pagination parameters shared by the list endpoints and
+// the page they answer with. A page carries its position both ways clients may follow it: a
+// `next_cursor` to pass back as `cursor`, and RFC 5988 `Link` headers to the first, previous,
+// next and last pages.
+package validation
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/render"
+)
+
+// maxPerPage is the `cap` of `per_page`, which a cursor mustn't exceed either.
+const maxPerPage = 100
+
+// Pagination is the `page` and `per_page` query parameters of a list endpoint. Embedded in a
+// query struct, it is decoded with it by DecodeQuery: `page` defaults to 1 and `per_page` to
+// 20, and a larger `per_page` than 100 is lowered to 100. A `cursor` from a previous page
+// stands for both and takes precedence over them.
+type Pagination struct {
+	Page    int64  `json:"page" form:"page" default:"1" validate:"min=1"`
+	PerPage int64  `json:"per_page" form:"per_page" default:"20" cap:"100" validate:"min=1"`
+	Cursor  string `json:"cursor,omitempty" form:"cursor"`
+}
+
+// Offset is the number of items before the page.
+func (p Pagination) Offset() int64 {
+	return (p.Page - 1) * p.PerPage
+}
+
+// resolveQuery replaces the page and page size with those of the cursor, if there is one.
+func (p *Pagination) resolveQuery(fields *[]apperror.FieldError) {
+	if p.Cursor == "" {
+		return
+	}
+	page, perPage, ok := decodeCursor(p.Cursor)
+	if !ok || perPage > maxPerPage {
+		*fields = append(*fields, apperror.FieldError{
+			Field:   "cursor",
+			Rule:    "cursor",
+			Message: "cursor must be a next_cursor of a previous page",
+		})
+		return
+	}
+	p.Page, p.PerPage = page, perPage
+}
+
+// encodeCursor makes the opaque cursor of a page. Clients must not build cursors themselves,
+// so their format may change; for now it is just the page position.
+func encodeCursor(page, perPage int64) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d", page, perPage))
+}
+
+func decodeCursor(cursor string) (page, perPage int64, ok bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, false
+	}
+	pageStr, perPageStr, found := strings.Cut(string(data), ":")
+	if !found {
+		return 0, 0, false
+	}
+	page, err1 := strconv.ParseInt(pageStr, 10, 64)
+	perPage, err2 := strconv.ParseInt(perPageStr, 10, 64)
+	if err1 != nil || err2 != nil || page < 1 || perPage < 1 {
+		return 0, 0, false
+	}
+	return page, perPage, true
+}
+
+// Page is one page of a list endpoint's items, in the same envelope for every list.
+// @Description A page of items
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Number of items on all pages
+	// example: 42
+	Total int64 `json:"total"`
+	// example: 1
+	Page int64 `json:"page"`
+	// example: 20
+	PerPage int64 `json:"per_page"`
+	// Pass as `cursor` to get the next page; absent on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewPage makes the page of `items` at the position `p` of a list of `total` items.
+func NewPage[T any](items []T, total int64, p Pagination) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	page := &Page[T]{Items: items, Total: total, Page: p.Page, PerPage: p.PerPage}
+	if page.hasNext() {
+		page.NextCursor = encodeCursor(p.Page+1, p.PerPage)
+	}
+	return page
+}
+
+func (p *Page[T]) hasNext() bool {
+	return p.Page*p.PerPage < p.Total
+}
+
+// lastPage is the number of the last page, 1 for an empty list.
+func (p *Page[T]) lastPage() int64 {
+	return max(1, (p.Total+p.PerPage-1)/p.PerPage)
+}
+
+// WritePage writes `page` as the response to `r`, with a `Link` header to its
+// neighbours. The links repeat the request's other query parameters.
+func WritePage[T any](w http.ResponseWriter, r *http.Request, page *Page[T]) {
+	links := []string{pageLink(r, 1, page.PerPage, "first")}
+	if page.Page > 1 {
+		links = append(links, pageLink(r, min(page.Page-1, page.lastPage()), page.PerPage, "prev"))
+	}
+	if page.hasNext() {
+		links = append(links, pageLink(r, page.Page+1, page.PerPage, "next"))
+	}
+	links = append(links, pageLink(r, page.lastPage(), page.PerPage, "last"))
+	w.Header().Set("Link", strings.Join(links, ", "))
+
+	render.Write(w, r, http.StatusOK, page)
+}
+
+// pageLink is a link to the page `page` of the list `r` requested, relative to the host.
+func pageLink(r *http.Request, page, perPage int64, rel string) string {
+	query := r.URL.Query()
+	query.Del("cursor")
+	query.Set("page", strconv.FormatInt(page, 10))
+	query.Set("per_page", strconv.FormatInt(perPage, 10))
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+}
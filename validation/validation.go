@@ -0,0 +1,148 @@
+// Package validation checks request DTOs against the rules in their `validate` struct tags,
+// using go-playground/validator, and decodes JSON bodies and query strings into them (see
+// `decode.go`). Handlers call DecodeJSON or DecodeQuery instead of checking fields one by one,
+// so every invalid request gets the same 400 response, listing all the invalid fields at once:
+//
+//	{"error": "email is required; username must be at most 64 characters",
+//	 "code": "VALIDATION_FAILED",
+//	 "fields": [{"field": "email", "rule": "required", "message": "email is required"}, ...]}
+//
+// Fields are named as clients see them, by their `json` key or, for query structs, their
+// `form` parameter. Rules that need the database, such as unknown languages or taken
+// usernames, stay in the services.
+//
+// Besides the rules of the validator, `username` rejects whitespace, control characters and '/'.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// embedded names the embedded structs in the validator's namespaces. Their fields are at the
+// top level of the JSON objects, so they don't appear in field paths.
+const embedded = "-"
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(fieldName)
+	if err := v.RegisterValidation("username", isUsername); err != nil {
+		panic(err) // Only for an invalid tag name
+	}
+	return v
+}
+
+// Struct checks `v`, a struct or a pointer to one, against its `validate` tags. It returns a
+// ValidationError listing the invalid fields, or nil. Other values, such as the maps of patch
+// requests, have no tags to check.
+func Struct(v any) error {
+	if reflect.Indirect(reflect.ValueOf(v)).Kind() != reflect.Struct {
+		return nil
+	}
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		return apperror.NewInternalError("failed to validate request", err)
+	}
+	fields := make([]apperror.FieldError, len(invalid))
+	for i, fe := range invalid {
+		path := fieldPath(fe.Namespace())
+		rule, param := ruleOf(fe)
+		fields[i] = apperror.FieldError{Field: path, Rule: rule, Message: message(path, rule, param, fe.Kind())}
+	}
+	return apperror.NewFieldsError(fields)
+}
+
+// fieldName names a struct field after its JSON key or query parameter.
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	if f.Anonymous {
+		return embedded
+	}
+	return f.Name
+}
+
+// fieldPath turns a namespace such as "NewCommentRequest.content[0].type" into the path of the
+// field in the request, "content[0].type".
+func fieldPath(namespace string) string {
+	parts := strings.Split(namespace, ".")[1:] // The first part is the type of the struct
+	path := parts[:0]
+	for _, part := range parts {
+		if part != embedded {
+			path = append(path, part)
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+// ruleOf returns the rule a field breaks and its parameter. A choice of rules, such as
+// `http_url|len=0` for an optional field that an empty string clears, is named after its
+// first rule.
+func ruleOf(fe validator.FieldError) (rule, param string) {
+	if first, _, ok := strings.Cut(fe.Tag(), "|"); ok {
+		rule, param, _ = strings.Cut(first, "=")
+		return rule, param
+	}
+	return fe.Tag(), fe.Param()
+}
+
+// message describes a broken rule for people, e.g. "website must be at most 200 characters".
+func message(field, rule, param string, kind reflect.Kind) string {
+	unit := ""
+	switch kind {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	}
+	if param == "1" {
+		unit = strings.TrimSuffix(unit, "s")
+	}
+	switch rule {
+	case "required":
+		return field + " is required"
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s%s", field, param, unit)
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s%s", field, param, unit)
+	case "gt":
+		return fmt.Sprintf("%s must be more than %s%s", field, param, unit)
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s%s", field, param, unit)
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s%s", field, param, unit)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(param, " ", ", "))
+	case "email":
+		return field + " must be a valid email address"
+	case "http_url":
+		return field + " must be an absolute http(s) URL"
+	case "username":
+		return field + " must not contain whitespace, control characters or '/'"
+	default:
+		return fmt.Sprintf("%s is invalid (%s)", field, rule)
+	}
+}
+
+// isUsername applies the `username` rule. Usernames appear in profile URLs.
+func isUsername(fl validator.FieldLevel) bool {
+	return !strings.ContainsFunc(fl.Field().String(), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r) || r == '/'
+	})
+}
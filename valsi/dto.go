@@ -0,0 +1,114 @@
+// Package valsi, as part of the dictionary module.
+// This file, `dto.go`, defines the response bodies of the dictionary lookup API.
+package valsi
+
+import "github.com/user/lensisku-go/validation"
+
+// Search modes, chosen with the `mode` query parameter.
+const (
+	// ModeAll combines the other modes: exact hits first, then gloss hits, then fuzzy hits.
+	ModeAll = "all"
+	// ModeExact looks the query up as a Lojban word.
+	ModeExact = "exact"
+	// ModeGloss finds the words whose definitions have a matching gloss or place keyword.
+	ModeGloss = "gloss"
+	// ModeFuzzy finds Lojban words spelled like the query.
+	ModeFuzzy = "fuzzy"
+)
+
+// SearchQuery is a dictionary lookup.
+type SearchQuery struct {
+	Query string `form:"q" validate:"required"`
+	// One of the Mode constants; ModeAll if empty
+	Mode string `form:"mode" validate:"omitempty,oneof=all exact gloss fuzzy"`
+	// Language tag; restricts results to words defined in that language
+	Language string `form:"language"`
+	validation.Pagination
+}
+
+// SimilarQuery narrows the words similar to a word.
+type SimilarQuery struct {
+	// Language tag; only definitions in this language are compared
+	Language string `form:"language"`
+	Limit    int    `form:"limit" default:"10" cap:"50" validate:"min=1"`
+}
+
+// SearchResult is one word found by a dictionary lookup.
+// @Description A Lojban word matching a dictionary lookup
+type SearchResult struct {
+	// example: 678
+	ValsiID int32 `json:"valsi_id"`
+	// example: "klama"
+	Word string `json:"word"`
+	// Word type, e.g. gismu or lujvo
+	// example: "gismu"
+	Type string `json:"type"`
+	// example: "kla"
+	Rafsi *string `json:"rafsi,omitempty"`
+	// How the word matched: exact, gloss or fuzzy
+	// example: "exact"
+	Match string `json:"match"`
+	// Trigram similarity between the query and the matched text (0..1); 1 for exact hits
+	// example: 1
+	Score float32 `json:"score"`
+	// The word's first definition in the requested language (English if none was requested,
+	// or any language if it has no English definition)
+	DefinitionID *int32  `json:"definition_id,omitempty"`
+	Definition   *string `json:"definition,omitempty"`
+	// example: "en"
+	Language *string `json:"language,omitempty"`
+}
+
+// WordOfTheDayResponse is the word of the day.
+// @Description The word of the day, with its first definition in the requested language
+type WordOfTheDayResponse struct {
+	// The UTC day the word was picked for
+	// example: "2024-05-01"
+	Date string `json:"date"`
+	// example: 678
+	ValsiID int32 `json:"valsi_id"`
+	// example: "klama"
+	Word string `json:"word"`
+	// example: "gismu"
+	Type string `json:"type"`
+	// example: "kla"
+	Rafsi *string `json:"rafsi,omitempty"`
+	// example: 5530
+	DefinitionID int32  `json:"definition_id"`
+	Definition   string `json:"definition"`
+	// example: "en"
+	Language string `json:"language"`
+}
+
+// SimilarWord is a word close in meaning to another.
+// @Description A word whose definitions are semantically close to another word's
+type SimilarWord struct {
+	// example: 1021
+	ValsiID int32 `json:"valsi_id"`
+	// example: "litru"
+	Word string `json:"word"`
+	// example: "gismu"
+	Type string `json:"type"`
+	// example: "lit"
+	Rafsi *string `json:"rafsi,omitempty"`
+	// Cosine similarity of the closest pair of definitions (-1..1, higher is closer)
+	// example: 0.83
+	Similarity float32 `json:"similarity"`
+	// The definition of this word that matched
+	// example: 5530
+	DefinitionID int32  `json:"definition_id"`
+	Definition   string `json:"definition"`
+	// example: "en"
+	Language string `json:"language"`
+}
+
+// SimilarResponse lists the words closest in meaning to a word.
+// @Description Words semantically close to a word, most similar first
+type SimilarResponse struct {
+	// example: 678
+	ValsiID int32 `json:"valsi_id"`
+	// example: "klama"
+	Word string `json:"word"`
+	// Empty while the word's definitions haven't been embedded
+	Results []SimilarWord `json:"results"`
+}
@@ -0,0 +1,118 @@
+// Package valsi encapsulates looking up Lojban words (valsi) in the dictionary.
+// This file, `handlers.go`, serves word search, the word of the day and the words similar in
+// meaning to a word, all under /api/v1/valsi.
+package valsi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// ValsiHandlers provides HTTP handlers for dictionary lookups.
+type ValsiHandlers struct {
+	service *ValsiService
+}
+
+// NewValsiHandlers creates new ValsiHandlers.
+func NewValsiHandlers(service *ValsiService) *ValsiHandlers {
+	return &ValsiHandlers{service: service}
+}
+
+// HandleSearch godoc
+// @Summary Look up words in the dictionary
+// @Description Finds Lojban words by exact spelling, by a gloss or place keyword of their definitions (prefix match), or by similar spelling (trigram similarity). In mode `all` a word found several ways is listed once under its best match; exact hits come first, then gloss hits, then fuzzy hits.
+// @Tags valsi
+// @Produce json
+// @Param q query string true "Search text"
+// @Param mode query string false "all (default), exact, gloss or fuzzy"
+// @Param language query string false "Language tag, e.g. en; only words defined in this language are returned"
+// @Param page query int false "Page number (default 1)"
+// @Param per_page query int false "Items per page (default 20, max 100)"
+// @Param cursor query string false "next_cursor of the previous page, instead of page and per_page"
+// @Success 200 {object} validation.Page[SearchResult] "Matches, best first"
+// @Header 200 {string} Link "Links to the first, previous, next and last pages"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing or invalid query"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/valsi/search [get]
+func (h *ValsiHandlers) HandleSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var q SearchQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		results, err := h.service.Search(r.Context(), q)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		validation.WritePage(w, r, results)
+	}
+}
+
+// HandleWordOfTheDay godoc
+// @Summary Get the word of the day
+// @Description Returns the word of the day, the same for everyone during a UTC day, with its first definition in the requested language. Only words defined in that language are picked.
+// @Tags valsi
+// @Produce json
+// @Param language query string false "Language tag (default en)"
+// @Success 200 {object} WordOfTheDayResponse "Today's word"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - No words are defined in the language"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/valsi/word-of-the-day [get]
+func (h *ValsiHandlers) HandleWordOfTheDay() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wotd, err := h.service.WordOfTheDay(r.Context(), r.URL.Query().Get("language"))
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, wotd)
+	}
+}
+
+// HandleSimilar godoc
+// @Summary Find words similar in meaning
+// @Description Returns the words whose definitions are semantically closest to the word's, compared through definition embeddings; each word is ranked by its closest definition, which is returned with it. A word whose definitions haven't been embedded yet has no similar words.
+// @Tags valsi
+// @Produce json
+// @Param valsiID path int true "Word ID"
+// @Param language query string false "Language tag, e.g. en; only definitions in this language are compared"
+// @Param limit query int false "Number of words (default 10, max 50)"
+// @Success 200 {object} SimilarResponse "Similar words, most similar first"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid word ID or limit"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - Word not found"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/valsi/{valsiID}/similar [get]
+func (h *ValsiHandlers) HandleSimilar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		valsiID, err := strconv.ParseInt(chi.URLParam(r, "valsiID"), 10, 32)
+		if err != nil || valsiID <= 0 {
+			auth.WriteError(w, r, apperror.NewBadRequestError("invalid word ID", err))
+			return
+		}
+		var q SimilarQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		similar, err := h.service.Similar(r.Context(), int32(valsiID), q.Language, q.Limit)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusOK, similar)
+	}
+}
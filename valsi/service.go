@@ -0,0 +1,121 @@
+// Package valsi, as part of the dictionary module.
+// This file, `service.go`, implements the dictionary lookup. A query is tried three ways:
+// as a Lojban word (exact), as a gloss or place keyword of a definition (matched by prefix
+// through `natlangwords` and `keywordmapping`), and as a misspelled Lojban word (pg_trgm
+// similarity). A word found several ways is listed once, under its best match.
+package valsi
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/cache"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/validation"
+)
+
+// maxQueryLength bounds the search input; longer strings make trigram matching expensive.
+const maxQueryLength = 100
+
+// ValsiService provides the dictionary lookup API.
+// It reads through the app pool, or a db.DB reading from a replica.
+type ValsiService struct {
+	db db.Querier
+	// `wotdCache` keeps the word of the day (see wotd.go); nil computes it on every request.
+	wotdCache *cache.Cache
+}
+
+// NewValsiService creates a new ValsiService.
+func NewValsiService(reader db.Querier) *ValsiService {
+	return &ValsiService{db: reader}
+}
+
+// searchMatches and searchFrom wrap the select list shared by the count and the page of a
+// search. $1 = query, $2 = prefix pattern, $3 = language tag (empty for any), $4 = mode.
+const searchMatches = `
+	WITH matches AS (
+		SELECT v.valsiid, 'exact' AS match, 1::real AS score, 0 AS rank
+		FROM valsi v
+		WHERE $4 IN ('all', 'exact') AND v.word = $1
+		UNION ALL
+		SELECT d.valsiid, 'gloss', similarity(n.word, $1), 1
+		FROM natlangwords n
+		JOIN languages l ON l.langid = n.langid
+		JOIN keywordmapping k ON k.natlangwordid = n.wordid
+		JOIN definitions d ON d.definitionid = k.definitionid
+		WHERE $4 IN ('all', 'gloss') AND n.word ILIKE $2
+		  AND ($3 = '' OR lower(l.tag) = lower($3))
+		UNION ALL
+		SELECT v.valsiid, 'fuzzy', similarity(v.word, $1), 2
+		FROM valsi v
+		WHERE $4 IN ('all', 'fuzzy') AND v.word % $1
+	),
+	best AS (
+		SELECT DISTINCT ON (valsiid) valsiid, match, score, rank
+		FROM matches
+		ORDER BY valsiid, rank, score DESC
+	)
+	SELECT `
+
+const searchFrom = `
+	FROM best b
+	JOIN valsi v ON v.valsiid = b.valsiid
+	LEFT JOIN valsitypes t ON t.typeid = v.typeid
+	LEFT JOIN LATERAL (
+		SELECT d.definitionid, d.definition, l.tag
+		FROM definitions d
+		JOIN languages l ON l.langid = d.langid
+		WHERE d.valsiid = v.valsiid AND ($3 = '' OR lower(l.tag) = lower($3))
+		ORDER BY (lower(l.tag) = 'en') DESC, l.langid, d.definitionnum, d.definitionid
+		LIMIT 1
+	) def ON TRUE
+	WHERE $3 = '' OR def.definitionid IS NOT NULL`
+
+// Search looks a query up in the dictionary. Exact hits come first, then gloss hits, then
+// fuzzy hits, each by descending similarity.
+func (s *ValsiService) Search(ctx context.Context, q SearchQuery) (*validation.Page[SearchResult], error) {
+	query := strings.TrimSpace(q.Query)
+	if query == "" {
+		return nil, apperror.NewValidationError("search query must not be empty", nil)
+	}
+	if utf8.RuneCountInString(query) > maxQueryLength {
+		return nil, apperror.NewValidationError("search query is too long", nil)
+	}
+	mode := q.Mode
+	if mode == "" {
+		mode = ModeAll
+	}
+	prefix := db.EscapeLike(query) + "%"
+	language := strings.TrimSpace(q.Language)
+
+	var total int64
+	err := s.db.QueryRow(ctx, searchMatches+"COUNT(*)"+searchFrom, query, prefix, language, mode).Scan(&total)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to count search results", err)
+	}
+
+	rows, err := s.db.Query(ctx, searchMatches+`
+		v.valsiid, v.word, COALESCE(t.descriptor, ''), v.rafsi, b.match, b.score,
+		def.definitionid, def.definition, def.tag`+searchFrom+`
+		ORDER BY b.rank, b.score DESC, v.word
+		LIMIT $5 OFFSET $6`, query, prefix, language, mode, q.PerPage, q.Offset())
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to search words", err)
+	}
+	defer rows.Close()
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.ValsiID, &r.Word, &r.Type, &r.Rafsi, &r.Match, &r.Score,
+			&r.DefinitionID, &r.Definition, &r.Language); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read search result", err)
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to search words", err)
+	}
+	return validation.NewPage(results, total, q.Pagination), nil
+}
@@ -0,0 +1,102 @@
+// Package valsi, as part of the dictionary module.
+// This file, `similar.go`, finds the words closest in meaning to a word, for "related words"
+// in the UI. Words are compared through their definitions' embeddings (computed by the
+// background embedding calculator): each definition of the word is matched with its nearest
+// definitions of other words, and a word ranks by its closest definition. The search runs on
+// the nearest-neighbour index of the model (see background/embedding_index.go), so the vectors
+// are cast to the model's dimension as the index is.
+package valsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+)
+
+// similarCandidates is how many nearest definitions are read per definition of the word, as a
+// multiple of the limit; several of them may belong to the same word.
+const similarCandidates = 4
+
+// Similar returns up to `limit` words whose definitions are closest to the word's, most
+// similar first. With a language tag, only definitions in that language are compared. A word
+// without embedded definitions has no similar words, so the result is empty rather than an
+// error. Only vectors of the same model are compared: that of the word's most recently
+// embedded definition.
+func (s *ValsiService) Similar(ctx context.Context, valsiID int32, language string, limit int) (*SimilarResponse, error) {
+	language = strings.TrimSpace(language)
+	resp := &SimilarResponse{ValsiID: valsiID, Results: []SimilarWord{}}
+	err := s.db.QueryRow(ctx, `SELECT word FROM valsi WHERE valsiid = $1`, valsiID).Scan(&resp.Word)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apperror.NewNotFoundError(fmt.Sprintf("word with ID %d not found", valsiID), nil)
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to look up word", err)
+	}
+
+	var model string
+	var dims int
+	err = s.db.QueryRow(ctx, `
+		SELECT embedding_model, vector_dims(embedding)
+		FROM definitions
+		WHERE valsiid = $1 AND embedding IS NOT NULL AND embedding_model IS NOT NULL
+		ORDER BY embedding_updated_at DESC NULLS LAST
+		LIMIT 1`, valsiID).Scan(&model, &dims)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return resp, nil
+	}
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to find similar words", err)
+	}
+
+	// The dimension can't be a parameter; it is a number read from the database.
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+		WITH src AS (
+			SELECT d.embedding::vector(%[1]d) AS embedding
+			FROM definitions d
+			JOIN languages l ON l.langid = d.langid
+			WHERE d.valsiid = $1 AND d.embedding IS NOT NULL AND d.embedding_model = $5
+			  AND ($2 = '' OR lower(l.tag) = lower($2))
+		),
+		nearest AS (
+			SELECT DISTINCT ON (n.valsiid) n.valsiid, n.definitionid, n.definition, n.tag, n.distance
+			FROM src
+			CROSS JOIN LATERAL (
+				SELECT c.valsiid, c.definitionid, c.definition, l.tag, c.embedding::vector(%[1]d) <=> src.embedding AS distance
+				FROM definitions c
+				JOIN languages l ON l.langid = c.langid
+				WHERE c.valsiid <> $1 AND c.embedding IS NOT NULL AND c.embedding_model = $5
+				  AND ($2 = '' OR lower(l.tag) = lower($2))
+				ORDER BY c.embedding::vector(%[1]d) <=> src.embedding
+				LIMIT $3::int * $4::int
+			) n
+			ORDER BY n.valsiid, n.distance
+		)
+		SELECT v.valsiid, v.word, COALESCE(t.descriptor, ''), v.rafsi, (1 - n.distance)::real,
+		       n.definitionid, n.definition, n.tag
+		FROM nearest n
+		JOIN valsi v ON v.valsiid = n.valsiid
+		LEFT JOIN valsitypes t ON t.typeid = v.typeid
+		ORDER BY n.distance, v.word
+		LIMIT $3`, dims), valsiID, language, limit, similarCandidates, model)
+	if err != nil {
+		return nil, apperror.NewDatabaseError("failed to find similar words", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var w SimilarWord
+		if err := rows.Scan(&w.ValsiID, &w.Word, &w.Type, &w.Rafsi, &w.Similarity,
+			&w.DefinitionID, &w.Definition, &w.Language); err != nil {
+			return nil, apperror.NewDatabaseError("failed to read similar word", err)
+		}
+		resp.Results = append(resp.Results, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apperror.NewDatabaseError("failed to find similar words", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,66 @@
+// Package valsi, as part of the dictionary module.
+// This file, `wotd.go`, picks the word of the day: a word with a definition in the requested
+// language, chosen by hashing the date with each word's ID, so every instance picks the same
+// word all day and a different one the next (UTC). Picking hashes every word, so the result is
+// cached (see `cache/cache.go`).
+package valsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/cache"
+)
+
+// UseCache caches the word of the day in `c`.
+func (s *ValsiService) UseCache(c *cache.Cache) {
+	s.wotdCache = c
+}
+
+// WordOfTheDay returns today's word and its first definition in `language` (English if empty).
+func (s *ValsiService) WordOfTheDay(ctx context.Context, language string) (*WordOfTheDayResponse, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		language = "en"
+	}
+	date := time.Now().UTC().Format(time.DateOnly)
+	return cache.GetOrCompute(ctx, s.wotdCache, date+":"+language, func(ctx context.Context) (*WordOfTheDayResponse, error) {
+		wotd := &WordOfTheDayResponse{Date: date}
+		err := s.db.QueryRow(ctx, `
+			WITH pick AS (
+				SELECT v.valsiid
+				FROM valsi v
+				WHERE EXISTS (
+					SELECT 1 FROM definitions d JOIN languages l ON l.langid = d.langid
+					WHERE d.valsiid = v.valsiid AND lower(l.tag) = $2)
+				ORDER BY md5($1 || ':' || v.valsiid), v.valsiid
+				LIMIT 1
+			)
+			SELECT v.valsiid, v.word, COALESCE(t.descriptor, ''), v.rafsi, def.definitionid, def.definition, def.tag
+			FROM pick
+			JOIN valsi v ON v.valsiid = pick.valsiid
+			LEFT JOIN valsitypes t ON t.typeid = v.typeid
+			JOIN LATERAL (
+				SELECT d.definitionid, d.definition, l.tag
+				FROM definitions d
+				JOIN languages l ON l.langid = d.langid
+				WHERE d.valsiid = v.valsiid AND lower(l.tag) = $2
+				ORDER BY d.definitionnum, d.definitionid
+				LIMIT 1
+			) def ON TRUE`, date, language).Scan(&wotd.ValsiID, &wotd.Word, &wotd.Type, &wotd.Rafsi,
+			&wotd.DefinitionID, &wotd.Definition, &wotd.Language)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.NewNotFoundError(fmt.Sprintf("no words are defined in language %q", language), nil)
+		}
+		if err != nil {
+			return nil, apperror.NewDatabaseError("failed to pick the word of the day", err)
+		}
+		return wotd, nil
+	})
+}
@@ -0,0 +1,170 @@
+// Package webpush, as part of the notifications module.
+// This file, `client.go`, delivers messages to the push services of browsers (Mozilla's,
+// Google's, Apple's...), which pass them on to the browser whenever it is online, even with the
+// website closed.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/user/lensisku-go/config"
+)
+
+// Urgency values of RFC 8030; push services may hold back less urgent messages to save the
+// device's battery.
+const (
+	UrgencyNormal = "normal"
+	UrgencyHigh   = "high"
+)
+
+// ErrGone reports that the push service no longer knows the subscription: the user revoked
+// the permission, or the browser dropped it. It is to be deleted.
+var ErrGone = errors.New("push subscription expired or unsubscribed")
+
+// PermanentError reports a message the push service refused and would refuse again.
+type PermanentError struct {
+	Status int
+	Body   string
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("push service refused the message with status %d: %s", e.Status, e.Body)
+}
+
+// pushServiceHosts are the domains of the browsers' push services. Endpoints elsewhere are
+// refused: the server would otherwise POST signed requests to any URL a user registers.
+var pushServiceHosts = []string{
+	"fcm.googleapis.com",        // Chrome, Edge on Android, Opera...
+	"push.services.mozilla.com", // Firefox (autopush)
+	"push.apple.com",            // Safari
+	"notify.windows.com",        // Edge on Windows (WNS)
+	"android.googleapis.com",    // Older Chrome subscriptions
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), private in practice though
+// netip doesn't count it so.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// ErrEndpointNotAllowed reports an endpoint outside the known push services.
+var ErrEndpointNotAllowed = errors.New("endpoint isn't a known push service")
+
+// checkEndpoint returns ErrEndpointNotAllowed unless `endpoint` is an https URL on the default
+// port of a push service's domain or one of its subdomains.
+func checkEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return ErrEndpointNotAllowed
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range pushServiceHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return ErrEndpointNotAllowed
+}
+
+// refusePrivateAddresses is the dialer's Control hook: even a push service's name mustn't lead
+// the server to its own network, should its DNS say so.
+func refusePrivateAddresses(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	ip := addrPort.Addr().Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+// Client sends Web Push messages.
+type Client struct {
+	cfg  *config.WebPushConfig
+	keys *vapidKeys
+	http *http.Client
+}
+
+// NewClient creates a Client with the VAPID keys of `cfg`, which it checks.
+func NewClient(cfg *config.WebPushConfig) (*Client, error) {
+	keys, err := parseVAPIDKeys(cfg.VAPIDPublicKey, cfg.VAPIDPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: cfg.Timeout, Control: refusePrivateAddresses}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // The proxy would connect on our behalf, past the dialer's check
+	transport.DialContext = dialer.DialContext
+	return &Client{cfg: cfg, keys: keys, http: &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: transport,
+		// A push service has no reason to redirect; following one would skip checkEndpoint.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}, nil
+}
+
+// PublicKey returns the VAPID public key, which browsers need to subscribe (the
+// `applicationServerKey` of PushManager.subscribe).
+func (c *Client) PublicKey() string {
+	return c.keys.public
+}
+
+// Send encrypts `payload` for the subscription and hands it to its push service, which keeps
+// it for up to `ttl` while the browser is offline. It returns ErrGone for a subscription to
+// delete, and a PermanentError for a message that mustn't be retried; other errors are
+// transient.
+func (c *Client) Send(ctx context.Context, sub Subscription, payload []byte, ttl time.Duration, urgency string) error {
+	if err := checkEndpoint(sub.Endpoint); err != nil {
+		return ErrGone // Registered before the check existed; drop it
+	}
+	body, err := encrypt(payload, sub.P256dh, sub.Auth)
+	if err != nil {
+		return &PermanentError{Body: err.Error()}
+	}
+	authorization, err := c.keys.authorization(sub.Endpoint, c.cfg.Subject, time.Now())
+	if err != nil {
+		return &PermanentError{Body: err.Error()}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return &PermanentError{Body: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", urgency)
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("deliver to push service: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("push service answered %d: %s", resp.StatusCode, detail)
+	default:
+		// 400, 401/403 (a VAPID problem), 413 (payload too large)...
+		return &PermanentError{Status: resp.StatusCode, Body: string(detail)}
+	}
+}
@@ -0,0 +1,188 @@
+// Package webpush, as part of the notifications module.
+// This file, `crypto.go`, implements the two pieces of cryptography of Web Push: encrypting a
+// message for one browser (RFC 8291, the "aes128gcm" content coding of RFC 8188), so the push
+// service relaying it can't read it, and signing the VAPID header (RFC 8292), which tells the
+// push service which server sends. Both use P-256 keys; the browser's come with its
+// subscription, the server's from the configuration.
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// recordSize is the record size announced in the header. A message fits in one record.
+	recordSize = 4096
+
+	// maxPayload is the largest plaintext that fits in one record: the record size, less the
+	// header, the padding delimiter and the AEAD tag. Push services may accept less.
+	maxPayload = recordSize - 86 - 1 - 16
+
+	// vapidLifetime is how long a VAPID signature is valid; RFC 8292 allows at most 24 hours.
+	vapidLifetime = 12 * time.Hour
+)
+
+// decodeKey decodes a key in base64url, with or without padding, as browsers and key
+// generators write them.
+func decodeKey(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// vapidKeys is the server's key pair.
+type vapidKeys struct {
+	signing *ecdsa.PrivateKey
+	public  string // Uncompressed point, base64url, as sent in the header
+}
+
+// parseVAPIDKeys reads the key pair of the configuration and checks that its halves belong
+// together.
+func parseVAPIDKeys(publicKey, privateKey string) (*vapidKeys, error) {
+	raw, err := decodeKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("WEBPUSH_VAPID_PRIVATE_KEY isn't base64url: %w", err)
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("WEBPUSH_VAPID_PRIVATE_KEY isn't a P-256 private key: %w", err)
+	}
+	public, err := decodeKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("WEBPUSH_VAPID_PUBLIC_KEY isn't base64url: %w", err)
+	}
+	if string(public) != string(key.PublicKey().Bytes()) {
+		return nil, errors.New("WEBPUSH_VAPID_PUBLIC_KEY isn't the public key of WEBPUSH_VAPID_PRIVATE_KEY")
+	}
+
+	// ECDSA wants the key in its own type; PKCS #8 converts between the two.
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signing, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("VAPID key isn't an ECDSA key")
+	}
+	return &vapidKeys{signing: signing, public: base64.RawURLEncoding.EncodeToString(public)}, nil
+}
+
+// authorization returns the Authorization header for a message to `endpoint`: a JWT for the
+// endpoint's origin, signed with the server's key, and the matching public key.
+func (k *vapidKeys) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidLifetime).Unix(),
+		"sub": subject,
+	})
+	signed, err := token.SignedString(k.signing)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + signed + ", k=" + k.public, nil
+}
+
+// encrypt encrypts `plaintext` for the browser with the public key `p256dh` and the secret
+// `auth` of its subscription, both base64url, and returns the request body.
+func encrypt(plaintext []byte, p256dh, auth string) ([]byte, error) {
+	// A new key pair and salt for every message.
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encryptWith(plaintext, p256dh, auth, asPrivate, salt)
+}
+
+// encryptWith is `encrypt` with the server's key pair and the salt given.
+func encryptWith(plaintext []byte, p256dh, auth string, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(plaintext) > maxPayload {
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d-byte limit", len(plaintext), maxPayload)
+	}
+	uaPublicBytes, err := decodeKey(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeKey(auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	asPublic := asPrivate.PublicKey().Bytes()
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	// RFC 8291 section 3.4: mix the auth secret into the shared secret, then derive the
+	// content encryption key and nonce of RFC 8188 from it.
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, authSecret)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublicBytes) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key ID length and key ID (the server's public key).
+	body := make([]byte, 0, 16+4+1+len(asPublic)+len(plaintext)+1+gcm.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+	// The single record ends with the delimiter of the last record, 0x02.
+	record := append(append(make([]byte, 0, len(plaintext)+1), plaintext...), 0x02)
+	return gcm.Seal(body, nonce, record, nil), nil
+}
@@ -0,0 +1,142 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The example of RFC 8291, Appendix A.
+const (
+	rfcPlaintext = "When I grow up, I want to be a watermelon"
+	rfcASPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+	rfcASPublic  = "BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"
+	rfcUAPublic  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	rfcSalt      = "DGv6ra1nlYgDCS1FRnbzlw"
+	rfcAuth      = "BTBZMqHH6r4Tts7J_aSIgg"
+	rfcBody      = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+)
+
+func mustDecodeKey(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := decodeKey(s)
+	if err != nil {
+		t.Fatalf("decodeKey(%q): %v", s, err)
+	}
+	return b
+}
+
+func TestEncryptRFC8291(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecodeKey(t, rfcASPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(asPrivate.PublicKey().Bytes()); got != rfcASPublic {
+		t.Fatalf("public key = %s, want %s", got, rfcASPublic)
+	}
+
+	body, err := encryptWith([]byte(rfcPlaintext), rfcUAPublic, rfcAuth, asPrivate, mustDecodeKey(t, rfcSalt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := base64.RawURLEncoding.EncodeToString(body); got != rfcBody {
+		t.Errorf("body = %s, want %s", got, rfcBody)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	plaintext := []byte(rfcPlaintext)
+	first, err := encrypt(plaintext, rfcUAPublic, rfcAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encrypt(plaintext, rfcUAPublic, rfcAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Salt, record size, key ID length, key ID, then the record: the plaintext, the delimiter
+	// and the tag.
+	if want := 16 + 4 + 1 + 65 + len(plaintext) + 1 + 16; len(first) != want {
+		t.Errorf("body is %d bytes, want %d", len(first), want)
+	}
+	if bytes.Equal(first[:16], second[:16]) || bytes.Equal(first[21:86], second[21:86]) {
+		t.Error("two messages share a salt or a key")
+	}
+}
+
+func TestEncryptErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		plaintext []byte
+		p256dh    string
+		auth      string
+		want      string
+	}{
+		{"too long", make([]byte, maxPayload+1), rfcUAPublic, rfcAuth, "exceeds the"},
+		{"p256dh not base64url", nil, "not base64!", rfcAuth, "invalid p256dh key"},
+		{"p256dh not a point", nil, rfcAuth, rfcAuth, "invalid p256dh key"},
+		{"auth not base64url", nil, rfcUAPublic, "not base64!", "invalid auth secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := encrypt(tt.plaintext, tt.p256dh, tt.auth)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("encrypt = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVAPID(t *testing.T) {
+	tests := []struct {
+		name    string
+		public  string
+		private string
+		wantErr string
+	}{
+		{"matching pair", rfcASPublic, rfcASPrivate, ""},
+		{"padded", rfcASPublic + "=", rfcASPrivate + "=", ""},
+		{"other public key", rfcUAPublic, rfcASPrivate, "isn't the public key of"},
+		{"private key not base64url", rfcASPublic, "not base64!", "isn't base64url"},
+		{"private key too short", rfcASPublic, rfcAuth, "isn't a P-256 private key"},
+	}
+	now := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := parseVAPIDKeys(tt.public, tt.private)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseVAPIDKeys = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header, err := keys.authorization("https://fcm.googleapis.com/fcm/send/abc", "mailto:admin@example.com", now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, public, ok := strings.Cut(strings.TrimPrefix(header, "vapid t="), ", k=")
+			if !ok || public != rfcASPublic {
+				t.Fatalf("header = %q, want the token and k=%s", header, rfcASPublic)
+			}
+			claims := jwt.MapClaims{}
+			_, err = jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (any, error) {
+				return &keys.signing.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience("https://fcm.googleapis.com"))
+			if err != nil {
+				t.Fatalf("token doesn't verify: %v", err)
+			}
+			if exp, _ := claims.GetExpirationTime(); exp == nil || !exp.Equal(now.Add(vapidLifetime).Truncate(time.Second)) {
+				t.Errorf("exp = %v, want %v", exp, now.Add(vapidLifetime))
+			}
+		})
+	}
+}
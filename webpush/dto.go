@@ -0,0 +1,61 @@
+// Package webpush, as part of the notifications module.
+// This file, `dto.go`, defines the request and response bodies of the Web Push endpoints, and
+// the message pushed to browsers.
+package webpush
+
+import "time"
+
+// SubscribeRequest is a browser's push subscription, as PushSubscription.toJSON() gives it.
+// @Description A push subscription of a browser
+type SubscribeRequest struct {
+	// URL of the push service to send the browser's messages to. Only the push services of the
+	// major browsers (Google, Mozilla, Apple, Microsoft) are accepted.
+	// example: "https://updates.push.services.mozilla.com/wpush/v2/gAAAAABh..."
+	Endpoint string `json:"endpoint" validate:"required,url,startswith=https://,max=2048"`
+	Keys     struct {
+		// The browser's P-256 public key, base64url
+		// example: "BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM"
+		P256dh string `json:"p256dh" validate:"required,max=128"`
+		// The browser's authentication secret, base64url
+		// example: "tBHItJI5svbpez7KI4CCXg"
+		Auth string `json:"auth" validate:"required,max=64"`
+	} `json:"keys"`
+}
+
+// UnsubscribeQuery names the subscription to remove.
+type UnsubscribeQuery struct {
+	Endpoint string `form:"endpoint" validate:"required,max=2048"`
+}
+
+// Subscription is a registered push subscription. Its keys are never sent back.
+// @Description A registered push subscription
+type Subscription struct {
+	// example: 12
+	ID int64 `json:"id"`
+	// example: "https://updates.push.services.mozilla.com/wpush/v2/gAAAAABh..."
+	Endpoint  string    `json:"endpoint"`
+	P256dh    string    `json:"-"`
+	Auth      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	// When a message last reached its push service
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+// PublicKeyResponse is the server's VAPID public key.
+// @Description The applicationServerKey for PushManager.subscribe
+type PublicKeyResponse struct {
+	// Uncompressed P-256 point, base64url
+	// example: "BEl62iUYgUivxIkv69yViEuiBIa-Ib9-SkvMeAtA3LFgDzkrxZJjSgSnfckjBJuBkr3qBUYIHBQFLXYp5Nksh8U"
+	PublicKey string `json:"public_key"`
+}
+
+// Message is what the service worker receives in its `push` event, as JSON: a notification
+// the user may also find at GET /api/v1/notifications.
+type Message struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	Link      *string   `json:"link,omitempty"`
+	ValsiID   *int32    `json:"valsi_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
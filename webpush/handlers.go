@@ -0,0 +1,116 @@
+// Package webpush, as part of the notifications module.
+// This file, `handlers.go`, serves the VAPID public key browsers subscribe with, and the
+// registration and removal of push subscriptions under /api/v1/notifications/push.
+package webpush
+
+import (
+	"net/http"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/auth"
+	"github.com/user/lensisku-go/render"
+	"github.com/user/lensisku-go/validation"
+)
+
+// maxUserAgent bounds the User-Agent kept with a subscription, which only helps users tell
+// their browsers apart.
+const maxUserAgent = 256
+
+// Handlers provides HTTP handlers for push subscriptions.
+type Handlers struct {
+	service *Service
+}
+
+// NewHandlers creates new Handlers.
+func NewHandlers(service *Service) *Handlers {
+	return &Handlers{service: service}
+}
+
+// HandleGetPublicKey godoc
+// @Summary Get the VAPID public key
+// @Description Returns the server's VAPID public key, to pass as `applicationServerKey` to PushManager.subscribe. Only available when Web Push is configured.
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} PublicKeyResponse "VAPID public key"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Router /api/v1/notifications/push/public-key [get]
+func (h *Handlers) HandleGetPublicKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.Write(w, r, http.StatusOK, PublicKeyResponse{PublicKey: h.service.PublicKey()})
+	}
+}
+
+// HandleSubscribe godoc
+// @Summary Register a push subscription
+// @Description Registers the browser's push subscription, the JSON of PushSubscription, for the authenticated user. Mentions and decisions on the user's definition edits and examples are then pushed to the browser. Registering an endpoint again replaces its keys; a user keeps at most 20 subscriptions, the oldest being dropped.
+// @Tags notifications
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param subscription body SubscribeRequest true "Push subscription"
+// @Success 201 {object} Subscription "Registered subscription"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Invalid subscription"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/notifications/push/subscriptions [post]
+func (h *Handlers) HandleSubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		var req SubscribeRequest
+		if err := validation.DecodeJSON(r, &req); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+		userAgent := r.UserAgent()
+		if len(userAgent) > maxUserAgent {
+			userAgent = userAgent[:maxUserAgent]
+		}
+
+		sub, err := h.service.Subscribe(r.Context(), userID, req, userAgent)
+		if err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		render.Write(w, r, http.StatusCreated, sub)
+	}
+}
+
+// HandleUnsubscribe godoc
+// @Summary Remove a push subscription
+// @Description Stops pushing to the browser with the given endpoint, as after PushSubscription.unsubscribe. Subscriptions the push service reports gone are removed without this.
+// @Tags notifications
+// @Security BearerAuth
+// @Param endpoint query string true "Endpoint of the subscription"
+// @Success 204 "Subscription removed"
+// @Failure 400 {object} apperror.ErrorResponse "Bad Request - Missing endpoint"
+// @Failure 401 {object} apperror.ErrorResponse "Unauthorized - Invalid or missing token"
+// @Failure 404 {object} apperror.ErrorResponse "Not Found - No such subscription of this user"
+// @Failure 500 {object} apperror.ErrorResponse "Internal Server Error"
+// @Router /api/v1/notifications/push/subscriptions [delete]
+func (h *Handlers) HandleUnsubscribe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.GetUserIDFromContext(r.Context())
+		if !ok {
+			auth.WriteError(w, r, apperror.NewUnauthorizedError("User ID not found in context, middleware issue?", nil))
+			return
+		}
+		var q UnsubscribeQuery
+		if err := validation.DecodeQuery(r, &q); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		if err := h.service.Unsubscribe(r.Context(), userID, q.Endpoint); err != nil {
+			auth.WriteError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,285 @@
+// Package webpush delivers the notifications that shouldn't wait for the user to come back to
+// the website, mentions and moderation decisions, to their browsers through Web Push.
+// This file, `service.go`, keeps the browsers' subscriptions and feeds the sender. On the
+// leader instance, a poller takes the new notifications of the types in `PushTypes` and queues
+// one job per subscription of their recipient; the job workers encrypt and deliver them,
+// retrying while the push service is unavailable, and delete subscriptions it reports gone.
+// Claiming a notification and queueing its jobs happen in one transaction, so each is pushed
+// once, whichever code path wrote it.
+package webpush
+
+import (
+	"context"
+	"crypto/ecdh"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/user/lensisku-go/apperror"
+	"github.com/user/lensisku-go/config"
+	"github.com/user/lensisku-go/db"
+	"github.com/user/lensisku-go/jobs"
+	"github.com/user/lensisku-go/leader"
+	"github.com/user/lensisku-go/logging"
+	"github.com/user/lensisku-go/notifications"
+)
+
+// SendJobType is the job type of one message to one subscription; the payload is a `sendJob`.
+const SendJobType = "webpush.send"
+
+// PushTypes are the notification types delivered by Web Push. Migration 000041 indexes the
+// notifications waiting to be pushed by the same list.
+var PushTypes = []string{
+	notifications.TypeMention,
+	notifications.TypeRevisionApproved,
+	notifications.TypeRevisionRejected,
+	notifications.TypeExampleApproved,
+	notifications.TypeExampleRejected,
+}
+
+// pendingFilter selects the notifications waiting to be pushed. The types are spelled out,
+// rather than passed as a parameter, so the planner uses the partial index.
+var pendingFilter = func() string {
+	quoted := make([]string, len(PushTypes))
+	for i, t := range PushTypes {
+		quoted[i] = "'" + t + "'"
+	}
+	return "pushed_at IS NULL AND notification_type IN (" + strings.Join(quoted, ", ") + ")"
+}()
+
+const (
+	// claimBatchSize is how many notifications one poll takes at most.
+	claimBatchSize = 500
+
+	// maxSubscriptions caps the subscriptions of a user; subscribing another browser drops
+	// the oldest.
+	maxSubscriptions = 20
+)
+
+// sendJob is the payload of a SendJobType job.
+type sendJob struct {
+	NotificationID int64 `json:"notification_id"`
+	SubscriptionID int64 `json:"subscription_id"`
+}
+
+// Service manages push subscriptions and delivery.
+type Service struct {
+	db     *pgxpool.Pool
+	queue  *jobs.Queue
+	client *Client
+	cfg    *config.WebPushConfig
+	logger *slog.Logger
+}
+
+// NewService creates a Service delivering through `client`.
+func NewService(db *pgxpool.Pool, queue *jobs.Queue, client *Client, cfg *config.WebPushConfig) *Service {
+	return &Service{db: db, queue: queue, client: client, cfg: cfg, logger: logging.For("webpush")}
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with.
+func (s *Service) PublicKey() string {
+	return s.client.PublicKey()
+}
+
+// Subscribe registers a browser's subscription for `userID`. An endpoint registered before,
+// by this user or another, is taken over with its new keys.
+func (s *Service) Subscribe(ctx context.Context, userID int, req SubscribeRequest, userAgent string) (*Subscription, error) {
+	if err := checkEndpoint(req.Endpoint); err != nil {
+		return nil, apperror.NewValidationError("endpoint must be the URL of a browser push service", err)
+	}
+	if key, err := decodeKey(req.Keys.P256dh); err != nil {
+		return nil, apperror.NewValidationError("keys.p256dh must be a base64url P-256 public key", err)
+	} else if _, err := ecdh.P256().NewPublicKey(key); err != nil {
+		return nil, apperror.NewValidationError("keys.p256dh must be a base64url P-256 public key", err)
+	}
+	if secret, err := decodeKey(req.Keys.Auth); err != nil || len(secret) != 16 {
+		return nil, apperror.NewValidationError("keys.auth must be a base64url 16-byte secret", err)
+	}
+
+	var sub Subscription
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+			ON CONFLICT (endpoint) DO UPDATE
+			SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth,
+			    user_agent = EXCLUDED.user_agent, created_at = NOW(), last_success_at = NULL
+			RETURNING id, endpoint, created_at, last_success_at`,
+			userID, req.Endpoint, req.Keys.P256dh, req.Keys.Auth, userAgent).Scan(&sub.ID, &sub.Endpoint, &sub.CreatedAt, &sub.LastSuccessAt)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to save push subscription", err)
+		}
+		_, err = tx.Exec(ctx, `
+			DELETE FROM push_subscriptions
+			WHERE user_id = $1 AND id NOT IN (
+				SELECT id FROM push_subscriptions WHERE user_id = $1
+				ORDER BY created_at DESC, id DESC LIMIT $2)`, userID, maxSubscriptions)
+		if err != nil {
+			return apperror.NewDatabaseError("failed to drop old push subscriptions", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Unsubscribe removes the subscription of `userID` with the given endpoint.
+func (s *Service) Unsubscribe(ctx context.Context, userID int, endpoint string) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM push_subscriptions WHERE user_id = $1 AND endpoint = $2`, userID, endpoint)
+	if err != nil {
+		return apperror.NewDatabaseError("failed to delete push subscription", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.NewNotFoundError("push subscription not found", nil)
+	}
+	return nil
+}
+
+// Start polls for notifications to push every WEBPUSH_POLL_INTERVAL, on the leader only, until
+// `stopChan` is closed.
+func (s *Service) Start(elector *leader.Elector, stopChan <-chan struct{}) {
+	go func() {
+		defer s.logger.Info("Web Push poller stopped")
+		ticker := time.NewTicker(s.cfg.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			if elector.IsLeader() {
+				queued, err := s.RunOnce(context.Background())
+				if err != nil {
+					s.logger.Error("Web Push poll failed", "error", err)
+				} else if queued > 0 {
+					s.logger.Debug("Web Push messages queued", "queued", queued)
+				}
+			}
+
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce takes the notifications waiting to be pushed and queues a message for each
+// subscription of their recipients, and returns how many it queued. A subscription only gets
+// the notifications that came after it, and notifications older than WEBPUSH_TTL are taken
+// without being pushed.
+func (s *Service) RunOnce(ctx context.Context) (int, error) {
+	queued := 0
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			WITH claimed AS (
+				UPDATE notifications SET pushed_at = NOW()
+				WHERE id IN (
+					SELECT id FROM notifications WHERE `+pendingFilter+`
+					ORDER BY id LIMIT $1
+					FOR UPDATE SKIP LOCKED)
+				RETURNING id, user_id, created_at
+			)
+			SELECT c.id, s.id
+			FROM claimed c
+			JOIN push_subscriptions s ON s.user_id = c.user_id AND s.created_at <= c.created_at
+			WHERE c.created_at > $2
+			ORDER BY c.id, s.id`, claimBatchSize, time.Now().Add(-s.cfg.TTL))
+		if err != nil {
+			return apperror.NewDatabaseError("failed to claim notifications to push", err)
+		}
+		var pending []sendJob
+		for rows.Next() {
+			var job sendJob
+			if err := rows.Scan(&job.NotificationID, &job.SubscriptionID); err != nil {
+				rows.Close()
+				return apperror.NewDatabaseError("failed to read notifications to push", err)
+			}
+			pending = append(pending, job)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return apperror.NewDatabaseError("failed to claim notifications to push", err)
+		}
+
+		for _, job := range pending {
+			if _, err := s.queue.EnqueueTx(ctx, tx, SendJobType, job, &jobs.EnqueueOptions{Priority: jobs.PriorityHigh}); err != nil {
+				return err
+			}
+		}
+		queued = len(pending)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return queued, nil
+}
+
+// SendJobHandler delivers queued messages. A subscription the push service reports gone is
+// deleted; a message whose notification has outlived WEBPUSH_TTL meanwhile is dropped.
+func (s *Service) SendJobHandler() jobs.HandlerFunc {
+	return func(ctx context.Context, job *jobs.Job) error {
+		var payload sendJob
+		if err := job.Decode(&payload); err != nil {
+			return jobs.Permanent(fmt.Errorf("invalid push job payload: %w", err))
+		}
+
+		var msg Message
+		err := s.db.QueryRow(ctx, `
+			SELECT id, notification_type, message, link, valsi_id, created_at
+			FROM notifications WHERE id = $1`, payload.NotificationID).Scan(
+			&msg.ID, &msg.Type, &msg.Message, &msg.Link, &msg.ValsiID, &msg.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil // Deleted with its user
+		}
+		if err != nil {
+			return fmt.Errorf("load notification %d: %w", payload.NotificationID, err)
+		}
+		var sub Subscription
+		err = s.db.QueryRow(ctx, `
+			SELECT id, endpoint, p256dh, auth, created_at, last_success_at
+			FROM push_subscriptions WHERE id = $1`, payload.SubscriptionID).Scan(
+			&sub.ID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.CreatedAt, &sub.LastSuccessAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil // Unsubscribed meanwhile
+		}
+		if err != nil {
+			return fmt.Errorf("load push subscription %d: %w", payload.SubscriptionID, err)
+		}
+
+		ttl := s.cfg.TTL - time.Since(msg.CreatedAt)
+		if ttl <= 0 {
+			return nil
+		}
+		body, err := json.Marshal(msg)
+		if err != nil {
+			return jobs.Permanent(err)
+		}
+
+		err = s.client.Send(ctx, sub, body, ttl, UrgencyHigh)
+		var permanent *PermanentError
+		switch {
+		case errors.Is(err, ErrGone):
+			s.logger.Info("Deleting expired push subscription", "subscription_id", sub.ID)
+			if _, err := s.db.Exec(ctx, `DELETE FROM push_subscriptions WHERE id = $1`, sub.ID); err != nil {
+				return fmt.Errorf("delete push subscription %d: %w", sub.ID, err)
+			}
+			return nil
+		case errors.As(err, &permanent):
+			return jobs.Permanent(err)
+		case err != nil:
+			return err
+		}
+		if _, err := s.db.Exec(ctx, `UPDATE push_subscriptions SET last_success_at = NOW() WHERE id = $1`, sub.ID); err != nil {
+			s.logger.Warn("Failed to record push delivery", "subscription_id", sub.ID, "error", err)
+		}
+		return nil
+	}
+}